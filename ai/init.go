@@ -9,17 +9,17 @@ import (
 
 func Init() {
 
-	database.AIsByMap = make([]map[int16][]*database.AI, database.SERVER_COUNT+1)
-	for s := 0; s <= database.SERVER_COUNT; s++ {
+	database.AIsByMap = make([]map[int16][]*database.AI, database.MAX_SERVER+1)
+	for s := 0; s <= database.MAX_SERVER; s++ {
 		database.AIsByMap[s] = make(map[int16][]*database.AI)
 	}
 
-	database.DungeonsByMap = make([]map[int16]int, database.SERVER_COUNT+1)
-	for s := 0; s <= database.SERVER_COUNT; s++ {
+	database.DungeonsByMap = make([]map[int16]int, database.MAX_SERVER+1)
+	for s := 0; s <= database.MAX_SERVER; s++ {
 		database.DungeonsByMap[s] = make(map[int16]int)
 	}
-	database.DungeonsAiByMap = make([]map[int16][]*database.AI, database.SERVER_COUNT+1)
-	for s := 0; s <= database.SERVER_COUNT; s++ {
+	database.DungeonsAiByMap = make([]map[int16][]*database.AI, database.MAX_SERVER+1)
+	for s := 0; s <= database.MAX_SERVER; s++ {
 		database.DungeonsAiByMap[s] = make(map[int16][]*database.AI)
 	}
 
@@ -39,6 +39,7 @@ func Init() {
 				server.GenerateIDForNPC(pos)
 			}
 		}
+		database.IndexNPCPositions()
 
 		database.NPCs, err = database.GetAllNPCs()
 		if err != nil {
@@ -54,6 +55,7 @@ func Init() {
 
 		for _, ai := range database.AIs {
 			database.AIsByMap[ai.Server][ai.Map] = append(database.AIsByMap[ai.Server][ai.Map], ai)
+			ai.SetCoordinate(database.ConvertPointToLocation(ai.Coordinate))
 		}
 
 		for _, AI := range database.AIs {
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net"
+	"strconv"
 
+	"hero-server/config"
 	"hero-server/database"
 
 	"github.com/thoas/go-funk"
@@ -14,11 +16,8 @@ import (
 
 type ApiService struct{}
 
-const (
-	port = ":9000"
-)
-
 func InitGRPC() {
+	port := ":" + strconv.Itoa(config.Default.API.Port)
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
@@ -129,7 +128,7 @@ func (s *ApiService) GetServers(ctx context.Context, req *Empty) (*GetServerResp
 
 func (s *ApiService) GetTavern(ctx context.Context, req *Empty) (*GetTavernResponse, error) {
 
-	items := funk.Values(database.HTItems).([]*database.HtItem)
+	items := database.AllHTItems()
 	items = funk.Filter(items, func(i *database.HtItem) bool {
 		return i.IsActive
 	}).([]*database.HtItem)
@@ -139,7 +138,7 @@ func (s *ApiService) GetTavern(ctx context.Context, req *Empty) (*GetTavernRespo
 
 	for _, i := range items {
 		title := titles[i.HTID/1000]
-		info := database.Items[int64(i.ID)]
+		info := database.FindItem(int64(i.ID))
 
 		quantity := int16(1)
 		if info.Timer > 0 {
@@ -1,45 +1,28 @@
 package auth
 
 import (
+	"hero-server/codec"
 	"hero-server/database"
 	"hero-server/logging"
 	"hero-server/messaging"
-	"hero-server/utils"
 )
 
 type CancelCharacterCreationHandler struct {
 }
 
 type CharacterCreationHandler struct {
-	characterType int
-	faction       int
-	height        int
-	name          string
 }
 
-var (
-	CHARACTER_CREATED = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x01, 0x03, 0x0A, 0x00, 0x00, 0x00, 0x55, 0xAA}
-)
-
 func (ccch *CancelCharacterCreationHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 
 	lch := &ListCharactersHandler{}
 	return lch.showCharacterMenu(s)
 }
 
-func (cch *CharacterCreationHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
-
-	index := 7
-	length := int(data[index])
-	index += 1
-
-	cch.name = string(data[8 : length+8])
-	index += len(cch.name)
-
-	cch.characterType = int(data[index])
-	index += 1
+func (cch *CharacterCreationHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
+	req := msg.(*codec.CreateCharacterRequest)
 
-	if cch.characterType == 52 { // Monk creation
+	if req.Type == 52 { // Monk creation
 		return messaging.SystemMessage(messaging.INCORRECT_REGISTRATION), nil
 	}
 
@@ -48,35 +31,30 @@ func (cch *CharacterCreationHandler) Handle(s *database.Socket, data []byte) ([]
 		return nil, err
 	}
 
+	faction := int(req.Faction)
 	if len(characters) > 0 {
-		cch.faction = characters[0].Faction
-	} else {
-		cch.faction = int(data[index])
+		faction = characters[0].Faction
 	}
-	index += 1
-
-	cch.height = int(data[index])
-	index += 1
 
 	// TODO => FACE AND HEAD
 
-	return cch.createCharacter(s)
+	return cch.createCharacter(s, req.Name, int(req.Type), faction, int(req.Height))
 }
 
-func (cch *CharacterCreationHandler) createCharacter(s *database.Socket) ([]byte, error) {
+func (cch *CharacterCreationHandler) createCharacter(s *database.Socket, name string, characterType, faction, height int) ([]byte, error) {
 	//s.CharacterMutex.Lock()
 	//defer s.CharacterMutex.Unlock()
 
-	ok, err := database.IsValidUsername(cch.name)
+	ok, err := database.IsValidUsername(name)
 	if err != nil {
 		return nil, err
 	} else if !ok {
 		return messaging.SystemMessage(messaging.INVALID_NAME), nil
-	} else if cch.faction == 0 {
+	} else if faction == 0 {
 		return messaging.SystemMessage(messaging.EMPTY_FACTION), nil
 	}
 
-	coordinate := database.SavePoints[1]
+	coordinate := database.FindSavePoint(1)
 	/*
 		if err != nil {
 			return nil, err
@@ -84,12 +62,12 @@ func (cch *CharacterCreationHandler) createCharacter(s *database.Socket) ([]byte
 	*/
 
 	character := &database.Character{
-		Type:           cch.characterType,
+		Type:           characterType,
 		UserID:         s.User.ID,
-		Name:           cch.name,
+		Name:           name,
 		Epoch:          0,
-		Faction:        cch.faction,
-		Height:         cch.height,
+		Faction:        faction,
+		Height:         height,
 		Level:          1,
 		Class:          0,
 		IsOnline:       false,
@@ -122,7 +100,7 @@ func (cch *CharacterCreationHandler) createCharacter(s *database.Socket) ([]byte
 	//character.AddItem(&database.InventorySlot{ItemID: 17402452, Quantity: 10080}, -1, false)
 	//character.AddItem(&database.InventorySlot{ItemID: 17402453, Quantity: 10080}, -1, false)
 
-	switch cch.characterType {
+	switch characterType {
 
 	case 52:
 		character.AddItem(&database.InventorySlot{ItemID: 100031129, Quantity: 10080}, -1, false)
@@ -205,15 +183,7 @@ func (cch *CharacterCreationHandler) createCharacter(s *database.Socket) ([]byte
 		return nil, err
 	}
 
-	resp := CHARACTER_CREATED
-	length := int16(len(cch.name)) + 10
-	resp.SetLength(length)
-
-	resp.Insert(utils.IntToBytes(uint64(character.ID), 4, true), 9) // character id
-
-	resp[13] = byte(len(cch.name)) // character name length
-
-	resp.Insert([]byte(cch.name), 14) // character name
+	resp := codec.Encode(&codec.CharacterCreated{CharacterID: character.ID, Name: name})
 
 	lch := &ListCharactersHandler{}
 	data, err := lch.showCharacterMenu(s)
@@ -221,7 +191,7 @@ func (cch *CharacterCreationHandler) createCharacter(s *database.Socket) ([]byte
 		return nil, err
 	}
 
-	logger.Log(logging.ACTION_CREATE_CHARACTER, character.ID, "Character created", s.User.ID, cch.name)
+	logging.Emit(character.Event(logging.ACTION_CREATE_CHARACTER, "Character created"))
 	resp.Concat(data)
 	return resp, nil
 }
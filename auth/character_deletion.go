@@ -99,7 +99,7 @@ func (cdh *CharacterDeletionHandler) deleteCharacter(s *database.Socket) ([]byte
 			return nil, err
 		}
 
-		logger.Log(logging.ACTION_DELETE_CHARACTER, character.ID, "Character deleted", s.User.ID, cdh.name)
+		logging.Emit(character.Event(logging.ACTION_DELETE_CHARACTER, "Character deleted"))
 		resp.Concat(data)
 	}
 
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 
@@ -74,14 +73,18 @@ func (csh *CharacterSelectionHandler) selectCharacter(s *database.Socket) ([]byt
 			return
 		}
 
-		s.HoustonSub, err = nats.Connection().Subscribe(nats.HOUSTON_CH, func(msg *NATS.Msg) {
+		// Global casts come from the Houston channel, near casts from the grid
+		// cells around the character (subscribed by Socket.UpdateInterest).
+		s.CastHandler = func(msg *NATS.Msg) {
 			err := HoustonHandler(s, msg)
 			if err != nil {
 				//log.Println("Err: ", err)
 				s.OnClose() // Check issue
 				return
 			}
-		})
+		}
+
+		s.HoustonSub, err = nats.Connection().Subscribe(nats.HOUSTON_CH, s.CastHandler)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -97,14 +100,11 @@ func (csh *CharacterSelectionHandler) selectCharacter(s *database.Socket) ([]byt
 		return nil, err
 	}
 
-	//go s.ResetPacketCount()
-
 	return CHARACTER_SELECTED, nil
 }
 
 func HoustonHandler(s *database.Socket, msg *NATS.Msg) error {
-	var packet nats.CastPacket
-	err := json.Unmarshal(msg.Data, &packet)
+	packet, err := nats.DecodeCastPacket(msg.Data)
 	if err != nil {
 		return err
 	}
@@ -4,75 +4,64 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"time"
 
+	"hero-server/codec"
+	"hero-server/config"
 	"hero-server/database"
 	"hero-server/logging"
+	"hero-server/security"
+	"hero-server/server"
 	"hero-server/utils"
 
 	"gopkg.in/guregu/null.v3"
 )
 
 type LoginHandler struct {
-	password string
-	username string
 }
 
 var (
-	USER_NOT_FOUND = utils.Packet{0xAA, 0x55, 0x23, 0x00, 0x00, 0x01, 0x00, 0x1F, 0x4D, 0x69, 0x73, 0x6D, 0x61, 0x74, 0x63, 0x68, 0x20, 0x41, 0x63, 0x63, 0x6F, 0x75, 0x6E, 0x74, 0x20, 0x49, 0x44, 0x20, 0x6F, 0x72, 0x20, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6F, 0x72, 0x64, 0x55, 0xAA}
-	LOGGED_IN      = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x00, 0x01, 0x01, 0x40, 0x35, 0x46, 0x45, 0x43, 0x45, 0x42, 0x36, 0x36, 0x46, 0x46, 0x43, 0x38, 0x36, 0x46, 0x33, 0x38, 0x44, 0x39, 0x35, 0x32, 0x37, 0x38, 0x36, 0x43, 0x36, 0x44, 0x36, 0x39, 0x36, 0x43, 0x37, 0x39, 0x43, 0x32, 0x44, 0x42, 0x43, 0x32, 0x33, 0x39, 0x44, 0x44, 0x34, 0x45, 0x39, 0x31, 0x42, 0x34, 0x36, 0x37, 0x32, 0x39, 0x44, 0x37, 0x33, 0x41, 0x32, 0x37, 0x46, 0x42, 0x35, 0x37, 0x45, 0x39, 0x55, 0xAA}
-	USER_BANNED    = utils.Packet{0xAA, 0x55, 0x36, 0x00, 0x00, 0x01, 0x00, 0x32, 0x59, 0x6F, 0x75, 0x72, 0x20, 0x61, 0x63, 0x63, 0x6F, 0x75, 0x6E, 0x74, 0x20, 0x68, 0x61, 0x73, 0x20, 0x62, 0x65, 0x65, 0x6E, 0x20, 0x64, 0x69, 0x73, 0x61, 0x62, 0x6C, 0x65, 0x64, 0x20, 0x75, 0x6E, 0x74, 0x69, 0x6C, 0x20, 0x5B, 0x5D, 0x2E, 0x55, 0xAA}
-
-	logger = logging.Logger
+	USER_NOT_FOUND    = codec.Encode(&codec.LoginFailed{Message: "Mismatch Account ID or Password"})
+	TOO_MANY_ATTEMPTS = codec.Encode(&codec.LoginFailed{Message: "Too many failed logins, please try again later."})
 
 	logins      = make(map[string]string)
 	loginsMutex sync.RWMutex
 )
 
-func (lh *LoginHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
-	index := 7
-	uNameLen := int(utils.BytesToInt(data[index:index+1], false))
-	lh.username = string(data[index+1 : index+uNameLen+1])
-	lh.password = string(data[index+uNameLen+2 : index+uNameLen+66])
-
-	return lh.login(s)
+func (lh *LoginHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
+	req := msg.(*codec.LoginRequest)
+	return lh.login(s, req.Username, req.Password)
 }
 
-func (lh *LoginHandler) login(s *database.Socket) ([]byte, error) {
+func (lh *LoginHandler) login(s *database.Socket, username, password string) ([]byte, error) {
+
+	ip := security.IP(s.ClientAddr)
+	if !security.LoginAllowed(username, ip) {
+		logging.Emit(&logging.Event{Action: logging.ACTION_LOGIN, Message: fmt.Sprintf("Login of %s from %s throttled", username, ip)})
+		return TOO_MANY_ATTEMPTS, nil
+	}
 
-	user, err := database.FindUserByName(lh.username)
+	user, err := database.FindUserByName(username)
 	if err != nil {
 		s.Conn.Close()
 		return nil, err
 	}
 
 	if user == nil {
-		if lh.password == "E29095B49C4CCF7A449EA5593E63B18418EE22C8F67D1693873EF2C2C41CF179" {
-
-			user = &database.User{
-				Username:    lh.username,
-				UserType:    5,
-				Password:    lh.password,
-				ConnectedIP: "",
-			}
-		} else {
-			time.Sleep(time.Second / 2)
-			return USER_NOT_FOUND, nil
-		}
+		database.CheckDummyPassword(password)
+		security.LoginFailed(username, ip)
+		return USER_NOT_FOUND, nil
 	}
 
 	var resp utils.Packet
-	// Check if password matches the stored password or the special password
-	if strings.Compare(lh.password, user.Password) == 0 || lh.password == "E29095B49C4CCF7A449EA5593E63B18418EE22C8F67D1693873EF2C2C41CF179" {
-		go logging.AddLogFile(8, lh.username+" TO ID "+s.ClientAddr+" logged in from that IP successfully.")
+	if user.CheckPassword(password) {
+		security.LoginSucceeded(username)
 		if user.UserType == 0 { // Banned
-			resp = USER_BANNED
-			resp.Insert([]byte(parseDate(user.DisabledUntil)), 0x2E) // ban duration
-			return resp, nil
+			msg := "Your account has been disabled until [" + parseDate(user.DisabledUntil) + "]."
+			return codec.Encode(&codec.LoginFailed{Message: msg}), nil
 		}
 
 		if user.ConnectedIP != "" { // user already online
-			logger.Log(logging.ACTION_LOGIN, 0, "Multiple login", user.ID, "Login")
+			logging.Emit(&logging.Event{Action: logging.ACTION_LOGIN, UserID: user.ID, Message: fmt.Sprintf("Multiple login from %s", ip)})
 			s.Conn.Close()
 			user.Logout()
 			if sock := database.GetSocket(user.ID); sock != nil {
@@ -85,12 +74,10 @@ func (lh *LoginHandler) login(s *database.Socket) ([]byte, error) {
 			return nil, nil
 		}
 
-		if lh.password == "E29095B49C4CCF7A449EA5593E63B18418EE22C8F67D1693873EF2C2C41CF179" {
-			user.UserType = 5
-		}
+		applyAdminList(user)
 
-		logger.Log(logging.ACTION_LOGIN, 0, "Login successful", user.ID, "Login")
-		resp = LOGGED_IN
+		logging.Emit(&logging.Event{Action: logging.ACTION_LOGIN, UserID: user.ID, Message: fmt.Sprintf("Logged in from %s", ip)})
+		resp = codec.Encode(&codec.LoginOK{Username: username})
 		s.User = user
 		s.User.ConnectedIP = s.ClientAddr
 
@@ -104,13 +91,9 @@ func (lh *LoginHandler) login(s *database.Socket) ([]byte, error) {
 		}(user.Username, s.ClientAddr)
 
 		go s.User.Update()
-
-		length := int16(len(lh.username) + 68)
-		resp.SetLength(length)
-		resp.Insert([]byte(lh.username), 7)
 	} else { // login failed
-		logger.Log(logging.ACTION_LOGIN, 0, "Login failed.", user.ID, "Login")
-		time.Sleep(time.Second / 2)
+		logging.Emit(&logging.Event{Action: logging.ACTION_LOGIN, UserID: user.ID, Message: fmt.Sprintf("Login failed from %s", ip)})
+		security.LoginFailed(username, ip)
 		resp = USER_NOT_FOUND
 		s.Conn.Close()
 	}
@@ -118,6 +101,24 @@ func (lh *LoginHandler) login(s *database.Socket) ([]byte, error) {
 	return resp, nil
 }
 
+// applyAdminList gives GM rights to the accounts in the admin list of the
+// config and takes them from every other account. Without a list the user
+// types of the database are kept.
+func applyAdminList(user *database.User) {
+	admins := config.Default.Auth.Admins
+	if len(admins) == 0 {
+		return
+	}
+
+	userType, ok := admins[strings.ToLower(user.Username)]
+	if ok {
+		user.UserType = userType
+	} else if user.UserType >= server.GA_USER {
+		logging.Emit(&logging.Event{Action: logging.ACTION_LOGIN, UserID: user.ID, Message: fmt.Sprintf("User type %d is not in the admin list", user.UserType)})
+		user.UserType = server.COMMON_USER
+	}
+}
+
 func parseDate(date null.Time) string {
 	if date.Valid {
 		year, month, day := date.Time.Date()
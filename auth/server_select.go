@@ -39,7 +39,7 @@ func (ssh *SelectServerHandler) selectServer(s *database.Socket) ([]byte, error)
 	port := config.Default.Server.Port
 	resp.Insert(utils.IntToBytes(uint64(port), 4, true), index)
 
-	logger.Log(logging.ACTION_SELECT_SERVER, 0, fmt.Sprintf("Server selected: %d", ssh.server), s.User.ID, "Server Select")
+	logging.Emit(&logging.Event{Action: logging.ACTION_SELECT_SERVER, UserID: s.User.ID, Message: fmt.Sprintf("Server %d selected", ssh.server)})
 
 	s.User.ConnectingTo = ssh.server
 	s.User.ConnectingIP = s.ClientAddr
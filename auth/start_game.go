@@ -123,7 +123,7 @@ func (csh *StartGameHandler) startGame(s *database.Socket) ([]byte, error) {
 	}
 
 	if s.Character.Map == 76 {
-		if s.Character.Faction != database.GoldenBasinArea.FactionID {
+		if !database.CanEnterGoldenBasin(s.Character) {
 			s.Character.Map = 1
 			s.Character.Coordinate = database.ConvertPointToCoordinate(324, 189)
 		}
@@ -159,8 +159,6 @@ func (csh *StartGameHandler) startGame(s *database.Socket) ([]byte, error) {
 	}
 
 	//s.Character.PartyMode = 33
-	s.Character.IsinWar = false
-	s.Character.IsinLastMan = false
 	s.Character.HasLot = false
 	s.Character.IsOnline = true
 	s.Character.Respawning = false
@@ -346,7 +344,7 @@ func (csh *StartGameHandler) startGame(s *database.Socket) ([]byte, error) {
 
 	go s.Character.ActivityStatus(30)
 
-	logger.Log(logging.ACTION_START_GAME, s.Character.ID, "Started the game", s.User.ID, s.Character.Name)
+	logging.Emit(s.Character.Event(logging.ACTION_START_GAME, "Started the game"))
 	return nil, nil
 }
 
@@ -485,7 +483,7 @@ func exploreMobs(s *database.Socket) {
 		database.AIMutex.Unlock()
 
 		/*
-			if c.IsinWar {
+			if c.InBattleground(database.BATTLEGROUND_WAR) {
 				isStone := Tester(database.WarStonesIDs, mob.PseudoID)
 				if isStone {
 					delete(c.OnSight.Mobs, id)
@@ -555,7 +553,7 @@ func exploreMobs(s *database.Socket) {
 			r.Insert(utils.FloatToBytes(coordinate.Y, 4, true), index) // coordinate-y
 			index += 4
 			r.SetLength(int16(index + 16))
-			if c.IsinWar {
+			if c.InBattleground(database.BATTLEGROUND_WAR) {
 				isStone := Tester(database.WarStonesIDs, mob.PseudoID)
 				if isStone {
 					if c.Faction == 1 {
@@ -612,7 +610,7 @@ func exploreMobs(s *database.Socket) {
 		database.AIMutex.Unlock()
 		coordinate := database.ConvertPointToLocation(loser.Coordinate)
 
-		if c.IsinWar {
+		if c.InBattleground(database.BATTLEGROUND_WAR) {
 			isStone := Tester(database.WarStonesIDs, loser.PseudoID)
 			if isStone {
 				if c.Faction == 1 {
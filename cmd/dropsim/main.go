@@ -0,0 +1,125 @@
+// Command dropsim kills an npc, or rolls a drop group, many times with the
+// drop tables of the database and prints how often every item dropped.
+// Run it from the server directory to get the item names from the items
+// sheet.
+//
+//	dropsim -dsn "postgres://..." -npc 41941 -level 80 -kills 100000
+//	dropsim -dsn "postgres://..." -group 9000001 -members 3 -quests 12
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"hero-server/database"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	var (
+		dsn        = flag.String("dsn", "", "postgres connection string")
+		npcID      = flag.Int("npc", 0, "npc id, rolled with its data.npc_drops rules")
+		groupID    = flag.Int("group", 0, "drop group id, rolled once per kill")
+		kills      = flag.Int("kills", 10000, "number of kills")
+		level      = flag.Int("level", 0, "level of the characters, the npc level by default")
+		mapID      = flag.Int("map", 0, "map of the kills, for data.drop_map_rates")
+		rate       = flag.Float64("rate", 1, "server drop rate")
+		multiplier = flag.Float64("multiplier", 1, "drop multiplier of the character")
+		pickaxe    = flag.Bool("pickaxe", false, "the character's pickaxe is active")
+		members    = flag.Int("members", 1, "party members near, for the per member groups")
+		quests     = flag.String("quests", "", "comma separated quests the characters are on")
+		seed       = flag.Int64("seed", 0, "random seed, the time by default")
+	)
+	flag.Parse()
+
+	if *dsn == "" || (*npcID == 0) == (*groupID == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conn, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer conn.Close()
+	database.UseConnection(conn)
+
+	if _, err := os.Stat("data/tb_ItemTable_Normal.xlsx"); err == nil {
+		if err := database.LoadTables("items"); err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		log.Println("No items sheet in data/, item names are left out")
+	}
+	if err := database.LoadTables("drops", "npc_drops", "drop_map_rates"); err != nil {
+		log.Fatalln(err)
+	}
+	database.SetRates(0, *rate, 0)
+
+	rule := database.NPCDrop{GroupID: *groupID, MaxRolls: 1}
+	if *npcID != 0 {
+		npcs, err := database.GetAllNPCs()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		npc := npcs[*npcID]
+		if npc == nil {
+			log.Fatalf("unknown npc %d", *npcID)
+		}
+
+		rule = database.NPCDropRule(npc)
+		if *level == 0 {
+			*level = int(npc.Level)
+		}
+		if !rule.InLevelGap(*level, int(npc.Level)) {
+			log.Fatalf("level %d is over the level gap of %s (%d)", *level, npc.Name, npc.Level)
+		}
+		fmt.Printf("%s (%d), level %d, group %d, %d-%d rolls\n", npc.Name, npc.ID, npc.Level, rule.GroupID, rule.MinRolls, rule.MaxRolls)
+	}
+
+	onQuest := make(map[int]bool)
+	for _, q := range strings.Split(*quests, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(q)); err == nil {
+			onQuest[id] = true
+		}
+	}
+
+	if *pickaxe {
+		rule.Multiplier += rule.Pickaxe
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	roll := &database.DropRoll{
+		Rate:     rule.DropRate(int16(*mapID), *multiplier),
+		Excluded: database.ExcludedDrops(int16(*mapID)),
+		Rand:     rand.New(rand.NewSource(*seed)),
+	}
+	for i := 0; i < *members; i++ {
+		roll.Members = append(roll.Members, &database.DropMember{Level: *level, HasQuest: func(id int) bool { return onQuest[id] }})
+	}
+
+	stats := database.SimulateDrops(roll, rule, *kills)
+	fmt.Printf("%d kills at rate %.2f\n\n", *kills, roll.Rate)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tNAME\tPER KILL\tCHANCE\tONE IN")
+	for _, s := range stats {
+		name := ""
+		if item, ok := database.GetItemInfo(int64(s.ItemID)); ok {
+			name = item.Name
+		}
+		fmt.Fprintf(w, "%d\t%s\t%.4f\t%.2f%%\t%.1f\n", s.ItemID, name, float64(s.Quantity)/float64(*kills),
+			100*float64(s.Kills)/float64(*kills), float64(*kills)/float64(s.Kills))
+	}
+	w.Flush()
+}
@@ -0,0 +1,113 @@
+// Command events searches the event log of the game server, either the json
+// lines files or the hops.events table.
+//
+//	events -name Foo -action trade,buy_cons_item -since 48h
+//	events -dsn "postgres://..." -item 203001001 -limit 20 -json
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"hero-server/logging"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	var (
+		file      = flag.String("file", "events.jsonl", "event log file, its rotated backups are read too")
+		dsn       = flag.String("dsn", "", "postgres connection string, reads hops.events instead of the file")
+		user      = flag.String("user", "", "user id")
+		character = flag.Int("character", 0, "character id, as the actor or the target")
+		name      = flag.String("name", "", "character name")
+		actions   = flag.String("action", "", "comma separated actions")
+		item      = flag.Int64("item", 0, "item id")
+		since     = flag.String("since", "", "RFC3339 time or a duration before now (24h)")
+		until     = flag.String("until", "", "RFC3339 time or a duration before now")
+		limit     = flag.Int("limit", 100, "number of most recent events, 0 for all")
+		asJSON    = flag.Bool("json", false, "print json lines")
+	)
+	flag.Parse()
+
+	filter := &logging.Filter{UserID: *user, CharacterID: *character, CharacterName: *name, ItemID: *item}
+	for _, a := range strings.Split(*actions, ",") {
+		if a == "" {
+			continue
+		}
+		action, err := logging.ParseAction(a)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		filter.Actions = append(filter.Actions, action)
+	}
+
+	var err error
+	if filter.Since, err = parseTime(*since); err != nil {
+		log.Fatalln(err)
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		log.Fatalln(err)
+	}
+
+	var events []*logging.Event
+	if *dsn != "" {
+		var db *sql.DB
+		if db, err = sql.Open("postgres", *dsn); err != nil {
+			log.Fatalln(err)
+		}
+		defer db.Close()
+		events, err = logging.QueryPostgres(db, filter, *limit)
+	} else {
+		events, err = logging.ReadFiles(*file, filter, *limit)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range events {
+			enc.Encode(e)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tUSER\tCHARACTER\tMAP\tGOLD\tITEMS\tMESSAGE")
+	for _, e := range events {
+		character := ""
+		if e.CharacterID != 0 {
+			character = fmt.Sprintf("%s (%d)", e.CharacterName, e.CharacterID)
+		}
+		items := ""
+		if len(e.ItemIDs) > 0 {
+			items = fmt.Sprint(e.ItemIDs)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d (%.1f,%.1f)\t%d\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"),
+			e.Action, e.UserID, character, e.Map, e.X, e.Y, e.Gold, items, e.Message)
+	}
+	w.Flush()
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s, use RFC3339 or a duration", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,70 @@
+// Command navgrid turns a walkability image of a map into the row of
+// data.nav_grids. Every pixel is a cell, dark pixels are blocked; the top
+// row of the image is the lowest y unless -flip is set.
+//
+//	navgrid -map 1 -image map1.png -cell 2 > map1.sql
+//	psql -f map1.sql
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"log"
+	"os"
+)
+
+func main() {
+	var (
+		mapID = flag.Int("map", 0, "map id")
+		path  = flag.String("image", "", "png image of the map, dark pixels are blocked")
+		cell  = flag.Float64("cell", 1, "size of a pixel in map units")
+		minX  = flag.Float64("minx", 0, "x of the left edge of the image")
+		minY  = flag.Float64("miny", 0, "y of the first row of the image")
+		flip  = flag.Bool("flip", false, "the bottom row of the image is the lowest y")
+	)
+	flag.Parse()
+
+	if *mapID <= 0 || *path == "" || *cell <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	cells := make([]byte, (width*height+7)/8)
+	open := 0
+	for y := 0; y < height; y++ {
+		row := y
+		if *flip {
+			row = height - 1 - y
+		}
+		for x := 0; x < width; x++ {
+			if color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+row)).(color.Gray).Y < 128 {
+				continue
+			}
+			i := y*width + x
+			cells[i/8] |= 1 << uint(i%8)
+			open++
+		}
+	}
+
+	fmt.Printf("delete from data.nav_grids where map_id = %d;\n", *mapID)
+	fmt.Printf("insert into data.nav_grids (map_id, min_x, min_y, cell_size, width, height, cells) values (%d, %v, %v, %v, %d, %d, '\\x%s');\n",
+		*mapID, *minX, *minY, *cell, width, height, hex.EncodeToString(cells))
+	log.Printf("Map %d: %dx%d cells, %d walkable", *mapID, width, height, open)
+}
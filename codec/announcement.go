@@ -0,0 +1,26 @@
+package codec
+
+const (
+	ANNOUNCEMENT  = 0x7106
+	DUNGEON_TIMER = 0xC017
+)
+
+// Announcement is the yellow text in the middle of the screen.
+type Announcement struct {
+	Message string
+}
+
+func (m *Announcement) Encode(w *Writer) {
+	w.Opcode(ANNOUNCEMENT)
+	w.String8(m.Message)
+}
+
+// DungeonTimer sets the countdown shown in a dungeon.
+type DungeonTimer struct {
+	Seconds uint32
+}
+
+func (m *DungeonTimer) Encode(w *Writer) {
+	w.Opcode(DUNGEON_TIMER)
+	w.U32(m.Seconds)
+}
@@ -0,0 +1,81 @@
+package codec
+
+const (
+	LOGIN              = 0x0000
+	LOGIN_RESULT       = 0x0001
+	CREATE_CHARACTER   = 0x0103
+	PASSWORD_HASH_SIZE = 64
+)
+
+func init() {
+	Register(func() Request { return &LoginRequest{} }, LOGIN)
+	Register(func() Request { return &CreateCharacterRequest{} }, CREATE_CHARACTER)
+}
+
+// LoginRequest carries the user name and the hex encoded password hash.
+type LoginRequest struct {
+	Username string
+	Password string
+}
+
+func (m *LoginRequest) Decode(r *Reader) error {
+	r.Skip(1)
+	m.Username = r.String8()
+	r.Skip(1) // hash length, always 64
+	m.Password = string(r.Bytes(PASSWORD_HASH_SIZE))
+	return r.Err()
+}
+
+// LoginOK lets the client continue to the server list. The token is a
+// constant the client expects after the user name.
+type LoginOK struct {
+	Username string
+}
+
+const loginToken = "5FECEB66FFC86F38D952786C6D696C79C2DBC239DD4E91B46729D73A27FB57E9"
+
+func (m *LoginOK) Encode(w *Writer) {
+	w.Opcode(LOGIN_RESULT)
+	w.U8(1)
+	w.Bytes([]byte(m.Username))
+	w.String8(loginToken)
+}
+
+// LoginFailed shows Message in the login dialog.
+type LoginFailed struct {
+	Message string
+}
+
+func (m *LoginFailed) Encode(w *Writer) {
+	w.Opcode(LOGIN_RESULT)
+	w.U8(0)
+	w.String8(m.Message)
+}
+
+type CreateCharacterRequest struct {
+	Name    string
+	Type    byte
+	Faction byte
+	Height  byte
+}
+
+func (m *CreateCharacterRequest) Decode(r *Reader) error {
+	r.Skip(1)
+	m.Name = r.String8()
+	m.Type = r.U8()
+	m.Faction = r.U8()
+	m.Height = r.U8()
+	return r.Err()
+}
+
+type CharacterCreated struct {
+	CharacterID int
+	Name        string
+}
+
+func (m *CharacterCreated) Encode(w *Writer) {
+	w.Opcode(CREATE_CHARACTER)
+	w.Bytes([]byte{0x0A, 0x00, 0x00})
+	w.U32(uint32(m.CharacterID))
+	w.String8(m.Name)
+}
@@ -0,0 +1,29 @@
+package codec
+
+const (
+	STRENGTHEN = 0x5402
+)
+
+func init() {
+	Register(func() Request { return &StrengthenRequest{} }, STRENGTHEN)
+}
+
+// StrengthenRequest upgrades the item in SlotID with the stones in
+// StoneSlots. LuckSlot and ProtectionSlot are 0 when not used.
+type StrengthenRequest struct {
+	SlotID         int64
+	StoneSlots     []int64
+	LuckSlot       int64
+	ProtectionSlot int64
+}
+
+func (m *StrengthenRequest) Decode(r *Reader) error {
+	m.SlotID = int64(r.U16())
+	count := int(r.U8())
+	for i := 0; i < count && r.Err() == nil; i++ {
+		m.StoneSlots = append(m.StoneSlots, int64(r.U16()))
+	}
+	m.LuckSlot = int64(r.U16())
+	m.ProtectionSlot = int64(r.U16())
+	return r.Err()
+}
@@ -0,0 +1,212 @@
+// Package codec declares the client messages as structs and converts them
+// from and to 0xAA55 frames. Readers are bounds checked, a truncated frame
+// ends in an error instead of a slice panic, and writers fill in the length
+// and the footer so responses no longer have to copy and patch shared
+// templates.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"hero-server/utils"
+)
+
+const (
+	HEADER_SIZE = 6 // 0xAA 0x55, length, opcode
+	FOOTER_SIZE = 2 // 0x55 0xAA
+)
+
+var (
+	ErrShortFrame    = errors.New("frame too short")
+	ErrBadHeader     = errors.New("frame does not start with 0xAA55")
+	ErrUnknownOpcode = errors.New("unknown opcode")
+)
+
+// Opcode returns the opcode of a frame, bytes [4:6] in big endian.
+func Opcode(frame []byte) (uint16, error) {
+	if len(frame) < HEADER_SIZE {
+		return 0, ErrShortFrame
+	} else if frame[0] != 0xAA || frame[1] != 0x55 {
+		return 0, ErrBadHeader
+	}
+	return binary.BigEndian.Uint16(frame[4:6]), nil
+}
+
+// Reader reads the fields of a frame after the header. The first read past
+// the end of the frame sets Err and every later read returns zero values.
+type Reader struct {
+	data   []byte
+	pos    int
+	opcode uint16
+	err    error
+}
+
+func NewReader(frame []byte) (*Reader, error) {
+	opcode, err := Opcode(frame)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{data: frame, pos: HEADER_SIZE, opcode: opcode}, nil
+}
+
+func (r *Reader) Opcode() uint16 {
+	return r.opcode
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+func (r *Reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("%w: opcode %d needs %d bytes at offset %d, frame has %d", ErrShortFrame, r.opcode, n, r.pos, len(r.data))
+		return nil
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *Reader) Skip(n int) {
+	r.take(n)
+}
+
+func (r *Reader) U8() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *Reader) Bool() bool {
+	return r.U8() == 1
+}
+
+func (r *Reader) U16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *Reader) U32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *Reader) U64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// F32 reads a float32, the coordinates of the client are single precision.
+func (r *Reader) F32() float64 {
+	return float64(math.Float32frombits(r.U32()))
+}
+
+// Bytes returns a copy of the next n bytes.
+func (r *Reader) Bytes(n int) []byte {
+	b := r.take(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// String8 reads a string prefixed with its length in one byte.
+func (r *Reader) String8() string {
+	n := int(r.U8())
+	return string(r.take(n))
+}
+
+func (r *Reader) Location() utils.Location {
+	return utils.Location{X: r.F32(), Y: r.F32()}
+}
+
+// Writer builds a frame. Encode methods write everything after the length,
+// starting with the opcode; Frame adds the length and the footer.
+type Writer struct {
+	buf []byte
+}
+
+func NewWriter() *Writer {
+	return &Writer{buf: []byte{0xAA, 0x55, 0x00, 0x00}}
+}
+
+// Opcode writes the two opcode bytes in big endian like the client sends them.
+func (w *Writer) Opcode(opcode uint16) {
+	w.buf = append(w.buf, byte(opcode>>8), byte(opcode))
+}
+
+func (w *Writer) U8(v byte) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.U8(1)
+	} else {
+		w.U8(0)
+	}
+}
+
+func (w *Writer) U16(v uint16) {
+	w.buf = append(w.buf, byte(v), byte(v>>8))
+}
+
+func (w *Writer) U32(v uint32) {
+	w.buf = append(w.buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (w *Writer) U64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *Writer) F32(v float64) {
+	w.U32(math.Float32bits(float32(v)))
+}
+
+func (w *Writer) Bytes(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+func (w *Writer) Zero(n int) {
+	w.buf = append(w.buf, make([]byte, n)...)
+}
+
+// String8 writes a string prefixed with its length in one byte, longer
+// strings are cut at 255 bytes.
+func (w *Writer) String8(s string) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	w.U8(byte(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *Writer) Location(l utils.Location) {
+	w.F32(l.X)
+	w.F32(l.Y)
+}
+
+// Frame returns the finished frame. The length field counts the opcode and
+// the body, i.e. everything between the length and the footer.
+func (w *Writer) Frame() utils.Packet {
+	frame := make(utils.Packet, 0, len(w.buf)+FOOTER_SIZE)
+	frame = append(frame, w.buf...)
+	binary.LittleEndian.PutUint16(frame[2:4], uint16(len(frame)-4))
+	return append(frame, 0x55, 0xAA)
+}
@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"hero-server/utils"
+)
+
+func TestDecodeLogin(t *testing.T) {
+	hash := bytes.Repeat([]byte{'A'}, PASSWORD_HASH_SIZE)
+	w := NewWriter()
+	w.Opcode(LOGIN)
+	w.U8(0)
+	w.String8("player")
+	w.U8(PASSWORD_HASH_SIZE)
+	w.Bytes(hash)
+
+	msg, err := Decode(w.Frame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := msg.(*LoginRequest)
+	if !ok {
+		t.Fatalf("got %T, want *LoginRequest", msg)
+	}
+	if req.Username != "player" || req.Password != string(hash) {
+		t.Fatalf("got %+v", req)
+	}
+}
+
+func TestDecodeMovement(t *testing.T) {
+	from, to := utils.Location{X: 100.5, Y: 200.25}, utils.Location{X: 110, Y: 190.75}
+	w := NewWriter()
+	w.Opcode(RUN)
+	w.Location(from)
+	w.Zero(4)
+	w.Location(to)
+
+	msg, err := Decode(w.Frame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := msg.(*MovementRequest)
+	if req.Opcode != RUN || req.From != from || req.To != to {
+		t.Fatalf("got %+v", req)
+	}
+}
+
+func TestDecodeStrengthen(t *testing.T) {
+	w := NewWriter()
+	w.Opcode(STRENGTHEN)
+	w.U16(3)
+	w.U8(2)
+	w.U16(4)
+	w.U16(5)
+	w.U16(6)
+	w.U16(0)
+
+	msg, err := Decode(w.Frame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := msg.(*StrengthenRequest)
+	if req.SlotID != 3 || len(req.StoneSlots) != 2 || req.StoneSlots[1] != 5 || req.LuckSlot != 6 || req.ProtectionSlot != 0 {
+		t.Fatalf("got %+v", req)
+	}
+}
+
+func TestDecodeShortFrame(t *testing.T) {
+	frames := []utils.Packet{
+		{0xAA, 0x55, 0x00},
+		{0xAA, 0x55, 0x02, 0x00, 0x22, 0x02, 0x55, 0xAA},                   // movement without coordinates
+		{0xAA, 0x55, 0x04, 0x00, 0x00, 0x00, 0x00, 0x10, 0x41, 0x55, 0xAA}, // user name longer than the frame
+		{0xAA, 0x55, 0x05, 0x00, 0x54, 0x02, 0x01, 0x00, 0xFF, 0x55, 0xAA}, // 255 stones
+	}
+	for _, frame := range frames {
+		if _, err := Decode(frame); !errors.Is(err, ErrShortFrame) {
+			t.Errorf("% X: got %v, want ErrShortFrame", []byte(frame), err)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode([]byte{0x55, 0xAA, 0x00, 0x00, 0x00, 0x00}); !errors.Is(err, ErrBadHeader) {
+		t.Errorf("got %v, want ErrBadHeader", err)
+	}
+	if _, err := Decode([]byte{0xAA, 0x55, 0x02, 0x00, 0xFF, 0xFE, 0x55, 0xAA}); !errors.Is(err, ErrUnknownOpcode) {
+		t.Errorf("got %v, want ErrUnknownOpcode", err)
+	}
+}
+
+// The encoders must produce the same bytes as the templates they replace.
+func TestEncodeMatchesTemplates(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Response
+		want utils.Packet
+	}{
+		{"user not found", &LoginFailed{Message: "Mismatch Account ID or Password"}, utils.Packet{0xAA, 0x55, 0x23, 0x00, 0x00, 0x01, 0x00, 0x1F, 0x4D, 0x69, 0x73, 0x6D, 0x61, 0x74, 0x63, 0x68, 0x20, 0x41, 0x63, 0x63, 0x6F, 0x75, 0x6E, 0x74, 0x20, 0x49, 0x44, 0x20, 0x6F, 0x72, 0x20, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6F, 0x72, 0x64, 0x55, 0xAA}},
+		{"announcement", &Announcement{Message: "Hi"}, utils.Packet{0xAA, 0x55, 0x05, 0x00, 0x71, 0x06, 0x02, 'H', 'i', 0x55, 0xAA}},
+		{"dungeon timer", &DungeonTimer{Seconds: 1800}, utils.Packet{0xAA, 0x55, 0x06, 0x00, 0xC0, 0x17, 0x08, 0x07, 0x00, 0x00, 0x55, 0xAA}},
+		{"trade request", &TradeRequested{PseudoID: 0x1234}, utils.Packet{0xAA, 0x55, 0x06, 0x00, 0x53, 0x01, 0x0A, 0x00, 0x34, 0x12, 0x55, 0xAA}},
+		{"trade rejected", &TradeAccepted{PseudoID: 7}, utils.Packet{0xAA, 0x55, 0x07, 0x00, 0x53, 0x09, 0x0A, 0x00, 0x07, 0x00, 0x00, 0x55, 0xAA}},
+		{"character created", &CharacterCreated{CharacterID: 5, Name: "ab"}, utils.Packet{0xAA, 0x55, 0x0C, 0x00, 0x01, 0x03, 0x0A, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x02, 'a', 'b', 0x55, 0xAA}},
+	}
+	for _, test := range tests {
+		if got := Encode(test.msg); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got % X, want % X", test.name, []byte(got), []byte(test.want))
+		}
+	}
+}
+
+func TestStringIsCut(t *testing.T) {
+	frame := Encode(&Announcement{Message: string(bytes.Repeat([]byte{'x'}, 300))})
+	if len(frame) != HEADER_SIZE+1+255+FOOTER_SIZE || frame[6] != 255 {
+		t.Fatalf("got frame of %d bytes with length byte %d", len(frame), frame[6])
+	}
+}
@@ -0,0 +1,50 @@
+package codec
+
+import "hero-server/utils"
+
+const (
+	WALK = 0x2201
+	RUN  = 0x2202
+	FLY  = 0x2604
+)
+
+func init() {
+	Register(func() Request { return &MovementRequest{} }, WALK, RUN, FLY)
+}
+
+type MovementRequest struct {
+	Opcode uint16
+	From   utils.Location
+	To     utils.Location
+}
+
+func (m *MovementRequest) Decode(r *Reader) error {
+	m.Opcode = r.Opcode()
+	m.From = r.Location()
+	r.Skip(4) // height
+	m.To = r.Location()
+	return r.Err()
+}
+
+// CharacterMoved is broadcast to the players around. The pseudo id sits
+// between the two opcode bytes of the request, the second one is the
+// movement mode.
+type CharacterMoved struct {
+	Opcode   uint16
+	PseudoID uint16
+	From     utils.Location
+	To       utils.Location
+	Speed    float64
+}
+
+func (m *CharacterMoved) Encode(w *Writer) {
+	w.U8(byte(m.Opcode >> 8))
+	w.U16(m.PseudoID)
+	w.U8(byte(m.Opcode))
+	w.Location(m.From)
+	w.Zero(4)
+	w.Location(m.To)
+	w.Bytes([]byte{0xC8, 0xB0, 0xFE, 0xBE})
+	w.F32(m.Speed)
+	w.Zero(2)
+}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"fmt"
+	"sync"
+
+	"hero-server/utils"
+)
+
+// Request is a message sent by the client. Decode reads the fields after the
+// header and returns the reader's error (or its own validation error).
+type Request interface {
+	Decode(r *Reader) error
+}
+
+// Response is a message sent by the server. Encode writes the opcode and the
+// body, Encode(m) turns it into a frame.
+type Response interface {
+	Encode(w *Writer)
+}
+
+var (
+	requests = make(map[uint16]func() Request)
+	regMutex sync.RWMutex
+)
+
+// Register declares the request struct of the given opcodes.
+func Register(newRequest func() Request, opcodes ...uint16) {
+	regMutex.Lock()
+	defer regMutex.Unlock()
+
+	for _, opcode := range opcodes {
+		if _, ok := requests[opcode]; ok {
+			panic(fmt.Sprintf("codec: opcode %d registered twice", opcode))
+		}
+		requests[opcode] = newRequest
+	}
+}
+
+func Registered(opcode uint16) bool {
+	regMutex.RLock()
+	defer regMutex.RUnlock()
+	_, ok := requests[opcode]
+	return ok
+}
+
+// Decode parses a frame into the request struct registered for its opcode.
+func Decode(frame []byte) (Request, error) {
+	r, err := NewReader(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	regMutex.RLock()
+	newRequest, ok := requests[r.Opcode()]
+	regMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownOpcode, r.Opcode())
+	}
+
+	req := newRequest()
+	if err := req.Decode(r); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func Encode(m Response) utils.Packet {
+	w := NewWriter()
+	m.Encode(w)
+	return w.Frame()
+}
+
+// Empty is a request without fields.
+type Empty struct{}
+
+func (m *Empty) Decode(r *Reader) error {
+	return r.Err()
+}
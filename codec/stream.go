@@ -0,0 +1,52 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MAX_FRAME_SIZE is the largest frame a client may send, header and footer
+// included.
+const MAX_FRAME_SIZE = 4096
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrBadFooter     = errors.New("frame does not end with 0x55AA")
+)
+
+// ReadFrame reads the next frame from r using the length in its header, so
+// frames split over several reads or sent together in one are both handled
+// and a 0x55AA inside the body does not end the frame.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	header, err := r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != 0xAA || header[1] != 0x55 {
+		return nil, ErrBadHeader
+	}
+
+	length := int(binary.LittleEndian.Uint16(header[2:4]))
+	size := length + 4 + FOOTER_SIZE
+	if length < 2 {
+		return nil, fmt.Errorf("%w: length %d", ErrShortFrame, length)
+	} else if size > MAX_FRAME_SIZE {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: connection closed in the middle of a frame", ErrShortFrame)
+		}
+		return nil, err
+	}
+
+	if frame[size-2] != 0x55 || frame[size-1] != 0xAA {
+		return nil, ErrBadFooter
+	}
+	return frame, nil
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadFrameFragmentedAndCoalesced(t *testing.T) {
+	first := Encode(&Announcement{Message: "a\x55\xAAb"}) // footer bytes inside the body
+	second := Encode(&DungeonTimer{Seconds: 60})
+	stream := append(append([]byte{}, first...), second...)
+
+	for name, r := range map[string]io.Reader{
+		"coalesced":  bytes.NewReader(stream),
+		"fragmented": iotest.OneByteReader(bytes.NewReader(stream)),
+	} {
+		reader := bufio.NewReader(r)
+		for _, want := range [][]byte{first, second} {
+			got, err := ReadFrame(reader)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s: got % X, want % X", name, got, want)
+			}
+		}
+		if _, err := ReadFrame(reader); err != io.EOF {
+			t.Fatalf("%s: got %v at the end of the stream, want EOF", name, err)
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"bad header", []byte{0x55, 0xAA, 0x02, 0x00, 0x00, 0x00, 0x55, 0xAA}, ErrBadHeader},
+		{"bad footer", []byte{0xAA, 0x55, 0x02, 0x00, 0x00, 0x00, 0xAA, 0x55}, ErrBadFooter},
+		{"too large", []byte{0xAA, 0x55, 0xFF, 0xFF, 0x00, 0x00}, ErrFrameTooLarge},
+		{"no opcode", []byte{0xAA, 0x55, 0x00, 0x00, 0x55, 0xAA}, ErrShortFrame},
+		{"truncated", []byte{0xAA, 0x55, 0x10, 0x00, 0x00, 0x00}, ErrShortFrame},
+	}
+	for _, test := range tests {
+		if _, err := ReadFrame(bufio.NewReader(bytes.NewReader(test.input))); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package codec
+
+const (
+	TRADE_REQUEST     = 0x5301
+	TRADE_RESPONSE    = 0x5302
+	TRADE_CANCEL      = 0x5303
+	TRADE_ADD_ITEM    = 0x5304
+	TRADE_ADD_GOLD    = 0x5306
+	TRADE_REMOVE_ITEM = 0x5308
+	TRADE_ACCEPT      = 0x5309
+)
+
+func init() {
+	Register(func() Request { return &TradeRequest{} }, TRADE_REQUEST)
+	Register(func() Request { return &TradeResponse{} }, TRADE_RESPONSE)
+	Register(func() Request { return &Empty{} }, TRADE_CANCEL)
+	Register(func() Request { return &AddTradeItemRequest{} }, TRADE_ADD_ITEM)
+	Register(func() Request { return &AddTradeGoldRequest{} }, TRADE_ADD_GOLD)
+	Register(func() Request { return &RemoveTradeItemRequest{} }, TRADE_REMOVE_ITEM)
+	Register(func() Request { return &AcceptTradeRequest{} }, TRADE_ACCEPT)
+}
+
+// TradeRequest asks the character with the given pseudo id to trade.
+type TradeRequest struct {
+	PseudoID uint16
+}
+
+func (m *TradeRequest) Decode(r *Reader) error {
+	m.PseudoID = r.U16()
+	return r.Err()
+}
+
+// TradeResponse answers the trade request of the character with PseudoID.
+type TradeResponse struct {
+	Accepted bool
+	PseudoID uint16
+}
+
+func (m *TradeResponse) Decode(r *Reader) error {
+	m.Accepted = r.Bool()
+	m.PseudoID = r.U16()
+	return r.Err()
+}
+
+type AddTradeItemRequest struct {
+	SlotID      int16
+	Quantity    uint16
+	TradeSlotID int16
+}
+
+func (m *AddTradeItemRequest) Decode(r *Reader) error {
+	m.SlotID = int16(r.U16())
+	m.Quantity = r.U16()
+	m.TradeSlotID = int16(r.U16())
+	return r.Err()
+}
+
+type AddTradeGoldRequest struct {
+	Gold uint64
+}
+
+func (m *AddTradeGoldRequest) Decode(r *Reader) error {
+	m.Gold = r.U64()
+	return r.Err()
+}
+
+type RemoveTradeItemRequest struct {
+	TradeSlotID int16
+}
+
+func (m *RemoveTradeItemRequest) Decode(r *Reader) error {
+	r.Skip(4)
+	m.TradeSlotID = int16(r.U16())
+	return r.Err()
+}
+
+type AcceptTradeRequest struct {
+	Accepted bool
+}
+
+func (m *AcceptTradeRequest) Decode(r *Reader) error {
+	m.Accepted = r.Bool()
+	return r.Err()
+}
+
+// TradeRequested tells the receiver who wants to trade.
+type TradeRequested struct {
+	PseudoID uint16
+}
+
+func (m *TradeRequested) Encode(w *Writer) {
+	w.Opcode(TRADE_REQUEST)
+	w.Bytes([]byte{0x0A, 0x00})
+	w.U16(m.PseudoID)
+}
+
+type TradeStarted struct{}
+
+func (m *TradeStarted) Encode(w *Writer) {
+	w.Opcode(TRADE_RESPONSE)
+	w.Bytes([]byte{0x0A, 0x00})
+}
+
+type TradeGoldAdded struct {
+	PseudoID uint16
+	Gold     uint64
+}
+
+func (m *TradeGoldAdded) Encode(w *Writer) {
+	w.Opcode(TRADE_ADD_GOLD)
+	w.Bytes([]byte{0x0A, 0x00})
+	w.U16(m.PseudoID)
+	w.U64(m.Gold)
+}
+
+type TradeItemRemoved struct {
+	PseudoID    uint16
+	TradeSlotID int16
+}
+
+func (m *TradeItemRemoved) Encode(w *Writer) {
+	w.Opcode(TRADE_REMOVE_ITEM)
+	w.Bytes([]byte{0x0A, 0x00})
+	w.U16(m.PseudoID)
+	w.U8(byte(m.TradeSlotID))
+}
+
+// TradeAccepted shows the accept state of one side of the trade.
+type TradeAccepted struct {
+	PseudoID uint16
+	Accepted bool
+}
+
+func (m *TradeAccepted) Encode(w *Writer) {
+	w.Opcode(TRADE_ACCEPT)
+	w.Bytes([]byte{0x0A, 0x00})
+	w.U16(m.PseudoID)
+	w.Bool(m.Accepted)
+}
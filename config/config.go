@@ -1,8 +1,18 @@
 package config
 
 type config struct {
-	Database Database
-	Server   Server
+	Database  Database
+	Server    Server
+	Nats      Nats
+	Web       Web
+	API       API
+	Redis     Redis
+	Rates     Rates
+	Shutdown  Shutdown
+	RateLimit RateLimit
+	Auth      Auth
+	Events    Events
+	Movement  Movement
 }
 
 type Database struct {
@@ -23,3 +33,102 @@ type Server struct {
 	IP   string
 	Port int
 }
+
+type Nats struct {
+	Host string
+	Port int
+}
+
+type Web struct {
+	Port           int
+	Tokens         map[string]Token // name => admin api token, the name is written to the audit log
+	TrustedProxies []string         // ips or cidrs whose X-Forwarded-For is believed, none by default
+}
+
+// Token is an admin api bearer token. Only the hex encoded sha256 of the
+// token is kept in the config.
+type Token struct {
+	SHA256 string
+	Scopes []string
+}
+
+// Admin api scopes.
+const (
+	SCOPE_READ     = "read"     // list players and rates
+	SCOPE_MODERATE = "moderate" // kick, ban, mute
+	SCOPE_ECONOMY  = "economy"  // give items and gold
+	SCOPE_SERVER   = "server"   // rates, announcements, wars, data tables
+)
+
+var SCOPES = []string{SCOPE_READ, SCOPE_MODERATE, SCOPE_ECONOMY, SCOPE_SERVER}
+
+type API struct {
+	Port int
+}
+
+type Redis struct {
+	Host     string
+	Port     int
+	Password string `json:"-"`
+	Scheme   string
+	DB       int
+}
+
+type Rates struct {
+	Drop float64
+	Exp  float64
+}
+
+type Shutdown struct {
+	Countdown int // seconds players are warned before the server goes down
+	Timeout   int // seconds the save phase may take before the process exits anyway
+}
+
+// RateLimit limits the packets of a single connection with token buckets.
+// Opcodes holds limits for single opcodes, OpcodeGroups for the packets that
+// are dispatched by the first opcode byte (attacks); every other packet
+// shares the Default bucket.
+type RateLimit struct {
+	Enabled             bool
+	MaxConnectionsPerIP int // 0 means unlimited
+	Violations          int // dropped packets in a minute before the ip is blocked
+	BlockDuration       int // seconds
+	Default             Limit
+	Opcodes             map[uint16]Limit
+	OpcodeGroups        map[byte]Limit
+}
+
+type Limit struct {
+	Rate  float64 // packets per second
+	Burst int
+}
+
+type Auth struct {
+	BcryptCost            int
+	MaxLoginFailures      int             // failed logins of a user name before it is locked
+	MaxLoginFailuresPerIP int             // failed logins from an ip before it is locked
+	LoginLockout          int             // seconds
+	Admins                map[string]int8 // user name => user type, the only accounts with GM rights when set
+}
+
+// Events configures the sinks of the event log.
+type Events struct {
+	File         string // json lines file, empty disables it
+	MaxSize      int    // megabytes before the file is rotated
+	MaxBackups   int    // rotated files that are kept
+	Postgres     bool   // insert into hops.events
+	Redis        bool   // add to the Stream redis stream, needs the Redis host
+	Stream       string
+	StreamMaxLen int64 // approximate, 0 keeps every entry
+}
+
+// Movement checks the moves of the characters against the position the
+// server knows. Violations add suspicion, which is forgiven over time.
+type Movement struct {
+	Enabled   bool
+	Tolerance float64 // factor of the running speed allowed for latency
+	Slack     float64 // distance allowed on top of the speed
+	Grace     int     // milliseconds after a teleport the old position is accepted
+	KickScore float64 // suspicion that disconnects the character, 0 never does
+	Decay     float64 // suspicion forgiven per minute
+}
@@ -1,18 +1,13 @@
 package config
 
-import (
-	"log"
-	"strconv"
-)
-
 var Default = &config{
 	Database: Database{
 		Driver:          "postgres",
 		IP:              "localhost",
-		Port:            getPort(),
+		Port:            5432,
 		User:            "postgres",
-		Password:        "Aceraspire13", //database password
-		Name:            "postgres",     //database name
+		Password:        "",
+		Name:            "postgres",
 		ConnMaxIdle:     10,
 		ConnMaxOpen:     100,
 		ConnMaxLifetime: 10,
@@ -23,14 +18,82 @@ var Default = &config{
 		IP:   "127.0.0.1",
 		Port: 4510,
 	},
-}
-
-func getPort() int {
-	sPort := "5432" //database port
-	port, err := strconv.ParseInt(sPort, 10, 32)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	return int(port)
+	Nats: Nats{
+		Host: "127.0.0.1",
+		Port: 4222,
+	},
+	Web: Web{
+		Port:   4444,
+		Tokens: map[string]Token{},
+	},
+	API: API{
+		Port: 9000,
+	},
+	Redis: Redis{
+		Host:   "",
+		Port:   6379,
+		Scheme: "rediss",
+		DB:     0,
+	},
+	Rates: Rates{
+		Drop: 1.0,
+		Exp:  1.0,
+	},
+	Shutdown: Shutdown{
+		Countdown: 60,
+		Timeout:   60,
+	},
+	RateLimit: RateLimit{
+		Enabled:             true,
+		MaxConnectionsPerIP: 5,
+		Violations:          50,
+		BlockDuration:       600,
+		Default:             Limit{Rate: 60, Burst: 120},
+		Opcodes: map[uint16]Limit{
+			0:     {Rate: 0.2, Burst: 3}, // login
+			8705:  {Rate: 15, Burst: 30}, // walk
+			8706:  {Rate: 15, Burst: 30}, // run
+			9732:  {Rate: 15, Burst: 30}, // fly
+			21249: {Rate: 0.5, Burst: 2}, // trade request
+			22785: {Rate: 10, Burst: 20}, // loot
+			28929: {Rate: 2, Burst: 5},   // chat
+			28930: {Rate: 2, Burst: 5},
+			28931: {Rate: 2, Burst: 5},
+			28932: {Rate: 2, Burst: 5},
+			28933: {Rate: 2, Burst: 5},
+			28935: {Rate: 2, Burst: 5},
+			28943: {Rate: 2, Burst: 5},
+			28945: {Rate: 2, Burst: 5},
+			28946: {Rate: 2, Burst: 5},
+		},
+		OpcodeGroups: map[byte]Limit{
+			65: {Rate: 10, Burst: 20}, // attack
+			68: {Rate: 10, Burst: 20}, // instant attack
+			69: {Rate: 10, Burst: 20},
+		},
+	},
+	Auth: Auth{
+		BcryptCost:            10,
+		MaxLoginFailures:      5,
+		MaxLoginFailuresPerIP: 20,
+		LoginLockout:          900,
+		Admins:                map[string]int8{},
+	},
+	Events: Events{
+		File:         "events.jsonl",
+		MaxSize:      100,
+		MaxBackups:   10,
+		Postgres:     false,
+		Redis:        false,
+		Stream:       "events",
+		StreamMaxLen: 1000000,
+	},
+	Movement: Movement{
+		Enabled:   true,
+		Tolerance: 1.5,
+		Slack:     10,
+		Grace:     2000,
+		KickScore: 0, // log only until the map bounds are tuned
+		Decay:     10,
+	},
 }
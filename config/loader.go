@@ -0,0 +1,293 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CONFIG_FILE_ENV points to the json file used by Load when no path is given.
+	CONFIG_FILE_ENV     = "CONFIG_FILE"
+	DEFAULT_CONFIG_FILE = "config.json"
+)
+
+// Load builds Default from the given json file (if it exists) and then applies
+// the environment overrides. Secrets (database and redis passwords) are only
+// read from the environment.
+func Load(path string) error {
+	if path == "" {
+		path = os.Getenv(CONFIG_FILE_ENV)
+	}
+	if path == "" {
+		path = DEFAULT_CONFIG_FILE
+	}
+
+	if err := loadFile(path); err != nil {
+		return err
+	}
+
+	if err := loadEnv(); err != nil {
+		return err
+	}
+
+	return Default.Validate()
+}
+
+func loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Config file error: %s", err.Error())
+	}
+
+	if err = json.Unmarshal(data, Default); err != nil {
+		return fmt.Errorf("Config file %s is not valid: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+func loadEnv() error {
+	cfg := Default
+
+	strVars := map[string]*string{
+		"POSTGRES_HOST":     &cfg.Database.IP,
+		"POSTGRES_USER":     &cfg.Database.User,
+		"POSTGRES_PASSWORD": &cfg.Database.Password,
+		"POSTGRES_DB":       &cfg.Database.Name,
+		"POSTGRES_SSLMODE":  &cfg.Database.SSLMode,
+		"SERVER_IP":         &cfg.Server.IP,
+		"NATS_HOST":         &cfg.Nats.Host,
+		"REDIS_HOST":        &cfg.Redis.Host,
+		"REDIS_PASSWORD":    &cfg.Redis.Password,
+		"REDIS_SCHEME":      &cfg.Redis.Scheme,
+		"EVENTS_FILE":       &cfg.Events.File,
+	}
+
+	intVars := map[string]*int{
+		"POSTGRES_PORT":              &cfg.Database.Port,
+		"POSTGRES_MAX_IDLE":          &cfg.Database.ConnMaxIdle,
+		"POSTGRES_MAX_OPEN":          &cfg.Database.ConnMaxOpen,
+		"POSTGRES_CONN_MAX_LIFETIME": &cfg.Database.ConnMaxLifetime,
+		"SERVER_PORT":                &cfg.Server.Port,
+		"NATS_PORT":                  &cfg.Nats.Port,
+		"WEB_PORT":                   &cfg.Web.Port,
+		"API_PORT":                   &cfg.API.Port,
+		"REDIS_PORT":                 &cfg.Redis.Port,
+		"REDIS_DB":                   &cfg.Redis.DB,
+		"SHUTDOWN_COUNTDOWN":         &cfg.Shutdown.Countdown,
+		"SHUTDOWN_TIMEOUT":           &cfg.Shutdown.Timeout,
+		"MAX_CONNECTIONS_PER_IP":     &cfg.RateLimit.MaxConnectionsPerIP,
+		"BCRYPT_COST":                &cfg.Auth.BcryptCost,
+	}
+
+	floatVars := map[string]*float64{
+		"DROP_RATE": &cfg.Rates.Drop,
+		"EXP_RATE":  &cfg.Rates.Exp,
+	}
+
+	for key, ptr := range strVars {
+		if val, ok := os.LookupEnv(key); ok {
+			*ptr = val
+		}
+	}
+
+	for key, ptr := range intVars {
+		val, ok := os.LookupEnv(key)
+		if !ok || val == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("%s env variable is not a number: %s", key, val)
+		}
+		*ptr = i
+	}
+
+	for key, ptr := range floatVars {
+		val, ok := os.LookupEnv(key)
+		if !ok || val == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("%s env variable is not a number: %s", key, val)
+		}
+		*ptr = f
+	}
+
+	if val := os.Getenv("POSTGRES_DEBUG"); val != "" {
+		cfg.Database.Debug = val == "1" || val == "true"
+	}
+
+	if val := os.Getenv("EVENTS_POSTGRES"); val != "" {
+		cfg.Events.Postgres = val == "1" || val == "true"
+	}
+
+	if val := os.Getenv("EVENTS_REDIS"); val != "" {
+		cfg.Events.Redis = val == "1" || val == "true"
+	}
+
+	if val := os.Getenv("RATE_LIMIT_ENABLED"); val != "" {
+		cfg.RateLimit.Enabled = val == "1" || val == "true"
+	}
+
+	if val := os.Getenv("MOVEMENT_CHECKS_ENABLED"); val != "" {
+		cfg.Movement.Enabled = val == "1" || val == "true"
+	}
+
+	return nil
+}
+
+func (c *config) Validate() error {
+	if c.Database.IP == "" {
+		return fmt.Errorf("Config error: database host is empty")
+	}
+	if c.Database.User == "" || c.Database.Name == "" {
+		return fmt.Errorf("Config error: database user and name are required")
+	}
+	if c.Database.ConnMaxOpen <= 0 || c.Database.ConnMaxIdle < 0 || c.Database.ConnMaxIdle > c.Database.ConnMaxOpen {
+		return fmt.Errorf("Config error: invalid database pool sizes (idle=%d, open=%d)", c.Database.ConnMaxIdle, c.Database.ConnMaxOpen)
+	}
+	if c.Server.IP == "" {
+		return fmt.Errorf("Config error: server ip is empty")
+	}
+
+	ports := map[string]int{
+		"database": c.Database.Port,
+		"server":   c.Server.Port,
+		"nats":     c.Nats.Port,
+		"web":      c.Web.Port,
+		"api":      c.API.Port,
+	}
+	if c.Redis.Host != "" {
+		ports["redis"] = c.Redis.Port
+		if c.Redis.Scheme != "redis" && c.Redis.Scheme != "rediss" {
+			return fmt.Errorf("Config error: invalid redis scheme %q, redis or rediss", c.Redis.Scheme)
+		}
+	}
+
+	for name, port := range ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("Config error: invalid %s port %d", name, port)
+		}
+	}
+
+	if c.Shutdown.Countdown < 0 || c.Shutdown.Timeout <= 0 {
+		return fmt.Errorf("Config error: invalid shutdown countdown %d or timeout %d", c.Shutdown.Countdown, c.Shutdown.Timeout)
+	}
+
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Web.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Events.validate(c.Redis); err != nil {
+		return err
+	}
+
+	if m := c.Movement; m.Tolerance < 1 || m.Slack < 0 || m.Grace < 0 || m.KickScore < 0 || m.Decay < 0 {
+		return fmt.Errorf("Config error: invalid movement checks (tolerance=%v, slack=%v, grace=%d, kick=%v, decay=%v)", m.Tolerance, m.Slack, m.Grace, m.KickScore, m.Decay)
+	}
+
+	if c.Rates.Drop <= 0 || c.Rates.Exp <= 0 {
+		return fmt.Errorf("Config error: drop and exp rates must be positive (drop=%v, exp=%v)", c.Rates.Drop, c.Rates.Exp)
+	}
+
+	return nil
+}
+
+func (r *RateLimit) validate() error {
+	if r.MaxConnectionsPerIP < 0 || r.Violations <= 0 || r.BlockDuration <= 0 {
+		return fmt.Errorf("Config error: invalid rate limit (connections=%d, violations=%d, block=%d)", r.MaxConnectionsPerIP, r.Violations, r.BlockDuration)
+	}
+
+	limits := map[string]Limit{"default": r.Default}
+	for opcode, l := range r.Opcodes {
+		limits[fmt.Sprintf("opcode %d", opcode)] = l
+	}
+	for group, l := range r.OpcodeGroups {
+		limits[fmt.Sprintf("opcode group %d", group)] = l
+	}
+
+	for name, l := range limits {
+		if l.Rate <= 0 || l.Burst < 1 {
+			return fmt.Errorf("Config error: invalid %s rate limit (rate=%v, burst=%d)", name, l.Rate, l.Burst)
+		}
+	}
+	return nil
+}
+
+func (w *Web) validate() error {
+	for name, token := range w.Tokens {
+		if sum, err := hex.DecodeString(token.SHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("Config error: web token %s is not a hex encoded sha256", name)
+		}
+
+		for _, scope := range token.Scopes {
+			known := false
+			for _, s := range SCOPES {
+				known = known || s == scope
+			}
+			if !known {
+				return fmt.Errorf("Config error: web token %s has unknown scope %s", name, scope)
+			}
+		}
+	}
+
+	for _, proxy := range w.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("Config error: trusted proxy %s is not an ip or a cidr", proxy)
+		}
+	}
+	return nil
+}
+
+func (a *Auth) validate() error {
+	if a.BcryptCost < 4 || a.BcryptCost > 31 {
+		return fmt.Errorf("Config error: bcrypt cost must be between 4 and 31, got %d", a.BcryptCost)
+	}
+	if a.MaxLoginFailures <= 0 || a.MaxLoginFailuresPerIP <= 0 || a.LoginLockout <= 0 {
+		return fmt.Errorf("Config error: invalid login throttle (user=%d, ip=%d, lockout=%d)", a.MaxLoginFailures, a.MaxLoginFailuresPerIP, a.LoginLockout)
+	}
+
+	for name, userType := range a.Admins {
+		if name != strings.ToLower(name) {
+			return fmt.Errorf("Config error: admin %s is not lower case", name)
+		}
+		if userType < 2 || userType > 5 {
+			return fmt.Errorf("Config error: admin %s has invalid user type %d", name, userType)
+		}
+	}
+	return nil
+}
+
+func (e *Events) validate(redis Redis) error {
+	if e.File != "" && (e.MaxSize <= 0 || e.MaxBackups < 0) {
+		return fmt.Errorf("Config error: invalid event file rotation (size=%d, backups=%d)", e.MaxSize, e.MaxBackups)
+	}
+	if e.Redis && (redis.Host == "" || e.Stream == "") {
+		return fmt.Errorf("Config error: the redis event stream needs a redis host and a stream name")
+	}
+	if e.StreamMaxLen < 0 {
+		return fmt.Errorf("Config error: invalid event stream length %d", e.StreamMaxLen)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package config
+
+import "testing"
+
+func TestAdminsLowerCase(t *testing.T) {
+	auth := Default.Auth
+
+	auth.Admins = map[string]int8{"gm": 3}
+	if err := auth.validate(); err != nil {
+		t.Fatalf("lower case admin: %s", err)
+	}
+
+	auth.Admins = map[string]int8{"GameMaster": 3}
+	if err := auth.validate(); err == nil {
+		t.Fatal("mixed case admin was accepted")
+	}
+}
@@ -0,0 +1,374 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"hero-server/messaging"
+	"hero-server/utils"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Kinds of the achievements. Counted kinds add up, the others are done when
+// the character reaches count.
+const (
+	ACHIEVEMENT_KILL    = "kill"    // kills of the npc target, of any npc when 0
+	ACHIEVEMENT_PVP_WIN = "pvp_win" // duels won
+	ACHIEVEMENT_WAR     = "war"     // great wars joined
+	ACHIEVEMENT_ENHANCE = "enhance" // an item of target, or any, upgraded to +count
+	ACHIEVEMENT_LEVEL   = "level"   // level reached
+	ACHIEVEMENT_REBORN  = "reborn"  // reborn level reached
+)
+
+// Achievement is an achievement of data.achievements. The reward is a title
+// and, when buff_id is set, the buff of that infection for buff_duration
+// seconds (0 for ever).
+type Achievement struct {
+	ID           int    `db:"id" json:"id"`
+	Name         string `db:"name" json:"name"`
+	Kind         string `db:"kind" json:"kind"`
+	Target       int    `db:"target" json:"target"`
+	Count        int    `db:"count" json:"count"`
+	Title        string `db:"title" json:"title"`
+	BuffID       int    `db:"buff_id" json:"buff_id"`
+	BuffDuration int64  `db:"buff_duration" json:"buff_duration"`
+	Announce     bool   `db:"announce" json:"announce"` // the first character to achieve it
+}
+
+// CharacterAchievement is the progress of a character on an achievement.
+type CharacterAchievement struct {
+	ID            int       `db:"id" json:"id"`
+	CharacterID   int       `db:"character_id" json:"character_id"`
+	AchievementID int       `db:"achievement_id" json:"achievement_id"`
+	Progress      int       `db:"progress" json:"progress"`
+	Completed     bool      `db:"completed" json:"completed"`
+	CompletedAt   null.Time `db:"completed_at" json:"completed_at"`
+}
+
+// AchievementProgress is an achievement with the progress of a character.
+type AchievementProgress struct {
+	*Achievement
+	Progress    int       `json:"progress"`
+	Completed   bool      `json:"completed"`
+	CompletedAt null.Time `json:"completed_at"`
+}
+
+var (
+	Achievements      = make(map[int]*Achievement)
+	achievementsMutex sync.RWMutex
+
+	// characterAchievements caches the progress of the online characters,
+	// read on first use.
+	characterAchievements      = make(map[int]*achievementSet)
+	characterAchievementsMutex sync.Mutex
+)
+
+// achievementSet is the progress of a character by achievement id. The
+// progress is written when an achievement is completed, otherwise by
+// SaveAchievements and on logout.
+type achievementSet struct {
+	progress map[int]*CharacterAchievement
+	dirty    map[int]bool
+	mutex    sync.Mutex
+}
+
+// FindAchievement returns the achievement of the id, nil when there is none.
+func FindAchievement(id int) *Achievement {
+	achievementsMutex.RLock()
+	defer achievementsMutex.RUnlock()
+	return Achievements[id]
+}
+
+// sortedAchievements returns the achievements by id.
+func sortedAchievements() []*Achievement {
+	achievementsMutex.RLock()
+	defer achievementsMutex.RUnlock()
+
+	list := make([]*Achievement, 0, len(Achievements))
+	for _, id := range sortedIntKeys(Achievements) {
+		list = append(list, Achievements[id])
+	}
+	return list
+}
+
+func (a *CharacterAchievement) Create() error {
+	return db.Insert(a)
+}
+
+func (a *CharacterAchievement) Update() error {
+	_, err := db.Update(a)
+	return err
+}
+
+func readAchievements() (map[int]*Achievement, error) {
+	var achievements []*Achievement
+	query := `select * from data.achievements`
+
+	if _, err := db.Select(&achievements, query); err != nil {
+		return nil, fmt.Errorf("readAchievements: %s", err.Error())
+	}
+
+	m := make(map[int]*Achievement, len(achievements))
+	for _, a := range achievements {
+		m[a.ID] = a
+	}
+	return m, nil
+}
+
+func validateAchievements(v interface{}) []error {
+	achievements := v.(map[int]*Achievement)
+
+	var errs []error
+	for _, id := range sortedIntKeys(achievements) {
+		a := achievements[id]
+		switch a.Kind {
+		case ACHIEVEMENT_KILL, ACHIEVEMENT_PVP_WIN, ACHIEVEMENT_WAR, ACHIEVEMENT_ENHANCE, ACHIEVEMENT_LEVEL, ACHIEVEMENT_REBORN:
+		default:
+			errs = append(errs, fmt.Errorf("achievement %d: unknown kind %q", id, a.Kind))
+		}
+		if a.Count <= 0 {
+			errs = append(errs, fmt.Errorf("achievement %d: no count", id))
+		}
+		if a.BuffID > 0 && len(BuffInfections) > 0 && FindBuffInfection(a.BuffID) == nil {
+			errs = append(errs, fmt.Errorf("achievement %d: unknown buff %d", id, a.BuffID))
+		}
+	}
+	return errs
+}
+
+// counted tells if the progress of the kind adds up, rather than being the
+// highest value reached.
+func counted(kind string) bool {
+	return kind == ACHIEVEMENT_KILL || kind == ACHIEVEMENT_PVP_WIN || kind == ACHIEVEMENT_WAR
+}
+
+// FindCharacterAchievements returns the achievement progress of a character.
+func FindCharacterAchievements(characterID int) ([]*CharacterAchievement, error) {
+
+	var achievements []*CharacterAchievement
+	query := `select * from hops.characters_achievements where character_id = $1`
+
+	if _, err := db.Select(&achievements, query, characterID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("FindCharacterAchievements: %s", err.Error())
+	}
+
+	return achievements, nil
+}
+
+// achievementsOf returns the progress of a character, read when it isn't
+// cached. Only the sets kept are cached, for online characters.
+func achievementsOf(characterID int, keep bool) (*achievementSet, error) {
+	characterAchievementsMutex.Lock()
+	defer characterAchievementsMutex.Unlock()
+
+	if set, ok := characterAchievements[characterID]; ok {
+		return set, nil
+	}
+
+	rows, err := FindCharacterAchievements(characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &achievementSet{progress: make(map[int]*CharacterAchievement, len(rows)), dirty: make(map[int]bool)}
+	for _, a := range rows {
+		set.progress[a.AchievementID] = a
+	}
+	if keep {
+		characterAchievements[characterID] = set
+	}
+	return set, nil
+}
+
+// save writes the progress that changed. The set's mutex is held.
+func (set *achievementSet) save() error {
+	var err error
+	for id := range set.dirty {
+		p := set.progress[id]
+		if p.ID > 0 {
+			err = p.Update()
+		} else {
+			err = p.Create()
+		}
+		if err != nil {
+			return fmt.Errorf("saveAchievements: %s", err.Error())
+		}
+		delete(set.dirty, id)
+	}
+	return nil
+}
+
+// SaveAchievements writes the progress of the online characters that
+// changed since the last save.
+func SaveAchievements() {
+	characterAchievementsMutex.Lock()
+	sets := make([]*achievementSet, 0, len(characterAchievements))
+	for _, set := range characterAchievements {
+		sets = append(sets, set)
+	}
+	characterAchievementsMutex.Unlock()
+
+	for _, set := range sets {
+		set.mutex.Lock()
+		if err := set.save(); err != nil {
+			log.Println(err)
+		}
+		set.mutex.Unlock()
+	}
+}
+
+// forgetAchievements saves and drops the cached progress of c when it logs
+// out.
+func (c *Character) forgetAchievements() {
+	characterAchievementsMutex.Lock()
+	set, ok := characterAchievements[c.ID]
+	delete(characterAchievements, c.ID)
+	characterAchievementsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if err := set.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// AchievementsOf returns every achievement with the progress of the
+// character, online or not, in order.
+func AchievementsOf(characterID int) ([]*AchievementProgress, error) {
+	set, err := achievementsOf(characterID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	achievements := sortedAchievements()
+	list := make([]*AchievementProgress, 0, len(achievements))
+	for _, achievement := range achievements {
+		p := &AchievementProgress{Achievement: achievement}
+		if a := set.progress[achievement.ID]; a != nil {
+			p.Progress, p.Completed, p.CompletedAt = a.Progress, a.Completed, a.CompletedAt
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// AdvanceAchievements counts amount towards the achievements of the kind and
+// target, or sets the value reached for the kinds that aren't counted, and
+// gives the rewards of the achievements that are done.
+func (c *Character) AdvanceAchievements(kind string, target, amount int) []byte {
+	if c == nil || amount <= 0 {
+		return nil
+	}
+
+	set, err := achievementsOf(c.ID, true)
+	if err != nil {
+		return nil
+	}
+
+	var completed []*CharacterAchievement
+	set.mutex.Lock()
+	for _, a := range sortedAchievements() {
+		id := a.ID
+		if a.Kind != kind || (a.Target != 0 && a.Target != target) {
+			continue
+		}
+
+		p := set.progress[id]
+		if p == nil {
+			p = &CharacterAchievement{CharacterID: c.ID, AchievementID: id}
+			set.progress[id] = p
+		} else if p.Completed {
+			continue
+		}
+
+		value := amount
+		if counted(kind) {
+			value += p.Progress
+		}
+		if value > a.Count {
+			value = a.Count
+		}
+		if value <= p.Progress {
+			continue
+		}
+
+		p.Progress = value
+		set.dirty[id] = true
+		if p.Progress == a.Count {
+			p.Completed, p.CompletedAt = true, null.TimeFrom(time.Now().UTC())
+			completed = append(completed, p)
+		}
+	}
+
+	if len(completed) > 0 {
+		if err := set.save(); err != nil {
+			log.Println(err)
+		}
+	}
+	set.mutex.Unlock()
+
+	resp := utils.Packet{}
+	for _, p := range completed {
+		a := FindAchievement(p.AchievementID)
+		if a == nil {
+			continue
+		}
+		first := a.Announce && firstToAchieve(p)
+		resp.Concat(c.achieved(a, first))
+	}
+	return resp
+}
+
+// firstToAchieve tells if no other character completed the achievement
+// before p.
+func firstToAchieve(p *CharacterAchievement) bool {
+	query := `select count(*) from hops.characters_achievements where achievement_id = $1 and completed = true and character_id <> $2 and completed_at <= $3`
+	count, err := db.SelectInt(query, p.AchievementID, p.CharacterID, p.CompletedAt)
+	return err == nil && count == 0
+}
+
+// achieved gives the rewards of an achievement c completed.
+func (c *Character) achieved(a *Achievement, first bool) []byte {
+	resp := utils.Packet{}
+	resp.Concat(messaging.InfoMessage(fmt.Sprintf("Achievement completed: %s.", a.Name)))
+	if a.Title != "" {
+		resp.Concat(messaging.InfoMessage(fmt.Sprintf("You earned the title [%s].", a.Title)))
+	}
+
+	if infection := FindBuffInfection(a.BuffID); infection != nil {
+		buff := &Buff{ID: infection.ID, CharacterID: c.ID, Name: a.Name, StartedAt: c.Epoch, Duration: a.BuffDuration, CanExpire: a.BuffDuration > 0,
+			ATK: infection.BaseATK, ArtsATK: infection.BaseArtsATK, DEF: infection.BaseDef, ArtsDEF: infection.ArtsDEF,
+			MaxHP: infection.MaxHP, HPRecoveryRate: infection.HPRecoveryRate, STR: infection.STR, DEX: infection.DEX, INT: infection.INT,
+			Accuracy: infection.Accuracy, Dodge: infection.DodgeRate, RunningSpeed: infection.MovSpeed}
+
+		var err error
+		if old, _ := FindBuffByID(infection.ID, c.ID); old != nil {
+			err = buff.Update()
+		} else {
+			err = buff.Create()
+		}
+		if err == nil && c.Socket != nil && c.Socket.Stats != nil {
+			if stats, err := c.GetStats(); err == nil {
+				resp.Concat(stats)
+			}
+		}
+	}
+
+	if first {
+		MakeAnnouncement(fmt.Sprintf("%s is the first to achieve %s!", c.Name, a.Name))
+	}
+	return resp
+}
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -22,9 +22,16 @@ type Fusion struct {
 }
 
 var (
-	Fusions = make(map[int64]*Fusion)
+	Fusions      = make(map[int64]*Fusion)
+	fusionsMutex sync.RWMutex
 )
 
+func FindFusion(id int64) *Fusion {
+	fusionsMutex.RLock()
+	defer fusionsMutex.RUnlock()
+	return Fusions[id]
+}
+
 func (e *Fusion) Create() error {
 	return db.Insert(e)
 }
@@ -43,20 +50,17 @@ func (e *Fusion) Delete() error {
 	return err
 }
 
-func getAdvancedFusions() error {
+func readFusions() (map[int64]*Fusion, error) {
 	var fusions []*Fusion
 	query := `select * from data.advanced_fusion`
 
 	if _, err := db.Select(&fusions, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getProductions: %s", err.Error())
+		return nil, fmt.Errorf("readFusions: %s", err.Error())
 	}
 
+	m := make(map[int64]*Fusion, len(fusions))
 	for _, f := range fusions {
-		Fusions[f.Item1] = f
+		m[f.Item1] = f
 	}
-
-	return nil
+	return m, nil
 }
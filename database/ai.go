@@ -47,23 +47,6 @@ type AI struct {
 	Once           bool                `db:"-"`
 }
 
-type DungeonMobsCounter struct {
-	BlackBandits int
-	Rogues       int
-	Ghosts       int
-	Animals      int
-
-	BlackBanditsLeader int
-	RogueKingsLeader   int
-	GhostWarriorKing   int
-	BeastMaster        int
-	Paechun            int
-}
-
-type AchievementMobCounter struct {
-	WolfPup int
-}
-
 var (
 	AIs      = make(map[int]*AI)
 	AIMutex  sync.RWMutex
@@ -72,17 +55,9 @@ var (
 	DungeonsAiByMap []map[int16][]*AI
 	DungeonsByMap   []map[int16]int
 
-	YingYangMobsCounter = make(map[int16]*DungeonMobsCounter)
-	YingYangMobsMutex   sync.RWMutex
-
 	AchievementAiByMap []map[int16][]*AI
 	AchievementsByMap  []map[int16]int
 
-	AchievementMobsCounter = make(map[int16]*AchievementMobCounter)
-	AchievementMobsMutex   sync.RWMutex
-
-	eventBosses = []int{1338006, 1338007, 18600007}
-
 	MOB_MOVEMENT    = utils.Packet{0xAA, 0x55, 0x21, 0x00, 0x33, 0x00, 0xBC, 0xDB, 0x9F, 0x41, 0x52, 0x70, 0xA2, 0x41, 0x00, 0x55, 0xAA}
 	MOB_ATTACK      = utils.Packet{0xAA, 0x55, 0x0C, 0x00, 0x41, 0x01, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x55, 0xAA}
 	MOB_SKILL       = utils.Packet{0xAA, 0x55, 0x1B, 0x00, 0x42, 0x0A, 0x00, 0xDF, 0x28, 0xFA, 0xBE, 0x01, 0x01, 0x55, 0xAA}
@@ -116,6 +91,7 @@ func FindAIByID(ID int) *AI {
 
 func (ai *AI) SetCoordinate(coordinate *utils.Location) {
 	ai.Coordinate = fmt.Sprintf("(%.1f,%.1f)", coordinate.X, coordinate.Y)
+	AIGrid.Move(ai.ID, ai.Server, ai.Map, coordinate)
 }
 
 func (ai *AI) Create() error {
@@ -154,13 +130,18 @@ func (ai *AI) FindTargetCharacterID() (int, error) {
 	maxCoordinate := ConvertPointToLocation(npcPos.MaxLocation)
 	aiCoordinate := ConvertPointToLocation(ai.Coordinate)
 
-	// characterMutex.Lock()
+	ids := CharacterGrid.Query(ai.Server, ai.Map, aiCoordinate, distance)
+
+	var nearbyChars []*Character
 	characterMutex.RLock()
-	allChars := funk.Values(characters)
+	for _, id := range ids {
+		if c, ok := characters[id]; ok && c != nil {
+			nearbyChars = append(nearbyChars, c)
+		}
+	}
 	characterMutex.RUnlock()
-	// characterMutex.Unlock()
 
-	filtered := funk.Filter(allChars, func(c *Character) bool {
+	filtered := funk.Filter(nearbyChars, func(c *Character) bool {
 
 		if c.Socket == nil || !c.IsOnline {
 			return false
@@ -545,12 +526,56 @@ func (ai *AI) DealDamageToPet(damage int) []byte {
 	return resp
 }
 
-func (ai *AI) MovementHandler(token int64, start, end *utils.Location, speed float64) {
+// Walk moves ai to end along the path of its map, ai stays when end can't
+// be reached.
+func (ai *AI) Walk(token int64, start, end *utils.Location, speed float64) {
+	path := FindPath(ai.Map, start, end)
+	if len(path) == 0 {
+		if token == ai.MovementToken {
+			ai.MovementToken = 0
+			ai.IsMoving = false
+		}
+		return
+	}
+
+	ai.MovementHandler(token, start, &path[0], speed, path[1:])
+}
+
+// GoBack walks ai back into its area.
+func (ai *AI) GoBack() {
+	npcPos := NPCPos[ai.PosID]
+	if npcPos == nil {
+		return
+	}
+
+	minCoordinate := ConvertPointToLocation(npcPos.MinLocation)
+	maxCoordinate := ConvertPointToLocation(npcPos.MaxLocation)
+	target := randomPoint(ai.Map, minCoordinate, maxCoordinate)
+
+	ai.IsMoving = true
+	ai.TargetLocation = target
+
+	token := ai.MovementToken
+	for token == ai.MovementToken {
+		ai.MovementToken = utils.RandInt(1, math.MaxInt64)
+	}
+
+	go ai.Walk(ai.MovementToken, ConvertPointToLocation(ai.Coordinate), &target, ai.RunningSpeed)
+}
+
+// MovementHandler moves ai from start towards end, then on along path, the
+// points left after end. It stops once the movement token changes.
+func (ai *AI) MovementHandler(token int64, start, end *utils.Location, speed float64, path []utils.Location) {
 
 	diff := utils.CalculateDistance(start, end)
 
 	if diff < 1 {
 		ai.SetCoordinate(end)
+		if token == ai.MovementToken && len(path) > 0 { // on to the next point of the path
+			*start = *end
+			ai.MovementHandler(token, start, &path[0], speed, path[1:])
+			return
+		}
 		ai.MovementToken = 0
 		ai.IsMoving = false
 		return
@@ -573,7 +598,7 @@ func (ai *AI) MovementHandler(token int64, start, end *utils.Location, speed flo
 		*start = *end
 		time.AfterFunc(time.Duration(diff/speed)*time.Millisecond, func() {
 			if token == ai.MovementToken {
-				ai.MovementHandler(token, start, end, speed)
+				ai.MovementHandler(token, start, end, speed, path)
 			}
 		})
 	} else { // target is away
@@ -581,7 +606,7 @@ func (ai *AI) MovementHandler(token int64, start, end *utils.Location, speed flo
 		start.Y += (end.Y - start.Y) * speed / diff
 		time.AfterFunc(1000*time.Millisecond, func() {
 			if token == ai.MovementToken {
-				ai.MovementHandler(token, start, end, speed)
+				ai.MovementHandler(token, start, end, speed, path)
 			}
 		})
 	}
@@ -604,10 +629,6 @@ func (ai *AI) FindClaimer() (*Character, error) {
 
 func (ai *AI) DropHandler(claimer *Character) {
 
-	var (
-		err error
-	)
-
 	npcPos := NPCPos[ai.PosID]
 	if npcPos == nil {
 		return
@@ -618,535 +639,291 @@ func (ai *AI) DropHandler(claimer *Character) {
 		return
 	}
 
-	diff := claimer.Level - int(npc.Level)
+	rule := NPCDropRule(npc)
+	if !rule.InLevelGap(claimer.Level, int(npc.Level)) {
+		return
+	}
 
-	if diff > 30 {
-		if npc.ID == 9999991 || npc.ID == 9999992 || npc.ID == 9999993 || npc.ID == 9999994 || npc.ID == 9999995 || npc.ID == 9999996 || npc.ID == 9999997 || npc.ID == 9999998 || npc.ID == 18600007 || npc.ID == 50071 || npc.ID == 1338007 || npc.ID == 1338006 || npc.ID == 30026 || npc.ID == 30007 {
-		} else {
-			return
-		}
+	if claimer.PickaxeActivated() {
+		rule.Multiplier += rule.Pickaxe
 	}
 
-	//isEventBoss := false
-	bossMultiplier, dropCount, count, minCount := 0.0, 0, 0, 0
-	baseLocation := ConvertPointToLocation(ai.Coordinate)
+	roll := &DropRoll{
+		Members:  dropMembers(claimer),
+		Rate:     rule.DropRate(claimer.Map, claimer.DropMultiplier+claimer.AdditionalDropMultiplier),
+		Excluded: ExcludedDrops(claimer.Map),
+	}
 
-	if funk.Contains(bosses, npc.ID) {
-		bossMultiplier = 2.5
-		minCount = 3
-
-	} else if funk.Contains(eventBosses, npc.ID) {
-		bossMultiplier = 5.0
-		minCount = 10
-		//isEventBoss = true
-
-	} else if !npcPos.Attackable && claimer.PickaxeActivated() {
-		bossMultiplier = 0.4
-	} else if npc.ID == 50071 {
-		minCount = 1
-	} else if npc.ID == 1338006 || npc.ID == 1338007 || npc.ID == 18600007 { // Red Dragon ve Rakma drop
-		minCount = 70
-	} /*else if npc.ID == 18600034 || npc.ID == 18600035 || npc.ID == 18600036 || npc.ID == 18600037 {
-		isEventBoss = true
-	}*/
-
-BEGIN:
-	id := npc.DropID
-
-	drop, ok := Drops[id]
-	if !ok || drop == nil {
-		// Dark Quest Items
-		if npc.ID == 43301 {
-			questItem := &InventorySlot{ItemID: 18500573, Quantity: 1}
-			rc, _, err := claimer.AddItem(questItem, -1, false)
-			if err == nil {
-				claimer.Socket.Write(*rc)
-				return
-			}
-		}
-		if npc.ID == 43302 {
-			questItem := &InventorySlot{ItemID: 18500574, Quantity: 1}
-			rc, _, err := claimer.AddItem(questItem, -1, false)
-			if err == nil {
-				claimer.Socket.Write(*rc)
-				return
-			}
-		}
-		if npc.ID == 43402 {
-			questItem := &InventorySlot{ItemID: 18500575, Quantity: 1}
-			rc, _, err := claimer.AddItem(questItem, -1, false)
-			if err == nil {
-				claimer.Socket.Write(*rc)
-				return
-			}
-		}
-		if npc.ID == 43403 {
-			questItem := &InventorySlot{ItemID: 18500576, Quantity: 1}
-			rc, _, err := claimer.AddItem(questItem, -1, false)
-			if err == nil {
-				claimer.Socket.Write(*rc)
-				return
-			}
-		}
-		if npc.ID == 43401 {
-			questItem := &InventorySlot{ItemID: 18500571, Quantity: 1}
-			rc, _, err := claimer.AddItem(questItem, -1, false)
-			if err == nil {
-				claimer.Socket.Write(*rc)
-				return
-			}
-		}
-		if npc.ID == 43206 {
-			if claimer.Level == 200 {
-				questItem := &InventorySlot{ItemID: 18500572, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
-			}
+	baseLocation := ConvertPointToLocation(ai.Coordinate)
+	for i, d := range roll.RollNPC(rule) {
+		owner, inventory := claimer, !npcPos.Attackable
+		if d.Member != nil { // per member drops go to the inventory
+			owner, inventory = d.Member.Character, true
 		}
+		go ai.dropItem(npc, npcPos, owner, d.ItemID, d.Quantity, i, inventory, baseLocation)
+	}
+}
 
-		if npc.ID == 1338002 {
-			if claimer.Level == 100 {
-				questItem := &InventorySlot{ItemID: 13370223, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
-			}
+// dropMembers are the claimer and the party members on the same map.
+func dropMembers(claimer *Character) []*DropMember {
+	member := func(c *Character) *DropMember {
+		m := &DropMember{Character: c, Level: c.Level}
+		if CharacterHasQuest != nil {
+			m.HasQuest = func(id int) bool { return CharacterHasQuest(c, id) }
 		}
-		if npc.ID == 1338003 {
-			if claimer.Level == 100 {
-				questItem := &InventorySlot{ItemID: 13370224, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
-			}
-		}
-		if npc.ID == 1338004 {
-			if claimer.Level == 100 {
-				questItem := &InventorySlot{ItemID: 13370225, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
-			}
-		}
-		if npc.ID == 1338005 {
-			if claimer.Level == 100 {
-				questItem := &InventorySlot{ItemID: 13370226, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
+		return m
+	}
+
+	members := []*DropMember{member(claimer)}
+	if party := FindParty(claimer); party != nil {
+		others := []*Character{party.Leader}
+		for _, m := range party.GetMembers() {
+			if m.Accepted {
+				others = append(others, m.Character)
 			}
 		}
 
-		if npc.ID == 1338001 {
-			if claimer.Level == 100 {
-				questItem := &InventorySlot{ItemID: 13370222, Quantity: 1}
-				rc, _, err := claimer.AddItem(questItem, -1, false)
-				if err == nil {
-					claimer.Socket.Write(*rc)
-					return
-				}
+		for _, c := range others {
+			if c != nil && c.ID != claimer.ID && c.Socket != nil && c.IsOnline && c.Map == claimer.Map {
+				members = append(members, member(c))
 			}
 		}
-		return
 	}
+	return members
+}
 
-	itemID := 0
-	end := false
-	for ok {
-		index := 0
-		seed := int(utils.RandInt(0, 1000))
-		items := drop.GetItems()
-
-		probabilities := drop.GetProbabilities()
-
-		var totalDropRate float64
-
-		switch claimer.Map {
-		case 5: // Spirit
-			totalDropRate = DROP_RATE*(0.5*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 7: // Southern
-			totalDropRate = DROP_RATE*(0.5*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 9: // Stone
-			totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 11: // Silen Valley
-			totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 13: // Crimson Sky
-			totalDropRate = DROP_RATE*(0.5*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 16: // Crystal Summit
-			totalDropRate = DROP_RATE*(0.7*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 17: // Tranquil Valley
-			totalDropRate = DROP_RATE*(0.5*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 18: // Desert Temple
-			totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 19: // Red Dragon
-			totalDropRate = DROP_RATE*(0.7*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 193: // Desert Mangook
-			totalDropRate = DROP_RATE*(0.8*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 194: // Red Mangook
-			totalDropRate = DROP_RATE*(0.9*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 200: // Desert Pawang
-			totalDropRate = DROP_RATE*(0.8*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 201: // Red Pawang
-			totalDropRate = DROP_RATE*(0.9*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-		case 28: // Tiger
-			totalDropRate = DROP_RATE*(0.7*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-			/*
-				case 108: // Desert Combat Base
-					totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-				case 193: // Mangook
-					totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-				case 194: // Mangook
-					totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-				case 200: // Pawang
-					totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-				case 201: // Pawang
-					totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-			*/
-		default:
-			totalDropRate = (DROP_RATE * (claimer.DropMultiplier + claimer.AdditionalDropMultiplier)) + bossMultiplier
-		}
+// dropItem drops an item of a kill on the ground for the claimer, or puts it
+// into the claimer's inventory.
+func (ai *AI) dropItem(npc *NPC, npcPos *NpcPosition, claimer *Character, itemID, quantity, index int, inventory bool, baseLocation *utils.Location) {
+
+	if itemID == 0 {
+		return
+	}
 
-		if npc.ID == 50071 {
-			// Snowman
-			totalDropRate = (DROP_RATE * (claimer.DropMultiplier + claimer.AdditionalDropMultiplier)) + bossMultiplier
+	if itemID == 13370000 || itemID == 13370001 || itemID == 13370002 {
+		if DRAGON_BOX == 0 {
+			return
 		}
+	}
 
-		/*
-			if claimer.Map == 16 {
-				totalDropRate = DROP_RATE*(0.4*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-			} else {
-				totalDropRate = (DROP_RATE * (claimer.DropMultiplier + claimer.AdditionalDropMultiplier)) + bossMultiplier
-			}
-		*/
+	resp := utils.Packet{}
+	isRelic := false
 
-		/*
-			if claimer.Map == 13 || claimer.Map == 17 || claimer.Map == 18 || claimer.Map == 19 || claimer.Map == 28 || claimer.Map == 193 || claimer.Map == 194 {
-				totalDropRate = DROP_RATE*(0.6*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-			} else if claimer.Map == 16 {
-				totalDropRate = DROP_RATE*(0.4*(claimer.DropMultiplier+claimer.AdditionalDropMultiplier)) + bossMultiplier
-			} else {
-				totalDropRate = (DROP_RATE * (claimer.DropMultiplier + claimer.AdditionalDropMultiplier)) + bossMultiplier
-			}
-		*/
+	if tmpRelic, ok := Relics[itemID]; ok { // relic drop
 
-		//totalDropRate := (DROP_RATE * (claimer.DropMultiplier + claimer.AdditionalDropMultiplier)) + bossMultiplier
-		dropFailRate := float64(1000 - probabilities[len(probabilities)-1])
-		dropFailRate /= totalDropRate
-		newDropFailRate := 1000 - dropFailRate
-		probMultiplier := float64(probabilities[len(probabilities)-1]) / newDropFailRate
-
-		if float64(probabilities[len(probabilities)-1])*totalDropRate < 900 {
-			probMultiplier = 1
-			probabilities = funk.Map(probabilities, func(prob int) int {
-				return int(float64(prob) * totalDropRate)
-			}).([]int)
+		requiredItems := tmpRelic.GetRequiredItems()
+		slots, err := claimer.InventorySlots()
+		if err != nil {
+			return
 		}
 
-		/*
-			for _, prob := range probabilities {
-				if float64(seed)*probMultiplier > float64(prob) {
-					index++
-					continue
+		for i := range requiredItems {
+			if int(slots[FindItem(int64(requiredItems[i])).Slot].ItemID) == requiredItems[i] {
+				if tmpRelic.Count < tmpRelic.Limit {
+					tmpRelic.Count++
+					tmpRelic.Update()
+					resp.Concat(claimer.RelicDrop(int64(itemID)))
+					isRelic = true
 				}
-				break
 			}
-		*/
+		}
 		/*
-			probabilities = funk.Map(probabilities, func(prob int) int {
-				return int(float64(prob) / probMultiplier)
-			}).([]int)
-		*/
 
-		seed = int(float64(seed) * probMultiplier)
-		index = sort.SearchInts(probabilities, seed)
-		if index >= len(items) {
-			if count >= minCount {
-				end = true
-				break
-			} else {
-				drop = Drops[id]
-				continue
+			if tmpRelic.Count < tmpRelic.Limit {
+				tmpRelic.Count++
+				tmpRelic.Update()
+				resp.Concat(claimer.RelicDrop(int64(itemID)))
+				isRelic = true
 			}
-		}
-
-		itemID = items[index]
-		item, exist := Items[int64(itemID)]
+		*/
 
-		if exist {
-			itemType := item.GetType()
-			if itemType == QUEST_TYPE || itemType == INGREDIENTS_TYPE {
-				drop = Drops[id]
-				continue
-			}
+		if !isRelic {
+			return
 		}
-
-		drop, ok = Drops[itemID]
 	}
 
-	if itemID > 0 && !end { // can drop an item
-		count++
+	item := FindItem(int64(itemID))
+	if item != nil {
 
-		if count >= 20 {
+		/*if item.Type == 70 || item.Type == 71 {
 			return
-		}
+		}*/
 
-		if ai.Map == 1 || ai.Map == 2 || ai.Map == 3 {
-			if itemID == 18500209 {
-				itemID = 0
+		seed := int(utils.RandInt(0, 1000))
+		plus := byte(0)
+		for i := 0; i < len(plusRates) && !isRelic; i++ {
+			if seed > plusRates[i] {
+				plus++
+				continue
 			}
+			break
 		}
 
-		go func() {
+		drop := NewSlot()
+		drop.ItemID = item.ID
+		drop.Quantity = uint(quantity)
+		if item.ID == 242 {
+			drop.Plus = 1
+		} else {
+			drop.Plus = plus
+		}
 
-			if itemID == 0 {
-				return
-			}
+		if item.Timer > 0 {
+			drop.Quantity = uint(item.Timer)
+		}
 
-			if itemID == 13370000 || itemID == 13370001 || itemID == 13370002 {
-				if DRAGON_BOX == 0 {
-					return
-				}
+		var upgradesArray []byte
+		itemType := item.GetType()
+		if itemType == WEAPON_TYPE {
+			upgradesArray = WeaponUpgrades
+		} else if itemType == ARMOR_TYPE {
+			upgradesArray = ArmorUpgrades
+		} else if itemType == ACC_TYPE {
+			if item.ID == 18500069 || item.ID == 18500070 || item.ID == 18500071 || item.ID == 18500072 {
+				drop.Plus = 0
+				plus = 0
 			}
+			upgradesArray = AccUpgrades
+		} else if itemType == PENDENT_TYPE || item.ID == 254 || item.ID == 255 {
+			if plus == 0 {
+				plus = 1
+				drop.Plus = 1
+			}
+			upgradesArray = []byte{byte(item.ID)}
 
-			resp := utils.Packet{}
-			isRelic := false
-
-			if tmpRelic, ok := Relics[itemID]; ok { // relic drop
+		} else if itemType == SOCKET_TYPE {
+			drop.ItemID = 235
+			drop.Plus = socketOrePlus[item.ID]
+			plus = socketOrePlus[item.ID]
+			upgradesArray = []byte{235}
 
-				requiredItems := tmpRelic.GetRequiredItems()
-				slots, err := claimer.InventorySlots()
-				if err != nil {
-					return
-				}
+		} else {
+			plus = 0
+			drop.Plus = 0
+		}
 
-				for i := range requiredItems {
-					if int(slots[Items[int64(requiredItems[i])].Slot].ItemID) == requiredItems[i] {
-						if tmpRelic.Count < tmpRelic.Limit {
-							tmpRelic.Count++
-							tmpRelic.Update()
-							resp.Concat(claimer.RelicDrop(int64(itemID)))
-							isRelic = true
-						}
-					}
-				}
-				/*
+		for i := byte(0); i < plus; i++ {
+			index := utils.RandInt(0, int64(len(upgradesArray)))
+			drop.SetUpgrade(int(i), upgradesArray[index])
+		}
 
-					if tmpRelic.Count < tmpRelic.Limit {
-						tmpRelic.Count++
-						tmpRelic.Update()
-						resp.Concat(claimer.RelicDrop(int64(itemID)))
-						isRelic = true
-					}
-				*/
+		if isRelic || inventory {
 
-				if !isRelic {
+			slot := int16(-1)
+			if npcPos.Attackable {
+				var err error
+				slot, err = claimer.FindFreeSlot()
+				if slot == 0 || err != nil {
 					return
 				}
 			}
 
-			item := Items[int64(itemID)]
-			if item != nil {
-
-				/*if item.Type == 70 || item.Type == 71 {
-					return
-				}*/
-
-				seed := int(utils.RandInt(0, 1000))
-				plus := byte(0)
-				for i := 0; i < len(plusRates) && !isRelic; i++ {
-					if seed > plusRates[i] {
-						plus++
-						continue
-					}
-					break
-				}
-
-				drop := NewSlot()
-				drop.ItemID = item.ID
-				drop.Quantity = 1
-				if item.ID == 242 {
-					drop.Plus = 1
-				} else {
-					drop.Plus = plus
-				}
+			data, _, err := claimer.AddItem(drop, slot, true)
+			if err != nil || data == nil {
+				return
+			}
 
-				if item.Timer > 0 {
-					drop.Quantity = uint(item.Timer)
+			if claimer != nil && claimer.Socket != nil {
+				claimer.Socket.Write(*data)
+				if isRelic {
+					claimer.Socket.User.SaveRelicDrop(claimer.Name, item.Name, npc.Name, int(ai.Map), npc.ID, claimer.DropMultiplier+claimer.AdditionalDropMultiplier+DropRate())
 				}
+			}
+		} else {
 
-				var upgradesArray []byte
-				itemType := item.GetType()
-				if itemType == WEAPON_TYPE {
-					upgradesArray = WeaponUpgrades
-				} else if itemType == ARMOR_TYPE {
-					upgradesArray = ArmorUpgrades
-				} else if itemType == ACC_TYPE {
-					if item.ID == 18500069 || item.ID == 18500070 || item.ID == 18500071 || item.ID == 18500072 {
-						drop.Plus = 0
-						plus = 0
-					}
-					upgradesArray = AccUpgrades
-				} else if itemType == PENDENT_TYPE || item.ID == 254 || item.ID == 255 {
-					if plus == 0 {
-						plus = 1
-						drop.Plus = 1
-					}
-					upgradesArray = []byte{byte(item.ID)}
-
-				} else if itemType == SOCKET_TYPE {
-					drop.ItemID = 235
-					drop.Plus = socketOrePlus[item.ID]
-					plus = socketOrePlus[item.ID]
-					upgradesArray = []byte{235}
+			offset := dropOffsets[index%len(dropOffsets)]
 
-				} else {
-					plus = 0
-					drop.Plus = 0
-				}
+			dr := &Drop{Server: ai.Server, Map: ai.Map, Claimer: claimer, Item: drop,
+				Location: utils.Location{X: baseLocation.X + offset.X, Y: baseLocation.Y + offset.Y}}
 
-				for i := byte(0); i < plus; i++ {
-					index := utils.RandInt(0, int64(len(upgradesArray)))
-					drop.SetUpgrade(int(i), upgradesArray[index])
+			/*
+					if isEventBoss || ai.Map == 10 {
+					//dr.Claimer = nil
 				}
+			*/
 
-				if isRelic || !npcPos.Attackable {
-
-					slot := int16(-1)
-					if npcPos.Attackable {
-						slot, err = claimer.FindFreeSlot()
-						if slot == 0 || err != nil {
-							return
-						}
-					}
-
-					data, _, err := claimer.AddItem(drop, slot, true)
-					if err != nil || data == nil {
-						return
-					}
-
-					if claimer != nil && claimer.Socket != nil {
-						claimer.Socket.Write(*data)
-						if isRelic {
-							claimer.Socket.User.SaveRelicDrop(claimer.Name, item.Name, npc.Name, int(ai.Map), npc.ID, claimer.DropMultiplier+claimer.AdditionalDropMultiplier+DROP_RATE)
-						}
+			dr.GenerateIDForDrop(ai.Server, ai.Map)
+
+			dropID := uint16(dr.ID)
+
+			if ai.Map == 10 || ai.Map == 243 {
+				time.AfterFunc(FREEDROP_LIFETIME, func() { // remove drop after timeout
+					//ai.RemoveDrop(ai.Server, ai.Map, dropID)
+					characters, _ := dr.Claimer.GetNearbyCharacters()
+					dr.Claimer = nil
+					for _, chars := range characters {
+						r := DROP_DISAPPEARED
+						r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
+						chars.Socket.Write(r)
+						chars.OnSight.DropsMutex.Lock()
+						delete(chars.OnSight.Drops, int(dropID))
+						chars.OnSight.DropsMutex.Unlock()
+						chars.Socket.Write(r)
 					}
-				} else {
-
-					offset := dropOffsets[dropCount%len(dropOffsets)]
-					dropCount++
-
-					dr := &Drop{Server: ai.Server, Map: ai.Map, Claimer: claimer, Item: drop,
-						Location: utils.Location{X: baseLocation.X + offset.X, Y: baseLocation.Y + offset.Y}}
-
-					/*
-							if isEventBoss || ai.Map == 10 {
-							//dr.Claimer = nil
-						}
-					*/
-
-					dr.GenerateIDForDrop(ai.Server, ai.Map)
-
-					dropID := uint16(dr.ID)
-
-					if ai.Map == 10 || ai.Map == 243 {
-						time.AfterFunc(FREEDROP_LIFETIME, func() { // remove drop after timeout
-							//ai.RemoveDrop(ai.Server, ai.Map, dropID)
-							characters, _ := dr.Claimer.GetNearbyCharacters()
-							dr.Claimer = nil
-							for _, chars := range characters {
-								r := DROP_DISAPPEARED
-								r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
-								chars.Socket.Write(r)
-								chars.OnSight.DropsMutex.Lock()
-								delete(chars.OnSight.Drops, int(dropID))
-								chars.OnSight.DropsMutex.Unlock()
-								chars.Socket.Write(r)
-							}
-						})
-					} else if ai.PosID == 5494 || ai.PosID == 5495 || ai.PosID == 5493 || ai.PosID == 5492 || ai.PosID == 5720 || ai.PosID == 5811 || ai.PosID == 5812 || ai.PosID == 5813 || ai.PosID == 5814 || ai.PosID == 5815 || ai.PosID == 5816 || ai.PosID == 5817 || ai.PosID == 5818 {
-						time.AfterFunc(FREEDROP_LIFETIME, func() { // remove drop after timeout
-							//ai.RemoveDrop(ai.Server, ai.Map, dropID)
-							characters, _ := dr.Claimer.GetNearbyCharacters()
-							dr.Claimer = nil
-							for _, chars := range characters {
-								r := DROP_DISAPPEARED
-								r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
-								chars.Socket.Write(r)
-								chars.OnSight.DropsMutex.Lock()
-								delete(chars.OnSight.Drops, int(dropID))
-								chars.OnSight.DropsMutex.Unlock()
-								chars.Socket.Write(r)
-							}
-						})
-					} else {
-						time.AfterFunc(DROP_LIFETIME, func() { // remove drop after timeout
-							ai.RemoveDrop(ai.Server, ai.Map, dropID)
-							characters, _ := dr.Claimer.GetNearbyCharacters()
-							for _, chars := range characters {
-								r := DROP_DISAPPEARED
-								r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
-								chars.Socket.Write(r)
-								chars.OnSight.DropsMutex.Lock()
-								delete(chars.OnSight.Drops, int(dropID))
-								chars.OnSight.DropsMutex.Unlock()
-								chars.Socket.Write(r)
-							}
-						})
+				})
+			} else if ai.PosID == 5494 || ai.PosID == 5495 || ai.PosID == 5493 || ai.PosID == 5492 || ai.PosID == 5720 || ai.PosID == 5811 || ai.PosID == 5812 || ai.PosID == 5813 || ai.PosID == 5814 || ai.PosID == 5815 || ai.PosID == 5816 || ai.PosID == 5817 || ai.PosID == 5818 {
+				time.AfterFunc(FREEDROP_LIFETIME, func() { // remove drop after timeout
+					//ai.RemoveDrop(ai.Server, ai.Map, dropID)
+					characters, _ := dr.Claimer.GetNearbyCharacters()
+					dr.Claimer = nil
+					for _, chars := range characters {
+						r := DROP_DISAPPEARED
+						r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
+						chars.Socket.Write(r)
+						chars.OnSight.DropsMutex.Lock()
+						delete(chars.OnSight.Drops, int(dropID))
+						chars.OnSight.DropsMutex.Unlock()
+						chars.Socket.Write(r)
 					}
-
-					r := ITEM_DROPPED
-					r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) // drop id
-
-					r.Insert(utils.FloatToBytes(offset.X+baseLocation.X, 4, true), 10) // drop coordinate-x
-					r.Insert(utils.FloatToBytes(offset.Y+baseLocation.Y, 4, true), 18) // drop coordinate-y
-
-					r.Insert(utils.IntToBytes(uint64(itemID), 4, true), 22) // item id
-					if drop.Plus > 0 {
-						r[27] = 0xA2
-						r.Insert(drop.GetUpgrades(), 32)                                  // item upgrades
-						r.Insert([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 47) // item sockets
-						r.Insert(utils.IntToBytes(uint64(claimer.PseudoID), 2, true), 66) // claimer id
-						r.SetLength(0x42)
-					} else {
-						r[27] = 0xA1
-						r.Insert(utils.IntToBytes(uint64(claimer.PseudoID), 2, true), 36) // claimer id
-						r.SetLength(0x24)
+				})
+			} else {
+				time.AfterFunc(DROP_LIFETIME, func() { // remove drop after timeout
+					ai.RemoveDrop(ai.Server, ai.Map, dropID)
+					characters, _ := dr.Claimer.GetNearbyCharacters()
+					for _, chars := range characters {
+						r := DROP_DISAPPEARED
+						r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
+						chars.Socket.Write(r)
+						chars.OnSight.DropsMutex.Lock()
+						delete(chars.OnSight.Drops, int(dropID))
+						chars.OnSight.DropsMutex.Unlock()
+						chars.Socket.Write(r)
 					}
+				})
+			}
 
-					resp.Concat(r)
-				}
+			r := ITEM_DROPPED
+			r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) // drop id
 
-				p := nats.CastPacket{CastNear: true, MobID: ai.ID, Data: resp, Type: nats.ITEM_DROP}
-				if isRelic {
-					p = nats.CastPacket{CastNear: false, Data: resp, Type: nats.ITEM_DROP}
-				} else {
-					p = nats.CastPacket{CastNear: true, MobID: ai.ID, Data: resp, Type: nats.BOSS_DROP}
-				}
+			r.Insert(utils.FloatToBytes(offset.X+baseLocation.X, 4, true), 10) // drop coordinate-x
+			r.Insert(utils.FloatToBytes(offset.Y+baseLocation.Y, 4, true), 18) // drop coordinate-y
 
-				if err := p.Cast(); err != nil {
-					return
-				}
+			r.Insert(utils.IntToBytes(uint64(itemID), 4, true), 22) // item id
+			if drop.Plus > 0 {
+				r[27] = 0xA2
+				r.Insert(drop.GetUpgrades(), 32)                                  // item upgrades
+				r.Insert([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 47) // item sockets
+				r.Insert(utils.IntToBytes(uint64(claimer.PseudoID), 2, true), 66) // claimer id
+				r.SetLength(0x42)
+			} else {
+				r[27] = 0xA1
+				r.Insert(utils.IntToBytes(uint64(claimer.PseudoID), 2, true), 36) // claimer id
+				r.SetLength(0x24)
 			}
-		}()
-	}
 
-	if !npcPos.Attackable {
-		end = true
-	}
+			resp.Concat(r)
+		}
 
-	if !end {
-		goto BEGIN
+		p := nats.CastPacket{CastNear: true, MobID: ai.ID, Data: resp, Type: nats.ITEM_DROP}
+		if isRelic {
+			p = nats.CastPacket{CastNear: false, Data: resp, Type: nats.ITEM_DROP}
+		} else {
+			p = nats.CastPacket{CastNear: true, MobID: ai.ID, Data: resp, Type: nats.BOSS_DROP}
+		}
+
+		if err := p.Cast(); err != nil {
+			return
+		}
 	}
 }
 
@@ -1159,6 +936,7 @@ func (ai *AI) RemoveDrop(server int, mapID int16, dropID uint16) {
 		drMutex.Lock()
 		delete(DropRegister[server][mapID], dropID)
 		drMutex.Unlock()
+		DropGrid.Remove(dropGridID(server, mapID, dropID))
 	}
 }
 
@@ -1223,7 +1001,8 @@ func (ai *AI) AIHandler() {
 				slots, _ := c.InventorySlots()
 				petSlot := slots[0x0A]
 				pet := petSlot.Pet
-				petInfo, ok := Pets[petSlot.ItemID]
+				petInfo := FindPet(petSlot.ItemID)
+				ok := petInfo != nil
 				if pet != nil && ok && pet.IsOnline && !petInfo.Combat {
 					ai.TargetPlayerID = 0
 					ai.TargetPetID = petSlot.Pet.PseudoID
@@ -1281,9 +1060,7 @@ func (ai *AI) AIHandler() {
 			if utils.RandInt(0, 1000) < 750 { // 75% chance to move
 				ai.IsMoving = true
 
-				targetX := utils.RandFloat(minCoordinate.X, maxCoordinate.X)
-				targetY := utils.RandFloat(minCoordinate.Y, maxCoordinate.Y)
-				target := utils.Location{X: targetX, Y: targetY}
+				target := randomPoint(ai.Map, minCoordinate, maxCoordinate)
 				ai.TargetLocation = target
 
 				//d := ai.Move(target, 1)
@@ -1295,7 +1072,7 @@ func (ai *AI) AIHandler() {
 					ai.MovementToken = utils.RandInt(1, math.MaxInt64)
 				}
 
-				go ai.MovementHandler(ai.MovementToken, coordinate, &target, ai.WalkingSpeed)
+				go ai.Walk(ai.MovementToken, coordinate, &target, ai.WalkingSpeed)
 
 			}
 
@@ -1309,20 +1086,22 @@ func (ai *AI) AIHandler() {
 			aiCoordinate := ConvertPointToLocation(ai.Coordinate)
 			distance := utils.CalculateDistance(&pet.Coordinate, aiCoordinate)
 
-			if ai.ShouldGoBack() || distance > 50 { // better to retreat
+			if goBack := ai.ShouldGoBack(); goBack || distance > 50 { // better to retreat
 				ai.TargetPetID = 0
 				ai.TargetPlayerID = 0
 				ai.MovementToken = 0
 				ai.IsMoving = false
 				ai.HP = npc.MaxHp
+				if goBack {
+					ai.GoBack()
+				}
 
 			} else if distance <= 4 && pet.IsOnline && pet.HP > 0 { // attack
 				seed := utils.RandInt(1, 1000)
 				skillIds := npc.GetSkills()
 				skillsCount := len(skillIds) - 1
 				randomSkill := utils.RandInt(0, int64(skillsCount))
-				_, ok := SkillInfos[skillIds[randomSkill]]
-
+				ok := FindSkillInfo(skillIds[randomSkill]) != nil
 				r := utils.Packet{}
 				if seed < 400 && ok {
 					r.Concat(ai.CastSkillToPet())
@@ -1335,7 +1114,7 @@ func (ai *AI) AIHandler() {
 
 			} else if distance > 3 && distance <= 50 { // chase
 				ai.IsMoving = true
-				target := GeneratePoint(&pet.Coordinate)
+				target := GeneratePoint(ai.Map, &pet.Coordinate)
 				ai.TargetLocation = target
 
 				token := ai.MovementToken
@@ -1343,7 +1122,7 @@ func (ai *AI) AIHandler() {
 					ai.MovementToken = utils.RandInt(1, math.MaxInt64)
 				}
 
-				go ai.MovementHandler(ai.MovementToken, aiCoordinate, &target, ai.RunningSpeed)
+				go ai.Walk(ai.MovementToken, aiCoordinate, &target, ai.RunningSpeed)
 
 			}
 
@@ -1372,18 +1151,20 @@ func (ai *AI) AIHandler() {
 			aiCoordinate := ConvertPointToLocation(ai.Coordinate)
 			distance := utils.CalculateDistance(characterCoordinate, aiCoordinate)
 
-			if ai.ShouldGoBack() || distance > 50 { // better to retreat
+			if goBack := ai.ShouldGoBack(); goBack || distance > 50 { // better to retreat
 				ai.TargetPlayerID = 0
 				ai.MovementToken = 0
 				ai.IsMoving = false
+				if goBack {
+					ai.GoBack()
+				}
 
 			} else if distance <= 5 && character.IsActive && stat.HP > 0 { // attack
 				seed := utils.RandInt(1, 1000)
 				skillIds := npc.GetSkills()
 				skillsCount := len(skillIds) - 1
 				randomSkill := utils.RandInt(0, int64(skillsCount))
-				_, ok := SkillInfos[skillIds[randomSkill]]
-
+				ok := FindSkillInfo(skillIds[randomSkill]) != nil
 				r := utils.Packet{}
 				if seed < 400 && ok {
 					r.Concat(ai.CastSkill())
@@ -1396,7 +1177,7 @@ func (ai *AI) AIHandler() {
 
 			} else if distance > 5 && distance <= 50 { // chase
 				ai.IsMoving = true
-				target := GeneratePoint(characterCoordinate)
+				target := GeneratePoint(ai.Map, characterCoordinate)
 				ai.TargetLocation = target
 
 				token := ai.MovementToken
@@ -1404,7 +1185,7 @@ func (ai *AI) AIHandler() {
 					ai.MovementToken = utils.RandInt(1, math.MaxInt64)
 				}
 
-				go ai.MovementHandler(ai.MovementToken, aiCoordinate, &target, ai.RunningSpeed)
+				go ai.Walk(ai.MovementToken, aiCoordinate, &target, ai.RunningSpeed)
 
 			}
 		}
@@ -1436,58 +1217,3 @@ func (ai *AI) ShouldGoBack() bool {
 
 	return true
 }
-
-func GeneratePoint(location *utils.Location) utils.Location {
-
-	r := 2.0
-	alfa := utils.RandFloat(0, 360)
-	targetX := location.X + r*float64(math.Cos(alfa*math.Pi/180))
-	targetY := location.Y + r*float64(math.Sin(alfa*math.Pi/180))
-
-	return utils.Location{X: targetX, Y: targetY}
-}
-
-func CountYingYangMobs(Map int16) {
-	var mobs *DungeonMobsCounter = new(DungeonMobsCounter)
-
-	i, j, k, l := 0, 0, 0, 0
-
-	mobs.BlackBanditsLeader = 1
-	mobs.RogueKingsLeader = 1
-	mobs.GhostWarriorKing = 1
-	mobs.BeastMaster = 1
-	mobs.Paechun = 1
-
-	for _, mob := range AIsByMap[1][Map] {
-		npcPos, _ := FindNPCPosByID(mob.PosID)
-		if npcPos == nil {
-			continue
-		}
-		if npcPos.NPCID == 60001 || npcPos.NPCID == 60002 || npcPos.NPCID == 60015 || npcPos.NPCID == 60016 {
-			if !mob.IsDead {
-				i++
-			}
-		} else if npcPos.NPCID == 60004 || npcPos.NPCID == 60018 {
-			if !mob.IsDead {
-				j++
-			}
-		} else if npcPos.NPCID == 60006 || npcPos.NPCID == 60007 || npcPos.NPCID == 60020 || npcPos.NPCID == 60021 {
-			if !mob.IsDead {
-				k++
-			}
-		} else if npcPos.NPCID == 60009 || npcPos.NPCID == 60010 || npcPos.NPCID == 60011 || npcPos.NPCID == 60012 ||
-			npcPos.NPCID == 60023 || npcPos.NPCID == 60024 || npcPos.NPCID == 60025 || npcPos.NPCID == 60026 {
-			if !mob.IsDead {
-				l++
-			}
-		}
-
-		mobs.BlackBandits = i
-		mobs.Rogues = j
-		mobs.Ghosts = k
-		mobs.Animals = l
-		YingYangMobsMutex.Lock()
-		YingYangMobsCounter[Map] = mobs
-		YingYangMobsMutex.Unlock()
-	}
-}
@@ -0,0 +1,923 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"hero-server/messaging"
+	"hero-server/utils"
+)
+
+// Kinds of the battlegrounds.
+const (
+	BATTLEGROUND_WAR          = "war"          // the great war, divine when the option is set
+	BATTLEGROUND_FACTION_WAR  = "faction_war"  // faction war of a level range
+	BATTLEGROUND_LAST_MAN     = "last_man"     // last man standing
+	BATTLEGROUND_GOLDEN_BASIN = "golden_basin" // golden basin war, its winner holds the basin
+	BATTLEGROUND_GUILD_WAR    = "guild_war"    // the guild war areas are open while it runs
+)
+
+// Phases of a battleground, in order.
+const (
+	PHASE_ANNOUNCE = iota // announced, characters join
+	PHASE_LOBBY           // joining is closed, the members wait for the start
+	PHASE_RUNNING
+	PHASE_SCORING
+	PHASE_REWARDS // the members see the result before they are sent out
+	PHASE_ENDED
+)
+
+var phaseNames = []string{"announce", "lobby", "running", "scoring", "rewards", "ended"}
+
+// Outcomes of the members of a battleground. Rewards for "all" go to every
+// member that is there at the end.
+const (
+	OUTCOME_WIN  = "win"
+	OUTCOME_LOSE = "lose"
+	OUTCOME_DRAW = "draw"
+	OUTCOME_ALL  = "all"
+)
+
+// Kinds of the score events.
+const (
+	SCORE_KILL  = "kill"  // a member killed another one
+	SCORE_DEATH = "death" // a member died
+	SCORE_NPC   = "npc"   // an npc was killed on the map
+	SCORE_TICK  = "tick"  // every second while running
+)
+
+// BattlegroundMode is the rules of a kind of battleground. The state is kept
+// on the battleground, modes only act on it.
+type BattlegroundMode interface {
+	// Join checks a character may join and returns its side and where it
+	// enters the map.
+	Join(b *Battleground, c *Character) (int, *utils.Location, error)
+	// Start runs when the battleground starts running.
+	Start(b *Battleground)
+	// Tick runs every second while running, true ends the battleground.
+	Tick(b *Battleground) bool
+	// Finish shows the result to the members, before the rewards.
+	Finish(b *Battleground)
+}
+
+// ScoreRule changes the scores of a battleground on what happens in it.
+type ScoreRule interface {
+	Score(b *Battleground, e *ScoreEvent)
+}
+
+// ScoreEvent is what happened in a battleground. Member is the killer of a
+// kill and the dead member of a death; npc kills by characters that are not
+// members have none.
+type ScoreEvent struct {
+	Kind   string
+	Member *BattlegroundMember
+	Enemy  *BattlegroundMember
+	NPCID  int
+}
+
+// BattlegroundKind is what the battlegrounds of a kind share.
+type BattlegroundKind struct {
+	Name        string
+	Map         int16  // 0 when it has no map of its own
+	Hint        string // where to join, in the announcements
+	Countdown   int    // seconds of announcements when the start gives none
+	Lobby       int    // seconds from the end of the announcements to the start
+	Duration    int    // seconds it runs at most, 0 until the mode ends it
+	MinMembers  int    // it is cancelled with fewer at the end of the announcements
+	LateJoin    bool   // characters may also join while it runs
+	Sides       int    // 0 when every member is on its own
+	StartScore  int    // of every side
+	Elimination bool   // killed members are out
+	Exit        int16  // map the members are sent to at the end, 0 to stay
+	Mode        BattlegroundMode
+	Rules       []ScoreRule
+}
+
+// BattlegroundOptions are given when a battleground is started.
+type BattlegroundOptions struct {
+	Countdown int  `json:"countdown"` // seconds, the default of the kind when 0
+	Duration  int  `json:"duration"`  // seconds, the default of the kind when 0
+	Divine    bool `json:"divine"`
+	MinLevel  int  `json:"min_level"`
+	MaxLevel  int  `json:"max_level"`
+}
+
+// BattlegroundMember is a character in a battleground.
+type BattlegroundMember struct {
+	Character *Character `json:"-"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Side      int        `json:"side"`
+	Kills     int        `json:"kills"`
+	Deaths    int        `json:"deaths"`
+	Score     int        `json:"score"`
+	Outcome   string     `json:"outcome,omitempty"`
+}
+
+// Battleground is a battleground of a kind, from its announcement to its
+// end. Its state is guarded by its own mutex, so battlegrounds of different
+// kinds never share any.
+type Battleground struct {
+	ID      int
+	Kind    string
+	Options BattlegroundOptions
+
+	phase   int
+	ends    time.Time // of the current phase
+	scores  []int     // by side, from 1
+	members map[int]*BattlegroundMember
+	stopped bool
+	mutex   sync.Mutex
+}
+
+// BattlegroundInfo is what the admin api and gm commands show of a
+// battleground.
+type BattlegroundInfo struct {
+	ID      int                   `json:"id"`
+	Kind    string                `json:"kind"`
+	Name    string                `json:"name"`
+	Map     int16                 `json:"map"`
+	Phase   string                `json:"phase"`
+	Left    int                   `json:"left"` // seconds of the phase, 0 when it has no end
+	Scores  []int                 `json:"scores"`
+	Members []*BattlegroundMember `json:"members"`
+	Options BattlegroundOptions   `json:"options"`
+}
+
+// BattlegroundReward is a reward of data.battleground_rewards, for the
+// members of a kind of battleground with the outcome.
+type BattlegroundReward struct {
+	ID            int    `db:"id" json:"id"`
+	Kind          string `db:"kind" json:"kind"`
+	Outcome       string `db:"outcome" json:"outcome"`
+	ItemID        int64  `db:"item_id" json:"item_id"`
+	Quantity      uint   `db:"quantity" json:"quantity"`
+	Honor         int    `db:"honor" json:"honor"`
+	BuffID        int    `db:"buff_id" json:"buff_id"`
+	BuffDuration  int64  `db:"buff_duration" json:"buff_duration"`
+	ExpMultiplier int    `db:"exp_multiplier" json:"exp_multiplier"` // percent, while the buff lasts
+}
+
+var (
+	// BATTLEGROUNDS are the kinds of battlegrounds by name.
+	BATTLEGROUNDS = map[string]*BattlegroundKind{
+		BATTLEGROUND_WAR: {Name: "Great War", Map: 230, Hint: "Please participate war by Hero Battle Manager", Countdown: 300,
+			Duration: 1200, Sides: 2, StartScore: 10000, Exit: 1, Mode: greatWar{},
+			Rules: []ScoreRule{KillPoints{Killed: -5}, StonePoints{Points: -2}, NPCPoints{424201: {1, -10000}, 424202: {2, -10000}}}},
+		BATTLEGROUND_FACTION_WAR: {Name: "Faction war", Map: 255, Hint: "Enter faction war at Hero Battle Manager", Countdown: 600,
+			Duration: 1200, Sides: 2, Exit: 1, Mode: factionWar{},
+			Rules: []ScoreRule{DeathPoints{Points: 5}, NPCPoints{425501: {2, 1}, 425502: {2, 15}, 425503: {2, 2}, 425504: {2, 1000},
+				425505: {1, 15}, 425506: {1, 1}, 425507: {1, 2}, 425508: {1, 1000}}}},
+		BATTLEGROUND_LAST_MAN: {Name: "Last Man Standing", Map: 254, Hint: "Please join from Master Bak on Marketplace.", Countdown: 300,
+			Elimination: true, Mode: lastMan{}, Rules: []ScoreRule{KillPoints{Killer: 1}}},
+		BATTLEGROUND_GOLDEN_BASIN: {Name: "Golden Basin war", Map: 76, Hint: "Please join from Faction District !", Countdown: 300,
+			Sides: 2, LateJoin: true, Mode: goldenBasin{}, Rules: []ScoreRule{CapturePoints{NPCID: 18600078, Points: 1}}},
+		BATTLEGROUND_GUILD_WAR: {Name: "Guild war", Mode: guildWar{}},
+	}
+
+	BattlegroundRewards      = make(map[int]*BattlegroundReward)
+	battlegroundRewardsMutex sync.RWMutex
+
+	// battlegrounds are the battlegrounds that have not ended, at most one
+	// of each kind.
+	battlegrounds      = make(map[string]*Battleground)
+	battlegroundsMutex sync.Mutex
+	battlegroundID     int
+)
+
+func readBattlegroundRewards() (map[int]*BattlegroundReward, error) {
+	var rewards []*BattlegroundReward
+	query := `select * from data.battleground_rewards`
+
+	if _, err := db.Select(&rewards, query); err != nil {
+		return nil, fmt.Errorf("readBattlegroundRewards: %s", err.Error())
+	}
+
+	m := make(map[int]*BattlegroundReward, len(rewards))
+	for _, r := range rewards {
+		m[r.ID] = r
+	}
+	return m, nil
+}
+
+func validateBattlegroundRewards(v interface{}) []error {
+	rewards := v.(map[int]*BattlegroundReward)
+
+	var errs []error
+	for _, id := range sortedIntKeys(rewards) {
+		r := rewards[id]
+		if BATTLEGROUNDS[r.Kind] == nil {
+			errs = append(errs, fmt.Errorf("reward %d: unknown battleground %q", id, r.Kind))
+		}
+		switch r.Outcome {
+		case OUTCOME_WIN, OUTCOME_LOSE, OUTCOME_DRAW, OUTCOME_ALL:
+		default:
+			errs = append(errs, fmt.Errorf("reward %d: unknown outcome %q", id, r.Outcome))
+		}
+		if r.ItemID > 0 && (!itemExists(int(r.ItemID)) || r.Quantity == 0) {
+			errs = append(errs, fmt.Errorf("reward %d: unknown item %d or no quantity", id, r.ItemID))
+		}
+		if r.BuffID > 0 && len(BuffInfections) > 0 && FindBuffInfection(r.BuffID) == nil {
+			errs = append(errs, fmt.Errorf("reward %d: unknown buff %d", id, r.BuffID))
+		}
+	}
+	return errs
+}
+
+// StartBattleground announces a battleground of a kind, unless one is
+// already running.
+func StartBattleground(kind string, options BattlegroundOptions) (*Battleground, error) {
+	k := BATTLEGROUNDS[kind]
+	if k == nil {
+		return nil, fmt.Errorf("unknown battleground %q", kind)
+	}
+	if options.Countdown <= 0 {
+		options.Countdown = k.Countdown
+	}
+
+	battlegroundsMutex.Lock()
+	if battlegrounds[kind] != nil {
+		battlegroundsMutex.Unlock()
+		return nil, fmt.Errorf("%s is already running", k.Name)
+	}
+
+	battlegroundID++
+	b := &Battleground{ID: battlegroundID, Kind: kind, Options: options, phase: PHASE_ANNOUNCE,
+		ends: time.Now().Add(time.Duration(options.Countdown) * time.Second), scores: make([]int, k.Sides+1),
+		members: make(map[int]*BattlegroundMember)}
+	for side := 1; side <= k.Sides; side++ {
+		b.scores[side] = k.StartScore
+	}
+	battlegrounds[kind] = b
+	battlegroundsMutex.Unlock()
+
+	if options.Countdown > 0 {
+		b.announce(options.Countdown)
+	}
+	go b.run()
+	return b, nil
+}
+
+// FindBattleground returns the battleground of a kind that has not ended.
+func FindBattleground(kind string) *Battleground {
+	battlegroundsMutex.Lock()
+	defer battlegroundsMutex.Unlock()
+	return battlegrounds[kind]
+}
+
+// MapBattleground returns the battleground held on a map.
+func MapBattleground(mapID int16) *Battleground {
+	battlegroundsMutex.Lock()
+	defer battlegroundsMutex.Unlock()
+
+	for _, b := range battlegrounds {
+		if m := b.kind().Map; m != 0 && m == mapID {
+			return b
+		}
+	}
+	return nil
+}
+
+// Battlegrounds returns the battlegrounds that have not ended.
+func Battlegrounds() []*Battleground {
+	battlegroundsMutex.Lock()
+	defer battlegroundsMutex.Unlock()
+
+	list := make([]*Battleground, 0, len(battlegrounds))
+	for _, b := range battlegrounds {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// StopBattleground cancels the battleground of a kind before it starts or
+// ends it early with its result. It returns false if there is none.
+func StopBattleground(kind string) bool {
+	b := FindBattleground(kind)
+	if b == nil {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.phase >= PHASE_SCORING {
+		return false
+	}
+	b.stopped = true
+	return true
+}
+
+// JoinBattleground makes a character join the battleground of a kind and
+// returns the packets of its entrance.
+func JoinBattleground(kind string, c *Character) ([]byte, error) {
+	b := FindBattleground(kind)
+	if b == nil {
+		return nil, fmt.Errorf("%s has not started.", BATTLEGROUNDS[kind].Name)
+	}
+	return b.Join(c)
+}
+
+func (b *Battleground) kind() *BattlegroundKind {
+	return BATTLEGROUNDS[b.Kind]
+}
+
+// Name is the name of the kind with the options.
+func (b *Battleground) Name() string {
+	name := b.kind().Name
+	if b.Options.Divine {
+		name = "Divine " + name
+	}
+	if b.Options.MaxLevel > 0 {
+		name = fmt.Sprintf("%s level %d-%d", name, b.Options.MinLevel, b.Options.MaxLevel)
+	}
+	return name
+}
+
+func (b *Battleground) Phase() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.phase
+}
+
+func (b *Battleground) Running() bool {
+	return b.Phase() == PHASE_RUNNING
+}
+
+// Left returns the seconds left of the current phase, 0 when it has no end.
+func (b *Battleground) Left() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.left(time.Now())
+}
+
+func (b *Battleground) left(now time.Time) int {
+	if b.ends.IsZero() {
+		return 0
+	}
+	return int(math.Max(0, math.Ceil(b.ends.Sub(now).Seconds())))
+}
+
+// Info returns what is shown of the battleground.
+func (b *Battleground) Info() *BattlegroundInfo {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	info := &BattlegroundInfo{ID: b.ID, Kind: b.Kind, Name: b.Name(), Map: b.kind().Map, Phase: phaseNames[b.phase],
+		Left: b.left(time.Now()), Scores: append([]int{}, b.scores[1:]...), Options: b.Options}
+	for _, m := range b.sortedMembers() {
+		member := *m
+		info.Members = append(info.Members, &member)
+	}
+	return info
+}
+
+// Members returns the members by id, of a side when side is above 0.
+func (b *Battleground) Members(side int) []*BattlegroundMember {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var list []*BattlegroundMember
+	for _, m := range b.sortedMembers() {
+		if side == 0 || m.Side == side {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+func (b *Battleground) sortedMembers() []*BattlegroundMember {
+	list := make([]*BattlegroundMember, 0, len(b.members))
+	for _, m := range b.members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Member returns the member of a character, nil when it is not in.
+func (b *Battleground) Member(c *Character) *BattlegroundMember {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.members[c.ID]
+}
+
+// Score returns the score of a side.
+func (b *Battleground) Score(side int) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if side <= 0 || side >= len(b.scores) {
+		return 0
+	}
+	return b.scores[side]
+}
+
+// AddScore adds points to a side, scores never fall below 0.
+func (b *Battleground) AddScore(side int, points int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if side > 0 && side < len(b.scores) {
+		b.scores[side] = int(math.Max(0, float64(b.scores[side]+points)))
+	}
+}
+
+// AddMemberScore adds points to a member and to its side.
+func (b *Battleground) AddMemberScore(m *BattlegroundMember, points int) {
+	b.mutex.Lock()
+	m.Score += points
+	b.mutex.Unlock()
+
+	b.AddScore(m.Side, points)
+}
+
+// Send writes a packet to the members that are online.
+func (b *Battleground) Send(data []byte) {
+	for _, m := range b.Members(0) {
+		if c := m.Character; c.IsOnline && c.Socket != nil {
+			c.Socket.Write(data)
+		}
+	}
+}
+
+// Join adds a character to the battleground while it is announced, or runs
+// for kinds that may be joined late, and returns the packets of its
+// entrance.
+func (b *Battleground) Join(c *Character) ([]byte, error) {
+	k := b.kind()
+
+	if !b.joinable() {
+		return nil, fmt.Errorf("%s can not be joined now.", b.Name())
+	} else if c.Battleground() != nil {
+		return nil, errors.New("You are already in a battleground.")
+	}
+
+	side, at, err := k.Mode.Join(b, c)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	if !b.canJoin() {
+		b.mutex.Unlock()
+		return nil, fmt.Errorf("%s can not be joined now.", b.Name())
+	} else if !c.setBattleground(b) {
+		b.mutex.Unlock()
+		return nil, errors.New("You are already in a battleground.")
+	}
+	b.members[c.ID] = &BattlegroundMember{Character: c, ID: c.ID, Name: c.Name, Side: side}
+	b.mutex.Unlock()
+
+	return c.ChangeMap(k.Map, at)
+}
+
+func (b *Battleground) joinable() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.canJoin()
+}
+
+func (b *Battleground) canJoin() bool {
+	return b.phase == PHASE_ANNOUNCE || b.phase == PHASE_RUNNING && b.kind().LateJoin
+}
+
+// Leave removes a character from the battleground.
+func (b *Battleground) Leave(c *Character) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.members, c.ID)
+	c.clearBattleground(b)
+}
+
+// Battleground returns the battleground the character is a member of.
+func (c *Character) Battleground() *Battleground {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+	return c.battleground
+}
+
+// setBattleground makes the character a member of b, false when it is a
+// member of a battleground already.
+func (c *Character) setBattleground(b *Battleground) bool {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+
+	if c.battleground != nil {
+		return false
+	}
+	c.battleground = b
+	return true
+}
+
+// clearBattleground takes the character out of b, unless it is a member of
+// another battleground by now.
+func (c *Character) clearBattleground(b *Battleground) {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+
+	if c.battleground == b {
+		c.battleground = nil
+	}
+}
+
+// InBattleground tells if the character is a member of a battleground of
+// the kind.
+func (c *Character) InBattleground(kind string) bool {
+	b := c.Battleground()
+	return b != nil && b.Kind == kind
+}
+
+// LeaveBattleground removes the character from its battleground and returns
+// the map it is sent to, 0 when it stays.
+func (c *Character) LeaveBattleground() int16 {
+	b := c.Battleground()
+	if b == nil {
+		return 0
+	}
+	b.Leave(c)
+	return b.kind().Exit
+}
+
+// Hostile tells if two members can attack each other.
+func (b *Battleground) Hostile(c, enemy *Character) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	m, e := b.members[c.ID], b.members[enemy.ID]
+	if b.phase != PHASE_RUNNING || m == nil || e == nil {
+		return false
+	}
+	return b.kind().Sides == 0 || m.Side != e.Side
+}
+
+// BattlegroundKill counts the kill of an enemy by the character when both
+// are members of the same running battleground.
+func (c *Character) BattlegroundKill(enemy *Character) {
+	b := c.Battleground()
+	if b == nil || enemy.Battleground() != b || !b.Hostile(c, enemy) {
+		return
+	}
+
+	b.mutex.Lock()
+	m, e := b.members[c.ID], b.members[enemy.ID]
+	if m == nil || e == nil {
+		b.mutex.Unlock()
+		return
+	}
+	m.Kills++
+	e.Deaths++
+	b.mutex.Unlock()
+
+	b.event(&ScoreEvent{Kind: SCORE_KILL, Member: m, Enemy: e})
+	if b.kind().Elimination {
+		b.Leave(enemy)
+	}
+}
+
+// BattlegroundDeath counts the death of the character in its running
+// battleground.
+func (c *Character) BattlegroundDeath() {
+	b := c.Battleground()
+	if b == nil || !b.Running() {
+		return
+	}
+	if m := b.Member(c); m != nil {
+		b.event(&ScoreEvent{Kind: SCORE_DEATH, Member: m})
+	}
+}
+
+// BattlegroundNPCKill counts the kill of an npc by the character in the
+// running battleground of its map.
+func (c *Character) BattlegroundNPCKill(npcID int) {
+	b := MapBattleground(c.Map)
+	if b == nil || !b.Running() {
+		return
+	}
+	b.event(&ScoreEvent{Kind: SCORE_NPC, Member: b.Member(c), NPCID: npcID})
+}
+
+func (b *Battleground) event(e *ScoreEvent) {
+	for _, rule := range b.kind().Rules {
+		rule.Score(b, e)
+	}
+}
+
+// run moves the battleground through its phases, a step every second.
+func (b *Battleground) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !b.step(time.Now()) {
+			return
+		}
+	}
+}
+
+// step runs a second of the battleground, false once it has ended.
+func (b *Battleground) step(now time.Time) bool {
+	k := b.kind()
+
+	b.mutex.Lock()
+	phase, left, stopped, members := b.phase, b.left(now), b.stopped, len(b.members)
+	b.mutex.Unlock()
+
+	switch phase {
+	case PHASE_ANNOUNCE:
+		if stopped {
+			b.cancel(fmt.Sprintf("%s has been cancelled.", b.Name()))
+			return false
+		} else if left > 0 {
+			if left%60 == 0 || left < 60 && left%10 == 0 {
+				b.announce(left)
+			}
+			return true
+		} else if members < k.MinMembers {
+			b.cancel(fmt.Sprintf("%s has been cancelled, %d of %d players joined.", b.Name(), members, k.MinMembers))
+			return false
+		}
+		b.setPhase(PHASE_LOBBY, now, k.Lobby)
+
+	case PHASE_LOBBY:
+		if stopped {
+			b.cancel(fmt.Sprintf("%s has been cancelled.", b.Name()))
+			return false
+		} else if left > 0 {
+			return true
+		}
+		b.setPhase(PHASE_RUNNING, now, b.duration())
+		k.Mode.Start(b)
+
+	case PHASE_RUNNING:
+		b.event(&ScoreEvent{Kind: SCORE_TICK})
+		if k.Mode.Tick(b) || stopped || b.duration() > 0 && left <= 0 {
+			b.setPhase(PHASE_SCORING, now, 0)
+		}
+
+	case PHASE_SCORING:
+		b.score()
+		k.Mode.Finish(b)
+		b.reward()
+		b.setPhase(PHASE_REWARDS, now, 10)
+
+	case PHASE_REWARDS:
+		if left > 0 {
+			return true
+		}
+		b.end()
+		return false
+	}
+	return true
+}
+
+// duration is the seconds it runs at most, 0 until the mode ends it.
+func (b *Battleground) duration() int {
+	if b.Options.Duration > 0 {
+		return b.Options.Duration
+	}
+	return b.kind().Duration
+}
+
+func (b *Battleground) setPhase(phase int, now time.Time, seconds int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.phase = phase
+	b.ends = time.Time{}
+	if seconds > 0 {
+		b.ends = now.Add(time.Duration(seconds) * time.Second)
+	}
+}
+
+func (b *Battleground) announce(left int) {
+	min, sec := secondsToMinutes(left)
+	makeAnnouncement(fmt.Sprintf("%s will start in %d minutes %d seconds.", b.Name(), min, sec))
+	if hint := b.kind().Hint; hint != "" {
+		makeAnnouncement(hint)
+	}
+}
+
+// score sets the outcome of every member: the side, or the members when
+// there are no sides, with the highest score wins. Ties draw.
+func (b *Battleground) score() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	scoreOf := func(m *BattlegroundMember) int {
+		if b.kind().Sides > 0 {
+			return b.scores[m.Side]
+		}
+		return m.Score
+	}
+
+	best, count := math.MinInt32, 0
+	if b.kind().Sides > 0 {
+		for side := 1; side < len(b.scores); side++ {
+			if b.scores[side] > best {
+				best, count = b.scores[side], 1
+			} else if b.scores[side] == best {
+				count++
+			}
+		}
+	} else {
+		for _, m := range b.members {
+			if m.Score > best {
+				best, count = m.Score, 1
+			} else if m.Score == best {
+				count++
+			}
+		}
+	}
+
+	for _, m := range b.members {
+		switch {
+		case scoreOf(m) < best:
+			m.Outcome = OUTCOME_LOSE
+		case count > 1:
+			m.Outcome = OUTCOME_DRAW
+		default:
+			m.Outcome = OUTCOME_WIN
+		}
+	}
+}
+
+// Winners returns the members that won.
+func (b *Battleground) Winners() []*BattlegroundMember {
+	var winners []*BattlegroundMember
+	for _, m := range b.Members(0) {
+		if m.Outcome == OUTCOME_WIN {
+			winners = append(winners, m)
+		}
+	}
+	return winners
+}
+
+// reward gives the rewards of their outcome to the members that are
+// online.
+func (b *Battleground) reward() {
+	var rewards []*BattlegroundReward
+	battlegroundRewardsMutex.RLock()
+	for _, id := range sortedIntKeys(BattlegroundRewards) {
+		if r := BattlegroundRewards[id]; r.Kind == b.Kind {
+			rewards = append(rewards, r)
+		}
+	}
+	battlegroundRewardsMutex.RUnlock()
+
+	for _, m := range b.Members(0) {
+		c := m.Character
+		if !c.IsOnline || c.Socket == nil {
+			continue
+		}
+
+		resp := utils.Packet{}
+		for _, r := range rewards {
+			if r.Outcome == m.Outcome || r.Outcome == OUTCOME_ALL {
+				resp.Concat(c.battlegroundReward(r))
+			}
+		}
+		c.Socket.Write(resp)
+		go c.Update()
+	}
+}
+
+func (c *Character) battlegroundReward(r *BattlegroundReward) []byte {
+	resp := utils.Packet{}
+	if r.ItemID > 0 {
+		data, _, err := c.AddItem(&InventorySlot{ItemID: r.ItemID, Quantity: r.Quantity}, -1, false)
+		if err != nil {
+			log.Println(err)
+		} else if data != nil {
+			resp.Concat(*data)
+		}
+	}
+
+	if r.Honor > 0 && c.Socket.Stats != nil {
+		c.Socket.Stats.Honor += r.Honor
+		resp.Concat(messaging.InfoMessage(fmt.Sprintf("You acquired %d Honor points.", r.Honor)))
+	}
+
+	if infection := FindBuffInfection(r.BuffID); infection != nil {
+		buff := &Buff{ID: infection.ID, CharacterID: c.ID, Name: infection.Name, EXPMultiplier: r.ExpMultiplier,
+			StartedAt: c.Epoch, Duration: r.BuffDuration, CanExpire: r.BuffDuration > 0}
+
+		var err error
+		if old, _ := FindBuffByID(infection.ID, c.ID); old != nil {
+			err = buff.Update()
+		} else {
+			err = buff.Create()
+			c.ExpMultiplier += float64(r.ExpMultiplier) / 100
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return resp
+}
+
+// cancel ends the battleground before it runs.
+func (b *Battleground) cancel(msg string) {
+	makeAnnouncement(msg)
+	b.end()
+}
+
+// end sends the members out and forgets the battleground.
+func (b *Battleground) end() {
+	battlegroundsMutex.Lock()
+	if battlegrounds[b.Kind] == b {
+		delete(battlegrounds, b.Kind)
+	}
+	battlegroundsMutex.Unlock()
+
+	b.mutex.Lock()
+	b.phase = PHASE_ENDED
+	members := b.sortedMembers()
+	for _, m := range members {
+		m.Character.clearBattleground(b)
+	}
+	b.mutex.Unlock()
+
+	exit := b.kind().Exit
+	for _, m := range members {
+		c := m.Character
+		if exit == 0 || !c.IsOnline || c.Socket == nil {
+			continue
+		}
+		if data, err := c.ChangeMap(exit, nil); err == nil {
+			c.Socket.Write(data)
+		}
+	}
+}
+
+// KillPoints adds points to the killer, and its side, and to the side of
+// the killed member when a member kills another one.
+type KillPoints struct {
+	Killer int
+	Killed int
+}
+
+func (r KillPoints) Score(b *Battleground, e *ScoreEvent) {
+	if e.Kind != SCORE_KILL {
+		return
+	}
+	b.AddMemberScore(e.Member, r.Killer)
+	b.AddScore(e.Enemy.Side, r.Killed)
+}
+
+// DeathPoints adds points to the other sides when a member dies.
+type DeathPoints struct {
+	Points int
+}
+
+func (r DeathPoints) Score(b *Battleground, e *ScoreEvent) {
+	if e.Kind != SCORE_DEATH {
+		return
+	}
+	for side := 1; side <= b.kind().Sides; side++ {
+		if side != e.Member.Side {
+			b.AddScore(side, r.Points)
+		}
+	}
+}
+
+// SidePoints are points for a side.
+type SidePoints struct {
+	Side   int
+	Points int
+}
+
+// NPCPoints adds points to a side when an npc is killed, by npc id.
+type NPCPoints map[int]SidePoints
+
+func (r NPCPoints) Score(b *Battleground, e *ScoreEvent) {
+	if e.Kind != SCORE_NPC {
+		return
+	}
+	if p, ok := r[e.NPCID]; ok {
+		b.AddScore(p.Side, p.Points)
+	}
+}
+
+// CapturePoints adds points to the side of the member that kills the npc.
+type CapturePoints struct {
+	NPCID  int
+	Points int
+}
+
+func (r CapturePoints) Score(b *Battleground, e *ScoreEvent) {
+	if e.Kind != SCORE_NPC || e.NPCID != r.NPCID || e.Member == nil {
+		return
+	}
+	b.AddScore(e.Member.Side, r.Points)
+}
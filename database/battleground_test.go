@@ -0,0 +1,179 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// testBattleground registers a battleground of a kind in the phase with
+// the characters as members, by side.
+func testBattleground(t *testing.T, kind string, phase int, sides map[*Character]int) *Battleground {
+	k := BATTLEGROUNDS[kind]
+	b := &Battleground{ID: -1, Kind: kind, phase: phase, scores: make([]int, k.Sides+1), members: make(map[int]*BattlegroundMember)}
+	for side := 1; side <= k.Sides; side++ {
+		b.scores[side] = k.StartScore
+	}
+	for c, side := range sides {
+		b.members[c.ID] = &BattlegroundMember{Character: c, ID: c.ID, Name: c.Name, Side: side}
+		c.battleground = b
+	}
+
+	battlegroundsMutex.Lock()
+	if battlegrounds[kind] != nil {
+		battlegroundsMutex.Unlock()
+		t.Fatalf("%s is running", kind)
+	}
+	battlegrounds[kind] = b
+	battlegroundsMutex.Unlock()
+
+	t.Cleanup(func() {
+		battlegroundsMutex.Lock()
+		delete(battlegrounds, kind)
+		battlegroundsMutex.Unlock()
+	})
+	return b
+}
+
+func TestBattlegroundLastMan(t *testing.T) {
+	a, z, out := &Character{ID: 1, Name: "a"}, &Character{ID: 2, Name: "z"}, &Character{ID: 3, Name: "out"}
+	b := testBattleground(t, BATTLEGROUND_LAST_MAN, PHASE_ANNOUNCE, map[*Character]int{a: 0, z: 0})
+
+	now := time.Now()
+	b.ends = now.Add(2 * time.Second)
+	if !b.step(now) || b.Phase() != PHASE_ANNOUNCE {
+		t.Fatalf("phase %d during the countdown", b.Phase())
+	}
+	if b.Hostile(a, z) {
+		t.Error("hostile before the start")
+	}
+
+	now = now.Add(2 * time.Second)
+	b.step(now)
+	b.step(now)
+	if !b.Running() {
+		t.Fatalf("phase %d after the countdown", b.Phase())
+	}
+	if !b.Hostile(a, z) || b.Hostile(a, out) {
+		t.Error("hostility of the members")
+	}
+
+	a.BattlegroundKill(z)
+	if z.Battleground() != nil || a.Battleground() != b || b.Member(a).Score != 1 {
+		t.Fatalf("kill of z: %+v", b.Member(a))
+	}
+
+	b.step(now)
+	if b.Phase() != PHASE_SCORING {
+		t.Fatalf("phase %d with one member left", b.Phase())
+	}
+	b.step(now)
+	if winners := b.Winners(); len(winners) != 1 || winners[0].Character != a {
+		t.Errorf("winners %v", winners)
+	}
+
+	if b.step(now.Add(10*time.Second)) || FindBattleground(BATTLEGROUND_LAST_MAN) != nil || a.Battleground() != nil {
+		t.Error("battleground did not end")
+	}
+}
+
+func TestBattlegroundWarScore(t *testing.T) {
+	order, shao, ally := &Character{ID: 1, Map: 230}, &Character{ID: 2, Map: 230}, &Character{ID: 3, Map: 230}
+	b := testBattleground(t, BATTLEGROUND_WAR, PHASE_RUNNING, map[*Character]int{order: 1, shao: 2, ally: 1})
+
+	if b.Hostile(order, ally) || !b.Hostile(order, shao) {
+		t.Error("hostility of the sides")
+	}
+	order.BattlegroundKill(ally)
+	order.BattlegroundKill(shao)
+	if b.Score(1) != 10000 || b.Score(2) != 9995 || b.Member(order).Kills != 1 || b.Member(shao).Deaths != 1 {
+		t.Errorf("scores %d:%d after the kill", b.Score(1), b.Score(2))
+	}
+
+	// the guardian of order falls, its side has no points left
+	shao.BattlegroundNPCKill(424201)
+	if b.Score(1) != 0 {
+		t.Errorf("order has %d points", b.Score(1))
+	}
+
+	b.score()
+	if b.Member(shao).Outcome != OUTCOME_WIN || b.Member(order).Outcome != OUTCOME_LOSE {
+		t.Errorf("outcomes %q and %q", b.Member(shao).Outcome, b.Member(order).Outcome)
+	}
+
+	b.scores[1] = b.scores[2]
+	b.score()
+	if b.Member(ally).Outcome != OUTCOME_DRAW {
+		t.Errorf("outcome %q of a tie", b.Member(ally).Outcome)
+	}
+}
+
+func TestBattlegroundGoldenBasin(t *testing.T) {
+	zhuang, shao, out := &Character{ID: 1, Map: 76, Faction: 1}, &Character{ID: 2, Map: 76, Faction: 2}, &Character{ID: 3, Map: 76, Faction: 1}
+	b := testBattleground(t, BATTLEGROUND_GOLDEN_BASIN, PHASE_RUNNING, map[*Character]int{zhuang: 1, shao: 2})
+
+	if !b.joinable() {
+		t.Error("the golden basin war can not be joined while it runs")
+	}
+	out.BattlegroundNPCKill(18600078) // not a member
+	if b.Score(1) != 0 {
+		t.Fatal("the statue was taken by a character out of the war")
+	}
+	shao.BattlegroundNPCKill(18600078)
+	if b.Score(2) != 1 || !b.step(time.Now()) || b.Phase() != PHASE_SCORING {
+		t.Fatalf("score %d, phase %d after the statue fell", b.Score(2), b.Phase())
+	}
+	b.score()
+	if winners := b.Winners(); len(winners) != 1 || winners[0].Character != shao {
+		t.Errorf("winners %v", winners)
+	}
+
+	basin := FindTerritory(TERRITORY_GOLDEN_BASIN)
+	basin.mutex.Lock()
+	areas := basin.areas
+	basin.areas = map[int]*TerritoryArea{GOLDEN_BASIN_AREA: {ID: GOLDEN_BASIN_AREA, Holder: 2}}
+	basin.mutex.Unlock()
+	t.Cleanup(func() {
+		basin.mutex.Lock()
+		basin.areas = areas
+		basin.mutex.Unlock()
+	})
+	if CanEnterGoldenBasin(zhuang) || !CanEnterGoldenBasin(shao) {
+		t.Error("entry of the holders")
+	}
+}
+
+func TestBattlegroundMembership(t *testing.T) {
+	a := &Character{ID: 1, Name: "a"}
+	b := testBattleground(t, BATTLEGROUND_LAST_MAN, PHASE_ANNOUNCE, nil)
+	other := &Battleground{Kind: BATTLEGROUND_WAR, members: make(map[int]*BattlegroundMember)}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for n := 0; n < 1000; n++ {
+			a.InBattleground(BATTLEGROUND_LAST_MAN)
+		}
+	}()
+	for n := 0; n < 1000; n++ {
+		if !a.setBattleground(b) || a.setBattleground(other) {
+			t.Fatal("joined two battlegrounds")
+		}
+		other.Leave(a) // not a member, a stays in b
+		if a.Battleground() != b {
+			t.Fatal("left the battleground of another")
+		}
+		b.Leave(a)
+	}
+	<-done
+}
+
+func TestValidateBattlegroundRewards(t *testing.T) {
+	rewards := map[int]*BattlegroundReward{
+		1: {ID: 1, Kind: BATTLEGROUND_WAR, Outcome: OUTCOME_WIN, Honor: 24},
+		2: {ID: 2, Kind: "arena", Outcome: OUTCOME_ALL},
+		3: {ID: 3, Kind: BATTLEGROUND_LAST_MAN, Outcome: "second"},
+	}
+	if errs := validateBattlegroundRewards(rewards); len(errs) != 2 {
+		t.Errorf("got %d problems, want 2: %v", len(errs), errs)
+	}
+}
@@ -1,14 +1,15 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
-	BuffIcons = make(map[int]*BuffIcon)
+	BuffIcons      = make(map[int]*BuffIcon)
+	buffIconsMutex sync.RWMutex
 )
 
 type BuffIcon struct {
@@ -29,20 +30,17 @@ func (e *BuffIcon) Delete() error {
 	return err
 }
 
-func getBuffIcons() error {
+func readBuffIcons() (map[int]*BuffIcon, error) {
 	var buffIcons []*BuffIcon
 	query := `select * from data.buff_icons`
 
 	if _, err := db.Select(&buffIcons, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getBuffIcons: %s", err.Error())
+		return nil, fmt.Errorf("readBuffIcons: %s", err.Error())
 	}
 
+	m := make(map[int]*BuffIcon, len(buffIcons))
 	for _, b := range buffIcons {
-		BuffIcons[b.SkillID] = b
+		m[b.SkillID] = b
 	}
-
-	return nil
+	return m, nil
 }
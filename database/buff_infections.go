@@ -1,16 +1,23 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
-	BuffInfections = make(map[int]*BuffInfection)
+	BuffInfections      = make(map[int]*BuffInfection)
+	buffInfectionsMutex sync.RWMutex
 )
 
+func FindBuffInfection(id int) *BuffInfection {
+	buffInfectionsMutex.RLock()
+	defer buffInfectionsMutex.RUnlock()
+	return BuffInfections[id]
+}
+
 type BuffInfection struct {
 	ID   int    `db:"id"`
 	Name string `db:"name"`
@@ -105,20 +112,17 @@ func (e *BuffInfection) Update() error {
 	return err
 }
 
-func getBuffInfections() error {
+func readBuffInfections() (map[int]*BuffInfection, error) {
 	var buffInfections []*BuffInfection
 	query := `select * from data.buff_infections`
 
 	if _, err := db.Select(&buffInfections, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getBuffInfections: %s", err.Error())
+		return nil, fmt.Errorf("readBuffInfections: %s", err.Error())
 	}
 
+	m := make(map[int]*BuffInfection, len(buffInfections))
 	for _, b := range buffInfections {
-		BuffInfections[b.ID] = b
+		m[b.ID] = b
 	}
-
-	return nil
+	return m, nil
 }
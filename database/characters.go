@@ -237,17 +237,22 @@ type Character struct {
 	Paralised bool `db:"-"`
 	Confused  bool `db:"-"`
 
-	AddingExp              sync.Mutex `db:"-" json:"-"`
-	AddingGold             sync.Mutex `db:"-" json:"-"`
-	Looting                sync.Mutex `db:"-" json:"-"`
-	AdditionalRunningSpeed float64    `db:"-" json:"-"`
-	InvMutex               sync.Mutex `db:"-"`
-	Socket                 *Socket    `db:"-" json:"-"`
-	ExploreWorld           func()     `db:"-" json:"-"`
-	HasLot                 bool       `db:"-" json:"-"`
-	LastRoar               time.Time  `db:"-" json:"-"`
-	Meditating             bool       `db:"-"`
-	MovementToken          int64      `db:"-" json:"-"`
+	AddingExp              sync.Mutex     `db:"-" json:"-"`
+	AddingGold             sync.Mutex     `db:"-" json:"-"`
+	Looting                sync.Mutex     `db:"-" json:"-"`
+	AdditionalRunningSpeed float64        `db:"-" json:"-"`
+	InvMutex               sync.Mutex     `db:"-"`
+	Socket                 *Socket        `db:"-" json:"-"`
+	ExploreWorld           func()         `db:"-" json:"-"`
+	HasLot                 bool           `db:"-" json:"-"`
+	LastRoar               time.Time      `db:"-" json:"-"`
+	Meditating             bool           `db:"-"`
+	MovementToken          int64          `db:"-" json:"-"`
+	movedTo                utils.Location `db:"-"` // where the server knows the character is
+	movedFrom              utils.Location `db:"-"` // where it was before the last teleport
+	movedAt                time.Time      `db:"-"`
+	placedAt               time.Time      `db:"-"`
+	moveMutex              sync.Mutex     `db:"-"`
 	//MovementTokenMutex     sync.Mutex `db:"-" json:"-"`
 	PseudoID uint16 `db:"-" json:"pseudo_id"`
 	PTS      int    `db:"-" json:"pts"`
@@ -281,12 +286,10 @@ type Character struct {
 	IsMounting        bool            `db:"-" json:"-"`
 	PlayerAidSettings *AidSettings    `db:"-" json:"-"`
 
-	IsAcceptedWar   bool    `db:"-" json:"-"`
-	IsinWar         bool    `db:"-" json:"-"`
-	IsinLastMan     bool    `db:"-" json:"-"`
-	WarKillCount    int     `db:"-" json:"-"`
-	InjuryCount     float64 `db:"-"`
-	WarContribution int     `db:"-" json:"-"`
+	battleground  *Battleground    `db:"-" json:"-"`
+	dungeon       *DungeonInstance `db:"-" json:"-"`
+	instanceMutex sync.Mutex       `db:"-"` // guards battleground and dungeon
+	InjuryCount   float64          `db:"-"`
 
 	UsedPotion bool `db:"-" json:"-"`
 	UsedConsig bool `db:"-" json:"-"`
@@ -346,8 +349,51 @@ func (t *Character) PreInsert(s gorp.SqlExecutor) error {
 	return nil
 }
 
+// SetCoordinate puts t at coordinate, the movement checks take it as a
+// teleport.
 func (t *Character) SetCoordinate(coordinate *utils.Location) {
+	t.setCoordinate(coordinate, true)
+}
+
+// MoveCoordinate sets where t walked to.
+func (t *Character) MoveCoordinate(coordinate *utils.Location) {
+	t.setCoordinate(coordinate, false)
+}
+
+func (t *Character) setCoordinate(coordinate *utils.Location, placed bool) {
+	t.placeAt(coordinate, placed)
 	t.Coordinate = fmt.Sprintf("(%.1f,%.1f)", coordinate.X, coordinate.Y)
+	if t.Socket != nil {
+		if t.Socket.User != nil {
+			CharacterGrid.Move(t.ID, t.Socket.User.ConnectedServer, t.Map, coordinate)
+		}
+		t.Socket.UpdateInterest()
+	}
+}
+
+// Event returns an event of action done by t where t stands.
+func (t *Character) Event(action logging.Action, message string) *logging.Event {
+	e := &logging.Event{Action: action, UserID: t.UserID, CharacterID: t.ID, CharacterName: t.Name, Map: t.Map, Message: message}
+	if t.Coordinate != "" {
+		loc := ConvertPointToLocation(t.Coordinate)
+		e.X, e.Y = loc.X, loc.Y
+	}
+	return e
+}
+
+// eventItems returns the item ids of the slots for an event, skipping nil
+// and empty slots and repeated ids.
+func eventItems(slots ...*InventorySlot) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, slot := range slots {
+		if slot == nil || slot.ItemID == 0 || seen[slot.ItemID] {
+			continue
+		}
+		seen[slot.ItemID] = true
+		ids = append(ids, slot.ItemID)
+	}
+	return ids
 }
 
 func (t *Character) FixDropAndExp() {
@@ -824,6 +870,12 @@ func (c *Character) Logout() {
 	c.Socket.CharacterSelected = false
 	c.PTS = 0
 	c.TradeID = ""
+	if exit, at := c.LeaveDungeon(); exit != 0 {
+		c.Map = exit
+		if at != nil {
+			c.Coordinate = ConvertPointToCoordinate(at.X, at.Y)
+		}
+	}
 	c.LeaveParty()
 	c.EndPvP()
 
@@ -845,32 +897,21 @@ func (c *Character) Logout() {
 		}
 	}
 
-	if c.IsinWar {
-		c.IsinWar = false
-		if c.Faction == 1 {
-			delete(OrderCharacters, c.ID)
-		} else {
-			delete(ShaoCharacters, c.ID)
-		}
-		c.Map = 1
-	}
-
-	if c.IsinLastMan {
-		c.IsinLastMan = false
-		LastManMutex.Lock()
-		delete(LastManCharacters, c.ID)
-		LastManMutex.Unlock()
-		c.Map = 254
+	if exit := c.LeaveBattleground(); exit != 0 {
+		c.Map = exit
 	}
 
 	LogoutFiveBuffDelete(c)
 	LogoutGuildWarBuffDelete(c)
+	c.forgetQuests()
+	c.forgetAchievements()
 
 	c.Update()
 	c.Socket.User.Update()
 
 	RemoveFromRegister(c)
 	RemovePetFromRegister(c)
+	CharacterGrid.Remove(c.ID)
 	DeleteCharacterFromCache(c.ID)
 	DeleteStatFromCache(c.ID)
 }
@@ -889,6 +930,12 @@ func (c *Character) EndPvP() {
 	}
 }
 
+func AddCharacterToCache(c *Character) {
+	characterMutex.Lock()
+	characters[c.ID] = c
+	characterMutex.Unlock()
+}
+
 func DeleteCharacterFromCache(id int) {
 	characterMutex.Lock()
 	delete(characters, id)
@@ -904,44 +951,41 @@ func (c *Character) GetNearbyCharacters() ([]*Character, error) {
 
 	var (
 		distance = float64(50)
+		chars    []*Character
 	)
 
 	u, err := FindUserByID(c.UserID)
 	if err != nil {
 		return nil, err
+	} else if u == nil {
+		return nil, nil
 	}
 
 	myCoordinate := ConvertPointToLocation(c.Coordinate)
+	ids := CharacterGrid.Query(u.ConnectedServer, c.Map, myCoordinate, distance)
 
 	characterMutex.RLock()
-	allChars := funk.Values(characters)
-	characterMutex.RUnlock()
-
-	characters := funk.Filter(allChars, func(character *Character) bool {
-
-		user, err := FindUserByID(character.UserID)
-		if err != nil || user == nil {
-			return false
+	for _, id := range ids {
+		if character, ok := characters[id]; ok && character != nil {
+			chars = append(chars, character)
 		}
+	}
+	characterMutex.RUnlock()
 
-		characterCoordinate := ConvertPointToLocation(character.Coordinate)
-		//fmt.Println(characters[character.ID].Name)
-
-		return character.IsOnline && user.ConnectedServer == u.ConnectedServer && character.Map == c.Map &&
-			(!character.Invisible || c.DetectionMode) && utils.CalculateDistance(characterCoordinate, myCoordinate) <= distance
+	chars = funk.Filter(chars, func(character *Character) bool {
+		return character.IsOnline && character.Map == c.Map && (!character.Invisible || c.DetectionMode)
 	}).([]*Character)
 
-	return characters, nil
+	return chars, nil
 }
 
 func (c *Character) GetNearbyAIIDs() ([]int, error) {
 
 	var (
 		distance = 64.0
-		ids      []int
 	)
 
-	if c.IsinWar {
+	if c.InBattleground(BATTLEGROUND_WAR) {
 		distance = 25.0
 	}
 
@@ -952,27 +996,14 @@ func (c *Character) GetNearbyAIIDs() ([]int, error) {
 		return nil, nil
 	}
 
-	candidates := AIsByMap[user.ConnectedServer][c.Map]
-	filtered := funk.Filter(candidates, func(ai *AI) bool {
-
-		characterCoordinate := ConvertPointToLocation(c.Coordinate)
-		aiCoordinate := ConvertPointToLocation(ai.Coordinate)
-
-		return utils.CalculateDistance(characterCoordinate, aiCoordinate) <= distance
-	})
-
-	for _, ai := range filtered.([]*AI) {
-		ids = append(ids, ai.ID)
-	}
-
-	return ids, nil
+	characterCoordinate := ConvertPointToLocation(c.Coordinate)
+	return AIGrid.Query(user.ConnectedServer, c.Map, characterCoordinate, distance), nil
 }
 
 func (c *Character) GetNearbyNPCIDs() ([]int, error) {
 
 	var (
 		distance = 50.0
-		ids      []int
 	)
 
 	user, err := FindUserByID(c.UserID)
@@ -982,22 +1013,9 @@ func (c *Character) GetNearbyNPCIDs() ([]int, error) {
 		return nil, nil
 	}
 
-	filtered := funk.Filter(NPCPos, func(pos *NpcPosition) bool {
-
-		characterCoordinate := ConvertPointToLocation(c.Coordinate)
-		minLocation := ConvertPointToLocation(pos.MinLocation)
-		maxLocation := ConvertPointToLocation(pos.MaxLocation)
-
-		npcCoordinate := &utils.Location{X: (minLocation.X + maxLocation.X) / 2, Y: (minLocation.Y + maxLocation.Y) / 2}
-
-		return c.Map == pos.MapID && utils.CalculateDistance(characterCoordinate, npcCoordinate) <= distance && pos.IsNPC // Unutma && !pos.Attackable
-	})
-
-	for _, pos := range filtered.([]*NpcPosition) {
-		ids = append(ids, pos.ID)
-	}
-
-	return ids, nil
+	// NPCs are the same on every server, they are indexed under server 0
+	characterCoordinate := ConvertPointToLocation(c.Coordinate)
+	return NPCGrid.Query(0, c.Map, characterCoordinate, distance), nil // Unutma && !pos.Attackable
 }
 
 func (c *Character) GetNearbyDrops() ([]int, error) {
@@ -1014,16 +1032,9 @@ func (c *Character) GetNearbyDrops() ([]int, error) {
 		return nil, nil
 	}
 
-	allDrops := GetDropsInMap(user.ConnectedServer, c.Map)
-	filtered := funk.Filter(allDrops, func(drop *Drop) bool {
-
-		characterCoordinate := ConvertPointToLocation(c.Coordinate)
-
-		return utils.CalculateDistance(characterCoordinate, &drop.Location) <= distance
-	})
-
-	for _, d := range filtered.([]*Drop) {
-		ids = append(ids, d.ID)
+	characterCoordinate := ConvertPointToLocation(c.Coordinate)
+	for _, id := range DropGrid.Query(user.ConnectedServer, c.Map, characterCoordinate, distance) {
+		ids = append(ids, id&0xFFFF)
 	}
 
 	return ids, nil
@@ -1424,7 +1435,7 @@ func (c *Character) DecrementItem(slotID int16, amount uint) *utils.Packet {
 
 	slot.Quantity -= amount
 
-	info := Items[slot.ItemID]
+	info := FindItem(slot.ItemID)
 	resp := utils.Packet{}
 
 	if info.TimerType == 3 {
@@ -1440,7 +1451,9 @@ func (c *Character) DecrementItem(slotID int16, amount uint) *utils.Packet {
 
 	if slot.Quantity == 0 {
 		if slot.ItemID != 0 {
-			go logging.AddLogFile(5, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteminin süresi doldu veya sildi.")
+			e := c.Event(logging.ACTION_REMOVE_ITEM, fmt.Sprintf("%s expired or was used up", info.Name))
+			e.ItemIDs = []int64{slot.ItemID}
+			logging.Emit(e)
 			c.UsedConsumables.ItemMutex.Lock()
 			delete(c.UsedConsumables.Items, slot.ItemID)
 			c.UsedConsumables.ItemMutex.Unlock()
@@ -1535,6 +1548,12 @@ func (c *Character) DoesInventoryExpanded() bool {
 }
 
 func (c *Character) AddItem(itemToAdd *InventorySlot, slotID int16, lootingDrop bool) (*utils.Packet, int16, error) {
+	return c.addItem(itemToAdd, slotID, lootingDrop, ITEM_CREATED, "")
+}
+
+// addItem is AddItem writing the added items to the ledger as event, with
+// the note.
+func (c *Character) addItem(itemToAdd *InventorySlot, slotID int16, lootingDrop bool, event, note string) (*utils.Packet, int16, error) {
 	var (
 		item *InventorySlot
 		err  error
@@ -1546,8 +1565,9 @@ func (c *Character) AddItem(itemToAdd *InventorySlot, slotID int16, lootingDrop
 
 	itemToAdd.CharacterID = null.IntFrom(int64(c.ID))
 	itemToAdd.UserID = null.StringFrom(c.UserID)
+	added := itemToAdd.Quantity
 
-	i := Items[itemToAdd.ItemID]
+	i := FindItem(itemToAdd.ItemID)
 	stackable := FindStackableByUIF(i.UIF)
 
 	slots, err := c.InventorySlots()
@@ -1593,9 +1613,12 @@ func (c *Character) AddItem(itemToAdd *InventorySlot, slotID int16, lootingDrop
 
 	itemToAdd.SlotID = slotID
 	slot := slots[slotID]
-	id := slot.ID
+	id, uid := slot.ID, slot.UID
 	*slot = *itemToAdd
 	slot.ID = id
+	if stacking {
+		slot.UID = uid
+	}
 
 	if !stacking && stackable == nil {
 		//for j := 0; j < int(itemToAdd.Quantity); j++ {
@@ -1660,6 +1683,10 @@ func (c *Character) AddItem(itemToAdd *InventorySlot, slotID int16, lootingDrop
 		}
 	}
 
+	if slot.UID == "" {
+		slot.UID = NewItemUID()
+	}
+
 	if slot.ID > 0 {
 		err = slot.Update()
 	} else {
@@ -1674,7 +1701,9 @@ func (c *Character) AddItem(itemToAdd *InventorySlot, slotID int16, lootingDrop
 	}
 
 	InventoryItems.Add(slot.ID, slot)
+	RecordItem(event, slot, int64(added), nil, c, note)
 	resp.Concat(slot.GetData(slotID))
+	resp.Concat(c.AdvanceQuests(QUEST_COLLECT, int(slot.ItemID), int(added)))
 	return &resp, slotID, nil
 }
 
@@ -1700,8 +1729,8 @@ func (c *Character) ReplaceItem(itemID int, where, to int16) ([]byte, error) {
 	}
 
 	toItem := invSlots[to]
-	whereInfoItem := Items[whereItem.ItemID]
-	toInfoItem := Items[toItem.ItemID]
+	whereInfoItem := FindItem(whereItem.ItemID)
+	toInfoItem := FindItem(toItem.ItemID)
 	slots := c.GetAllEquipedSlots()
 	useItem, _ := utils.Contains(slots, int(to))
 	isWeapon := false
@@ -1757,6 +1786,7 @@ func (c *Character) ReplaceItem(itemID int, where, to int16) ([]byte, error) {
 
 	toItem.Update()
 	InventoryItems.Add(toItem.ID, toItem)
+	recordMove(c, toItem, where, to)
 
 	resp := ITEM_REPLACEMENT
 	resp.Insert(utils.IntToBytes(uint64(itemID), 4, true), 8) // item id
@@ -1765,7 +1795,7 @@ func (c *Character) ReplaceItem(itemID int, where, to int16) ([]byte, error) {
 
 	whereAffects, toAffects := DoesSlotAffectStats(where), DoesSlotAffectStats(to)
 
-	info := Items[int64(itemID)]
+	info := FindItem(int64(itemID))
 	if whereAffects {
 		if info != nil && info.Timer > 0 {
 			toItem.InUse = false
@@ -1838,8 +1868,8 @@ func (c *Character) SwapItems(where, to int16) ([]byte, error) {
 		return nil, nil
 	}
 
-	whereInfoItem := Items[whereItem.ItemID]
-	toInfoItem := Items[toItem.ItemID]
+	whereInfoItem := FindItem(whereItem.ItemID)
+	toInfoItem := FindItem(toItem.ItemID)
 	slots := c.GetAllEquipedSlots()
 	useItem, _ := utils.Contains(slots, int(to))
 	useItem2, _ := utils.Contains(slots, int(where))
@@ -1913,6 +1943,8 @@ func (c *Character) SwapItems(where, to int16) ([]byte, error) {
 	toItem.Update()
 	InventoryItems.Add(whereItem.ID, whereItem)
 	InventoryItems.Add(toItem.ID, toItem)
+	recordMove(c, toItem, where, to)
+	recordMove(c, whereItem, to, where)
 
 	resp := ITEM_SWAP
 	resp.Insert(utils.IntToBytes(uint64(where), 4, true), 9)  // where slot
@@ -1926,13 +1958,13 @@ func (c *Character) SwapItems(where, to int16) ([]byte, error) {
 
 	if whereAffects {
 		item := whereItem // new item
-		info := Items[int64(item.ItemID)]
+		info := FindItem(int64(item.ItemID))
 		if info != nil && info.Timer > 0 {
 			item.InUse = true
 		}
 
 		item = toItem // old item
-		info = Items[int64(item.ItemID)]
+		info = FindItem(int64(item.ItemID))
 		if info != nil && info.Timer > 0 {
 			item.InUse = false
 		}
@@ -1940,13 +1972,13 @@ func (c *Character) SwapItems(where, to int16) ([]byte, error) {
 
 	if toAffects {
 		item := whereItem // old item
-		info := Items[int64(item.ItemID)]
+		info := FindItem(int64(item.ItemID))
 		if info != nil && info.Timer > 0 {
 			item.InUse = false
 		}
 
 		item = toItem // new item
-		info = Items[int64(item.ItemID)]
+		info = FindItem(int64(item.ItemID))
 		if info != nil && info.Timer > 0 {
 			item.InUse = true
 		}
@@ -2018,7 +2050,7 @@ func (c *Character) SplitItem(where, to, quantity uint16) ([]byte, error) {
 		return nil, nil
 	}
 
-	info := Items[whereItem.ItemID]
+	info := FindItem(whereItem.ItemID)
 
 	if info.Timer > 0 {
 		return nil, nil
@@ -2036,8 +2068,10 @@ func (c *Character) SplitItem(where, to, quantity uint16) ([]byte, error) {
 			return nil, nil
 		}
 
+		toItem.UID = NewItemUID()
 		toItem.Insert()
 		InventoryItems.Add(toItem.ID, toItem)
+		RecordItem(ITEM_SPLIT, toItem, 0, c, c, whereItem.UID)
 
 		resp := SPLIT_ITEM
 		resp.Insert(utils.IntToBytes(uint64(toItem.ItemID), 4, true), 8)       // item id
@@ -2070,8 +2104,7 @@ func (c *Character) GetHPandChi() []byte {
 	buffs, _ := FindBuffsByCharacterID(c.ID)
 	for _, buff := range buffs {
 
-		_, ok := BuffInfections[buff.ID]
-		if !ok {
+		if FindBuffInfection(buff.ID) == nil {
 			continue
 		}
 		if buff.ID == 10100 || buff.ID == 90098 {
@@ -2126,6 +2159,7 @@ func (c *Character) GetHPandChi() []byte {
 func (c *Character) Handler() {
 	defer func() {
 		if err := recover(); err != nil {
+			HandlerPanics.Inc("character")
 			log.Println(err)
 			log.Printf("handler error: %+v", string(dbg.Stack()))
 			c.HandlerCB = nil
@@ -2225,6 +2259,7 @@ func (c *Character) Handler() {
 			opponent.DuelID = 0
 			opponent.DuelStarted = false
 			opponent.Socket.Write(PVP_FINISHED)
+			opponent.Socket.Write(opponent.AdvanceAchievements(ACHIEVEMENT_PVP_WIN, 0, 1))
 
 			//info := fmt.Sprintf("[%s] has defeated [%s]", opponent.Name, c.Name)
 			//r := messaging.InfoMessage(info)
@@ -2233,16 +2268,7 @@ func (c *Character) Handler() {
 			//p.Cast()
 		}
 
-		if c.Map == 255 {
-			if c.Faction == 1 {
-				AddPointsToFactionWarFaction(5, 2)
-			}
-
-			if c.Faction == 2 {
-				AddPointsToFactionWarFaction(5, 1)
-			}
-
-		}
+		c.BattlegroundDeath()
 
 		c.Targets = []*Target{}
 		c.PlayerTargets = []*PlayerTarget{}
@@ -2341,7 +2367,9 @@ func (c *Character) PetHandler() {
 			return
 		}
 
-		petInfo, ok := Pets[petSlot.ItemID]
+		petInfo := FindPet(petSlot.ItemID)
+
+		ok := petInfo != nil
 		if !ok {
 			return
 		}
@@ -2506,10 +2534,7 @@ func (c *Character) PetHandler() {
 
 			if distance > 10 { // Pet is so far from his owner
 				pet.IsMoving = true
-				targetX := utils.RandFloat(ownerPos.X-5, ownerPos.X+5)
-				targetY := utils.RandFloat(ownerPos.Y-5, ownerPos.Y+5)
-
-				target := utils.Location{X: targetX, Y: targetY}
+				target := randomPoint(c.Map, &utils.Location{X: ownerPos.X - 5, Y: ownerPos.Y - 5}, &utils.Location{X: ownerPos.X + 5, Y: ownerPos.Y + 5})
 				pet.TargetLocation = target
 				speed := float64(10.0)
 
@@ -2518,7 +2543,7 @@ func (c *Character) PetHandler() {
 					pet.MovementToken = utils.RandInt(1, math.MaxInt64)
 				}
 
-				go pet.MovementHandler(pet.MovementToken, &pet.Coordinate, &target, speed)
+				go pet.Walk(c.Map, pet.MovementToken, &pet.Coordinate, &target, speed)
 			}
 		} else { // Target mode
 			target := GetFromRegister(c.Socket.User.ConnectedServer, c.Map, uint16(pet.Target))
@@ -2541,20 +2566,21 @@ func (c *Character) PetHandler() {
 					seed := utils.RandInt(1, 1000)
 					r := utils.Packet{}
 					skillID := petInfo.GetSkills()
-					skill, ok := SkillInfos[skillID]
+					skill := FindSkillInfo(skillID)
+					ok := skill != nil
 					if seed < 500 && ok && pet.CHI >= skill.BaseChi && skillID != 0 {
 						r.Concat(pet.CastSkill(c))
 					} else {
 						r.Concat(pet.Attack(c))
 					}
 
-					p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.MOB_ATTACK}
+					p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.MOB_ATTACK, Origin: pet.CastOrigin()}
 					p.Cast()
 					pet.LastHit++
 
 				} else if distance > 3 && distance <= 50 { // chase
 					pet.IsMoving = true
-					target := GeneratePoint(aiCoordinate)
+					target := GeneratePoint(c.Map, aiCoordinate)
 					pet.TargetLocation = target
 					speed := float64(10.0)
 
@@ -2563,7 +2589,7 @@ func (c *Character) PetHandler() {
 						pet.MovementToken = utils.RandInt(1, math.MaxInt64)
 					}
 
-					go pet.MovementHandler(pet.MovementToken, &pet.Coordinate, &target, speed)
+					go pet.Walk(c.Map, pet.MovementToken, &pet.Coordinate, &target, speed)
 					pet.LastHit = 0
 
 				} else {
@@ -2593,20 +2619,21 @@ func (c *Character) PetHandler() {
 					seed := utils.RandInt(1, 1000)
 					r := utils.Packet{}
 					skillID := petInfo.GetSkills()
-					skill, ok := SkillInfos[skillID]
+					skill := FindSkillInfo(skillID)
+					ok := skill != nil
 					if seed < 500 && ok && pet.CHI >= skill.BaseChi && skillID != 0 {
 						r.Concat(pet.CastSkill(c))
 					} else {
 						r.Concat(pet.PlayerAttack(c))
 					}
 
-					p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.MOB_ATTACK}
+					p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.MOB_ATTACK, Origin: pet.CastOrigin()}
 					p.Cast()
 					pet.LastHit++
 
 				} else if distance > 3 && distance <= 50 { // chase
 					pet.IsMoving = true
-					target := GeneratePoint(aiCoordinate)
+					target := GeneratePoint(c.Map, aiCoordinate)
 					pet.TargetLocation = target
 					speed := float64(10.0)
 
@@ -2615,7 +2642,7 @@ func (c *Character) PetHandler() {
 						pet.MovementToken = utils.RandInt(1, math.MaxInt64)
 					}
 
-					go pet.MovementHandler(pet.MovementToken, &pet.Coordinate, &target, speed)
+					go pet.Walk(c.Map, pet.MovementToken, &pet.Coordinate, &target, speed)
 					pet.LastHit = 0
 
 				} else {
@@ -2735,8 +2762,9 @@ func (c *Character) HandleBuffs() {
 			id = d
 		}
 
-		infection, ok := BuffInfections[id]
-		if !ok {
+		infection := FindBuffInfection(id)
+
+		if infection == nil {
 			continue
 		}
 
@@ -2760,7 +2788,7 @@ func (c *Character) HandleLimitedItems() {
 
 	for _, slotID := range slotIDs {
 		slot := invSlots[slotID]
-		item := Items[slot.ItemID]
+		item := FindItem(slot.ItemID)
 		if item != nil && (item.TimerType == 1 || item.TimerType == 3) { // time limited item
 			if c.Epoch%60 == 0 {
 				data := c.DecrementItem(slotID, 1)
@@ -2797,7 +2825,7 @@ func (c *Character) HandleLimitedItems() {
 		start, end := starts[j], ends[j]
 		for slotID := start; slotID <= end; slotID++ {
 			slot := invSlots[slotID]
-			item := Items[slot.ItemID]
+			item := FindItem(slot.ItemID)
 			if slot.Activated {
 				if c.Epoch%60 == 0 {
 					data := c.DecrementItem(slotID, 1)
@@ -2974,7 +3002,7 @@ func (c *Character) ItemEffects(st *Stat, start, end int16) error {
 
 		if item.ItemID != 0 {
 
-			info := Items[item.ItemID]
+			info := FindItem(item.ItemID)
 			slotId := i
 			if slotId == 4 {
 				slotId = 3
@@ -3002,7 +3030,7 @@ func (c *Character) ItemEffects(st *Stat, start, end int16) error {
 			}
 
 			for _, id := range ids {
-				item := Items[id]
+				item := FindItem(id)
 				if item == nil {
 					continue
 				}
@@ -3097,13 +3125,13 @@ func (c *Character) AddExp(amount int64) ([]byte, bool) {
 	var exp int64
 
 	if c.Socket.User.ConnectedServer == 6 {
-		newRate := (expMultipler * EXP_RATE) * 1.15
+		newRate := (expMultipler * ExpRate()) * 1.15
 		exp = c.Exp + int64(float64(amount)*(newRate))
 	} else if c.Socket.User.ConnectedServer == 9 {
-		newRate := (expMultipler * EXP_RATE) * 1.50
+		newRate := (expMultipler * ExpRate()) * 1.50
 		exp = c.Exp + int64(float64(amount)*(newRate))
 	} else {
-		exp = c.Exp + int64(float64(amount)*(expMultipler*EXP_RATE))
+		exp = c.Exp + int64(float64(amount)*(expMultipler*ExpRate()))
 	}
 
 	spIndex := utils.SearchUInt64(SkillPoints, uint64(c.Exp))
@@ -3127,7 +3155,7 @@ func (c *Character) AddExp(amount int64) ([]byte, bool) {
 
 	levelUp := false
 	level := int16(c.Level)
-	targetExp := EXPs[level].Exp
+	targetExp := FindExp(level).Exp
 	skPts, sp := 0, 0
 	np := 0                                             //nature pts
 	for exp >= targetExp && level < 299 && canLevelUp { // Levelling up && level < 100
@@ -3140,7 +3168,7 @@ func (c *Character) AddExp(amount int64) ([]byte, bool) {
 		} else {
 			level++
 			st.HP = st.MaxHP
-			skPts += EXPs[int16(level)].SkillPoints
+			skPts += FindExp(int16(level)).SkillPoints
 
 			if level <= 100 {
 				sp += int(level/10) + 4
@@ -3170,7 +3198,7 @@ func (c *Character) AddExp(amount int64) ([]byte, bool) {
 				}
 			}
 
-			targetExp = EXPs[level].Exp
+			targetExp = FindExp(level).Exp
 			levelUp = true
 		}
 
@@ -3210,6 +3238,7 @@ func (c *Character) AddExp(amount int64) ([]byte, bool) {
 		resp.Concat(messaging.SystemMessage(messaging.LEVEL_UP))
 		resp.Concat(messaging.SystemMessage(messaging.LEVEL_UP_SP))
 		resp.Concat(messaging.InfoMessage(c.GetLevelText()))
+		resp.Concat(c.AdvanceAchievements(ACHIEVEMENT_LEVEL, 0, c.Level))
 
 		spawnData, err := c.SpawnCharacter()
 		if err == nil {
@@ -3253,7 +3282,7 @@ func (c *Character) AddPlayerExp(amount int64) ([]byte, bool) {
 
 	levelUp := false
 	level := int16(c.Level)
-	targetExp := EXPs[level].Exp
+	targetExp := FindExp(level).Exp
 	skPts, sp := 0, 0
 	np := 0                                             //nature pts
 	for exp >= targetExp && level < 299 && canLevelUp { // Levelling up && level < 100
@@ -3293,7 +3322,7 @@ func (c *Character) AddPlayerExp(amount int64) ([]byte, bool) {
 				sp = 13
 			}
 
-			targetExp = EXPs[level].Exp
+			targetExp = FindExp(level).Exp
 			levelUp = true
 		}
 		if level >= 101 && level < 201 { //divine nature stats
@@ -3324,6 +3353,7 @@ func (c *Character) AddPlayerExp(amount int64) ([]byte, bool) {
 		resp.Concat(messaging.SystemMessage(messaging.LEVEL_UP))
 		resp.Concat(messaging.SystemMessage(messaging.LEVEL_UP_SP))
 		resp.Concat(messaging.InfoMessage(c.GetLevelText()))
+		resp.Concat(c.AdvanceAchievements(ACHIEVEMENT_LEVEL, 0, c.Level))
 
 		spawnData, err := c.SpawnCharacter()
 		if err == nil {
@@ -3343,7 +3373,7 @@ func (c *Character) LosePlayerExp(percent int) (int64, error) {
 	level := int16(c.Level)
 	expminus := int64(0)
 	if level >= 10 {
-		oldExp := EXPs[level-1].Exp
+		oldExp := FindExp(level - 1).Exp
 		resp := EXP_SKILL_PT_CHANGED
 		if oldExp <= c.Exp {
 			per := float64(percent) / 200
@@ -3382,8 +3412,8 @@ func (c *Character) CombineItems(where, to int16) (int64, int16, error) {
 		return 0, 0, nil
 	}
 
-	whereInfoItem := Items[whereItem.ItemID]
-	toInfoItem := Items[toItem.ItemID]
+	whereInfoItem := FindItem(whereItem.ItemID)
+	toInfoItem := FindItem(toItem.ItemID)
 	slots := c.GetAllEquipedSlots()
 	useItem, _ := utils.Contains(slots, int(to))
 	isWeapon := false
@@ -3411,7 +3441,7 @@ func (c *Character) CombineItems(where, to int16) (int64, int16, error) {
 	}
 
 	if toItem.ItemID == whereItem.ItemID {
-		info := Items[toItem.ItemID]
+		info := FindItem(toItem.ItemID)
 		stackable := FindStackableByUIF(info.UIF)
 
 		if stackable != nil {
@@ -3495,7 +3525,7 @@ func (c *Character) ChangeMap(mapID int16, coordinate *utils.Location, args ...i
 				buff.Duration = int64(5) * 60
 				buff.Update()
 			} else {
-				buffinfo := BuffInfections[93]
+				buffinfo := FindBuffInfection(93)
 				buff = &Buff{ID: int(93), CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(5) * 60}
 				buff.Create()
 			}
@@ -3514,7 +3544,7 @@ func (c *Character) ChangeMap(mapID int16, coordinate *utils.Location, args ...i
 				buff.Duration = int64(60) * 60
 				buff.Update()
 			} else {
-				buffinfo := BuffInfections[70022]
+				buffinfo := FindBuffInfection(70022)
 				buff = &Buff{ID: int(70022), CharacterID: c.ID, Name: buffinfo.Name, ArtsATK: -2000, RunningSpeed: -10, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(60) * 60}
 				buff.Create()
 			}
@@ -3541,39 +3571,17 @@ func (c *Character) ChangeMap(mapID int16, coordinate *utils.Location, args ...i
 	}
 
 	if coordinate == nil { // if no coordinate then teleport home
-		d := SavePoints[uint8(mapID)]
+		d := FindSavePoint(uint8(mapID))
 		if d == nil {
 			d = &SavePoint{Point: "(100.0,100.0)"}
 		}
 		coordinate = ConvertPointToLocation(d.Point)
 	}
-	/*
-		if !c.IsinWar {
-			if coordinate == nil { // if no coordinate then teleport home
-				d := SavePoints[uint8(mapID)]
-				if d == nil {
-					d = &SavePoint{Point: "(100.0,100.0)"}
-				}
-				coordinate = ConvertPointToLocation(d.Point)
-			}
-		}  else {
-			if c.Faction == 1 && c.Map != 230 {
-				delete(OrderCharacters, c.ID)
-				c.IsinWar = false
-			} else if c.Faction == 2 && c.Map != 230 {
-				delete(ShaoCharacters, c.ID)
-				c.IsinWar = false
-			}
-		}
-	*/
-
-	if c.IsinLastMan {
-		if c.Map != 254 {
-			c.IsinLastMan = false
-			LastManMutex.Lock()
-			delete(LastManCharacters, c.ID)
-			LastManMutex.Unlock()
-		}
+	if b := c.Battleground(); b != nil && c.Map != b.kind().Map {
+		b.Leave(c)
+	}
+	if i := c.Dungeon(); i != nil && c.Map != i.Dungeon.Map {
+		i.Leave(c)
 	}
 
 	if funk.Contains(sharedMaps, mapID) { // shared map
@@ -3648,6 +3656,7 @@ func (c *Character) ChangeMap(mapID int16, coordinate *utils.Location, args ...i
 	if err == nil {
 		resp.Concat(data)
 	}
+	resp.Concat(c.AdvanceQuests(QUEST_MAP, int(mapID), 1))
 	return resp, nil
 }
 
@@ -3681,9 +3690,11 @@ func (c *Character) RemoveItem(slotID int16) ([]byte, error) {
 		resp.Concat(statData)
 	}
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 	if item.ItemID != 0 {
-		go logging.AddLogFile(5, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteminin süresi doldu veya sildi.")
+		e := c.Event(logging.ACTION_REMOVE_ITEM, fmt.Sprintf("%s expired or was removed", info.Name))
+		e.ItemIDs = []int64{item.ItemID}
+		logging.Emit(e)
 	}
 
 	/*
@@ -3764,8 +3775,15 @@ func (c *Character) SellItem(itemID, slot, quantity int, unitPrice uint64) ([]by
 		sellPrice = sellPrice + (sellPrice*uint64(percent))/100
 	}
 
+	slots, err := c.InventorySlots()
+	if err != nil {
+		return nil, err
+	}
+	RecordItem(ITEM_SOLD, slots[slot], -int64(slots[slot].Quantity), c, nil, "")
+
 	c.LootGold(sellPrice)
-	_, err := c.RemoveItem(int16(slot))
+	GoldCreated.Add(float64(sellPrice), "npc_sale")
+	_, err = c.RemoveItem(int16(slot))
 	if err != nil {
 		return nil, err
 	}
@@ -3829,7 +3847,7 @@ func (c *Character) GetStats() ([]byte, error) {
 	index += 4
 	index++
 
-	targetExp := EXPs[int16(c.Level)].Exp
+	targetExp := FindExp(int16(c.Level)).Exp
 	resp.Insert(utils.IntToBytes(uint64(targetExp), 8, true), index) // character target experience
 	index += 8
 
@@ -3948,7 +3966,7 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 		return resp, nil
 	}
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 
 	cost := (info.BuyPrice / 10) * int64(item.Plus+1) * int64(math.Pow(2, float64(len(stones)-1)))
 
@@ -3962,7 +3980,7 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 	}
 
 	stone := stones[0]
-	stoneInfo := Items[stone.ItemID]
+	stoneInfo := FindItem(stone.ItemID)
 
 	if int16(item.Plus) < stoneInfo.MinUpgradeLevel || stoneInfo.ID > 255 {
 		resp := messaging.SystemMessage(messaging.INCORRECT_GEM)
@@ -4003,7 +4021,7 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 	}
 
 	if luck != nil {
-		luckInfo := Items[luck.ItemID]
+		luckInfo := FindItem(luck.ItemID)
 		if luckInfo.Type == 164 { // charm of luck
 			var k float64
 			if luck.ItemID == 13000034 {
@@ -4063,13 +4081,14 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 
 	protectionInfo := &Item{}
 	if protection != nil {
-		protectionInfo = Items[protection.ItemID]
+		protectionInfo = FindItem(protection.ItemID)
 	}
 
 	resp := utils.Packet{}
 	c.LootGold(-uint64(cost))
 	resp.Concat(c.GetGold())
 
+	used := eventItems(append([]*InventorySlot{item, luck, protection}, stones...)...)
 	seed := int(utils.RandInt(0, 1000))
 	if float64(seed) < rate { // upgrade successful
 		var codes []byte
@@ -4077,20 +4096,16 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 			codes = append(codes, byte(stone.ItemID))
 		}
 
-		before := item.GetUpgrades()
 		resp.Concat(item.Upgrade(int16(slotID), codes...))
-		logger.Log(logging.ACTION_UPGRADE_ITEM, c.ID, fmt.Sprintf("Item (%d) upgraded: %s -> %s", item.ID, before, item.GetUpgrades()), c.UserID, c.Name)
+		resp.Concat(c.AdvanceAchievements(ACHIEVEMENT_ENHANCE, int(item.ItemID), int(item.Plus)))
+		e := c.Event(logging.ACTION_UPGRADE_ITEM, fmt.Sprintf("%s (%d) upgraded to +%d", info.Name, item.ID, item.Plus))
+		e.ItemIDs = used
+		logging.Emit(e)
 		/*if item.Plus > 7 {
 			if itemType != HT_ARMOR_TYPE && itemType != PET_ITEM_TYPE {
 				makeAnnouncement(c.Name + " has upgraded his " + info.Name + " to +" + strconv.Itoa(int(item.Plus)) + " successfully")
 			}
 		}*/
-		if luck != nil {
-			luckInfo := Items[luck.ItemID]
-			go logging.AddLogFile(4, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme başarılı şekilde artı bastı : +"+strconv.Itoa(int(item.Plus))+" Kullanılan luck: "+luckInfo.Name)
-		} else {
-			go logging.AddLogFile(4, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme başarılı şekilde artı bastı : +"+strconv.Itoa(int(item.Plus)))
-		}
 
 	} else if itemType == HT_ARMOR_TYPE || itemType == PET_ITEM_TYPE ||
 		(protection != nil && protectionInfo.GetType() == SCALE_TYPE) { // ht or pet item failed or got protection
@@ -4122,38 +4137,37 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 		r.Insert(item.GetSockets(), 35)                             // item sockets
 
 		resp.Concat(r)
-		logger.Log(logging.ACTION_UPGRADE_ITEM, c.ID, fmt.Sprintf("Item (%d) upgrade failed but not vanished", item.ID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_UPGRADE_ITEM, fmt.Sprintf("%s (%d) upgrade failed, item kept", info.Name, item.ID))
+		e.ItemIDs = used
+		logging.Emit(e)
 
 	} else { // casual item failed so destroy it
 		r := UPG_FAILED
 		r.Insert(utils.IntToBytes(uint64(item.ItemID), 4, true), 9) // item id
 		resp.Concat(r)
 
+		RecordItem(ITEM_DESTROYED, item, -int64(item.Quantity), c, nil, "upgrade")
 		itemsData, err := c.RemoveItem(int16(slotID))
 		if err != nil {
 			return nil, err
 		}
 
 		resp.Concat(itemsData)
-		if luck != nil {
-			luckInfo := Items[luck.ItemID]
-			go logging.AddLogFile(4, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme artı basarken yaktı. Kullanılan taş sayısı:  "+fmt.Sprintf("%d", len(stones))+" Kullanılan luck: "+luckInfo.Name)
-		} else {
-			go logging.AddLogFile(4, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme artı basarken yaktı. Kullanılan taş sayısı:  "+fmt.Sprintf("%d", len(stones)))
-		}
-		logger.Log(logging.ACTION_UPGRADE_ITEM, c.ID, fmt.Sprintf("Item (%d) upgrade failed and destroyed", item.ID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_UPGRADE_ITEM, fmt.Sprintf("%s upgrade failed, item destroyed with %d stones", info.Name, len(stones)))
+		e.ItemIDs = used
+		logging.Emit(e)
 	}
 
 	for _, slot := range stoneSlots {
-		resp.Concat(*c.DecrementItem(int16(slot), 1))
+		resp.Concat(*c.consumeItem(int16(slot), 1, "upgrade"))
 	}
 
 	if luck != nil {
-		resp.Concat(*c.DecrementItem(int16(luckSlot), 1))
+		resp.Concat(*c.consumeItem(int16(luckSlot), 1, "upgrade"))
 	}
 
 	if protection != nil {
-		resp.Concat(*c.DecrementItem(int16(protectionSlot), 1))
+		resp.Concat(*c.consumeItem(int16(protectionSlot), 1, "upgrade"))
 	}
 
 	err = item.Update()
@@ -4166,7 +4180,7 @@ func (c *Character) BSUpgrade(slotID int64, stones []*InventorySlot, luck, prote
 
 func (c *Character) BSProduction(book *InventorySlot, materials []*InventorySlot, special *InventorySlot, prodSlot int16, bookSlot, specialSlot int16, materialSlots []int16, materialCounts []uint) ([]byte, error) {
 
-	production := Productions[int(book.ItemID)]
+	production := FindProduction(int(book.ItemID))
 	prodMaterials, err := production.GetMaterials()
 	if err != nil {
 		return nil, err
@@ -4194,7 +4208,7 @@ func (c *Character) BSProduction(book *InventorySlot, materials []*InventorySlot
 	c.LootGold(-cost)
 	luckRate := float64(1)
 	if special != nil {
-		specialInfo := Items[special.ItemID]
+		specialInfo := FindItem(special.ItemID)
 		luckRate = float64(specialInfo.SellPrice+100) / 100
 	}
 
@@ -4213,22 +4227,26 @@ func (c *Character) BSProduction(book *InventorySlot, materials []*InventorySlot
 		}
 
 		resp.Concat(PRODUCTION_SUCCESS)
-		logger.Log(logging.ACTION_PRODUCTION, c.ID, fmt.Sprintf("Production (%d) success", book.ItemID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_PRODUCTION, fmt.Sprintf("Production of %d succeeded", production.Production))
+		e.ItemIDs, e.Gold = append(eventItems(append([]*InventorySlot{book, special}, materials...)...), int64(production.Production)), -int64(cost)
+		logging.Emit(e)
 
 	} else { // Failed
 		resp.Concat(PRODUCTION_FAILED)
 		resp.Concat(c.GetGold())
-		logger.Log(logging.ACTION_PRODUCTION, c.ID, fmt.Sprintf("Production (%d) failed", book.ItemID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_PRODUCTION, fmt.Sprintf("Production of %d failed", production.Production))
+		e.ItemIDs, e.Gold = eventItems(append([]*InventorySlot{book, special}, materials...)...), -int64(cost)
+		logging.Emit(e)
 	}
 
-	resp.Concat(*c.DecrementItem(int16(bookSlot), 1))
+	resp.Concat(*c.consumeItem(int16(bookSlot), 1, "production"))
 
 	for i := 0; i < len(materialSlots); i++ {
-		resp.Concat(*c.DecrementItem(int16(materialSlots[i]), uint(materialCounts[i])))
+		resp.Concat(*c.consumeItem(int16(materialSlots[i]), uint(materialCounts[i]), "production"))
 	}
 
 	if special != nil {
-		resp.Concat(*c.DecrementItem(int16(specialSlot), 1))
+		resp.Concat(*c.consumeItem(int16(specialSlot), 1, "production"))
 	}
 
 	return *resp, nil
@@ -4240,7 +4258,7 @@ func (c *Character) AdvancedFusion(items []*InventorySlot, special *InventorySlo
 		return nil, false, nil
 	}
 
-	fusion := Fusions[items[0].ItemID]
+	fusion := FindFusion(items[0].ItemID)
 	seed := int(utils.RandInt(0, 1000))
 
 	cost := uint64(fusion.Cost)
@@ -4255,7 +4273,7 @@ func (c *Character) AdvancedFusion(items []*InventorySlot, special *InventorySlo
 	c.LootGold(-cost)
 	rate := float64(fusion.Probability)
 	if special != nil {
-		info := Items[special.ItemID]
+		info := FindItem(special.ItemID)
 		rate *= float64(info.SellPrice+100) / 100
 	}
 
@@ -4270,20 +4288,24 @@ func (c *Character) AdvancedFusion(items []*InventorySlot, special *InventorySlo
 
 		resp.Concat(*itemData)
 		resp.Concat(FUSION_SUCCESS)
-		logger.Log(logging.ACTION_ADVANCED_FUSION, c.ID, fmt.Sprintf("Advanced fusion (%d) success", items[0].ItemID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_ADVANCED_FUSION, fmt.Sprintf("Fusion of %d succeeded", fusion.Production))
+		e.ItemIDs, e.Gold = append(eventItems(append([]*InventorySlot{special}, items...)...), fusion.Production), -int64(cost)
+		logging.Emit(e)
 		return resp, true, nil
 
 	} else { // Failed
 		resp := FUSION_FAILED
 		resp.Concat(c.GetGold())
-		logger.Log(logging.ACTION_ADVANCED_FUSION, c.ID, fmt.Sprintf("Advanced fusion (%d) failed", items[0].ItemID), c.UserID, c.Name)
+		e := c.Event(logging.ACTION_ADVANCED_FUSION, fmt.Sprintf("Fusion of %d failed", fusion.Production))
+		e.ItemIDs, e.Gold = eventItems(append([]*InventorySlot{special}, items...)...), -int64(cost)
+		logging.Emit(e)
 		return resp, false, nil
 	}
 }
 
 func (c *Character) Dismantle(item, special *InventorySlot) ([]byte, bool, error) {
 
-	melting := Meltings[int(item.ItemID)]
+	melting := FindMelting(int(item.ItemID))
 	if melting == nil {
 		return nil, false, nil
 	}
@@ -4305,10 +4327,11 @@ func (c *Character) Dismantle(item, special *InventorySlot) ([]byte, bool, error
 
 	c.LootGold(-cost)
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 
 	profit := utils.RandFloat(1, melting.ProfitMultiplier) * float64(info.BuyPrice*2)
 	c.LootGold(uint64(profit))
+	GoldCreated.Add(float64(uint64(profit)), "dismantle")
 
 	resp := utils.Packet{}
 	r := DISMANTLE_SUCCESS
@@ -4403,15 +4426,17 @@ func (c *Character) Dismantle(item, special *InventorySlot) ([]byte, bool, error
 	r.SetLength(length)
 	resp.Concat(r)
 	resp.Concat(c.GetGold())
-	logger.Log(logging.ACTION_DISMANTLE, c.ID, fmt.Sprintf("Dismantle (%d) success with %d gold", item.ID, c.Gold), c.UserID, c.Name)
+	e := c.Event(logging.ACTION_DISMANTLE, fmt.Sprintf("%s (%d) dismantled", info.Name, item.ID))
+	e.ItemIDs, e.Gold = eventItems(item, special), int64(uint64(profit))-int64(cost)
+	logging.Emit(e)
 	return resp, true, nil
 }
 
 func (c *Character) Extraction(item, special *InventorySlot, itemSlot int16) ([]byte, bool, error) {
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 	code := int(item.GetUpgrades()[item.Plus-1])
-	cost := uint64(info.SellPrice) * uint64(HaxCodes[code].ExtractionMultiplier) / 1000
+	cost := uint64(info.SellPrice) * uint64(FindHaxCode(code).ExtractionMultiplier) / 1000
 
 	if c.Gold < cost {
 		return nil, false, nil
@@ -4441,7 +4466,7 @@ func (c *Character) Extraction(item, special *InventorySlot, itemSlot int16) ([]
 			return nil, false, err
 		}
 
-		id := int64(HaxCodes[code].ExtractedItem)
+		id := int64(FindHaxCode(code).ExtractedItem)
 		itemData, _, err := c.AddItem(&InventorySlot{ItemID: id, Quantity: 1}, freeSlot, false)
 		if err != nil {
 			return nil, false, err
@@ -4476,13 +4501,16 @@ func (c *Character) Extraction(item, special *InventorySlot, itemSlot int16) ([]
 		return nil, false, err
 	}
 
-	logger.Log(logging.ACTION_EXTRACTION, c.ID, fmt.Sprintf("Extraction success for item (%d)", item.ID), c.UserID, c.Name)
+	e := c.Event(logging.ACTION_EXTRACTION, fmt.Sprintf("%s (%d) extracted to +%d", info.Name, item.ID, item.Plus))
+	e.ItemIDs, e.Gold = eventItems(item, special), -int64(cost)
+	logging.Emit(e)
 	return resp, true, nil
 }
 
 func (c *Character) CreateSocket(item, special *InventorySlot, itemSlot, specialSlot int16) ([]byte, error) {
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
+	used := eventItems(item, special)
 
 	cost := uint64(info.SellPrice * 164)
 	if c.Gold < cost {
@@ -4500,7 +4528,7 @@ func (c *Character) CreateSocket(item, special *InventorySlot, itemSlot, special
 
 	if item.SocketCount > 0 && special != nil {
 		if special.ItemID == 17200186 || special.ItemID == 17502301 {
-			resp := c.DecrementItem(specialSlot, 1)
+			resp := c.consumeItem(specialSlot, 1, "socket")
 			resp.Concat(item.CreateSocket(itemSlot, 0))
 			item.Update()
 			return *resp, nil
@@ -4516,7 +4544,7 @@ func (c *Character) CreateSocket(item, special *InventorySlot, itemSlot, special
 	/*
 		if item.SocketCount > 0 && special != nil && special.ItemID == 17200186 || special.ItemID == 17502301 { // socket init
 			fmt.Println("init")
-			resp := c.DecrementItem(specialSlot, 1)
+			resp := c.consumeItem(specialSlot, 1, "socket")
 			resp.Concat(item.CreateSocket(itemSlot, 0))
 			return *resp, nil
 
@@ -4556,15 +4584,12 @@ func (c *Character) CreateSocket(item, special *InventorySlot, itemSlot, special
 
 		}
 
-		resp.Concat(*c.DecrementItem(specialSlot, 1))
+		resp.Concat(*c.consumeItem(specialSlot, 1, "socket"))
 	}
 
-	if special != nil {
-		tmpInfo := Items[item.ItemID]
-		go logging.AddLogFile(6, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme socket açtı socket sayısı : +"+strconv.Itoa(int(socketCount))+" Kullanılan item: "+tmpInfo.Name)
-	} else {
-		go logging.AddLogFile(6, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme socket açtı socket sayısı : +"+strconv.Itoa(int(socketCount))+" Kullanılan item: Yok")
-	}
+	e := c.Event(logging.ACTION_CREATE_SOCKET, fmt.Sprintf("%s (%d) got %d sockets", info.Name, item.ID, socketCount))
+	e.ItemIDs, e.Gold = used, -int64(cost)
+	logging.Emit(e)
 
 	item.SocketCount = socketCount
 	item.Update()
@@ -4575,7 +4600,7 @@ func (c *Character) CreateSocket(item, special *InventorySlot, itemSlot, special
 
 func (c *Character) UpgradeSocket(item, socket, special, edit *InventorySlot, itemSlot, socketSlot, specialSlot, editSlot int16, locks []bool) ([]byte, error) {
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 	cost := uint64(info.SellPrice * 164)
 	if c.Gold < cost {
 		return nil, nil
@@ -4662,25 +4687,22 @@ func (c *Character) UpgradeSocket(item, socket, special, edit *InventorySlot, it
 		sockets[i] = code
 	}
 
-	if special != nil {
-		tmpInfo := Items[item.ItemID]
-		go logging.AddLogFile(6, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme socket bastı socket arr : +"+string(item.GetSockets())+" Kullanılan item: "+tmpInfo.Name)
-	} else {
-		go logging.AddLogFile(6, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakterine ait ("+info.Name+") iteme socket açtı socket sayısı : +"+string(item.GetSockets())+" Kullanılan item: Yok")
-	}
+	e := c.Event(logging.ACTION_UPGRADE_SOCKET, fmt.Sprintf("%s (%d) sockets set to %v", info.Name, item.ID, sockets))
+	e.ItemIDs, e.Gold = eventItems(item, socket, special, edit), -int64(cost)
+	logging.Emit(e)
 
 	c.LootGold(-cost)
 	resp := utils.Packet{}
 	resp.Concat(item.UpgradeSocket(itemSlot, sockets))
 	resp.Concat(c.GetGold())
-	resp.Concat(*c.DecrementItem(socketSlot, 1))
+	resp.Concat(*c.consumeItem(socketSlot, 1, "socket upgrade"))
 
 	if special != nil {
-		resp.Concat(*c.DecrementItem(specialSlot, 1))
+		resp.Concat(*c.consumeItem(specialSlot, 1, "socket upgrade"))
 	}
 
 	if edit != nil {
-		resp.Concat(*c.DecrementItem(editSlot, 1))
+		resp.Concat(*c.consumeItem(editSlot, 1, "socket upgrade"))
 	}
 
 	return resp, nil
@@ -4688,8 +4710,8 @@ func (c *Character) UpgradeSocket(item, socket, special, edit *InventorySlot, it
 
 func (c *Character) HolyWaterUpgrade(item, holyWater *InventorySlot, itemSlot, holyWaterSlot int16) ([]byte, error) {
 
-	itemInfo := Items[item.ItemID]
-	hwInfo := Items[holyWater.ItemID]
+	itemInfo := FindItem(item.ItemID)
+	hwInfo := FindItem(holyWater.ItemID)
 
 	if (itemInfo.GetType() == WEAPON_TYPE && (hwInfo.HolyWaterUpg1 < 66 || hwInfo.HolyWaterUpg1 > 105)) ||
 		(itemInfo.GetType() == ARMOR_TYPE && (hwInfo.HolyWaterUpg1 < 41 || hwInfo.HolyWaterUpg1 > 65)) ||
@@ -4735,12 +4757,12 @@ func (c *Character) HolyWaterUpgrade(item, holyWater *InventorySlot, itemSlot, h
 			resp.Concat(r)
 
 			new := funk.Map(item.GetUpgrades()[:item.Plus], func(upg byte) string {
-				return HaxCodes[int(upg)].Code
+				return FindHaxCode(int(upg)).Code
 			}).([]string)
 
 			old := make([]string, len(new))
 			copy(old, new)
-			old[randSlot] = HaxCodes[int(preUpgrade)].Code
+			old[randSlot] = FindHaxCode(int(preUpgrade)).Code
 
 			msg := fmt.Sprintf("[%s] has been upgraded from [%s] to [%s].", itemInfo.Name, strings.Join(old, ""), strings.Join(new, ""))
 			msgData := messaging.InfoMessage(msg)
@@ -4784,8 +4806,9 @@ func (c *Character) RegisterItem(item *InventorySlot, price uint64, itemSlot int
 		return nil, nil
 	}
 
-	info, ok := Items[item.ItemID]
-	if !ok {
+	info := FindItem(item.ItemID)
+
+	if info == nil {
 		return nil, nil
 	}
 
@@ -4809,7 +4832,9 @@ func (c *Character) RegisterItem(item *InventorySlot, price uint64, itemSlot int
 		return nil, err
 	}
 
-	go logging.AddLogFile(3, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakteri ile consa bir item kayıt etti. Item : ("+info.Name+") Fiyat: ("+strconv.Itoa(int(price))+") (CONSIG)")
+	e := c.Event(logging.ACTION_REGISTER_CONS_ITEM, fmt.Sprintf("%s (%d) listed for %d gold", info.Name, item.ID, price))
+	e.ItemIDs, e.Gold = []int64{item.ItemID}, -int64(commision)
+	logging.Emit(e)
 
 	c.LootGold(-commision)
 	resp := ITEM_REGISTERED
@@ -4837,6 +4862,7 @@ func (c *Character) RegisterItem(item *InventorySlot, price uint64, itemSlot int
 	newItem.Consignment = true
 	newItem.Update()
 	InventoryItems.Add(newItem.ID, newItem)
+	RecordItem(ITEM_LISTED, newItem, 0, c, nil, fmt.Sprintf("price %d", price))
 
 	*item = *NewSlot()
 	resp.Concat(c.GetGold())
@@ -4874,7 +4900,7 @@ func (c *Character) ClaimMenu() ([]byte, error) {
 			slot.Quantity = 1
 		}
 
-		info := Items[int64(slot.ItemID)]
+		info := FindItem(int64(slot.ItemID))
 
 		if item.IsSold {
 			resp.Insert([]byte{0x01}, index)
@@ -4961,16 +4987,16 @@ func (c *Character) BuyConsignmentItem(consignmentID int) ([]byte, error) {
 	}
 
 	slot, err := FindInventorySlotByID(consignmentItem.ID)
-	if err != nil {
+	if err != nil || slot == nil {
 		return nil, err
 	}
 
-	if c.Gold < consignmentItem.Price {
+	if !slot.Consignment || slot.CharacterID.Int64 != int64(consignmentItem.SellerID) {
 		return nil, nil
 	}
 
-	seller, err := FindCharacterByID(int(slot.CharacterID.Int64))
-	if err != nil {
+	seller, err := FindCharacterByID(consignmentItem.SellerID)
+	if err != nil || seller == nil {
 		return nil, err
 	}
 
@@ -4982,7 +5008,7 @@ func (c *Character) BuyConsignmentItem(consignmentID int) ([]byte, error) {
 	resp.Insert(utils.IntToBytes(uint64(consignmentID), 4, true), 8) // consignment item id
 
 	slotID, err := c.FindFreeSlot()
-	if err != nil {
+	if err != nil || slotID < 0 {
 		return nil, nil
 	}
 
@@ -4993,28 +5019,37 @@ func (c *Character) BuyConsignmentItem(consignmentID int) ([]byte, error) {
 	newItem.CharacterID = null.IntFrom(int64(c.ID))
 	newItem.SlotID = slotID
 
-	err = newItem.Update()
-	if err != nil {
+	c.AddingGold.Lock()
+	if c.Gold < consignmentItem.Price {
+		c.AddingGold.Unlock()
+		return nil, nil
+	}
+
+	err = consignmentItem.sell(seller, c, newItem, c.Gold-consignmentItem.Price)
+	if err == ErrConsignmentSold {
+		c.AddingGold.Unlock()
+		return nil, nil
+	} else if err != nil {
+		c.AddingGold.Unlock()
 		return nil, err
 	}
 
+	c.Gold -= consignmentItem.Price
+	c.AddingGold.Unlock()
+
 	*slots[slotID] = *newItem
 	InventoryItems.Add(newItem.ID, slots[slotID])
-	c.LootGold(-consignmentItem.Price)
 
 	resp.Concat(newItem.GetData(slotID))
 	resp.Concat(c.GetGold())
 
-	s, ok := Sockets[seller.UserID]
-	if ok {
+	if s := GetSocket(seller.UserID); s != nil {
 		s.Write(CONSIGMENT_ITEM_SOLD)
 	}
 
-	go logging.AddLogFile(3, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakteri ile consdan bir item satın aldı Item : ("+strconv.Itoa(newItem.ID)+") Fiyat: ("+strconv.Itoa(int(consignmentItem.Price))+") Satıcı: ("+seller.Name+")("+seller.UserID+") (CONSIG)")
-
-	logger.Log(logging.ACTION_BUY_CONS_ITEM, c.ID, fmt.Sprintf("Bought consignment item (%d) with %d gold from (%d)", newItem.ID, consignmentItem.Price, seller.ID), c.UserID, c.Name)
-	consignmentItem.IsSold = true
-	go consignmentItem.Update()
+	e := c.Event(logging.ACTION_BUY_CONS_ITEM, fmt.Sprintf("Bought consignment item (%d) from %s", newItem.ID, seller.Name))
+	e.TargetID, e.ItemIDs, e.Gold = seller.ID, []int64{newItem.ItemID}, -int64(consignmentItem.Price)
+	logging.Emit(e)
 	return resp, nil
 }
 
@@ -5030,7 +5065,7 @@ func (c *Character) ClaimConsignmentItem(consignmentID int, isCancel bool) ([]by
 	})
 
 	consignmentItem, err := FindConsignmentItemByID(consignmentID)
-	if err != nil || consignmentItem == nil {
+	if err != nil || consignmentItem == nil || consignmentItem.SellerID != c.ID {
 		return nil, err
 	}
 
@@ -5048,12 +5083,12 @@ func (c *Character) ClaimConsignmentItem(consignmentID int, isCancel bool) ([]by
 		}
 
 		slotID, err := c.FindFreeSlot()
-		if err != nil {
+		if err != nil || slotID < 0 {
 			return nil, err
 		}
 
 		slot, err := FindInventorySlotByID(consignmentItem.ID)
-		if err != nil {
+		if err != nil || slot == nil {
 			return nil, err
 		}
 
@@ -5062,33 +5097,43 @@ func (c *Character) ClaimConsignmentItem(consignmentID int, isCancel bool) ([]by
 		newItem.Consignment = false
 		newItem.SlotID = slotID
 
-		err = newItem.Update()
-		if err != nil {
+		err = withdraw(consignmentID, c, newItem)
+		if err == ErrConsignmentSold {
+			return nil, nil
+		} else if err != nil {
 			return nil, err
 		}
 
 		*slots[slotID] = *newItem
 		InventoryItems.Add(newItem.ID, slots[slotID])
 
-		resp.Concat(slot.GetData(slotID))
+		resp.Concat(newItem.GetData(slotID))
 
 	} else {
 		if !consignmentItem.IsSold {
 			return nil, nil
 		}
 
-		logger.Log(logging.ACTION_BUY_CONS_ITEM, c.ID, fmt.Sprintf("Claimed consignment item (consid:%d) with %d gold", consignmentID, consignmentItem.Price), c.UserID, c.Name)
+		c.AddingGold.Lock()
+		amount, err := payOut(consignmentID, c)
+		if err == ErrConsignmentNotFound {
+			c.AddingGold.Unlock()
+			return nil, nil
+		} else if err != nil {
+			c.AddingGold.Unlock()
+			return nil, err
+		}
 
-		c.LootGold(consignmentItem.Price)
-		resp.Concat(c.GetGold())
-	}
+		c.Gold += amount
+		c.AddingGold.Unlock()
+
+		e := c.Event(logging.ACTION_CLAIM_CONS_ITEM, fmt.Sprintf("Claimed the price of consignment item (%d)", consignmentID))
+		e.Gold = int64(amount)
+		logging.Emit(e)
 
-	s, _ := FindInventorySlotByID(consignmentItem.ID)
-	if s != nil && !s.UserID.Valid && !s.CharacterID.Valid {
-		s.Delete()
+		resp.Concat(c.GetGold())
 	}
 
-	go consignmentItem.Delete()
 	return resp, nil
 }
 
@@ -5104,7 +5149,7 @@ func (c *Character) FindItemInUsed(itemIDs []int64) (bool, error) {
 				continue
 			}
 
-			infoItem := Items[slot.ItemID]
+			infoItem := FindItem(slot.ItemID)
 			if slots[index].InUse && infoItem.HtType != 21 {
 				return true, nil
 			}
@@ -5139,7 +5184,7 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 		//return *c.DecrementItem(slotID, 0), nil
 	}
 
-	info := Items[item.ItemID]
+	info := FindItem(item.ItemID)
 	if info == nil {
 		return nil, nil
 	} else if info.MinLevel > c.Level || (info.MaxLevel > 0 && info.MaxLevel < c.Level) {
@@ -5168,13 +5213,8 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 		c.Targets = []*Target{}
 		c.PlayerTargets = []*PlayerTarget{}
 		c.Selection = 0
-		if c.IsinLastMan {
-			c.IsinLastMan = false
-			LastManMutex.Lock()
-			delete(LastManCharacters, c.ID)
-			LastManMutex.Unlock()
-		}
-		d := SavePoints[uint8(c.Map)]
+		c.LeaveBattleground()
+		d := FindSavePoint(uint8(c.Map))
 		coordinate := ConvertPointToLocation(d.Point)
 		resp.Concat(c.Teleport(coordinate))
 
@@ -5291,7 +5331,7 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 		c.InvMutex.Lock()
 		defer c.InvMutex.Unlock()
 
-		gambling := GamblingItems[int(item.ItemID)]
+		gambling := FindGambling(int(item.ItemID))
 		if gambling == nil || gambling.Cost > c.Gold { // FIX Gambling null
 			resp := utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x59, 0x08, 0xF9, 0x03, 0x55, 0xAA} // not enough gold
 			return resp, nil
@@ -5317,13 +5357,13 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 		c.LootGold(-gambling.Cost)
 		resp.Concat(c.GetGold())
 
-		drop, ok := Drops[gambling.DropID]
-		if drop == nil || !ok {
+		drop := FindDrop(gambling.DropID)
+		if drop == nil {
 			goto FALLBACK
 		}
 
 		var itemID int
-		for ok {
+		for drop != nil {
 			index := 0
 			seed := int(utils.RandInt(0, 1000))
 			items := drop.GetItems()
@@ -5342,11 +5382,11 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 			}
 
 			itemID = items[index]
-			drop, ok = Drops[itemID]
+			drop = FindDrop(itemID)
 		}
 
 		plus, quantity, upgs := uint8(0), uint(1), []byte{}
-		rewardInfo := Items[int64(itemID)]
+		rewardInfo := FindItem(int64(itemID))
 		if rewardInfo != nil {
 			if rewardInfo.ID == 235 || rewardInfo.ID == 242 || rewardInfo.ID == 254 || rewardInfo.ID == 255 { // Socket-PP-Ghost Dagger-Dragon Scale
 				var rates []int
@@ -5373,7 +5413,7 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 					itemID++
 				}
 
-				rewardInfo = Items[int64(itemID)]
+				rewardInfo = FindItem(int64(itemID))
 			} else if funk.Contains(haxBoxes, item.ItemID) { // Hax Box
 				seed := utils.RandInt(0, 1000)
 				plus = uint8(sort.SearchInts(plusRates, int(seed)) + 1)
@@ -5417,8 +5457,8 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 			item.SetUpgrades(upgs)
 
 			if rewardInfo.GetType() == PET_TYPE {
-				petInfo := Pets[int64(rewardInfo.ID)]
-				petExpInfo := PetExps[int16(petInfo.Level)]
+				petInfo := FindPet(int64(rewardInfo.ID))
+				petExpInfo := FindPetExp(int16(petInfo.Level))
 
 				targetExps := []int{petExpInfo.ReqExpEvo1, petExpInfo.ReqExpEvo2, petExpInfo.ReqExpEvo3, petExpInfo.ReqExpHt}
 				item.Pet = &PetSlot{
@@ -5612,7 +5652,7 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 			return NO_SLOTS_FOR_SKILL_BOOK, nil // FIX resp
 		}
 
-		skillInfos := SkillInfosByBook[item.ItemID]
+		skillInfos := FindSkillInfosByBook(item.ItemID)
 		set := &SkillSet{BookID: item.ItemID}
 		c := 0
 		for i := 1; i <= 24; i++ { // there should be 24 skills with empty ones
@@ -5729,9 +5769,9 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 
 		if item.ItemID == 15400002 {
 			skillPoint := 0
-			for i := range EXPs {
-				if int(EXPs[i].Level) <= c.Level {
-					skillPoint += EXPs[i].SkillPoints
+			for _, exp := range AllExps() {
+				if int(exp.Level) <= c.Level {
+					skillPoint += exp.SkillPoints
 				}
 			}
 			c.Class = 0
@@ -5902,8 +5942,8 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 			return resp, nil
 		}
 
-		gambling := GamblingItems[int(item.ItemID)]
-		d := Drops[gambling.DropID]
+		gambling := FindGambling(int(item.ItemID))
+		d := FindDrop(gambling.DropID)
 		items := d.GetItems()
 
 		if c.Gold >= gambling.Cost {
@@ -5954,7 +5994,7 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 			if itemID == 0 {
 				continue
 			}
-			info := Items[int64(itemID)]
+			info := FindItem(int64(itemID))
 			reward := NewSlot()
 			reward.ItemID = int64(itemID)
 			reward.Quantity = 1
@@ -6022,8 +6062,8 @@ func (c *Character) UseConsumable(item *InventorySlot, slotID int16) ([]byte, er
 	case HOLY_WATER_TYPE:
 		goto FALLBACK
 	case FORM_TYPE:
-		info, ok := Items[int64(item.ItemID)]
-		if !ok || item.Activated != c.Morphed {
+		info := FindItem(int64(item.ItemID))
+		if info == nil || item.Activated != c.Morphed {
 			goto FALLBACK
 		}
 
@@ -6292,7 +6332,7 @@ func (c *Character) UpgradeSkill(slotIndex, skillIndex byte) ([]byte, error) {
 	set := skillSlots.Slots[slotIndex]
 	skill := set.Skills[skillIndex]
 
-	info := SkillInfos[skill.SkillID]
+	info := FindSkillInfo(skill.SkillID)
 	if int8(skill.Plus) >= info.MaxPlus {
 		return nil, nil
 	}
@@ -6346,7 +6386,7 @@ func (c *Character) DowngradeSkill(slotIndex, skillIndex byte) ([]byte, error) {
 	set := skillSlots.Slots[slotIndex]
 	skill := set.Skills[skillIndex]
 
-	info := SkillInfos[skill.SkillID]
+	info := FindSkillInfo(skill.SkillID)
 	if int8(skill.Plus) <= 0 {
 		return nil, nil
 	}
@@ -6603,7 +6643,8 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 	}
 	petSlot := slots[0x0A]
 	pet := petSlot.Pet
-	petInfo, ok := Pets[petSlot.ItemID]
+	petInfo := FindPet(petSlot.ItemID)
+	ok := petInfo != nil
 	if pet != nil && ok && pet.IsOnline && !petInfo.Combat {
 		return nil, nil
 	}
@@ -6612,14 +6653,14 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 	skills := c.Socket.Skills
 
 	canCast := false
-	skillInfo := SkillInfos[skillID]
+	skillInfo := FindSkillInfo(skillID)
 	weapon := slots[c.WeaponSlot]
 	if weapon.ItemID == 0 { // there are some skills which can be casted without weapon such as monk skills
 		if c.Type == MONK || c.Type == DIVINE_MONK {
 			canCast = true
 		}
 	} else {
-		weaponInfo := Items[weapon.ItemID]
+		weaponInfo := FindItem(weapon.ItemID)
 		canCast = weaponInfo.CanUse(skillInfo.Type)
 
 		if !canCast {
@@ -6631,7 +6672,7 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 
 			weapon2 := slots[c.WeaponSlot]
 			if weapon2 != nil && weapon2.ItemID != 0 {
-				weapon2Info := Items[weapon2.ItemID]
+				weapon2Info := FindItem(weapon2.ItemID)
 				canCast = weapon2Info.CanUse(skillInfo.Type)
 
 				if canCast {
@@ -6779,7 +6820,7 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 			goto COMBAT
 		}
 
-		infection := BuffInfections[skillInfo.InfectionID]
+		infection := FindBuffInfection(skillInfo.InfectionID)
 		duration := (skillInfo.BaseTime + skillInfo.AdditionalTime*int(plus)) / 10
 
 		if skillInfo.InfectionID == 92 {
@@ -6795,7 +6836,7 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 			if seed > 0 {
 				buff, err := FindBuffByID(92, character.ID)
 				if err == nil && buff == nil {
-					buffinfo := BuffInfections[92]
+					buffinfo := FindBuffInfection(92)
 					buff = &Buff{ID: int(92), CharacterID: character.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: character.Epoch, Duration: int64(duration)}
 
 					err := buff.Create()
@@ -6842,7 +6883,7 @@ func (c *Character) CastSkill(attackCounter, skillID, targetID int, cX, cY, cZ f
 			if seed > 0 {
 				buff, err := FindBuffByID(246, character.ID)
 				if err == nil && buff == nil {
-					buffinfo := BuffInfections[246]
+					buffinfo := FindBuffInfection(246)
 					buff = &Buff{ID: int(246), CharacterID: character.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: character.Epoch, Duration: int64(duration)}
 
 					err := buff.Create()
@@ -7191,32 +7232,8 @@ func (c *Character) CalculateDamage(ai *AI, isSkill bool) (int, error) {
 		dmg = ai.HP
 	}
 
-	if c.Map == 243 {
-		if YingYangMobsCounter[c.Map] == nil {
-			YingYangMobsCounter[c.Map] = &DungeonMobsCounter{
-				BlackBandits:       50,
-				Rogues:             50,
-				Ghosts:             50,
-				Animals:            50,
-				BlackBanditsLeader: 1,
-				RogueKingsLeader:   1,
-				GhostWarriorKing:   1,
-				BeastMaster:        1,
-				Paechun:            1,
-			}
-		}
-		YingYangMobsMutex.Lock()
-		counter := YingYangMobsCounter[c.Map]
-		YingYangMobsMutex.Unlock()
-		if npcPos.NPCID == 60003 && counter.BlackBandits > 5 {
-			dmg = 0
-		} else if npcPos.NPCID == 60005 && counter.Rogues > 15 {
-			dmg = 0
-		} else if npcPos.NPCID == 60008 && counter.Ghosts > 15 {
-			dmg = 0
-		} else if (npcPos.NPCID == 60013 || npcPos.NPCID == 60014) && (counter.BlackBanditsLeader > 0 || counter.RogueKingsLeader > 0 || counter.GhostWarriorKing > 0) {
-			dmg = 0
-		}
+	if c.DungeonLocked(npcPos.NPCID) {
+		dmg = 0
 	}
 
 	if diff := int(npc.Level) - c.Level; diff > 0 {
@@ -7229,36 +7246,6 @@ func (c *Character) CalculateDamage(ai *AI, isSkill bool) (int, error) {
 		}
 	}
 
-	if c.Map == 1 {
-		if AchievementMobsCounter[c.Map] == nil {
-			AchievementMobsCounter[c.Map] = &AchievementMobCounter{
-				WolfPup: 3,
-			}
-		}
-		AchievementMobsMutex.Lock()
-		counter := AchievementMobsCounter[c.Map]
-		AchievementMobsMutex.Unlock()
-		if npcPos.NPCID == 40101 {
-			if counter.WolfPup > 0 {
-				counter.WolfPup--
-			}
-		} /*else if counter.WolfPup == 0 {
-			c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You have been promoted to Beginner!")))
-			ANNOUNCEMENT := utils.Packet{0xAA, 0x55, 0x54, 0x00, 0x71, 0x14, 0x51, 0x55, 0xAA}
-			msg := " has accomplished the [Beginning] stage"
-			announce := ANNOUNCEMENT
-			index := 6
-			announce[index] = byte(len(c.Name) + len(msg))
-			index++
-			announce.Insert([]byte("["+c.Name+"]"), index) // character name
-			index += len(c.Name) + 2
-			announce.Insert([]byte(msg), index) // character name
-			announce.SetLength(int16(binary.Size(announce) - 6))
-			p := nats.CastPacket{CastNear: false, Data: announce}
-			p.Cast()
-			return dmg, nil
-		}*/
-	}
 	return dmg, nil
 }
 
@@ -7307,17 +7294,13 @@ func (c *Character) CalculateDamageToPlayer(enemy *Character, isSkill bool) (int
 
 func (c *Character) CancelTrade() {
 
+	// a trade being settled is removed once it is done
 	trade := FindTrade(c)
-	if trade == nil {
+	if trade == nil || trade.IsCompleting() {
 		return
 	}
 
-	receiver, sender := trade.Receiver.Character, trade.Sender.Character
-	trade.Delete()
-
-	resp := TRADE_CANCELLED
-	sender.Socket.Write(resp)
-	receiver.Socket.Write(resp)
+	trade.Cancel()
 }
 
 func (c *Character) OpenSale(name string, slotIDs []int16, prices []uint64) ([]byte, error) {
@@ -7332,7 +7315,7 @@ func (c *Character) OpenSale(name string, slotIDs []int16, prices []uint64) ([]b
 		slotID := slotIDs[i]
 		price := prices[i]
 		item := slots[slotID]
-		info := Items[item.ItemID]
+		info := FindItem(item.ItemID)
 
 		if slotID == 0 || price == 0 || item == nil || item.ItemID == 0 || info.Tradable == 2 {
 			continue
@@ -7464,11 +7447,13 @@ func (c *Character) BuySaleItem(saleID uint16, saleSlotID, inventorySlotID int16
 	mySlots[inventorySlotID] = myItem
 	myItem.Update()
 	InventoryItems.Add(myItem.ID, myItem)
+	RecordItem(ITEM_BOUGHT, myItem, 0, seller, c, fmt.Sprintf("shop, price %d", saleItem.Price))
 
 	resp.Concat(item.GetData(inventorySlotID))
-	//logger.Log(logging.ACTION_BUY_SALE_ITEM, c.ID, fmt.Sprintf("Bought sale item (%d) with %d gold from seller (%d)", myItem.ID, saleItem.Price, seller.ID), c.UserID, c.Name)
-	itemInfo := Items[item.ItemID]
-	go logging.AddLogFile(3, c.Socket.User.ID+" idli kullanici ("+c.Name+") isimli karakteriyle, ("+seller.Socket.User.ID+") idye sahip ("+seller.Name+") isimli karakterin kurduğu pazardan item çekti. İtem:  (+"+strconv.Itoa(int(item.Plus))+" "+itemInfo.Name+") Fiyat: ("+strconv.Itoa(int(saleItem.Price))+")G (SALES)")
+	itemInfo := FindItem(item.ItemID)
+	e := c.Event(logging.ACTION_BUY_SALE_ITEM, fmt.Sprintf("Bought +%d %s (%d) from the shop of %s", item.Plus, itemInfo.Name, myItem.ID, seller.Name))
+	e.TargetID, e.ItemIDs, e.Gold = seller.ID, []int64{item.ItemID}, -int64(saleItem.Price)
+	logging.Emit(e)
 	saleItem.IsSold = true
 
 	sellerResp := SOLD_SALE_ITEM
@@ -7631,7 +7616,7 @@ func (c *Character) JobPassives(stat *Stat) error {
 	}
 
 	if passive := skillSlots.Slots[5]; passive.BookID > 0 {
-		info := JobPassives[int8(c.Class)]
+		info := FindJobPassive(int8(c.Class))
 		if info != nil {
 			plus := passive.Skills[0].Plus
 			stat.MaxHP += info.MaxHp * plus
@@ -7653,7 +7638,7 @@ func (c *Character) JobPassives(stat *Stat) error {
 
 	for _, slot := range slots {
 		for _, skill := range slot.Skills {
-			info := SkillInfos[skill.SkillID]
+			info := FindSkillInfo(skill.SkillID)
 			if info == nil {
 				continue
 			}
@@ -7794,7 +7779,7 @@ func (c *Character) GetLevelText() string {
 
 func (c *Character) RelicDrop(itemID int64) []byte {
 
-	itemName := Items[itemID].Name
+	itemName := FindItem(itemID).Name
 	relic := Relics[int(itemID)]
 	msg := fmt.Sprintf("%s has acquired %d / (out of %d) [%s].", c.Name, relic.Count, relic.Limit, itemName)
 	length := int16(len(msg) + 3)
@@ -7870,7 +7855,7 @@ func (c *Character) TogglePet() []byte {
 
 	spawnData, _ := c.SpawnCharacter()
 	pet.PetOwner = c
-	petInfo := Pets[petSlot.ItemID]
+	petInfo := FindPet(petSlot.ItemID)
 	if petInfo.Combat || !petInfo.Combat {
 		location := ConvertPointToLocation(c.Coordinate)
 		pet.Coordinate = utils.Location{X: location.X + 3, Y: location.Y}
@@ -7931,8 +7916,8 @@ func (c *Character) TogglePet() []byte {
 
 		spawnData, _ := c.SpawnCharacter()
 		pet.PetOwner = c
-		petInfo, ok := Pets[petSlot.ItemID]
-		if ok && !petInfo.Combat {
+		petInfo := FindPet(petSlot.ItemID)
+		if petInfo != nil && !petInfo.Combat {
 			p := nats.CastPacket{CastNear: true, CharacterID: c.ID, Data: spawnData}
 			p.Cast()
 		}
@@ -8019,7 +8004,7 @@ func (c *Character) DealDamageToPlayer(char *Character, dmg int) {
 		}
 		index += 4
 	} else {
-		fmt.Println("Valami error: %s", err)
+		fmt.Printf("Valami error: %s\n", err)
 	}
 	r.SetLength(int16(binary.Size(r) - 6))
 	c.Socket.Write(r)
@@ -8159,102 +8144,14 @@ func CheckMobDead(ai *AI, c *Character) {
 		go ai.DropHandler(c)
 	}
 	if ai.HP <= 0 { // ai died
-		if c.Map == 243 {
-			if YingYangMobsCounter[c.Map] == nil {
-				YingYangMobsCounter[c.Map] = &DungeonMobsCounter{
-					BlackBandits:       0,
-					Rogues:             0,
-					Ghosts:             0,
-					Animals:            0,
-					BlackBanditsLeader: 0,
-					RogueKingsLeader:   0,
-					GhostWarriorKing:   0,
-					BeastMaster:        0,
-					Paechun:            0,
-				}
-			}
-
-			YingYangMobsMutex.Lock()
-			counter := YingYangMobsCounter[c.Map]
-			YingYangMobsMutex.Unlock()
-			if npcPos.NPCID == 60001 || npcPos.NPCID == 60002 || npcPos.NPCID == 60015 || npcPos.NPCID == 60016 {
-				counter.BlackBandits--
-				if counter.BlackBandits < 0 {
-					counter.BlackBandits = 0
-				}
-				c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You have %d BlackBandits left to kill", counter.BlackBandits)))
-			} else if npcPos.NPCID == 60004 || npcPos.NPCID == 60018 {
-				counter.Rogues--
-				if counter.Rogues < 0 {
-					counter.Rogues = 0
-				}
-				c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You have %d Rogues left to kill", counter.Rogues)))
-			} else if npcPos.NPCID == 60006 || npcPos.NPCID == 60007 || npcPos.NPCID == 60020 || npcPos.NPCID == 60021 {
-				counter.Ghosts--
-				if counter.Ghosts < 0 {
-					counter.Ghosts = 0
-				}
-				c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You have %d Ghosts left to kill", counter.Ghosts)))
-			} else if npcPos.NPCID == 60009 || npcPos.NPCID == 60010 || npcPos.NPCID == 60011 || npcPos.NPCID == 60012 ||
-				npcPos.NPCID == 60023 || npcPos.NPCID == 60024 || npcPos.NPCID == 60025 || npcPos.NPCID == 60026 {
-				counter.Animals--
-				if counter.Animals < 0 {
-					counter.Animals = 0
-				}
-				c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You have %d animals left to kill", counter.Animals)))
-			} else if npcPos.NPCID == 60003 {
-				counter.BlackBanditsLeader--
-				if counter.BlackBanditsLeader < 0 {
-					counter.BlackBanditsLeader = 0
-				}
-			} else if npcPos.NPCID == 60005 {
-				counter.RogueKingsLeader--
-				if counter.RogueKingsLeader < 0 {
-					counter.RogueKingsLeader = 0
-				}
-			} else if npcPos.NPCID == 60008 {
-				counter.GhostWarriorKing--
-				if counter.GhostWarriorKing < 0 {
-					counter.GhostWarriorKing = 0
-				}
-			} else if npcPos.NPCID == 60013 || npcPos.NPCID == 60014 {
-				if npcPos.NPCID == 60013 {
-					counter.BeastMaster--
-					if counter.BeastMaster < 0 {
-						counter.BeastMaster = 0
-					}
-				}
-				if npcPos.NPCID == 60014 {
-					counter.Paechun--
-					if counter.Paechun < 0 {
-						counter.Paechun = 0
-					}
-				}
-			}
+		for _, m := range dropMembers(c) {
+			m.Character.Socket.Write(m.Character.AdvanceQuests(QUEST_KILL, npcPos.NPCID, 1))
 		}
+		c.Socket.Write(c.AdvanceAchievements(ACHIEVEMENT_KILL, npcPos.NPCID, 1))
 
-		/*if ai.HP <= 0 { // ai died
-			if c.Map == 1 {
-				if AchievementMobsCounter[c.Map] == nil {
-					AchievementMobsCounter[c.Map] = &AchievementMobCounter{
-						WolfPup: 0,
-					}
-
-				}
-
-				AchievementMobsMutex.Lock()
-				counter := AchievementMobsCounter[c.Map]
-				AchievementMobsMutex.Unlock()
-				if npcPos.NPCID == 40101 {
-					counter.WolfPup--
-					if counter.WolfPup < 0 {
-						counter.WolfPup = 0
-						c.Socket.Write(messaging.InfoMessage(fmt.Sprintf("Kill %d More Wolf Pups to achieve the [Beginning] Achievement", counter.WolfPup)))
-					}
-					return
-				}
-			}
-		}*/
+		if data := c.DungeonKill(npcPos.NPCID); len(data) > 0 {
+			c.Socket.Write(data)
+		}
 
 		// 			//Tusan					Tokma           // Hoho            // Rakma           // Red Dragon		//Leopard			//Ancient 		// Clan Leader 		// Hulma			// Mahu			// Devil Jin
 		if npc.ID == 9999991 || npc.ID == 9999992 || npc.ID == 9999993 || npc.ID == 9999994 || npc.ID == 9999995 || npc.ID == 9999996 || npc.ID == 9999997 || npc.ID == 9999998 || npc.ID == 42561 || npc.ID == 42562 || npc.ID == 43206 {
@@ -8367,31 +8264,7 @@ func CheckMobDead(ai *AI, c *Character) {
 			c.Selection = 0
 		}
 
-		if npc.ID == 424201 && WarStarted {
-			OrderPoints = 0 //OrderPoints -= 200
-		} else if npc.ID == 424202 && WarStarted {
-			ShaoPoints = 0 // ShaoPoints -= 200
-		}
-
-		if isFactionWarStarted {
-			if npc.ID == 425501 {
-				AddPointsToFactionWarFaction(1, 2)
-			} else if npc.ID == 425502 {
-				AddPointsToFactionWarFaction(15, 2)
-			} else if npc.ID == 425503 {
-				AddPointsToFactionWarFaction(2, 2)
-			} else if npc.ID == 425504 {
-				AddPointsToFactionWarFaction(1000, 2)
-			} else if npc.ID == 425505 {
-				AddPointsToFactionWarFaction(15, 1)
-			} else if npc.ID == 425506 {
-				AddPointsToFactionWarFaction(1, 1)
-			} else if npc.ID == 425507 {
-				AddPointsToFactionWarFaction(2, 1)
-			} else if npc.ID == 425508 {
-				AddPointsToFactionWarFaction(1000, 1)
-			}
-		}
+		c.BattlegroundNPCKill(npc.ID)
 
 		if npc.ID == 18600038 {
 			dealers := ai.DamageDealers.Values()
@@ -8505,37 +8378,37 @@ func CheckMobDead(ai *AI, c *Character) {
 		if goldDrop > 0 {
 			amount := uint64(utils.RandInt(goldDrop/2, goldDrop))
 			if GOLD_EVENT == 1 {
-				r = c.LootGold(amount * uint64(GOLD_RATE))
-			} else {
-				r = c.LootGold(amount)
+				amount *= uint64(GOLD_RATE)
 			}
+			r = c.LootGold(amount)
+			GoldCreated.Add(float64(amount), "loot")
 
 			c.Socket.Write(r)
 		}
 
 		claimer, _ := ai.FindClaimer()
-		if funk.Contains(FiveclanMobs, npc.ID) {
+		if funk.Contains(FindTerritory(TERRITORY_FIVE_CLANS).Mobs, npc.ID) {
 			if claimer.GuildID != -1 {
 				/*
 					guildTempleCounter := 0
 
-					if FiveClans[1].ClanID == claimer.GuildID {
+					if FindTerritory(TERRITORY_FIVE_CLANS).Holder(1) == claimer.GuildID {
 						guildTempleCounter++
 					}
 
-					if FiveClans[2].ClanID == claimer.GuildID {
+					if FindTerritory(TERRITORY_FIVE_CLANS).Holder(2) == claimer.GuildID {
 						guildTempleCounter++
 					}
 
-					if FiveClans[3].ClanID == claimer.GuildID {
+					if FindTerritory(TERRITORY_FIVE_CLANS).Holder(3) == claimer.GuildID {
 						guildTempleCounter++
 					}
 
-					if FiveClans[4].ClanID == claimer.GuildID {
+					if FindTerritory(TERRITORY_FIVE_CLANS).Holder(4) == claimer.GuildID {
 						guildTempleCounter++
 					}
 
-					if FiveClans[5].ClanID == claimer.GuildID {
+					if FindTerritory(TERRITORY_FIVE_CLANS).Holder(5) == claimer.GuildID {
 						guildTempleCounter++
 					}
 
@@ -8545,9 +8418,7 @@ func CheckMobDead(ai *AI, c *Character) {
 				*/
 				exp := time.Now().UTC().Add(time.Hour * 6)
 				if npc.ID == 423308 { //HWARANG GUARDIAN STATUE //SOUTHERN WOOD TEMPLE
-					FiveClans[4].ClanID = c.GuildID
-					FiveClans[4].ExpiresAt = null.TimeFrom(exp)
-					FiveClans[4].Update()
+					FindTerritory(TERRITORY_FIVE_CLANS).Capture(4, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8567,7 +8438,7 @@ func CheckMobDead(ai *AI, c *Character) {
 
 						// 5 Drop
 						// 15 Exp
-						infection := BuffInfections[70004]
+						infection := FindBuffInfection(70004)
 						buff := &Buff{ID: int(70004), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 5, DropMultiplier: 2, StartedAt: char.Epoch, Duration: 21500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8579,11 +8450,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + FiveClans[4].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_FIVE_CLANS).Area(4).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 423310 { //SUGUN GUARDIAN STATUE //LIGHTNING HILL TEMPLE
-					FiveClans[3].ClanID = c.GuildID
-					FiveClans[3].ExpiresAt = null.TimeFrom(exp)
-					FiveClans[3].Update()
+					FindTerritory(TERRITORY_FIVE_CLANS).Capture(3, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						fmt.Println(err)
@@ -8603,7 +8472,7 @@ func CheckMobDead(ai *AI, c *Character) {
 							continue
 						}
 
-						infection := BuffInfections[70003]
+						infection := FindBuffInfection(70003)
 						buff := &Buff{ID: int(70003), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 5, DropMultiplier: 2, StartedAt: char.Epoch, Duration: 21500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8616,11 +8485,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + FiveClans[3].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_FIVE_CLANS).Area(3).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 423312 { //CHUNKYUNG GUARDIAN STATUE //OCEAN ARMY TEMPLE
-					FiveClans[2].ClanID = c.GuildID
-					FiveClans[2].ExpiresAt = null.TimeFrom(exp)
-					FiveClans[2].Update()
+					FindTerritory(TERRITORY_FIVE_CLANS).Capture(2, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8637,7 +8504,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70002]
+						infection := FindBuffInfection(70002)
 						buff := &Buff{ID: int(70002), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 2, DropMultiplier: 2, StartedAt: char.Epoch, Duration: 21500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8649,11 +8516,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + FiveClans[2].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_FIVE_CLANS).Area(2).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 423314 { //MOKNAM GUARDIAN STATUE //FLAME WOLF TEMPLE
-					FiveClans[1].ClanID = c.GuildID
-					FiveClans[1].ExpiresAt = null.TimeFrom(exp)
-					FiveClans[1].Update()
+					FindTerritory(TERRITORY_FIVE_CLANS).Capture(1, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8670,7 +8535,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70001]
+						infection := FindBuffInfection(70001)
 						buff := &Buff{ID: int(70001), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 3, DropMultiplier: 2, StartedAt: char.Epoch, Duration: 21500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8682,11 +8547,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + FiveClans[1].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_FIVE_CLANS).Area(1).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 423316 { //JISU GUARDIAN STATUE //WESTERN LAND TEMPLE
-					FiveClans[5].ClanID = c.GuildID
-					FiveClans[5].ExpiresAt = null.TimeFrom(exp)
-					FiveClans[5].Update()
+					FindTerritory(TERRITORY_FIVE_CLANS).Capture(5, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8703,7 +8566,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70005]
+						infection := FindBuffInfection(70005)
 						buff := &Buff{ID: int(70005), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 5, DropMultiplier: 2, StartedAt: char.Epoch, Duration: 21500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8714,18 +8577,16 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + FiveClans[5].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_FIVE_CLANS).Area(5).Name + "] has been conquered by [" + guild.Name + "]")
 				}
 			}
 		}
 
-		if funk.Contains(GuildWarMobs, npc.ID) {
+		if funk.Contains(FindTerritory(TERRITORY_GUILD_WAR).Mobs, npc.ID) {
 			if claimer.GuildID != -1 {
 				exp := time.Now().UTC().Add(time.Hour * 24 * 6)
 				if npc.ID == 18600047 { //HWARANG GUARDIAN STATUE //SOUTHERN WOOD TEMPLE
-					GuildWarAreas[4].ClanID = c.GuildID
-					GuildWarAreas[4].ExpiresAt = null.TimeFrom(exp)
-					GuildWarAreas[4].Update()
+					FindTerritory(TERRITORY_GUILD_WAR).Capture(4, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8743,7 +8604,7 @@ func CheckMobDead(ai *AI, c *Character) {
 							continue
 						}
 
-						infection := BuffInfections[70013]
+						infection := FindBuffInfection(70013)
 						buff := &Buff{ID: int(70013), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 3, StartedAt: char.Epoch, Duration: 604500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8755,11 +8616,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + GuildWarAreas[4].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_GUILD_WAR).Area(4).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 18600048 { //SUGUN GUARDIAN STATUE //LIGHTNING HILL TEMPLE
-					GuildWarAreas[3].ClanID = c.GuildID
-					GuildWarAreas[3].ExpiresAt = null.TimeFrom(exp)
-					GuildWarAreas[3].Update()
+					FindTerritory(TERRITORY_GUILD_WAR).Capture(3, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						fmt.Println(err)
@@ -8779,7 +8638,7 @@ func CheckMobDead(ai *AI, c *Character) {
 							continue
 						}
 
-						infection := BuffInfections[70012]
+						infection := FindBuffInfection(70012)
 						buff := &Buff{ID: int(70012), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 3, StartedAt: char.Epoch, Duration: 604500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8792,11 +8651,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + GuildWarAreas[3].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_GUILD_WAR).Area(3).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 18600049 { //CHUNKYUNG GUARDIAN STATUE //OCEAN ARMY TEMPLE
-					GuildWarAreas[2].ClanID = c.GuildID
-					GuildWarAreas[2].ExpiresAt = null.TimeFrom(exp)
-					GuildWarAreas[2].Update()
+					FindTerritory(TERRITORY_GUILD_WAR).Capture(2, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8813,7 +8670,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70009]
+						infection := FindBuffInfection(70009)
 						buff := &Buff{ID: int(70009), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, StartedAt: char.Epoch, Duration: 604500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8824,11 +8681,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + GuildWarAreas[2].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_GUILD_WAR).Area(2).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 18600050 { //MOKNAM GUARDIAN STATUE //FLAME WOLF TEMPLE
-					GuildWarAreas[1].ClanID = c.GuildID
-					GuildWarAreas[1].ExpiresAt = null.TimeFrom(exp)
-					GuildWarAreas[1].Update()
+					FindTerritory(TERRITORY_GUILD_WAR).Capture(1, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8845,7 +8700,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70010]
+						infection := FindBuffInfection(70010)
 						buff := &Buff{ID: int(70010), CharacterID: char.ID, Name: infection.Name, DropMultiplier: 5, StartedAt: char.Epoch, Duration: 604500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8856,11 +8711,9 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + GuildWarAreas[1].TempleName + "] has been conquered by [" + guild.Name + "]")
+					makeAnnouncement("[" + FindTerritory(TERRITORY_GUILD_WAR).Area(1).Name + "] has been conquered by [" + guild.Name + "]")
 				} else if npc.ID == 18600051 { //JISU GUARDIAN STATUE //WESTERN LAND TEMPLE
-					GuildWarAreas[5].ClanID = c.GuildID
-					GuildWarAreas[5].ExpiresAt = null.TimeFrom(exp)
-					GuildWarAreas[5].Update()
+					FindTerritory(TERRITORY_GUILD_WAR).Capture(5, c.GuildID, exp)
 					guild, err := FindGuildByID(c.GuildID)
 					if err != nil {
 						return
@@ -8877,7 +8730,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						if err != nil {
 							continue
 						}
-						infection := BuffInfections[70011]
+						infection := FindBuffInfection(70011)
 						buff := &Buff{ID: int(70011), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 3, StartedAt: char.Epoch, Duration: 604500, CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -8888,40 +8741,7 @@ func CheckMobDead(ai *AI, c *Character) {
 						char.Update()
 					}
 
-					makeAnnouncement("[" + GuildWarAreas[5].TempleName + "] has been conquered by [" + guild.Name + "]")
-				}
-			}
-		}
-
-		if npc.ID == 18600078 {
-			exp := time.Now().UTC().Add(time.Hour * 24 * 23)
-			GoldenBasinArea.ExpiresAt = null.TimeFrom(exp)
-			GoldenBasinArea.FactionID = claimer.Faction
-			err := GoldenBasinArea.Update()
-			if err != nil {
-				fmt.Println("Golden basin update err : ", err)
-			}
-			if claimer.Faction == 1 {
-				//makeAnnouncement("Zhuangs has conquered the Golden Basin")
-				chars := FindCharactersInMap(76)
-				for _, c := range chars {
-					if c != nil && c.Socket != nil {
-						if c.Faction != 1 {
-							tmpData, _ := c.ChangeMap(1, nil)
-							c.Socket.Write(tmpData)
-						}
-					}
-				}
-			} else if claimer.Faction == 2 {
-				//makeAnnouncement("Shaos has conquered the Golden Basin")
-				chars := FindCharactersInMap(76)
-				for _, c := range chars {
-					if c != nil && c.Socket != nil {
-						if c.Faction != 2 {
-							tmpData, _ := c.ChangeMap(1, nil)
-							c.Socket.Write(tmpData)
-						}
-					}
+					makeAnnouncement("[" + FindTerritory(TERRITORY_GUILD_WAR).Area(5).Name + "] has been conquered by [" + guild.Name + "]")
 				}
 			}
 		}
@@ -9012,7 +8832,7 @@ func (c *Character) CanAttack(enemy *Character) bool {
 		return true
 	}
 
-	if c.Map == 108 || c.Map == 255 && c.Faction != enemy.Faction {
+	if c.Map == 108 {
 		return true
 	}
 
@@ -9022,14 +8842,8 @@ func (c *Character) CanAttack(enemy *Character) bool {
 		}
 	}
 
-	if c.Map == 254 && LastmanStarted && c.IsinLastMan && enemy.IsinLastMan {
-		return true
-	}
-
-	if c.IsinWar && enemy.IsinWar && c.Faction != enemy.Faction {
-		if WarStarted {
-			return true
-		}
+	if b := c.Battleground(); b != nil && b == enemy.Battleground() {
+		return b.Hostile(c, enemy)
 	}
 
 	if c.Map == 76 && enemy.Faction != c.Faction {
@@ -9156,7 +8970,7 @@ func (c *Character) GoDarkness() {
 	skills.SkillPoints = skPts
 	if c.Level > 100 {
 		for i := 101; i <= c.Level; i++ {
-			skills.SkillPoints += EXPs[int16(i)].SkillPoints
+			skills.SkillPoints += FindExp(int16(i)).SkillPoints
 		}
 	}
 
@@ -9230,7 +9044,7 @@ func (c *Character) Enchant(bookID int64, matsSlots []int16, matsIds []int64) ([
 		return nil, err
 	}
 
-	enhancement := Enhancements[int(bookID)]
+	enhancement := FindEnhancement(int(bookID))
 	if enhancement == nil {
 		return ENCHANT_ERROR, nil
 	}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -15,6 +16,9 @@ import (
 )
 
 var (
+	ErrConsignmentSold     = errors.New("consignment item is already sold")
+	ErrConsignmentNotFound = errors.New("consignment item not found")
+
 	orders     = map[int]string{1: "item_name", 2: "quantity", 3: "expires_at", 4: "price"}
 	categories = map[int][]int{
 		1:  {70, 71, 99, 100, 101, 102, 103, 104, 105, 107, 108},
@@ -47,6 +51,7 @@ type ConsignmentItem struct {
 	Price     uint64    `db:"price" json:"price"`
 	IsSold    bool      `db:"is_sold" json:"is_sold"`
 	ExpiresAt null.Time `db:"expires_at" json:"expires_at"`
+	Escrow    uint64    `db:"escrow" json:"escrow"` // gold paid by the buyer, held until the seller claims it
 }
 
 func (e *ConsignmentItem) PreInsert(s gorp.SqlExecutor) error {
@@ -177,7 +182,7 @@ func CountConsignmentItems(category, minUpgLevel, maxUpgLevel int, minPrice, max
 			return false
 		}
 
-		info := Items[slot.ItemID]
+		info := FindItem(slot.ItemID)
 		if info == nil || !strings.Contains(strings.ToLower(info.Name), strings.ToLower(itemName)) ||
 			slot.Plus < uint8(minUpgLevel) || slot.Plus > uint8(maxUpgLevel) || len(cats) == 0 {
 
@@ -226,3 +231,119 @@ func FindConsignmentItemByID(id int) (*ConsignmentItem, error) {
 
 	return item, nil
 }
+
+// sell marks the item sold and moves item (the copy of the listed slot that
+// goes into the buyer's inventory) and the price in one transaction. The
+// price is kept in escrow until the seller claims it. It fails with
+// ErrConsignmentSold if another buyer was faster.
+func (e *ConsignmentItem) sell(seller, buyer *Character, item *InventorySlot, buyerGold uint64) error {
+	tr, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	}
+
+	res, err := tr.Exec(`update hops.consignment set is_sold = true, escrow = $1 where id = $2 and is_sold = false`, e.Price, e.ID)
+	if err != nil {
+		tr.Rollback()
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	} else if n, _ := res.RowsAffected(); n != 1 {
+		tr.Rollback()
+		return ErrConsignmentSold
+	}
+
+	if err := item.UpdateWithTransaction(tr); err != nil {
+		tr.Rollback()
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	}
+
+	if err := recordItem(tr, ITEM_BOUGHT, item, 0, seller, buyer, fmt.Sprintf("price %d", e.Price)); err != nil {
+		tr.Rollback()
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	}
+
+	if _, err := tr.Exec(`update hops.characters set gold = $1 where id = $2`, buyerGold, buyer.ID); err != nil {
+		tr.Rollback()
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	}
+
+	if err := tr.Commit(); err != nil {
+		return fmt.Errorf("ConsignmentItem.sell: %s", err.Error())
+	}
+
+	e.IsSold = true
+	e.Escrow = e.Price
+	return nil
+}
+
+// payOut removes the sold item of seller and returns the gold held in escrow
+// for it, after writing the seller's new gold in the same transaction.
+func payOut(consignmentID int, seller *Character) (uint64, error) {
+	tr, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("payOut: %s", err.Error())
+	}
+
+	item := &ConsignmentItem{}
+	if err := tr.SelectOne(item, `select * from hops.consignment where id = $1 for update`, consignmentID); err != nil {
+		tr.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, ErrConsignmentNotFound
+		}
+		return 0, fmt.Errorf("payOut: %s", err.Error())
+	} else if item.SellerID != seller.ID || !item.IsSold {
+		tr.Rollback()
+		return 0, ErrConsignmentNotFound
+	}
+
+	res, err := tr.Exec(`delete from hops.consignment where id = $1 and is_sold = true`, consignmentID)
+	if err != nil {
+		tr.Rollback()
+		return 0, fmt.Errorf("payOut: %s", err.Error())
+	} else if n, _ := res.RowsAffected(); n != 1 {
+		tr.Rollback()
+		return 0, ErrConsignmentNotFound
+	}
+
+	if _, err := tr.Exec(`update hops.characters set gold = $1 where id = $2`, seller.Gold+item.Escrow, seller.ID); err != nil {
+		tr.Rollback()
+		return 0, fmt.Errorf("payOut: %s", err.Error())
+	}
+
+	if err := tr.Commit(); err != nil {
+		return 0, fmt.Errorf("payOut: %s", err.Error())
+	}
+	return item.Escrow, nil
+}
+
+// withdraw removes the unsold item of seller and puts item (the copy of the
+// listed slot) back into the seller's inventory in one transaction.
+func withdraw(consignmentID int, seller *Character, item *InventorySlot) error {
+	tr, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("withdraw: %s", err.Error())
+	}
+
+	res, err := tr.Exec(`delete from hops.consignment where id = $1 and seller_id = $2 and is_sold = false`, consignmentID, seller.ID)
+	if err != nil {
+		tr.Rollback()
+		return fmt.Errorf("withdraw: %s", err.Error())
+	} else if n, _ := res.RowsAffected(); n != 1 {
+		tr.Rollback()
+		return ErrConsignmentSold
+	}
+
+	if err := item.UpdateWithTransaction(tr); err != nil {
+		tr.Rollback()
+		return fmt.Errorf("withdraw: %s", err.Error())
+	}
+
+	if err := recordItem(tr, ITEM_WITHDRAWN, item, 0, nil, seller, ""); err != nil {
+		tr.Rollback()
+		return fmt.Errorf("withdraw: %s", err.Error())
+	}
+
+	if err := tr.Commit(); err != nil {
+		return fmt.Errorf("withdraw: %s", err.Error())
+	}
+	return nil
+}
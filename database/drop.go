@@ -25,6 +25,7 @@ func (drop *Drop) GenerateIDForDrop(server int, mapID int16) {
 		if _, ok := DropRegister[server][mapID][i]; !ok {
 			DropRegister[server][mapID][i] = drop
 			drop.ID = int(i)
+			DropGrid.Move(dropGridID(server, mapID, i), server, mapID, &drop.Location)
 			return
 		}
 	}
@@ -54,4 +55,5 @@ func RemoveFromDropRegister(server int, mapID int16, dropID uint16) {
 	drMutex.Lock()
 	defer drMutex.Unlock()
 	delete(DropRegister[server][mapID], dropID)
+	DropGrid.Remove(dropGridID(server, mapID, dropID))
 }
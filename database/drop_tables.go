@@ -0,0 +1,573 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/thoas/go-funk"
+)
+
+const (
+	DROP_WEIGHT_TOTAL = 1000 // the weights of a weighted group are out of this, the rest drops nothing
+	DROP_MAX_DEPTH    = 8
+	DROP_MAX_ATTEMPTS = 100 // rolls of a kill, including the ones repeated for min_rolls
+	DROP_REROLLS      = 10
+)
+
+var (
+	DropGroups        = make(map[int]*DropGroup)
+	dropsMutex        sync.RWMutex
+	NPCDrops          = make(map[int]*NPCDrop)
+	npcDropsMutex     sync.RWMutex
+	DropMapRates      = make(map[int16]*DropMapRate)
+	dropMapRatesMutex sync.RWMutex
+
+	// DEFAULT_NPC_DROP are the drop rules of npcs without a data.npc_drops row.
+	DEFAULT_NPC_DROP = NPCDrop{MaxRolls: 20, MaxLevelGap: 30, MapRates: true}
+
+	// CharacterHasQuest tells if a character is on a quest, for the drops
+	// that need one. Without it those entries never drop.
+	CharacterHasQuest func(c *Character, questID int) bool
+)
+
+func FindNPCDrop(id int) *NPCDrop {
+	npcDropsMutex.RLock()
+	defer npcDropsMutex.RUnlock()
+	return NPCDrops[id]
+}
+
+func FindDropGroup(id int) *DropGroup {
+	dropsMutex.RLock()
+	defer dropsMutex.RUnlock()
+	return DropGroups[id]
+}
+
+func FindDropMapRate(id int16) *DropMapRate {
+	dropMapRatesMutex.RLock()
+	defer dropMapRatesMutex.RUnlock()
+	return DropMapRates[id]
+}
+
+// DropGroup is a drop table. A weighted group drops one of its entries by
+// weight or nothing, a guaranteed group drops every entry. A per member group
+// is rolled for every party member near, who get the items directly.
+type DropGroup struct {
+	ID         int          `db:"id" json:"id"`
+	Guaranteed bool         `db:"guaranteed" json:"guaranteed"`
+	PerMember  bool         `db:"per_member" json:"per_member"`
+	Rolls      int          `db:"rolls" json:"rolls"`
+	Entries    []*DropEntry `db:"-" json:"entries"`
+
+	legacy   *DropInfo // the data.drops row the group was made from
+	problems []string
+}
+
+// DropEntry is an item or another group. Entries with conditions the member
+// doesn't meet are left out of the roll.
+type DropEntry struct {
+	ID          int `db:"id" json:"-"`
+	GroupID     int `db:"group_id" json:"-"`
+	ItemID      int `db:"item_id" json:"item_id,omitempty"`
+	SubGroupID  int `db:"sub_group_id" json:"sub_group_id,omitempty"`
+	Weight      int `db:"weight" json:"weight"`
+	MinQuantity int `db:"min_quantity" json:"min_quantity"`
+	MaxQuantity int `db:"max_quantity" json:"max_quantity"`
+	MinLevel    int `db:"min_level" json:"min_level,omitempty"`
+	MaxLevel    int `db:"max_level" json:"max_level,omitempty"`
+	QuestID     int `db:"quest_id" json:"quest_id,omitempty"`
+}
+
+// NPCDrop are the drop rules of an npc. Its group is rolled again as long as
+// something drops, up to MaxRolls times; rolls that drop nothing are repeated
+// until MinRolls rolls dropped something.
+type NPCDrop struct {
+	NPCID       int     `db:"npc_id" json:"npc_id"`
+	GroupID     int     `db:"group_id" json:"group_id"` // 0 uses the drop id of the npc
+	Multiplier  float64 `db:"multiplier" json:"multiplier"`
+	MinRolls    int     `db:"min_rolls" json:"min_rolls"`
+	MaxRolls    int     `db:"max_rolls" json:"max_rolls"`
+	MaxLevelGap int     `db:"max_level_gap" json:"max_level_gap"` // -1 for no limit
+	MapRates    bool    `db:"map_rates" json:"map_rates"`
+	Pickaxe     float64 `db:"pickaxe_multiplier" json:"pickaxe_multiplier"` // added to multiplier while the claimer's pickaxe is active
+}
+
+// DropMapRate is the rate of the drops on a map and the items that never
+// drop there.
+type DropMapRate struct {
+	MapID    int16   `db:"map_id" json:"map_id"`
+	Rate     float64 `db:"rate" json:"rate"`
+	Excluded string  `db:"excluded_items" json:"excluded_items"`
+
+	excluded []int
+}
+
+// DropMember is who a drop is rolled for, Character is nil in the simulator.
+type DropMember struct {
+	Character *Character
+	Level     int
+	HasQuest  func(questID int) bool
+}
+
+// DropRoll rolls drop groups for the members, the claimer first.
+type DropRoll struct {
+	Members  []*DropMember
+	Rate     float64    // 1 rolls the weights as they are
+	Excluded []int      // items left out of the roll, of the map
+	Rand     *rand.Rand // nil uses the global source
+}
+
+// DroppedItem is the result of a roll. Member is set for the items of per
+// member groups.
+type DroppedItem struct {
+	ItemID   int
+	Quantity int
+	Member   *DropMember
+}
+
+// DropStat is how often an item dropped in a simulation.
+type DropStat struct {
+	ItemID   int
+	Quantity int // dropped in total
+	Kills    int // kills that dropped it at least once
+}
+
+func readDropGroups() (map[int]*DropGroup, error) {
+	var infos []*DropInfo
+	if _, err := db.Select(&infos, `select * from data.drops`); err != nil {
+		return nil, fmt.Errorf("readDropGroups: %s", err.Error())
+	}
+
+	var groups []*DropGroup
+	if _, err := db.Select(&groups, `select * from data.drop_groups`); err != nil {
+		return nil, fmt.Errorf("readDropGroups: %s", err.Error())
+	}
+
+	var entries []*DropEntry
+	if _, err := db.Select(&entries, `select * from data.drop_entries order by group_id, id`); err != nil {
+		return nil, fmt.Errorf("readDropGroups: %s", err.Error())
+	}
+
+	return buildDropGroups(infos, groups, entries), nil
+}
+
+// buildDropGroups makes weighted groups of the data.drops rows, where an
+// entry is another group when a row has its id, and adds the data.drop_groups.
+func buildDropGroups(infos []*DropInfo, groups []*DropGroup, entries []*DropEntry) map[int]*DropGroup {
+	m := make(map[int]*DropGroup, len(infos)+len(groups))
+	for _, d := range infos {
+		m[d.ID] = &DropGroup{ID: d.ID, Rolls: 1, legacy: d}
+	}
+
+	for _, g := range groups {
+		if old, ok := m[g.ID]; ok && old.legacy != nil {
+			g.problems = append(g.problems, "the id is also in data.drops")
+		}
+		m[g.ID] = g
+	}
+
+	for _, e := range entries {
+		if g := m[e.GroupID]; g != nil && g.legacy == nil {
+			g.Entries = append(g.Entries, e)
+		}
+	}
+
+	for _, g := range m {
+		if g.legacy == nil {
+			continue
+		}
+
+		items, err := parseIDs(g.legacy.Items)
+		if err != nil {
+			g.problems = append(g.problems, "items: "+err.Error())
+		}
+		probs, err := parseIDs(g.legacy.Probabilities)
+		if err != nil {
+			g.problems = append(g.problems, "probabilities: "+err.Error())
+		}
+
+		last := 0
+		for i := 0; i < len(items) && i < len(probs); i++ {
+			e := &DropEntry{GroupID: g.ID, Weight: probs[i] - last, MinQuantity: 1, MaxQuantity: 1}
+			if sub, ok := m[items[i]]; ok && sub.legacy != nil {
+				e.SubGroupID = items[i]
+			} else {
+				e.ItemID = items[i]
+			}
+			g.Entries = append(g.Entries, e)
+			last = probs[i]
+		}
+	}
+	return m
+}
+
+func setDropGroups(groups map[int]*DropGroup) {
+	drops := make(map[int]*DropInfo)
+	for id, g := range groups {
+		if g.legacy != nil {
+			drops[id] = g.legacy
+		}
+	}
+	DropGroups, Drops = groups, drops
+}
+
+func readNPCDrops() (map[int]*NPCDrop, error) {
+	var rules []*NPCDrop
+	query := `select * from data.npc_drops`
+
+	if _, err := db.Select(&rules, query); err != nil {
+		return nil, fmt.Errorf("readNPCDrops: %s", err.Error())
+	}
+
+	m := make(map[int]*NPCDrop, len(rules))
+	for _, r := range rules {
+		m[r.NPCID] = r
+	}
+	return m, nil
+}
+
+func readDropMapRates() (map[int16]*DropMapRate, error) {
+	var rates []*DropMapRate
+	query := `select * from data.drop_map_rates`
+
+	if _, err := db.Select(&rates, query); err != nil {
+		return nil, fmt.Errorf("readDropMapRates: %s", err.Error())
+	}
+
+	m := make(map[int16]*DropMapRate, len(rates))
+	for _, r := range rates {
+		r.excluded, _ = parseIDs(r.Excluded)
+		m[r.MapID] = r
+	}
+	return m, nil
+}
+
+func validateDropMapRates(v interface{}) []error {
+	rates := v.(map[int16]*DropMapRate)
+
+	var errs []error
+	ids := make([]int, 0, len(rates))
+	for id := range rates {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		r := rates[int16(id)]
+		if _, err := parseIDs(r.Excluded); err != nil {
+			errs = append(errs, fmt.Errorf("map %d: excluded items: %s", id, err.Error()))
+		}
+		for _, item := range r.excluded {
+			if !itemExists(item) {
+				errs = append(errs, fmt.Errorf("map %d: unknown item %d", id, item))
+			}
+		}
+	}
+	return errs
+}
+
+// ExcludedDrops returns the items that never drop on the map.
+func ExcludedDrops(mapID int16) []int {
+	if m := FindDropMapRate(mapID); m != nil {
+		return m.excluded
+	}
+	return nil
+}
+
+// validateDropGroups checks that the entries are items or groups, that the
+// weights fit and that no group contains itself.
+func validateDropGroups(v interface{}) []error {
+	groups := v.(map[int]*DropGroup)
+
+	var errs []error
+	for _, id := range sortedIntKeys(groups) {
+		g := groups[id]
+		for _, p := range g.problems {
+			errs = append(errs, fmt.Errorf("drop group %d: %s", id, p))
+		}
+
+		total := 0
+		for _, e := range g.Entries {
+			total += e.Weight
+			switch {
+			case e.Weight < 0:
+				errs = append(errs, fmt.Errorf("drop group %d: negative weight", id))
+			case e.SubGroupID > 0 && groups[e.SubGroupID] == nil:
+				errs = append(errs, fmt.Errorf("drop group %d: unknown group %d", id, e.SubGroupID))
+			case e.SubGroupID == 0 && e.ItemID > 0 && !itemExists(e.ItemID):
+				errs = append(errs, fmt.Errorf("drop group %d: unknown item %d", id, e.ItemID))
+			case e.MaxQuantity < e.MinQuantity:
+				errs = append(errs, fmt.Errorf("drop group %d: quantity %d-%d", id, e.MinQuantity, e.MaxQuantity))
+			}
+		}
+		if !g.Guaranteed && total > DROP_WEIGHT_TOTAL {
+			errs = append(errs, fmt.Errorf("drop group %d: weights add up to %d", id, total))
+		}
+
+		if dropCycle(groups, g, map[int]bool{}) {
+			errs = append(errs, fmt.Errorf("drop group %d: contains itself", id))
+		}
+	}
+	return errs
+}
+
+func dropCycle(groups map[int]*DropGroup, g *DropGroup, path map[int]bool) bool {
+	if path[g.ID] {
+		return true
+	}
+
+	path[g.ID] = true
+	defer delete(path, g.ID)
+
+	for _, e := range g.Entries {
+		if sub := groups[e.SubGroupID]; e.SubGroupID > 0 && sub != nil && dropCycle(groups, sub, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// NPCDropRule returns the drop rules of an npc.
+func NPCDropRule(npc *NPC) NPCDrop {
+	rule := DEFAULT_NPC_DROP
+	if r := FindNPCDrop(npc.ID); r != nil {
+		rule = *r
+	}
+
+	rule.NPCID = npc.ID
+	if rule.GroupID == 0 {
+		rule.GroupID = npc.DropID
+	}
+	return rule
+}
+
+// InLevelGap tells if a character of the level gets drops from the npc.
+func (r NPCDrop) InLevelGap(level int, npcLevel int) bool {
+	return r.MaxLevelGap < 0 || level-npcLevel <= r.MaxLevelGap
+}
+
+// DropRate is the rate of a kill on a map, multiplier is the drop multiplier
+// of the character.
+func (r NPCDrop) DropRate(mapID int16, multiplier float64) float64 {
+	rate := DropRate() * multiplier
+	if m := FindDropMapRate(mapID); m != nil && r.MapRates {
+		rate *= m.Rate
+	}
+	return rate + r.Multiplier
+}
+
+// RollNPC rolls the group of an npc for a kill.
+func (r *DropRoll) RollNPC(rule NPCDrop) []*DroppedItem {
+	var drops []*DroppedItem
+	for attempts, rolls := 0, 0; attempts < DROP_MAX_ATTEMPTS && rolls < rule.MaxRolls; attempts++ {
+		items := r.Roll(rule.GroupID)
+		if len(items) == 0 {
+			if rolls >= rule.MinRolls {
+				break
+			}
+			continue
+		}
+
+		drops = append(drops, items...)
+		rolls++
+	}
+	return drops
+}
+
+// Roll rolls a group once.
+func (r *DropRoll) Roll(groupID int) []*DroppedItem {
+	var drops []*DroppedItem
+	if g := FindDropGroup(groupID); g != nil {
+		r.roll(g, nil, 0, &drops)
+	}
+	return drops
+}
+
+func (r *DropRoll) roll(g *DropGroup, member *DropMember, depth int, drops *[]*DroppedItem) {
+	if depth > DROP_MAX_DEPTH {
+		return
+	}
+
+	if g.PerMember && member == nil {
+		for _, m := range r.Members {
+			r.roll(g, m, depth, drops)
+		}
+		return
+	}
+
+	rolls := g.Rolls
+	if rolls < 1 {
+		rolls = 1
+	}
+
+	for i := 0; i < rolls; i++ {
+		if g.Guaranteed {
+			for _, e := range g.Entries {
+				if r.meets(e, member) {
+					r.drop(e, member, depth, drops)
+				}
+			}
+		} else if e := r.pick(g, member); e != nil {
+			r.drop(e, member, depth, drops)
+		}
+	}
+}
+
+// pick picks an entry of a weighted group. The rate changes the chance of
+// dropping anything, the items keep their share.
+func (r *DropRoll) pick(g *DropGroup, member *DropMember) *DropEntry {
+	var entries []*DropEntry
+	total := 0
+	for _, e := range g.Entries {
+		if r.meets(e, member) {
+			entries = append(entries, e)
+			total += e.Weight
+		}
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	chance := scaledChance(float64(total)/DROP_WEIGHT_TOTAL, r.Rate)
+	for i := 0; i < DROP_REROLLS; i++ {
+		if r.float() >= chance {
+			return nil
+		}
+
+		n := r.intn(total)
+		for _, e := range entries {
+			if n -= e.Weight; n < 0 {
+				// quest items of data.drops never dropped, they are rolled again
+				if g.legacy != nil && isQuestItem(e.ItemID) {
+					break
+				}
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (r *DropRoll) drop(e *DropEntry, member *DropMember, depth int, drops *[]*DroppedItem) {
+	if e.SubGroupID > 0 {
+		if sub := FindDropGroup(e.SubGroupID); sub != nil {
+			r.roll(sub, member, depth+1, drops)
+		}
+		return
+	} else if e.ItemID <= 0 {
+		return
+	}
+
+	quantity := e.MinQuantity
+	if quantity < 1 {
+		quantity = 1
+	}
+	if e.MaxQuantity > quantity {
+		quantity += r.intn(e.MaxQuantity - quantity + 1)
+	}
+	*drops = append(*drops, &DroppedItem{ItemID: e.ItemID, Quantity: quantity, Member: member})
+}
+
+// meets tells if the member, or the claimer outside per member groups, meets
+// the conditions of an entry, and the item is not excluded on the map.
+func (r *DropRoll) meets(e *DropEntry, member *DropMember) bool {
+	if e.ItemID > 0 && e.SubGroupID == 0 && funk.ContainsInt(r.Excluded, e.ItemID) {
+		return false
+	}
+
+	if member == nil {
+		if len(r.Members) == 0 {
+			return e.MinLevel == 0 && e.MaxLevel == 0 && e.QuestID == 0
+		}
+		member = r.Members[0]
+	}
+
+	if e.MinLevel > 0 && member.Level < e.MinLevel {
+		return false
+	} else if e.MaxLevel > 0 && member.Level > e.MaxLevel {
+		return false
+	} else if e.QuestID > 0 && (member.HasQuest == nil || !member.HasQuest(e.QuestID)) {
+		return false
+	}
+	return true
+}
+
+func (r *DropRoll) intn(n int) int {
+	if r.Rand != nil {
+		return r.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+func (r *DropRoll) float() float64 {
+	if r.Rand != nil {
+		return r.Rand.Float64()
+	}
+	return rand.Float64()
+}
+
+// scaledChance is the chance of dropping anything at a rate. Up to 90% the
+// chance grows with the rate, above only the chance of nothing shrinks.
+func scaledChance(chance, rate float64) float64 {
+	if chance*rate < 0.9 {
+		return chance * rate
+	}
+	return 1 - (1-chance)/rate
+}
+
+func isQuestItem(id int) bool {
+	item, ok := GetItemInfo(int64(id))
+	if !ok {
+		return false
+	}
+	t := item.GetType()
+	return t == QUEST_TYPE || t == INGREDIENTS_TYPE
+}
+
+// SimulateDrops kills an npc the given times and counts the drops, the most
+// dropped items first.
+func SimulateDrops(r *DropRoll, rule NPCDrop, kills int) []*DropStat {
+	stats := make(map[int]*DropStat)
+	for i := 0; i < kills; i++ {
+		seen := make(map[int]bool)
+		for _, d := range r.RollNPC(rule) {
+			s := stats[d.ItemID]
+			if s == nil {
+				s = &DropStat{ItemID: d.ItemID}
+				stats[d.ItemID] = s
+			}
+
+			s.Quantity += d.Quantity
+			if !seen[d.ItemID] {
+				s.Kills++
+				seen[d.ItemID] = true
+			}
+		}
+	}
+
+	list := make([]*DropStat, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Quantity != list[j].Quantity {
+			return list[i].Quantity > list[j].Quantity
+		}
+		return list[i].ItemID < list[j].ItemID
+	})
+	return list
+}
+
+// LoadTables reads reloadable tables for the commands that don't start the
+// server, on the connection given to UseConnection.
+func LoadTables(names ...string) error {
+	for _, name := range names {
+		if _, ok := RELOADABLE_TABLES[name]; !ok {
+			return fmt.Errorf("LoadTables: unknown table %s", name)
+		}
+		if err := loadTable(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
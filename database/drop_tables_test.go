@@ -0,0 +1,178 @@
+package database
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func useDropGroups(t *testing.T, groups map[int]*DropGroup) {
+	old, drops := DropGroups, Drops
+	setDropGroups(groups)
+	t.Cleanup(func() { DropGroups, Drops = old, drops })
+}
+
+func TestBuildDropGroups(t *testing.T) {
+	infos := []*DropInfo{
+		{ID: 1, Items: "{100,2}", Probabilities: "{200,700}"},
+		{ID: 2, Items: "{101}", Probabilities: "{1000}"},
+	}
+	groups := []*DropGroup{{ID: 5, Guaranteed: true}}
+	entries := []*DropEntry{{GroupID: 5, ItemID: 300, MinQuantity: 2, MaxQuantity: 2}, {GroupID: 1, ItemID: 999}}
+
+	m := buildDropGroups(infos, groups, entries)
+	want := []*DropEntry{
+		{GroupID: 1, ItemID: 100, Weight: 200, MinQuantity: 1, MaxQuantity: 1},
+		{GroupID: 1, SubGroupID: 2, Weight: 500, MinQuantity: 1, MaxQuantity: 1},
+	}
+	if !reflect.DeepEqual(m[1].Entries, want) {
+		t.Fatalf("legacy group: %+v", m[1].Entries)
+	}
+	if len(m[5].Entries) != 1 || m[5].Entries[0].ItemID != 300 {
+		t.Fatalf("group 5: %+v", m[5].Entries)
+	}
+
+	setDropGroups(m)
+	defer setDropGroups(map[int]*DropGroup{})
+	if len(Drops) != 2 || Drops[1] != infos[0] {
+		t.Fatalf("legacy rows: %+v", Drops)
+	}
+}
+
+func TestRollDropGroups(t *testing.T) {
+	useDropGroups(t, map[int]*DropGroup{
+		1: {ID: 1, Guaranteed: true, Entries: []*DropEntry{
+			{ItemID: 10, MinQuantity: 2, MaxQuantity: 2},
+			{SubGroupID: 2},
+			{ItemID: 11, MinLevel: 50},
+		}},
+		2: {ID: 2, Entries: []*DropEntry{{ItemID: 20, Weight: 250}, {ItemID: 21, Weight: 250}}},
+		3: {ID: 3, Guaranteed: true, PerMember: true, Entries: []*DropEntry{{ItemID: 30, QuestID: 7}}},
+	})
+
+	onQuest := func(id int) bool { return id == 7 }
+	r := &DropRoll{
+		Members: []*DropMember{{Level: 40}, {Level: 60, HasQuest: onQuest}, {Level: 70, HasQuest: onQuest}},
+		Rate:    1,
+		Rand:    rand.New(rand.NewSource(1)),
+	}
+
+	counts := map[int]int{}
+	kills := 20000
+	for i := 0; i < kills; i++ {
+		for _, d := range r.Roll(1) {
+			counts[d.ItemID] += d.Quantity
+		}
+	}
+	if counts[10] != 2*kills || counts[11] != 0 {
+		t.Fatalf("guaranteed entries: %v", counts)
+	}
+	for _, id := range []int{20, 21} {
+		if got := float64(counts[id]) / float64(kills); math.Abs(got-0.25) > 0.02 {
+			t.Errorf("item %d dropped %.3f times per kill, want 0.25", id, got)
+		}
+	}
+
+	drops := r.Roll(3)
+	if len(drops) != 2 || drops[0].Member != r.Members[1] || drops[1].Member != r.Members[2] {
+		t.Fatalf("per member drops: %+v", drops)
+	}
+
+	r.Rate = 2
+	counts = map[int]int{}
+	for i := 0; i < kills; i++ {
+		for _, d := range r.Roll(2) {
+			counts[d.ItemID]++
+		}
+	}
+	if got := float64(counts[20]+counts[21]) / float64(kills); math.Abs(got-0.75) > 0.02 {
+		t.Errorf("double rate dropped %.3f times per kill, want 0.75", got)
+	}
+}
+
+func TestRollExcludedDrops(t *testing.T) {
+	useDropGroups(t, map[int]*DropGroup{
+		1: {ID: 1, Entries: []*DropEntry{{ItemID: 20, Weight: 500}, {ItemID: 21, Weight: 500}}},
+	})
+	rates, mutex := DropMapRates, &dropMapRatesMutex
+	mutex.Lock()
+	DropMapRates = map[int16]*DropMapRate{1: {MapID: 1, Rate: 1, excluded: []int{21}}}
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		DropMapRates = rates
+		mutex.Unlock()
+	})
+
+	r := &DropRoll{Rate: 1, Excluded: ExcludedDrops(1), Rand: rand.New(rand.NewSource(1))}
+	counts := map[int]int{}
+	kills := 20000
+	for i := 0; i < kills; i++ {
+		for _, d := range r.Roll(1) {
+			counts[d.ItemID]++
+		}
+	}
+	if counts[21] != 0 || math.Abs(float64(counts[20])/float64(kills)-0.5) > 0.02 {
+		t.Errorf("drops on a map excluding 21: %v", counts)
+	}
+	if ExcludedDrops(2) != nil {
+		t.Error("excluded drops on a map without a row")
+	}
+}
+
+func TestRollNPC(t *testing.T) {
+	useDropGroups(t, map[int]*DropGroup{
+		1: {ID: 1, Entries: []*DropEntry{{ItemID: 10, Weight: 500}}},
+		2: {ID: 2, Entries: []*DropEntry{{ItemID: 10, Weight: 1000}}},
+	})
+	r := &DropRoll{Rate: 1, Rand: rand.New(rand.NewSource(1))}
+
+	for i := 0; i < 100; i++ {
+		if n := len(r.RollNPC(NPCDrop{GroupID: 1, MinRolls: 3, MaxRolls: 20})); n < 3 || n > 20 {
+			t.Fatalf("%d drops, want 3 to 20", n)
+		}
+	}
+	if n := len(r.RollNPC(NPCDrop{GroupID: 2, MaxRolls: 20})); n != 20 {
+		t.Fatalf("%d drops of a certain group, want 20", n)
+	}
+
+	stats := SimulateDrops(r, NPCDrop{GroupID: 2, MaxRolls: 1}, 50)
+	if len(stats) != 1 || stats[0].Quantity != 50 || stats[0].Kills != 50 {
+		t.Fatalf("stats: %+v", stats[0])
+	}
+
+	rule := NPCDrop{MaxLevelGap: 30}
+	if !rule.InLevelGap(80, 50) || rule.InLevelGap(81, 50) {
+		t.Fatal("level gap")
+	}
+	if rule.MaxLevelGap = -1; !rule.InLevelGap(200, 1) {
+		t.Fatal("no level gap")
+	}
+}
+
+func TestValidateDropGroups(t *testing.T) {
+	items := Items
+	Items = map[int64]*Item{100: {ID: 100}}
+	defer func() { Items = items }()
+
+	groups := buildDropGroups([]*DropInfo{
+		{ID: 1, Items: "{100,2}", Probabilities: "{500,1000}"},
+		{ID: 2, Items: "{100}", Probabilities: "{1000}"},
+		{ID: 3, Items: "{}", Probabilities: "{}"},
+	}, nil, nil)
+	if errs := validateDropGroups(groups); len(errs) != 0 {
+		t.Fatalf("valid groups: %v", errs)
+	}
+
+	groups = buildDropGroups([]*DropInfo{
+		{ID: 1, Items: "{100,999}", Probabilities: "{800,1200}"},
+		{ID: 2, Items: "{10x}", Probabilities: "{1}"},
+		{ID: 3, Items: "{4}", Probabilities: "{100}"},
+		{ID: 4, Items: "{3}", Probabilities: "{100}"},
+	}, nil, nil)
+	// unknown item, weights over 1000, bad items and 3 and 4 containing each other
+	if errs := validateDropGroups(groups); len(errs) != 5 {
+		t.Fatalf("got %d problems, want 5: %v", len(errs), errs)
+	}
+}
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,6 +13,12 @@ var (
 	Drops = make(map[int]*DropInfo)
 )
 
+func FindDrop(id int) *DropInfo {
+	dropsMutex.RLock()
+	defer dropsMutex.RUnlock()
+	return Drops[id]
+}
+
 type DropInfo struct {
 	ID            int    `db:"id"`
 	Items         string `db:"items"`
@@ -75,25 +80,3 @@ func (e *DropInfo) Delete() error {
 	_, err := db.Delete(e)
 	return err
 }
-
-func getAllDrops() error {
-	var drops []*DropInfo
-	query := `select * from data.drops`
-
-	if _, err := db.Select(&drops, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getAllDrops: %s", err.Error())
-	}
-
-	for _, d := range drops {
-		Drops[d.ID] = d
-	}
-
-	return nil
-}
-
-func GetAllDrops() error {
-	return getAllDrops()
-}
@@ -0,0 +1,683 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hero-server/codec"
+	"hero-server/messaging"
+	"hero-server/utils"
+
+	"github.com/thoas/go-funk"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Results of the dungeon runs.
+const (
+	DUNGEON_COMPLETED = "completed"
+	DUNGEON_TIMEOUT   = "timeout"
+	DUNGEON_LEFT      = "left"
+	DUNGEON_CLOSED    = "closed"    // by a gm or when everyone left
+	DUNGEON_CANCELLED = "cancelled" // a member could not enter, the run does not count
+)
+
+var (
+	ErrDungeonsFull   = errors.New("All dungeons are full at this moment, come back later.")
+	ErrDungeonLevel   = errors.New("A member of the party is not of the level of the dungeon.")
+	ErrDungeonTicket  = errors.New("A member of the party has no ticket for the dungeon.")
+	ErrDungeonMembers = errors.New("The party is not of the size of the dungeon.")
+)
+
+// Dungeon is a dungeon of data.dungeons. Every party that enters it gets an
+// instance of its own: the map on one of the servers after the game ones,
+// with a copy of the mobs the first server has on the map, which don't
+// respawn. The objectives are kept as json:
+//
+//	[{"name": "Black Bandits", "npcs": [60001, 60002], "count": 45},
+//	 {"name": "Black Bandit Leader", "npcs": [60003], "count": 1, "after": [0]}]
+//
+// The npcs of an objective can't be hurt before the objectives in after are
+// done, and the dungeon is completed once all of them are. Without
+// objectives it runs until the time is up.
+type Dungeon struct {
+	ID         int     `db:"id" json:"id"`
+	Name       string  `db:"name" json:"name"` // used by the start_dungeon npc actions
+	Title      string  `db:"title" json:"title"`
+	Map        int16   `db:"map_id" json:"map_id"`
+	X          float64 `db:"x" json:"x"` // entrance, the save point of the map when 0
+	Y          float64 `db:"y" json:"y"`
+	ExitMap    int16   `db:"exit_map" json:"exit_map"`
+	ExitX      float64 `db:"exit_x" json:"exit_x"`
+	ExitY      float64 `db:"exit_y" json:"exit_y"`
+	TimeLimit  int     `db:"time_limit" json:"time_limit"` // seconds
+	MinLevel   int     `db:"min_level" json:"min_level"`
+	MaxLevel   int     `db:"max_level" json:"max_level"`
+	MinMembers int     `db:"min_members" json:"min_members"`
+	MaxMembers int     `db:"max_members" json:"max_members"`
+	TicketID   int64   `db:"ticket_id" json:"ticket_id"`
+	Tickets    uint    `db:"tickets" json:"tickets"`         // of ticket_id every member gives to enter
+	DailyLimit int     `db:"daily_limit" json:"daily_limit"` // runs a day of every member, 0 for no limit
+	Instances  int     `db:"instances" json:"instances"`     // open at a time, 0 up to every free instance server
+	Script     []byte  `db:"objectives" json:"-"`
+
+	Objectives []*DungeonObjective `db:"-" json:"objectives"`
+	problem    error
+}
+
+// DungeonObjective is a number of kills of any of the npcs.
+type DungeonObjective struct {
+	Name  string `json:"name"`
+	NPCs  []int  `json:"npcs"`
+	Count int    `json:"count"`
+	After []int  `json:"after,omitempty"`
+}
+
+// DungeonRun is a run of a character in hops.dungeon_runs, the daily limits
+// count them.
+type DungeonRun struct {
+	ID          int       `db:"id" json:"id"`
+	DungeonID   int       `db:"dungeon_id" json:"dungeon_id"`
+	CharacterID int       `db:"character_id" json:"character_id"`
+	Instance    int       `db:"instance" json:"instance"`
+	StartedAt   time.Time `db:"started_at" json:"started_at"`
+	EndedAt     null.Time `db:"ended_at" json:"ended_at"`
+	Result      string    `db:"result" json:"result"`
+}
+
+// DungeonInstance is the instance of a dungeon a party runs. Its id is the
+// server it runs on.
+type DungeonInstance struct {
+	ID      int
+	Dungeon *Dungeon
+	Started time.Time
+	Ends    time.Time
+
+	kills   []int // by objective
+	members map[int]*dungeonMember
+	ais     []*AI
+	closed  bool
+	mutex   sync.Mutex
+}
+
+type dungeonMember struct {
+	character *Character
+	server    int // to go back to
+	run       *DungeonRun
+}
+
+var (
+	Dungeons           = make(map[int]*Dungeon)
+	dungeonsTableMutex sync.RWMutex
+
+	dungeonInstances = make(map[int]*DungeonInstance)
+	dungeonsMutex    sync.Mutex
+	dungeonAIID      = 1 << 30 // ids of the copied mobs, above the ones of hops.ai
+)
+
+func (r *DungeonRun) Create() error {
+	return db.Insert(r)
+}
+
+func (r *DungeonRun) Update() error {
+	_, err := db.Update(r)
+	return err
+}
+
+func readDungeons() (map[int]*Dungeon, error) {
+	var dungeons []*Dungeon
+	query := `select * from data.dungeons`
+
+	if _, err := db.Select(&dungeons, query); err != nil {
+		return nil, fmt.Errorf("readDungeons: %s", err.Error())
+	}
+
+	m := make(map[int]*Dungeon, len(dungeons))
+	for _, d := range dungeons {
+		d.parse()
+		m[d.ID] = d
+	}
+	return m, nil
+}
+
+// parse reads the objectives, objectives that can't be read are a problem
+// of the table.
+func (d *Dungeon) parse() {
+	d.Objectives, d.problem = nil, nil
+	if len(d.Script) == 0 {
+		return
+	}
+	if err := json.Unmarshal(d.Script, &d.Objectives); err != nil {
+		d.problem = err
+	}
+}
+
+func validateDungeons(v interface{}) []error {
+	dungeons := v.(map[int]*Dungeon)
+
+	var errs []error
+	names := make(map[string]int)
+	for _, id := range sortedIntKeys(dungeons) {
+		d := dungeons[id]
+		if err := d.check(); err != nil {
+			errs = append(errs, fmt.Errorf("dungeon %d: %s", id, err.Error()))
+		}
+		if other, ok := names[d.Name]; ok {
+			errs = append(errs, fmt.Errorf("dungeon %d: name %q of dungeon %d", id, d.Name, other))
+		}
+		names[d.Name] = id
+	}
+	return errs
+}
+
+func (d *Dungeon) check() error {
+	switch {
+	case d.problem != nil:
+		return d.problem
+	case d.Name == "":
+		return fmt.Errorf("no name")
+	case d.Map <= 0 || d.ExitMap <= 0:
+		return fmt.Errorf("no map or exit map")
+	case funk.Contains(sharedMaps, d.Map):
+		return fmt.Errorf("map %d is shared by the servers", d.Map)
+	case d.TimeLimit <= 0:
+		return fmt.Errorf("no time limit")
+	case d.Instances < 0 || d.Instances > DUNGEON_INSTANCES:
+		return fmt.Errorf("instances %d not in 0-%d", d.Instances, DUNGEON_INSTANCES)
+	case d.MaxMembers > 0 && d.MaxMembers < d.MinMembers:
+		return fmt.Errorf("invalid party size %d-%d", d.MinMembers, d.MaxMembers)
+	case d.TicketID > 0 && (!itemExists(int(d.TicketID)) || d.Tickets == 0):
+		return fmt.Errorf("unknown ticket %d or no tickets", d.TicketID)
+	}
+
+	for i, o := range d.Objectives {
+		if len(o.NPCs) == 0 || o.Count <= 0 {
+			return fmt.Errorf("objective %d without npcs or count", i)
+		}
+		for _, after := range o.After {
+			if after < 0 || after >= i {
+				return fmt.Errorf("objective %d after %d, only the ones before it can be", i, after)
+			}
+		}
+	}
+	return nil
+}
+
+// FindDungeon returns the dungeon with the name.
+func FindDungeon(name string) *Dungeon {
+	dungeonsTableMutex.RLock()
+	defer dungeonsTableMutex.RUnlock()
+
+	for _, d := range Dungeons {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// runsToday returns the runs of the character in the dungeon since
+// midnight, cancelled ones aside.
+func (d *Dungeon) runsToday(c *Character) (int64, error) {
+	y, m, day := time.Now().Date()
+	query := `select count(*) from hops.dungeon_runs where dungeon_id = $1 and character_id = $2 and started_at >= $3 and result <> $4`
+	return db.SelectInt(query, d.ID, c.ID, time.Date(y, m, day, 0, 0, 0, 0, time.Local), DUNGEON_CANCELLED)
+}
+
+func (d *Dungeon) findTicket(c *Character) (int16, error) {
+	slot, _, err := c.FindItemInInventory(func(slot *InventorySlot) bool {
+		return slot.Quantity >= d.Tickets
+	}, d.TicketID)
+	return slot, err
+}
+
+// Check tells if the characters can enter the dungeon together.
+func (d *Dungeon) Check(members []*Character) error {
+	if len(members) < d.MinMembers || (d.MaxMembers > 0 && len(members) > d.MaxMembers) {
+		return ErrDungeonMembers
+	}
+
+	for _, c := range members {
+		if c.Level < d.MinLevel || (d.MaxLevel > 0 && c.Level > d.MaxLevel) {
+			return ErrDungeonLevel
+		} else if c.Dungeon() != nil || c.Battleground() != nil {
+			return fmt.Errorf("%s is busy at the moment.", c.Name)
+		}
+
+		if d.TicketID > 0 {
+			if slot, err := d.findTicket(c); err != nil {
+				return err
+			} else if slot < 0 {
+				return ErrDungeonTicket
+			}
+		}
+
+		if d.DailyLimit > 0 {
+			runs, err := d.runsToday(c)
+			if err != nil {
+				return fmt.Errorf("Check: %s", err.Error())
+			} else if runs >= int64(d.DailyLimit) {
+				return fmt.Errorf("%s has run %s %d times today.", c.Name, d.Title, runs)
+			}
+		}
+	}
+	return nil
+}
+
+// OpenDungeonInstance opens an instance of the dungeon on a free server
+// and copies the mobs of the map to it. Every instance takes a server of its
+// own, so all the dungeons share the DUNGEON_INSTANCES servers, and a
+// dungeon with instances set opens no more than those at a time.
+func OpenDungeonInstance(d *Dungeon) (*DungeonInstance, error) {
+	dungeonsMutex.Lock()
+	i := &DungeonInstance{Dungeon: d, Started: time.Now(), kills: make([]int, len(d.Objectives)),
+		members: make(map[int]*dungeonMember)}
+	i.Ends = i.Started.Add(time.Duration(d.TimeLimit) * time.Second)
+	open := 0
+	for _, other := range dungeonInstances {
+		if other.Dungeon.ID == d.ID {
+			open++
+		}
+	}
+	for server := SERVER_COUNT + 1; server <= MAX_SERVER && (d.Instances == 0 || open < d.Instances); server++ {
+		if dungeonInstances[server] == nil {
+			i.ID = server
+			dungeonInstances[server] = i
+			break
+		}
+	}
+	dungeonsMutex.Unlock()
+
+	if i.ID == 0 {
+		return nil, ErrDungeonsFull
+	}
+	i.spawn()
+	return i, nil
+}
+
+// DungeonInstances returns the open instances by id.
+func DungeonInstances() []*DungeonInstance {
+	dungeonsMutex.Lock()
+	defer dungeonsMutex.Unlock()
+
+	list := make([]*DungeonInstance, 0, len(dungeonInstances))
+	for _, i := range dungeonInstances {
+		list = append(list, i)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].ID < list[b].ID
+	})
+	return list
+}
+
+func FindDungeonInstance(id int) *DungeonInstance {
+	dungeonsMutex.Lock()
+	defer dungeonsMutex.Unlock()
+	return dungeonInstances[id]
+}
+
+// spawn copies the mobs of the map on the first server to the instance.
+func (i *DungeonInstance) spawn() {
+	mapID := i.Dungeon.Map
+	if len(AIsByMap) <= i.ID {
+		return
+	}
+
+	var ais []*AI
+	AIMutex.Lock()
+	for _, template := range AIsByMap[1][mapID] {
+		pos := NPCPos[template.PosID]
+		if pos == nil || NPCs[pos.NPCID] == nil {
+			continue
+		}
+
+		dungeonAIID++
+		ai := &AI{ID: dungeonAIID, PosID: template.PosID, Server: i.ID, Faction: template.Faction, Map: mapID,
+			WalkingSpeed: template.WalkingSpeed, RunningSpeed: template.RunningSpeed, CanAttack: template.CanAttack,
+			HP: NPCs[pos.NPCID].MaxHp, Once: true}
+		ai.OnSightPlayers = make(map[int]interface{})
+		ai.SetCoordinate(ConvertPointToLocation(template.Coordinate))
+		ai.TargetLocation = *ConvertPointToLocation(ai.Coordinate)
+		ai.Handler = ai.AIHandler
+
+		AIs[ai.ID] = ai
+		ais = append(ais, ai)
+	}
+	AIMutex.Unlock()
+
+	AIsByMap[i.ID][mapID] = ais
+	for _, ai := range ais {
+		if GenerateAIID != nil {
+			GenerateAIID(ai)
+		}
+		if ai.WalkingSpeed > 0 {
+			go ai.Handler()
+		}
+	}
+
+	i.mutex.Lock()
+	i.ais = ais
+	i.mutex.Unlock()
+}
+
+// Members returns the characters in the instance.
+func (i *DungeonInstance) Members() []*Character {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	members := make([]*Character, 0, len(i.members))
+	for _, m := range i.members {
+		members = append(members, m.character)
+	}
+	sort.Slice(members, func(a, b int) bool {
+		return members[a].ID < members[b].ID
+	})
+	return members
+}
+
+// Left returns the seconds left to complete the dungeon.
+func (i *DungeonInstance) Left() int {
+	if left := int(time.Until(i.Ends).Seconds()); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Enter sends the character into the instance, taking its tickets once it
+// is a member. The tickets are given back when it can't be sent there.
+func (i *DungeonInstance) Enter(c *Character) ([]byte, error) {
+	d := i.Dungeon
+	run := &DungeonRun{DungeonID: d.ID, CharacterID: c.ID, Instance: i.ID, StartedAt: time.Now()}
+	i.mutex.Lock()
+	if i.closed {
+		i.mutex.Unlock()
+		return nil, ErrDungeonsFull
+	}
+	i.members[c.ID] = &dungeonMember{character: c, server: c.Socket.User.ConnectedServer, run: run}
+	i.mutex.Unlock()
+
+	c.setDungeon(i)
+	c.IsDungeon = true
+	c.Socket.User.ConnectedServer = i.ID
+
+	resp := utils.Packet{}
+	if d.TicketID > 0 {
+		slot, err := d.findTicket(c)
+		if err == nil && slot < 0 {
+			err = ErrDungeonTicket
+		}
+		var data *utils.Packet
+		if err == nil {
+			if data = c.consumeItem(slot, d.Tickets, fmt.Sprintf("dungeon %s", d.Name)); data == nil {
+				err = ErrDungeonTicket
+			}
+		}
+		if err != nil {
+			i.Leave(c)
+			return nil, err
+		}
+		resp.Concat(*data)
+	}
+
+	var at *utils.Location
+	if d.X != 0 || d.Y != 0 {
+		at = &utils.Location{X: d.X, Y: d.Y}
+	}
+	data, err := c.ChangeMap(d.Map, at)
+	if err != nil {
+		i.Leave(c)
+		if d.TicketID > 0 {
+			if refund, _, _ := c.AddItem(NewItemSlot(d.TicketID, d.Tickets), -1, false); refund != nil {
+				resp.Concat(*refund)
+			}
+		}
+		return resp, err
+	}
+
+	if err := run.Create(); err != nil {
+		log.Printf("Enter: %s", err.Error())
+	}
+	resp.Concat(data)
+	resp.Concat(codec.Encode(&codec.DungeonTimer{Seconds: uint32(i.Left())}))
+	return resp, nil
+}
+
+// Leave takes the character out of the instance, back to its server.
+func (i *DungeonInstance) Leave(c *Character) {
+	i.leave(c, DUNGEON_LEFT)
+}
+
+func (i *DungeonInstance) leave(c *Character, result string) {
+	i.mutex.Lock()
+	m := i.members[c.ID]
+	delete(i.members, c.ID)
+	i.mutex.Unlock()
+
+	if m == nil {
+		return
+	}
+	if c.clearDungeon(i) {
+		c.IsDungeon = false
+	}
+	if c.Socket != nil && c.Socket.User != nil && c.Socket.User.ConnectedServer == i.ID {
+		c.Socket.User.ConnectedServer = m.server
+	}
+
+	m.run.EndedAt = null.TimeFrom(time.Now())
+	m.run.Result = result
+	if m.run.ID > 0 {
+		if err := m.run.Update(); err != nil {
+			log.Printf("leave: %s", err.Error())
+		}
+	}
+}
+
+// Exit returns the map and coordinate the members leave to.
+func (d *Dungeon) Exit() (int16, *utils.Location) {
+	if d.ExitX == 0 && d.ExitY == 0 {
+		return d.ExitMap, nil
+	}
+	return d.ExitMap, &utils.Location{X: d.ExitX, Y: d.ExitY}
+}
+
+// Close sends the members out with the result and removes the mobs of the
+// instance. It returns false when it was closed already.
+func (i *DungeonInstance) Close(result string, msg string) bool {
+	i.mutex.Lock()
+	if i.closed {
+		i.mutex.Unlock()
+		return false
+	}
+	i.closed = true
+	ais := i.ais
+	i.mutex.Unlock()
+
+	exit, at := i.Dungeon.Exit()
+	for _, c := range i.Members() {
+		i.leave(c, result)
+		if !c.IsOnline || c.Socket == nil {
+			continue
+		}
+
+		resp := utils.Packet{}
+		if msg != "" {
+			resp.Concat(messaging.InfoMessage(msg))
+		}
+		if data, err := c.ChangeMap(exit, at); err == nil {
+			resp.Concat(data)
+		}
+		c.Socket.Write(resp)
+	}
+
+	AIMutex.Lock()
+	for _, ai := range ais {
+		ai.Handler = nil
+		delete(AIs, ai.ID)
+		AIGrid.Remove(ai.ID)
+	}
+	AIMutex.Unlock()
+
+	mapID := i.Dungeon.Map
+	if len(AIsByMap) > i.ID {
+		AIsByMap[i.ID][mapID] = nil
+	}
+	if ClearMapRegister != nil {
+		ClearMapRegister(i.ID, mapID)
+	}
+	drMutex.Lock()
+	DropRegister[i.ID][mapID] = make(map[uint16]*Drop)
+	drMutex.Unlock()
+
+	dungeonsMutex.Lock()
+	if dungeonInstances[i.ID] == i {
+		delete(dungeonInstances, i.ID)
+	}
+	dungeonsMutex.Unlock()
+	return true
+}
+
+// Cancel closes the instance when a member of the party could not enter.
+// The members in it get their tickets back and their runs don't count for
+// the daily limit.
+func (i *DungeonInstance) Cancel(msg string) bool {
+	members := i.Members()
+	if !i.Close(DUNGEON_CANCELLED, msg) {
+		return false
+	}
+
+	d := i.Dungeon
+	if d.TicketID == 0 {
+		return true
+	}
+	for _, c := range members {
+		data, _, err := c.AddItem(NewItemSlot(d.TicketID, d.Tickets), -1, false)
+		if err != nil {
+			log.Printf("Cancel: %s", err.Error())
+		} else if data != nil && c.IsOnline && c.Socket != nil {
+			c.Socket.Write(*data)
+		}
+	}
+	return true
+}
+
+// locked tells if the npc belongs to an objective that can't be done yet.
+func (i *DungeonInstance) locked(npcID int) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, o := range i.Dungeon.Objectives {
+		if !funk.ContainsInt(o.NPCs, npcID) {
+			continue
+		}
+		for _, after := range o.After {
+			if i.kills[after] < i.Dungeon.Objectives[after].Count {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kill counts the kill of an npc for the objectives it belongs to, and
+// returns the kills left of each of them by objective.
+func (i *DungeonInstance) kill(npcID int) map[*DungeonObjective]int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	left := make(map[*DungeonObjective]int)
+	for n, o := range i.Dungeon.Objectives {
+		if funk.ContainsInt(o.NPCs, npcID) && i.kills[n] < o.Count {
+			i.kills[n]++
+			left[o] = o.Count - i.kills[n]
+		}
+	}
+	return left
+}
+
+// Completed tells if every objective is done, never for a dungeon without
+// objectives.
+func (i *DungeonInstance) Completed() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if len(i.Dungeon.Objectives) == 0 {
+		return false
+	}
+	for n, o := range i.Dungeon.Objectives {
+		if i.kills[n] < o.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// Dungeon returns the dungeon instance the character is in.
+func (c *Character) Dungeon() *DungeonInstance {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+	return c.dungeon
+}
+
+func (c *Character) setDungeon(i *DungeonInstance) {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+	c.dungeon = i
+}
+
+// clearDungeon takes the character out of i, false when it is in another
+// instance by now.
+func (c *Character) clearDungeon(i *DungeonInstance) bool {
+	c.instanceMutex.Lock()
+	defer c.instanceMutex.Unlock()
+
+	if c.dungeon != i {
+		return false
+	}
+	c.dungeon = nil
+	return true
+}
+
+// DungeonLocked tells if the npc can't be hurt yet in the dungeon of the
+// character.
+func (c *Character) DungeonLocked(npcID int) bool {
+	i := c.Dungeon()
+	return i != nil && c.Map == i.Dungeon.Map && i.locked(npcID)
+}
+
+// DungeonKill counts the kill of an npc in the dungeon of the character and
+// returns the progress to show.
+func (c *Character) DungeonKill(npcID int) []byte {
+	i := c.Dungeon()
+	if i == nil || c.Map != i.Dungeon.Map {
+		return nil
+	}
+
+	kills := i.kill(npcID)
+	resp := utils.Packet{}
+	for _, o := range i.Dungeon.Objectives {
+		left, ok := kills[o]
+		if !ok {
+			continue
+		} else if left > 0 {
+			resp.Concat(messaging.InfoMessage(fmt.Sprintf("You have %d %s left to kill", left, o.Name)))
+		} else {
+			resp.Concat(messaging.InfoMessage(fmt.Sprintf("%s done.", o.Name)))
+		}
+	}
+	return resp
+}
+
+// LeaveDungeon takes the character out of its dungeon and returns the map
+// and coordinate it is sent to, 0 when it stays.
+func (c *Character) LeaveDungeon() (int16, *utils.Location) {
+	i := c.Dungeon()
+	if i == nil {
+		return 0, nil
+	}
+	i.Leave(c)
+	return i.Dungeon.Exit()
+}
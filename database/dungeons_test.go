@@ -0,0 +1,152 @@
+package database
+
+import (
+	"testing"
+)
+
+func testDungeon() *Dungeon {
+	d := &Dungeon{ID: 1, Name: "test", Title: "Test dungeon", Map: 243, ExitMap: 17, TimeLimit: 60, MinLevel: 70, MaxMembers: 2,
+		Script: []byte(`[{"name": "Bandits", "npcs": [1, 2], "count": 2}, {"name": "Leader", "npcs": [3], "count": 1, "after": [0]}]`)}
+	d.parse()
+	return d
+}
+
+func TestDungeonObjectives(t *testing.T) {
+	d := testDungeon()
+	if err := d.check(); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &DungeonInstance{Dungeon: d, kills: make([]int, len(d.Objectives)), members: make(map[int]*dungeonMember)}
+	c := &Character{ID: 1, Map: 243, dungeon: i}
+	if !c.DungeonLocked(3) || c.DungeonLocked(1) {
+		t.Error("the leader is not locked before the bandits")
+	}
+
+	c.DungeonKill(1)
+	c.DungeonKill(4)
+	if i.Completed() || !c.DungeonLocked(3) {
+		t.Fatalf("kills %v after one bandit", i.kills)
+	}
+
+	c.DungeonKill(2)
+	c.DungeonKill(2)
+	if c.DungeonLocked(3) || i.kills[0] != 2 {
+		t.Fatalf("kills %v after the bandits", i.kills)
+	}
+	if data := c.DungeonKill(3); len(data) == 0 || !i.Completed() {
+		t.Errorf("kills %v after the leader", i.kills)
+	}
+
+	c.Map = 17
+	if c.DungeonLocked(3) || c.DungeonKill(3) != nil {
+		t.Error("kills counted out of the dungeon map")
+	}
+}
+
+func TestDungeonInstances(t *testing.T) {
+	d := testDungeon()
+	d.Objectives = nil
+
+	var instances []*DungeonInstance
+	for n := 0; n < DUNGEON_INSTANCES; n++ {
+		i, err := OpenDungeonInstance(d)
+		if err != nil {
+			t.Fatal(err)
+		} else if i.ID <= SERVER_COUNT || i.ID > MAX_SERVER {
+			t.Fatalf("instance on server %d", i.ID)
+		}
+		instances = append(instances, i)
+	}
+	if _, err := OpenDungeonInstance(d); err != ErrDungeonsFull {
+		t.Errorf("got %v with every instance open", err)
+	}
+
+	first := instances[0]
+	if !first.Close(DUNGEON_CLOSED, "") || first.Close(DUNGEON_CLOSED, "") || first.Completed() {
+		t.Error("closing twice")
+	}
+	if i, err := OpenDungeonInstance(d); err != nil || i.ID != first.ID {
+		t.Errorf("got %v, %v instead of the closed server", i, err)
+	}
+
+	for _, i := range DungeonInstances() {
+		i.Close(DUNGEON_CLOSED, "")
+	}
+	if len(DungeonInstances()) != 0 {
+		t.Error("instances left open")
+	}
+}
+
+func TestDungeonInstancesOfDungeon(t *testing.T) {
+	d, other := testDungeon(), testDungeon()
+	other.ID = 2
+	d.Instances = 1
+	t.Cleanup(func() {
+		for _, i := range DungeonInstances() {
+			i.Close(DUNGEON_CLOSED, "")
+		}
+	})
+
+	i, err := OpenDungeonInstance(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDungeonInstance(d); err != ErrDungeonsFull {
+		t.Errorf("got %v past the instances of the dungeon", err)
+	}
+	if _, err := OpenDungeonInstance(other); err != nil {
+		t.Errorf("got %v for another dungeon", err)
+	}
+
+	// a member could not enter, the one that did is out and its run is cancelled
+	c := &Character{ID: 1, Socket: &Socket{User: &User{ConnectedServer: 1}}}
+	run := &DungeonRun{}
+	i.members[c.ID] = &dungeonMember{character: c, server: 1, run: run}
+	c.setDungeon(i)
+	if !i.Cancel("") || i.Cancel("") {
+		t.Fatal("cancelling twice")
+	}
+	if c.Dungeon() != nil || run.Result != DUNGEON_CANCELLED {
+		t.Errorf("run %q after the cancel", run.Result)
+	}
+	if _, err := OpenDungeonInstance(d); err != nil {
+		t.Errorf("got %v once the instance was cancelled", err)
+	}
+}
+
+func TestDungeonCheck(t *testing.T) {
+	d := testDungeon()
+	a, b := &Character{ID: 1, Level: 80}, &Character{ID: 2, Level: 60}
+
+	if err := d.Check([]*Character{a, b}); err != ErrDungeonLevel {
+		t.Errorf("got %v for a member below the level", err)
+	}
+	b.Level = 70
+	if err := d.Check([]*Character{a, b, {ID: 3, Level: 70}}); err != ErrDungeonMembers {
+		t.Errorf("got %v for a party too big", err)
+	}
+	if err := d.Check([]*Character{a, b}); err != nil {
+		t.Error(err)
+	}
+
+	d.Objectives[1].After = []int{1}
+	if errs := validateDungeons(map[int]*Dungeon{1: d, 2: testDungeon()}); len(errs) != 2 {
+		t.Errorf("got %d problems, want 2: %v", len(errs), errs)
+	}
+}
+
+func TestDungeonEnterClosed(t *testing.T) {
+	d := testDungeon()
+	d.TicketID, d.Tickets = 5, 1
+	i := &DungeonInstance{ID: MAX_SERVER, Dungeon: d, members: make(map[int]*dungeonMember), closed: true}
+	c := &Character{ID: 1, Level: 70, Socket: &Socket{User: &User{ConnectedServer: 1}}}
+
+	// the ticket is not looked at while the instance is closed
+	if _, err := i.Enter(c); err != ErrDungeonsFull {
+		t.Fatalf("got %v entering a closed instance", err)
+	}
+	if c.Dungeon() != nil || c.Socket.User.ConnectedServer != 1 || len(i.Members()) != 0 {
+		t.Error("entered a closed instance")
+	}
+}
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 )
 
 type Emotion struct {
@@ -13,9 +13,16 @@ type Emotion struct {
 }
 
 var (
-	Emotions = make(map[int]*Emotion)
+	Emotions      = make(map[int]*Emotion)
+	emotionsMutex sync.RWMutex
 )
 
+func FindEmotion(id int) *Emotion {
+	emotionsMutex.RLock()
+	defer emotionsMutex.RUnlock()
+	return Emotions[id]
+}
+
 /*
 
 func GetEmotions() error {
@@ -46,24 +53,17 @@ func GetEmotions() error {
 }
 */
 
-func getAllEmotions() error {
+func readEmotions() (map[int]*Emotion, error) {
 	var emotions []*Emotion
 	query := `select * from data.emotions`
 
 	if _, err := db.Select(&emotions, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getAllEmotions: %s", err.Error())
+		return nil, fmt.Errorf("readEmotions: %s", err.Error())
 	}
 
+	m := make(map[int]*Emotion, len(emotions))
 	for _, d := range emotions {
-		Emotions[d.ID] = d
+		m[d.ID] = d
 	}
-
-	return nil
-}
-
-func GetAllEmotions() error {
-	return getAllEmotions()
+	return m, nil
 }
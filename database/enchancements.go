@@ -1,14 +1,21 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 )
 
 var (
-	Enhancements = make(map[int]*Enhancement)
+	Enhancements      = make(map[int]*Enhancement)
+	enhancementsMutex sync.RWMutex
 )
 
+func FindEnhancement(id int) *Enhancement {
+	enhancementsMutex.RLock()
+	defer enhancementsMutex.RUnlock()
+	return Enhancements[id]
+}
+
 type Enhancement struct {
 	ID        int   `db:"id"`
 	BookID    int   `db:"bookid"`
@@ -22,20 +29,17 @@ type Enhancement struct {
 	Result    int   `db:"result"`
 }
 
-func getEnhancements() error {
+func readEnhancements() (map[int]*Enhancement, error) {
 	var enchant []*Enhancement
 	query := `select * from data.enchant`
 
 	if _, err := db.Select(&enchant, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getEnhancements: %s", err.Error())
+		return nil, fmt.Errorf("readEnhancements: %s", err.Error())
 	}
 
+	m := make(map[int]*Enhancement, len(enchant))
 	for _, e := range enchant {
-		Enhancements[e.BookID] = e
+		m[e.BookID] = e
 	}
-
-	return nil
+	return m, nil
 }
@@ -1,7 +1,7 @@
 package database
 
 import (
-	"database/sql"
+	"fmt"
 	"sync"
 
 	gorp "gopkg.in/gorp.v1"
@@ -14,10 +14,29 @@ type ExpInfo struct {
 }
 
 var (
-	EXPs     = make(map[int16]*ExpInfo)
-	expMutex sync.Mutex
+	EXPs      = make(map[int16]*ExpInfo)
+	expsMutex sync.RWMutex
+	expMutex  sync.Mutex
 )
 
+// AllExps returns the rows of the exp table in no order.
+func AllExps() []*ExpInfo {
+	expsMutex.RLock()
+	defer expsMutex.RUnlock()
+
+	exps := make([]*ExpInfo, 0, len(EXPs))
+	for _, e := range EXPs {
+		exps = append(exps, e)
+	}
+	return exps
+}
+
+func FindExp(id int16) *ExpInfo {
+	expsMutex.RLock()
+	defer expsMutex.RUnlock()
+	return EXPs[id]
+}
+
 func (e *ExpInfo) Create() error {
 	return db.Insert(e)
 }
@@ -36,20 +55,17 @@ func (e *ExpInfo) Delete() error {
 	return err
 }
 
-func getExps() error {
-
+func readExps() (map[int16]*ExpInfo, error) {
 	var arr []*ExpInfo
 	query := `select * from data.exp_table`
 
 	if _, err := db.Select(&arr, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return nil
+		return nil, fmt.Errorf("readExps: %s", err.Error())
 	}
 
+	m := make(map[int16]*ExpInfo, len(arr))
 	for _, e := range arr {
-		EXPs[e.Level] = e
+		m[e.Level] = e
 	}
-	return nil
+	return m, nil
 }
@@ -1,51 +1,12 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
-
-	null "gopkg.in/guregu/null.v3"
-)
-
-var (
-	FiveClans     = make(map[int]*FiveClan)
-	FiveclanMobs  = []int{423308, 423310, 423312, 423314, 423316}
-	FiveclanBuffs = []int{70001, 70002, 70003, 70004, 70005}
 )
 
-type FiveClan struct {
-	AreaID     int       `db:"id"`
-	ClanID     int       `db:"clanid"`
-	ExpiresAt  null.Time `db:"expires_at" json:"expires_at"`
-	TempleName string    `db:"name" json:"name"`
-}
-
-func (b *FiveClan) Update() error {
-	_, err := db.Update(b)
-	return err
-}
-
-func getFiveAreas() error {
-	var areas []*FiveClan
-	query := `select * from data.fiveclan_war`
-
-	if _, err := db.Select(&areas, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getFiveAreas: %s", err.Error())
-	}
-
-	for _, cr := range areas {
-		FiveClans[cr.AreaID] = cr
-	}
-
-	return nil
-}
-
 func LogoutFiveBuffDelete(char *Character) {
-	for _, fivebuff := range FiveclanBuffs {
+	for _, fivebuff := range FindTerritory(TERRITORY_FIVE_CLANS).Buffs {
 		buff, err := FindBuffByID(fivebuff, char.ID)
 		if err != nil {
 			continue
@@ -90,21 +51,21 @@ func AddFiveBuffWhenLogin(char *Character) error {
 		if err != nil {
 			return err
 		}
-		for _, clans := range FiveClans {
-			if clans.ClanID == guild.ID {
-				buffID := FiveclanBuffs[clans.AreaID-1]
+		territory := FindTerritory(TERRITORY_FIVE_CLANS)
+		for _, clans := range territory.Areas() {
+			if clans.Holder == guild.ID {
+				buffID := territory.Buffs[clans.ID-1]
 				currentTime := time.Now()
 				diff := clans.ExpiresAt.Time.Sub(currentTime)
 				if diff < 0 {
-					clans.ClanID = 0
-					clans.Update()
+					territory.Release(clans.ID)
 					continue
 				}
 
 				if buffID == 70001 {
 					haveBuff, _ := FindBuffByID(70001, char.ID)
 					if haveBuff == nil {
-						infection := BuffInfections[70001]
+						infection := FindBuffInfection(70001)
 						buff := &Buff{ID: int(70001), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -122,7 +83,7 @@ func AddFiveBuffWhenLogin(char *Character) error {
 				if buffID == 70002 {
 					haveBuff, _ := FindBuffByID(70002, char.ID)
 					if haveBuff == nil {
-						infection := BuffInfections[70002]
+						infection := FindBuffInfection(70002)
 						buff := &Buff{ID: int(70002), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -140,7 +101,7 @@ func AddFiveBuffWhenLogin(char *Character) error {
 				if buffID == 70003 {
 					haveBuff, _ := FindBuffByID(70003, char.ID)
 					if haveBuff == nil {
-						infection := BuffInfections[70003]
+						infection := FindBuffInfection(70003)
 						buff := &Buff{ID: int(70003), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -159,7 +120,7 @@ func AddFiveBuffWhenLogin(char *Character) error {
 				if buffID == 70004 {
 					haveBuff, _ := FindBuffByID(70004, char.ID)
 					if haveBuff == nil {
-						infection := BuffInfections[70004]
+						infection := FindBuffInfection(70004)
 						buff := &Buff{ID: int(70004), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -177,7 +138,7 @@ func AddFiveBuffWhenLogin(char *Character) error {
 				if buffID == 70005 {
 					haveBuff, _ := FindBuffByID(70005, char.ID)
 					if haveBuff == nil {
-						infection := BuffInfections[70005]
+						infection := FindBuffInfection(70005)
 						buff := &Buff{ID: int(70005), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 						err = buff.Create()
 						if err != nil {
@@ -1,14 +1,15 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
 	GamblingItems = make(map[int]*Gambling)
+	gamblingMutex sync.RWMutex
 	rewardCounts  = map[int64]uint{17502658: 30, 17502527: 50, 17502659: 60, 17502528: 100, 17502529: 150, 17502530: 200, 17200188: 10, 17200189: 30,
 		17501007: 10, 17502516: 50, 17502517: 75, 17502518: 100, 17501008: 10, 17502513: 50, 17502514: 75, 17502515: 100, 17502555: 600, 17502557: 600,
 		13370142: 100, 13370143: 100, 13370144: 100, 13370145: 100}
@@ -43,6 +44,12 @@ var (
 	}
 )
 
+func FindGambling(id int) *Gambling {
+	gamblingMutex.RLock()
+	defer gamblingMutex.RUnlock()
+	return GamblingItems[id]
+}
+
 type Gambling struct {
 	ID     int    `db:"id"`
 	Cost   uint64 `db:"cost"`
@@ -62,20 +69,17 @@ func (e *Gambling) Delete() error {
 	return err
 }
 
-func getGamblingItems() error {
+func readGamblingItems() (map[int]*Gambling, error) {
 	var gamblings []*Gambling
 	query := `select * from data.gambling`
 
 	if _, err := db.Select(&gamblings, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getGamblingItems: %s", err.Error())
+		return nil, fmt.Errorf("readGamblingItems: %s", err.Error())
 	}
 
+	m := make(map[int]*Gambling, len(gamblings))
 	for _, g := range gamblings {
-		GamblingItems[g.ID] = g
+		m[g.ID] = g
 	}
-
-	return nil
+	return m, nil
 }
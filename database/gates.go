@@ -1,7 +1,6 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"sync"
 
@@ -21,6 +20,12 @@ var (
 	GatesMutex sync.RWMutex
 )
 
+func FindGate(id int) *Gate {
+	GatesMutex.RLock()
+	defer GatesMutex.RUnlock()
+	return Gates[id]
+}
+
 func (e *Gate) SetPoint(point *utils.Location) {
 	e.Point = fmt.Sprintf("%.2f,%.2f", point.X, point.Y)
 }
@@ -38,20 +43,17 @@ func (e *Gate) Delete() error {
 	return err
 }
 
-func getGates() error {
+func readGates() (map[int]*Gate, error) {
 	var gates []*Gate
 	query := `select * from data.gates`
 
 	if _, err := db.Select(&gates, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getGates: %s", err.Error())
+		return nil, fmt.Errorf("readGates: %s", err.Error())
 	}
 
+	m := make(map[int]*Gate, len(gates))
 	for _, g := range gates {
-		Gates[g.ID] = g
+		m[g.ID] = g
 	}
-
-	return nil
+	return m, nil
 }
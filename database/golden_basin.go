@@ -1,62 +1,70 @@
 package database
 
 import (
-	"database/sql"
-	"fmt"
+	"errors"
+	"log"
 	"time"
 
-	null "gopkg.in/guregu/null.v3"
+	"hero-server/utils"
 )
 
-var (
-	GoldenBasinArea    *GoldenBasin
-	CanJoinGoldenBasin = false
-)
+// goldenBasin is the golden basin war on map 76. The factions are the sides
+// and the first to kill the golden basin statue (18600078) holds the basin
+// for 23 days; its members are the only ones left in it.
+type goldenBasin struct{}
 
-type GoldenBasin struct {
-	ID        int       `db:"id"`
-	FactionID int       `db:"faction_id"`
-	ExpiresAt null.Time `db:"expires_at" json:"expires_at"`
-}
+func (goldenBasin) Join(b *Battleground, c *Character) (int, *utils.Location, error) {
+	if c.Level < 50 {
+		return 0, nil, errors.New("You are not at 50 Level.")
+	}
 
-func (g *GoldenBasin) Update() error {
-	_, err := db.Update(g)
-	return err
+	if c.Faction == 2 {
+		return 2, &utils.Location{X: 430, Y: 75}, nil
+	}
+	return 1, &utils.Location{X: 75, Y: 431}, nil
 }
 
-func getGoldenBasin() error {
-	var goldenBasin []*GoldenBasin
-	query := `select * from data.golden_basin;`
-
-	if _, err := db.Select(&goldenBasin, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
+// Start hands the basin back to no faction and sends the characters that
+// are not members out of it.
+func (goldenBasin) Start(b *Battleground) {
+	if err := FindTerritory(TERRITORY_GOLDEN_BASIN).Release(GOLDEN_BASIN_AREA); err != nil {
+		log.Println(err)
+	}
+	for _, c := range FindCharactersInMap(76) {
+		if c != nil && c.Socket != nil && b.Member(c) == nil {
+			data, _ := c.ChangeMap(1, nil)
+			c.Socket.Write(data)
 		}
-		return fmt.Errorf("getGoldenBasin: %s", err.Error())
 	}
+}
 
-	GoldenBasinArea = goldenBasin[0]
-
-	return nil
+func (goldenBasin) Tick(b *Battleground) bool {
+	return b.Score(1) > 0 || b.Score(2) > 0
 }
 
-func startGoldenBasinTimer(prepareWarStart int) {
-	//min, sec := secondsToMinutes(prepareWarStart)
-	//msg := fmt.Sprintf("%d mins %d secs after the Golden Basin War will start.", min, sec)
-	//makeAnnouncement(msg)
-	if prepareWarStart > 0 {
-		time.AfterFunc(time.Second*10, func() {
-			startGoldenBasinTimer(prepareWarStart - 10)
-		})
-	} else {
-		CanJoinGoldenBasin = true
-		//msg2 := "Please join from Faction District !"
-		//makeAnnouncement(msg2)
+func (goldenBasin) Finish(b *Battleground) {
+	winners := b.Winners()
+	if len(winners) == 0 {
+		makeAnnouncement("The Golden Basin war ended without a winner.")
+		return
+	}
+
+	faction := winners[0].Side
+	exp := time.Now().UTC().Add(time.Hour * 24 * 23)
+	if err := FindTerritory(TERRITORY_GOLDEN_BASIN).Capture(GOLDEN_BASIN_AREA, faction, exp); err != nil {
+		log.Println(err)
+	}
+
+	for _, c := range FindCharactersInMap(76) {
+		if c != nil && c.Socket != nil && c.Faction != faction {
+			data, _ := c.ChangeMap(1, nil)
+			c.Socket.Write(data)
+		}
 	}
 }
 
-func StartGoldenBasinWar() {
-	GoldenBasinArea.FactionID = 0
-	GoldenBasinArea.Update()
-	startGoldenBasinTimer(300)
+// CanEnterGoldenBasin tells if a character may enter the golden basin
+// outside of its war.
+func CanEnterGoldenBasin(c *Character) bool {
+	return c.Faction == FindTerritory(TERRITORY_GOLDEN_BASIN).Holder(GOLDEN_BASIN_AREA)
 }
@@ -1,52 +1,42 @@
 package database
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
-	null "gopkg.in/guregu/null.v3"
+	"hero-server/utils"
 )
 
-var (
-	GuildVarActive = false
-	GuildWarAreas  = make(map[int]*GuildWar)
-	GuildWarMobs   = []int{18600047, 18600048, 18600049, 18600050, 18600051}
-	GuildWarBuffs  = []int{70009, 70010, 70011, 70012, 70013}
-)
+// guildWar opens the guild war areas while it runs. Characters of a guild
+// enter them at the npc rather than joining, and the guild that kills the
+// statue of an area holds it.
+type guildWar struct{}
 
-type GuildWar struct {
-	AreaID     int       `db:"id"`
-	ClanID     int       `db:"clanid"`
-	ExpiresAt  null.Time `db:"expires_at" json:"expires_at"`
-	TempleName string    `db:"name" json:"name"`
+func (guildWar) Join(b *Battleground, c *Character) (int, *utils.Location, error) {
+	return 0, nil, errors.New("The guild war areas are entered at their npc.")
 }
 
-func (b *GuildWar) Update() error {
-	_, err := db.Update(b)
-	return err
+func (guildWar) Start(b *Battleground) {
+	makeAnnouncement("The guild war areas are open!")
 }
 
-func getGuildAreas() error {
-	var areas []*GuildWar
-	query := `select * from data.guild_war`
-
-	if _, err := db.Select(&areas, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getGuildAreas: %s", err.Error())
-	}
+func (guildWar) Tick(b *Battleground) bool {
+	return false
+}
 
-	for _, cr := range areas {
-		GuildWarAreas[cr.AreaID] = cr
-	}
+func (guildWar) Finish(b *Battleground) {
+	makeAnnouncement("The guild war areas are closed.")
+}
 
-	return nil
+// GuildWarActive tells if the guild war areas are open.
+func GuildWarActive() bool {
+	b := FindBattleground(BATTLEGROUND_GUILD_WAR)
+	return b != nil && b.Running()
 }
 
 func LogoutGuildWarBuffDelete(char *Character) {
-	for _, fivebuff := range GuildWarBuffs {
+	for _, fivebuff := range FindTerritory(TERRITORY_GUILD_WAR).Buffs {
 		buff, err := FindBuffByID(fivebuff, char.ID)
 		if err != nil {
 			continue
@@ -89,19 +79,19 @@ func AddGuildWarBuffWhenLogin(char *Character) error {
 		if err != nil {
 			return err
 		}
-		for _, clans := range GuildWarAreas {
-			if clans.ClanID == guild.ID {
-				buffID := GuildWarBuffs[clans.AreaID-1]
+		territory := FindTerritory(TERRITORY_GUILD_WAR)
+		for _, clans := range territory.Areas() {
+			if clans.Holder == guild.ID {
+				buffID := territory.Buffs[clans.ID-1]
 				currentTime := time.Now()
 				diff := clans.ExpiresAt.Time.Sub(currentTime)
 				if diff < 0 {
-					clans.ClanID = 0
-					clans.Update()
+					territory.Release(clans.ID)
 					continue
 				}
 
 				if buffID == 70009 {
-					infection := BuffInfections[70009]
+					infection := FindBuffInfection(70009)
 					buff := &Buff{ID: int(70009), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 					err = buff.Create()
 					if err != nil {
@@ -111,7 +101,7 @@ func AddGuildWarBuffWhenLogin(char *Character) error {
 				}
 
 				if buffID == 70010 {
-					infection := BuffInfections[70010]
+					infection := FindBuffInfection(70010)
 					buff := &Buff{ID: int(70010), CharacterID: char.ID, Name: infection.Name, DropMultiplier: 5, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 					err = buff.Create()
 					if err != nil {
@@ -122,7 +112,7 @@ func AddGuildWarBuffWhenLogin(char *Character) error {
 				}
 
 				if buffID == 70011 {
-					infection := BuffInfections[70011]
+					infection := FindBuffInfection(70011)
 					buff := &Buff{ID: int(70011), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 10, DropMultiplier: 3, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 					err = buff.Create()
 					if err != nil {
@@ -135,7 +125,7 @@ func AddGuildWarBuffWhenLogin(char *Character) error {
 				}
 
 				if buffID == 70012 {
-					infection := BuffInfections[70012]
+					infection := FindBuffInfection(70012)
 					buff := &Buff{ID: int(70012), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 3, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 					err = buff.Create()
 					if err != nil {
@@ -147,7 +137,7 @@ func AddGuildWarBuffWhenLogin(char *Character) error {
 				}
 
 				if buffID == 70013 {
-					infection := BuffInfections[70013]
+					infection := FindBuffInfection(70013)
 					buff := &Buff{ID: int(70013), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 3, StartedAt: char.Epoch, Duration: int64(diff.Seconds()), CanExpire: true}
 					err = buff.Create()
 					if err != nil {
@@ -442,35 +442,35 @@ func (g *Guild) AddGuildTierBuff(c *Character) {
 	/*if g.Recognition == 1 {
 		tier1Buff, _ := FindBuffByID(70015, c.ID)
 		if tier1Buff == nil {
-			infection := BuffInfections[70015]
+			infection := FindBuffInfection(70015)
 			buff := &Buff{ID: int(70015), CharacterID: c.ID, Name: infection.Name, EXPMultiplier: 3, DropMultiplier: 1, StartedAt: c.Epoch, Duration: int64(999999999), CanExpire: false}
 			buff.Create()
 		}
 	} else if g.Recognition == 2 {
 		tier2Buff, _ := FindBuffByID(70016, c.ID)
 		if tier2Buff == nil {
-			infection := BuffInfections[70016]
+			infection := FindBuffInfection(70016)
 			buff := &Buff{ID: int(70016), CharacterID: c.ID, Name: infection.Name, EXPMultiplier: 6, DropMultiplier: 2, StartedAt: c.Epoch, Duration: int64(999999999), CanExpire: false}
 			buff.Create()
 		}
 	} else if g.Recognition == 3 {
 		tier3Buff, _ := FindBuffByID(70017, c.ID)
 		if tier3Buff == nil {
-			infection := BuffInfections[70017]
+			infection := FindBuffInfection(70017)
 			buff := &Buff{ID: int(70017), CharacterID: c.ID, Name: infection.Name, EXPMultiplier: 9, DropMultiplier: 3, StartedAt: c.Epoch, Duration: int64(999999999), CanExpire: false}
 			buff.Create()
 		}
 	} else if g.Recognition == 4 {
 		tier4Buff, _ := FindBuffByID(70018, c.ID)
 		if tier4Buff == nil {
-			infection := BuffInfections[70018]
+			infection := FindBuffInfection(70018)
 			buff := &Buff{ID: int(70018), CharacterID: c.ID, Name: infection.Name, EXPMultiplier: 12, DropMultiplier: 4, StartedAt: c.Epoch, Duration: int64(999999999), CanExpire: false}
 			buff.Create()
 		}
 	} else if g.Recognition == 5 {
 		tier5Buff, _ := FindBuffByID(70019, c.ID)
 		if tier5Buff == nil {
-			infection := BuffInfections[70019]
+			infection := FindBuffInfection(70019)
 			buff := &Buff{ID: int(70019), CharacterID: c.ID, Name: infection.Name, EXPMultiplier: 15, DropMultiplier: 5, StartedAt: c.Epoch, Duration: int64(999999999), CanExpire: false}
 			buff.Create()
 		}
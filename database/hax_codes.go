@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -16,9 +16,16 @@ type HaxCode struct {
 }
 
 var (
-	HaxCodes = make(map[int]*HaxCode)
+	HaxCodes      = make(map[int]*HaxCode)
+	haxCodesMutex sync.RWMutex
 )
 
+func FindHaxCode(id int) *HaxCode {
+	haxCodesMutex.RLock()
+	defer haxCodesMutex.RUnlock()
+	return HaxCodes[id]
+}
+
 func (e *HaxCode) Create() error {
 	return db.Insert(e)
 }
@@ -32,21 +39,17 @@ func (e *HaxCode) Delete() error {
 	return err
 }
 
-func getHaxCodes() error {
-
+func readHaxCodes() (map[int]*HaxCode, error) {
 	var haxcodes []*HaxCode
 	query := `select * from data.hax_codes`
 
 	if _, err := db.Select(&haxcodes, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getHaxCodes: %s", err.Error())
+		return nil, fmt.Errorf("readHaxCodes: %s", err.Error())
 	}
 
+	m := make(map[int]*HaxCode, len(haxcodes))
 	for _, h := range haxcodes {
-		HaxCodes[h.ID] = h
+		m[h.ID] = h
 	}
-
-	return nil
+	return m, nil
 }
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -17,9 +17,28 @@ type HtItem struct {
 }
 
 var (
-	HTItems = make(map[int]*HtItem)
+	HTItems      = make(map[int]*HtItem)
+	htItemsMutex sync.RWMutex
 )
 
+// AllHTItems returns the items of the HT shop in no order.
+func AllHTItems() []*HtItem {
+	htItemsMutex.RLock()
+	defer htItemsMutex.RUnlock()
+
+	items := make([]*HtItem, 0, len(HTItems))
+	for _, item := range HTItems {
+		items = append(items, item)
+	}
+	return items
+}
+
+func FindHTItem(id int) *HtItem {
+	htItemsMutex.RLock()
+	defer htItemsMutex.RUnlock()
+	return HTItems[id]
+}
+
 func (e *HtItem) Create() error {
 	return db.Insert(e)
 }
@@ -38,20 +57,17 @@ func (e *HtItem) Delete() error {
 	return err
 }
 
-func getHTItems() error {
+func readHTItems() (map[int]*HtItem, error) {
 	var htitems []*HtItem
 	query := `select * from data.ht_shop`
 
 	if _, err := db.Select(&htitems, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getHTItems: %s", err.Error())
+		return nil, fmt.Errorf("readHTItems: %s", err.Error())
 	}
 
+	m := make(map[int]*HtItem, len(htitems))
 	for _, h := range htitems {
-		HTItems[h.ID] = h
+		m[h.ID] = h
 	}
-
-	return nil
+	return m, nil
 }
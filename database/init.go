@@ -8,10 +8,9 @@ import (
 	"time"
 
 	"hero-server/config"
-	"hero-server/logging"
 	"hero-server/utils"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	gorp "gopkg.in/gorp.v1"
 )
 
@@ -20,8 +19,6 @@ var (
 	FREEDROP_LIFETIME = time.Duration(200) * time.Millisecond
 	DEFAULT_DROP_RATE = utils.ParseFloat("1.0")
 	DEFAULT_EXP_RATE  = utils.ParseFloat("1.0")
-	DROP_RATE         = DEFAULT_DROP_RATE
-	EXP_RATE          = DEFAULT_EXP_RATE
 	DRAGON_BOX        = 0
 	GOLD_EVENT        = 0
 	GOLD_RATE         = 1.0
@@ -35,6 +32,8 @@ var (
 	RemoveFromRegister      func(*Character)
 	RemovePetFromRegister   func(c *Character)
 	FindCharacterByPseudoID func(server int, ID uint16) *Character
+	GenerateAIID            func(*AI)
+	ClearMapRegister        func(server int, mapID int16)
 
 	AccUpgrades          []byte
 	ArmorUpgrades        []byte
@@ -43,7 +42,6 @@ var (
 	SocketArmorUpgrades  []byte
 	SocketWeaponUpgrades []byte
 	plusRates            = []int{450, 600, 800, 900, 930, 960, 965}
-	logger               = logging.Logger
 )
 
 func InitDB() error {
@@ -65,10 +63,16 @@ func InitDB() error {
 		conn        *sql.DB
 	)
 
-	conn, err = sql.Open("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", ip, port, user, pass, name, sslMode))
+	DEFAULT_DROP_RATE = cfg.Rates.Drop
+	DEFAULT_EXP_RATE = cfg.Rates.Exp
+	expRate, dropRate = DEFAULT_EXP_RATE, DEFAULT_DROP_RATE
+
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", ip, port, user, pass, name, sslMode)
+	connector, err := pq.NewConnector(dsn)
 	if err != nil {
 		return fmt.Errorf("Database connection error: %s", err.Error())
 	}
+	conn = sql.OpenDB(timedConnector{connector})
 
 	conn.SetMaxIdleConns(maxIdle)
 	conn.SetMaxOpenConns(maxOpen)
@@ -78,6 +82,36 @@ func InitDB() error {
 		return fmt.Errorf("Database connection error: %s", err.Error())
 	}
 
+	UseConnection(conn)
+
+	if debug {
+		db.TraceOn("[gorp]", log.New(os.Stdout, "myapp:", log.Lmicroseconds))
+	}
+
+	if err = resetDB(); err != nil {
+		return err
+	}
+
+	if err = getAll(); err != nil {
+		return err
+	}
+
+	if err = listenReloads(dsn); err != nil {
+		return err
+	}
+
+	Init <- err == nil
+	return nil
+}
+
+// Connection returns the connection of the game tables.
+func Connection() *sql.DB {
+	return db.Db
+}
+
+// UseConnection maps the game tables on the given connection. InitDB calls it
+// after connecting; the replay tests use it to plug in their own store.
+func UseConnection(conn *sql.DB) {
 	db = &gorp.DbMap{Db: conn, Dialect: gorp.PostgresDialect{}}
 	db.AddTableWithNameAndSchema(Emotion{}, "data", "emotions")
 	db.AddTableWithNameAndSchema(PetExpInfo{}, "data", "pet_exp_table")
@@ -105,37 +139,23 @@ func InitDB() error {
 	db.AddTableWithNameAndSchema(ShopItem{}, "data", "shop_items").SetKeys(false, "type")
 	db.AddTableWithNameAndSchema(Enhancement{}, "data", "enchant").SetKeys(true, "id")
 
-	db.AddTableWithNameAndSchema(FiveClan{}, "data", "fiveclan_war").SetKeys(false, "id")
-	db.AddTableWithNameAndSchema(GuildWar{}, "data", "guild_war").SetKeys(false, "id")
-	db.AddTableWithNameAndSchema(GoldenBasin{}, "data", "golden_basin").SetKeys(true, "id")
-
 	db.AddTableWithNameAndSchema(AI{}, "hops", "ai").SetKeys(true, "id")
 	//db.AddTableWithNameAndSchema(AiBuff{}, "hops", "ai_buffs").SetKeys(false, "id", "ai_id")
 	db.AddTableWithNameAndSchema(Character{}, "hops", "characters").SetKeys(true, "id")
 	db.AddTableWithNameAndSchema(Buff{}, "hops", "characters_buffs").SetKeys(false, "id", "character_id")
+	db.AddTableWithNameAndSchema(CharacterQuest{}, "hops", "characters_quests").SetKeys(true, "id")
+	db.AddTableWithNameAndSchema(CharacterAchievement{}, "hops", "characters_achievements").SetKeys(true, "id")
+	db.AddTableWithNameAndSchema(DungeonRun{}, "hops", "dungeon_runs").SetKeys(true, "id")
 	db.AddTableWithNameAndSchema(ConsignmentItem{}, "hops", "consignment").SetKeys(false, "id")
 	db.AddTableWithNameAndSchema(Guild{}, "hops", "guilds").SetKeys(true, "id")
-	db.AddTableWithNameAndSchema(InventorySlot{}, "hops", "items_characters").SetKeys(true, "id")
+	db.AddTableWithNameAndSchema(InventorySlot{}, "hops", "items_characters").SetKeys(true, "id").SetVersionCol("Revision")
+	db.AddTableWithNameAndSchema(ItemEvent{}, "hops", "item_ledger").SetKeys(true, "id")
 	db.AddTableWithNameAndSchema(Relic{}, "hops", "relics").SetKeys(false, "id")
+	db.AddTableWithNameAndSchema(ScheduledEvent{}, "hops", "scheduled_events").SetKeys(true, "id")
 	db.AddTableWithNameAndSchema(Server{}, "hops", "servers").SetKeys(true, "id")
 	db.AddTableWithNameAndSchema(Skills{}, "hops", "skills").SetKeys(false, "id")
 	db.AddTableWithNameAndSchema(Stat{}, "hops", "stats").SetKeys(false, "id")
 	db.AddTableWithNameAndSchema(User{}, "hops", "users").SetKeys(true, "id")
-
-	if debug {
-		db.TraceOn("[gorp]", log.New(os.Stdout, "myapp:", log.Lmicroseconds))
-	}
-
-	if err = resetDB(); err != nil {
-		return err
-	}
-
-	if err = getAll(); err != nil {
-		return err
-	}
-
-	Init <- err == nil
-	return nil
 }
 
 func resetDB() error {
@@ -185,10 +205,20 @@ func resetDB() error {
 
 func getAll() error {
 
-	callBacks := []func() error{getAllDrops, getScripts, getHaxCodes, getHTItems, getProductions, getAdvancedFusions, getItemMeltings, getGates,
-		getStackables, getAllItems, getSkillInfos, getGamblingItems, getJobPassives, getBuffIcons, getBuffInfections, getExps, getAllSavePoints,
-		getRelics, GetAllPetExps, GetAllPets, getAllShops, getAllShopItems, getFiveAreas, getAllEmotions, getGuildAreas, getGoldenBasin, getEnhancements}
+	// the other tables are validated against the items
+	if err := loadTable("items"); err != nil {
+		return err
+	}
+	for _, name := range TableNames() {
+		if name == "items" {
+			continue
+		}
+		if err := loadTable(name); err != nil {
+			return err
+		}
+	}
 
+	callBacks := []func() error{getRelics, getTerritories}
 	for _, cb := range callBacks {
 		if err := cb(); err != nil {
 			return err
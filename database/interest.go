@@ -0,0 +1,127 @@
+package database
+
+import (
+	"log"
+
+	"hero-server/nats"
+
+	NATS "github.com/nats-io/nats.go"
+)
+
+func init() {
+	nats.ResolveOrigin = resolveCastOrigin
+}
+
+func resolveCastOrigin(p *nats.CastPacket) *nats.Origin {
+	if p.CharacterID > 0 {
+		characterMutex.RLock()
+		c := characters[p.CharacterID]
+		characterMutex.RUnlock()
+
+		return c.CastOrigin()
+
+	} else if p.MobID > 0 {
+		AIMutex.RLock()
+		ai := AIs[p.MobID]
+		AIMutex.RUnlock()
+
+		return ai.CastOrigin()
+	}
+
+	return nil
+}
+
+func (c *Character) CastOrigin() *nats.Origin {
+	if c == nil || c.Socket == nil || c.Socket.User == nil || c.Coordinate == "" {
+		return nil
+	}
+
+	coordinate := ConvertPointToLocation(c.Coordinate)
+	return &nats.Origin{Server: c.Socket.User.ConnectedServer, Map: c.Map, X: coordinate.X, Y: coordinate.Y}
+}
+
+func (ai *AI) CastOrigin() *nats.Origin {
+	if ai == nil || ai.Coordinate == "" {
+		return nil
+	}
+
+	coordinate := ConvertPointToLocation(ai.Coordinate)
+	return &nats.Origin{Server: ai.Server, Map: ai.Map, X: coordinate.X, Y: coordinate.Y}
+}
+
+func (pet *PetSlot) CastOrigin() *nats.Origin {
+	if pet == nil || pet.PetOwner == nil {
+		return nil
+	}
+
+	origin := pet.PetOwner.CastOrigin()
+	if origin == nil {
+		return nil
+	}
+
+	origin.X, origin.Y = pet.Coordinate.X, pet.Coordinate.Y
+	return origin
+}
+
+// UpdateInterest keeps the socket subscribed to the 3x3 block of grid cells
+// around its character. It is cheap to call when the cell did not change.
+func (s *Socket) UpdateInterest() {
+	if s == nil || s.CastHandler == nil {
+		return
+	}
+
+	origin := s.Character.CastOrigin()
+	if origin == nil {
+		return
+	}
+
+	cell := nats.CellOf(origin)
+
+	s.cellMutex.Lock()
+	defer s.cellMutex.Unlock()
+
+	if s.cellSubs != nil && s.cell == cell {
+		return
+	}
+
+	if s.cellSubs == nil {
+		s.cellSubs = make(map[string]*NATS.Subscription)
+	}
+
+	wanted := make(map[string]bool, 9)
+	for _, n := range cell.Neighbours() {
+		wanted[n.Subject()] = true
+	}
+
+	for subject, sub := range s.cellSubs {
+		if !wanted[subject] {
+			sub.Unsubscribe()
+			delete(s.cellSubs, subject)
+		}
+	}
+
+	for subject := range wanted {
+		if _, ok := s.cellSubs[subject]; ok {
+			continue
+		}
+
+		sub, err := nats.Connection().Subscribe(subject, s.CastHandler)
+		if err != nil {
+			log.Println("UpdateInterest error:", err)
+			continue
+		}
+		s.cellSubs[subject] = sub
+	}
+
+	s.cell = cell
+}
+
+func (s *Socket) clearInterest() {
+	s.cellMutex.Lock()
+	defer s.cellMutex.Unlock()
+
+	for _, sub := range s.cellSubs {
+		sub.Unsubscribe()
+	}
+	s.cellSubs = nil
+}
@@ -15,6 +15,7 @@ import (
 	"hero-server/utils"
 
 	"github.com/thoas/go-funk"
+	gorp "gopkg.in/gorp.v1"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -39,6 +40,8 @@ type InventorySlot struct {
 	UpdatedAt   null.Time       `db:"updated_at"`
 	Consignment bool            `db:"consignment"`
 	Appearance  int64           `db:"appearance"`
+	Revision    int64           `db:"version"` // optimistic lock, bumped by every update
+	UID         string          `db:"uid"`     // stable item uid of the ledger
 
 	Pet *PetSlot    `db:"-" json:"-"`
 	RFU interface{} `db:"-" json:"-"`
@@ -79,7 +82,7 @@ type PetSlot struct {
 }
 
 var (
-	DropRegister = make([]map[int16]map[uint16]*Drop, SERVER_COUNT+1)
+	DropRegister = make([]map[int16]map[uint16]*Drop, MAX_SERVER+1)
 	drMutex      sync.RWMutex
 
 	ITEM_SLOT = utils.Packet{0xAA, 0x55, 0x2E, 0x00, 0x57, 0x0A, 0x00, 0xA1, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
@@ -95,12 +98,12 @@ var (
 
 func init() {
 
-	for j := 0; j <= SERVER_COUNT; j++ {
+	for j := 0; j <= MAX_SERVER; j++ {
 		DropRegister[j] = make(map[int16]map[uint16]*Drop)
 	}
 
 	for i := int16(1); i <= 255; i++ {
-		for j := 0; j <= SERVER_COUNT; j++ {
+		for j := 0; j <= MAX_SERVER; j++ {
 			DropRegister[j][i] = make(map[uint16]*Drop)
 		}
 	}
@@ -110,6 +113,28 @@ func NewSlot() *InventorySlot {
 	return &InventorySlot{UpgradeArr: "{0,0,0,0,0,0,0,0,0,0,0,0,0,0,0}", SocketArr: "{0,0,0,0,0,0,0,0,0,0,0,0,0,0,0}"}
 }
 
+// NewItemSlot returns a slot holding quantity of the item, pets start
+// with full fullness and loyalty at the experience of their level.
+func NewItemSlot(itemID int64, quantity uint) *InventorySlot {
+	item := &InventorySlot{ItemID: itemID, Quantity: quantity}
+	info := FindItem(itemID)
+
+	if info.GetType() == PET_TYPE {
+		petInfo := FindPet(itemID)
+		expInfo := FindPetExp(petInfo.Level - 1)
+
+		item.Pet = &PetSlot{
+			Fullness: 100, Loyalty: 100,
+			Exp:   uint64(expInfo.ReqExpEvo1),
+			HP:    petInfo.BaseHP,
+			Level: byte(petInfo.Level),
+			Name:  petInfo.Name,
+			CHI:   petInfo.BaseChi}
+	}
+
+	return item
+}
+
 func FindInventorySlotsByCharacterID(characterID int) ([]*InventorySlot, error) {
 
 	var arr []*InventorySlot
@@ -190,6 +215,10 @@ func (slot *InventorySlot) Insert() error {
 		slot.PetInfo = json.RawMessage("{}")
 	}
 
+	if slot.UID == "" {
+		slot.UID = NewItemUID()
+	}
+
 	err := db.Insert(slot)
 	if err != nil {
 		return err
@@ -199,11 +228,7 @@ func (slot *InventorySlot) Insert() error {
 	return nil
 }
 
-func (slot *InventorySlot) Update() error {
-
-	if slot.ID == 0 {
-		return nil
-	}
+func (slot *InventorySlot) prepareUpdate() {
 
 	now := time.Now().UTC()
 	slot.UpdatedAt = null.TimeFrom(now)
@@ -222,7 +247,15 @@ func (slot *InventorySlot) Update() error {
 	if slot.PetInfo == nil {
 		slot.PetInfo = json.RawMessage("{}")
 	}
+}
 
+func (slot *InventorySlot) Update() error {
+
+	if slot.ID == 0 {
+		return nil
+	}
+
+	slot.prepareUpdate()
 	_, err := db.Update(slot)
 	if err != nil {
 		log.Println(err)
@@ -232,6 +265,14 @@ func (slot *InventorySlot) Update() error {
 	return nil
 }
 
+// UpdateWithTransaction fails with a gorp.OptimisticLockError if the row was
+// changed since the slot was read.
+func (slot *InventorySlot) UpdateWithTransaction(tr *gorp.Transaction) error {
+	slot.prepareUpdate()
+	_, err := tr.Update(slot)
+	return err
+}
+
 func (slot *InventorySlot) Delete() error {
 	InventoryItems.Delete(slot.ID)
 	_, err := db.Delete(slot)
@@ -356,7 +397,7 @@ func (slot *InventorySlot) GetData(slotID int16) []byte {
 	resp, r2 := utils.Packet{}, utils.Packet{}
 	if slot.ItemID > 0 {
 		r := ITEM_SLOT
-		item := Items[slot.ItemID]
+		item := FindItem(slot.ItemID)
 		if item == nil {
 			return nil
 		}
@@ -458,7 +499,7 @@ func (slot *InventorySlot) GetPetStats(c *Character) []byte {
 		return nil
 	}
 
-	petInfo := Pets[slot.ItemID]
+	petInfo := FindPet(slot.ItemID)
 
 	level := byte(petInfo.Level)
 	levelDiff := int(pet.Level - level)
@@ -485,7 +526,7 @@ func (slot *InventorySlot) GetPetStats(c *Character) []byte {
 			continue
 		}
 
-		info := Items[item.ItemID]
+		info := FindItem(item.ItemID)
 		if info == nil || info.Slot != d+317 {
 			continue
 		}
@@ -498,7 +539,7 @@ func (slot *InventorySlot) GetPetStats(c *Character) []byte {
 
 		upgs := item.GetUpgrades()
 		for i := byte(0); i < item.Plus; i++ {
-			upg := Items[int64(upgs[i])]
+			upg := FindItem(int64(upgs[i]))
 			if upg == nil {
 				continue
 			}
@@ -572,12 +613,34 @@ func (pet *PetSlot) FindTargetMobID(owner *Character) (int, error) {
 	return 0, nil
 }
 
-func (pet *PetSlot) MovementHandler(token int64, start, end *utils.Location, speed float64) {
+// Walk moves the pet to end along the path of the map, the pet stays when
+// end can't be reached.
+func (pet *PetSlot) Walk(mapID int16, token int64, start, end *utils.Location, speed float64) {
+	path := FindPath(mapID, start, end)
+	if len(path) == 0 {
+		if token == pet.MovementToken {
+			pet.MovementToken = 0
+			pet.IsMoving = false
+		}
+		return
+	}
+
+	pet.MovementHandler(token, start, &path[0], speed, path[1:])
+}
+
+// MovementHandler moves pet from start towards end, then on along path, the
+// points left after end. It stops once the movement token changes.
+func (pet *PetSlot) MovementHandler(token int64, start, end *utils.Location, speed float64, path []utils.Location) {
 
 	diff := utils.CalculateDistance(start, end)
 
 	if diff < 1 {
 		pet.Coordinate = *end
+		if token == pet.MovementToken && len(path) > 0 { // on to the next point of the path
+			*start = *end
+			pet.MovementHandler(token, start, &path[0], speed, path[1:])
+			return
+		}
 		pet.MovementToken = 0
 		pet.IsMoving = false
 		return
@@ -589,14 +652,14 @@ func (pet *PetSlot) MovementHandler(token int64, start, end *utils.Location, spe
 	r := utils.Packet{}
 	r = pet.Move(*end, 2)
 
-	p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.PET_MOVEMENT}
+	p := nats.CastPacket{CastNear: true, PetID: pet.PseudoID, Data: r, Type: nats.PET_MOVEMENT, Origin: pet.CastOrigin()}
 	p.Cast()
 
 	if diff <= speed { // target is so close
 		*start = *end
 		time.AfterFunc(time.Duration(diff/speed)*time.Millisecond, func() {
 			if token == pet.MovementToken {
-				pet.MovementHandler(token, start, end, speed)
+				pet.MovementHandler(token, start, end, speed, path)
 			}
 		})
 	} else { // target is away
@@ -604,7 +667,7 @@ func (pet *PetSlot) MovementHandler(token int64, start, end *utils.Location, spe
 		start.Y += (end.Y - start.Y) * speed / diff
 		time.AfterFunc(1000*time.Millisecond, func() {
 			if token == pet.MovementToken {
-				pet.MovementHandler(token, start, end, speed)
+				pet.MovementHandler(token, start, end, speed, path)
 			}
 		})
 	}
@@ -727,12 +790,12 @@ func (pet *PetSlot) CastSkill(owner *Character) []byte {
 	}
 
 	petSlot := slots[0x0A]
-	petInfo := Pets[petSlot.ItemID]
+	petInfo := FindPet(petSlot.ItemID)
 
 	min := pet.MinATK + pet.MinATK*pet.INT/100
 	max := pet.MaxATK + pet.MaxATK*pet.INT/100
 
-	skillInfo := SkillInfos[petInfo.SkillID]
+	skillInfo := FindSkillInfo(petInfo.SkillID)
 	castLocation := &pet.Coordinate
 
 	if skillInfo.AreaCenter == 1 || skillInfo.AreaCenter == 2 {
@@ -805,8 +868,8 @@ func (pet *PetSlot) AddExp(owner *Character) {
 	}
 
 	petSlot := slots[0x0A]
-	petInfo := Pets[petSlot.ItemID]
-	petExpInfo := PetExps[int16(pet.Level)]
+	petInfo := FindPet(petSlot.ItemID)
+	petExpInfo := FindPetExp(int16(pet.Level))
 	if petExpInfo == nil {
 		log.Println("Invalid pet level:", pet.Level)
 		return
@@ -820,7 +883,7 @@ func (pet *PetSlot) AddExp(owner *Character) {
 	for pet.Exp >= uint64(targetExps[petInfo.Evolution-1]) {
 		if pet.Level < 100 {
 			pet.Level++
-			petExpInfo = PetExps[int16(pet.Level)]
+			petExpInfo = FindPetExp(int16(pet.Level))
 			targetExps = []int{petExpInfo.ReqExpEvo1, petExpInfo.ReqExpEvo2, petExpInfo.ReqExpEvo3, petExpInfo.ReqExpHt}
 
 		} else {
@@ -831,7 +894,7 @@ func (pet *PetSlot) AddExp(owner *Character) {
 		}
 	}
 
-	petExpInfo = PetExps[int16(pet.Level)]
+	petExpInfo = FindPetExp(int16(pet.Level))
 	targetExps = []int{petExpInfo.ReqExpEvo1, petExpInfo.ReqExpEvo2, petExpInfo.ReqExpEvo3, petExpInfo.ReqExpHt}
 
 	for int16(pet.Level) >= petInfo.TargetLevel { // evolution
@@ -840,7 +903,7 @@ func (pet *PetSlot) AddExp(owner *Character) {
 		}
 
 		petSlot.ItemID = petInfo.EvolvedID
-		petInfo = Pets[petInfo.EvolvedID]
+		petInfo = FindPet(petInfo.EvolvedID)
 		pet.Exp = uint64(targetExps[petInfo.Evolution-1])
 	}
 
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"sync"
 
@@ -18,18 +19,50 @@ var (
 	haxBoxes      = []int64{92000002, 92000003, 92000004, 92000005, 92000006, 92000007, 92000008, 92000009, 92000010}
 )
 
+func FindItem(id int64) *Item {
+	ItemsMutex.RLock()
+	defer ItemsMutex.RUnlock()
+	return Items[id]
+}
+
 func GetItemInfo(id int64) (*Item, bool) {
 	ItemsMutex.RLock()
 	defer ItemsMutex.RUnlock()
 	item, ok := Items[id]
 	return item, ok
 }
+
+// SetItem adds or replaces the information of an item. The table is copied,
+// maps handed out by a reload are never changed.
 func SetItem(item *Item) {
 	ItemsMutex.Lock()
 	defer ItemsMutex.Unlock()
-	Items[item.ID] = item
+
+	items := make(map[int64]*Item, len(Items)+1)
+	for id, info := range Items {
+		items[id] = info
+	}
+	items[item.ID] = item
+	Items = items
 }
 
+// DeleteItem removes the information of an item, see SetItem.
+func DeleteItem(id int64) {
+	ItemsMutex.Lock()
+	defer ItemsMutex.Unlock()
+
+	items := make(map[int64]*Item, len(Items))
+	for itemID, info := range Items {
+		if itemID != id {
+			items[itemID] = info
+		}
+	}
+	Items = items
+}
+
+// ITEM_TABLE_COLUMNS is the number of columns read from the items sheet.
+const ITEM_TABLE_COLUMNS = 131
+
 const (
 	WEAPON_TYPE = iota
 	ARMOR_TYPE
@@ -222,23 +255,28 @@ func (item *Item) GetType() int {
 	return UNKNOWN_TYPE
 }
 
-func getAllItems() error {
+func readItems() (map[int64]*Item, error) {
 	log.Print("Reading Items table...")
 
 	f, err := excelize.OpenFile("data/tb_ItemTable_Normal.xlsx")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("readItems: %s", err.Error())
 	}
 	defer f.Close()
 	// Get all the rows in the Sheet1.
 	rows, err := f.GetRows("Sheet1")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("readItems: %s", err.Error())
 	}
+
+	items := make(map[int64]*Item, len(rows))
 	for index, row := range rows {
 		if index == 0 {
 			continue
 		}
+		if len(row) < ITEM_TABLE_COLUMNS { // empty cells at the end are left out
+			row = append(row, make([]string, ITEM_TABLE_COLUMNS-len(row))...)
+		}
 		item := &Item{
 			ID:              int64(utils.StringToInt(row[1])),
 			Name:            row[2],
@@ -305,9 +343,9 @@ func getAllItems() error {
 			HolyWaterRate3: utils.StringToInt(row[130]),
 			NPCID:          utils.StringToInt(row[29]),
 		}
-		SetItem(item)
+		items[item.ID] = item
 	}
-	return nil
+	return items, nil
 }
 
 // Determines if a weapon item can use an action with specified type
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -20,9 +20,16 @@ type JobPassive struct {
 }
 
 var (
-	JobPassives = make(map[int8]*JobPassive)
+	JobPassives      = make(map[int8]*JobPassive)
+	jobPassivesMutex sync.RWMutex
 )
 
+func FindJobPassive(id int8) *JobPassive {
+	jobPassivesMutex.RLock()
+	defer jobPassivesMutex.RUnlock()
+	return JobPassives[id]
+}
+
 func (p *JobPassive) Create() error {
 	return db.Insert(p)
 }
@@ -41,20 +48,17 @@ func (p *JobPassive) Delete() error {
 	return err
 }
 
-func getJobPassives() error {
+func readJobPassives() (map[int8]*JobPassive, error) {
 	var passives []*JobPassive
 	query := `select * from data.job_passives`
 
 	if _, err := db.Select(&passives, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getJobPassives: %s", err.Error())
+		return nil, fmt.Errorf("readJobPassives: %s", err.Error())
 	}
 
+	m := make(map[int8]*JobPassive, len(passives))
 	for _, p := range passives {
-		JobPassives[p.ID] = p
+		m[p.ID] = p
 	}
-
-	return nil
+	return m, nil
 }
@@ -1,65 +1,36 @@
 package database
 
 import (
+	"errors"
 	"fmt"
-	"sync"
-	"time"
-)
-
-var (
-	LastManCharacters = make(map[int]*Character)
-	LastManMutex      sync.Mutex
 
-	CanJoinLastMan = false
-	LastmanStarted = false
+	"hero-server/utils"
 )
 
-func StartLastManTimer(prepareWarStart int) {
-	min, sec := secondsToMinutes(prepareWarStart)
-	msg := fmt.Sprintf("Last Man Standing is starting in %d minutes %d seconds", min, sec)
-	msg2 := fmt.Sprintf("Please join from Master Bak on Marketplace.")
-	makeAnnouncement(msg)
-	makeAnnouncement(msg2)
-	if prepareWarStart > 0 {
-		time.AfterFunc(time.Second*10, func() {
-			StartLastManTimer(prepareWarStart - 10)
-		})
-	} else {
-		StartLastManWar()
+// lastMan is last man standing on map 254, every member for itself. Killed
+// members are out and the last one left wins.
+type lastMan struct{}
+
+func (lastMan) Join(b *Battleground, c *Character) (int, *utils.Location, error) {
+	if c.Level < 60 {
+		return 0, nil, errors.New("You must be level 60 to join Last Man Standing.")
 	}
+	return 0, &utils.Location{X: 137, Y: 365}, nil
 }
 
-func StartLastManWar() {
-	CanJoinLastMan = false
-	LastmanStarted = true
+func (lastMan) Start(b *Battleground) {
 	makeAnnouncement("Last Man Standing has started! GEAR UP!")
-	LastManRunning()
 }
 
-func LastManRunning() {
-	for range time.Tick(10 * time.Second) {
-		LastManMutex.Lock()
-		totalChr := len(LastManCharacters)
-		LastManMutex.Unlock()
-
-		if totalChr > 1 {
-
-		} else {
-			CanJoinLastMan = false
-			LastmanStarted = false
-
-			winner := ""
-
-			LastManMutex.Lock()
-			for k := range LastManCharacters {
-				winner = LastManCharacters[k].Name
-				delete(LastManCharacters, LastManCharacters[k].ID)
-			}
-			LastManMutex.Unlock()
+func (lastMan) Tick(b *Battleground) bool {
+	return len(b.Members(0)) <= 1
+}
 
-			msg := fmt.Sprintf("Last Man Standing Winner : %s", winner)
-			makeAnnouncement(msg)
-			return
-		}
+func (lastMan) Finish(b *Battleground) {
+	winners := b.Winners()
+	if len(winners) != 1 {
+		makeAnnouncement("Last Man Standing has ended without a winner.")
+		return
 	}
+	makeAnnouncement(fmt.Sprintf("Last Man Standing Winner : %s", winners[0].Name))
 }
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"hero-server/utils"
+
+	"github.com/google/uuid"
+	gorp "gopkg.in/gorp.v1"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Item ledger events. Quantity of an event is the change of the number of
+// items in the game, so only creations and the ways items leave the game
+// have one.
+const (
+	ITEM_CREATED   = "created"   // added to an inventory by the game (drops, npc shops, rewards)
+	ITEM_SPLIT     = "split"     // a new stack split from the stack in note
+	ITEM_MOVED     = "moved"     // moved between the inventory and the bank, note is where to
+	ITEM_TRADED    = "traded"    // changed hands in a trade
+	ITEM_SOLD      = "sold"      // sold to an npc
+	ITEM_LISTED    = "listed"    // put on consignment
+	ITEM_BOUGHT    = "bought"    // bought from consignment or a player shop
+	ITEM_WITHDRAWN = "withdrawn" // taken back from consignment
+	ITEM_CONSUMED  = "consumed"  // used up by the blacksmith
+	ITEM_DESTROYED = "destroyed" // burned by a failed upgrade
+	ITEM_GRANTED   = "granted"   // given by a gm, note is the gm
+)
+
+var (
+	lastItemAudit      *ItemAudit
+	lastItemAuditMutex sync.RWMutex
+)
+
+// ItemEvent is a row of the append-only item ledger.
+type ItemEvent struct {
+	ID              int64     `db:"id" json:"id"`
+	UID             string    `db:"uid" json:"uid"`
+	RowID           int       `db:"row_id" json:"row_id"` // id in hops.items_characters
+	ItemID          int64     `db:"item_id" json:"item_id"`
+	Event           string    `db:"event" json:"event"`
+	Quantity        int64     `db:"quantity" json:"quantity"`
+	FromCharacterID null.Int  `db:"from_character_id" json:"from_character_id"`
+	ToCharacterID   null.Int  `db:"to_character_id" json:"to_character_id"`
+	SlotID          int16     `db:"slot_id" json:"slot_id"`
+	Note            string    `db:"note" json:"note"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+}
+
+// ItemAudit is the result of AuditItems.
+type ItemAudit struct {
+	Time        time.Time          `json:"time"`
+	Duplicates  []*DuplicateItem   `json:"duplicates"`
+	Divergences []*StackDivergence `json:"divergences"`
+}
+
+// DuplicateItem is an item uid found in more than one place.
+type DuplicateItem struct {
+	UID    string `db:"uid" json:"uid"`
+	Copies int64  `db:"copies" json:"copies"`
+	Online bool   `db:"-" json:"online"` // found in the inventories of online characters
+}
+
+// StackDivergence is a stackable item with more pieces in the game than the
+// ledger accounts for.
+type StackDivergence struct {
+	ItemID int64 `json:"item_id"`
+	InGame int64 `json:"in_game"`
+	Ledger int64 `json:"ledger"`
+}
+
+// NewItemUID returns a new item uid. The uid is copied along with the rest
+// of a slot, so a duplicated item keeps the uid of the original.
+func NewItemUID() string {
+	return uuid.New().String()
+}
+
+// recordItem appends an event for slot to the ledger, with s being either
+// the connection or the transaction that moves the item.
+func recordItem(s gorp.SqlExecutor, event string, slot *InventorySlot, quantity int64, from, to *Character, note string) error {
+	e := &ItemEvent{
+		UID:       slot.UID,
+		RowID:     slot.ID,
+		ItemID:    slot.ItemID,
+		Event:     event,
+		Quantity:  quantity,
+		SlotID:    slot.SlotID,
+		Note:      note,
+		CreatedAt: time.Now().UTC(),
+	}
+	if from != nil {
+		e.FromCharacterID = null.IntFrom(int64(from.ID))
+	}
+	if to != nil {
+		e.ToCharacterID = null.IntFrom(int64(to.ID))
+	}
+
+	switch event {
+	case ITEM_CREATED:
+		itemsCreated.Add(float64(quantity))
+	case ITEM_GRANTED:
+		itemsGranted.Inc()
+	}
+
+	if err := s.Insert(e); err != nil {
+		return fmt.Errorf("recordItem: %s", err.Error())
+	}
+	return nil
+}
+
+// RecordItem appends an event outside of a transaction. A failed write is
+// logged, it does not undo what happened to the item.
+func RecordItem(event string, slot *InventorySlot, quantity int64, from, to *Character, note string) {
+	if slot == nil || slot.ItemID == 0 {
+		return
+	}
+
+	if err := recordItem(db, event, slot, quantity, from, to, note); err != nil {
+		log.Println(err)
+	}
+}
+
+// recordMove records an item that went from slot where to slot to if it
+// moved between the inventory and the bank.
+func recordMove(c *Character, item *InventorySlot, where, to int16) {
+	fromBank, toBank := where >= 0x0043 && where <= 0x132, to >= 0x0043 && to <= 0x132
+	if fromBank == toBank {
+		return
+	}
+
+	note := "inventory"
+	if toBank {
+		note = "bank"
+	}
+	RecordItem(ITEM_MOVED, item, 0, c, c, note)
+}
+
+// consumeItem takes amount of the item in slotID from the inventory of c and
+// records it as used up by the blacksmith action in note.
+func (c *Character) consumeItem(slotID int16, amount uint, note string) *utils.Packet {
+	slots, err := c.InventorySlots()
+	if err != nil {
+		return nil
+	}
+
+	item := *slots[slotID]
+	resp := c.DecrementItem(slotID, amount)
+	if resp != nil {
+		RecordItem(ITEM_CONSUMED, &item, -int64(amount), c, nil, note)
+	}
+	return resp
+}
+
+// GrantItem is AddItem for items given by a gm, recorded in the ledger as
+// granted by the gm named by.
+func (c *Character) GrantItem(item *InventorySlot, slotID int16, lootingDrop bool, by string) (*utils.Packet, int16, error) {
+	return c.addItem(item, slotID, lootingDrop, ITEM_GRANTED, by)
+}
+
+func FindItemEventsByUID(uid string) ([]*ItemEvent, error) {
+
+	var events []*ItemEvent
+	query := `select * from hops.item_ledger where uid = $1 order by id asc`
+	if _, err := db.Select(&events, query, uid); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("FindItemEventsByUID: %s", err.Error())
+	}
+
+	return events, nil
+}
+
+// AuditItems looks for item uids that exist more than once, in the database
+// or in the inventories of online characters, and for stackable items of
+// which there are more pieces than the ledger has created.
+func AuditItems() (*ItemAudit, error) {
+	audit := &ItemAudit{Time: time.Now().UTC()}
+
+	query := `select uid, count(*) as copies from hops.items_characters where uid <> '' group by uid having count(*) > 1`
+	if _, err := db.Select(&audit.Duplicates, query); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("AuditItems: %s", err.Error())
+	}
+
+	found := make(map[string]bool)
+	for _, d := range audit.Duplicates {
+		found[d.UID] = true
+	}
+	for uid, copies := range onlineItemCopies() {
+		if copies > 1 && !found[uid] {
+			audit.Duplicates = append(audit.Duplicates, &DuplicateItem{UID: uid, Copies: int64(copies), Online: true})
+		}
+	}
+
+	inGame, err := itemTotals(`select item_id, sum(quantity) as total from hops.items_characters group by item_id`)
+	if err != nil {
+		return nil, fmt.Errorf("AuditItems: %s", err.Error())
+	}
+	ledger, err := itemTotals(`select item_id, sum(quantity) as total from hops.item_ledger group by item_id`)
+	if err != nil {
+		return nil, fmt.Errorf("AuditItems: %s", err.Error())
+	}
+
+	for itemID, total := range inGame {
+		info := FindItem(itemID)
+		if info == nil || FindStackableByUIF(info.UIF) == nil {
+			continue
+		}
+		// items used up outside of the ledger only lower the game total
+		if total > ledger[itemID] {
+			audit.Divergences = append(audit.Divergences, &StackDivergence{ItemID: itemID, InGame: total, Ledger: ledger[itemID]})
+		}
+	}
+
+	for _, d := range audit.Duplicates {
+		log.Printf("AuditItems: item %s exists %d times (online: %t)", d.UID, d.Copies, d.Online)
+	}
+	for _, d := range audit.Divergences {
+		log.Printf("AuditItems: %d pieces of item %d in game, ledger has %d", d.InGame, d.ItemID, d.Ledger)
+	}
+
+	lastItemAuditMutex.Lock()
+	lastItemAudit = audit
+	lastItemAuditMutex.Unlock()
+	return audit, nil
+}
+
+// LastItemAudit returns the result of the last AuditItems run, nil before
+// the first one.
+func LastItemAudit() *ItemAudit {
+	lastItemAuditMutex.RLock()
+	defer lastItemAuditMutex.RUnlock()
+	return lastItemAudit
+}
+
+func itemTotals(query string) (map[int64]int64, error) {
+	var rows []*struct {
+		ItemID int64 `db:"item_id"`
+		Total  int64 `db:"total"`
+	}
+	if _, err := db.Select(&rows, query); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	totals := make(map[int64]int64, len(rows))
+	for _, r := range rows {
+		totals[r.ItemID] = r.Total
+	}
+	return totals, nil
+}
+
+// onlineItemCopies counts the inventory slots holding each uid over the
+// online characters, a slot copied in memory shows up here before it is
+// saved.
+func onlineItemCopies() map[string]int {
+	copies := make(map[string]int)
+
+	characters, err := FindOnlineCharacters()
+	if err != nil {
+		log.Println(err)
+		return copies
+	}
+
+	for _, c := range characters {
+		slots, err := c.InventorySlots()
+		if err != nil {
+			continue
+		}
+		for _, slot := range slots {
+			if slot.ItemID != 0 && slot.UID != "" {
+				copies[slot.UID]++
+			}
+		}
+	}
+	return copies
+}
@@ -1,10 +1,10 @@
 package database
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -24,9 +24,16 @@ type ItemMelting struct {
 }
 
 var (
-	Meltings = make(map[int]*ItemMelting)
+	Meltings      = make(map[int]*ItemMelting)
+	meltingsMutex sync.RWMutex
 )
 
+func FindMelting(id int) *ItemMelting {
+	meltingsMutex.RLock()
+	defer meltingsMutex.RUnlock()
+	return Meltings[id]
+}
+
 func (e *ItemMelting) Create() error {
 	return db.Insert(e)
 }
@@ -70,20 +77,17 @@ func (e *ItemMelting) GetItemCounts() ([]int, error) {
 	return e.itemCounts, nil
 }
 
-func getItemMeltings() error {
+func readMeltings() (map[int]*ItemMelting, error) {
 	var meltings []*ItemMelting
 	query := `select * from data.item_meltings`
 
 	if _, err := db.Select(&meltings, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getItemMeltings: %s", err.Error())
+		return nil, fmt.Errorf("readMeltings: %s", err.Error())
 	}
 
-	for _, m := range meltings {
-		Meltings[m.ID] = m
+	m := make(map[int]*ItemMelting, len(meltings))
+	for _, melting := range meltings {
+		m[melting.ID] = melting
 	}
-
-	return nil
+	return m, nil
 }
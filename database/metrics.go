@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+
+	"hero-server/metrics"
+)
+
+var (
+	HandlerPanics = metrics.NewCounter("hero_handler_panics_total", "Panics recovered in the packet and character handlers.", "handler")
+	GoldCreated   = metrics.NewCounter("hero_gold_created_total", "Gold given to characters from outside the economy, by source.", "source")
+
+	itemsCreated       = metrics.NewCounter("hero_items_created_total", "Pieces of items created, as recorded in the item ledger.")
+	itemsGranted       = metrics.NewCounter("hero_items_granted_total", "Items given by gms and the admin api.")
+	movementViolations = metrics.NewCounter("hero_movement_violations_total", "Moves rejected by the movement checks, by reason.", "reason")
+	queryDuration      = metrics.NewHistogram("hero_db_query_duration_seconds", "Duration of the database queries by statement.", metrics.DURATION_BUCKETS, "statement")
+
+	_ = metrics.NewGaugeFunc("hero_sockets", "Connected sockets.", nil, func(set func(float64, ...string)) {
+		socketMutex.RLock()
+		defer socketMutex.RUnlock()
+		set(float64(len(Sockets)))
+	})
+
+	_ = metrics.NewGaugeFunc("hero_online_characters", "Online characters by server and map.", []string{"server", "map"}, func(set func(float64, ...string)) {
+		characters, err := FindOnlineCharacters()
+		if err != nil {
+			return
+		}
+
+		counts := make(map[[2]int]int)
+		for _, c := range characters {
+			if s := c.Socket; s != nil && s.User != nil {
+				counts[[2]int{s.User.ConnectedServer, int(c.Map)}]++
+			}
+		}
+		for k, n := range counts {
+			set(float64(n), strconv.Itoa(k[0]), strconv.Itoa(k[1]))
+		}
+	})
+
+	_ = metrics.NewGaugeFunc("hero_ais_alive", "Living AIs by server and map.", []string{"server", "map"}, func(set func(float64, ...string)) {
+		counts := make(map[[2]int]int)
+		AIMutex.RLock()
+		for _, ai := range AIs {
+			if !ai.IsDead {
+				counts[[2]int{ai.Server, int(ai.Map)}]++
+			}
+		}
+		AIMutex.RUnlock()
+
+		for k, n := range counts {
+			set(float64(n), strconv.Itoa(k[0]), strconv.Itoa(k[1]))
+		}
+	})
+)
+
+// timedConnector wraps the connections of a driver to observe the duration
+// of every query in queryDuration.
+type timedConnector struct {
+	driver.Connector
+}
+
+type timedConn struct {
+	driver.Conn
+}
+
+func (c timedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn}, nil
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	defer observeQuery(query, time.Now())
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	defer observeQuery(query, time.Now())
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// observeQuery observes a query by its first word, so the label stays one of
+// select, insert, update, delete or other.
+func observeQuery(query string, start time.Time) {
+	word := strings.TrimLeft(query, " \t\n")
+	if i := strings.IndexAny(word, " \t\n"); i >= 0 {
+		word = word[:i]
+	}
+
+	statement := "other"
+	switch word = strings.ToLower(word); word {
+	case "select", "insert", "update", "delete":
+		statement = word
+	}
+	queryDuration.Observe(time.Since(start).Seconds(), statement)
+}
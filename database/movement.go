@@ -0,0 +1,263 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"hero-server/config"
+	"hero-server/logging"
+	"hero-server/utils"
+)
+
+// Reasons of the movement violations.
+const (
+	VIOLATION_SPEED    = "speed"    // moved further than the running speed allows
+	VIOLATION_TELEPORT = "teleport" // started far away from the known position
+	VIOLATION_BOUNDS   = "bounds"   // left the map or moved through cells that can't be walked on
+)
+
+// MapBound is the area of a map in data.map_bounds, moves out of it are
+// violations. Maps without bounds are not checked.
+type MapBound struct {
+	MapID int16   `db:"map_id" json:"map_id"`
+	MinX  float64 `db:"min_x" json:"min_x"`
+	MinY  float64 `db:"min_y" json:"min_y"`
+	MaxX  float64 `db:"max_x" json:"max_x"`
+	MaxY  float64 `db:"max_y" json:"max_y"`
+}
+
+// Suspicion is the movement suspicion of a character, kept in memory so
+// logging out does not clear it.
+type Suspicion struct {
+	CharacterID int       `json:"character_id"`
+	Name        string    `json:"name"`
+	Score       float64   `json:"score"`
+	Violations  int       `json:"violations"`
+	Reason      string    `json:"reason"` // of the last violation
+	LastAt      time.Time `json:"last_at"`
+}
+
+var (
+	MapBounds      = make(map[int16]*MapBound)
+	mapBoundsMutex sync.RWMutex
+
+	// VIOLATION_SCORES is the suspicion a violation adds.
+	VIOLATION_SCORES = map[string]float64{VIOLATION_SPEED: 5, VIOLATION_TELEPORT: 20, VIOLATION_BOUNDS: 20}
+
+	// MAX_SUSPICIONS is how many characters are kept suspected, the ones
+	// suspected the longest ago are forgotten first.
+	MAX_SUSPICIONS = 10000
+
+	suspicions      = make(map[int]*Suspicion)
+	suspicionsMutex sync.Mutex
+)
+
+func FindMapBound(id int16) *MapBound {
+	mapBoundsMutex.RLock()
+	defer mapBoundsMutex.RUnlock()
+	return MapBounds[id]
+}
+
+func readMapBounds() (map[int16]*MapBound, error) {
+	var bounds []*MapBound
+	query := `select * from data.map_bounds`
+
+	if _, err := db.Select(&bounds, query); err != nil {
+		return nil, fmt.Errorf("readMapBounds: %s", err.Error())
+	}
+
+	m := make(map[int16]*MapBound, len(bounds))
+	for _, b := range bounds {
+		m[b.MapID] = b
+	}
+	return m, nil
+}
+
+func validateMapBounds(v interface{}) []error {
+	bounds := v.(map[int16]*MapBound)
+
+	var errs []error
+	for _, id := range sortedIntKeys(bounds) {
+		if b := bounds[int16(id)]; b.MinX >= b.MaxX || b.MinY >= b.MaxY {
+			errs = append(errs, fmt.Errorf("map %d: empty bounds", id))
+		}
+	}
+	return errs
+}
+
+// Contains tells if the point is in the bounds.
+func (b *MapBound) Contains(loc *utils.Location) bool {
+	return loc.X >= b.MinX && loc.X <= b.MaxX && loc.Y >= b.MinY && loc.Y <= b.MaxY
+}
+
+// walkable tells if a point of the map can be walked on.
+func walkable(mapID int16, loc *utils.Location) bool {
+	if b := FindMapBound(mapID); b != nil && !b.Contains(loc) {
+		return false
+	}
+	if g := navGrid(mapID); g != nil {
+		return g.Walkable(loc.X, loc.Y)
+	}
+	return true
+}
+
+// placeAt keeps the position the server put c at, placed when it was
+// teleported rather than walked there.
+func (c *Character) placeAt(coordinate *utils.Location, placed bool) {
+	c.moveMutex.Lock()
+	defer c.moveMutex.Unlock()
+
+	now := time.Now()
+	if placed {
+		c.movedFrom, c.placedAt = c.movedTo, now
+	}
+	c.movedTo, c.movedAt = *coordinate, now
+}
+
+// maxSpeed is the fastest c can move.
+func (c *Character) maxSpeed() float64 {
+	if speed := c.RunningSpeed + c.AdditionalRunningSpeed; speed > 5.6 {
+		return speed
+	}
+	return 5.6
+}
+
+// CheckMove checks a move of c from where the client says c stands to the
+// target against the position the server knows. A rejected move returns
+// the position c is put back to.
+func (c *Character) CheckMove(from, to *utils.Location) (*utils.Location, bool) {
+	cfg := config.Default.Movement
+	if !cfg.Enabled {
+		return nil, true
+	}
+
+	c.moveMutex.Lock()
+	known, before, movedAt, placedAt := c.movedTo, c.movedFrom, c.movedAt, c.placedAt
+	c.moveMutex.Unlock()
+
+	if movedAt.IsZero() { // not placed since the login
+		known = *ConvertPointToLocation(c.Coordinate)
+	} else {
+		now := time.Now()
+		allowed := c.maxSpeed()*cfg.Tolerance*now.Sub(movedAt).Seconds() + cfg.Slack
+
+		distance := utils.CalculateDistance(&known, from)
+		if now.Sub(placedAt) < time.Duration(cfg.Grace)*time.Millisecond { // moves sent before the teleport arrived
+			if d := utils.CalculateDistance(&before, from); d < distance {
+				distance = d
+			}
+		}
+
+		if distance > allowed*3 {
+			c.suspect(VIOLATION_TELEPORT, fmt.Sprintf("moved %.1f from %s in %s, %.1f allowed", distance, c.Coordinate, now.Sub(movedAt), allowed))
+			return &known, false
+		} else if distance > allowed {
+			c.suspect(VIOLATION_SPEED, fmt.Sprintf("moved %.1f from %s in %s, %.1f allowed", distance, c.Coordinate, now.Sub(movedAt), allowed))
+			return &known, false
+		}
+	}
+
+	if !walkable(c.Map, from) {
+		c.suspect(VIOLATION_BOUNDS, fmt.Sprintf("stood at (%.1f,%.1f) of map %d", from.X, from.Y, c.Map))
+		return &known, false
+	} else if !walkable(c.Map, to) || !walkableLine(c.Map, from, to) {
+		c.suspect(VIOLATION_BOUNDS, fmt.Sprintf("moved from (%.1f,%.1f) to (%.1f,%.1f) of map %d", from.X, from.Y, to.X, to.Y, c.Map))
+		return from, false
+	}
+	return nil, true
+}
+
+// decay forgives the suspicion of the time since the last violation.
+func (s *Suspicion) decay(now time.Time, perMinute float64) {
+	if s.Score -= perMinute * now.Sub(s.LastAt).Minutes(); s.Score < 0 {
+		s.Score = 0
+	}
+	s.LastAt = now
+}
+
+// suspect records a violation of c, c is disconnected when its suspicion
+// reaches the kick score.
+func (c *Character) suspect(reason, message string) {
+	cfg := config.Default.Movement
+	now := time.Now()
+
+	suspicionsMutex.Lock()
+	s := suspicions[c.ID]
+	if s == nil {
+		pruneSuspicions(now, MAX_SUSPICIONS-1)
+		s = &Suspicion{CharacterID: c.ID, Name: c.Name, LastAt: now}
+		suspicions[c.ID] = s
+	}
+	s.decay(now, cfg.Decay)
+	s.Score += VIOLATION_SCORES[reason]
+	s.Violations++
+	s.Reason = reason
+	kick := cfg.KickScore > 0 && s.Score >= cfg.KickScore
+	suspicionsMutex.Unlock()
+
+	movementViolations.Add(1, reason)
+	logging.Emit(c.Event(logging.ACTION_MOVEMENT_VIOLATION, reason+": "+message))
+
+	if kick && c.Socket != nil && c.Socket.Conn != nil {
+		c.Socket.Conn.Close()
+	}
+}
+
+// pruneSuspicions forgets the characters whose suspicion decayed to 0, then
+// the ones suspected the longest ago until at most max are left. The
+// suspicions mutex is held.
+func pruneSuspicions(now time.Time, max int) {
+	for id, s := range suspicions {
+		current := *s
+		if current.decay(now, config.Default.Movement.Decay); current.Score <= 0 {
+			delete(suspicions, id)
+		}
+	}
+	if len(suspicions) <= max {
+		return
+	}
+
+	list := make([]*Suspicion, 0, len(suspicions))
+	for _, s := range suspicions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastAt.Before(list[j].LastAt)
+	})
+	for _, s := range list[:len(list)-max] {
+		delete(suspicions, s.CharacterID)
+	}
+}
+
+// Suspicions returns the suspicion of the characters, the most suspicious
+// first.
+func Suspicions() []*Suspicion {
+	suspicionsMutex.Lock()
+	defer suspicionsMutex.Unlock()
+
+	now := time.Now()
+	pruneSuspicions(now, MAX_SUSPICIONS)
+	list := make([]*Suspicion, 0, len(suspicions))
+	for _, s := range suspicions {
+		current := *s
+		current.decay(now, config.Default.Movement.Decay)
+		current.LastAt = s.LastAt
+		list = append(list, &current)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	return list
+}
+
+// FindSuspicion returns the suspicion of a character, nil when it has none.
+func FindSuspicion(characterID int) *Suspicion {
+	for _, s := range Suspicions() {
+		if s.CharacterID == characterID {
+			return s
+		}
+	}
+	return nil
+}
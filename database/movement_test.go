@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneSuspicions(t *testing.T) {
+	now := time.Now()
+	suspicionsMutex.Lock()
+	saved := suspicions
+	suspicions = map[int]*Suspicion{
+		1: {CharacterID: 1, Score: 5, LastAt: now.Add(-time.Hour)}, // decayed
+		2: {CharacterID: 2, Score: 50, LastAt: now.Add(-time.Minute)},
+		3: {CharacterID: 3, Score: 50, LastAt: now},
+	}
+	defer func() { suspicions = saved; suspicionsMutex.Unlock() }()
+
+	if pruneSuspicions(now, 2); len(suspicions) != 2 || suspicions[1] != nil {
+		t.Fatalf("decayed suspicion kept: %v", suspicions)
+	}
+	if pruneSuspicions(now, 1); len(suspicions) != 1 || suspicions[3] == nil {
+		t.Errorf("latest suspicion not kept: %v", suspicions)
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"hero-server/nav"
+	"hero-server/utils"
+)
+
+// NavGrid is the walkability grid of a map in data.nav_grids, see nav.Grid
+// for the cells. Mobs and pets walk around the cells that are blocked and
+// player moves through them are violations.
+type NavGrid struct {
+	MapID    int16   `db:"map_id" json:"map_id"`
+	MinX     float64 `db:"min_x" json:"min_x"`
+	MinY     float64 `db:"min_y" json:"min_y"`
+	CellSize float64 `db:"cell_size" json:"cell_size"`
+	Width    int     `db:"width" json:"width"`
+	Height   int     `db:"height" json:"height"`
+	Cells    []byte  `db:"cells" json:"cells"`
+
+	grid    *nav.Grid `db:"-"`
+	problem error     `db:"-"`
+}
+
+var (
+	NavGrids      = make(map[int16]*NavGrid)
+	navGridsMutex sync.RWMutex
+)
+
+func FindNavGrid(id int16) *NavGrid {
+	navGridsMutex.RLock()
+	defer navGridsMutex.RUnlock()
+	return NavGrids[id]
+}
+
+func readNavGrids() (map[int16]*NavGrid, error) {
+	var grids []*NavGrid
+	query := `select * from data.nav_grids`
+
+	if _, err := db.Select(&grids, query); err != nil {
+		return nil, fmt.Errorf("readNavGrids: %s", err.Error())
+	}
+
+	m := make(map[int16]*NavGrid, len(grids))
+	for _, g := range grids {
+		g.grid, g.problem = nav.NewGrid(g.MinX, g.MinY, g.CellSize, g.Width, g.Height, g.Cells)
+		m[g.MapID] = g
+	}
+	return m, nil
+}
+
+func validateNavGrids(v interface{}) []error {
+	grids := v.(map[int16]*NavGrid)
+
+	var errs []error
+	for _, id := range sortedIntKeys(grids) {
+		if g := grids[int16(id)]; g.problem != nil {
+			errs = append(errs, fmt.Errorf("map %d: %s", id, g.problem.Error()))
+		}
+	}
+	return errs
+}
+
+// navGrid returns the grid of a map, nil when the map has none.
+func navGrid(mapID int16) *nav.Grid {
+	if g := FindNavGrid(mapID); g != nil {
+		return g.grid
+	}
+	return nil
+}
+
+// FindPath returns the points to walk through on a map to the target, the
+// target alone on maps without a grid and nil when it can't be reached.
+func FindPath(mapID int16, from, to *utils.Location) []utils.Location {
+	g := navGrid(mapID)
+	if g == nil {
+		return []utils.Location{*to}
+	}
+	return g.FindPath(from, to)
+}
+
+// walkableLine tells if the straight line between two points of a map can
+// be walked.
+func walkableLine(mapID int16, from, to *utils.Location) bool {
+	if g := navGrid(mapID); g != nil {
+		return g.Clear(from, to)
+	}
+	return true
+}
+
+// GeneratePoint returns a point 2 away from location in a random direction
+// that can be walked to on the map, location when there is none.
+func GeneratePoint(mapID int16, location *utils.Location) utils.Location {
+
+	r := 2.0
+	alfa := utils.RandFloat(0, 360)
+	for i := 0; i < 8; i++ {
+		angle := (alfa + float64(i)*45) * math.Pi / 180
+		target := utils.Location{X: location.X + r*math.Cos(angle), Y: location.Y + r*math.Sin(angle)}
+		if walkable(mapID, &target) && walkableLine(mapID, location, &target) {
+			return target
+		}
+	}
+
+	return *location
+}
+
+// randomPoint returns a point of the area that can be walked on, the last
+// one tried when none of a few can.
+func randomPoint(mapID int16, min, max *utils.Location) utils.Location {
+	var target utils.Location
+	for i := 0; i < 5; i++ {
+		target = utils.Location{X: utils.RandFloat(min.X, max.X), Y: utils.RandFloat(min.Y, max.Y)}
+		if walkable(mapID, &target) {
+			break
+		}
+	}
+	return target
+}
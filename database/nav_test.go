@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+
+	"hero-server/nav"
+	"hero-server/utils"
+)
+
+func TestNavGrids(t *testing.T) {
+	// 8x8 cells of 2, the column of x 6 to 8 is blocked below y 12
+	cells := make([]byte, 8)
+	for y := 0; y < 8; y++ {
+		cells[y] = 0xFF
+		if y < 6 {
+			cells[y] &^= 1 << 3
+		}
+	}
+	grid, err := nav.NewGrid(0, 0, 2, 8, 8, cells)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grids := NavGrids
+	NavGrids = map[int16]*NavGrid{1: {MapID: 1, grid: grid}}
+	defer func() { NavGrids = grids }()
+
+	from, to := &utils.Location{X: 1, Y: 1}, &utils.Location{X: 13, Y: 1}
+	if path := FindPath(1, from, to); len(path) < 2 || path[len(path)-1] != *to {
+		t.Fatalf("path around the wall: %v", path)
+	}
+	if path := FindPath(3, from, to); len(path) != 1 {
+		t.Errorf("map without a grid: %v", path)
+	}
+	if walkable(1, &utils.Location{X: 7, Y: 3}) || walkableLine(1, from, to) || !walkable(1, &utils.Location{X: 7, Y: 15}) {
+		t.Error("walkability of the wall")
+	}
+
+	for i := 0; i < 20; i++ {
+		at := &utils.Location{X: 5, Y: 5}
+		if p := GeneratePoint(1, at); !walkable(1, &p) || !walkableLine(1, at, &p) {
+			t.Fatalf("generated point %v behind the wall", p)
+		}
+	}
+
+	NavGrids[2] = &NavGrid{MapID: 2, Width: 8, Height: 8, CellSize: 2}
+	NavGrids[2].grid, NavGrids[2].problem = nav.NewGrid(0, 0, 2, 8, 8, cells[:2])
+	if errs := validateNavGrids(NavGrids); len(errs) != 1 {
+		t.Errorf("got %d problems, want 1: %v", len(errs), errs)
+	}
+}
@@ -1,8 +1,8 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -13,9 +13,16 @@ type NPCScript struct {
 }
 
 var (
-	NPCScripts = make(map[int]*NPCScript)
+	NPCScripts      = make(map[int]*NPCScript)
+	npcScriptsMutex sync.RWMutex
 )
 
+func FindNPCScript(id int) *NPCScript {
+	npcScriptsMutex.RLock()
+	defer npcScriptsMutex.RUnlock()
+	return NPCScripts[id]
+}
+
 func (e *NPCScript) Create() error {
 	return db.Insert(e)
 }
@@ -34,20 +41,17 @@ func (e *NPCScript) Delete() error {
 	return err
 }
 
-func getScripts() error {
+func readScripts() (map[int]*NPCScript, error) {
 	var scripts []*NPCScript
 	query := `select * from data.npc_scripts`
 
 	if _, err := db.Select(&scripts, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getScripts: %s", err.Error())
+		return nil, fmt.Errorf("readScripts: %s", err.Error())
 	}
 
+	m := make(map[int]*NPCScript, len(scripts))
 	for _, s := range scripts {
-		NPCScripts[s.ID] = s
+		m[s.ID] = s
 	}
-
-	return nil
+	return m, nil
 }
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Steps of the npc action scripts. The check steps stop the script when the
+// character doesn't meet them, the others are applied in order.
+const (
+	ACTION_LEVEL   = "level"   // min_level to max_level
+	ACTION_CLASS   = "class"   // one of the classes
+	ACTION_TYPE    = "type"    // one of the character types
+	ACTION_FACTION = "faction" // of the faction
+	ACTION_MAP     = "map"     // on the map
+	ACTION_GOLD    = "gold"    // has the gold
+	ACTION_ITEM    = "item"    // has quantity of the item
+	ACTION_PARTY   = "party"   // leads a party of at most quantity members
+	ACTION_QUEST   = "quest"   // on the quest
+
+	ACTION_TAKE_GOLD      = "take_gold"
+	ACTION_TAKE_ITEM      = "take_item"
+	ACTION_GIVE_ITEM      = "give_item"
+	ACTION_TELEPORT       = "teleport" // to x, y of map, or of the current map
+	ACTION_OPEN_SHOP      = "open_shop"
+	ACTION_SET_JOB        = "set_job"
+	ACTION_START_DUNGEON  = "start_dungeon"
+	ACTION_ACCEPT_QUEST   = "accept_quest"
+	ACTION_COMPLETE_QUEST = "complete_quest"
+	ACTION_TEXT           = "text" // npc text
+	ACTION_MESSAGE        = "message"
+)
+
+// NPCAction is the script of an npc button, a list of typed steps stored as
+// json in data.npc_actions. The actions of npc 0 are used by every npc that
+// has none of its own.
+type NPCAction struct {
+	NPCID    int           `db:"npc_id" json:"npc_id"`
+	ActionID int           `db:"action_id" json:"action_id"`
+	Script   []byte        `db:"steps" json:"-"`
+	Steps    []*ActionStep `db:"-" json:"steps"`
+	problem  error
+}
+
+// ActionStep is a step of an npc action. Text or Message is shown when a
+// check fails; Party makes level and item steps count for every member.
+type ActionStep struct {
+	Op       string  `json:"op"`
+	MinLevel int     `json:"min_level,omitempty"`
+	MaxLevel int     `json:"max_level,omitempty"`
+	Classes  []int   `json:"classes,omitempty"`
+	Types    []int   `json:"types,omitempty"`
+	Faction  int     `json:"faction,omitempty"`
+	Gold     uint64  `json:"gold,omitempty"`
+	ItemID   int64   `json:"item,omitempty"`
+	Quantity uint    `json:"quantity,omitempty"`
+	Map      int16   `json:"map,omitempty"`
+	X        float64 `json:"x,omitempty"`
+	Y        float64 `json:"y,omitempty"`
+	Shop     int     `json:"shop,omitempty"`
+	Job      int     `json:"job,omitempty"`
+	Dungeon  string  `json:"dungeon,omitempty"`
+	Quest    int     `json:"quest,omitempty"`
+	Party    bool    `json:"party,omitempty"`
+	Text     int     `json:"text,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+var (
+	// NPCActions are the scripted npc buttons by npc and action id.
+	NPCActions      = make(map[int]map[int]*NPCAction)
+	npcActionsMutex sync.RWMutex
+)
+
+// FindNPCAction returns the script of the button of an npc, or nil when the
+// button is not scripted.
+func FindNPCAction(npcID, actionID int) *NPCAction {
+	npcActionsMutex.RLock()
+	defer npcActionsMutex.RUnlock()
+
+	if a := NPCActions[npcID][actionID]; a != nil {
+		return a
+	}
+	return NPCActions[0][actionID]
+}
+
+func readNPCActions() (map[int]map[int]*NPCAction, error) {
+	var actions []*NPCAction
+	query := `select * from data.npc_actions`
+
+	if _, err := db.Select(&actions, query); err != nil {
+		return nil, fmt.Errorf("readNPCActions: %s", err.Error())
+	}
+
+	m := make(map[int]map[int]*NPCAction)
+	for _, a := range actions {
+		a.parse()
+		if m[a.NPCID] == nil {
+			m[a.NPCID] = make(map[int]*NPCAction)
+		}
+		m[a.NPCID][a.ActionID] = a
+	}
+	return m, nil
+}
+
+// parse reads the steps of the script, a script that can't be read is a
+// problem of the table.
+func (a *NPCAction) parse() {
+	a.Steps, a.problem = nil, nil
+	if err := json.Unmarshal(a.Script, &a.Steps); err != nil {
+		a.problem = err
+	}
+}
+
+func validateNPCActions(v interface{}) []error {
+	actions := v.(map[int]map[int]*NPCAction)
+
+	var errs []error
+	for _, npcID := range sortedIntKeys(actions) {
+		for _, actionID := range sortedIntKeys(actions[npcID]) {
+			a := actions[npcID][actionID]
+			if a.problem != nil {
+				errs = append(errs, fmt.Errorf("npc %d action %d: %s", npcID, actionID, a.problem.Error()))
+				continue
+			}
+			if len(a.Steps) == 0 {
+				errs = append(errs, fmt.Errorf("npc %d action %d: no steps", npcID, actionID))
+			}
+			for i, s := range a.Steps {
+				if err := s.validate(); err != nil {
+					errs = append(errs, fmt.Errorf("npc %d action %d step %d: %s", npcID, actionID, i+1, err.Error()))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (s *ActionStep) validate() error {
+	switch s.Op {
+	case ACTION_LEVEL:
+		if s.MinLevel <= 0 && s.MaxLevel <= 0 {
+			return fmt.Errorf("level without min_level or max_level")
+		}
+	case ACTION_CLASS:
+		if len(s.Classes) == 0 {
+			return fmt.Errorf("class without classes")
+		}
+	case ACTION_TYPE:
+		if len(s.Types) == 0 {
+			return fmt.Errorf("type without types")
+		}
+	case ACTION_FACTION, ACTION_PARTY, ACTION_TEXT, ACTION_MESSAGE:
+	case ACTION_MAP:
+		if s.Map <= 0 {
+			return fmt.Errorf("map without map")
+		}
+	case ACTION_GOLD, ACTION_TAKE_GOLD:
+		if s.Gold == 0 {
+			return fmt.Errorf("%s without gold", s.Op)
+		}
+	case ACTION_ITEM, ACTION_TAKE_ITEM, ACTION_GIVE_ITEM:
+		if !itemExists(int(s.ItemID)) {
+			return fmt.Errorf("%s of unknown item %d", s.Op, s.ItemID)
+		}
+	case ACTION_TELEPORT:
+		if s.Map <= 0 && s.X == 0 && s.Y == 0 {
+			return fmt.Errorf("teleport without map or coordinate")
+		}
+	case ACTION_OPEN_SHOP:
+		if s.Shop <= 0 {
+			return fmt.Errorf("open_shop without shop")
+		}
+	case ACTION_SET_JOB:
+		if s.Job <= 0 {
+			return fmt.Errorf("set_job without job")
+		}
+	case ACTION_START_DUNGEON:
+		if s.Dungeon == "" {
+			return fmt.Errorf("start_dungeon without dungeon")
+		}
+	case ACTION_QUEST, ACTION_ACCEPT_QUEST, ACTION_COMPLETE_QUEST:
+		if s.Quest <= 0 {
+			return fmt.Errorf("%s without quest", s.Op)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", s.Op)
+	}
+	return nil
+}
+
+// Count is the quantity of an item step, 1 when it is not set.
+func (s *ActionStep) Count() uint {
+	if s.Quantity == 0 {
+		return 1
+	}
+	return s.Quantity
+}
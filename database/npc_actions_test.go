@@ -0,0 +1,46 @@
+package database
+
+import "testing"
+
+func TestNPCActions(t *testing.T) {
+	items := Items
+	Items = map[int64]*Item{16210003: {ID: 16210003}}
+	defer func() { Items = items }()
+
+	action := func(npcID, actionID int, steps string) *NPCAction {
+		a := &NPCAction{NPCID: npcID, ActionID: actionID, Script: []byte(steps)}
+		a.parse()
+		return a
+	}
+
+	promotion := action(20006, 13, `[{"op":"class","classes":[0]},{"op":"level","min_level":10},
+		{"op":"set_job","job":13},{"op":"give_item","item":16210003}]`)
+	move := action(0, 77, `[{"op":"teleport","map":7}]`)
+	shop := action(20002, 1, `[{"op":"open_shop","shop":7}]`)
+	actions := map[int]map[int]*NPCAction{0: {77: move}, 20002: {1: shop}, 20006: {13: promotion}}
+
+	if errs := validateNPCActions(actions); len(errs) != 0 {
+		t.Fatalf("valid actions: %v", errs)
+	}
+	if promotion.Steps[1].MinLevel != 10 || promotion.Steps[3].Count() != 1 {
+		t.Fatalf("steps: %+v %+v", promotion.Steps[1], promotion.Steps[3])
+	}
+
+	old := NPCActions
+	NPCActions = actions
+	defer func() { NPCActions = old }()
+
+	if FindNPCAction(20006, 13) != promotion || FindNPCAction(20006, 77) != move || FindNPCAction(20006, 1) != nil {
+		t.Fatal("npc actions or the actions of every npc were not found")
+	}
+
+	bad := map[int]map[int]*NPCAction{20006: {
+		1: action(20006, 1, `[{"op":"give_item","item":1},{"op":"fly"},{"op":"open_shop"}]`),
+		2: action(20006, 2, `{"op":"text"}`),
+		3: action(20006, 3, `[]`),
+	}}
+	// unknown item, unknown op, shop missing, not a list and no steps
+	if errs := validateNPCActions(bad); len(errs) != 5 {
+		t.Fatalf("got %d problems, want 5: %v", len(errs), errs)
+	}
+}
@@ -10,9 +10,7 @@ import (
 )
 
 var (
-	NPCs   map[int]*NPC
-	bosses = []int{9999991, 9999992, 9999993, 9999994, 9999995, 9999996, 9999997, 9999998, 41941, 41171, 41371, 41381, 41671, 41851, 41852, 41853, 42451, 42452, 42561, 42562} /*40951, 41171, 41371, 41381, 41671, 41851, 41852, 41853, 41941, 42451, 42452, 42561, 42562,
-	420108, 430108*/
+	NPCs map[int]*NPC
 )
 
 type NPC struct {
@@ -63,6 +63,17 @@ func (p *Party) GetMembers() []*PartyMember {
 	return funk.Values(p.Members).([]*PartyMember)
 }
 
+// Characters returns the leader and the accepted members of the party.
+func (p *Party) Characters() []*Character {
+	list := []*Character{p.Leader}
+	for _, m := range p.GetMembers() {
+		if m.Accepted && m.Character.ID != p.Leader.ID {
+			list = append(list, m.Character)
+		}
+	}
+	return list
+}
+
 func (p *Party) RemoveMember(m *PartyMember) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"crypto/subtle"
+	"strings"
+	"sync"
+
+	"hero-server/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// IsHashedPassword reports whether p is a bcrypt hash. Older rows store the
+// client digest as it was sent.
+func IsHashedPassword(p string) bool {
+	return strings.HasPrefix(p, "$2")
+}
+
+// SetPassword stores a bcrypt hash (with its own random salt) of the digest
+// the client sends.
+func (u *User) SetPassword(digest string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(digest), config.Default.Auth.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	u.Password = string(hash)
+	return nil
+}
+
+// CheckPassword compares the client digest with the stored password. A
+// matching legacy row is rehashed in place, the caller saves the user.
+func (u *User) CheckPassword(digest string) bool {
+	if IsHashedPassword(u.Password) {
+		return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(digest)) == nil
+	}
+
+	// spend the same time as a bcrypt comparison
+	CheckDummyPassword(digest)
+	if subtle.ConstantTimeCompare([]byte(u.Password), []byte(digest)) != 1 {
+		return false
+	}
+
+	u.SetPassword(digest) // on error the digest stays and is upgraded next time
+	return true
+}
+
+// CheckDummyPassword runs a bcrypt comparison that always fails, so a login
+// with an unknown user name takes as long as one with a wrong password.
+func CheckDummyPassword(digest string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), config.Default.Auth.BcryptCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(digest))
+}
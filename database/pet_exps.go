@@ -1,16 +1,23 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
-	PetExps = make(map[int16]*PetExpInfo)
+	PetExps      = make(map[int16]*PetExpInfo)
+	petExpsMutex sync.RWMutex
 )
 
+func FindPetExp(id int16) *PetExpInfo {
+	petExpsMutex.RLock()
+	defer petExpsMutex.RUnlock()
+	return PetExps[id]
+}
+
 type PetExpInfo struct {
 	Level         int16 `db:"level"`
 	ReqExpEvo1    int   `db:"req_exp_evo1"`
@@ -40,21 +47,17 @@ func (p *PetExpInfo) Delete() error {
 	return err
 }
 
-func GetAllPetExps() error {
-
+func readPetExps() (map[int16]*PetExpInfo, error) {
 	var arr []*PetExpInfo
 	query := `select * from "data".pet_exp_table`
 
 	if _, err := db.Select(&arr, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("GetAllPetExps: %s", err.Error())
+		return nil, fmt.Errorf("readPetExps: %s", err.Error())
 	}
 
+	m := make(map[int16]*PetExpInfo, len(arr))
 	for _, petExp := range arr {
-		PetExps[petExp.Level] = petExp
+		m[petExp.Level] = petExp
 	}
-
-	return nil
+	return m, nil
 }
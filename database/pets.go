@@ -1,16 +1,23 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
-	Pets = make(map[int64]*Pet)
+	Pets      = make(map[int64]*Pet)
+	petsMutex sync.RWMutex
 )
 
+func FindPet(id int64) *Pet {
+	petsMutex.RLock()
+	defer petsMutex.RUnlock()
+	return Pets[id]
+}
+
 type Pet struct {
 	ID            int64  `db:"id"`
 	Name          string `db:"name"`
@@ -51,23 +58,19 @@ func (e *Pet) Delete() error {
 	return err
 }
 
-func GetAllPets() error {
-
+func readPets() (map[int64]*Pet, error) {
 	var arr []*Pet
 	query := `select * from "data".pets`
 
 	if _, err := db.Select(&arr, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("GetAllPets: %s", err.Error())
+		return nil, fmt.Errorf("readPets: %s", err.Error())
 	}
 
+	m := make(map[int64]*Pet, len(arr))
 	for _, pet := range arr {
-		Pets[pet.ID] = pet
+		m[pet.ID] = pet
 	}
-
-	return nil
+	return m, nil
 }
 
 func (e *Pet) GetSkills() int {
@@ -1,9 +1,9 @@
 package database
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
@@ -24,9 +24,16 @@ type ProductionMaterial struct {
 }
 
 var (
-	Productions = make(map[int]*Production)
+	Productions      = make(map[int]*Production)
+	productionsMutex sync.RWMutex
 )
 
+func FindProduction(id int) *Production {
+	productionsMutex.RLock()
+	defer productionsMutex.RUnlock()
+	return Productions[id]
+}
+
 func (e *Production) Create() error {
 	return db.Insert(e)
 }
@@ -53,20 +60,17 @@ func (e *Production) GetMaterials() ([]*ProductionMaterial, error) {
 	return e.materials, nil
 }
 
-func getProductions() error {
+func readProductions() (map[int]*Production, error) {
 	var prods []*Production
 	query := `select * from data.productions`
 
 	if _, err := db.Select(&prods, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getProductions: %s", err.Error())
+		return nil, fmt.Errorf("readProductions: %s", err.Error())
 	}
 
+	m := make(map[int]*Production, len(prods))
 	for _, p := range prods {
-		Productions[p.ID] = p
+		m[p.ID] = p
 	}
-
-	return nil
+	return m, nil
 }
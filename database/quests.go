@@ -0,0 +1,597 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hero-server/messaging"
+	"hero-server/utils"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Objectives of the quests, the target is an npc, item or map id.
+const (
+	QUEST_KILL    = "kill"    // kill count of the npc
+	QUEST_COLLECT = "collect" // have count of the item, taken at the turn in
+	QUEST_MAP     = "map"     // enter the map
+	QUEST_TALK    = "talk"    // talk to the npc
+)
+
+// Quest is a quest of data.quests with its objectives and rewards.
+type Quest struct {
+	ID         int               `db:"id" json:"id"`
+	Name       string            `db:"name" json:"name"`
+	MinLevel   int               `db:"min_level" json:"min_level"`
+	MaxLevel   int               `db:"max_level" json:"max_level"`
+	PreviousID int               `db:"previous_id" json:"previous_id"` // quest to complete first
+	Repeatable bool              `db:"repeatable" json:"repeatable"`
+	Exp        int64             `db:"exp" json:"exp"`
+	Gold       uint64            `db:"gold" json:"gold"`
+	Objectives []*QuestObjective `db:"-" json:"objectives"`
+	Rewards    []*QuestReward    `db:"-" json:"rewards"`
+}
+
+type QuestObjective struct {
+	ID      int    `db:"id" json:"id"`
+	QuestID int    `db:"quest_id" json:"quest_id"`
+	Kind    string `db:"kind" json:"kind"`
+	Target  int    `db:"target" json:"target"`
+	Count   int    `db:"count" json:"count"`
+}
+
+type QuestReward struct {
+	ID       int   `db:"id" json:"id"`
+	QuestID  int   `db:"quest_id" json:"quest_id"`
+	ItemID   int64 `db:"item_id" json:"item_id"`
+	Quantity uint  `db:"quantity" json:"quantity"`
+}
+
+// CharacterQuest is the progress of a character on a quest, the count of
+// every objective in order.
+type CharacterQuest struct {
+	ID          int       `db:"id" json:"id"`
+	CharacterID int       `db:"character_id" json:"character_id"`
+	QuestID     int       `db:"quest_id" json:"quest_id"`
+	Progress    string    `db:"progress" json:"progress"`
+	Completed   bool      `db:"completed" json:"completed"`
+	AcceptedAt  time.Time `db:"accepted_at" json:"accepted_at"`
+	CompletedAt null.Time `db:"completed_at" json:"completed_at"`
+
+	counts []int `db:"-"`
+}
+
+var (
+	Quests      = make(map[int]*Quest)
+	questsMutex sync.RWMutex
+)
+
+func FindQuest(id int) *Quest {
+	questsMutex.RLock()
+	defer questsMutex.RUnlock()
+	return Quests[id]
+}
+
+func init() {
+	CharacterHasQuest = func(c *Character, questID int) bool { return c.OnQuest(questID) }
+}
+
+func (q *CharacterQuest) Create() error {
+	return db.Insert(q)
+}
+
+func (q *CharacterQuest) Update() error {
+	_, err := db.Update(q)
+	return err
+}
+
+func readQuests() (map[int]*Quest, error) {
+	var quests []*Quest
+	if _, err := db.Select(&quests, `select * from data.quests`); err != nil {
+		return nil, fmt.Errorf("readQuests: %s", err.Error())
+	}
+
+	var objectives []*QuestObjective
+	if _, err := db.Select(&objectives, `select * from data.quest_objectives order by quest_id, id`); err != nil {
+		return nil, fmt.Errorf("readQuests: %s", err.Error())
+	}
+
+	var rewards []*QuestReward
+	if _, err := db.Select(&rewards, `select * from data.quest_rewards order by quest_id, id`); err != nil {
+		return nil, fmt.Errorf("readQuests: %s", err.Error())
+	}
+
+	return buildQuests(quests, objectives, rewards), nil
+}
+
+func buildQuests(quests []*Quest, objectives []*QuestObjective, rewards []*QuestReward) map[int]*Quest {
+	m := make(map[int]*Quest, len(quests))
+	for _, q := range quests {
+		m[q.ID] = q
+	}
+	for _, o := range objectives {
+		if q := m[o.QuestID]; q != nil {
+			q.Objectives = append(q.Objectives, o)
+		}
+	}
+	for _, r := range rewards {
+		if q := m[r.QuestID]; q != nil {
+			q.Rewards = append(q.Rewards, r)
+		}
+	}
+	return m
+}
+
+func validateQuests(v interface{}) []error {
+	quests := v.(map[int]*Quest)
+
+	var errs []error
+	for _, id := range sortedIntKeys(quests) {
+		q := quests[id]
+		if len(q.Objectives) == 0 {
+			errs = append(errs, fmt.Errorf("quest %d: no objectives", id))
+		}
+		if q.PreviousID > 0 && quests[q.PreviousID] == nil {
+			errs = append(errs, fmt.Errorf("quest %d: unknown previous quest %d", id, q.PreviousID))
+		}
+
+		for _, o := range q.Objectives {
+			switch {
+			case o.Kind != QUEST_KILL && o.Kind != QUEST_COLLECT && o.Kind != QUEST_MAP && o.Kind != QUEST_TALK:
+				errs = append(errs, fmt.Errorf("quest %d: unknown objective %q", id, o.Kind))
+			case o.Count <= 0:
+				errs = append(errs, fmt.Errorf("quest %d: %s objective without count", id, o.Kind))
+			case o.Kind == QUEST_COLLECT && !itemExists(o.Target):
+				errs = append(errs, fmt.Errorf("quest %d: collect of unknown item %d", id, o.Target))
+			}
+		}
+		for _, r := range q.Rewards {
+			if !itemExists(int(r.ItemID)) || r.Quantity == 0 {
+				errs = append(errs, fmt.Errorf("quest %d: reward of unknown item %d or no quantity", id, r.ItemID))
+			}
+		}
+	}
+	return errs
+}
+
+// FindCharacterQuests returns the quests a character accepted, done or not.
+func FindCharacterQuests(characterID int) ([]*CharacterQuest, error) {
+
+	var quests []*CharacterQuest
+	query := `select * from hops.characters_quests where character_id = $1`
+
+	if _, err := db.Select(&quests, query, characterID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("FindCharacterQuests: %s", err.Error())
+	}
+
+	return quests, nil
+}
+
+var (
+	// characterQuests caches the quests of the online characters, read on
+	// first use.
+	characterQuests      = make(map[int]*questSet)
+	characterQuestsMutex sync.Mutex
+)
+
+// questSet is the quests of a character by quest id. Accepting and turning
+// in a quest are written at once, the progress on the objectives by
+// SaveQuests, when every objective is done and on logout.
+type questSet struct {
+	quests map[int]*CharacterQuest
+	dirty  map[int]bool
+	mutex  sync.Mutex
+}
+
+// questsOf returns the quests of c, read when they aren't cached.
+func (c *Character) questsOf() (*questSet, error) {
+	characterQuestsMutex.Lock()
+	defer characterQuestsMutex.Unlock()
+
+	if set, ok := characterQuests[c.ID]; ok {
+		return set, nil
+	}
+
+	rows, err := FindCharacterQuests(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &questSet{quests: make(map[int]*CharacterQuest, len(rows)), dirty: make(map[int]bool)}
+	for _, q := range rows {
+		q.counts = parseCounts(q.Progress)
+		set.quests[q.QuestID] = q
+	}
+	characterQuests[c.ID] = set
+	return set, nil
+}
+
+// save writes the progress that changed. The set's mutex is held.
+func (set *questSet) save() error {
+	for id := range set.dirty {
+		if err := set.quests[id].Update(); err != nil {
+			return fmt.Errorf("saveQuests: %s", err.Error())
+		}
+		delete(set.dirty, id)
+	}
+	return nil
+}
+
+// SaveQuests writes the progress of the online characters that changed
+// since the last save.
+func SaveQuests() {
+	characterQuestsMutex.Lock()
+	sets := make([]*questSet, 0, len(characterQuests))
+	for _, set := range characterQuests {
+		sets = append(sets, set)
+	}
+	characterQuestsMutex.Unlock()
+
+	for _, set := range sets {
+		set.mutex.Lock()
+		if err := set.save(); err != nil {
+			log.Println(err)
+		}
+		set.mutex.Unlock()
+	}
+}
+
+// forgetQuests saves and drops the cached quests of c when it logs out.
+func (c *Character) forgetQuests() {
+	characterQuestsMutex.Lock()
+	set, ok := characterQuests[c.ID]
+	delete(characterQuests, c.ID)
+	characterQuestsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if err := set.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// CharacterQuests returns a copy of the quests of c.
+func (c *Character) CharacterQuests() ([]*CharacterQuest, error) {
+	set, err := c.questsOf()
+	if err != nil {
+		return nil, err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	list := make([]*CharacterQuest, 0, len(set.quests))
+	for _, id := range sortedIntKeys(set.quests) {
+		q := *set.quests[id]
+		list = append(list, &q)
+	}
+	return list, nil
+}
+
+// OnQuest tells if c accepted the quest and has not completed it yet.
+func (c *Character) OnQuest(questID int) bool {
+	set, err := c.questsOf()
+	if err != nil {
+		return false
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	q := set.quests[questID]
+	return q != nil && !q.Completed
+}
+
+// CanAcceptQuest returns why c can't accept the quest, or nil.
+func (c *Character) CanAcceptQuest(questID int) error {
+	set, err := c.questsOf()
+	if err != nil {
+		return err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return c.canAcceptQuest(set, questID)
+}
+
+func (c *Character) canAcceptQuest(set *questSet, questID int) error {
+	quest := FindQuest(questID)
+	if quest == nil {
+		return fmt.Errorf("This quest is not available.")
+	}
+
+	quests := set.quests
+	if c.Level < quest.MinLevel || (quest.MaxLevel > 0 && c.Level > quest.MaxLevel) {
+		return fmt.Errorf("Your level is not suitable for %s.", quest.Name)
+	} else if q := quests[questID]; q != nil && !q.Completed {
+		return fmt.Errorf("You are already on %s.", quest.Name)
+	} else if q != nil && !quest.Repeatable {
+		return fmt.Errorf("You already completed %s.", quest.Name)
+	} else if p := quests[quest.PreviousID]; quest.PreviousID > 0 && (p == nil || !p.Completed) {
+		if previous := FindQuest(quest.PreviousID); previous != nil {
+			return fmt.Errorf("You must complete %s first.", previous.Name)
+		}
+		return fmt.Errorf("This quest is not available.")
+	}
+	return nil
+}
+
+// AcceptQuest starts the quest for c, or starts it again when it is
+// repeatable.
+func (c *Character) AcceptQuest(questID int) ([]byte, error) {
+	set, err := c.questsOf()
+	if err != nil {
+		return nil, err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if err := c.canAcceptQuest(set, questID); err != nil {
+		return messaging.InfoMessage(err.Error()), nil
+	}
+
+	quest := FindQuest(questID)
+	q := set.quests[questID]
+	if q == nil {
+		q = &CharacterQuest{CharacterID: c.ID, QuestID: questID}
+	}
+	q.counts = make([]int, len(quest.Objectives))
+	q.Progress = formatCounts(q.counts)
+	q.Completed, q.AcceptedAt, q.CompletedAt = false, time.Now().UTC(), null.Time{}
+
+	if q.ID > 0 {
+		err = q.Update()
+	} else {
+		err = q.Create()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("AcceptQuest: %s", err.Error())
+	}
+	set.quests[questID] = q
+	delete(set.dirty, questID)
+
+	resp := utils.Packet{}
+	resp.Concat(messaging.InfoMessage(fmt.Sprintf("Quest accepted: %s.", quest.Name)))
+	for i, o := range quest.Objectives {
+		if o.Kind == QUEST_COLLECT {
+			resp.Concat(set.setCount(quest, q, i, c.itemCount(int64(o.Target))))
+		}
+	}
+	return resp, nil
+}
+
+// AdvanceQuests counts amount towards the objectives of kind and target of
+// the quests c is on and returns the progress messages.
+func (c *Character) AdvanceQuests(kind string, target, amount int) []byte {
+	if c == nil || amount <= 0 {
+		return nil
+	}
+
+	set, err := c.questsOf()
+	if err != nil {
+		return nil
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	resp := utils.Packet{}
+	for _, q := range set.quests {
+		quest := FindQuest(q.QuestID)
+		if q.Completed || quest == nil {
+			continue
+		}
+		q.fit(quest)
+
+		for i, o := range quest.Objectives {
+			if o.Kind == kind && o.Target == target && i < len(q.counts) && q.counts[i] < o.Count {
+				resp.Concat(set.setCount(quest, q, i, q.counts[i]+amount))
+			}
+		}
+	}
+	return resp
+}
+
+// setCount sets the count of an objective of q, saving the quests once
+// every objective is done. The set's mutex is held.
+func (set *questSet) setCount(quest *Quest, q *CharacterQuest, i, count int) []byte {
+	o := quest.Objectives[i]
+	if count > o.Count {
+		count = o.Count
+	}
+	if count == q.counts[i] {
+		return nil
+	}
+
+	q.counts[i] = count
+	q.Progress = formatCounts(q.counts)
+	set.dirty[q.QuestID] = true
+
+	if count == o.Count && questDone(quest, q) {
+		if err := set.save(); err != nil {
+			log.Println(err)
+		}
+		return messaging.InfoMessage(fmt.Sprintf("%s: all objectives are done.", quest.Name))
+	}
+	return messaging.InfoMessage(fmt.Sprintf("%s: %d/%d", quest.Name, count, o.Count))
+}
+
+// fit pads the counts of q when objectives were added to the quest since
+// it was accepted.
+func (q *CharacterQuest) fit(quest *Quest) {
+	for len(q.counts) < len(quest.Objectives) {
+		q.counts = append(q.counts, 0)
+	}
+}
+
+func questDone(quest *Quest, q *CharacterQuest) bool {
+	for i, o := range quest.Objectives {
+		if i >= len(q.counts) || q.counts[i] < o.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// CanCompleteQuest returns why c can't turn in the quest, or nil.
+func (c *Character) CanCompleteQuest(questID int) error {
+	set, err := c.questsOf()
+	if err != nil {
+		return err
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return c.canCompleteQuest(set, questID)
+}
+
+func (c *Character) canCompleteQuest(set *questSet, questID int) error {
+	quest := FindQuest(questID)
+	q := set.quests[questID]
+	if quest == nil || q == nil || q.Completed {
+		return fmt.Errorf("You are not on this quest.")
+	}
+
+	if q.fit(quest); !questDone(quest, q) {
+		return fmt.Errorf("You haven't done every objective of %s.", quest.Name)
+	}
+
+	for _, o := range quest.Objectives {
+		if o.Kind == QUEST_COLLECT && c.itemCount(int64(o.Target)) < o.Count {
+			return fmt.Errorf("You don't have the items of %s anymore.", quest.Name)
+		}
+	}
+	if len(quest.Rewards) > 0 {
+		if _, err := c.FindFreeSlots(len(quest.Rewards)); err != nil {
+			return fmt.Errorf("Your inventory is full.")
+		}
+	}
+	return nil
+}
+
+// CompleteQuest turns in the quest, takes the collected items and gives the
+// rewards.
+func (c *Character) CompleteQuest(questID int) ([]byte, error) {
+	set, err := c.questsOf()
+	if err != nil {
+		return nil, err
+	}
+
+	set.mutex.Lock()
+	if err := c.canCompleteQuest(set, questID); err != nil {
+		set.mutex.Unlock()
+		return messaging.InfoMessage(err.Error()), nil
+	}
+
+	quest := FindQuest(questID)
+	q := set.quests[questID]
+	q.Completed, q.CompletedAt = true, null.TimeFrom(time.Now().UTC())
+	if err := q.Update(); err != nil {
+		q.Completed, q.CompletedAt = false, null.Time{}
+		set.mutex.Unlock()
+		return nil, fmt.Errorf("CompleteQuest: %s", err.Error())
+	}
+	delete(set.dirty, questID)
+	set.mutex.Unlock() // AddItem counts collected items
+
+	resp := utils.Packet{}
+	for _, o := range quest.Objectives {
+		if o.Kind == QUEST_COLLECT {
+			resp.Concat(c.takeItems(int64(o.Target), o.Count, fmt.Sprintf("quest %d", questID)))
+		}
+	}
+
+	for _, r := range quest.Rewards {
+		data, _, err := c.AddItem(&InventorySlot{ItemID: r.ItemID, Quantity: r.Quantity}, -1, false)
+		if err != nil {
+			return resp, fmt.Errorf("CompleteQuest: %s", err.Error())
+		} else if data != nil {
+			resp.Concat(*data)
+		}
+	}
+
+	if quest.Exp > 0 {
+		data, levelUp := c.AddExp(quest.Exp)
+		if levelUp {
+			if stats, err := c.GetStats(); err == nil {
+				data = append(data, stats...)
+			}
+		}
+		resp.Concat(data)
+	}
+	if quest.Gold > 0 {
+		resp.Concat(c.LootGold(quest.Gold))
+		GoldCreated.Add(float64(quest.Gold), "quest")
+	}
+
+	resp.Concat(messaging.InfoMessage(fmt.Sprintf("Quest completed: %s.", quest.Name)))
+	return resp, nil
+}
+
+// itemCount is how many pieces of the item c has in the inventory.
+func (c *Character) itemCount(itemID int64) int {
+	slots, err := c.InventorySlots()
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for i, s := range slots {
+		if s.ItemID == itemID && (i < 0x43 || i > 0x132) {
+			count += int(s.Quantity)
+		}
+	}
+	return count
+}
+
+// takeItems takes count pieces of the item out of the stacks in the
+// inventory of c.
+func (c *Character) takeItems(itemID int64, count int, note string) []byte {
+	resp := utils.Packet{}
+	for count > 0 {
+		slotID, slot, err := c.FindItemInInventory(nil, itemID)
+		if err != nil || slot == nil {
+			break
+		}
+
+		n := count
+		if int(slot.Quantity) < n {
+			n = int(slot.Quantity)
+		}
+		data := c.consumeItem(slotID, uint(n), note)
+		if data == nil {
+			break
+		}
+		resp.Concat(*data)
+		count -= n
+	}
+	return resp
+}
+
+// parseCounts parses the {1,2} progress of a quest.
+func parseCounts(s string) []int {
+	counts, err := parseIDs(s)
+	if err != nil {
+		return nil
+	}
+	return counts
+}
+
+func formatCounts(counts []int) string {
+	parts := make([]string, len(counts))
+	for i, n := range counts {
+		parts[i] = strconv.Itoa(n)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
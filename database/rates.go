@@ -0,0 +1,65 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	expRate, dropRate   = DEFAULT_EXP_RATE, DEFAULT_DROP_RATE
+	expTimer, dropTimer *time.Timer
+	ratesMutex          sync.RWMutex
+)
+
+func ExpRate() float64 {
+	ratesMutex.RLock()
+	defer ratesMutex.RUnlock()
+	return expRate
+}
+
+func DropRate() float64 {
+	ratesMutex.RLock()
+	defer ratesMutex.RUnlock()
+	return dropRate
+}
+
+// SetRates changes the rates that are positive. With minutes set they go
+// back to the configured rates afterwards, unless they are changed again
+// in the meantime.
+func SetRates(exp, drop float64, minutes int64) {
+	ratesMutex.Lock()
+	defer ratesMutex.Unlock()
+
+	if exp > 0 {
+		expRate = exp
+		resetRate(&expTimer, minutes, &expRate, DEFAULT_EXP_RATE)
+	}
+	if drop > 0 {
+		dropRate = drop
+		resetRate(&dropTimer, minutes, &dropRate, DEFAULT_DROP_RATE)
+	}
+}
+
+// resetRate replaces the timer that sets the rate back to the default, the
+// rates mutex is held.
+func resetRate(timer **time.Timer, minutes int64, rate *float64, def float64) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if minutes <= 0 {
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(time.Duration(minutes)*time.Minute, func() {
+		ratesMutex.Lock()
+		defer ratesMutex.Unlock()
+
+		// unless a later change replaced the timer
+		if *timer == t {
+			*rate, *timer = def, nil
+		}
+	})
+	*timer = t
+}
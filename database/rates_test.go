@@ -0,0 +1,21 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestSetRates(t *testing.T) {
+	defer SetRates(DEFAULT_EXP_RATE, DEFAULT_DROP_RATE, 0)
+
+	SetRates(2, 0, 1)
+	timer := expTimer
+	SetRates(3, 4, 0)
+	if ExpRate() != 3 || DropRate() != 4 {
+		t.Fatalf("rates %v and %v", ExpRate(), DropRate())
+	}
+
+	// the timer of the first change no longer resets the rate
+	if timer.Stop() || expTimer != nil {
+		t.Error("timer of a replaced rate is running")
+	}
+}
@@ -69,7 +69,7 @@ func (s *Sale) SaleData() ([]byte, error) {
 		data.Insert([]byte{0x00}, index)
 		index++
 
-		info := Items[item.ItemID]
+		info := FindItem(item.ItemID)
 		itemtypeinfo := 0
 		if info == nil {
 			itemtypeinfo = 0
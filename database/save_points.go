@@ -1,10 +1,10 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"hero-server/utils"
 
@@ -12,9 +12,16 @@ import (
 )
 
 var (
-	SavePoints = make(map[uint8]*SavePoint)
+	SavePoints      = make(map[uint8]*SavePoint)
+	savePointsMutex sync.RWMutex
 )
 
+func FindSavePoint(id uint8) *SavePoint {
+	savePointsMutex.RLock()
+	defer savePointsMutex.RUnlock()
+	return SavePoints[id]
+}
+
 type SavePoint struct {
 	ID    uint8  `db:"id"`
 	Point string `db:"point"`
@@ -37,24 +44,19 @@ func (e *SavePoint) Delete() error {
 	return err
 }
 
-func getAllSavePoints() error {
-
+func readSavePoints() (map[uint8]*SavePoint, error) {
+	var t []*SavePoint
 	query := `select * from data.save_points`
 
-	t := []*SavePoint{}
-
 	if _, err := db.Select(&t, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getAllSavePoints: %s", err.Error())
+		return nil, fmt.Errorf("readSavePoints: %s", err.Error())
 	}
 
+	m := make(map[uint8]*SavePoint, len(t))
 	for _, s := range t {
-		SavePoints[s.ID] = s
+		m[s.ID] = s
 	}
-
-	return nil
+	return m, nil
 }
 
 func ConvertPointToLocation(point string) *utils.Location {
@@ -0,0 +1,323 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Kinds of the scheduled events.
+const (
+	EVENT_WAR          = "war"          // great war, divine when divine is set
+	EVENT_FACTION_WAR  = "faction_war"  // faction war of min_level to max_level
+	EVENT_LAST_MAN     = "last_man"     // last man standing
+	EVENT_GOLDEN_BASIN = "golden_basin" // golden basin war, for duration minutes, 0 until it is conquered
+	EVENT_GUILD_WAR    = "guild_war"    // guild war areas open for duration minutes, 0 until stopped
+)
+
+// ScheduledEvent is a recurring event of hops.scheduled_events. Cron is a
+// standard five field expression (or a descriptor like @daily) in the time
+// zone of the event. Countdown is the seconds to join a battleground before
+// it starts, the default of its kind when 0. When fewer than min_players
+// characters are online the run is skipped.
+type ScheduledEvent struct {
+	ID         int       `db:"id" json:"id"`
+	Name       string    `db:"name" json:"name"`
+	Kind       string    `db:"kind" json:"kind"`
+	Cron       string    `db:"cron" json:"cron"`
+	Timezone   string    `db:"timezone" json:"timezone"`
+	Divine     bool      `db:"divine" json:"divine"`
+	MinLevel   int64     `db:"min_level" json:"min_level"`
+	MaxLevel   int64     `db:"max_level" json:"max_level"`
+	MinPlayers int       `db:"min_players" json:"min_players"`
+	Countdown  int       `db:"countdown" json:"countdown"`
+	Duration   int       `db:"duration" json:"duration"`
+	Enabled    bool      `db:"enabled" json:"enabled"`
+	LastRun    null.Time `db:"last_run" json:"last_run"`
+	LastResult string    `db:"last_result" json:"last_result"`
+
+	schedule cron.Schedule  `db:"-"`
+	location *time.Location `db:"-"`
+	timer    *time.Timer    `db:"-"`
+}
+
+var (
+	scheduledEvents = make(map[int]*ScheduledEvent)
+	scheduleMutex   sync.Mutex
+)
+
+func (e *ScheduledEvent) Create() error {
+	return db.Insert(e)
+}
+
+func (e *ScheduledEvent) Update() error {
+	_, err := db.Update(e)
+	return err
+}
+
+func (e *ScheduledEvent) Delete() error {
+	_, err := db.Delete(e)
+	return err
+}
+
+// Parse checks the event and reads its cron expression and time zone.
+func (e *ScheduledEvent) Parse() error {
+	switch e.Kind {
+	case EVENT_WAR, EVENT_LAST_MAN, EVENT_GOLDEN_BASIN, EVENT_GUILD_WAR:
+	case EVENT_FACTION_WAR:
+		if e.MinLevel <= 0 || e.MaxLevel < e.MinLevel {
+			return fmt.Errorf("invalid level range %d-%d", e.MinLevel, e.MaxLevel)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", e.Kind)
+	}
+	if e.Countdown < 0 || e.Duration < 0 || e.MinPlayers < 0 {
+		return fmt.Errorf("negative countdown, duration or min players")
+	}
+
+	location, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return fmt.Errorf("timezone: %s", err.Error())
+	}
+	schedule, err := cron.ParseStandard(e.Cron)
+	if err != nil {
+		return fmt.Errorf("cron: %s", err.Error())
+	}
+
+	e.location, e.schedule = location, schedule
+	return nil
+}
+
+// NextRuns returns the next n times the event runs after from, in its time
+// zone, whether it is enabled or not.
+func (e *ScheduledEvent) NextRuns(from time.Time, n int) []time.Time {
+	if e.schedule == nil {
+		return nil
+	}
+
+	runs := make([]time.Time, 0, n)
+	at := from.In(e.location)
+	for i := 0; i < n; i++ {
+		if at = e.schedule.Next(at); at.IsZero() {
+			break
+		}
+		runs = append(runs, at)
+	}
+	return runs
+}
+
+// stop stops the timer of the next run, the schedule mutex is held.
+func (e *ScheduledEvent) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// arm starts the timer of the next run, the schedule mutex is held.
+func (e *ScheduledEvent) arm() {
+	e.stop()
+	if !e.Enabled || e.schedule == nil {
+		return
+	}
+
+	runs := e.NextRuns(time.Now(), 1)
+	if len(runs) == 0 {
+		return
+	}
+	e.timer = time.AfterFunc(time.Until(runs[0]), func() {
+		scheduleMutex.Lock()
+		current := scheduledEvents[e.ID] == e
+		scheduleMutex.Unlock()
+
+		// the event was changed or removed since
+		if !current {
+			return
+		}
+
+		e.record(e.start())
+
+		scheduleMutex.Lock()
+		defer scheduleMutex.Unlock()
+		if scheduledEvents[e.ID] == e {
+			e.arm()
+		}
+	})
+}
+
+// start starts the event unless it is running already or too few characters
+// are online, it returns the result of the run.
+func (e *ScheduledEvent) start() string {
+	if e.MinPlayers > 0 {
+		online, _ := FindOnlineCharacters()
+		if len(online) < e.MinPlayers {
+			return fmt.Sprintf("skipped, %d of %d players online", len(online), e.MinPlayers)
+		}
+	}
+
+	var err error
+	switch e.Kind {
+	case EVENT_WAR:
+		_, err = StartBattleground(BATTLEGROUND_WAR, BattlegroundOptions{Countdown: e.Countdown, Divine: e.Divine})
+	case EVENT_FACTION_WAR:
+		_, err = StartBattleground(BATTLEGROUND_FACTION_WAR, BattlegroundOptions{Countdown: e.Countdown, MinLevel: int(e.MinLevel), MaxLevel: int(e.MaxLevel)})
+	case EVENT_LAST_MAN:
+		_, err = StartBattleground(BATTLEGROUND_LAST_MAN, BattlegroundOptions{Countdown: e.Countdown})
+	case EVENT_GOLDEN_BASIN:
+		_, err = StartBattleground(BATTLEGROUND_GOLDEN_BASIN, BattlegroundOptions{Countdown: e.Countdown, Duration: e.Duration * 60})
+	case EVENT_GUILD_WAR:
+		_, err = StartBattleground(BATTLEGROUND_GUILD_WAR, BattlegroundOptions{Duration: e.Duration * 60})
+	}
+	if err != nil {
+		return "skipped, " + err.Error()
+	}
+	return "started"
+}
+
+// record saves the time and result of a run.
+func (e *ScheduledEvent) record(result string) {
+	log.Printf("Scheduled event %d (%s): %s", e.ID, e.Name, result)
+
+	now := null.TimeFrom(time.Now())
+	scheduleMutex.Lock()
+	e.LastRun, e.LastResult = now, result
+	scheduleMutex.Unlock()
+
+	// only the run, an edit of the event may have been saved meanwhile
+	query := `update hops.scheduled_events set last_run = $1, last_result = $2 where id = $3`
+	if _, err := db.Exec(query, now, result, e.ID); err != nil {
+		log.Printf("record: %s", err.Error())
+	}
+}
+
+// StartSchedule reads the scheduled events and starts the timers of the
+// enabled ones. Events that do not parse are kept but never run.
+func StartSchedule() error {
+	var events []*ScheduledEvent
+	query := `select * from hops.scheduled_events`
+
+	if _, err := db.Select(&events, query); err != nil {
+		return fmt.Errorf("StartSchedule: %s", err.Error())
+	}
+
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	for _, e := range scheduledEvents {
+		e.stop()
+	}
+	scheduledEvents = make(map[int]*ScheduledEvent, len(events))
+	for _, e := range events {
+		if err := e.Parse(); err != nil {
+			log.Printf("Scheduled event %d: %s", e.ID, err.Error())
+		}
+		scheduledEvents[e.ID] = e
+		e.arm()
+	}
+	return nil
+}
+
+// ScheduledEvents returns the scheduled events by id.
+func ScheduledEvents() []*ScheduledEvent {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	events := make([]*ScheduledEvent, 0, len(scheduledEvents))
+	for _, e := range scheduledEvents {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events
+}
+
+func FindScheduledEvent(id int) *ScheduledEvent {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+	return scheduledEvents[id]
+}
+
+// SaveScheduledEvent checks and saves a new event, or the changes of one
+// when the id is set, and schedules it.
+func SaveScheduledEvent(e *ScheduledEvent) error {
+	if err := e.Parse(); err != nil {
+		return err
+	}
+
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	old := scheduledEvents[e.ID]
+	if e.ID == 0 {
+		if err := e.Create(); err != nil {
+			return fmt.Errorf("SaveScheduledEvent: %s", err.Error())
+		}
+	} else if old == nil {
+		return fmt.Errorf("SaveScheduledEvent: no event %d", e.ID)
+	} else {
+		e.LastRun, e.LastResult = old.LastRun, old.LastResult
+		if err := e.Update(); err != nil {
+			return fmt.Errorf("SaveScheduledEvent: %s", err.Error())
+		}
+		old.stop()
+	}
+
+	scheduledEvents[e.ID] = e
+	e.arm()
+	return nil
+}
+
+// EnableScheduledEvent turns the runs of an event on or off.
+func EnableScheduledEvent(id int, enabled bool) error {
+	e := FindScheduledEvent(id)
+	if e == nil {
+		return fmt.Errorf("no event %d", id)
+	}
+
+	update := *e
+	update.Enabled = enabled
+	update.timer = nil
+	return SaveScheduledEvent(&update)
+}
+
+// DeleteScheduledEvent removes an event, false when there is none.
+func DeleteScheduledEvent(id int) (bool, error) {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	e := scheduledEvents[id]
+	if e == nil {
+		return false, nil
+	}
+	if err := e.Delete(); err != nil {
+		return false, fmt.Errorf("DeleteScheduledEvent: %s", err.Error())
+	}
+
+	e.stop()
+	delete(scheduledEvents, id)
+	return true, nil
+}
+
+// RunScheduledEvent starts an event now, outside of its schedule, and
+// returns the result.
+func RunScheduledEvent(id int) (string, error) {
+	e := FindScheduledEvent(id)
+	if e == nil {
+		return "", fmt.Errorf("no event %d", id)
+	}
+
+	check := *e
+	if err := check.Parse(); err != nil {
+		return "", err
+	}
+
+	result := e.start()
+	e.record(result)
+	return result, nil
+}
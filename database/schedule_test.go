@@ -0,0 +1,48 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduledEventNextRuns(t *testing.T) {
+	e := &ScheduledEvent{Kind: EVENT_WAR, Cron: "0 22 * * *", Timezone: "Asia/Shanghai"}
+	if err := e.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 22:00 in Shanghai is 14:00 utc
+	from := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+	runs := e.NextRuns(from, 2)
+	want := []time.Time{time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 14, 0, 0, 0, time.UTC)}
+	if len(runs) != len(want) {
+		t.Fatalf("got %v, want %v", runs, want)
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			t.Errorf("run %d at %v, want %v", i, runs[i], want[i])
+		}
+	}
+
+	e = &ScheduledEvent{Kind: EVENT_FACTION_WAR, Cron: "0 20 * * 6", Timezone: "UTC", MinLevel: 60, MaxLevel: 50}
+	if err := e.Parse(); err == nil || e.NextRuns(from, 1) != nil {
+		t.Error("faction war with an invalid level range")
+	}
+}
+
+func TestScheduledEventGuildWar(t *testing.T) {
+	e := &ScheduledEvent{Kind: EVENT_GUILD_WAR, Cron: "@daily", Timezone: "UTC", Duration: 60}
+	if result := e.start(); result != "started" {
+		t.Fatalf("got %q", result)
+	}
+	b := FindBattleground(BATTLEGROUND_GUILD_WAR)
+	t.Cleanup(func() { StopBattleground(BATTLEGROUND_GUILD_WAR) })
+	if b == nil || b.duration() != 3600 {
+		t.Fatalf("guild war %+v", b)
+	}
+
+	// a recurring run while the areas are open is skipped, not lost later
+	if result := e.start(); result != "skipped, Guild war is already running" {
+		t.Errorf("got %q for a second run", result)
+	}
+}
@@ -10,6 +10,11 @@ import (
 
 const (
 	SERVER_COUNT = 10
+
+	// DUNGEON_INSTANCES are the servers after the game servers that run the
+	// dungeon instances, MAX_SERVER is the last of them.
+	DUNGEON_INSTANCES = 40
+	MAX_SERVER        = SERVER_COUNT + DUNGEON_INSTANCES
 )
 
 var (
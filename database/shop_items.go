@@ -1,18 +1,25 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/thoas/go-funk"
 )
 
 var (
-	ShopItems = make(map[int]*ShopItem)
+	ShopItems      = make(map[int]*ShopItem)
+	shopItemsMutex sync.RWMutex
 )
 
+func FindShopItem(id int) *ShopItem {
+	shopItemsMutex.RLock()
+	defer shopItemsMutex.RUnlock()
+	return ShopItems[id]
+}
+
 type ShopItem struct {
 	Type  int    `db:"type"`
 	Items string `db:"items"`
@@ -44,20 +51,17 @@ func (e *ShopItem) GetItems() []int {
 	return arr
 }
 
-func getAllShopItems() error {
+func readShopItems() (map[int]*ShopItem, error) {
 	var shopItems []*ShopItem
 	query := `select * from data.shop_items`
 
 	if _, err := db.Select(&shopItems, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getAllShopItems: %s", err.Error())
+		return nil, fmt.Errorf("readShopItems: %s", err.Error())
 	}
 
+	m := make(map[int]*ShopItem, len(shopItems))
 	for _, s := range shopItems {
-		ShopItems[s.Type] = s
+		m[s.Type] = s
 	}
-
-	return nil
+	return m, nil
 }
@@ -1,18 +1,25 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/thoas/go-funk"
 )
 
 var (
-	Shops = make(map[int]*Shop)
+	Shops      = make(map[int]*Shop)
+	shopsMutex sync.RWMutex
 )
 
+func FindShop(id int) *Shop {
+	shopsMutex.RLock()
+	defer shopsMutex.RUnlock()
+	return Shops[id]
+}
+
 type Shop struct {
 	ID    int    `db:"id"`
 	Name  string `db:"name"`
@@ -45,28 +52,25 @@ func (e *Shop) GetTypes() []int {
 	return arr
 }
 
-func getAllShops() error {
+func readShops() (map[int]*Shop, error) {
 	var shops []*Shop
 	query := `select * from data.shop_table`
 
 	if _, err := db.Select(&shops, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getAllShops: %s", err.Error())
+		return nil, fmt.Errorf("readShops: %s", err.Error())
 	}
 
+	m := make(map[int]*Shop, len(shops))
 	for _, s := range shops {
-		Shops[s.ID] = s
+		m[s.ID] = s
 	}
-
-	return nil
+	return m, nil
 }
 
 func (e *Shop) IsPurchasable(itemID int) bool {
 	types := e.GetTypes()
 	for _, t := range types {
-		shopItems := ShopItems[t]
+		shopItems := FindShopItem(t)
 		items := shopItems.GetItems()
 
 		if funk.Contains(items, itemID) {
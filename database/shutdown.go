@@ -0,0 +1,172 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	draining   int32
+	stopped    int32
+	handlersWG sync.WaitGroup
+)
+
+// StartDraining marks the server as going down. Handlers use IsDraining to
+// refuse starting new trades, sales and consignment purchases.
+func StartDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// BeginHandle registers an in-flight packet handler. It returns false once
+// StopHandling was called; EndHandle must only be called after a true result.
+func BeginHandle() bool {
+	if atomic.LoadInt32(&stopped) == 1 {
+		return false
+	}
+
+	handlersWG.Add(1)
+	if atomic.LoadInt32(&stopped) == 1 {
+		handlersWG.Done()
+		return false
+	}
+	return true
+}
+
+func EndHandle() {
+	handlersWG.Done()
+}
+
+// StopHandling rejects every new packet and waits up to timeout for the
+// handlers which are still running.
+func StopHandling(timeout time.Duration) bool {
+	atomic.StoreInt32(&stopped, 1)
+
+	done := make(chan struct{})
+	go func() {
+		handlersWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// SaveOnlineCharacters hands out pending drops to their claimers, cancels
+// trades and sales and writes every online character to the database before
+// closing its socket.
+func SaveOnlineCharacters() error {
+	lootPendingDrops()
+
+	chars, err := FindOnlineCharacters()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, c := range chars {
+		if err := saveCharacter(c); err != nil {
+			log.Printf("Shutdown save failed for %d (%s): %+v", c.ID, c.Name, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("SaveOnlineCharacters: %d of %d characters could not be saved", failed, len(chars))
+	}
+	return nil
+}
+
+func saveCharacter(c *Character) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	c.CancelTrade()
+	if sale := FindSale(c.PseudoID); sale != nil {
+		sale.Delete()
+		c.SaleActive = false
+		c.SaleActiveEpoch = 0
+	}
+
+	var errs []error
+	if err := c.Update(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s := c.Socket; s != nil {
+		if s.Stats != nil {
+			if err := s.Stats.Update(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if s.Skills != nil {
+			if err := s.Skills.Update(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	slots, err := c.InventorySlots()
+	if err == nil {
+		for _, slot := range slots {
+			if slot == nil || slot.ID == 0 {
+				continue
+			}
+			if err := slot.Update(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	} else {
+		errs = append(errs, err)
+	}
+
+	if c.Socket != nil {
+		c.Socket.OnClose()
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// lootPendingDrops gives the items lying on the ground to the characters that
+// own them, drops only live in memory and would be lost otherwise.
+func lootPendingDrops() {
+	drMutex.Lock()
+	var drops []*Drop
+	for server, maps := range DropRegister {
+		for mapID, register := range maps {
+			for id, drop := range register {
+				drops = append(drops, drop)
+				delete(register, id)
+				DropGrid.Remove(dropGridID(server, mapID, id))
+			}
+		}
+	}
+	drMutex.Unlock()
+
+	for _, drop := range drops {
+		claimer := drop.Claimer
+		if claimer == nil || !claimer.IsOnline || drop.Item == nil || drop.Item.ItemID == 0 {
+			continue
+		}
+
+		if _, slot, err := claimer.AddItem(drop.Item, -1, true); err != nil || slot == -1 {
+			log.Printf("Shutdown: drop %d (item %d) of %s could not be looted: %v", drop.ID, drop.Item.ItemID, claimer.Name, err)
+		}
+	}
+}
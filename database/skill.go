@@ -1,19 +1,41 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"sort"
+	"sync"
 
 	gorp "gopkg.in/gorp.v1"
 )
 
 var (
 	SkillInfos       = make(map[int]*SkillInfo)
+	skillsMutex      sync.RWMutex
 	SkillInfosByBook = make(map[int64][]*SkillInfo)
-	SkillPoints      = make([]uint64, 12000)
+	SkillPoints      = skillPoints(12000)
 )
 
+func FindSkillInfosByBook(id int64) []*SkillInfo {
+	skillsMutex.RLock()
+	defer skillsMutex.RUnlock()
+	return SkillInfosByBook[id]
+}
+
+func FindSkillInfo(id int) *SkillInfo {
+	skillsMutex.RLock()
+	defer skillsMutex.RUnlock()
+	return SkillInfos[id]
+}
+
+// skillPoints are the points needed for every skill level.
+func skillPoints(n int) []uint64 {
+	points := make([]uint64, n)
+	for i := range points {
+		points[i] = 2000 * uint64(i) * uint64(i)
+	}
+	return points
+}
+
 type SkillInfo struct {
 	ID                      int     `db:"id"`
 	BookID                  int64   `db:"book_id"`
@@ -60,33 +82,35 @@ func (e *SkillInfo) Update() error {
 	return err
 }
 
-func getSkillInfos() error {
+func readSkillInfos() (map[int]*SkillInfo, error) {
 	var skills []*SkillInfo
 	query := `select * from data.skills`
 
 	if _, err := db.Select(&skills, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getSkillInfos: %s", err.Error())
+		return nil, fmt.Errorf("readSkillInfos: %s", err.Error())
 	}
 
+	m := make(map[int]*SkillInfo, len(skills))
+	for _, s := range skills {
+		m[s.ID] = s
+	}
+	return m, nil
+}
+
+// setSkillInfos replaces the skills and the skills of every book.
+func setSkillInfos(skills map[int]*SkillInfo) {
+	byBook := make(map[int64][]*SkillInfo)
 	for _, s := range skills {
-		SkillInfos[s.ID] = s
 		if s.Slot > 0 {
-			SkillInfosByBook[s.BookID] = append(SkillInfosByBook[s.BookID], s)
+			byBook[s.BookID] = append(byBook[s.BookID], s)
 		}
 	}
 
-	for _, b := range SkillInfosByBook {
+	for _, b := range byBook {
 		sort.Slice(b, func(i, j int) bool {
 			return b[i].Slot < b[j].Slot
 		})
 	}
 
-	for i := uint64(0); i < uint64(len(SkillPoints)); i++ {
-		SkillPoints[i] = 2000 * i * i
-	}
-
-	return nil
+	SkillInfos, SkillInfosByBook = skills, byBook
 }
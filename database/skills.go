@@ -117,6 +117,12 @@ func (e *Skills) SetSkills(slots *SkillSlots) error {
 	return nil
 }
 
+func AddSkillsToCache(skills *Skills) {
+	skMutex.Lock()
+	allSkills[skills.ID] = skills
+	skMutex.Unlock()
+}
+
 func FindSkillsByID(id int) (*Skills, error) {
 
 	skMutex.RLock()
@@ -165,7 +171,7 @@ func (s *Skills) GetSkillsData() ([]byte, error) {
 				if skill.SkillID == 0 {
 					continue
 				}
-				info := SkillInfos[skill.SkillID]
+				info := FindSkillInfo(skill.SkillID)
 				for ; c < info.Slot; c++ {
 					r.Insert([]byte{0x00, 0x00, 0x00, 0x00, 0x00}, index) // empty slot
 					index += 5
@@ -2,9 +2,9 @@ package database
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -12,6 +12,9 @@ import (
 	"sync"
 	"time"
 
+	"hero-server/codec"
+	heronats "hero-server/nats"
+	"hero-server/security"
 	"hero-server/utils"
 
 	"github.com/nats-io/nats.go"
@@ -22,8 +25,21 @@ var (
 	Handler     func(*Socket, []byte, uint16) ([]byte, error)
 	Sockets     = make(map[string]*Socket)
 	socketMutex sync.RWMutex
+
+	WRITE_QUEUE_SIZE    = 256              // frames waiting to be written per connection
+	WRITE_QUEUE_TIMEOUT = 3 * time.Second  // how long Write waits on a full queue
+	WRITE_TIMEOUT       = 10 * time.Second // deadline of a single write to the connection
+	WRITE_BATCH_SIZE    = 16 * 1024        // queued frames are written together up to this size
+
+	ErrSocketClosed = errors.New("socket closed")
+	ErrSlowClient   = errors.New("client too slow, write queue full")
 )
 
+type outFrame struct {
+	data    []byte
+	flushed chan struct{} // closed once everything before it is written
+}
+
 type Socket struct {
 	Conn              net.Conn
 	ClientAddr        string
@@ -35,8 +51,18 @@ type Socket struct {
 	//StatsMutex        sync.RWMutex
 	Skills     *Skills
 	HoustonSub *nats.Subscription
-	PacketSize int16
-	WriteChan  chan struct{}
+
+	writeQueue chan outFrame
+	closing    chan struct{}
+	startOnce  sync.Once
+	closeOnce  sync.Once
+
+	// CastHandler receives the broadcasts of the grid cells around the
+	// character, see UpdateInterest.
+	CastHandler nats.MsgHandler
+	cellSubs    map[string]*nats.Subscription
+	cell        heronats.Cell
+	cellMutex   sync.Mutex
 
 	handlePing   func() error
 	pingDuration time.Duration
@@ -119,225 +145,226 @@ func CloseSocket(ip string) bool {
 }
 
 func (s *Socket) Read() {
+	s.start()
+	s.ClientAddr = s.Conn.RemoteAddr().String()
 
-	//reader := bufio.NewReader(s.Conn)
-	//writer := bufio.NewWriter(s.Conn)
+	reader := bufio.NewReaderSize(s.Conn, codec.MAX_FRAME_SIZE)
+	if os.Getenv("PROXY_ENABLED") == "1" {
+		if err := s.readProxyHeader(reader); err != nil {
+			log.Printf("Proxy header error from %s: %s", s.ClientAddr, err.Error())
+			s.OnClose()
+			return
+		}
 
-	//go s.ResetPacketCount()
+		ip := security.IP(s.ClientAddr)
+		if !security.OpenConnection(ip) {
+			s.OnClose()
+			return
+		}
+		defer security.CloseConnection(ip)
+	}
 
+	limiter := security.NewLimiter()
 	for {
-		buf := make([]byte, 4096)
-		n, err := s.Conn.Read(buf)
+		frame, err := codec.ReadFrame(reader)
 		if err != nil { // do not remove connecting ip here
+			if err != io.EOF && !s.IsClosed() {
+				log.Printf("Read error from %s: %s", s.ClientAddr, err.Error())
+			}
 			s.OnClose()
-			break
+			return
 		}
 
-		if buf[0x0] != 0xAA && buf[0x1] != 0x55 {
-			s.OnClose()
-			break
-		}
+		//tmpPacket := utils.Packet(frame)
+		//tmpPacket.Print()
 
-		/*
-			if n > 2048 {
-				s.OnClose()
-				break
+		sign := uint16(utils.BytesToInt(frame[4:6], false))
+		if !limiter.Allow(sign) {
+			userID := ""
+			if s.User != nil {
+				userID = s.User.ID
 			}
-
-			if s.PacketSize >= 100 {
+			if security.Violation(security.IP(s.ClientAddr), userID) {
+				log.Printf("Packet flood from %s (user %q), blocking the ip.", s.ClientAddr, userID)
 				s.OnClose()
 				return
 			}
+			continue
+		}
 
-			s.PacketSize++
-		*/
-
-		/*
-			go func() {
-				if redis.Client2 != nil {
-					var tmpPacket utils.Packet
-					tmpPacket.Concat(buf[:n])
-					redis.Client2.Set(uuid.New().String(), tmpPacket.ReturnPackage(), time.Duration(0))
-				}
-
-			}()
-		*/
-
-		/*
-			//paketleri yaz
-			result := make([]byte, len(buf[:n]))
-			tmpBuff := bytes.NewBuffer(result)
-
-			for _, b := range buf[:n] {
-				fmt.Fprintf(tmpBuff, "\\x%02x", b)
-			}
-
-			fmt.Println(tmpBuff.String())
-		*/
+		// frames of a connection are handled one after the other, in order
+		resp, err := Handler(s, frame, sign)
+		if err != nil {
+			fmt.Println("recognize packet error:", err)
+		}
 
-		//tmpPacket := utils.Packet(buf[:n])
-		//tmpPacket.Print()
+		if len(resp) > 0 {
+			s.Write(resp)
+		}
+	}
+}
 
-		go func() {
-			resp, err := s.recognizePacket(buf[:n])
-			if err != nil {
-				fmt.Println("recognize packet error:", err)
-			}
+// readProxyHeader reads the PROXY protocol line the load balancer sends
+// before the first frame.
+func (s *Socket) readProxyHeader(r *bufio.Reader) error {
+	prefix, err := r.Peek(5)
+	if err != nil {
+		return err
+	} else if string(prefix) != "PROXY" {
+		return nil
+	}
 
-			if len(resp) > 0 {
-				packets := bytes.SplitAfter(resp, []byte{0x55, 0xAA})
-				for _, packet := range packets {
-					if len(packet) == 0 {
-						continue
-					}
-
-					/*
-						//s.Conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
-						_, err := s.Conn.Write(packet) // Guild Bug
-						//_, err := writer.Write(packet)
-						//writer.Flush()
-						if err != nil {
-							s.OnClose()
-							break
-						}
-					*/
-
-					s.Write(packet)
-
-					//s.SafeWrite(packet)
-
-					//s.Write(packet)
-					time.Sleep(time.Duration(len(packet)/25) * time.Millisecond)
-				}
-			}
-		}()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
 	}
+
+	s.ParseHeader([]byte(strings.TrimRight(line, "\r\n")))
+	return nil
 }
 
 func (s *Socket) OnClose() {
 	if s == nil {
 		return
 	}
-	s.Conn.Close()
-	if u := s.User; u != nil {
-		s.Remove(u.ID)
-		if s.User.ConnectingIP == "" {
-			u.Logout()
+	s.start()
+
+	// the reader, the writer and kicks all close the socket, only the first
+	// logs out
+	s.closeOnce.Do(func() {
+		close(s.closing)
+
+		s.Conn.Close()
+		if u := s.User; u != nil {
+			s.Remove(u.ID)
+			if s.User.ConnectingIP == "" {
+				u.Logout()
+			}
 		}
-	}
-	if c := s.Character; c != nil {
-		c.Logout()
-	}
-	if s.HoustonSub != nil {
-		s.HoustonSub.Unsubscribe()
-	}
-
-	s = nil
+		if c := s.Character; c != nil {
+			c.Logout()
+		}
+		if s.HoustonSub != nil {
+			s.HoustonSub.Unsubscribe()
+		}
+		s.clearInterest()
+	})
 }
 
-func (s *Socket) recognizePacket(data []byte) ([]byte, error) {
-	packets := bytes.SplitAfter(data, []byte{0x55, 0xAA})
-
-	resp := utils.Packet{}
-	for _, packet := range packets {
+func (s *Socket) IsClosed() bool {
+	s.start()
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
 
-		if len(packet) < 6 {
-			continue
-		}
+// start creates the write queue and its writer the first time the socket
+// is used.
+func (s *Socket) start() {
+	s.startOnce.Do(func() {
+		s.writeQueue = make(chan outFrame, WRITE_QUEUE_SIZE)
+		s.closing = make(chan struct{})
+		go s.writeLoop()
+	})
+}
 
-		if os.Getenv("PROXY_ENABLED") == "1" {
-			header, body := []byte{}, []byte{}
-			if bytes.Contains(packet, []byte{0xAA, 0x55}) {
-				pParts := bytes.Split(packet, []byte{0xAA, 0x55})
-				if len(pParts) == 1 {
-					body = append([]byte{0xAA, 0x55}, pParts[0]...)
+// Write queues data for the connection. When the queue stays full for
+// WRITE_QUEUE_TIMEOUT the client is too slow to keep up and gets
+// disconnected.
+func (s *Socket) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	s.start()
 
-				} else {
-					header = pParts[0]
-					body = append([]byte{0xAA, 0x55}, pParts[1]...)
-				}
-			} else {
-				header = packet
-			}
+	// callers may reuse data once Write returns
+	f := outFrame{data: append([]byte{}, data...)}
+	select {
+	case s.writeQueue <- f:
+		return nil
+	case <-s.closing:
+		return ErrSocketClosed
+	default:
+	}
 
-			s.ParseHeader(header)
+	timer := time.NewTimer(WRITE_QUEUE_TIMEOUT)
+	defer timer.Stop()
 
-			if len(body) > 0 {
-				sign := uint16(utils.BytesToInt(body[4:6], false))
-				d, err := Handler(s, body, sign)
-				if err != nil {
-					return nil, err
-				}
+	select {
+	case s.writeQueue <- f:
+		return nil
+	case <-s.closing:
+		return ErrSocketClosed
+	case <-timer.C:
+		log.Printf("Write queue of %s is full, disconnecting slow client.", s.ClientAddr)
+		s.OnClose()
+		return ErrSlowClient
+	}
+}
 
-				resp.Concat(d)
-			}
-		} else {
-			s.ClientAddr = s.Conn.RemoteAddr().String()
-			sign := uint16(utils.BytesToInt(packet[4:6], false))
-			d, err := Handler(s, packet, sign)
-			if err != nil {
-				return nil, err
-			}
+// Flush waits until everything queued before the call is written.
+func (s *Socket) Flush() {
+	s.start()
 
-			resp.Concat(d)
-		}
+	done := make(chan struct{})
+	select {
+	case s.writeQueue <- outFrame{flushed: done}:
+	case <-s.closing:
+		return
 	}
 
-	return resp, nil
+	select {
+	case <-done:
+	case <-s.closing:
+	}
 }
 
-func (s *Socket) Write(data []byte) error {
+func (s *Socket) writeLoop() {
+	buf := make([]byte, 0, WRITE_BATCH_SIZE)
+	var flushed []chan struct{}
 
-	select {
-	case s.WriteChan <- struct{}{}:
-		defer func() {
-			<-s.WriteChan
-		}()
-		if s != nil && s.Conn != nil {
-			_, err := s.Conn.Write(data) // Guild Bug
-			if err != nil {
-				s.OnClose()
-				return err
-			}
+	for {
+		var f outFrame
+		select {
+		case f = <-s.writeQueue:
+		case <-s.closing:
+			return
 		}
-	case <-time.After(7 * time.Second):
-		s.OnClose()
-		return errors.New("Time out.")
-	}
-
-	/*
 
-		if s != nil && s.Conn != nil {
-			_, err := s.Conn.Write(data) // Guild Bug
-			if err != nil {
-				s.OnClose()
-				return err
+		// batch whatever else is already waiting
+		buf, flushed = append(buf[:0], f.data...), flushed[:0]
+		if f.flushed != nil {
+			flushed = append(flushed, f.flushed)
+		}
+	batch:
+		for len(buf) < WRITE_BATCH_SIZE {
+			select {
+			case f = <-s.writeQueue:
+				buf = append(buf, f.data...)
+				if f.flushed != nil {
+					flushed = append(flushed, f.flushed)
+				}
+			default:
+				break batch
 			}
 		}
 
-		return nil
-	*/
-	return nil
-}
-
-/*
-func (s *Socket) WriteHandler() {
-	for data := range s.WriteChan {
-		if s != nil && s.Conn != nil {
-			_, err := s.Conn.Write(data) // Guild Bug
-			if err != nil {
+		if len(buf) > 0 {
+			s.Conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+			if _, err := s.Conn.Write(buf); err != nil {
 				s.OnClose()
-				fmt.Println("Write Err: ", err)
+				return
 			}
 		}
-	}
-}
 
-func (s *Socket) SafeWrite(data []byte) {
-	s.WriteChan <- data
-	select {}
+		for _, done := range flushed {
+			close(done)
+		}
+	}
 }
-*/
 
 func (s *Socket) ParseHeader(header []byte) {
 
@@ -356,13 +383,3 @@ func (s *Socket) ParseHeader(header []byte) {
 
 	s.ClientAddr = fmt.Sprintf("%s:%s", clientIP, clientPort)
 }
-
-func (s *Socket) ResetPacketCount() {
-	for {
-		time.Sleep(time.Second * 5)
-		if s == nil {
-			return
-		}
-		s.PacketSize = 0
-	}
-}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSocketWritesInOrder(t *testing.T) {
+	conn, client := net.Pipe()
+	defer client.Close()
+	s := &Socket{Conn: conn}
+
+	var want []byte
+	for i := 0; i < 100; i++ {
+		want = append(want, 0xAA, 0x55, 0x02, 0x00, byte(i), 0x00, 0x55, 0xAA)
+	}
+
+	go func() {
+		for i := 0; i < len(want); i += 8 {
+			s.Write(want[i : i+8])
+		}
+		s.Flush()
+		s.OnClose()
+	}()
+
+	got, _ := io.ReadAll(client)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %d bytes out of order, want %d", len(got), len(want))
+	}
+}
+
+func TestSocketDisconnectsSlowClient(t *testing.T) {
+	size, timeout := WRITE_QUEUE_SIZE, WRITE_QUEUE_TIMEOUT
+	WRITE_QUEUE_SIZE, WRITE_QUEUE_TIMEOUT = 4, 50*time.Millisecond
+	defer func() { WRITE_QUEUE_SIZE, WRITE_QUEUE_TIMEOUT = size, timeout }()
+
+	conn, client := net.Pipe() // nobody reads from client
+	defer client.Close()
+	s := &Socket{Conn: conn}
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = s.Write([]byte{0xAA, 0x55, 0x02, 0x00, 0x00, 0x00, 0x55, 0xAA})
+	}
+	if err != ErrSlowClient {
+		t.Fatalf("got %v, want ErrSlowClient", err)
+	}
+	if !s.IsClosed() {
+		t.Fatal("slow client was not disconnected")
+	}
+	if err := s.Write([]byte{0x00}); err != ErrSocketClosed {
+		t.Fatalf("write after close: got %v, want ErrSocketClosed", err)
+	}
+}
+
+func TestSocketClosesOnce(t *testing.T) {
+	conn, client := net.Pipe()
+	defer client.Close()
+
+	u := &User{ID: "close-once", ConnectingIP: "127.0.0.1"}
+	s := &Socket{Conn: conn, User: u}
+	s.Add(u.ID)
+	s.OnClose()
+
+	// the user logs in again before the writer of the old socket gives up
+	next := &Socket{User: u}
+	next.Add(u.ID)
+	defer next.Remove(u.ID)
+
+	s.OnClose()
+	if GetSocket(u.ID) != next {
+		t.Fatal("a second close removed the new socket")
+	}
+}
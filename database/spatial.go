@@ -0,0 +1,166 @@
+package database
+
+import (
+	"math"
+	"sync"
+
+	"hero-server/utils"
+)
+
+const (
+	// GRID_CELL_SIZE is the edge length of a spatial grid cell. Sight queries
+	// use a 50-64 radius, so a query touches at most 5x5 cells.
+	GRID_CELL_SIZE = 32.0
+)
+
+var (
+	CharacterGrid = NewSpatialGrid(GRID_CELL_SIZE)
+	AIGrid        = NewSpatialGrid(GRID_CELL_SIZE)
+	DropGrid      = NewSpatialGrid(GRID_CELL_SIZE)
+	NPCGrid       = NewSpatialGrid(GRID_CELL_SIZE)
+)
+
+type gridCell struct {
+	server int
+	mapID  int16
+	x, y   int
+}
+
+type gridEntry struct {
+	cell     gridCell
+	location utils.Location
+}
+
+// SpatialGrid is a uniform grid index over every (server, map) pair. Entries
+// are identified by an int which must be unique within the grid.
+type SpatialGrid struct {
+	cellSize float64
+	cells    map[gridCell]map[int]*gridEntry
+	entries  map[int]*gridEntry
+	mutex    sync.RWMutex
+}
+
+func NewSpatialGrid(cellSize float64) *SpatialGrid {
+	return &SpatialGrid{
+		cellSize: cellSize,
+		cells:    make(map[gridCell]map[int]*gridEntry),
+		entries:  make(map[int]*gridEntry),
+	}
+}
+
+func (g *SpatialGrid) cellOf(server int, mapID int16, x, y float64) gridCell {
+	return gridCell{server: server, mapID: mapID, x: int(math.Floor(x / g.cellSize)), y: int(math.Floor(y / g.cellSize))}
+}
+
+// Move inserts the entry or moves it to the given position.
+func (g *SpatialGrid) Move(id, server int, mapID int16, location *utils.Location) {
+	cell := g.cellOf(server, mapID, location.X, location.Y)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	entry, ok := g.entries[id]
+	if ok && entry.cell == cell {
+		entry.location = *location
+		return
+	}
+
+	if ok {
+		g.removeFromCell(id, entry.cell)
+	}
+
+	entry = &gridEntry{cell: cell, location: *location}
+	g.entries[id] = entry
+
+	ids, ok := g.cells[cell]
+	if !ok {
+		ids = make(map[int]*gridEntry)
+		g.cells[cell] = ids
+	}
+	ids[id] = entry
+}
+
+func (g *SpatialGrid) Remove(id int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	entry, ok := g.entries[id]
+	if !ok {
+		return
+	}
+
+	g.removeFromCell(id, entry.cell)
+	delete(g.entries, id)
+}
+
+func (g *SpatialGrid) removeFromCell(id int, cell gridCell) {
+	ids := g.cells[cell]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(g.cells, cell)
+	}
+}
+
+// Location returns the indexed position of the entry.
+func (g *SpatialGrid) Location(id int) (*utils.Location, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	entry, ok := g.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	location := entry.location
+	return &location, true
+}
+
+// Query returns the ids within distance of the center, only visiting the cells
+// overlapping the search circle.
+func (g *SpatialGrid) Query(server int, mapID int16, center *utils.Location, distance float64) []int {
+	min := g.cellOf(server, mapID, center.X-distance, center.Y-distance)
+	max := g.cellOf(server, mapID, center.X+distance, center.Y+distance)
+
+	var ids []int
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	for x := min.x; x <= max.x; x++ {
+		for y := min.y; y <= max.y; y++ {
+			for id, entry := range g.cells[gridCell{server: server, mapID: mapID, x: x, y: y}] {
+				if utils.CalculateDistance(&entry.location, center) <= distance {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+
+	return ids
+}
+
+func (g *SpatialGrid) Len() int {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return len(g.entries)
+}
+
+// Drop ids are only unique inside a (server, map) pair, so they are packed
+// together before being stored in the grid.
+func dropGridID(server int, mapID int16, dropID uint16) int {
+	return server<<32 | int(uint16(mapID))<<16 | int(dropID)
+}
+
+func IndexNPCPositions() {
+	for _, pos := range NPCPos {
+		if pos == nil || !pos.IsNPC {
+			continue
+		}
+
+		minLocation := ConvertPointToLocation(pos.MinLocation)
+		maxLocation := ConvertPointToLocation(pos.MaxLocation)
+		location := &utils.Location{X: (minLocation.X + maxLocation.X) / 2, Y: (minLocation.Y + maxLocation.Y) / 2}
+
+		NPCGrid.Move(pos.ID, 0, pos.MapID, location)
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"hero-server/utils"
+)
+
+const benchMapSize = 1024.0
+
+func randomLocations(n int, seed int64) []*utils.Location {
+	r := rand.New(rand.NewSource(seed))
+	locations := make([]*utils.Location, n)
+	for i := range locations {
+		locations[i] = &utils.Location{X: r.Float64() * benchMapSize, Y: r.Float64() * benchMapSize}
+	}
+	return locations
+}
+
+func linearQuery(coordinates []string, center *utils.Location, distance float64) []int {
+	var ids []int
+	for id, coordinate := range coordinates {
+		if utils.CalculateDistance(ConvertPointToLocation(coordinate), center) <= distance {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestSpatialGridQueryMatchesLinearScan(t *testing.T) {
+	locations := randomLocations(2000, 1)
+	grid := NewSpatialGrid(GRID_CELL_SIZE)
+	coordinates := make([]string, len(locations))
+	for id, loc := range locations {
+		grid.Move(id, 1, 1, loc)
+		coordinates[id] = loc.String()
+	}
+
+	// rounding of the coordinate strings must not change the result
+	for id, loc := range locations {
+		rounded := ConvertPointToLocation(coordinates[id])
+		*loc = *rounded
+		grid.Move(id, 1, 1, loc)
+	}
+
+	for _, center := range randomLocations(50, 2) {
+		got := grid.Query(1, 1, center, 50)
+		want := linearQuery(coordinates, center, 50)
+		sort.Ints(got)
+		sort.Ints(want)
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("query around %v: got %v, want %v", center, got, want)
+		}
+	}
+
+	if ids := grid.Query(2, 1, locations[0], 50); len(ids) != 0 {
+		t.Fatalf("entries leaked into another server: %v", ids)
+	}
+}
+
+func TestSpatialGridMoveAndRemove(t *testing.T) {
+	grid := NewSpatialGrid(GRID_CELL_SIZE)
+	grid.Move(1, 1, 1, &utils.Location{X: 10, Y: 10})
+	grid.Move(1, 1, 2, &utils.Location{X: 500, Y: 500})
+
+	if ids := grid.Query(1, 1, &utils.Location{X: 10, Y: 10}, 5); len(ids) != 0 {
+		t.Fatalf("old position still indexed: %v", ids)
+	}
+	if ids := grid.Query(1, 2, &utils.Location{X: 500, Y: 500}, 5); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("new position not indexed: %v", ids)
+	}
+
+	grid.Remove(1)
+	if grid.Len() != 0 || len(grid.cells) != 0 {
+		t.Fatalf("grid not empty after remove: %d entries, %d cells", grid.Len(), len(grid.cells))
+	}
+}
+
+func TestDropGridID(t *testing.T) {
+	a := dropGridID(1, 10, 7)
+	b := dropGridID(2, 10, 7)
+	c := dropGridID(1, 11, 7)
+	if a == b || a == c || b == c {
+		t.Fatalf("drop grid ids collide: %d %d %d", a, b, c)
+	}
+	if a&0xFFFF != 7 {
+		t.Fatalf("drop id not recoverable from %d", a)
+	}
+}
+
+// The benchmarks compare the old O(N) scan (parse every coordinate string and
+// compute the distance) with the grid lookup, which only visits the cells
+// around the query point and so stays flat as N grows.
+
+func BenchmarkNearbyLinear(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		locations := randomLocations(n, 1)
+		coordinates := make([]string, n)
+		for i, loc := range locations {
+			coordinates[i] = loc.String()
+		}
+		centers := randomLocations(64, 2)
+
+		b.Run(fmt.Sprintf("N=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearQuery(coordinates, centers[i%len(centers)], 50)
+			}
+		})
+	}
+}
+
+func BenchmarkNearbyGrid(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		grid := NewSpatialGrid(GRID_CELL_SIZE)
+		for i, loc := range randomLocations(n, 1) {
+			grid.Move(i, 1, 1, loc)
+		}
+		centers := randomLocations(64, 2)
+
+		b.Run(fmt.Sprintf("N=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				grid.Query(1, 1, centers[i%len(centers)], 50)
+			}
+		})
+	}
+}
+
+func BenchmarkGridMove(b *testing.B) {
+	grid := NewSpatialGrid(GRID_CELL_SIZE)
+	locations := randomLocations(1024, 1)
+	for i := 0; i < b.N; i++ {
+		grid.Move(i%256, 1, 1, locations[i%len(locations)])
+	}
+}
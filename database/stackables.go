@@ -1,9 +1,9 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/thoas/go-funk"
 	gorp "gopkg.in/gorp.v1"
@@ -15,7 +15,8 @@ type Stackable struct {
 }
 
 var (
-	Stackables = make(map[int]*Stackable)
+	Stackables      = make(map[int]*Stackable)
+	stackablesMutex sync.RWMutex
 )
 
 func (e *Stackable) Create() error {
@@ -32,6 +33,8 @@ func (e *Stackable) Delete() error {
 }
 
 func FindStackableByUIF(uif string) *Stackable {
+	stackablesMutex.RLock()
+	defer stackablesMutex.RUnlock()
 
 	if stackable, ok := funk.Find(funk.Values(Stackables), func(stackable *Stackable) bool {
 		return strings.ToLower(stackable.UIF) == strings.ToLower(uif)
@@ -42,20 +45,17 @@ func FindStackableByUIF(uif string) *Stackable {
 	return nil
 }
 
-func getStackables() error {
+func readStackables() (map[int]*Stackable, error) {
 	var stackables []*Stackable
 	query := `select * from data.stackables`
 
 	if _, err := db.Select(&stackables, query); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		}
-		return fmt.Errorf("getStackables: %s", err.Error())
+		return nil, fmt.Errorf("readStackables: %s", err.Error())
 	}
 
+	m := make(map[int]*Stackable, len(stackables))
 	for _, s := range stackables {
-		Stackables[s.ID] = s
+		m[s.ID] = s
 	}
-
-	return nil
+	return m, nil
 }
@@ -1,31 +1,18 @@
 package database
 
 import (
-	"fmt"
-	"time"
+	"errors"
 
-	"hero-server/messaging"
+	"hero-server/codec"
 
 	"hero-server/nats"
 	"hero-server/utils"
 )
 
 var (
-	ANNOUNCEMENT    = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x71, 0x06, 0x00, 0x55, 0xAA}
-	START_WAR       = utils.Packet{0xAA, 0x55, 0x23, 0x00, 0x65, 0x01, 0x00, 0x00, 0x17, 0x00, 0x00, 0x00, 0x10, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x10, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xb0, 0x04, 0x00, 0x00, 0x55, 0xaa}
-	OrderCharacters = make(map[int]*Character)
-	ShaoCharacters  = make(map[int]*Character)
-	LobbyCharacters = make(map[int]*Character)
-
-	WarRequirePlayers = 10
-	OrderPoints       = 10000
-	ShaoPoints        = 10000
-	CanJoinWar        = false
-	WarStarted        = false
-	DivineWar         = false
-	WarStonesIDs      = []uint16{}
-	WarStones         = make(map[int]*WarStone)
-	ActiveWars        = make(map[int]*ActiveWar)
+	START_WAR    = utils.Packet{0xAA, 0x55, 0x23, 0x00, 0x65, 0x01, 0x00, 0x00, 0x17, 0x00, 0x00, 0x00, 0x10, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x10, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xb0, 0x04, 0x00, 0x00, 0x55, 0xaa}
+	WarStonesIDs = []uint16{}
+	WarStones    = make(map[int]*WarStone)
 )
 
 type WarStone struct {
@@ -39,144 +26,97 @@ type WarStone struct {
 	NearbyShaoV   []int  `db:"-" json:"-"`
 }
 
-type ActiveWar struct {
-	WarID         uint16       `db:"-" json:"-"`
-	ZuhangPlayers []*Character `db:"-" json:"-"`
-	ShaoPlayers   []*Character `db:"-" json:"-"`
-}
-
 func MakeAnnouncement(msg string) {
-	length := int16(len(msg) + 3)
-
-	resp := ANNOUNCEMENT
-	resp.SetLength(length)
-	resp[6] = byte(len(msg))
-	resp.Insert([]byte(msg), 7)
-
+	resp := codec.Encode(&codec.Announcement{Message: msg})
 	p := nats.CastPacket{CastNear: false, Data: resp}
 	p.Cast()
 }
 
 func makeAnnouncement(msg string) {
-	length := int16(len(msg) + 3)
-
-	resp := ANNOUNCEMENT
-	resp.SetLength(length)
-	resp[6] = byte(len(msg))
-	resp.Insert([]byte(msg), 7)
-
+	resp := codec.Encode(&codec.Announcement{Message: msg})
 	p := nats.CastPacket{CastNear: false, Data: resp}
 	p.Cast()
 }
 
-func JoinToWarLobby(char *Character) {
-	LobbyCharacters[char.ID] = char
-	warReady := false
-	zuhangPlayers := 0
-	shaoPlayers := 0
-	if len(LobbyCharacters) >= WarRequirePlayers {
-		newWar := &ActiveWar{WarID: 1}
-		ActiveWars[int(1)] = newWar
-		for _, char := range LobbyCharacters {
-			if char.Faction == 1 {
-				if zuhangPlayers < WarRequirePlayers/2 {
-					zuhangPlayers++
-					ActiveWars[int(1)].ZuhangPlayers = append(ActiveWars[int(1)].ZuhangPlayers, char)
-				}
-			} else {
-				if shaoPlayers < WarRequirePlayers/2 {
-					shaoPlayers++
-					ActiveWars[int(1)].ShaoPlayers = append(ActiveWars[int(1)].ShaoPlayers, char)
-				}
-			}
-			if zuhangPlayers >= WarRequirePlayers/2 && shaoPlayers >= WarRequirePlayers/2 {
-				warReady = true
-				continue
-			}
-		}
-	}
-	if warReady {
-		for _, char := range ActiveWars[int(1)].ShaoPlayers {
-			char.Socket.Write(messaging.InfoMessage(fmt.Sprintf("Your war is ready. /accept war ")))
-		}
-		for _, char := range ActiveWars[int(1)].ZuhangPlayers {
-			char.Socket.Write(messaging.InfoMessage(fmt.Sprintf("Your war is ready. /accept war ")))
-		}
-		CheckALlPlayersReady()
-	}
-}
-
 func secondsToMinutes(inSeconds int) (int, int) {
 	minutes := inSeconds / 60
 	seconds := inSeconds % 60
 	return minutes, seconds
 }
 
-func StartWarTimer(prepareWarStart int) {
-	min, sec := secondsToMinutes(prepareWarStart)
-	msg := ""
-	if DivineWar {
-		msg = fmt.Sprintf("%d minutes %d second after the divine Great War will start.", min, sec)
-	} else {
-		msg = fmt.Sprintf("%d minutes %d second after the Great War will start.", min, sec)
+// greatWar is the great war on map 230. The factions are the sides, each
+// stone a side holds costs the other side points and the war ends early
+// when a side has none left.
+type greatWar struct{}
+
+func (greatWar) Join(b *Battleground, c *Character) (int, *utils.Location, error) {
+	if b.Options.Divine && c.Level <= 100 {
+		return 0, nil, errors.New("You are not Divine")
+	} else if !b.Options.Divine && (c.Level < 50 || c.Level > 100) {
+		return 0, nil, errors.New("You are not non Divine")
 	}
-	msg2 := fmt.Sprintf("Please participate war by Hero Battle Manager")
-	makeAnnouncement(msg)
-	makeAnnouncement(msg2)
-	if prepareWarStart > 0 {
-		time.AfterFunc(time.Second*10, func() {
-			StartWarTimer(prepareWarStart - 10)
-		})
-	} else {
-		StartWar()
+
+	if c.Faction == 1 {
+		return 1, &utils.Location{X: 75, Y: 45}, nil
 	}
+	return 2, &utils.Location{X: 81, Y: 475}, nil
 }
 
-func ResetWar() {
-	time.AfterFunc(time.Second*10, func() {
-		for _, char := range OrderCharacters {
-			delete(OrderCharacters, char.ID)
-			char.WarKillCount = 0
-			char.WarContribution = 0
-			char.IsinWar = false
-			gomap, _ := char.ChangeMap(1, nil)
-			char.Socket.Write(gomap)
-		}
-		for _, char := range ShaoCharacters {
-			delete(ShaoCharacters, char.ID)
-			char.WarKillCount = 0
-			char.WarContribution = 0
-			char.IsinWar = false
-			gomap, _ := char.ChangeMap(1, nil)
-			char.Socket.Write(gomap)
-		}
-		for _, stones := range WarStones {
-			stones.ConquereValue = 0
-			stones.ConqueredID = 0
-			stones.NearbyShao = 0
-			stones.NearbyShaoV = []int{}
-			stones.NearbyZuhang = 0
-			stones.NearbyZuhangV = []int{}
+func (greatWar) Start(b *Battleground) {
+	resetWarStones()
+
+	resp := START_WAR
+	resp.Overwrite(utils.IntToBytes(uint64(len(b.Members(1))), 4, false), 8)
+	resp.Overwrite(utils.IntToBytes(uint64(len(b.Members(2))), 4, false), 22)
+	b.Send(resp)
+
+	for _, m := range b.Members(0) {
+		if m.Character.IsOnline && m.Character.Socket != nil {
+			m.Character.Socket.Write(m.Character.AdvanceAchievements(ACHIEVEMENT_WAR, 0, 1))
 		}
-	})
+	}
 }
 
-func StartWar() {
-	resp := START_WAR
-	byteOrders := utils.IntToBytes(uint64(len(OrderCharacters)), 4, false)
-	byteShaos := utils.IntToBytes(uint64(len(ShaoCharacters)), 4, false)
-	resp.Overwrite(byteOrders, 8)
-	resp.Overwrite(byteShaos, 22)
-	for _, char := range OrderCharacters {
-		char.Socket.Write(resp)
+func (greatWar) Tick(b *Battleground) bool {
+	b.Send(warTimerMenu(b))
+	conquerWarStones()
+	return b.Score(1) <= 0 || b.Score(2) <= 0
+}
+
+func (greatWar) Finish(b *Battleground) {
+	b.Send(warScorePanel(b))
+	resetWarStones()
+}
+
+// StonePoints adds points to the other side for every stone a side of the
+// great war holds, every second.
+type StonePoints struct {
+	Points int
+}
+
+func (r StonePoints) Score(b *Battleground, e *ScoreEvent) {
+	if e.Kind != SCORE_TICK {
+		return
 	}
-	for _, char := range ShaoCharacters {
-		char.Socket.Write(resp)
+	for _, stone := range WarStones {
+		switch stone.ConqueredID {
+		case 1:
+			b.AddScore(2, r.Points)
+		case 2:
+			b.AddScore(1, r.Points)
+		}
 	}
+}
 
-	CanJoinWar = false
-	WarStarted = true
-	StartInWarTimer()
+func resetWarStones() {
+	for _, stones := range WarStones {
+		stones.ConquereValue = 0
+		stones.ConqueredID = 0
+		stones.NearbyShao = 0
+		stones.NearbyShaoV = []int{}
+		stones.NearbyZuhang = 0
+		stones.NearbyZuhangV = []int{}
+	}
 }
 
 func (self *WarStone) RemoveZuhang(id int) {
@@ -196,21 +136,3 @@ func (self *WarStone) RemoveShao(id int) {
 		}
 	}
 }
-
-func StartWarAutoFunc(isDivineWar bool) {
-	CanJoinWar = true
-	DivineWar = isDivineWar
-	ShaoPoints = 10000
-	OrderPoints = 10000
-
-	for _, stones := range WarStones {
-		stones.ConquereValue = 0
-		stones.ConqueredID = 0
-		stones.NearbyShao = 0
-		stones.NearbyShaoV = []int{}
-		stones.NearbyZuhang = 0
-		stones.NearbyZuhangV = []int{}
-	}
-
-	StartWarTimer(300)
-}
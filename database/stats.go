@@ -298,6 +298,12 @@ func FindStatByID(id int) (*Stat, error) {
 	return stat, nil
 }
 
+func AddStatToCache(stat *Stat) {
+	stMutex.Lock()
+	stats[stat.ID] = stat
+	stMutex.Unlock()
+}
+
 func DeleteStatFromCache(id int) {
 	stMutex.Lock()
 	delete(stats, id)
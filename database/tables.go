@@ -0,0 +1,356 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RELOAD_CHANNEL is the postgres channel that reloads tables, the payload is
+// a comma separated list of table names:
+//
+//	notify data_reload, 'drops,shop_items';
+const RELOAD_CHANNEL = "data_reload"
+
+// Table is a data table that is read at the start and can be read again
+// while the server is running. A reload reads the whole table into a new
+// map, validates it and only then swaps it with the map in use.
+type Table struct {
+	read     func() (interface{}, error)
+	target   interface{}               // pointer to the package map
+	mutex    *sync.RWMutex             // guards target, readers go through its accessors
+	set      func(interface{})         // replaces target when more than the map changes
+	validate func(interface{}) []error // problems that prevent a reload
+}
+
+// TableDiff is what a reload changed, by row key.
+type TableDiff struct {
+	Table   string   `json:"table"`
+	Rows    int      `json:"rows"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// RELOADABLE_TABLES are the data tables that can be read again while the
+// server is running, by the name used in the admin api and gm commands.
+var RELOADABLE_TABLES = map[string]*Table{
+	"achievements":         {read: func() (interface{}, error) { return readAchievements() }, target: &Achievements, mutex: &achievementsMutex, validate: validateAchievements},
+	"battleground_rewards": {read: func() (interface{}, error) { return readBattlegroundRewards() }, target: &BattlegroundRewards, mutex: &battlegroundRewardsMutex, validate: validateBattlegroundRewards},
+	"buff_icons":           {read: func() (interface{}, error) { return readBuffIcons() }, target: &BuffIcons, mutex: &buffIconsMutex},
+	"buff_infections":      {read: func() (interface{}, error) { return readBuffInfections() }, target: &BuffInfections, mutex: &buffInfectionsMutex},
+	"drop_map_rates":       {read: func() (interface{}, error) { return readDropMapRates() }, target: &DropMapRates, mutex: &dropMapRatesMutex, validate: validateDropMapRates},
+	"drops": {read: func() (interface{}, error) { return readDropGroups() }, target: &DropGroups, mutex: &dropsMutex,
+		set: func(v interface{}) { setDropGroups(v.(map[int]*DropGroup)) }, validate: validateDropGroups},
+	"dungeons":     {read: func() (interface{}, error) { return readDungeons() }, target: &Dungeons, mutex: &dungeonsTableMutex, validate: validateDungeons},
+	"emotions":     {read: func() (interface{}, error) { return readEmotions() }, target: &Emotions, mutex: &emotionsMutex},
+	"enhancements": {read: func() (interface{}, error) { return readEnhancements() }, target: &Enhancements, mutex: &enhancementsMutex},
+	"exps":         {read: func() (interface{}, error) { return readExps() }, target: &EXPs, mutex: &expsMutex},
+	"fusions":      {read: func() (interface{}, error) { return readFusions() }, target: &Fusions, mutex: &fusionsMutex},
+	"gambling":     {read: func() (interface{}, error) { return readGamblingItems() }, target: &GamblingItems, mutex: &gamblingMutex},
+	"gates":        {read: func() (interface{}, error) { return readGates() }, target: &Gates, mutex: &GatesMutex},
+	"hax_codes":    {read: func() (interface{}, error) { return readHaxCodes() }, target: &HaxCodes, mutex: &haxCodesMutex},
+	"htshop":       {read: func() (interface{}, error) { return readHTItems() }, target: &HTItems, mutex: &htItemsMutex, validate: validateHTItems},
+	"items":        {read: func() (interface{}, error) { return readItems() }, target: &Items, mutex: &ItemsMutex},
+	"job_passives": {read: func() (interface{}, error) { return readJobPassives() }, target: &JobPassives, mutex: &jobPassivesMutex},
+	"map_bounds":   {read: func() (interface{}, error) { return readMapBounds() }, target: &MapBounds, mutex: &mapBoundsMutex, validate: validateMapBounds},
+	"meltings":     {read: func() (interface{}, error) { return readMeltings() }, target: &Meltings, mutex: &meltingsMutex},
+	"nav_grids":    {read: func() (interface{}, error) { return readNavGrids() }, target: &NavGrids, mutex: &navGridsMutex, validate: validateNavGrids},
+	"npc_actions":  {read: func() (interface{}, error) { return readNPCActions() }, target: &NPCActions, mutex: &npcActionsMutex, validate: validateNPCActions},
+	"npc_drops":    {read: func() (interface{}, error) { return readNPCDrops() }, target: &NPCDrops, mutex: &npcDropsMutex},
+	"npc_scripts":  {read: func() (interface{}, error) { return readScripts() }, target: &NPCScripts, mutex: &npcScriptsMutex},
+	"pet_exps":     {read: func() (interface{}, error) { return readPetExps() }, target: &PetExps, mutex: &petExpsMutex},
+	"pets":         {read: func() (interface{}, error) { return readPets() }, target: &Pets, mutex: &petsMutex},
+	"productions":  {read: func() (interface{}, error) { return readProductions() }, target: &Productions, mutex: &productionsMutex, validate: validateProductions},
+	"quests":       {read: func() (interface{}, error) { return readQuests() }, target: &Quests, mutex: &questsMutex, validate: validateQuests},
+	"save_points":  {read: func() (interface{}, error) { return readSavePoints() }, target: &SavePoints, mutex: &savePointsMutex},
+	"shop_items":   {read: func() (interface{}, error) { return readShopItems() }, target: &ShopItems, mutex: &shopItemsMutex, validate: validateShopItems},
+	"shops":        {read: func() (interface{}, error) { return readShops() }, target: &Shops, mutex: &shopsMutex},
+	"skills": {read: func() (interface{}, error) { return readSkillInfos() }, target: &SkillInfos, mutex: &skillsMutex,
+		set: func(v interface{}) { setSkillInfos(v.(map[int]*SkillInfo)) }},
+	"stackables": {read: func() (interface{}, error) { return readStackables() }, target: &Stackables, mutex: &stackablesMutex},
+}
+
+var tablesMutex sync.Mutex
+
+// TableNames returns the names of the reloadable tables in order.
+func TableNames() []string {
+	names := make([]string, 0, len(RELOADABLE_TABLES))
+	for name := range RELOADABLE_TABLES {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReloadTable reads the data table with the given name again. The table in
+// use is kept when it can't be read or has problems.
+func ReloadTable(name string) (*TableDiff, error) {
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+
+	t, ok := RELOADABLE_TABLES[name]
+	if !ok {
+		return nil, fmt.Errorf("ReloadTable: unknown table %s", name)
+	}
+
+	v, err := t.read()
+	if err != nil {
+		return nil, fmt.Errorf("ReloadTable: %s", err.Error())
+	}
+
+	old := t.get()
+	if errs := t.check(old, v); len(errs) > 0 {
+		return nil, fmt.Errorf("ReloadTable: %s has %d problems, the first is: %s", name, len(errs), errs[0].Error())
+	}
+
+	diff := diffTables(name, old, v)
+	t.swap(v)
+	log.Printf("Reloaded %s", diff)
+	return diff, nil
+}
+
+// loadTable reads a table at the start. Problems are only logged, the table
+// is used anyway.
+func loadTable(name string) error {
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+
+	t := RELOADABLE_TABLES[name]
+	v, err := t.read()
+	if err != nil {
+		return err
+	}
+
+	for _, err := range t.check(nil, v) {
+		log.Printf("Table %s: %s", name, err.Error())
+	}
+	t.swap(v)
+	return nil
+}
+
+func (t *Table) get() interface{} {
+	if t.mutex != nil {
+		t.mutex.RLock()
+		defer t.mutex.RUnlock()
+	}
+	return reflect.ValueOf(t.target).Elem().Interface()
+}
+
+func (t *Table) swap(v interface{}) {
+	if t.mutex != nil {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+	}
+
+	if t.set != nil {
+		t.set(v)
+	} else {
+		reflect.ValueOf(t.target).Elem().Set(reflect.ValueOf(v))
+	}
+}
+
+func (t *Table) check(old, v interface{}) []error {
+	if old != nil && reflect.ValueOf(v).Len() == 0 && reflect.ValueOf(old).Len() > 0 {
+		return []error{fmt.Errorf("the table is empty")}
+	}
+	if t.validate == nil {
+		return nil
+	}
+	return t.validate(v)
+}
+
+// diffTables compares two maps of rows. Rows are compared by their json, so
+// fields that are cached after the read don't count as changes.
+func diffTables(name string, old, new interface{}) *TableDiff {
+	diff := &TableDiff{Table: name, Added: []string{}, Removed: []string{}, Changed: []string{}}
+	o, n := reflect.ValueOf(old), reflect.ValueOf(new)
+	diff.Rows = n.Len()
+
+	for _, k := range n.MapKeys() {
+		key := fmt.Sprint(k.Interface())
+		if ov := o.MapIndex(k); !ov.IsValid() {
+			diff.Added = append(diff.Added, key)
+		} else if !sameRow(ov.Interface(), n.MapIndex(k).Interface()) {
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	for _, k := range o.MapKeys() {
+		if !n.MapIndex(k).IsValid() {
+			diff.Removed = append(diff.Removed, fmt.Sprint(k.Interface()))
+		}
+	}
+
+	for _, keys := range [][]string{diff.Added, diff.Removed, diff.Changed} {
+		sortKeys(keys)
+	}
+	return diff
+}
+
+func sameRow(a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// sortKeys sorts numeric keys by value and the others as strings.
+func sortKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.ParseInt(keys[i], 10, 64)
+		b, errB := strconv.ParseInt(keys[j], 10, 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+func (d *TableDiff) String() string {
+	return fmt.Sprintf("%s: %d rows, %d added, %d removed, %d changed", d.Table, d.Rows, len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// listenReloads reloads the tables named in the notifications on
+// RELOAD_CHANNEL, so every server reloads on one notify.
+func listenReloads(dsn string) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Reload listener error:", err)
+		}
+	})
+
+	if err := listener.Listen(RELOAD_CHANNEL); err != nil {
+		listener.Close()
+		return fmt.Errorf("listenReloads: %s", err.Error())
+	}
+
+	go func() {
+		for n := range listener.Notify {
+			if n == nil { // reconnected, notifications may be lost
+				continue
+			}
+
+			for _, name := range strings.Split(n.Extra, ",") {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				if _, err := ReloadTable(name); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// parseIDs parses the {1,2,3} arrays of the data tables.
+func parseIDs(s string) ([]int, error) {
+	s = strings.Trim(strings.TrimSpace(s), "{}")
+	if s == "" {
+		return nil, nil
+	}
+
+	var ids []int
+	for _, p := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func itemExists(id int) bool {
+	_, ok := GetItemInfo(int64(id))
+	return ok
+}
+
+func validateShopItems(v interface{}) []error {
+	shopItems := v.(map[int]*ShopItem)
+
+	var errs []error
+	for _, t := range sortedIntKeys(shopItems) {
+		items, err := parseIDs(shopItems[t].Items)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shop items %d: %s", t, err.Error()))
+			continue
+		}
+		for _, item := range items {
+			if !itemExists(item) {
+				errs = append(errs, fmt.Errorf("shop items %d: unknown item %d", t, item))
+			}
+		}
+	}
+	return errs
+}
+
+func validateHTItems(v interface{}) []error {
+	htItems := v.(map[int]*HtItem)
+
+	var errs []error
+	for _, id := range sortedIntKeys(htItems) {
+		if !itemExists(id) {
+			errs = append(errs, fmt.Errorf("ht item %d: unknown item", id))
+		} else if htItems[id].Cash < 0 {
+			errs = append(errs, fmt.Errorf("ht item %d: negative price", id))
+		}
+	}
+	return errs
+}
+
+func validateProductions(v interface{}) []error {
+	prods := v.(map[int]*Production)
+
+	var errs []error
+	for _, id := range sortedIntKeys(prods) {
+		p := prods[id]
+		if len(p.Materials) == 0 {
+			continue
+		}
+
+		materials, err := p.GetMaterials()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("production %d: materials: %s", id, err.Error()))
+			continue
+		}
+
+		if p.Production > 0 && !itemExists(p.Production) {
+			errs = append(errs, fmt.Errorf("production %d: unknown item %d", id, p.Production))
+		}
+		for _, m := range materials {
+			if m.ID > 0 && !itemExists(m.ID) {
+				errs = append(errs, fmt.Errorf("production %d: unknown material %d", id, m.ID))
+			}
+		}
+		if p.Probability < 0 || p.Cost < 0 {
+			errs = append(errs, fmt.Errorf("production %d: negative probability or cost", id))
+		}
+	}
+	return errs
+}
+
+// sortedIntKeys returns the keys of a map with int keys in order, so the
+// problems are reported the same way every time.
+func sortedIntKeys(m interface{}) []int {
+	var keys []int
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, int(k.Int()))
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReloadTable(t *testing.T) {
+	type row struct {
+		Name   string
+		cached int
+	}
+
+	current := map[int]*row{1: {Name: "a", cached: 1}, 2: {Name: "b"}, 3: {Name: "c"}}
+	next := map[int]*row{1: {Name: "a"}, 2: {Name: "B"}, 10: {Name: "d"}}
+	var problems []error
+
+	RELOADABLE_TABLES["test"] = &Table{
+		read:     func() (interface{}, error) { return next, nil },
+		target:   &current,
+		validate: func(interface{}) []error { return problems },
+	}
+	defer delete(RELOADABLE_TABLES, "test")
+
+	diff, err := ReloadTable("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &TableDiff{Table: "test", Rows: 3, Added: []string{"10"}, Removed: []string{"3"}, Changed: []string{"2"}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("got %+v, want %+v", diff, want)
+	}
+	if current[2].Name != "B" || current[3] != nil {
+		t.Fatalf("table was not swapped: %+v", current)
+	}
+
+	reloaded := current
+	problems = []error{errors.New("bad row")}
+	next = map[int]*row{1: {Name: "x"}}
+	if _, err := ReloadTable("test"); err == nil {
+		t.Fatal("table with problems was reloaded")
+	}
+
+	problems = nil
+	next = map[int]*row{}
+	if _, err := ReloadTable("test"); err == nil {
+		t.Fatal("empty table was reloaded")
+	}
+	if !reflect.DeepEqual(current, reloaded) {
+		t.Fatalf("failed reloads changed the table: %+v", current)
+	}
+
+	if _, err := ReloadTable("nope"); err == nil {
+		t.Fatal("unknown table was reloaded")
+	}
+}
+
+func TestReloadTableWhileRead(t *testing.T) {
+	gates := Gates
+	defer func() { Gates = gates }()
+
+	table := *RELOADABLE_TABLES["gates"]
+	table.read = func() (interface{}, error) { return map[int]*Gate{1: {ID: 1}}, nil }
+	RELOADABLE_TABLES["test"] = &table
+	defer delete(RELOADABLE_TABLES, "test")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if g := FindGate(1); g != nil && g.ID != 1 {
+				t.Errorf("gate %d", g.ID)
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if _, err := ReloadTable("test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
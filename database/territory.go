@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Kinds of the territories.
+const (
+	TERRITORY_FIVE_CLANS   = "five_clans"   // temples held by guilds, taken by killing their statues
+	TERRITORY_GUILD_WAR    = "guild_war"    // temples held by guilds, taken while the guild war runs
+	TERRITORY_GOLDEN_BASIN = "golden_basin" // held by the faction that won the last golden basin war
+)
+
+// GOLDEN_BASIN_AREA is the area of the golden basin in data.golden_basin.
+const GOLDEN_BASIN_AREA = 1
+
+// TerritoryArea is an area of a territory, held by a guild or a faction
+// until it expires.
+type TerritoryArea struct {
+	ID        int       `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Holder    int       `db:"holder" json:"holder"` // 0 when nobody holds it
+	ExpiresAt null.Time `db:"expires_at" json:"expires_at"`
+}
+
+// Territory is the areas of a kind of territory. Its state is guarded by its
+// own mutex.
+type Territory struct {
+	Kind  string
+	Mobs  []int // the statue of each area, from area 1
+	Buffs []int // of the holders of each area, from area 1
+
+	table  string // of the areas
+	holder string // column of the holder in the table
+	named  bool   // the table has the names of the areas
+
+	areas map[int]*TerritoryArea
+	mutex sync.Mutex
+}
+
+var (
+	// TERRITORIES are the territories by kind.
+	TERRITORIES = map[string]*Territory{
+		TERRITORY_FIVE_CLANS: {Kind: TERRITORY_FIVE_CLANS, Mobs: []int{423308, 423310, 423312, 423314, 423316},
+			Buffs: []int{70001, 70002, 70003, 70004, 70005}, table: "data.fiveclan_war", holder: "clanid", named: true},
+		TERRITORY_GUILD_WAR: {Kind: TERRITORY_GUILD_WAR, Mobs: []int{18600047, 18600048, 18600049, 18600050, 18600051},
+			Buffs: []int{70009, 70010, 70011, 70012, 70013}, table: "data.guild_war", holder: "clanid", named: true},
+		TERRITORY_GOLDEN_BASIN: {Kind: TERRITORY_GOLDEN_BASIN, table: "data.golden_basin", holder: "faction_id"},
+	}
+)
+
+// FindTerritory returns the territory of a kind.
+func FindTerritory(kind string) *Territory {
+	return TERRITORIES[kind]
+}
+
+func getTerritories() error {
+	for _, kind := range []string{TERRITORY_FIVE_CLANS, TERRITORY_GUILD_WAR, TERRITORY_GOLDEN_BASIN} {
+		if err := TERRITORIES[kind].load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Territory) load() error {
+	columns := fmt.Sprintf("id, %s as holder, expires_at", t.holder)
+	if t.named {
+		columns += ", name"
+	}
+
+	var areas []*TerritoryArea
+	query := fmt.Sprintf(`select %s from %s`, columns, t.table)
+	if _, err := db.Select(&areas, query); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("getTerritories: %s", err.Error())
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.areas = make(map[int]*TerritoryArea, len(areas))
+	for _, a := range areas {
+		t.areas[a.ID] = a
+	}
+	return nil
+}
+
+// Area returns a copy of an area, with no holder when it is unknown.
+func (t *Territory) Area(id int) TerritoryArea {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if a := t.areas[id]; a != nil {
+		return *a
+	}
+	return TerritoryArea{ID: id}
+}
+
+// Holder returns who holds an area, 0 when nobody does.
+func (t *Territory) Holder(id int) int {
+	return t.Area(id).Holder
+}
+
+// Areas returns copies of the areas by id.
+func (t *Territory) Areas() []TerritoryArea {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list := make([]TerritoryArea, 0, len(t.areas))
+	for _, a := range t.areas {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Capture makes holder hold an area until expires.
+func (t *Territory) Capture(id, holder int, expires time.Time) error {
+	return t.set(id, holder, null.TimeFrom(expires))
+}
+
+// Release makes nobody hold an area.
+func (t *Territory) Release(id int) error {
+	return t.set(id, 0, t.Area(id).ExpiresAt)
+}
+
+func (t *Territory) set(id, holder int, expires null.Time) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	a := t.areas[id]
+	if a == nil {
+		return fmt.Errorf("%s has no area %d", t.Kind, id)
+	}
+
+	query := fmt.Sprintf(`update %s set %s = $1, expires_at = $2 where id = $3`, t.table, t.holder)
+	if _, err := db.Exec(query, holder, expires, id); err != nil {
+		return fmt.Errorf("set: %s", err.Error())
+	}
+	a.Holder, a.ExpiresAt = holder, expires
+	return nil
+}
+
+// AreaOfMob returns the area whose statue is the npc, 0 when there is none.
+func (t *Territory) AreaOfMob(npcID int) int {
+	for i, id := range t.Mobs {
+		if id == npcID {
+			return i + 1
+		}
+	}
+	return 0
+}
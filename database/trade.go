@@ -1,28 +1,59 @@
 package database
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	gorp "gopkg.in/gorp.v1"
+	"gopkg.in/guregu/null.v3"
+)
 
 var (
 	Trades = make(map[string]*Trade)
 	tMutex sync.RWMutex
+
+	ErrTradeItemChanged   = errors.New("trade item changed")
+	ErrTradeNotEnoughGold = errors.New("not enough gold for the trade")
+	ErrTradeInventoryFull = errors.New("not enough inventory space for the trade")
 )
 
 type Trade struct {
 	Sender     *Trader
 	Receiver   *Trader
 	Completing bool
+
+	mutex sync.Mutex
 }
 
 type Trader struct {
 	Character *Character
-	Slots     map[int16]int16
+	Items     map[int16]*TradeItem // by trade slot
 	Gold      uint64
 	Accepted  bool
 }
 
+// TradeItem is an offered item as it was when it was offered. The trade is
+// rejected when the slot holds another item or the item changed since.
+type TradeItem struct {
+	SlotID   int16
+	ID       int
+	UID      string
+	Revision int64
+}
+
+// TradeMove is an item that changed hands in a settled trade, Item is the
+// slot as it is in the inventory of To.
+type TradeMove struct {
+	From, To         *Character
+	FromSlot, ToSlot int16
+	Item             *InventorySlot
+}
+
 func (t *Trade) New(sender, receiver *Character) {
-	t.Sender = &Trader{Character: sender, Slots: make(map[int16]int16)}
-	t.Receiver = &Trader{Character: receiver, Slots: make(map[int16]int16)}
+	t.Sender = &Trader{Character: sender, Items: make(map[int16]*TradeItem)}
+	t.Receiver = &Trader{Character: receiver, Items: make(map[int16]*TradeItem)}
 
 	tMutex.Lock()
 	defer tMutex.Unlock()
@@ -52,3 +83,252 @@ func FindTrade(c *Character) *Trade {
 
 	return t
 }
+
+// Accept sets whether the trader of c accepts the trade, a trader that
+// does not takes back the acceptance of the partner too. Settle is true for
+// the one call that makes both accept, which then settles the trade. Ok is
+// false while the trade is being settled.
+func (t *Trade) Accept(c *Character, accepted bool) (settle, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.Completing {
+		return false, false
+	}
+
+	trader, partner := t.Sender, t.Receiver
+	if t.Receiver.Character.UserID == c.UserID {
+		trader, partner = t.Receiver, t.Sender
+	}
+	trader.Accepted = accepted
+	if !accepted {
+		partner.Accepted = false
+	}
+
+	t.Completing = t.Sender.Accepted && t.Receiver.Accepted
+	return t.Completing, true
+}
+
+// Unaccept takes back the acceptance of both traders before an offer
+// changes and returns who had accepted. Ok is false while the trade is
+// being settled, the offer must not change then.
+func (t *Trade) Unaccept() (sender, receiver, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.Completing {
+		return false, false, false
+	}
+
+	sender, receiver = t.Sender.Accepted, t.Receiver.Accepted
+	t.Sender.Accepted, t.Receiver.Accepted = false, false
+	return sender, receiver, true
+}
+
+// trader returns the trader of c.
+func (t *Trade) trader(c *Character) *Trader {
+	if t.Receiver.Character.UserID == c.UserID {
+		return t.Receiver
+	}
+	return t.Sender
+}
+
+// Offer puts the item of slotID of c in the trade slot, false while the
+// trade is being settled.
+func (t *Trade) Offer(c *Character, tradeSlot, slotID int16, item *InventorySlot) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.Completing {
+		return false
+	}
+	trader := t.trader(c)
+	if trader.Items == nil {
+		trader.Items = make(map[int16]*TradeItem)
+	}
+	trader.Items[tradeSlot] = &TradeItem{SlotID: slotID, ID: item.ID, UID: item.UID, Revision: item.Revision}
+	return true
+}
+
+// Withdraw takes the item of the trade slot of c out of the trade, false
+// while the trade is being settled.
+func (t *Trade) Withdraw(c *Character, tradeSlot int16) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.Completing {
+		return false
+	}
+	delete(t.trader(c).Items, tradeSlot)
+	return true
+}
+
+func (t *Trade) IsCompleting() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.Completing
+}
+
+// Cancel removes the trade and tells both traders.
+func (t *Trade) Cancel() {
+	receiver, sender := t.Receiver.Character, t.Sender.Character
+	t.Delete()
+
+	resp := TRADE_CANCELLED
+	sender.Socket.Write(resp)
+	receiver.Socket.Write(resp)
+}
+
+// Settle moves the offered items and gold of both traders in one database
+// transaction. Every item row is checked to still belong to its trader and
+// is updated with an optimistic version check. The inventories and gold in
+// memory are changed only after the commit, so when Settle fails nothing
+// has changed.
+func (t *Trade) Settle() ([]*TradeMove, error) {
+	sender, receiver := t.Sender.Character, t.Receiver.Character
+
+	sender.AddingGold.Lock()
+	defer sender.AddingGold.Unlock()
+	receiver.AddingGold.Lock()
+	defer receiver.AddingGold.Unlock()
+
+	if sender.Gold < t.Sender.Gold || receiver.Gold < t.Receiver.Gold {
+		return nil, ErrTradeNotEnoughGold
+	}
+	senderGold := sender.Gold - t.Sender.Gold + t.Receiver.Gold
+	receiverGold := receiver.Gold - t.Receiver.Gold + t.Sender.Gold
+
+	moves, err := t.Sender.moves(receiver)
+	if err != nil {
+		return nil, err
+	}
+	rMoves, err := t.Receiver.moves(sender)
+	if err != nil {
+		return nil, err
+	}
+	moves = append(moves, rMoves...)
+
+	tr, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("Settle: %s", err.Error())
+	}
+
+	for _, m := range moves {
+		row := &InventorySlot{}
+		if err := tr.SelectOne(row, `select * from hops.items_characters where id = $1 for update`, m.Item.ID); err != nil {
+			tr.Rollback()
+			return nil, fmt.Errorf("%w: item %d: %s", ErrTradeItemChanged, m.Item.ID, err.Error())
+		}
+		if row.CharacterID.Int64 != int64(m.From.ID) || row.UserID.String != m.From.UserID || row.ItemID != m.Item.ItemID || row.UID != m.Item.UID || row.Consignment {
+			tr.Rollback()
+			return nil, fmt.Errorf("%w: item %d is not owned by %d", ErrTradeItemChanged, m.Item.ID, m.From.ID)
+		}
+
+		m.Item.UserID = null.StringFrom(m.To.UserID)
+		m.Item.CharacterID = null.IntFrom(int64(m.To.ID))
+		m.Item.SlotID = m.ToSlot
+		if err := m.Item.moveWithTransaction(tr); err != nil {
+			tr.Rollback()
+			return nil, fmt.Errorf("%w: item %d: %s", ErrTradeItemChanged, m.Item.ID, err.Error())
+		}
+		if err := recordItem(tr, ITEM_TRADED, m.Item, 0, m.From, m.To, ""); err != nil {
+			tr.Rollback()
+			return nil, fmt.Errorf("Settle: %s", err.Error())
+		}
+	}
+
+	golds := []struct {
+		c    *Character
+		gold uint64
+	}{{sender, senderGold}, {receiver, receiverGold}}
+	for _, g := range golds {
+		if _, err := tr.Exec(`update hops.characters set gold = $1 where id = $2`, g.gold, g.c.ID); err != nil {
+			tr.Rollback()
+			return nil, fmt.Errorf("Settle: %s", err.Error())
+		}
+	}
+
+	if err := tr.Commit(); err != nil {
+		return nil, fmt.Errorf("Settle: %s", err.Error())
+	}
+
+	for _, m := range moves {
+		slots, _ := m.From.InventorySlots()
+		*slots[m.FromSlot] = *NewSlot()
+	}
+	for _, m := range moves {
+		slots, _ := m.To.InventorySlots()
+		*slots[m.ToSlot] = *m.Item
+		m.Item = slots[m.ToSlot]
+		InventoryItems.Add(m.Item.ID, m.Item)
+	}
+
+	sender.Gold = senderGold
+	receiver.Gold = receiverGold
+	return moves, nil
+}
+
+// moveWithTransaction writes the new owner and slot of the item if the row
+// still has the version the item was read with, and bumps the version.
+func (slot *InventorySlot) moveWithTransaction(tr *gorp.Transaction) error {
+	query := `update hops.items_characters set user_id = $1, character_id = $2, slot_id = $3, version = version + 1
+		where id = $4 and version = $5`
+
+	res, err := tr.Exec(query, slot.UserID, slot.CharacterID, slot.SlotID, slot.ID, slot.Revision)
+	if err != nil {
+		return err
+	} else if n, _ := res.RowsAffected(); n != 1 {
+		return fmt.Errorf("version %d is out of date", slot.Revision)
+	}
+
+	slot.Revision++
+	return nil
+}
+
+// moves plans where the offered items of tr go in the inventory of to, in
+// the order of the trade slots. The items are copies, the inventories are
+// not changed. An item that is not the one offered, or changed since it was,
+// fails the trade.
+func (tr *Trader) moves(to *Character) ([]*TradeMove, error) {
+	if len(tr.Items) == 0 {
+		return nil, nil
+	}
+
+	slots, err := tr.Character.InventorySlots()
+	if err != nil {
+		return nil, err
+	}
+
+	freeSlots, err := to.FindFreeSlots(len(tr.Items))
+	if err != nil {
+		return nil, ErrTradeInventoryFull
+	}
+
+	tradeSlots := make([]int, 0, len(tr.Items))
+	for tradeSlot := range tr.Items {
+		tradeSlots = append(tradeSlots, int(tradeSlot))
+	}
+	sort.Ints(tradeSlots)
+
+	var moves []*TradeMove
+	offered := make(map[int16]bool)
+	for i, tradeSlot := range tradeSlots {
+		offer := tr.Items[int16(tradeSlot)]
+		slotID := offer.SlotID
+		if slotID < 0 || int(slotID) >= len(slots) || offered[slotID] {
+			return nil, ErrTradeItemChanged
+		}
+		offered[slotID] = true
+
+		item := *slots[slotID]
+		if item.ID == 0 || item.ItemID == 0 || item.CharacterID.Int64 != int64(tr.Character.ID) {
+			return nil, ErrTradeItemChanged
+		} else if item.ID != offer.ID || item.UID != offer.UID || item.Revision != offer.Revision {
+			return nil, fmt.Errorf("%w: item %d changed since it was offered", ErrTradeItemChanged, item.ID)
+		}
+
+		moves = append(moves, &TradeMove{From: tr.Character, To: to, FromSlot: slotID, ToSlot: freeSlots[i], Item: &item})
+	}
+
+	return moves, nil
+}
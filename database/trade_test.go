@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTradeAcceptSettlesOnce(t *testing.T) {
+	for n := 0; n < 100; n++ {
+		sender, receiver := &Character{ID: 1, UserID: "a"}, &Character{ID: 2, UserID: "b"}
+		trade := &Trade{Sender: &Trader{Character: sender}, Receiver: &Trader{Character: receiver}}
+
+		var wg sync.WaitGroup
+		settles := make(chan bool, 2)
+		for _, c := range []*Character{sender, receiver} {
+			wg.Add(1)
+			go func(c *Character) {
+				defer wg.Done()
+				settle, _ := trade.Accept(c, true)
+				settles <- settle
+			}(c)
+		}
+		wg.Wait()
+
+		if (<-settles) == (<-settles) {
+			t.Fatal("both or neither of the traders settle")
+		}
+		if _, _, ok := trade.Unaccept(); ok {
+			t.Fatal("offer changed while the trade is settled")
+		}
+		if _, ok := trade.Accept(sender, false); ok {
+			t.Fatal("acceptance taken back while the trade is settled")
+		}
+	}
+}
+
+func TestTradeItemChanged(t *testing.T) {
+	inventory := func() []*InventorySlot {
+		slots := make([]*InventorySlot, 67)
+		for i := range slots {
+			slots[i] = NewSlot()
+		}
+		return slots
+	}
+	sender, receiver := &Character{ID: 1, UserID: "a"}, &Character{ID: 2, UserID: "b"}
+	sender.inventory, receiver.inventory = inventory(), inventory()
+	sender.inventory[11] = &InventorySlot{ID: 5, ItemID: 100, Quantity: 1, UID: "sword", Revision: 3, CharacterID: null.IntFrom(1)}
+
+	trade := &Trade{Sender: &Trader{Character: sender}, Receiver: &Trader{Character: receiver}}
+	trade.Offer(sender, 0, 11, sender.inventory[11])
+	if moves, err := trade.Sender.moves(receiver); err != nil || len(moves) != 1 {
+		t.Fatalf("got %v, %v for the offered item", moves, err)
+	}
+
+	// upgraded after it was offered
+	sender.inventory[11].Revision++
+	if _, err := trade.Sender.moves(receiver); !errors.Is(err, ErrTradeItemChanged) {
+		t.Errorf("got %v for a changed item", err)
+	}
+
+	// swapped for another item
+	sender.inventory[11] = &InventorySlot{ID: 6, ItemID: 100, Quantity: 1, UID: "other", Revision: 3, CharacterID: null.IntFrom(1)}
+	if _, err := trade.Sender.moves(receiver); !errors.Is(err, ErrTradeItemChanged) {
+		t.Errorf("got %v for a swapped item", err)
+	}
+}
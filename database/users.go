@@ -293,6 +293,12 @@ func (u *User) Logout() {
 	go u.Update()
 }
 
+func AddUserToCache(u *User) {
+	userMutex.Lock()
+	defer userMutex.Unlock()
+	users[u.ID] = u
+}
+
 func DeleteUserFromCache(id string) {
 	userMutex.Lock()
 	defer userMutex.Unlock()
@@ -1,12 +1,6 @@
 package database
 
 import (
-	"fmt"
-	"os"
-	"time"
-
-	"hero-server/messaging"
-
 	"hero-server/utils"
 )
 
@@ -15,343 +9,137 @@ var (
 	WAR_SCOREPANEL = utils.Packet{0xAA, 0x55, 0x30, 0x00, 0x65, 0x06, 0x55, 0xAA}
 )
 
-func CheckALlPlayersReady() {
-	timein := time.Now().Add(time.Minute * 1)
-	deadtime := timein.Format(time.RFC3339)
-
-	v, err := time.Parse(time.RFC3339, deadtime)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	for range time.Tick(1 * time.Second) {
-		readyShaoPlayers := 0
-		readyZuhangPlayers := 0
-		timeRemaining := getTimeRemaining(v)
-		if timeRemaining.t <= 0 {
-			for _, char := range ActiveWars[int(1)].ShaoPlayers {
-				if !char.IsAcceptedWar {
-					ActiveWars[int(1)].RemoveLobbyShao(char)
-					delete(LobbyCharacters, char.ID)
-					char.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You missed the ready check. You kicked from the lobby")))
-				}
-				char.IsAcceptedWar = false
-			}
-			for _, char := range ActiveWars[int(1)].ZuhangPlayers {
-				if !char.IsAcceptedWar {
-					ActiveWars[int(1)].RemoveLobbyZuhang(char)
-					delete(LobbyCharacters, char.ID)
-					char.Socket.Write(messaging.InfoMessage(fmt.Sprintf("You missed the ready check. You kicked from the lobby")))
-				}
-				char.IsAcceptedWar = false
-			}
-			break
-		}
-		for _, char := range ActiveWars[int(1)].ShaoPlayers {
-			if char.IsAcceptedWar {
-				readyShaoPlayers++
-			}
-		}
-		for _, char := range ActiveWars[int(1)].ZuhangPlayers {
-			if char.IsAcceptedWar {
-				readyZuhangPlayers++
-			}
-		}
-		if readyZuhangPlayers >= WarRequirePlayers/2 && readyShaoPlayers >= WarRequirePlayers/2 {
-			for _, char := range ActiveWars[int(1)].ZuhangPlayers {
-				x := 75.0
-				y := 45.0
-				char.IsinWar = true
-				OrderCharacters[char.ID] = char
-				data, _ := char.ChangeMap(230, ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-				char.Socket.Write(data)
-			}
-			for _, char := range ActiveWars[int(1)].ShaoPlayers {
-				x := 81.0
-				y := 475.0
-				char.IsinWar = true
-				ShaoCharacters[char.ID] = char
-				data, _ := char.ChangeMap(230, ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-				char.Socket.Write(data)
-			}
-			StartWarTimer(int(60))
-			break
+// warTimerMenu is the bar of the great war with the members, points and
+// stones of both sides and the seconds left.
+func warTimerMenu(b *Battleground) utils.Packet {
+	shaoStones := 0
+	ZuhangStones := 0
+	for _, stones := range WarStones {
+		if stones.ConqueredID == 1 {
+			ZuhangStones++
+		} else if stones.ConqueredID == 2 {
+			shaoStones++
 		}
 	}
-}
 
-func (self *ActiveWar) RemoveLobbyShao(char *Character) {
-	for i, other := range self.ShaoPlayers {
-		if other == char {
-			self.ShaoPlayers = append(self.ShaoPlayers[:i], self.ShaoPlayers[i+1:]...)
-			break
-		}
-	}
-}
-func (self *ActiveWar) RemoveLobbyZuhang(char *Character) {
-	for i, other := range self.ZuhangPlayers {
-		if other == char {
-			self.ZuhangPlayers = append(self.ZuhangPlayers[:i], self.ZuhangPlayers[i+1:]...)
-			break
-		}
-	}
-}
-
-func StartInWarTimer() {
-	timein := time.Now().Add(time.Minute * 20)
-	deadtime := timein.Format(time.RFC3339)
-
-	v, err := time.Parse(time.RFC3339, deadtime)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	for range time.Tick(1 * time.Second) {
-		timeRemaining := getTimeRemaining(v)
-		if timeRemaining.t <= 0 || OrderPoints <= 0 || ShaoPoints <= 0 {
-			WarStarted = false
-			WarScorePanel()
-			ResetWar()
-			break
-		}
-		timeCounters := CalculateWarCountdown(timeRemaining)
-		data := utils.IntToBytes(uint64(timeCounters), 4, true)
-		shaoStones := 0
-		ZuhangStones := 0
-		index := 7
-		resp := TIMER_MENU
-		byteOrders := utils.IntToBytes(uint64(len(OrderCharacters)), 4, true)
-		ordersPoint := utils.IntToBytes(uint64(OrderPoints), 4, true)
-		byteShaos := utils.IntToBytes(uint64(len(ShaoCharacters)), 4, true)
-		shaoPoint := utils.IntToBytes(uint64(ShaoPoints), 4, true)
+	data := utils.IntToBytes(uint64(b.Left()), 4, true)
+	index := 7
+	resp := TIMER_MENU
+	byteOrders := utils.IntToBytes(uint64(len(b.Members(1))), 4, true)
+	ordersPoint := utils.IntToBytes(uint64(b.Score(1)), 4, true)
+	byteShaos := utils.IntToBytes(uint64(len(b.Members(2))), 4, true)
+	shaoPoint := utils.IntToBytes(uint64(b.Score(2)), 4, true)
+	resp.Insert(byteOrders, index)
+	index += 4
+	resp.Insert(ordersPoint, index)
+	index += 4
+	resp.Insert([]byte{0x00, 0x00, 0x00, 0x00}, index)
+	index += 4
+	if ZuhangStones > 0 {
+		resp.Insert(utils.IntToBytes(uint64(ZuhangStones), 1, false), index)
+		index++
 		for _, stones := range WarStones {
 			if stones.ConqueredID == 1 {
-				ShaoPoints -= 2
-				ZuhangStones++
-			} else if stones.ConqueredID == 2 {
-				OrderPoints -= 2
-				shaoStones++
+				resp.Insert(utils.IntToBytes(uint64(stones.NpcID), 4, true), index)
+				index += 4
 			}
 		}
-		resp.Insert(byteOrders, index)
-		index += 4
-		resp.Insert(ordersPoint, index)
-		index += 4
-		resp.Insert([]byte{0x00, 0x00, 0x00, 0x00}, index)
-		index += 4
-		if ZuhangStones > 0 {
-			resp.Insert(utils.IntToBytes(uint64(ZuhangStones), 1, false), index)
-			index++
-			for _, stones := range WarStones {
-				if stones.ConqueredID == 1 {
-					resp.Insert(utils.IntToBytes(uint64(stones.NpcID), 4, true), index)
-					index += 4
-				}
+		resp.Insert([]byte{0x00}, index)
+		index++
+	} else {
+		resp.Insert([]byte{0x00, 0x00}, index) //IDE JÖN MAJD HOGY KINEK HÁNY KÖVE VAN
+		index += 2
+	}
+	resp.Insert(byteShaos, index)
+	index += 4
+	resp.Insert(shaoPoint, index)
+	index += 4
+	resp.Insert([]byte{0x00, 0x00, 0x00, 0x00}, index)
+	index += 4
+	if shaoStones >= 1 {
+		resp.Insert(utils.IntToBytes(uint64(shaoStones), 1, false), index)
+		index++
+		for _, stones := range WarStones {
+			if stones.ConqueredID == 2 {
+				resp.Insert(utils.IntToBytes(uint64(stones.NpcID), 4, true), index)
+				index += 4
 			}
-			resp.Insert([]byte{0x00}, index)
-			index++
-		} else {
-			resp.Insert([]byte{0x00, 0x00}, index) //IDE JÖN MAJD HOGY KINEK HÁNY KÖVE VAN
-			index += 2
 		}
-		resp.Insert(byteShaos, index)
-		index += 4
-		resp.Insert(shaoPoint, index)
-		index += 4
-		resp.Insert([]byte{0x00, 0x00, 0x00, 0x00}, index)
-		index += 4
-		if shaoStones >= 1 {
-			resp.Insert(utils.IntToBytes(uint64(shaoStones), 1, false), index)
-			index++
-			for _, stones := range WarStones {
-				if stones.ConqueredID == 2 {
-					resp.Insert(utils.IntToBytes(uint64(stones.NpcID), 4, true), index)
-					index += 4
-				}
+	} else {
+		resp.Insert([]byte{0x00}, index-2)
+		index++
+	}
+	resp.Insert(data, index)
+	index += 4
+	/*resp.Insert(data2, index)
+	index++*/
+	length := index - 4
+	resp.SetLength(int16(length))
+	return resp
+}
+
+// conquerWarStones moves the stones of the great war towards the side with
+// more members near them.
+func conquerWarStones() {
+	for _, stones := range WarStones {
+		if len(stones.NearbyZuhangV) > len(stones.NearbyShaoV) {
+			if stones.ConquereValue > 0 {
+				stones.ConquereValue--
 			}
-		} else {
-			resp.Insert([]byte{0x00}, index-2)
-			index++
-		}
-		resp.Insert(data, index)
-		index += 4
-		/*resp.Insert(data2, index)
-		index++*/
-		length := index - 4
-		resp.SetLength(int16(length))
-		for _, char := range OrderCharacters {
-			if char != nil && char.Socket.Conn != nil {
-				if char.IsOnline {
-					char.Socket.Write(resp)
-				} else {
-					delete(OrderCharacters, char.ID)
-				}
+			if stones.ConquereValue >= 0 && stones.ConquereValue <= 30 {
+				stones.ConqueredID = 1
+			} else if stones.ConquereValue > 170 {
+				stones.ConqueredID = 0
 			}
-		}
-		for _, char := range ShaoCharacters {
-			if char != nil && char.Socket.Conn != nil {
-				if char.IsOnline {
-					char.Socket.Write(resp)
-				} else {
-					delete(ShaoCharacters, char.ID)
-				}
+		} else if len(stones.NearbyShaoV) > len(stones.NearbyZuhangV) {
+			if stones.ConquereValue < 200 {
+				stones.ConquereValue++
 			}
-		}
-		for _, stones := range WarStones {
-			if len(stones.NearbyZuhangV) > len(stones.NearbyShaoV) {
-				if stones.ConquereValue > 0 {
-					stones.ConquereValue--
-				}
-				if stones.ConquereValue >= 0 && stones.ConquereValue <= 30 {
-					stones.ConqueredID = 1
-				} else if stones.ConquereValue > 170 {
-					stones.ConqueredID = 0
-				}
-			} else if len(stones.NearbyShaoV) > len(stones.NearbyZuhangV) {
-				if stones.ConquereValue < 200 {
-					stones.ConquereValue++
-				}
-				if stones.ConquereValue >= 170 && stones.ConquereValue <= 200 {
-					stones.ConqueredID = 2
-				} else if stones.ConquereValue < 30 {
-					stones.ConqueredID = 0
-				}
+			if stones.ConquereValue >= 170 && stones.ConquereValue <= 200 {
+				stones.ConqueredID = 2
+			} else if stones.ConquereValue < 30 {
+				stones.ConqueredID = 0
 			}
 		}
 	}
 }
 
-type countdown struct {
-	t int
-	d int
-	h int
-	m int
-	s int
-}
-
-func WarScorePanel() {
-	zuhang_nyert := false
+// warScorePanel is the result of the great war with the contribution and
+// kills of every member, the rewards are given from the reward table.
+func warScorePanel(b *Battleground) utils.Packet {
 	resp := WAR_SCOREPANEL
 	index := 6
-	if OrderPoints > ShaoPoints {
+	if b.Score(1) > b.Score(2) {
 		resp.Insert([]byte{0x00, 0x28, 0x00}, index)
 	} else {
 		resp.Insert([]byte{0x01, 0x28, 0x00}, index)
 	}
-	if OrderPoints > ShaoPoints {
-		zuhang_nyert = true
-	}
 	index += 3
 
-	for _, char := range OrderCharacters {
-		if char != nil {
-			resp.Insert(utils.IntToBytes(uint64(len(char.Name)), 1, false), index)
-			index++
-			resp.Insert([]byte(char.Name), index)
-			index += len(char.Name)
-			resp.Insert(utils.IntToBytes(uint64(char.Faction), 1, false), index)
-			index++
-			data := utils.IntToBytes(uint64(char.WarContribution), 3, true)
-			resp.Insert(data, index)
-			index += 3
-			resp.Insert([]byte{0x00}, index)
-			index++
-			data2 := utils.IntToBytes(uint64(char.WarKillCount), 3, true)
-			resp.Insert(data2, index)
-			index += 3
-			resp.Insert([]byte{0x00}, index)
-			index++
-			if zuhang_nyert {
-				item := &InventorySlot{ItemID: 99009117, Quantity: uint(1)}
-				r, _, err := char.AddItem(item, -1, false)
-				if err == nil {
-					char.Socket.Stats.Honor += 24
-					r.Concat(messaging.InfoMessage(fmt.Sprintf("You acquired 24 Honor points.")))
-					char.Socket.Write(*r)
-					infection := BuffInfections[70020]
-					buff := &Buff{ID: int(70020), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 30, StartedAt: char.Epoch, Duration: 14400, CanExpire: true}
-					buff.Create()
-					char.ExpMultiplier += 0.3
-				}
-			} else {
-				item := &InventorySlot{ItemID: 99009118, Quantity: uint(1)}
-				r, _, err := char.AddItem(item, -1, false)
-				if err == nil {
-					char.Socket.Stats.Honor += 17
-					r.Concat(messaging.InfoMessage(fmt.Sprintf("You acquired 17 Honor points.")))
-					char.Socket.Write(*r)
-					infection := BuffInfections[70021]
-					buff := &Buff{ID: int(70021), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, StartedAt: char.Epoch, Duration: 14400, CanExpire: true}
-					buff.Create()
-					char.ExpMultiplier += 0.15
-				}
-			}
-
-			go char.Update()
-		}
-	}
-
-	for _, char := range ShaoCharacters {
-		if char != nil {
-			resp.Insert(utils.IntToBytes(uint64(len(char.Name)), 1, false), index)
+	for _, side := range []int{1, 2} {
+		for _, m := range b.Members(side) {
+			resp.Insert(utils.IntToBytes(uint64(len(m.Name)), 1, false), index)
 			index++
-			resp.Insert([]byte(char.Name), index)
-			index += len(char.Name)
-			resp.Insert(utils.IntToBytes(uint64(char.Faction), 1, false), index)
+			resp.Insert([]byte(m.Name), index)
+			index += len(m.Name)
+			resp.Insert(utils.IntToBytes(uint64(m.Character.Faction), 1, false), index)
 			index++
-			data := utils.IntToBytes(uint64(char.WarContribution), 3, true)
+			data := utils.IntToBytes(uint64(m.Score), 3, true)
 			resp.Insert(data, index)
 			index += 3
 			resp.Insert([]byte{0x00}, index)
 			index++
-			data2 := utils.IntToBytes(uint64(char.WarKillCount), 3, true)
+			data2 := utils.IntToBytes(uint64(m.Kills), 3, true)
 			resp.Insert(data2, index)
 			index += 3
 			resp.Insert([]byte{0x00}, index)
 			index++
-			if !zuhang_nyert {
-				item := &InventorySlot{ItemID: 99009117, Quantity: uint(1)}
-				r, _, err := char.AddItem(item, -1, false)
-				if err == nil && r != nil {
-					char.Socket.Stats.Honor += 24
-					r.Concat(messaging.InfoMessage(fmt.Sprintf("You acquired 24 Honor points.")))
-					char.Socket.Write(*r)
-					infection := BuffInfections[70020]
-					buff := &Buff{ID: int(70020), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 30, StartedAt: char.Epoch, Duration: 14400, CanExpire: true}
-					buff.Create()
-					char.ExpMultiplier += 0.3
-				}
-			} else {
-				item := &InventorySlot{ItemID: 99009118, Quantity: uint(1)}
-				r, _, err := char.AddItem(item, -1, false)
-				if err == nil && r != nil {
-					char.Socket.Stats.Honor += 17
-					r.Concat(messaging.InfoMessage(fmt.Sprintf("You acquired 17 Honor points.")))
-					char.Socket.Write(*r)
-					infection := BuffInfections[70021]
-					buff := &Buff{ID: int(70021), CharacterID: char.ID, Name: infection.Name, EXPMultiplier: 15, StartedAt: char.Epoch, Duration: 14400, CanExpire: true}
-					buff.Create()
-					char.ExpMultiplier += 0.15
-				}
-			}
-			go char.Update()
 		}
 	}
 
 	length := index - 4
 	resp.SetLength(int16(length))
-	for _, char := range ShaoCharacters {
-		if char != nil {
-			char.Socket.Write(resp)
-		}
-	}
-	for _, char := range OrderCharacters {
-		if char != nil {
-			char.Socket.Write(resp)
-		}
-	}
-	//ResetWar()
+	return resp
 }
 
 func CalculateResult(number int) []int {
@@ -373,31 +161,8 @@ func CalculateResult(number int) []int {
 	return divCount
 }
 
-func CalculateWarCountdown(time countdown) int {
-	//remaining := time.t
-	return time.t
-}
-
 func divmod(numerator, denominator int64) (quotient, remainder int64) {
 	quotient = numerator / denominator // integer division, decimals are truncated
 	remainder = numerator % denominator
 	return
 }
-
-func getTimeRemaining(t time.Time) countdown {
-	currentTime := time.Now()
-	difference := t.Sub(currentTime)
-
-	total := int(difference.Seconds())
-	days := int(total / (60 * 60 * 24))
-	hours := int(total / (60 * 60) % 24)
-	minutes := int(total/60) % 60
-	seconds := int(total % 60)
-	return countdown{
-		t: total,
-		d: days,
-		h: hours,
-		m: minutes,
-		s: seconds,
-	}
-}
@@ -0,0 +1,79 @@
+package dungeon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hero-server/codec"
+	"hero-server/database"
+	"hero-server/nats"
+)
+
+// Start checks the party and sends it into an instance of the dungeon of
+// its own.
+func Start(d *database.Dungeon, party *database.Party) error {
+	if party == nil || party.Leader == nil {
+		return fmt.Errorf("Only a party leader can enter.")
+	}
+
+	list := party.Characters()
+	if err := d.Check(list); err != nil {
+		return err
+	}
+
+	i, err := database.OpenDungeonInstance(d)
+	if err != nil {
+		return err
+	}
+
+	// the party goes in together or not at all
+	for _, c := range list {
+		data, err := i.Enter(c)
+		if len(data) > 0 {
+			c.Socket.Write(data)
+		}
+		if err != nil {
+			i.Cancel(fmt.Sprintf("%s could not enter %s.", c.Name, d.Title))
+			return err
+		}
+	}
+
+	go run(i)
+	return nil
+}
+
+// run closes the instance once its objectives are done, its time is up or
+// everyone left it.
+func run(i *database.DungeonInstance) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		members := i.Members()
+		switch {
+		case len(members) == 0:
+			i.Close(database.DUNGEON_CLOSED, "")
+			return
+
+		case i.Completed():
+			names := make([]string, 0, len(members))
+			for _, c := range members {
+				names = append(names, c.Name)
+			}
+			i.Close(database.DUNGEON_COMPLETED, "You finished the dungeon successfully !")
+			makeAnnouncement(fmt.Sprintf("%s got pwned by: %s", i.Dungeon.Title, strings.Join(names, ", ")))
+			return
+
+		case i.Left() == 0:
+			i.Close(database.DUNGEON_TIMEOUT, "Your time has ended. Come again when you are stronger. Teleporting to safe zone.")
+			return
+		}
+	}
+}
+
+func makeAnnouncement(msg string) {
+	resp := codec.Encode(&codec.Announcement{Message: msg})
+	p := nats.CastPacket{CastNear: false, Data: resp}
+	p.Cast()
+}
@@ -1,11 +1,16 @@
 package factoy
 
 import (
+	"fmt"
 	"log"
 	dbg "runtime/debug"
+	"strconv"
+	"time"
 
 	"hero-server/auth"
+	"hero-server/codec"
 	"hero-server/database"
+	"hero-server/metrics"
 	"hero-server/npc"
 	"hero-server/player"
 	"hero-server/utils"
@@ -15,14 +20,19 @@ type Factory interface {
 	Handle(*database.Socket, []byte) ([]byte, error)
 }
 
+// MessageFactory handles a request decoded by the codec package.
+type MessageFactory interface {
+	HandleMessage(*database.Socket, codec.Request) ([]byte, error)
+}
+
 var (
+	packetDuration = metrics.NewHistogram("hero_packet_duration_seconds", "Duration of the packet handlers by opcode.", metrics.DURATION_BUCKETS, "opcode")
+
 	pkgTypes = map[uint16]Factory{
-		000:   &auth.LoginHandler{},
 		002:   &auth.ListServersHandler{},
 		004:   &auth.SelectServerHandler{},
 		257:   &auth.ListCharactersHandler{},
 		258:   &auth.CancelCharacterCreationHandler{},
-		259:   &auth.CharacterCreationHandler{},
 		261:   &auth.CharacterSelectionHandler{},
 		434:   &auth.CharacterDeletionHandler{},
 		441:   &player.InTacticalSpaceTPHandler{},
@@ -31,9 +41,6 @@ var (
 		2313:  &player.CharacterMenuHandler{},
 		4609:  &player.RespawnHandler{},
 		4612:  &player.RespawnHandler{},
-		8705:  &player.MovementHandler{},
-		8706:  &player.MovementHandler{},
-		9732:  &player.MovementHandler{},
 		10257: &player.OpenTacticalSpaceHandler{},
 		10753: &player.SendPvPRequestHandler{},
 		10754: &player.RespondPvPRequestHandler{},
@@ -58,14 +65,6 @@ var (
 		20994: &player.RespondPartyRequestHandler{},
 		20995: &player.LeavePartyHandler{},
 		20998: &player.ExpelFromPartyHandler{},
-		21249: &player.SendTradeRequestHandler{},
-		21250: &player.RespondTradeRequestHandler{},
-		21251: &player.CancelTradeHandler{},
-		21252: &player.AddTradeItemHandler{},
-		21254: &player.AddTradeGoldHandler{},
-		21256: &player.RemoveTradeItemHandler{},
-		21257: &player.AcceptTradeHandler{},
-		21506: &npc.StrengthenHandler{},
 		21508: &npc.ProductionHandler{},
 		21509: &npc.DismantleHandler{},
 		21510: &npc.ExtractionHandler{},
@@ -157,6 +156,33 @@ var (
 		47874: &player.TravelToFiveClanArea{},
 	}
 
+	msgTypes = map[uint16]MessageFactory{
+		codec.LOGIN:             &auth.LoginHandler{},
+		codec.CREATE_CHARACTER:  &auth.CharacterCreationHandler{},
+		codec.WALK:              &player.MovementHandler{},
+		codec.RUN:               &player.MovementHandler{},
+		codec.FLY:               &player.MovementHandler{},
+		codec.TRADE_REQUEST:     &player.SendTradeRequestHandler{},
+		codec.TRADE_RESPONSE:    &player.RespondTradeRequestHandler{},
+		codec.TRADE_CANCEL:      &player.CancelTradeHandler{},
+		codec.TRADE_ADD_ITEM:    &player.AddTradeItemHandler{},
+		codec.TRADE_ADD_GOLD:    &player.AddTradeGoldHandler{},
+		codec.TRADE_REMOVE_ITEM: &player.RemoveTradeItemHandler{},
+		codec.TRADE_ACCEPT:      &player.AcceptTradeHandler{},
+		codec.STRENGTHEN:        &npc.StrengthenHandler{},
+	}
+
+	// Requests which start something that can not be finished while the
+	// server is draining for a shutdown.
+	drainBlocked = map[uint16]bool{
+		15617: true, // register consignment item
+		15618: true, // buy consignment item
+		21249: true, // trade request
+		21250: true, // respond trade request
+		21761: true, // open sale
+		21764: true, // buy sale item
+	}
+
 	pkgTypes2 = map[byte]Factory{
 		40:  &player.EnterGateHandler{},
 		65:  &player.AttackHandler{},
@@ -168,11 +194,45 @@ var (
 	}
 )
 
+// opcodeLabel is the opcode of a packet in the metrics. Packets dispatched
+// by their first opcode byte are counted as one group, unknown opcodes
+// together.
+func opcodeLabel(pkgType uint16) string {
+	if _, ok := msgTypes[pkgType]; ok {
+		return strconv.Itoa(int(pkgType))
+	} else if _, ok := pkgTypes[pkgType]; ok {
+		return strconv.Itoa(int(pkgType))
+	} else if _, ok := pkgTypes2[byte(pkgType/256)]; ok {
+		return fmt.Sprintf("group_%d", pkgType/256)
+	}
+	return "unknown"
+}
+
 func init() {
 
+	for opcode := range msgTypes {
+		if !codec.Registered(opcode) {
+			log.Panicf("factory: no codec message registered for opcode %d", opcode)
+		}
+	}
+
 	database.Handler = func(s *database.Socket, data []byte, pkgType uint16) ([]byte, error) {
+		if !database.BeginHandle() {
+			return nil, nil
+		}
+		defer database.EndHandle()
+
+		if database.IsDraining() && drainBlocked[pkgType] {
+			return nil, nil
+		}
+
+		defer func(start time.Time) {
+			packetDuration.Observe(time.Since(start).Seconds(), opcodeLabel(pkgType))
+		}(time.Now())
+
 		defer func() {
 			if err := recover(); err != nil {
+				database.HandlerPanics.Inc("packet")
 				log.Println(err)
 				log.Printf("%+v", string(dbg.Stack()))
 
@@ -198,6 +258,15 @@ func init() {
 			}
 		}()
 
+		if msgHandler, ok := msgTypes[pkgType]; ok {
+			msg, err := codec.Decode(data)
+			if err != nil {
+				log.Printf("malformed packet: %s", err.Error())
+				return nil, nil
+			}
+			return msgHandler.HandleMessage(s, msg)
+		}
+
 		pkg, ok := pkgTypes[pkgType]
 		if ok {
 			return pkg.Handle(s, data)
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileSink writes events as json lines. When the file grows over maxSize
+// bytes it is renamed to path.1, the older files are shifted up to
+// path.<maxBackups> and the oldest is removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("NewFileSink: %s", err.Error())
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("NewFileSink: %s", err.Error())
+	}
+
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(events []*Event) error {
+	w := bufio.NewWriter(s.file)
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("FileSink: %s", err.Error())
+		}
+		data = append(data, '\n')
+
+		if s.maxSize > 0 && s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("FileSink: %s", err.Error())
+			}
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			w = bufio.NewWriter(s.file)
+		}
+
+		n, _ := w.Write(data)
+		s.size += int64(n)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("FileSink: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("FileSink: %s", err.Error())
+	}
+
+	if s.maxBackups > 0 {
+		os.Remove(backupPath(s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			os.Rename(backupPath(s.path, i), backupPath(s.path, i+1))
+		}
+		if err := os.Rename(s.path, backupPath(s.path, 1)); err != nil {
+			return fmt.Errorf("FileSink: %s", err.Error())
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("FileSink: %s", err.Error())
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
@@ -1,16 +1,14 @@
 package logging
 
 import (
-	"encoding/json"
 	"fmt"
 	glog "log"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"hero-server/redis"
-	"hero-server/utils"
-
 	"github.com/google/uuid"
-	"github.com/tidwall/gjson"
 )
 
 type Action byte
@@ -37,64 +35,197 @@ const (
 	ACTION_ADD_EXP
 	ACTION_EXP_RATE
 	ACTION_DROP_RATE
+	ACTION_CHAT
+	ACTION_CHAT_COMMAND
+	ACTION_REMOVE_ITEM
+	ACTION_CREATE_SOCKET
+	ACTION_UPGRADE_SOCKET
+	ACTION_REGISTER_CONS_ITEM
+	ACTION_BANK_DEPOSIT
+	ACTION_BANK_WITHDRAW
+	ACTION_BUY_HT_ITEM
+	ACTION_MOVEMENT_VIOLATION
+	ACTION_ADMIN_API
+)
+
+// actionNames are the names of the actions in the sinks and the query
+// command, indexed by action.
+var actionNames = []string{
+	"login", "select_server", "create_character", "delete_character", "start_game",
+	"upgrade_item", "production", "advanced_fusion", "dismantle", "extraction",
+	"trade", "buy_sale_item", "buy_cons_item", "claim_cons_item", "create_item",
+	"create_gold", "upgrade_gm_item", "add_ncash", "add_exp", "exp_rate",
+	"drop_rate", "chat", "chat_command", "remove_item", "create_socket",
+	"upgrade_socket", "register_cons_item", "bank_deposit", "bank_withdraw", "buy_ht_item",
+	"movement_violation", "admin_api",
+}
+
+const (
+	EVENT_QUEUE_SIZE     = 8192 // events waiting for the sinks, more are dropped
+	EVENT_BATCH_SIZE     = 256
+	EVENT_FLUSH_INTERVAL = time.Second
 )
 
 var (
-	Logger = &LoggerController{}
-	logs   = utils.NewMap()
+	queue   = make(chan *Event, EVENT_QUEUE_SIZE)
+	dropped uint64
+
+	sinks      []Sink
+	stop, done chan struct{}
+	sinksMutex sync.Mutex
 )
 
-type (
-	Log struct {
-		Action        Action    `json:"action,omitempty"`
-		CharacterID   string    `json:"character_id,omitempty"`
-		Date          time.Time `json:"date,omitempty"`
-		ID            string    `json:"id,omitempty"`
-		Message       string    `json:"message,omitempty"`
-		UserID        string    `json:"user_id,omitempty"`
-		CharacterName string    `json:"character_name,omitempty"`
+// Event is something a player or a gm did. The actor fields are left empty
+// when the event happened before a character was selected.
+type Event struct {
+	ID            string    `json:"id"`
+	Time          time.Time `json:"time"`
+	Action        Action    `json:"action"`
+	UserID        string    `json:"user_id,omitempty"`
+	CharacterID   int       `json:"character_id,omitempty"`
+	CharacterName string    `json:"character_name,omitempty"`
+	Map           int16     `json:"map,omitempty"`
+	X             float64   `json:"x,omitempty"`
+	Y             float64   `json:"y,omitempty"`
+	TargetID      int       `json:"target_id,omitempty"` // the other character of a trade, sale or gm command
+	ItemIDs       []int64   `json:"item_ids,omitempty"`
+	Gold          int64     `json:"gold,omitempty"` // change of the actor's gold
+	Message       string    `json:"message,omitempty"`
+}
+
+// Sink stores batches of events. Sinks are only called from the logging
+// goroutine, one batch at a time.
+type Sink interface {
+	Write(events []*Event) error
+	Close() error
+}
+
+func (a Action) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
 	}
+	return fmt.Sprintf("action_%d", a)
+}
 
-	LoggerController struct{}
-)
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
 
-func (l *LoggerController) Log(action Action, characterID int, message, userID, chrName string) {
+func (a *Action) UnmarshalText(text []byte) error {
+	action, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*a = action
+	return nil
+}
 
-	log := &Log{
-		Action:        action,
-		Date:          time.Now(),
-		ID:            uuid.New().String(),
-		Message:       message,
-		UserID:        userID,
-		CharacterName: chrName,
+func ParseAction(name string) (Action, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range actionNames {
+		if n == name {
+			return Action(i), nil
+		}
 	}
-	if characterID > 0 {
-		log.CharacterID = fmt.Sprintf("%d", characterID)
+	return 0, fmt.Errorf("unknown action: %s", name)
+}
+
+// Emit queues e for the sinks. It never blocks: when the queue is full the
+// event is dropped and counted.
+func Emit(e *Event) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
 	}
 
-	data, err := json.Marshal(log)
-	if err != nil {
-		glog.Println("Log error:", err)
+	select {
+	case queue <- e:
+	default:
+		atomic.AddUint64(&dropped, 1)
+	}
+}
+
+// Dropped returns the number of events dropped since the start.
+func Dropped() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+// Start writes the emitted events to s until Close is called.
+func Start(s ...Sink) {
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
+
+	if stop != nil {
 		return
 	}
 
-	logs.Add(log.ID, data)
+	sinks = s
+	stop, done = make(chan struct{}), make(chan struct{})
+	go run(sinks, stop, done)
 }
 
-func (l *LoggerController) StartLogging() {
+// Close writes the queued events and closes the sinks.
+func Close() {
+	sinksMutex.Lock()
+	defer sinksMutex.Unlock()
 
-	logData := logs.PopValues()
-	for _, data := range logData {
-		log := data.([]byte)
-		id := gjson.Get(string(log), "id").String()
+	if stop == nil {
+		return
+	}
 
-		err := redis.Set(id, log)
-		if err != nil {
-			glog.Println(err)
+	close(stop)
+	<-done
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			glog.Println("Logging error:", err)
 		}
 	}
+	sinks, stop, done = nil, nil, nil
+}
+
+func run(sinks []Sink, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(EVENT_FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	var batch []*Event
+	var reported uint64
+	for {
+		select {
+		case e := <-queue:
+			if batch = append(batch, e); len(batch) < EVENT_BATCH_SIZE {
+				continue
+			}
+		case <-ticker.C:
+		case <-stop:
+			for len(queue) > 0 {
+				batch = append(batch, <-queue)
+			}
+			write(sinks, batch)
+			return
+		}
 
-	time.AfterFunc(time.Second*10, func() {
-		l.StartLogging()
-	})
+		write(sinks, batch)
+		batch = nil
+
+		if n := Dropped(); n > reported {
+			glog.Printf("Logging: %d events dropped, the queue is full", n-reported)
+			reported = n
+		}
+	}
+}
+
+func write(sinks []Sink, batch []*Event) {
+	if len(batch) == 0 {
+		return
+	}
+
+	for _, s := range sinks {
+		if err := s.Write(batch); err != nil {
+			glog.Println("Logging error:", err)
+		}
+	}
 }
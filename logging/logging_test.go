@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	sync.Mutex
+	events []*Event
+	closed bool
+}
+
+func (s *memorySink) Write(events []*Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestEmitWritesQueuedEventsOnClose(t *testing.T) {
+	sink := &memorySink{}
+	Start(sink)
+
+	for i := 0; i < 10; i++ {
+		Emit(&Event{Action: ACTION_CHAT, CharacterID: i})
+	}
+	Close()
+
+	if len(sink.events) != 10 || !sink.closed {
+		t.Fatalf("got %d events (closed: %t), want 10", len(sink.events), sink.closed)
+	}
+	for i, e := range sink.events {
+		if e.CharacterID != i || e.ID == "" || e.Time.IsZero() {
+			t.Errorf("event %d: %+v", i, e)
+		}
+	}
+}
+
+func TestActionJSON(t *testing.T) {
+	data, err := json.Marshal(&Event{Action: ACTION_BUY_CONS_ITEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Event{}
+	if err := json.Unmarshal(data, e); err != nil {
+		t.Fatal(err)
+	} else if e.Action != ACTION_BUY_CONS_ITEM {
+		t.Fatalf("%s decoded to %s", data, e.Action)
+	}
+
+	if len(actionNames) != int(ACTION_ADMIN_API)+1 {
+		t.Fatalf("%d action names for %d actions", len(actionNames), ACTION_ADMIN_API+1)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var events []*Event
+	for i := 0; i < 40; i++ {
+		events = append(events, &Event{ID: "id", Time: start.Add(time.Duration(i) * time.Minute), Action: ACTION_TRADE, CharacterID: i % 4, ItemIDs: []int64{int64(i)}})
+	}
+
+	s, err := NewFileSink(path, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if err := s.Write([]*Event{e}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		} else if info.Size() > 1024 {
+			t.Errorf("%s has %d bytes", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backup over the limit: %v", err)
+	}
+
+	all, err := ReadFiles(path, &Filter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || len(all) >= len(events) || all[len(all)-1].ItemIDs[0] != 39 {
+		t.Fatalf("read %d events, want the last ones of %d", len(all), len(events))
+	}
+	for i := 1; i < len(all); i++ {
+		if !all[i-1].Time.Before(all[i].Time) {
+			t.Fatalf("events are not in order at %d", i)
+		}
+	}
+
+	filter := &Filter{CharacterID: 2, Actions: []Action{ACTION_TRADE}, Since: start.Add(30 * time.Minute)}
+	got, err := ReadFiles(path, filter, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ItemIDs[0] != 34 || got[1].ItemIDs[0] != 38 {
+		t.Fatalf("got %+v", got)
+	}
+
+	if got, _ := ReadFiles(path, &Filter{ItemID: 39, Actions: []Action{ACTION_CHAT}}, 0); len(got) != 0 {
+		t.Fatalf("action filter matched %d events", len(got))
+	}
+}
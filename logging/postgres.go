@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PostgresSink inserts events into hops.events.
+type PostgresSink struct {
+	db *sql.DB
+}
+
+func NewPostgresSink(db *sql.DB) *PostgresSink {
+	return &PostgresSink{db: db}
+}
+
+func (s *PostgresSink) Write(events []*Event) error {
+	columns := 13
+	query := strings.Builder{}
+	query.WriteString(`insert into hops.events (id, time, action, user_id, character_id, character_name, map, x, y, target_id, item_ids, gold, message) values `)
+
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, e := range events {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := 1; j <= columns; j++ {
+			if j > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", i*columns+j)
+		}
+		query.WriteString(")")
+
+		itemIDs := e.ItemIDs
+		if itemIDs == nil {
+			itemIDs = []int64{}
+		}
+		args = append(args, e.ID, e.Time, e.Action.String(), e.UserID, e.CharacterID, e.CharacterName,
+			e.Map, e.X, e.Y, e.TargetID, pq.Array(itemIDs), e.Gold, e.Message)
+	}
+
+	if _, err := s.db.Exec(query.String(), args...); err != nil {
+		return fmt.Errorf("PostgresSink: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *PostgresSink) Close() error {
+	return nil
+}
+
+// QueryPostgres returns the last limit events of hops.events matching f,
+// oldest first.
+func QueryPostgres(db *sql.DB, f *Filter, limit int) ([]*Event, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID != "" {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.CharacterID != 0 {
+		add("(character_id = $%[1]d or target_id = $%[1]d)", f.CharacterID)
+	}
+	if f.CharacterName != "" {
+		add("lower(character_name) = lower($%d)", f.CharacterName)
+	}
+	if len(f.Actions) > 0 {
+		names := make([]string, len(f.Actions))
+		for i, a := range f.Actions {
+			names[i] = a.String()
+		}
+		add("action = any($%d)", pq.Array(names))
+	}
+	if f.ItemID != 0 {
+		add("$%d = any(item_ids)", f.ItemID)
+	}
+	if !f.Since.IsZero() {
+		add("time >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("time < $%d", f.Until)
+	}
+
+	query := `select id, time, action, user_id, character_id, character_name, map, x, y, target_id, item_ids, gold, message from hops.events`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by time desc"
+	if limit > 0 {
+		query += fmt.Sprintf(" limit %d", limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("QueryPostgres: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		e, action := &Event{}, ""
+		if err := rows.Scan(&e.ID, &e.Time, &action, &e.UserID, &e.CharacterID, &e.CharacterName, &e.Map, &e.X, &e.Y,
+			&e.TargetID, pq.Array(&e.ItemIDs), &e.Gold, &e.Message); err != nil {
+			return nil, fmt.Errorf("QueryPostgres: %s", err.Error())
+		}
+		if e.Action, err = ParseAction(action); err != nil {
+			return nil, fmt.Errorf("QueryPostgres: %s", err.Error())
+		}
+		events = append([]*Event{e}, events...)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("QueryPostgres: %s", err.Error())
+	}
+	return events, nil
+}
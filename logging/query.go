@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Filter selects events for the query command, zero fields match every
+// event.
+type Filter struct {
+	UserID        string
+	CharacterID   int
+	CharacterName string // case insensitive
+	Actions       []Action
+	ItemID        int64
+	Since, Until  time.Time
+}
+
+func (f *Filter) Match(e *Event) bool {
+	if f.UserID != "" && e.UserID != f.UserID {
+		return false
+	}
+	if f.CharacterID != 0 && e.CharacterID != f.CharacterID && e.TargetID != f.CharacterID {
+		return false
+	}
+	if f.CharacterName != "" && !strings.EqualFold(e.CharacterName, f.CharacterName) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+
+	if len(f.Actions) > 0 {
+		found := false
+		for _, a := range f.Actions {
+			found = found || a == e.Action
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.ItemID != 0 {
+		found := false
+		for _, id := range e.ItemIDs {
+			found = found || id == f.ItemID
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReadFiles returns the last limit events matching f from the json lines
+// file at path and its rotated backups, oldest first. A limit of 0 returns
+// every match.
+func ReadFiles(path string, f *Filter, limit int) ([]*Event, error) {
+	paths := []string{path}
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupPath(path, i)); err != nil {
+			break
+		}
+		paths = append([]string{backupPath(path, i)}, paths...)
+	}
+
+	var events []*Event
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("ReadFiles: %s", err.Error())
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			e := &Event{}
+			if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("ReadFiles: %s:%d: %s", p, line, err.Error())
+			}
+
+			if f.Match(e) {
+				events = append(events, e)
+				if limit > 0 && len(events) > limit {
+					events = events[1:]
+				}
+			}
+		}
+
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ReadFiles: %s", err.Error())
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"hero-server/redis"
+)
+
+// RedisSink adds events to a redis stream, each entry has the action and
+// the event as json.
+type RedisSink struct {
+	stream string
+	maxLen int64
+}
+
+func NewRedisSink(stream string, maxLen int64) *RedisSink {
+	return &RedisSink{stream: stream, maxLen: maxLen}
+}
+
+func (s *RedisSink) Write(events []*Event) error {
+	entries := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("RedisSink: %s", err.Error())
+		}
+		entries = append(entries, map[string]interface{}{"action": e.Action.String(), "event": data})
+	}
+
+	if err := redis.XAdd(s.stream, s.maxLen, entries...); err != nil {
+		return fmt.Errorf("RedisSink: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *RedisSink) Close() error {
+	return nil
+}
@@ -1,22 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	_ "strings"
+	"syscall"
 	"time"
 
 	_ "hero-server/factory"
-	_ "hero-server/security"
 
 	"hero-server/ai"
 	"hero-server/config"
 	"hero-server/database"
 	"hero-server/logging"
 	"hero-server/nats"
+	"hero-server/redis"
+	"hero-server/security"
 	"hero-server/web"
 
 	"github.com/robfig/cron"
@@ -26,7 +30,10 @@ import (
 	_ "github.com/KimMachineGun/automemlimit"
 )
 
-//var logger = logging.Logger
+var (
+	listener     net.Listener
+	shutdownDone = make(chan struct{})
+)
 
 func initDatabase() {
 	for {
@@ -40,30 +47,33 @@ func initDatabase() {
 	}
 }
 
-/*
-func initRedis() {
-	for {
-		err := redis.InitRedis()
+// initLogging starts the event log with the sinks of the config, after the
+// database is connected.
+func initLogging() {
+	cfg := config.Default.Events
+
+	var sinks []logging.Sink
+	if cfg.File != "" {
+		file, err := logging.NewFileSink(cfg.File, int64(cfg.MaxSize)<<20, cfg.MaxBackups)
 		if err != nil {
-			log.Printf("Redis connection error: %+v, waiting 30 sec...", err)
-			time.Sleep(time.Duration(30) * time.Second)
-			continue
+			log.Fatalln(err)
 		}
+		sinks = append(sinks, file)
+	}
 
-		log.Printf("Connected to redis...")
-		go logger.StartLogging()
-
-
-			if redisHost := os.Getenv("REDIS_HOST"); redisHost != "" {
-				log.Printf("Connected to redis...")
-				go logger.StartLogging()
-			}
-
+	if cfg.Postgres {
+		sinks = append(sinks, logging.NewPostgresSink(database.Connection()))
+	}
 
-		return
+	if cfg.Redis {
+		if err := redis.InitRedis(); err != nil {
+			log.Fatalln("Redis connection error:", err)
+		}
+		sinks = append(sinks, logging.NewRedisSink(cfg.Stream, cfg.StreamMaxLen))
 	}
+
+	logging.Start(sinks...)
 }
-*/
 
 func startServer() {
 	cfg := config.Default
@@ -74,83 +84,108 @@ func startServer() {
 		log.Fatalf("Socket listen port %d failed,%s", port, err)
 		os.Exit(1)
 	}
+	listener = listen
 	defer listen.Close()
 	log.Printf("Begin listen port: %d", port)
 
 	for {
 		conn, err := listen.Accept()
 		if err != nil {
-			log.Fatalln(err)
+			if database.IsDraining() {
+				return
+			}
+			log.Println(err)
 			continue
 		}
 
 		//API Security Check Start
 		/*
 			parsedIP := strings.Split(conn.RemoteAddr().String(), ":")
-			if parsedIP[0] == "" {
+			if !security.CheckPlayer(parsedIP[0]) {
 				conn.Close()
 				continue
 			}
+		*/
+		// API Security Check Finish
 
-			security.BannedIPsMutex.Lock()
-			val, have := security.BannedIPs[parsedIP[0]]
-			security.BannedIPsMutex.Unlock()
-			if have {
-				if val >= 10 {
-					conn.Close()
-					continue
-				}
+		// behind a proxy the client ip is only known after the proxy
+		// header, Socket.Read applies the connection limits then
+		ip := security.IP(conn.RemoteAddr().String())
+		proxied := os.Getenv("PROXY_ENABLED") == "1"
+		if !proxied && !security.OpenConnection(ip) {
+			conn.Close()
+			continue
+		}
+
+		ws := &database.Socket{Conn: conn}
+		go func() {
+			ws.Read()
+			if !proxied {
+				security.CloseConnection(ip)
 			}
+		}()
+	}
+}
 
-			if !security.CheckPlayer(parsedIP[0]) {
-				conn.Close()
+func handleSignals(natsServer interface{ Shutdown() }) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-				security.BannedIPsMutex.Lock()
-				tmpVal, tmpHave := security.BannedIPs[parsedIP[0]]
-				if tmpHave {
-					security.BannedIPs[parsedIP[0]] = tmpVal + 1
-				} else {
-					security.BannedIPs[parsedIP[0]] = tmpVal + 1
-				}
-				security.BannedIPsMutex.Unlock()
+	sig := <-sigs
+	log.Printf("Received %s, shutting down...", sig)
 
-				continue
-			}
-		*/
-		// API Security Check Finish
+	cfg := config.Default.Shutdown
+	database.StartDraining()
+	if listener != nil {
+		listener.Close()
+	}
 
-		/*
+	// second signal skips the countdown
+	countdown(cfg.Countdown, sigs)
 
-					//fmt.Println(parsedIP[0])
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	time.AfterFunc(timeout, func() {
+		log.Printf("Shutdown did not finish in %s, exiting.", timeout)
+		os.Exit(1)
+	})
 
-			for b := range BanList {
-				if parsedIP[0] == BanList[b] {
-					conn.Close()
-					continue
-				}
-			}
+	if !database.StopHandling(5 * time.Second) {
+		log.Println("Shutdown: some packet handlers are still running.")
+	}
 
-					parsedIP := strings.Split(conn.RemoteAddr().String(), ":")
-			if parsedIP[0] == "" {
-				conn.Close()
-				continue
-			}
+	if err := database.SaveOnlineCharacters(); err != nil {
+		log.Println(err)
+	} else {
+		log.Println("Shutdown: all online characters saved.")
+	}
 
-				if security.RemoteAddrs[parsedIP[0]] >= 3 {
-					fmt.Println("Multi Client: ", parsedIP[0])
-					conn.Close()
-					continue
-				}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := web.StopWebServer(ctx); err != nil {
+		log.Println("Shutdown: web server:", err)
+	}
 
+	logging.Close()
+	natsServer.Shutdown()
+	close(shutdownDone)
+}
 
+func countdown(seconds int, skip <-chan os.Signal) {
+	warnings := []int{300, 120, 60, 30, 10, 5, 4, 3, 2, 1}
 
-				connectionSize := security.RemoteAddrs[parsedIP[0]]
-				security.RemoteAddrs[parsedIP[0]] = connectionSize + 1
-		*/
+	for left := seconds; left > 0; left-- {
+		for _, w := range warnings {
+			if left == w {
+				database.MakeAnnouncement(fmt.Sprintf("Server will be shut down in %d seconds. Please log out safely.", left))
+				break
+			}
+		}
 
-		ws := database.Socket{Conn: conn, WriteChan: make(chan struct{}, 1)}
-		go ws.Read()
-		//go ws.WriteHandler()
+		select {
+		case <-skip:
+			return
+		case <-time.After(time.Second):
+		}
 	}
 }
 
@@ -163,54 +198,15 @@ func cronHandler() {
 		database.ResetDailyCheckIn()
 	})
 
-	c.AddFunc("@every 1m", func() {
-		beijingLoc, tmpErr := time.LoadLocation("Asia/Shanghai")
-		if tmpErr != nil {
-			fmt.Println("FAİL: Load Location err: ", tmpErr)
-			return
-		}
-
-		tmpNow := time.Now().In(beijingLoc).Hour()
-		tmpNowMin := time.Now().In(beijingLoc).Minute()
-
-		// Sabah
-		/*if tmpNow == 10 {
-			if tmpNowMin == 0 {
-				// Start non divine war
-				database.StartWarAutoFunc(false)
-			}
-
-			/*
-				if tmpNowMin == 30 {
-					// Start divine war
-					database.StartWarAutoFunc(true)
-				}
-
-		}*/
-
-		// Akşam
-		if tmpNow == 22 {
-			if tmpNowMin == 0 {
-				// Start non divine war
-				database.StartWarAutoFunc(false)
-			}
-
-			/*
-				if tmpNowMin == 30 {
-					// Start divine war
-					database.StartWarAutoFunc(true)
-				}
-			*/
+	c.AddFunc("@every 30m", func() {
+		if _, err := database.AuditItems(); err != nil {
+			log.Println(err)
 		}
-
-		if tmpNow == 23 {
-			if tmpNowMin == 0 {
-				//database.StartGoldenBasinWar()
-			}
-		}
-
 	})
 
+	c.AddFunc("@every 1m", database.SaveAchievements)
+	c.AddFunc("@every 1m", database.SaveQuests)
+
 	c.Start()
 }
 
@@ -235,24 +231,24 @@ func reloadBans() {
 
 func main() {
 
+	if err := config.Load(""); err != nil {
+		log.Fatalln(err)
+	}
+
+	cfg := config.Default
+	nats.DefaultOptions.Host = cfg.Nats.Host
+	nats.DefaultOptions.Port = cfg.Nats.Port
+
 	//debug.SetGCPercent(-1)
 	//debug.SetMemoryLimit(math.MaxInt64)
 	//go reloadBans()
 
-	//initRedis()
-	logging.InitLogFiles()
-	defer func() {
-		logging.GameLogFile.Close()
-		logging.AdminFile.Close()
-		logging.ChatLogFile.Close()
-		logging.RemoveItemFile.Close()
-		logging.BlacksmithFile.Close()
-		logging.JangboFile.Close()
-		logging.HTShopFile.Close()
-		logging.LoginLogFile.Close()
-	}()
 	initDatabase()
+	initLogging()
 	cronHandler()
+	if err := database.StartSchedule(); err != nil {
+		log.Println(err)
+	}
 	//go http.ListenAndServe(":7777", nil)
 	go web.StartWebServer()
 
@@ -261,16 +257,17 @@ func main() {
 	go database.FixDropAndExp() // Temple bug fix TODO
 
 	s := nats.RunServer(nil)
-	defer s.Shutdown()
 
 	c, err := nats.ConnectSelf(nil)
-	defer c.Close()
-
 	if err != nil {
 		log.Fatalln(err)
 	}
+	defer c.Close()
+
+	go handleSignals(s)
 
 	//go api.InitGRPC()
 
 	startServer()
+	<-shutdownDone
 }
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CONTENT_TYPE is the content type of the prometheus text format written by
+// Write.
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DURATION_BUCKETS are the default histogram buckets in seconds.
+	DURATION_BUCKETS = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+	registry      []metric
+	registryMutex sync.Mutex
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	_ = NewGaugeFunc("go_goroutines", "Number of goroutines.", nil, func(set func(float64, ...string)) {
+		set(float64(runtime.NumGoroutine()))
+	})
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type header struct {
+	name, help, kind string
+	labels           []string
+}
+
+// series is the value of a metric for one set of label values.
+type series struct {
+	values []string
+	value  float64
+	counts []uint64 // histograms only, per bucket and not cumulative
+	count  uint64
+}
+
+// Counter is a value that only goes up, like the number of handled packets.
+type Counter struct {
+	header
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// GaugeFunc is a value read when the metrics are written, like the number of
+// connected sockets.
+type GaugeFunc struct {
+	header
+	collect func(set func(value float64, values ...string))
+}
+
+// Histogram counts observations, like handler durations, in buckets.
+type Histogram struct {
+	header
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*series
+}
+
+func register(m metric, name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, r := range registry {
+		if metricName(r) == name {
+			log.Panicf("metrics: %s is registered twice", name)
+		}
+	}
+	registry = append(registry, m)
+}
+
+func metricName(m metric) string {
+	switch m := m.(type) {
+	case *Counter:
+		return m.name
+	case *GaugeFunc:
+		return m.name
+	case *Histogram:
+		return m.name
+	}
+	return ""
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{header: header{name, help, "counter", labels}, series: make(map[string]*series)}
+	register(c, name)
+	return c
+}
+
+// NewGaugeFunc registers a gauge that calls collect on every scrape, collect
+// calls set once per set of label values.
+func NewGaugeFunc(name, help string, labels []string, collect func(set func(value float64, values ...string))) *GaugeFunc {
+	g := &GaugeFunc{header: header{name, help, "gauge", labels}, collect: collect}
+	register(g, name)
+	return g
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{header: header{name, help, "histogram", labels}, buckets: buckets, series: make(map[string]*series)}
+	register(h, name)
+	return h
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	find(c.series, values, 0).value += v
+}
+
+// Value returns the counter of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if s := c.series[key(values)]; s != nil {
+		return s.value
+	}
+	return 0
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := find(h.series, values, len(h.buckets))
+	s.value += v
+	s.count++
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+}
+
+func find(m map[string]*series, values []string, buckets int) *series {
+	k := key(values)
+	s := m[k]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...), counts: make([]uint64, buckets)}
+		m[k] = s
+	}
+	return s
+}
+
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// Write writes every registered metric in the prometheus text format.
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMutex.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func (h *header) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", h.name, h.help, h.name, h.kind)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range sorted(c.series) {
+		writeSample(w, c.name, c.labels, s.values, "", s.value)
+	}
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := make(map[string]*series)
+	g.collect(func(v float64, labels ...string) {
+		find(values, labels, 0).value = v
+	})
+
+	g.writeHeader(w)
+	for _, s := range sorted(values) {
+		writeSample(w, g.name, g.labels, s.values, "", s.value)
+	}
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range sorted(h.series) {
+		cumulative := uint64(0)
+		for i, b := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.values, formatFloat(b), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", s.value)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", float64(s.count))
+	}
+}
+
+func sorted(m map[string]*series) []*series {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, k := range keys {
+		list[i] = m[k]
+	}
+	return list
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, le string, v float64) {
+	var pairs []string
+	for i, l := range labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, labelEscaper.Replace(value)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(v))
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
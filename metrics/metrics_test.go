@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_packets_total", "Packets.", "opcode")
+	c.Inc("1")
+	c.Add(2, "1")
+	c.Inc(`a"b`)
+
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{.1, 1}, "opcode")
+	h.Observe(.05, "1")
+	h.Observe(.5, "1")
+	h.Observe(5, "1")
+
+	buf := &bytes.Buffer{}
+	Write(buf)
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE test_packets_total counter",
+		`test_packets_total{opcode="1"} 3`,
+		`test_packets_total{opcode="a\"b"} 1`,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{opcode="1",le="0.1"} 1`,
+		`test_duration_seconds_bucket{opcode="1",le="1"} 2`,
+		`test_duration_seconds_bucket{opcode="1",le="+Inf"} 3`,
+		`test_duration_seconds_sum{opcode="1"} 5.55`,
+		`test_duration_seconds_count{opcode="1"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, out)
+		}
+	}
+
+	if c.Value("1") != 3 || c.Value("2") != 0 {
+		t.Errorf("values %v %v", c.Value("1"), c.Value("2"))
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	NewCounter("test_twice_total", "Twice.")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registered twice")
+		}
+	}()
+	NewCounter("test_twice_total", "Twice.")
+}
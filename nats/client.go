@@ -1,10 +1,11 @@
 package nats
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
+	"hero-server/metrics"
+
 	"github.com/nats-io/gnatsd/server"
 	"github.com/nats-io/nats.go"
 )
@@ -15,6 +16,8 @@ const (
 
 var (
 	conn *nats.Conn
+
+	casts = metrics.NewCounter("hero_nats_casts_total", "Packets published to the other servers.")
 )
 
 type CastPacket struct {
@@ -30,6 +33,10 @@ type CastPacket struct {
 	MaxDistance float64 `json:"max_distance"`
 	Data        []byte  `json:"data"`
 	Type        int8    `json:"type"`
+
+	// Origin is used to route near casts to the right grid cell. When nil it
+	// is resolved from CharacterID/MobID.
+	Origin *Origin `json:"-"`
 }
 
 func ConnectSelf(opts *server.Options) (*nats.Conn, error) {
@@ -51,10 +58,6 @@ func Connection() *nats.Conn {
 }
 
 func (p *CastPacket) Cast() error {
-
-	data, err := json.Marshal(p)
-	if err != nil {
-		return err
-	}
-	return Connection().Publish(HOUSTON_CH, data)
+	casts.Inc()
+	return Connection().Publish(p.subject(), p.Encode())
 }
@@ -0,0 +1,98 @@
+package nats
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	ENVELOPE_VERSION = 1
+
+	flagCastNear    = 1 << 0
+	flagHasLocation = 1 << 1
+
+	// version, flags, type, character, mob, pet, drop
+	envelopeHeaderSize = 3 + 4*4
+	envelopeLocSize    = 3 * 8
+)
+
+var (
+	ErrShortEnvelope   = errors.New("cast envelope is too short")
+	ErrEnvelopeVersion = errors.New("unknown cast envelope version")
+)
+
+// Encode serializes the packet into the binary envelope that is published on
+// the broadcast subjects. The routing Origin is not part of the envelope.
+func (p *CastPacket) Encode() []byte {
+	size := envelopeHeaderSize + len(p.Data)
+	if p.Location != nil {
+		size += envelopeLocSize
+	}
+
+	buf := make([]byte, size)
+	buf[0] = ENVELOPE_VERSION
+	if p.CastNear {
+		buf[1] |= flagCastNear
+	}
+	if p.Location != nil {
+		buf[1] |= flagHasLocation
+	}
+	buf[2] = byte(p.Type)
+
+	binary.LittleEndian.PutUint32(buf[3:], uint32(int32(p.CharacterID)))
+	binary.LittleEndian.PutUint32(buf[7:], uint32(int32(p.MobID)))
+	binary.LittleEndian.PutUint32(buf[11:], uint32(int32(p.PetID)))
+	binary.LittleEndian.PutUint32(buf[15:], uint32(int32(p.DropID)))
+
+	index := envelopeHeaderSize
+	if p.Location != nil {
+		binary.LittleEndian.PutUint64(buf[index:], math.Float64bits(p.Location.X))
+		binary.LittleEndian.PutUint64(buf[index+8:], math.Float64bits(p.Location.Y))
+		binary.LittleEndian.PutUint64(buf[index+16:], math.Float64bits(p.MaxDistance))
+		index += envelopeLocSize
+	}
+
+	copy(buf[index:], p.Data)
+	return buf
+}
+
+// DecodeCastPacket parses an envelope created by Encode. Data references the
+// given buffer and is not copied.
+func DecodeCastPacket(buf []byte) (*CastPacket, error) {
+	if len(buf) < envelopeHeaderSize {
+		return nil, ErrShortEnvelope
+	}
+	if buf[0] != ENVELOPE_VERSION {
+		return nil, ErrEnvelopeVersion
+	}
+
+	p := &CastPacket{
+		CastNear:    buf[1]&flagCastNear != 0,
+		Type:        int8(buf[2]),
+		CharacterID: int(int32(binary.LittleEndian.Uint32(buf[3:]))),
+		MobID:       int(int32(binary.LittleEndian.Uint32(buf[7:]))),
+		PetID:       int(int32(binary.LittleEndian.Uint32(buf[11:]))),
+		DropID:      int(int32(binary.LittleEndian.Uint32(buf[15:]))),
+	}
+
+	index := envelopeHeaderSize
+	if buf[1]&flagHasLocation != 0 {
+		if len(buf) < index+envelopeLocSize {
+			return nil, ErrShortEnvelope
+		}
+
+		p.Location = &struct {
+			X float64
+			Y float64
+		}{
+			X: math.Float64frombits(binary.LittleEndian.Uint64(buf[index:])),
+			Y: math.Float64frombits(binary.LittleEndian.Uint64(buf[index+8:])),
+		}
+		p.MaxDistance = math.Float64frombits(binary.LittleEndian.Uint64(buf[index+16:]))
+		index += envelopeLocSize
+	}
+
+	p.Data = buf[index:]
+	return p, nil
+}
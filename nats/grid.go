@@ -0,0 +1,81 @@
+package nats
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// CELL_SIZE must be at least the largest sight distance (see
+	// GetNearbyAIIDs), so that everything a character can see is inside the 3x3
+	// block of cells around the character.
+	CELL_SIZE = 64.0
+
+	CELL_CH_PREFIX = "Houston.cell"
+)
+
+// Origin is the position a packet is broadcast from.
+type Origin struct {
+	Server int
+	Map    int16
+	X      float64
+	Y      float64
+}
+
+type Cell struct {
+	Server int
+	Map    int16
+	X      int
+	Y      int
+}
+
+// ResolveOrigin finds the origin of a packet from its character/mob id when
+// the caller did not set one. It is set by the database package.
+var ResolveOrigin func(p *CastPacket) *Origin
+
+func CellOf(o *Origin) Cell {
+	return Cell{
+		Server: o.Server,
+		Map:    o.Map,
+		X:      int(math.Floor(o.X / CELL_SIZE)),
+		Y:      int(math.Floor(o.Y / CELL_SIZE)),
+	}
+}
+
+func (c Cell) Subject() string {
+	return fmt.Sprintf("%s.%d.%d.%d.%d", CELL_CH_PREFIX, c.Server, c.Map, c.X, c.Y)
+}
+
+// Neighbours returns the cell itself and the 8 cells around it.
+func (c Cell) Neighbours() []Cell {
+	cells := make([]Cell, 0, 9)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			cells = append(cells, Cell{Server: c.Server, Map: c.Map, X: c.X + dx, Y: c.Y + dy})
+		}
+	}
+	return cells
+}
+
+// subject picks the subject a packet is published on. Near casts go to the
+// cell of their origin; everything else (and anything we can not locate) goes
+// to the global channel where receivers filter it as before.
+func (p *CastPacket) subject() string {
+	if !p.CastNear {
+		return HOUSTON_CH
+	}
+
+	if p.Location != nil && p.MaxDistance > CELL_SIZE {
+		return HOUSTON_CH
+	}
+
+	origin := p.Origin
+	if origin == nil && ResolveOrigin != nil {
+		origin = ResolveOrigin(p)
+	}
+	if origin == nil {
+		return HOUSTON_CH
+	}
+
+	return CellOf(origin).Subject()
+}
@@ -0,0 +1,95 @@
+package nav
+
+import (
+	"fmt"
+	"math"
+
+	"hero-server/utils"
+)
+
+// Grid is the walkability of a map, a grid of square cells starting at
+// MinX, MinY. Cells are stored one bit each, row by row from the lowest y,
+// the lowest bit of a byte first; a set bit is a cell that can be walked on.
+type Grid struct {
+	MinX, MinY float64
+	CellSize   float64
+	Width      int
+	Height     int
+	cells      []byte
+}
+
+// NewGrid returns the grid of the cells, which must hold width*height bits.
+func NewGrid(minX, minY, cellSize float64, width, height int, cells []byte) (*Grid, error) {
+	if cellSize <= 0 || width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("NewGrid: invalid size %dx%d cells of %v", width, height, cellSize)
+	}
+	if n := (width*height + 7) / 8; len(cells) < n {
+		return nil, fmt.Errorf("NewGrid: %d bytes of cells, %d needed", len(cells), n)
+	}
+	return &Grid{MinX: minX, MinY: minY, CellSize: cellSize, Width: width, Height: height, cells: cells}, nil
+}
+
+// cell returns the cell of a point.
+func (g *Grid) cell(x, y float64) (int, int) {
+	return int(math.Floor((x - g.MinX) / g.CellSize)), int(math.Floor((y - g.MinY) / g.CellSize))
+}
+
+// center returns the middle of a cell.
+func (g *Grid) center(cx, cy int) utils.Location {
+	return utils.Location{X: g.MinX + (float64(cx)+0.5)*g.CellSize, Y: g.MinY + (float64(cy)+0.5)*g.CellSize}
+}
+
+// open tells if a cell is in the grid and can be walked on.
+func (g *Grid) open(cx, cy int) bool {
+	if cx < 0 || cy < 0 || cx >= g.Width || cy >= g.Height {
+		return false
+	}
+	i := cy*g.Width + cx
+	return g.cells[i/8]&(1<<uint(i%8)) != 0
+}
+
+// Walkable tells if a point can be walked on, points off the grid can't.
+func (g *Grid) Walkable(x, y float64) bool {
+	return g.open(g.cell(x, y))
+}
+
+// Clear tells if the straight line between two points only crosses cells
+// that can be walked on.
+func (g *Grid) Clear(from, to *utils.Location) bool {
+	steps := int(math.Ceil(utils.CalculateDistance(from, to)/(g.CellSize/2))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		if !g.Walkable(from.X+(to.X-from.X)*t, from.Y+(to.Y-from.Y)*t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Nearest returns the middle of the walkable cell closest to a point,
+// searching up to radius cells away.
+func (g *Grid) Nearest(loc *utils.Location, radius int) (utils.Location, bool) {
+	cx, cy := g.cell(loc.X, loc.Y)
+	if g.open(cx, cy) {
+		return *loc, true
+	}
+
+	for r := 1; r <= radius; r++ {
+		best, found := utils.Location{}, false
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if (dx != -r && dx != r && dy != -r && dy != r) || !g.open(cx+dx, cy+dy) {
+					continue
+				}
+				c := g.center(cx+dx, cy+dy)
+				if !found || utils.CalculateDistance(loc, &c) < utils.CalculateDistance(loc, &best) {
+					best, found = c, true
+				}
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+	return utils.Location{}, false
+}
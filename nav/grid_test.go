@@ -0,0 +1,101 @@
+package nav
+
+import (
+	"testing"
+
+	"hero-server/utils"
+)
+
+// gridOf builds a grid of 1x1 cells from rows of text, '#' is blocked and
+// the first row has the lowest y.
+func gridOf(t *testing.T, rows ...string) *Grid {
+	t.Helper()
+
+	width, height := len(rows[0]), len(rows)
+	cells := make([]byte, (width*height+7)/8)
+	for y, row := range rows {
+		for x, c := range row {
+			if c != '#' {
+				i := y*width + x
+				cells[i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+
+	g, err := NewGrid(0, 0, 1, width, height, cells)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestFindPath(t *testing.T) {
+	g := gridOf(t,
+		"..........",
+		"..........",
+		"#######...",
+		"..........",
+		"..........",
+	)
+
+	from, to := &utils.Location{X: 1.5, Y: 0.5}, &utils.Location{X: 1.5, Y: 4.5}
+	if g.Clear(from, to) || !g.Walkable(1.5, 0.5) || g.Walkable(1.5, 2.5) || g.Walkable(-1, 0) {
+		t.Fatal("walkability of the wall")
+	}
+
+	path := g.FindPath(from, to)
+	if len(path) < 2 || path[len(path)-1] != *to {
+		t.Fatalf("path around the wall: %v", path)
+	}
+	at := *from
+	for _, p := range path {
+		if !g.Clear(&at, &p) {
+			t.Fatalf("path %v goes through the wall from %v to %v", path, at, p)
+		}
+		at = p
+	}
+
+	if path := g.FindPath(from, &utils.Location{X: 2.5, Y: 0.5}); len(path) != 1 {
+		t.Errorf("straight path: %v", path)
+	}
+	if path := g.FindPath(from, &utils.Location{X: 3.5, Y: 2.5}); path != nil {
+		t.Errorf("path into the wall: %v", path)
+	}
+}
+
+func TestFindPathUnreachable(t *testing.T) {
+	g := gridOf(t,
+		"...#...",
+		"...#...",
+		"...#...",
+	)
+
+	if path := g.FindPath(&utils.Location{X: 0.5, Y: 0.5}, &utils.Location{X: 6.5, Y: 2.5}); path != nil {
+		t.Errorf("path through a closed wall: %v", path)
+	}
+	// diagonal steps do not squeeze between two blocked corners
+	g = gridOf(t,
+		"..#",
+		".#.",
+	)
+	if path := g.FindPath(&utils.Location{X: 0.5, Y: 0.5}, &utils.Location{X: 2.5, Y: 1.5}); path != nil {
+		t.Errorf("path through a corner: %v", path)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	g := gridOf(t,
+		"###",
+		"##.",
+	)
+
+	if loc, ok := g.Nearest(&utils.Location{X: 0.5, Y: 0.5}, 2); !ok || loc != (utils.Location{X: 2.5, Y: 1.5}) {
+		t.Errorf("nearest walkable point: %v %v", loc, ok)
+	}
+	if _, ok := g.Nearest(&utils.Location{X: 0.5, Y: 0.5}, 1); ok {
+		t.Error("walkable point found out of the radius")
+	}
+	if _, err := NewGrid(0, 0, 1, 4, 4, []byte{0xFF}); err == nil {
+		t.Error("grid with too few cells")
+	}
+}
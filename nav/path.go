@@ -0,0 +1,126 @@
+package nav
+
+import (
+	"container/heap"
+	"math"
+
+	"hero-server/utils"
+)
+
+// MAX_PATH_NODES is the number of cells a search may expand before it gives
+// up, so an unreachable target does not search the whole map.
+const MAX_PATH_NODES = 20000
+
+var directions = [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+type node struct {
+	x, y   int
+	g, f   float64
+	parent *node
+	index  int
+	closed bool
+}
+
+type openSet []*node
+
+func (s openSet) Len() int           { return len(s) }
+func (s openSet) Less(i, j int) bool { return s[i].f < s[j].f }
+func (s openSet) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+func (s *openSet) Push(x interface{}) {
+	n := x.(*node)
+	n.index = len(*s)
+	*s = append(*s, n)
+}
+func (s *openSet) Pop() interface{} {
+	old := *s
+	n := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return n
+}
+
+// octile is the distance between two cells moving in eight directions.
+func octile(dx, dy int) float64 {
+	ax, ay := math.Abs(float64(dx)), math.Abs(float64(dy))
+	return math.Max(ax, ay) + (math.Sqrt2-1)*math.Min(ax, ay)
+}
+
+// FindPath returns the points to walk through from one point to another,
+// the last one being the target, or nil when the target can't be reached.
+// The start may be on a blocked cell, a mob that spawned there can leave it.
+// Diagonal steps never cut the corner of a blocked cell and the path is
+// smoothed to the fewest straight lines.
+func (g *Grid) FindPath(from, to *utils.Location) []utils.Location {
+	if !g.Walkable(to.X, to.Y) {
+		return nil
+	}
+	if g.Clear(from, to) {
+		return []utils.Location{*to}
+	}
+
+	sx, sy := g.cell(from.X, from.Y)
+	tx, ty := g.cell(to.X, to.Y)
+
+	nodes := make(map[int]*node)
+	start := &node{x: sx, y: sy, f: octile(tx-sx, ty-sy)}
+	nodes[sy*g.Width+sx] = start
+	open := &openSet{start}
+
+	for expanded := 0; open.Len() > 0 && expanded < MAX_PATH_NODES; expanded++ {
+		current := heap.Pop(open).(*node)
+		current.closed = true
+		if current.x == tx && current.y == ty {
+			return g.smooth(from, to, current)
+		}
+
+		for _, d := range directions {
+			nx, ny := current.x+d[0], current.y+d[1]
+			if !g.open(nx, ny) {
+				continue
+			}
+			if d[0] != 0 && d[1] != 0 && (!g.open(current.x+d[0], current.y) || !g.open(current.x, current.y+d[1])) {
+				continue // corner
+			}
+
+			cost := current.g + octile(d[0], d[1])
+			n := nodes[ny*g.Width+nx]
+			if n == nil {
+				n = &node{x: nx, y: ny, g: cost, f: cost + octile(tx-nx, ty-ny), parent: current}
+				nodes[ny*g.Width+nx] = n
+				heap.Push(open, n)
+			} else if !n.closed && cost < n.g {
+				n.g, n.f, n.parent = cost, cost+octile(tx-nx, ty-ny), current
+				heap.Fix(open, n.index)
+			}
+		}
+	}
+	return nil
+}
+
+// smooth turns the cells of a path into the points where it turns, skipping
+// every point the line from the previous one can do without.
+func (g *Grid) smooth(from, to *utils.Location, last *node) []utils.Location {
+	var cells []utils.Location
+	for n := last.parent; n != nil && n.parent != nil; n = n.parent {
+		cells = append([]utils.Location{g.center(n.x, n.y)}, cells...)
+	}
+	cells = append(cells, *to)
+
+	var path []utils.Location
+	at := *from
+	for i := 0; i < len(cells); {
+		next := i
+		for j := len(cells) - 1; j > i; j-- {
+			if g.Clear(&at, &cells[j]) {
+				next = j
+				break
+			}
+		}
+		at = cells[next]
+		path = append(path, at)
+		i = next + 1
+	}
+	return path
+}
@@ -0,0 +1,276 @@
+package npc
+
+import (
+	"fmt"
+
+	"hero-server/database"
+	"hero-server/dungeon"
+	"hero-server/messaging"
+	"hero-server/utils"
+
+	"github.com/thoas/go-funk"
+)
+
+// EXCHANGE_ACTION is the button that opens the shop of an npc.
+const EXCHANGE_ACTION = 1
+
+// runAction runs the script of an npc button. Every step is checked before
+// any is applied, so a script never takes an item and then fails to give
+// what it was taken for.
+func runAction(c *database.Character, npcID int, action *database.NPCAction) (utils.Packet, error) {
+	gives := 0
+	for _, s := range action.Steps {
+		if ok, resp := checkStep(c, npcID, s); !ok {
+			return resp, nil
+		}
+		if s.Op == database.ACTION_GIVE_ITEM {
+			gives++
+		}
+	}
+
+	if gives > 0 {
+		if _, err := c.FindFreeSlots(gives); err != nil {
+			return messaging.InfoMessage("Your inventory is full."), nil
+		}
+	}
+
+	resp := utils.Packet{}
+	for _, s := range action.Steps {
+		data, err := applyStep(c, npcID, s)
+		if err != nil {
+			return resp, fmt.Errorf("runAction: npc %d action %d: %s", npcID, action.ActionID, err.Error())
+		}
+		resp.Concat(data)
+	}
+	return resp, nil
+}
+
+// npcShop is the shop the exchange button of an npc opens.
+func npcShop(npcID int) (int, bool) {
+	action := database.FindNPCAction(npcID, EXCHANGE_ACTION)
+	if action == nil {
+		return 0, false
+	}
+
+	for _, s := range action.Steps {
+		if s.Op == database.ACTION_OPEN_SHOP {
+			return s.Shop, true
+		}
+	}
+	return 0, false
+}
+
+// actionMembers are the characters a step counts for, the party of c when
+// the step is for the party.
+func actionMembers(c *database.Character, s *database.ActionStep) []*database.Character {
+	members := []*database.Character{c}
+	if !s.Party || c.PartyID == "" {
+		return members
+	}
+
+	if party := database.FindParty(c); party != nil {
+		if party.Leader != nil && party.Leader.ID != c.ID {
+			members = append(members, party.Leader)
+		}
+		for _, m := range party.GetMembers() {
+			if m.Accepted && m.Character.ID != c.ID {
+				members = append(members, m.Character)
+			}
+		}
+	}
+	return members
+}
+
+// checkStep tells if c meets the step, or what to reply when it doesn't.
+func checkStep(c *database.Character, npcID int, s *database.ActionStep) (bool, utils.Packet) {
+	switch s.Op {
+	case database.ACTION_LEVEL:
+		for _, m := range actionMembers(c, s) {
+			if m.Level < s.MinLevel || (s.MaxLevel > 0 && m.Level > s.MaxLevel) {
+				return false, failStep(npcID, s, npcReply(NOT_ENOUGH_LEVEL, npcID))
+			}
+		}
+
+	case database.ACTION_CLASS:
+		if !funk.ContainsInt(s.Classes, c.Class) {
+			return false, failStep(npcID, s, npcReply(INVALID_CLASS, npcID))
+		}
+
+	case database.ACTION_TYPE:
+		if !funk.ContainsInt(s.Types, c.Type) {
+			return false, failStep(npcID, s, npcReply(INVALID_CLASS, npcID))
+		}
+
+	case database.ACTION_FACTION:
+		if c.Faction != s.Faction {
+			return false, failStep(npcID, s, nil)
+		}
+
+	case database.ACTION_MAP:
+		if c.Map != s.Map {
+			return false, failStep(npcID, s, nil)
+		}
+
+	case database.ACTION_GOLD, database.ACTION_TAKE_GOLD:
+		if c.Gold < s.Gold {
+			return false, failStep(npcID, s, messaging.InfoMessage("You don't have enough gold."))
+		}
+
+	case database.ACTION_ITEM, database.ACTION_TAKE_ITEM:
+		for _, m := range actionMembers(c, s) {
+			if slot, _, _ := findActionItem(m, s); slot < 0 {
+				name := fmt.Sprint(s.ItemID)
+				if info, ok := database.GetItemInfo(s.ItemID); ok {
+					name = info.Name
+				}
+				return false, failStep(npcID, s, messaging.InfoMessage(fmt.Sprintf("%s is missing %s.", m.Name, name)))
+			}
+		}
+
+	case database.ACTION_QUEST:
+		if !c.OnQuest(s.Quest) {
+			return false, failStep(npcID, s, nil)
+		}
+
+	case database.ACTION_ACCEPT_QUEST:
+		if err := c.CanAcceptQuest(s.Quest); err != nil {
+			return false, failStep(npcID, s, messaging.InfoMessage(err.Error()))
+		}
+
+	case database.ACTION_COMPLETE_QUEST:
+		if err := c.CanCompleteQuest(s.Quest); err != nil {
+			return false, failStep(npcID, s, messaging.InfoMessage(err.Error()))
+		}
+
+	case database.ACTION_PARTY, database.ACTION_START_DUNGEON:
+		party := database.FindParty(c)
+		if c.PartyID == "" || party == nil || party.Leader.ID != c.ID {
+			return false, failStep(npcID, s, messaging.InfoMessage("Only a party leader can enter."))
+		}
+		if s.Quantity > 0 && len(party.GetMembers()) > int(s.Quantity) {
+			return false, failStep(npcID, s, messaging.InfoMessage(fmt.Sprintf("Maximum %d players can entry at once.", s.Quantity)))
+		}
+		if s.Op == database.ACTION_START_DUNGEON {
+			d := database.FindDungeon(s.Dungeon)
+			if d == nil {
+				return false, failStep(npcID, s, messaging.InfoMessage("This dungeon is closed."))
+			} else if err := d.Check(party.Characters()); err != nil {
+				return false, failStep(npcID, s, messaging.InfoMessage(err.Error()))
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// failStep is the reply to a failed check, the npc text or message of the
+// step if it has one.
+func failStep(npcID int, s *database.ActionStep, resp utils.Packet) utils.Packet {
+	if s.Text > 0 {
+		return GetNPCMenu(npcID, s.Text, 0, nil)
+	} else if s.Message != "" {
+		return messaging.InfoMessage(s.Message)
+	}
+	return resp
+}
+
+func npcReply(packet utils.Packet, npcID int) utils.Packet {
+	resp := packet
+	resp.Insert(utils.IntToBytes(uint64(npcID), 4, true), 6) // npc id
+	return resp
+}
+
+func findActionItem(c *database.Character, s *database.ActionStep) (int16, *database.InventorySlot, error) {
+	return c.FindItemInInventory(func(slot *database.InventorySlot) bool {
+		return slot.Quantity >= s.Count()
+	}, s.ItemID)
+}
+
+func applyStep(c *database.Character, npcID int, s *database.ActionStep) ([]byte, error) {
+	switch s.Op {
+	case database.ACTION_TAKE_GOLD:
+		c.AddingGold.Lock()
+		if c.Gold < s.Gold {
+			c.AddingGold.Unlock()
+			return nil, fmt.Errorf("not enough gold")
+		}
+		c.Gold -= s.Gold
+		c.AddingGold.Unlock()
+		return c.GetGold(), nil
+
+	case database.ACTION_TAKE_ITEM:
+		resp := utils.Packet{}
+		for _, m := range actionMembers(c, s) {
+			slotID, slot, err := findActionItem(m, s)
+			if err != nil {
+				return nil, err
+			} else if slotID < 0 {
+				return nil, fmt.Errorf("%s is missing item %d", m.Name, s.ItemID)
+			}
+
+			item := *slot
+			data := m.DecrementItem(slotID, s.Count())
+			if data == nil {
+				return nil, fmt.Errorf("%s is missing item %d", m.Name, s.ItemID)
+			}
+			database.RecordItem(database.ITEM_CONSUMED, &item, -int64(s.Count()), m, nil, fmt.Sprintf("npc %d", npcID))
+
+			if m == c {
+				resp.Concat(*data)
+			} else {
+				m.Socket.Write(*data)
+			}
+		}
+		return resp, nil
+
+	case database.ACTION_GIVE_ITEM:
+		data, _, err := c.AddItem(&database.InventorySlot{ItemID: s.ItemID, Quantity: s.Count()}, -1, false)
+		if err != nil {
+			return nil, err
+		} else if data == nil {
+			return nil, fmt.Errorf("no room for item %d", s.ItemID)
+		}
+		return *data, nil
+
+	case database.ACTION_TELEPORT:
+		var coordinate *utils.Location
+		if s.X != 0 || s.Y != 0 {
+			coordinate = database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", s.X, s.Y))
+		}
+		if s.Map > 0 && (s.Map != c.Map || coordinate == nil) {
+			return c.ChangeMap(s.Map, coordinate)
+		}
+		return c.Teleport(coordinate), nil
+
+	case database.ACTION_OPEN_SHOP:
+		resp := OPEN_SHOP
+		resp.Insert(utils.IntToBytes(uint64(s.Shop), 4, true), 7) // shop id
+		return resp, nil
+
+	case database.ACTION_SET_JOB:
+		c.Class = s.Job
+		resp := utils.Packet{}
+		resp.Concat(JOB_PROMOTED)
+		resp[6] = byte(s.Job)
+		return resp, nil
+
+	case database.ACTION_START_DUNGEON:
+		if err := dungeon.Start(database.FindDungeon(s.Dungeon), database.FindParty(c)); err != nil {
+			return messaging.InfoMessage(err.Error()), nil
+		}
+
+	case database.ACTION_ACCEPT_QUEST:
+		return c.AcceptQuest(s.Quest)
+
+	case database.ACTION_COMPLETE_QUEST:
+		return c.CompleteQuest(s.Quest)
+
+	case database.ACTION_TEXT:
+		return GetNPCMenu(npcID, s.Text, 0, nil), nil
+
+	case database.ACTION_MESSAGE:
+		return messaging.InfoMessage(s.Message), nil
+	}
+
+	return nil, nil
+}
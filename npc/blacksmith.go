@@ -1,6 +1,7 @@
 package npc
 
 import (
+	"hero-server/codec"
 	"hero-server/database"
 	"hero-server/utils"
 )
@@ -13,17 +14,16 @@ type (
 	ExtractionHandler     struct{}
 )
 
-func (h *StrengthenHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *StrengthenHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.OnClose()
 		return nil, nil
 	}
 
-	slotID := utils.BytesToInt(data[6:8], true)
-	stoneCount := data[8]
+	req := msg.(*codec.StrengthenRequest)
+	slotID, lSlot, pSlot := req.SlotID, req.LuckSlot, req.ProtectionSlot
 
-	index := 9
 	var (
 		stoneSlots []int64
 		stones     []*database.InventorySlot
@@ -34,36 +34,31 @@ func (h *StrengthenHandler) Handle(s *database.Socket, data []byte) ([]byte, err
 		return nil, err
 	}
 
-	if slots[slotID].ItemID == 0 {
+	inRange := func(id int64) bool { return id >= 0 && id < int64(len(slots)) }
+	if !inRange(slotID) || !inRange(lSlot) || !inRange(pSlot) {
 		return nil, nil
 	}
 
-	for i := 0; i < int(stoneCount); i++ {
-		id := utils.BytesToInt(data[index:index+2], true) // stone slot id
+	if slots[slotID].ItemID == 0 {
+		return nil, nil
+	}
 
-		if slots[id].ItemID == 0 {
+	for _, id := range req.StoneSlots { // stone slot ids
+		if !inRange(id) || slots[id].ItemID == 0 {
 			continue
 		}
 
 		stoneSlots = append(stoneSlots, id)
 		stones = append(stones, slots[id])
-		index += 2
 	}
 
 	var luck *database.InventorySlot
-	lSlot := utils.BytesToInt(data[index:index+2], true)
-	if lSlot == 0 {
-		luck = nil
-	} else {
+	if lSlot != 0 {
 		luck = slots[lSlot]
 	}
-	index += 2
 
 	var protection *database.InventorySlot
-	pSlot := utils.BytesToInt(data[index:index+2], true)
-	if pSlot == 0 {
-		protection = nil
-	} else {
+	if pSlot != 0 {
 		protection = slots[pSlot]
 	}
 
@@ -181,7 +176,7 @@ func (h *AdvancedFusionHandler) Handle(s *database.Socket, data []byte) ([]byte,
 	}
 	resp.Concat(fusionData)
 
-	fusion := database.Fusions[items[0].ItemID]
+	fusion := database.FindFusion(items[0].ItemID)
 	if success || (!success && fusion.DestroyOnFail) {
 		for _, id := range slotIDs {
 			itemData, err := s.Character.RemoveItem(id)
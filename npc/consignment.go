@@ -69,7 +69,7 @@ func (h *OpenConsignmentHandler) Handle(s *database.Socket, data []byte) ([]byte
 			return nil, err
 		}
 
-		info := database.Items[int64(item.ItemID)]
+		info := database.FindItem(int64(item.ItemID))
 
 		seller, err := database.FindCharacterByID(int(item.CharacterID.Int64))
 		if err != nil || seller == nil {
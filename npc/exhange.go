@@ -29,13 +29,13 @@ func (h *BuyItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 	slotID := int16(utils.BytesToInt(data[16:18], true))
 
 	npcID := int(utils.BytesToInt(data[18:22], true))
-	shopID, ok := shops[npcID]
+	shopID, ok := npcShop(npcID)
 	if !ok {
 		shopID = 25
 	}
 
-	shop, ok := database.Shops[shopID]
-	if !ok {
+	shop := database.FindShop(shopID)
+	if shop == nil {
 		return nil, nil
 	}
 
@@ -49,7 +49,7 @@ func (h *BuyItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 		return nil, err
 	}
 
-	info := database.Items[itemID]
+	info := database.FindItem(itemID)
 	cost := uint64(info.BuyPrice) * uint64(quantity)
 
 	if npcID == 20160 {
@@ -371,8 +371,8 @@ func (h *BuyItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 			}
 
 			if info.GetType() == database.PET_TYPE {
-				petInfo := database.Pets[item.ItemID]
-				expInfo := database.PetExps[petInfo.Level-1]
+				petInfo := database.FindPet(item.ItemID)
+				expInfo := database.FindPetExp(petInfo.Level - 1)
 
 				item.Pet = &database.PetSlot{
 					Fullness: 100, Loyalty: 100,
@@ -416,7 +416,7 @@ func (h *SellItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 	quantity := int(utils.BytesToInt(data[10:12], true))
 	slotID := int16(utils.BytesToInt(data[12:14], true))
 
-	item := database.Items[itemID]
+	item := database.FindItem(itemID)
 	slot := slots[slotID]
 
 	if item.Tradable == 2 {
@@ -428,7 +428,7 @@ func (h *SellItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		upgs := slot.GetUpgrades()
 		for i := uint8(0); i < slot.Plus; i++ {
 			upg := upgs[i]
-			if code, ok := database.HaxCodes[int(upg)]; ok {
+			if code := database.FindHaxCode(int(upg)); code != nil {
 				multiplier += code.SaleMultiplier
 			}
 		}
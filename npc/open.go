@@ -23,14 +23,6 @@ type PressButtonHandler struct {
 }
 
 var (
-	shops = map[int]int{20002: 7, 20003: 2, 20004: 4, 20005: 1, 20009: 8, 20010: 10, 20011: 10, 20013: 25, 20160: 340,
-		20024: 6, 20025: 6, 20026: 11, 20033: 21, 20034: 22, 20035: 23, 20036: 24, 20044: 21, 20047: 21, 20082: 21,
-		20083: 21, 20084: 21, 20085: 23, 20086: 22, 20087: 21, 20094: 103, 20095: 100, 20105: 21, 20133: 21,
-		20146: 21, 20151: 6, 20173: 342, 20211: 25, 20239: 21, 20415: 21, 20015: 340, 20202: 341, 20206: 11, 20203: 11,
-		20316: 11, 20323: 11, 20337: 11, 20413: 25, 20379: 25, 20204: 344, 20317: 343, 20051: 345, 20293: 346, 20295: 346,
-		23714: 347, 23741: 348, 23747: 349, 20088: 350, 20169: 351,
-	}
-
 	COMPOSITION_MENU          = utils.Packet{0xAA, 0x55, 0x03, 0x00, 0x57, 0x0F, 0x01, 0x55, 0xAA}
 	OPEN_SHOP                 = utils.Packet{0xAA, 0x55, 0x07, 0x00, 0x57, 0x03, 0x01, 0x55, 0xAA}
 	NPC_MENU                  = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x57, 0x02, 0x55, 0xAA}
@@ -70,6 +62,7 @@ func (h *OpenHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 	}
 
 	npc := database.NPCs[pos.NPCID]
+	c.Socket.Write(c.AdvanceQuests(database.QUEST_TALK, pos.NPCID, 1))
 
 	if npc.ID == 20147 { // Ice Palace Mistress Lord
 		coordinate := &utils.Location{X: 163, Y: 350}
@@ -117,7 +110,7 @@ func (h *OpenHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 		}
 	*/
 
-	npcScript := database.NPCScripts[npc.ID]
+	npcScript := database.FindNPCScript(npc.ID)
 	if npcScript == nil {
 		return nil, nil
 	}
@@ -167,7 +160,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 		return i > 0
 	})
 
-	npcScript := database.NPCScripts[npcID]
+	npcScript := database.FindNPCScript(npcID)
 	if npcScript == nil {
 		return nil, nil
 	}
@@ -196,17 +189,15 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 		actions := gjson.Get(script, "actions").Array()
 		actIndex := indexes[len(indexes)-1] - 1
 		actID := actions[actIndex].Int()
+		if action := database.FindNPCAction(npcID, int(actID)); action != nil {
+			return runAction(c, npcID, action)
+		}
 
 		resp := utils.Packet{}
 
 		var err error
 		book1, book2, job := 0, 0, 0
 		switch actID {
-		case 1: // Exchange
-			shopNo := shops[npcID]
-			resp = OPEN_SHOP
-			resp.Insert(utils.IntToBytes(uint64(shopNo), 4, true), 7) // shop id
-
 		case 2: // Compositon
 			resp = COMPOSITION_MENU
 
@@ -218,77 +209,14 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 
 		case 13: // Accept
 			switch npcID {
-			case 20006: // Hunter trainer
-				book1, job = 16210003, 13
-				resp, err = firstJobPromotion(c, book1, job, npcID)
-				if err != nil {
-					return nil, err
-				}
-			case 20020: // Warrior trainer
-				book1, job = 16210001, 11
-				resp, err = firstJobPromotion(c, book1, job, npcID)
-				if err != nil {
-					return nil, err
-				}
-			case 20021: // Physician trainer
-				book1, job = 16210002, 12
-				resp, err = firstJobPromotion(c, book1, job, npcID)
-				if err != nil {
-					return nil, err
-				}
-			case 20022: // Assassin trainer
-				book1, job = 16210004, 14
-				resp, err = firstJobPromotion(c, book1, job, npcID)
-				if err != nil {
-					return nil, err
-				}
 			case 20057: //HERO BATTLE MANAGER
 				switch index {
 				case 11: //THE GREAT WAR
-					if database.CanJoinWar {
-						if database.DivineWar {
-							if c.Level > 100 {
-								if database.DivineWar {
-									if c.Faction == 1 {
-										x := 75.0
-										y := 45.0
-										c.IsinWar = true
-										database.OrderCharacters[c.ID] = c
-										data, _ := c.ChangeMap(230, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-										c.Socket.Write(data)
-									} else {
-										x := 81.0
-										y := 475.0
-										c.IsinWar = true
-										database.ShaoCharacters[c.ID] = c
-										data, _ := c.ChangeMap(230, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-										c.Socket.Write(data)
-									}
-								}
-							} else {
-								resp.Concat(messaging.InfoMessage(fmt.Sprintf("You are not Divine")))
-							}
-						} else {
-							if c.Level >= 50 && c.Level <= 100 {
-								if c.Faction == 1 {
-									x := 75.0
-									y := 45.0
-									c.IsinWar = true
-									database.OrderCharacters[c.ID] = c
-									data, _ := c.ChangeMap(230, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-									c.Socket.Write(data)
-								} else {
-									x := 81.0
-									y := 475.0
-									c.IsinWar = true
-									database.ShaoCharacters[c.ID] = c
-									data, _ := c.ChangeMap(230, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-									c.Socket.Write(data)
-								}
-							} else {
-								resp.Concat(messaging.InfoMessage(fmt.Sprintf("You are not non Divine")))
-							}
-						}
+					data, err := database.JoinBattleground(database.BATTLEGROUND_WAR, c)
+					if err != nil {
+						resp.Concat(messaging.InfoMessage(err.Error()))
+					} else {
+						resp.Concat(data)
 					}
 				case 10: //FACTION WAR
 					//database.AddMemberToFactionWar(c)
@@ -308,77 +236,15 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				resp = GUILD_MENU
 			}
 
-		case 77: // Move to Souther Plains
-			resp, _ = c.ChangeMap(7, nil)
-
-		case 78: // Move to Dragon Castle
-			resp, _ = c.ChangeMap(1, nil)
-
-		case 86: // Move to Spirit Spire
-			resp, _ = c.ChangeMap(5, nil)
-
-		case 103: // Move to Highlands
-			resp, _ = c.ChangeMap(2, nil)
-
-		case 104: // Move to Venom Swamp
-			resp, _ = c.ChangeMap(3, nil)
-		case 106: // Move to Silent Valley
-			resp, _ = c.ChangeMap(11, nil)
-		case 148: // Become a Champion
-			book1, book2, job = 16100039, 16100200, 21
-			resp, err = secondJobPromotion(c, book1, book2, 11, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 149: // Become a Musa
-			book1, book2, job = 16100040, 16100200, 22
-			resp, err = secondJobPromotion(c, book1, book2, 11, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 151: // Become a Surgeon
-			book1, book2, job = 16100041, 16100200, 23
-			resp, err = secondJobPromotion(c, book1, book2, 12, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 152: // Become a Combat Medic
-			book1, book2, job = 16100042, 16100200, 24
-			resp, err = secondJobPromotion(c, book1, book2, 12, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 154: // Become a Slayer
-			book1, book2, job = 16100043, 16100200, 27
-			resp, err = secondJobPromotion(c, book1, book2, 14, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 155: // Become a Shinobi
-			book1, book2, job = 16100044, 16100200, 28
-			resp, err = secondJobPromotion(c, book1, book2, 14, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 157: // Become a Tracker
-			book1, book2, job = 16100045, 16100200, 25
-			resp, err = secondJobPromotion(c, book1, book2, 13, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-		case 158: // Become a Ranger
-			book1, book2, job = 16100046, 16100200, 26
-			resp, err = secondJobPromotion(c, book1, book2, 13, job, npcID)
-			if err != nil {
-				return nil, err
-			}
-
 		case 194: // Dismantle
 			resp = DISMANTLE_MENU
 
 		case 116:
-			database.AddMemberToFactionWar(c)
-			resp, _ = c.ChangeMap(255, nil)
+			data, err := database.JoinBattleground(database.BATTLEGROUND_FACTION_WAR, c)
+			if err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
+			resp = data
 
 		case 195: // Extraction
 			resp = EXTRACTION_MENU
@@ -727,14 +593,14 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 						resp, _ = divineJobPromotion(c, npcID)
 						statData, _ := c.GetStats()
 						resp.Concat(statData)
-						s.Conn.Write(resp)
+						s.Write(resp)
 						//database.MakeAnnouncement("At this moment I mark my name on list of Top master in Strong HERO. - " + c.Name)
 						/*time.AfterFunc(time.Duration(60*time.Second), func() {
 							CharacterSelect := utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x01, 0x05, 0x0A, 0x00, 0x55, 0xAA}
 							CHARACTER_MENU := utils.Packet{0xAA, 0x55, 0x03, 0x00, 0x09, 0x09, 0x00, 0x55, 0xAA}
 							resp := CHARACTER_MENU
 							resp.Concat(CharacterSelect)
-							s.Conn.Write(resp)
+							s.Write(resp)
 						})*/
 				} else {
 					resp.Concat(messaging.InfoMessage(fmt.Sprintf("You don't have class."))) //NOTICE TO NO SELECTED CLASS
@@ -890,16 +756,11 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				resp, _ = c.ChangeMap(30, nil)
 			}
 		case 1349: // Market Arena
-			if database.CanJoinLastMan && !database.LastmanStarted {
-				if c.Level >= 60 {
-					c.IsinLastMan = true
-					database.LastManMutex.Lock()
-					database.LastManCharacters[c.ID] = c
-					database.LastManMutex.Unlock()
-					coordinate := &utils.Location{X: 137, Y: 365}
-					resp, _ = c.ChangeMap(254, coordinate)
-				}
+			data, err := database.JoinBattleground(database.BATTLEGROUND_LAST_MAN, c)
+			if err != nil {
+				return messaging.InfoMessage(err.Error()), nil
 			}
+			resp = data
 		case 1350: // Ancient Relic
 			if c.Level > 70 {
 				goldSandSlot, goldSand, err := c.FindItemInInventory(nil, 1030)
@@ -1585,6 +1446,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 						c.Socket.Write(resp)
 						c.Level = 1
 						c.RebornLevel = 1
+						c.Socket.Write(c.AdvanceAchievements(database.ACHIEVEMENT_REBORN, 0, c.RebornLevel))
 						c.Exp = 0
 						c.Class = 0
 						c.AddExp(1)
@@ -1614,14 +1476,14 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 						tmpResp, _, _ := c.AddItem(&database.InventorySlot{ItemID: 18500891, Quantity: 1}, -1, false)
 						resp.Concat(*tmpResp)
 						resp.Concat(statData)
-						s.Conn.Write(resp)
+						s.Write(resp)
 						database.MakeAnnouncement(c.Name + " has reborned and is ready for new adventures and endless possibilities.")
 						time.AfterFunc(time.Duration(3*time.Second), func() {
 							CharacterSelect := utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x01, 0x05, 0x0A, 0x00, 0x55, 0xAA}
 							CHARACTER_MENU := utils.Packet{0xAA, 0x55, 0x03, 0x00, 0x09, 0x09, 0x00, 0x55, 0xAA}
 							resp := CHARACTER_MENU
 							resp.Concat(CharacterSelect)
-							s.Conn.Write(resp)
+							s.Write(resp)
 						})
 					} else {
 						resp.Concat(messaging.InfoMessage(fmt.Sprintf("You don't have class."))) //NOTICE TO NO SELECTED CLASS
@@ -1732,6 +1594,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 							c.Socket.Write(resp)
 							c.Level = 1
 							c.RebornLevel = 2
+							c.Socket.Write(c.AdvanceAchievements(database.ACHIEVEMENT_REBORN, 0, c.RebornLevel))
 							// TODO karakterin exp ve drobunu ayarla karakter login olduğunda reborn levele göre versin
 							c.Exp = 0
 							c.Class = 0
@@ -1759,14 +1622,14 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 								return nil, err
 							}
 							resp.Concat(statData)
-							s.Conn.Write(resp)
+							s.Write(resp)
 							database.MakeAnnouncement(c.Name + " has reborned and is ready for new adventures and endless possibilities.")
 							time.AfterFunc(time.Duration(2*time.Second), func() {
 								CharacterSelect := utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x01, 0x05, 0x0A, 0x00, 0x55, 0xAA}
 								CHARACTER_MENU := utils.Packet{0xAA, 0x55, 0x03, 0x00, 0x09, 0x09, 0x00, 0x55, 0xAA}
 								resp := CHARACTER_MENU
 								resp.Concat(CharacterSelect)
-								s.Conn.Write(resp)
+								s.Write(resp)
 							})
 						} else {
 							resp.Concat(messaging.InfoMessage(fmt.Sprintf("You don't have class."))) //NOTICE TO NO SELECTED CLASS
@@ -1790,6 +1653,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 						c.Socket.Write(resp)
 						c.Level = 1
 						c.RebornLevel = 3
+						c.Socket.Write(c.AdvanceAchievements(database.ACHIEVEMENT_REBORN, 0, c.RebornLevel))
 						// TODO karakterin exp ve drobunu ayarla karakter login olduğunda reborn levele göre versin
 						c.Exp = 0
 						c.Class = 0
@@ -1817,14 +1681,14 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 							return nil, err
 						}
 						resp.Concat(statData)
-						s.Conn.Write(resp)
+						s.Write(resp)
 						database.MakeAnnouncement(c.Name + " has reborned and is ready for new adventures and endless possibilities.")
 						time.AfterFunc(time.Duration(2*time.Second), func() {
 							CharacterSelect := utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x01, 0x05, 0x0A, 0x00, 0x55, 0xAA}
 							CHARACTER_MENU := utils.Packet{0xAA, 0x55, 0x03, 0x00, 0x09, 0x09, 0x00, 0x55, 0xAA}
 							resp := CHARACTER_MENU
 							resp.Concat(CharacterSelect)
-							s.Conn.Write(resp)
+							s.Write(resp)
 						})
 					} else {
 						resp.Concat(messaging.InfoMessage(fmt.Sprintf("You don't have class."))) //NOTICE TO NO SELECTED CLASS
@@ -1865,7 +1729,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				resp.Concat(messaging.InfoMessage(fmt.Sprintf("You are not at 155 Level")))
 			}
 		case 1366:
-			if database.GuildVarActive {
+			if database.GuildWarActive() {
 				guild, err := database.FindGuildByID(c.GuildID)
 				if err != nil {
 					fmt.Println(err)
@@ -1992,7 +1856,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				return nil, nil
 			}
 
-			buffinfo := database.BuffInfections[1337]
+			buffinfo := database.FindBuffInfection(1337)
 			buff = &database.Buff{ID: 1337, CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(720) * 60, EXPMultiplier: 20, DropMultiplier: 5}
 			err = buff.Create()
 			if err != nil {
@@ -2324,43 +2188,28 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				return resp, nil
 			}
 
-			if database.GoldenBasinArea.FactionID == 0 {
-				if database.CanJoinGoldenBasin {
-					if c.Faction == 1 {
-						x := 75.0
-						y := 431.0
-						data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-						resp.Concat(data)
-					}
-
-					if c.Faction == 2 {
-						x := 430.0
-						y := 75.0
-						data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-						resp.Concat(data)
-					}
-				} else {
-					resp := messaging.InfoMessage("Golden Basin war not started yet or already finished.")
-					return resp, nil
+			if database.FindBattleground(database.BATTLEGROUND_GOLDEN_BASIN) != nil {
+				data, err := database.JoinBattleground(database.BATTLEGROUND_GOLDEN_BASIN, c)
+				if err != nil {
+					return messaging.InfoMessage(err.Error()), nil
 				}
+				resp.Concat(data)
+			} else if !database.CanEnterGoldenBasin(c) {
+				resp := messaging.InfoMessage("Golden Basin is currently on the enemy side.")
+				return resp, nil
 			} else {
-				if c.Faction != database.GoldenBasinArea.FactionID {
-					resp := messaging.InfoMessage("Golden Basin is currently on the enemy side.")
-					return resp, nil
-				} else {
-					if c.Faction == 1 {
-						x := 75.0
-						y := 431.0
-						data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-						resp.Concat(data)
-					}
+				if c.Faction == 1 {
+					x := 75.0
+					y := 431.0
+					data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
+					resp.Concat(data)
+				}
 
-					if c.Faction == 2 {
-						x := 430.0
-						y := 75.0
-						data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-						resp.Concat(data)
-					}
+				if c.Faction == 2 {
+					x := 430.0
+					y := 75.0
+					data, _ := c.ChangeMap(76, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
+					resp.Concat(data)
 				}
 			}
 		case 1391:
@@ -2396,7 +2245,7 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				return nil, nil
 			}
 
-			buffinfo := database.BuffInfections[70024]
+			buffinfo := database.FindBuffInfection(70024)
 			buff = &database.Buff{ID: 70024, CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(1440) * 60}
 			err = buff.Create()
 			if err != nil {
@@ -2416,117 +2265,35 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 			resp.Insert(utils.IntToBytes(uint64(351), 4, true), 7) // shop id
 			return resp, nil
 		case 3087:
-			if c.Map == 17 {
-				if c.PartyID == "" {
-					resp = GetNPCMenu(npcID, 133702, 0, nil)
-				} else {
-					party := database.FindParty(c)
-					if party.Leader.ID != c.ID {
-						resp = GetNPCMenu(npcID, 133703, 0, nil)
-						return resp, nil
-					}
-					if len(party.Members) > 3 {
-						msg := messaging.InfoMessage("Maximum 3 players can entry at once.")
-						party.Leader.Socket.Write(msg)
-						return nil, nil
-					}
-
-					if dungeon.IsDungeonClosed {
-						msg := messaging.InfoMessage("All dungeons are full at this moment, come back later.")
-						party.Leader.Socket.Write(msg)
-						return nil, nil
-					}
-
-					if c.Level < 70 {
-						resp = GetNPCMenu(npcID, 133705, 0, nil)
-						return resp, nil
-					}
-
-					database.CountYingYangMobs(243)
-					database.YingYangMobsMutex.Lock()
-					yingYangMobs := database.YingYangMobsCounter[243]
-					database.YingYangMobsMutex.Unlock()
-
-					if yingYangMobs.BlackBandits < 50 || yingYangMobs.Rogues < 50 || yingYangMobs.Ghosts < 50 || yingYangMobs.Animals < 50 || yingYangMobs.BeastMaster != 1 || yingYangMobs.Paechun != 1 {
-						msg := messaging.InfoMessage("Dungeon is not ready at this moment, come back later.")
-						party.Leader.Socket.Write(msg)
-						return nil, nil
-					}
-
-					slot, _, err := c.FindItemInInventory(nil, 99002475)
-					if err != nil {
-						resp = GetNPCMenu(npcID, 133704, 0, nil)
-						return resp, nil
-					} else if slot == -1 {
-						resp = GetNPCMenu(npcID, 133704, 0, nil)
-						return resp, nil
-					}
-
-					for _, member := range party.Members {
-						if member.Character.Level < 70 { //
-							resp = GetNPCMenu(npcID, 133705, 0, nil)
-							return resp, nil
-						}
-
-						tmpSlot, _, err := member.FindItemInInventory(nil, 99002475)
-						if err != nil {
-							resp = GetNPCMenu(npcID, 133704, 0, nil)
-							return resp, nil
-						} else if tmpSlot == -1 {
-							resp = GetNPCMenu(npcID, 133704, 0, nil)
-							return resp, nil
-						}
-
-						decResp := member.DecrementItem(tmpSlot, uint(1))
-						//member.Socket.Conn.Write(*decResp)
-						member.Socket.Write(*decResp)
-					}
-
-					decResp := c.DecrementItem(slot, uint(1))
-					c.Socket.Write(*decResp)
-					go dungeon.StartYingYang(party)
-				}
-			} /*else if c.Map == 24 {
-				if c.PartyID == "" {
-					resp = GetNPCMenu(npcID, 133702, 0, nil)
-				} else {
-					party := database.FindParty(c)
-					if party.Leader.ID != c.ID {
-						resp = GetNPCMenu(npcID, 133703, 0, nil)
-						return resp, nil
-					}
-					if len(party.Members) > 3 {
-						msg := messaging.InfoMessage("Maximum 3 players can entry at once.")
-						party.Leader.Socket.Write(msg)
-						return nil, nil
-					}
-
-					if c.YingYangTicketsLeft <= 0 {
-						resp = GetNPCMenu(npcID, 133704, 0, nil)
-						return resp, nil
-					} else if c.Level < 101 || c.Level > 200 {
-						resp = GetNPCMenu(npcID, 133705, 0, nil)
-						return resp, nil
-					}
+			// ying yang at the marketplace, the divine one at map 24
+			name := "yingyang"
+			if c.Map == 24 {
+				name = "divine_yingyang"
+			} else if c.Map != 17 {
+				return nil, nil
+			}
 
-					for _, member := range party.Members {
+			party := database.FindParty(c)
+			if c.PartyID == "" || party == nil {
+				return GetNPCMenu(npcID, 133702, 0, nil), nil
+			} else if party.Leader.ID != c.ID {
+				return GetNPCMenu(npcID, 133703, 0, nil), nil
+			}
 
-						if member.Character.YingYangTicketsLeft <= 0 {
-							resp = GetNPCMenu(npcID, 133704, 0, nil)
-							return resp, nil
-						} else if member.Character.Level < 101 || member.Character.Level > 200 {
-							resp = GetNPCMenu(npcID, 133705, 0, nil)
-							return resp, nil
-						}
+			d := database.FindDungeon(name)
+			if d == nil {
+				return messaging.InfoMessage("This dungeon is closed."), nil
+			}
 
-						member.Character.YingYangTicketsLeft--
-						member.Character.Update()
-					}
-					c.YingYangTicketsLeft--
-					c.Update()
-					go dungeon.StartDivineYingYang(party)
-				}
-			} */
+			switch err := dungeon.Start(d, party); err {
+			case nil:
+			case database.ErrDungeonLevel:
+				return GetNPCMenu(npcID, 133705, 0, nil), nil
+			case database.ErrDungeonTicket:
+				return GetNPCMenu(npcID, 133704, 0, nil), nil
+			default:
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		case 3088:
 			if c.YingYangTicketsLeft {
 				itemData, _, err := c.AddItem(&database.InventorySlot{ItemID: 99002475, Quantity: 3}, -1, false)
@@ -2540,17 +2307,6 @@ func (h *PressButtonHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 				return *itemData, nil
 			}
 			return nil, nil
-		case 3103:
-			shopNo := shops[npcID]
-			resp = OPEN_SHOP
-			resp.Insert(utils.IntToBytes(uint64(shopNo), 4, true), 7) // shop id
-		case 197101: // Move to Marketplace
-			resp, _ = c.ChangeMap(254, nil)
-		case 197102:
-			x := 321.0
-			y := 339.0
-			resp, _ = c.ChangeMap(254, database.ConvertPointToLocation(fmt.Sprintf("%.1f,%.1f", x, y)))
-
 		case 1801:
 			if c.Exp == 233332051410 && c.Level == 100 {
 				r, _ := c.ChangeMap(43, nil)
@@ -2590,69 +2346,6 @@ func GetNPCMenu(npcID, textID, index int, actions []int) []byte {
 	return resp
 }
 
-func firstJobPromotion(c *database.Character, book, job, npcID int) (utils.Packet, error) {
-	resp := utils.Packet{}
-	if c.Class == 0 && c.Level >= 10 {
-		c.Class = job
-		resp = JOB_PROMOTED
-		resp[6] = byte(job)
-
-		r, _, err := c.AddItem(&database.InventorySlot{ItemID: int64(book), Quantity: 1}, -1, false)
-		if err != nil {
-			return resp, err
-		} else if r == nil {
-			return nil, nil
-		}
-
-		resp.Concat(*r)
-
-	} else if c.Level < 10 {
-		resp = NOT_ENOUGH_LEVEL
-		resp.Insert(utils.IntToBytes(uint64(npcID), 4, true), 6) // npc id
-	} else {
-		resp = INVALID_CLASS
-		resp.Insert(utils.IntToBytes(uint64(npcID), 4, true), 6) // npc id
-	}
-
-	return resp, nil
-}
-
-func secondJobPromotion(c *database.Character, book1, book2, preJob, job, npcID int) (utils.Packet, error) {
-	resp := utils.Packet{}
-	if c.Class == preJob && c.Level >= 50 {
-		c.Class = job
-		resp = JOB_PROMOTED
-		resp[6] = byte(job)
-
-		r, _, err := c.AddItem(&database.InventorySlot{ItemID: int64(book1), Quantity: 1}, -1, false)
-		if err != nil {
-			return resp, err
-		} else if r == nil {
-			return nil, nil
-		}
-
-		resp.Concat(*r)
-
-		r, _, err = c.AddItem(&database.InventorySlot{ItemID: int64(book2), Quantity: 1}, -1, false)
-		if err != nil {
-			return resp, err
-		} else if r == nil {
-			return nil, nil
-		}
-
-		resp.Concat(*r)
-
-	} else if c.Level < 50 {
-		resp := NOT_ENOUGH_LEVEL
-		resp.Insert(utils.IntToBytes(uint64(npcID), 4, true), 6) // npc id
-	} else {
-		resp = INVALID_CLASS
-		resp.Insert(utils.IntToBytes(uint64(npcID), 4, true), 6) // npc id
-	}
-
-	return resp, nil
-}
-
 func divineJobPromotion(c *database.Character, npcID int) (utils.Packet, error) {
 	resp := utils.Packet{}
 	if c.Class != 0 {
@@ -129,60 +129,61 @@ func (h *TravelToCastleHandler) Handle(s *database.Socket, data []byte) ([]byte,
 	}
 
 	if s.Character.Map == 233 {
+		fiveClans := database.FindTerritory(database.TERRITORY_FIVE_CLANS)
 		resp := CLANCASTLE_MAP
 		index := 7
 		length := 3
-		if database.FiveClans[1].ClanID != 0 {
+		if fiveClans.Holder(1) != 0 {
 			//FLAME, WATERFALL, SKY GARDEN, FOREST,UNDERGROUND
 			resp.Insert([]byte{0x01, 0xdf, 0x04, 0x00, 0x00}, index)
 			index += 5
 			length += 5
-			area, _ := database.FindGuildByID(database.FiveClans[1].ClanID) //FLAME WOLF TEMPLE
-			resp.Insert([]byte{byte(len(area.Name))}, index)                // Guild name length
+			area, _ := database.FindGuildByID(fiveClans.Holder(1)) //FLAME WOLF TEMPLE
+			resp.Insert([]byte{byte(len(area.Name))}, index)       // Guild name length
 			index++
 			resp.Insert([]byte(area.Name), index) // Guild name
 			index += len(area.Name)
 			length += 1 + len(area.Name)
 		}
-		if database.FiveClans[2].ClanID != 0 {
+		if fiveClans.Holder(2) != 0 {
 			resp.Insert([]byte{0x02, 0xeb, 0x00, 0x00, 0x00}, index)
 			index += 5
 			length += 5
-			area, _ := database.FindGuildByID(database.FiveClans[2].ClanID) //OCEAN ARMY
-			resp.Insert([]byte{byte(len(area.Name))}, index)                // Guild name length
+			area, _ := database.FindGuildByID(fiveClans.Holder(2)) //OCEAN ARMY
+			resp.Insert([]byte{byte(len(area.Name))}, index)       // Guild name length
 			index++
 			resp.Insert([]byte(area.Name), index) // Guild name
 			index += len(area.Name)
 			length += 1 + len(area.Name)
 		}
-		if database.FiveClans[3].ClanID != 0 {
+		if fiveClans.Holder(3) != 0 {
 			resp.Insert([]byte{0x03, 0x5d, 0x06, 0x00, 0x00}, index)
 			index += 5
 			length += 5
-			area, _ := database.FindGuildByID(database.FiveClans[3].ClanID) //LIGHTNING HILL
-			resp.Insert([]byte{byte(len(area.Name))}, index)                // Guild name length
+			area, _ := database.FindGuildByID(fiveClans.Holder(3)) //LIGHTNING HILL
+			resp.Insert([]byte{byte(len(area.Name))}, index)       // Guild name length
 			index++
 			resp.Insert([]byte(area.Name), index) // Guild name
 			index += len(area.Name)
 			length += 1 + len(area.Name)
 		}
-		if database.FiveClans[4].ClanID != 0 {
+		if fiveClans.Holder(4) != 0 {
 			resp.Insert([]byte{0x04, 0xf0, 0x06, 0x00, 0x00}, index)
 			index += 5
 			length += 5
-			area, _ := database.FindGuildByID(database.FiveClans[4].ClanID) //SOUTHERN WOOD TEMPLE
-			resp.Insert([]byte{byte(len(area.Name))}, index)                // Guild name length
+			area, _ := database.FindGuildByID(fiveClans.Holder(4)) //SOUTHERN WOOD TEMPLE
+			resp.Insert([]byte{byte(len(area.Name))}, index)       // Guild name length
 			index++
 			resp.Insert([]byte(area.Name), index) // Guild name
 			index += len(area.Name)
 			length += 1 + len(area.Name)
 		}
-		if database.FiveClans[5].ClanID != 0 {
+		if fiveClans.Holder(5) != 0 {
 			resp.Insert([]byte{0x05, 0xd7, 0x05, 0x00, 0x00}, index)
 			index += 5
 			length += 5
-			area, _ := database.FindGuildByID(database.FiveClans[5].ClanID) //WESTERN LAND TEMPLE
-			resp.Insert([]byte{byte(len(area.Name))}, index)                // Guild name length
+			area, _ := database.FindGuildByID(fiveClans.Holder(5)) //WESTERN LAND TEMPLE
+			resp.Insert([]byte{byte(len(area.Name))}, index)       // Guild name length
 			index++
 			resp.Insert([]byte(area.Name), index) // Guild name
 			index += len(area.Name)
@@ -217,44 +218,44 @@ func (h *TravelToFiveClanArea) Handle(s *database.Socket, data []byte) ([]byte,
 		//s.Write(coord)
 		/*
 			case 1: //FLAME WOLF TEMPLE
-				if s.Character.GuildID == database.FiveClans[1].ClanID {
+				if s.Character.GuildID == database.FindTerritory(database.TERRITORY_FIVE_CLANS).Holder(1) {
 					x := "243,777"
 					coord := s.Character.Teleport(database.ConvertPointToLocation(x))
-					s.Conn.Write(coord)
+					s.Write(coord)
 				} else {
-					s.Conn.Write(CANNOT_MOVE)
+					s.Write(CANNOT_MOVE)
 				}
 			case 2: //OCEAN ARMY
-				if s.Character.GuildID == database.FiveClans[2].ClanID {
+				if s.Character.GuildID == database.FindTerritory(database.TERRITORY_FIVE_CLANS).Holder(2) {
 					x := "131,433"
 					coord := s.Character.Teleport(database.ConvertPointToLocation(x))
-					s.Conn.Write(coord)
+					s.Write(coord)
 				} else {
-					s.Conn.Write(CANNOT_MOVE)
+					s.Write(CANNOT_MOVE)
 				}
 			case 3: //LIGHTNING HILL
-				if s.Character.GuildID == database.FiveClans[3].ClanID {
+				if s.Character.GuildID == database.FindTerritory(database.TERRITORY_FIVE_CLANS).Holder(3) {
 					x := "615,171"
 					coord := s.Character.Teleport(database.ConvertPointToLocation(x))
-					s.Conn.Write(coord)
+					s.Write(coord)
 				} else {
-					s.Conn.Write(CANNOT_MOVE)
+					s.Write(CANNOT_MOVE)
 				}
 			case 4: //SOUTHERN WOOD TEMPLE
-				if s.Character.GuildID == database.FiveClans[4].ClanID {
+				if s.Character.GuildID == database.FindTerritory(database.TERRITORY_FIVE_CLANS).Holder(4) {
 					x := "863,425"
 					coord := s.Character.Teleport(database.ConvertPointToLocation(x))
-					s.Conn.Write(coord)
+					s.Write(coord)
 				} else {
-					s.Conn.Write(CANNOT_MOVE)
+					s.Write(CANNOT_MOVE)
 				}
 			case 5: //WESTERN LAND TEMPLE
-				if s.Character.GuildID == database.FiveClans[5].ClanID {
+				if s.Character.GuildID == database.FindTerritory(database.TERRITORY_FIVE_CLANS).Holder(5) {
 					x := "689,867"
 					coord := s.Character.Teleport(database.ConvertPointToLocation(x))
-					s.Conn.Write(coord)
+					s.Write(coord)
 				} else {
-					s.Conn.Write(CANNOT_MOVE)
+					s.Write(CANNOT_MOVE)
 				}
 		*/
 	}
@@ -313,14 +314,14 @@ func (h *OpenLotHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 		go s.Character.GetGold()
 	}
 
-	drop, ok := database.Drops[dropID]
+	drop := database.FindDrop(dropID)
 	if drop == nil {
 		return nil, nil
 	}
 
 	resp := OPEN_LOT
 	itemID := 0
-	for ok {
+	for drop != nil {
 		index := 0
 		seed := int(utils.RandInt(0, 1000))
 		items := drop.GetItems()
@@ -340,7 +341,7 @@ func (h *OpenLotHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 		}
 
 		itemID = items[index]
-		drop, ok = database.Drops[itemID]
+		drop = database.FindDrop(itemID)
 	}
 
 	if itemID == 10002 {
@@ -359,7 +360,7 @@ func (h *OpenLotHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 			}
 		}
 
-		info := database.Items[int64(itemID)]
+		info := database.FindItem(int64(itemID))
 		if info == nil {
 			return nil, nil
 		}
@@ -398,15 +399,10 @@ func (h *EnterGateHandler) Handle(s *database.Socket, data []byte) ([]byte, erro
 		return nil, nil
 	}
 
-	database.GatesMutex.Lock()
-	gate, ok := database.Gates[gateID]
-	database.GatesMutex.Unlock()
+	gate := database.FindGate(gateID)
 	if gate == nil { // 01.12.2023 // BUG FIX
 		return s.Character.ChangeMap(int16(s.Character.Map), nil)
 	}
-	if !ok {
-		return s.Character.ChangeMap(int16(s.Character.Map), nil)
-	}
 
 	if gate.TargetMap == 14 || gate.TargetMap == 15 {
 		if s.Character.Faction == 2 {
@@ -558,7 +554,7 @@ func (h *TransferItemTypeHandler) Handle(s *database.Socket, data []byte) ([]byt
 		return nil, err
 	}
 	item := invSlots[slot]
-	info := database.Items[item.ItemID]
+	info := database.FindItem(item.ItemID)
 	if info.ItemPair == 0 {
 		return nil, nil
 	} else {
@@ -103,18 +103,16 @@ func (h *AttackHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 						return nil, nil
 					}
 
-					buffinfo := database.BuffInfections[56]
+					buffinfo := database.FindBuffInfection(56)
 					buff = &database.Buff{ID: 56, CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(5) * 60}
 					err = buff.Create()
 					return nil, nil
 				}
 			}
 
-			if c.IsinWar {
-				if npc.ID == 424201 || npc.ID == 424202 {
-					if !database.WarStarted {
-						return nil, nil
-					}
+			if npc.ID == 424201 || npc.ID == 424202 {
+				if b := c.Battleground(); b != nil && !b.Running() {
+					return nil, nil
 				}
 			}
 
@@ -250,18 +248,16 @@ func (h *InstantAttackHandler) Handle(s *database.Socket, data []byte) ([]byte,
 						return nil, nil
 					}
 
-					buffinfo := database.BuffInfections[56]
+					buffinfo := database.FindBuffInfection(56)
 					buff = &database.Buff{ID: 56, CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(5) * 60}
 					err = buff.Create()
 					return nil, nil
 				}
 			}
 
-			if c.IsinWar {
-				if npc.ID == 424201 || npc.ID == 424202 {
-					if !database.WarStarted {
-						return nil, nil
-					}
+			if npc.ID == 424201 || npc.ID == 424202 {
+				if b := c.Battleground(); b != nil && !b.Running() {
+					return nil, nil
 				}
 			}
 
@@ -375,14 +371,14 @@ func (h *DealDamageHandler) Handle(s *database.Socket, data []byte) ([]byte, err
 		ai := c.TamingAI
 		pos := database.NPCPos[ai.PosID]
 		npc := database.NPCs[pos.NPCID]
-		petInfo := database.Pets[int64(npc.ID)]
+		petInfo := database.FindPet(int64(npc.ID))
 
 		seed := utils.RandInt(0, 1000)
 		if seed < 250 && petInfo != nil {
 			go c.DealDamage(ai, ai.HP)
 
 			item := &database.InventorySlot{ItemID: int64(npc.ID), Quantity: 1}
-			expInfo := database.PetExps[petInfo.Level-1]
+			expInfo := database.FindPetExp(petInfo.Level - 1)
 			item.Pet = &database.PetSlot{
 				Fullness: 100, Loyalty: 100,
 				Exp:   uint64(expInfo.ReqExpEvo1),
@@ -489,7 +485,7 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			dmg = critical
 			r = PVP_DEAL_SKILL_CRITICAL_DAMAGE
 
-			buffinfo := database.BuffInfections[265]
+			buffinfo := database.FindBuffInfection(265)
 			buff := database.Buff{ID: int(265), CharacterID: enemy.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: enemy.Epoch, Duration: int64(2) * 2}
 			buff.Create()
 		}
@@ -502,7 +498,7 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			dmg = critical
 			r = PVP_DEAL_SKILL_CRITICAL_DAMAGE
 
-			buffinfo := database.BuffInfections[265]
+			buffinfo := database.FindBuffInfection(265)
 			buff := database.Buff{ID: int(265), CharacterID: enemy.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: enemy.Epoch, Duration: int64(2) * 2}
 			buff.Create()
 		}
@@ -581,7 +577,7 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			reflectionDmg := (80 / 100.0) * float32(dmg)
 			dmg = int(reflectionDmg)
 
-			buffinfo := database.BuffInfections[221]
+			buffinfo := database.FindBuffInfection(221)
 			buff := database.Buff{ID: int(221), CharacterID: enemy.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: enemy.Epoch, Duration: int64(2) * 2}
 			buff.Create()
 		}
@@ -596,7 +592,7 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			c.Socket.Stats.HP -= int(reflectionDmg)
 			dmg = 3
 
-			buffinfo := database.BuffInfections[88]
+			buffinfo := database.FindBuffInfection(88)
 			buff := database.Buff{ID: int(88), CharacterID: enemy.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: enemy.Epoch, Duration: int64(2) * 2}
 			buff.Create()
 		}
@@ -624,7 +620,7 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			absorbedDmg := (30 / 100.0) * float32(dmg)
 			dmg = dmg - int(absorbedDmg)
 
-			buffinfo := database.BuffInfections[103]
+			buffinfo := database.FindBuffInfection(103)
 			buff := database.Buff{ID: int(103), CharacterID: enemy.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: enemy.Epoch, Duration: int64(2) * 2}
 			buff.Create()
 		}
@@ -686,16 +682,9 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 		enemy.Socket.Write(enemy.GetHPandChi())
 		info := fmt.Sprintf("[%s] has defeated [%s]", c.Name, enemy.Name)
 		r := messaging.InfoMessage(info)
-		if database.WarStarted && c.IsinWar && enemy.IsinWar {
-			c.WarKillCount++
-			if c.Faction == 1 {
-				database.ShaoPoints -= 5
-			} else {
-				database.OrderPoints -= 5
-			}
-		}
+		c.BattlegroundKill(enemy)
 
-		if funk.Contains(database.LoseEXPServers, int16(c.Socket.User.ConnectedServer)) && funk.Contains(database.LoseEXPServers, int16(enemy.Socket.User.ConnectedServer)) && !c.IsinWar && !enemy.IsinWar {
+		if funk.Contains(database.LoseEXPServers, int16(c.Socket.User.ConnectedServer)) && funk.Contains(database.LoseEXPServers, int16(enemy.Socket.User.ConnectedServer)) && c.Battleground() == nil && enemy.Battleground() == nil {
 			if s.Character.Level < 101 && enemy.Level < 101 /* && s.Character.RebornLevel == enemy.RebornLevel */ {
 				database.MakeAnnouncement("[" + s.Character.Name + "] has slain [" + enemy.Name + "]")
 				different := int(c.Level - enemy.Level)
@@ -719,17 +708,10 @@ func DealDamageToPlayer(s *database.Socket, enemy *database.Character, dmg int)
 			}
 		}
 
-		if c.IsinLastMan && enemy.IsinLastMan {
-			enemy.IsinLastMan = false
-			database.LastManMutex.Lock()
-			delete(database.LastManCharacters, enemy.ID)
-			database.LastManMutex.Unlock()
-		}
-
 		if c.Map != 233 && c.Map != 250 && c.Map != 74 && c.DuelID != enemy.ID {
 			if c.Level > 100 && enemy.Level <= 100 {
 				buff, _ := database.FindBuffByID(56, c.ID)
-				buffinfo := database.BuffInfections[56]
+				buffinfo := database.FindBuffInfection(56)
 				buff = &database.Buff{ID: 56, CharacterID: c.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: c.Epoch, Duration: int64(60) * 60}
 				buff.Create()
 			}
@@ -804,18 +786,16 @@ func (h *CastSkillHandler) Handle(s *database.Socket, data []byte) ([]byte, erro
 						return nil, nil
 					}
 
-					buffinfo := database.BuffInfections[56]
+					buffinfo := database.FindBuffInfection(56)
 					buff = &database.Buff{ID: 56, CharacterID: s.Character.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: s.Character.Epoch, Duration: int64(5) * 60}
 					err = buff.Create()
 					return nil, nil
 				}
 			}
 
-			if s.Character.IsinWar {
-				if npc.ID == 424201 || npc.ID == 424202 {
-					if !database.WarStarted {
-						return nil, nil
-					}
+			if npc.ID == 424201 || npc.ID == 424202 {
+				if b := s.Character.Battleground(); b != nil && !b.Running() {
+					return nil, nil
 				}
 			}
 
@@ -886,18 +866,16 @@ func (h *CastMonkSkillHandler) Handle(s *database.Socket, data []byte) ([]byte,
 						return nil, nil
 					}
 
-					buffinfo := database.BuffInfections[56]
+					buffinfo := database.FindBuffInfection(56)
 					buff = &database.Buff{ID: 56, CharacterID: s.Character.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: s.Character.Epoch, Duration: int64(5) * 60}
 					err = buff.Create()
 					return nil, nil
 				}
 			}
 
-			if s.Character.IsinWar {
-				if npc.ID == 424201 || npc.ID == 424202 {
-					if !database.WarStarted {
-						return nil, nil
-					}
+			if npc.ID == 424201 || npc.ID == 424202 {
+				if b := s.Character.Battleground(); b != nil && !b.Running() {
+					return nil, nil
 				}
 			}
 		}
@@ -921,7 +899,7 @@ func (h *CastMonkSkillHandler) Handle(s *database.Socket, data []byte) ([]byte,
 	resp.Insert(utils.IntToBytes(uint64(targetID), 2, true), 20)            // target pseudo id
 	resp.Insert(utils.IntToBytes(uint64(skillID), 4, true), 22)             // skill id
 
-	skill := database.SkillInfos[skillID]
+	skill := database.FindSkillInfo(skillID)
 	token := s.Character.MovementToken
 
 	time.AfterFunc(time.Duration(skill.CastTime*1000)*time.Millisecond, func() {
@@ -965,7 +943,7 @@ func ApplyStatusEffects(character, enemy *database.Character) {
 
 		if int(rand) <= probabilty {
 			if !enemy.Paralised {
-				enemy.SpecialEffects(database.BuffInfections[259], int64(seconds))
+				enemy.SpecialEffects(database.FindBuffInfection(259), int64(seconds))
 				enemy.Paralised = true
 			}
 		}
@@ -979,7 +957,7 @@ func ApplyStatusEffects(character, enemy *database.Character) {
 
 		if int(rand) <= probabilty {
 			if !enemy.Confused {
-				enemy.SpecialEffects(database.BuffInfections[258], int64(seconds))
+				enemy.SpecialEffects(database.FindBuffInfection(258), int64(seconds))
 				enemy.Confused = true
 			}
 		}
@@ -993,7 +971,7 @@ func ApplyStatusEffects(character, enemy *database.Character) {
 
 		if int(rand) <= probabilty {
 			if !enemy.Poisoned {
-				enemy.SpecialEffects(database.BuffInfections[257], int64(seconds))
+				enemy.SpecialEffects(database.FindBuffInfection(257), int64(seconds))
 				enemy.Poisoned = true
 			}
 		}
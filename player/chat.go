@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"hero-server/codec"
 	"hero-server/database"
 	"hero-server/logging"
 	"hero-server/messaging"
@@ -35,12 +36,11 @@ type Emotion struct{}
 var (
 	CHAT_MESSAGE  = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x00, 0x55, 0xAA}
 	SHOUT_MESSAGE = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x71, 0x0E, 0x00, 0x00, 0x55, 0xAA}
-	ANNOUNCEMENT  = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x71, 0x06, 0x00, 0x55, 0xAA}
 )
 
 func (h *Emotion) Handle(s *database.Socket, data []byte) ([]byte, error) {
 	emotID := int(utils.BytesToInt(data[11:12], true))
-	emotion := database.Emotions[emotID]
+	emotion := database.FindEmotion(emotID)
 	if emotion == nil {
 		return nil, nil
 	}
@@ -80,7 +80,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 	case 28929: // normal chat
 		messageLen := utils.BytesToInt(data[6:8], true)
 		h.message = string(data[8 : messageLen+8])
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (N)")
+		h.logChat(s, "normal", nil)
 
 		return h.normalChat(s)
 	case 28930: // private chat
@@ -106,7 +106,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 		index += 2
 
 		h.message = string(data[index : index+messageLen])
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (PM : "+c.Name+")")
+		h.logChat(s, "private", c)
 		return h.chatWithReceivers(s, h.createChatMessage)
 
 	case 28931: // party chat
@@ -133,7 +133,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 		}
 		h.receiversMutex.Unlock()
 
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (Party)")
+		h.logChat(s, "party", nil)
 		return h.chatWithReceivers(s, h.createChatMessage)
 
 	case 28932: // guild chat
@@ -163,7 +163,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 			}
 			h.receiversMutex.Unlock()
 
-			logging.AddLogFile(1, s.Character.Name+": "+h.message+" (Guild)")
+			h.logChat(s, "guild", nil)
 			return h.chatWithReceivers(s, h.createChatMessage)
 		}
 
@@ -201,7 +201,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 
 		//resp.Concat(chat)
 		resp.Concat(s.Character.GetHPandChi())
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (Roar)")
+		h.logChat(s, "roar", nil)
 		return resp, nil
 
 	case 28935: // commands
@@ -213,7 +213,6 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 		return h.cmdMessage(s, data)
 
 	case 28943: // shout
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (Shout)")
 		return h.Shout(s, data)
 
 	case 28945: // faction chat
@@ -244,7 +243,7 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 		}
 
 		//resp.Concat(chat)
-		logging.AddLogFile(1, s.Character.Name+": "+h.message+" (Faction)")
+		h.logChat(s, "faction", nil)
 		return resp, nil
 
 	}
@@ -252,6 +251,16 @@ func (h *ChatHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 	return nil, nil
 }
 
+// logChat emits the message of s on channel, to is the receiver of a
+// private message.
+func (h *ChatHandler) logChat(s *database.Socket, channel string, to *database.Character) {
+	e := s.Character.Event(logging.ACTION_CHAT, channel+": "+h.message)
+	if to != nil {
+		e.TargetID = to.ID
+	}
+	logging.Emit(e)
+}
+
 func (h *ChatHandler) Shout(s *database.Socket, data []byte) ([]byte, error) {
 
 	if time.Now().Sub(s.Character.LastRoar) < 10*time.Second {
@@ -288,6 +297,7 @@ func (h *ChatHandler) Shout(s *database.Socket, data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	h.logChat(s, "shout", nil)
 
 	//resp.Concat(chat)
 	return *resp, nil
@@ -394,13 +404,7 @@ func (h *ChatHandler) chatWithReceivers(s *database.Socket, msgHandler func(*dat
 }
 
 func makeAnnouncement(msg string) {
-	length := int16(len(msg) + 3)
-
-	resp := ANNOUNCEMENT
-	resp.SetLength(length)
-	resp[6] = byte(len(msg))
-	resp.Insert([]byte(msg), 7)
-
+	resp := codec.Encode(&codec.Announcement{Message: msg})
 	p := nats.CastPacket{CastNear: false, Data: resp}
 	p.Cast()
 }
@@ -414,12 +418,38 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 
 	if parts := strings.Split(h.message, " "); len(parts) > 0 {
 		if h.message != "/home" {
-			logging.AddLogFile(0, s.Character.Name+": "+h.message+" (Admin)")
+			logging.Emit(s.Character.Event(logging.ACTION_CHAT_COMMAND, h.message))
 		}
 		cmd := strings.ToLower(strings.TrimPrefix(parts[0], "/"))
 		switch cmd {
 		case "shout":
 			return h.Shout(s, data)
+		case "achievements":
+			c := s.Character
+			if len(parts) > 1 && s.User.UserType >= server.GM_USER {
+				c, err = database.FindCharacterByName(parts[1])
+				if err != nil {
+					return nil, err
+				} else if c == nil {
+					return messaging.InfoMessage("Character not found."), nil
+				}
+			}
+
+			achievements, err := database.AchievementsOf(c.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			resp.Concat(messaging.InfoMessage(fmt.Sprintf("%s achievements:", c.Name)))
+			for _, a := range achievements {
+				msg := fmt.Sprintf("%s: %d/%d", a.Name, a.Progress, a.Count)
+				if a.Completed && a.Title != "" {
+					msg += fmt.Sprintf(" [%s]", a.Title)
+				} else if a.Completed {
+					msg += " done"
+				}
+				resp.Concat(messaging.InfoMessage(msg))
+			}
 		case "announce":
 			if s.User.UserType < server.GA_USER {
 				return nil, nil
@@ -464,28 +494,15 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 				}
 			}
 
-			item := &database.InventorySlot{ItemID: itemID, Quantity: uint(quantity)}
-			info := database.Items[itemID]
-
-			if info.GetType() == database.PET_TYPE {
-				petInfo := database.Pets[itemID]
-				expInfo := database.PetExps[petInfo.Level-1]
-
-				item.Pet = &database.PetSlot{
-					Fullness: 100, Loyalty: 100,
-					Exp:   uint64(expInfo.ReqExpEvo1),
-					HP:    petInfo.BaseHP,
-					Level: byte(petInfo.Level),
-					Name:  petInfo.Name,
-					CHI:   petInfo.BaseChi}
-			}
-
-			r, _, err := ch.AddItem(item, -1, false)
+			item := database.NewItemSlot(itemID, uint(quantity))
+			r, _, err := ch.GrantItem(item, -1, false, s.Character.Name)
 			if err != nil {
 				return nil, err
 			}
 
-			go logger.Log(logging.ACTION_CREATE_ITEM, s.Character.ID, fmt.Sprintf("%s isimli oyuncu %d id li item oluşturdu.", s.Character.Name, itemID), s.User.ID, s.Character.Name)
+			e := s.Character.Event(logging.ACTION_CREATE_ITEM, fmt.Sprintf("Created %d of %d for %s", quantity, itemID, ch.Name))
+			e.TargetID, e.ItemIDs = ch.ID, []int64{itemID}
+			logging.Emit(e)
 
 			ch.Socket.Write(*r)
 			return nil, nil
@@ -497,7 +514,7 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 				return nil, nil
 			}
 			number, _ := strconv.ParseInt(parts[1], 10, 32)
-			buffinfo := database.BuffInfections[int(number)]
+			buffinfo := database.FindBuffInfection(int(number))
 			buff := &database.Buff{ID: int(number), CharacterID: s.Character.ID, Name: buffinfo.Name, BagExpansion: false, StartedAt: s.Character.Epoch, Duration: int64(5) * 60}
 			err := buff.Create()
 			if err != nil {
@@ -541,9 +558,12 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			}
 
 			s.Character.Gold += uint64(amount)
+			database.GoldCreated.Add(float64(amount), "gm")
 			h := &GetGoldHandler{}
 
-			go logger.Log(logging.ACTION_CREATE_GOLD, s.Character.ID, fmt.Sprintf("%s isimli oyuncu %d gold oluşturdu", s.Character.Name, amount), s.User.ID, s.Character.Name)
+			e := s.Character.Event(logging.ACTION_CREATE_GOLD, fmt.Sprintf("Created %d gold", amount))
+			e.Gold = amount
+			logging.Emit(e)
 
 			return h.Handle(s)
 		case "upgrade":
@@ -580,7 +600,9 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			}
 
 			item := slots[slotID]
-			go logger.Log(logging.ACTION_UPGRADE_GM_ITEM, s.Character.ID, fmt.Sprintf("%s isimli oyuncu %d id li iteme + bastı", s.Character.Name, item.ID), s.User.ID, s.Character.Name)
+			e := s.Character.Event(logging.ACTION_UPGRADE_GM_ITEM, fmt.Sprintf("Upgraded item (%d) with %d x %d", item.ID, count, code))
+			e.ItemIDs = []int64{item.ItemID}
+			logging.Emit(e)
 			return item.Upgrade(int16(slotID), codes...), nil
 		case "exp":
 			if s.User.UserType < server.HGM_USER {
@@ -684,7 +706,7 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			user.NCash += uint64(amount)
 			user.Update()
 
-			go logger.Log(logging.ACTION_ADD_NCASH, s.Character.ID, fmt.Sprintf("%s isimli oyuncu %s idli oyuncuya %d ncash verdi", s.Character.Name, user.ID, amount), s.User.ID, s.Character.Name)
+			logging.Emit(s.Character.Event(logging.ACTION_ADD_NCASH, fmt.Sprintf("Gave %d ncash to user %s", amount, user.ID)))
 
 			return messaging.InfoMessage(fmt.Sprintf("%d nCash loaded to %s (%s).", amount, user.Username, user.ID)), nil
 		case "exprate":
@@ -698,21 +720,18 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			if len(parts) > 2 {
 				rate := 0.0
 				if am, err := strconv.ParseFloat(parts[1], 64); err == nil {
-					database.EXP_RATE = am
 					rate = am
 				}
 				minute, err := strconv.ParseInt(parts[2], 10, 64)
 				if err != nil {
 					return nil, err
 				}
-				time.AfterFunc(time.Duration(minute)*time.Minute, func() {
-					database.EXP_RATE = database.DEFAULT_EXP_RATE
-				})
+				database.SetRates(rate, 0, minute)
 
-				go logger.Log(logging.ACTION_EXP_RATE, s.Character.ID, fmt.Sprintf("%s isimli oyuncu exp oranını %f çekti", s.Character.Name, rate), s.User.ID, s.Character.Name)
+				logging.Emit(s.Character.Event(logging.ACTION_EXP_RATE, fmt.Sprintf("Set the exp rate to %v for %d minutes", rate, minute)))
 			}
 
-			return messaging.InfoMessage(fmt.Sprintf("EXP Rate now: %f", database.EXP_RATE)), nil
+			return messaging.InfoMessage(fmt.Sprintf("EXP Rate now: %f", database.ExpRate())), nil
 		case "droprate":
 			if s.User.UserType < server.GM_USER {
 				return nil, nil
@@ -724,20 +743,17 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			if len(parts) > 2 {
 				rate := 0.0
 				if s, err := strconv.ParseFloat(parts[1], 64); err == nil {
-					database.DROP_RATE = s
 					rate = s
 				}
 				minute, err := strconv.ParseInt(parts[2], 10, 64)
 				if err != nil {
 					return nil, err
 				}
-				time.AfterFunc(time.Duration(minute)*time.Minute, func() {
-					database.DROP_RATE = database.DEFAULT_DROP_RATE
-				})
+				database.SetRates(0, rate, minute)
 
-				go logger.Log(logging.ACTION_DROP_RATE, s.Character.ID, fmt.Sprintf("%s isimli oyuncu drop oranını %f çekti", s.Character.Name, rate), s.User.ID, s.Character.Name)
+				logging.Emit(s.Character.Event(logging.ACTION_DROP_RATE, fmt.Sprintf("Set the drop rate to %v for %d minutes", rate, minute)))
 			}
-			return messaging.InfoMessage(fmt.Sprintf("Drop Rate now: %f", database.DROP_RATE)), nil
+			return messaging.InfoMessage(fmt.Sprintf("Drop Rate now: %f", database.DropRate())), nil
 		case "mob":
 			if s.User.UserType < server.HGM_USER {
 				return nil, nil
@@ -766,7 +782,7 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			maxLoc := database.ConvertPointToLocation(npcPos.MaxLocation)
 			loc := utils.Location{X: utils.RandFloat(minLoc.X, maxLoc.X), Y: utils.RandFloat(minLoc.Y, maxLoc.Y)}
 
-			ai.Coordinate = loc.String()
+			ai.SetCoordinate(&loc)
 			ai.Handler = ai.AIHandler
 			go ai.Handler()
 
@@ -811,12 +827,12 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 					return nil, nil
 				}
 
-				tmpRelicInfo := database.Items[itemID]
+				tmpRelicInfo := database.FindItem(itemID)
 				if tmpRelicInfo == nil {
 					return nil, nil
 				}
 
-				itemData, _, _ := ch.AddItem(&database.InventorySlot{ItemID: itemID, Quantity: 1}, slot, true)
+				itemData, _, _ := ch.GrantItem(&database.InventorySlot{ItemID: itemID, Quantity: 1}, slot, true, s.Character.Name)
 				if itemData != nil {
 					ch.Socket.Write(*itemData)
 
@@ -1128,19 +1144,17 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			if len(parts) < 3 {
 				return nil, nil
 			}
-			time, _ := strconv.ParseInt(parts[1], 10, 32)
-			divineWar, _ := strconv.ParseBool(parts[2])
-			database.DivineWar = divineWar
-			database.CanJoinWar = true
-			database.ShaoPoints = 10000
-			database.OrderPoints = 10000
-			database.StartWarTimer(int(time))
+			countdown, _ := strconv.ParseInt(parts[1], 10, 32)
+			divine, _ := strconv.ParseBool(parts[2])
+			if _, err := database.StartBattleground(database.BATTLEGROUND_WAR, database.BattlegroundOptions{Countdown: int(countdown), Divine: divine}); err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		case "factionwar":
 			if s.User.UserType < server.GM_USER {
 				return nil, nil
 			}
 
-			if len(parts) < 2 {
+			if len(parts) < 3 {
 				return nil, nil
 			}
 
@@ -1154,7 +1168,9 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 				return nil, err
 			}
 
-			database.PrepareFactionWar(minLevel, maxLevel)
+			if _, err := database.StartBattleground(database.BATTLEGROUND_FACTION_WAR, database.BattlegroundOptions{MinLevel: int(minLevel), MaxLevel: int(maxLevel)}); err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		case "spawnmob":
 			if s.User.UserType < server.GA_USER {
 				return nil, nil
@@ -1180,7 +1196,7 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			maxX := randomLocX + 50
 			maxY := randomLocY + 50
 			npcPos.MaxLocation = fmt.Sprintf("%.1f,%.1f", maxX, maxY)
-			newai.Coordinate = loc.String()
+			newai.SetCoordinate(&loc)
 			newai.Handler = newai.AIHandler
 
 			database.AIsByMap[newai.Server][newai.Map] = append(database.AIsByMap[newai.Server][newai.Map], newai)
@@ -1248,6 +1264,83 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			resp.Concat(messaging.InfoMessage(fmt.Sprint("Min Atk: ", c.Socket.Stats.MinArtsATK)))
 			resp.Concat(messaging.InfoMessage(fmt.Sprint("Max Atk: ", c.Socket.Stats.MaxArtsATK)))
 			resp.Concat(messaging.InfoMessage(fmt.Sprint("SDEF: ", c.Socket.Stats.ArtsDEF)))
+		case "suspicion":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
+
+			list := database.Suspicions()
+			if len(parts) > 1 {
+				c, err := database.FindCharacterByName(parts[1])
+				if err != nil {
+					return nil, err
+				} else if c == nil {
+					return messaging.InfoMessage("Character not found."), nil
+				}
+
+				list = nil
+				if suspicion := database.FindSuspicion(c.ID); suspicion != nil {
+					list = append(list, suspicion)
+				}
+			}
+
+			if len(list) == 0 {
+				return messaging.InfoMessage("No movement violations."), nil
+			}
+			for i, suspicion := range list {
+				if i == 10 {
+					break
+				}
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("%s: score %.1f, %d violations, last %s at %s", suspicion.Name, suspicion.Score,
+					suspicion.Violations, suspicion.Reason, suspicion.LastAt.Format("15:04:05"))))
+			}
+		case "events":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
+
+			events := database.ScheduledEvents()
+			if len(events) == 0 {
+				return messaging.InfoMessage("No scheduled events."), nil
+			}
+			for _, e := range events {
+				state, next := "off", "never"
+				if e.Enabled {
+					state = "on"
+				}
+				if runs := e.NextRuns(time.Now(), 1); len(runs) > 0 {
+					next = runs[0].Format("2006-01-02 15:04 MST")
+				}
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("%d %s (%s, %s): %s, next %s", e.ID, e.Name, e.Kind, e.Cron, state, next)))
+			}
+		case "event":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
+
+			if len(parts) < 3 {
+				return messaging.InfoMessage("Usage: /event <id> on|off|run"), nil
+			}
+			id, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+
+			switch parts[2] {
+			case "on", "off":
+				if err := database.EnableScheduledEvent(id, parts[2] == "on"); err != nil {
+					return messaging.InfoMessage(err.Error()), nil
+				}
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("Event %d is %s.", id, parts[2])))
+			case "run":
+				result, err := database.RunScheduledEvent(id)
+				if err != nil {
+					return messaging.InfoMessage(err.Error()), nil
+				}
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("Event %d: %s.", id, result)))
+			default:
+				return messaging.InfoMessage("Usage: /event <id> on|off|run"), nil
+			}
 		case "dragonbox":
 			if s.User.UserType < server.GM_USER {
 				return nil, nil
@@ -1342,43 +1435,93 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 			if len(parts) < 2 {
 				return nil, nil
 			}
-			time, _ := strconv.ParseInt(parts[1], 10, 32)
-			database.CanJoinLastMan = true
-			database.StartLastManTimer(int(time))
+			countdown, _ := strconv.ParseInt(parts[1], 10, 32)
+			if _, err := database.StartBattleground(database.BATTLEGROUND_LAST_MAN, database.BattlegroundOptions{Countdown: int(countdown)}); err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		case "lastmancount":
 			if s.User.UserType < server.GA_USER {
 				return nil, nil
 			}
 
-			if database.LastmanStarted {
-				database.LastManMutex.Lock()
-				charactersSize := len(database.LastManCharacters)
-				resp.Concat(messaging.InfoMessage(fmt.Sprintf("%d player(s) in Last Man Standing.", charactersSize)))
+			b := database.FindBattleground(database.BATTLEGROUND_LAST_MAN)
+			if b == nil {
+				return messaging.InfoMessage("Event not started yet."), nil
+			}
 
-				for _, c := range database.LastManCharacters {
-					u, _ := database.FindUserByID(c.UserID)
-					if u == nil {
-						continue
-					}
+			members := b.Members(0)
+			resp.Concat(messaging.InfoMessage(fmt.Sprintf("%d player(s) in Last Man Standing.", len(members))))
+			for _, m := range members {
+				resp.Concat(messaging.InfoMessage(m.Name))
+			}
+		case "battlegrounds":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
+
+			list := database.Battlegrounds()
+			if len(list) == 0 {
+				return messaging.InfoMessage("No battlegrounds."), nil
+			}
+			for _, b := range list {
+				info := b.Info()
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("%s: %s, %d seconds left, %d members, scores %v", info.Name, info.Phase, info.Left, len(info.Members), info.Scores)))
+			}
+		case "stopbattleground":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
 
-					resp.Concat(messaging.InfoMessage(fmt.Sprintf("%s", c.Name)))
+			if len(parts) < 2 {
+				return messaging.InfoMessage("Usage: /stopbattleground war|faction_war|last_man|golden_basin|guild_war"), nil
+			}
+			if !database.StopBattleground(parts[1]) {
+				return messaging.InfoMessage(fmt.Sprintf("No %s to stop.", parts[1])), nil
+			}
+		case "dungeons":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
+
+			instances := database.DungeonInstances()
+			if len(instances) == 0 {
+				return messaging.InfoMessage("No dungeon instances."), nil
+			}
+			for _, i := range instances {
+				names := []string{}
+				for _, c := range i.Members() {
+					names = append(names, c.Name)
 				}
+				resp.Concat(messaging.InfoMessage(fmt.Sprintf("%d %s: %d seconds left, %s", i.ID, i.Dungeon.Title, i.Left(), strings.Join(names, ", "))))
+			}
+		case "closedungeon":
+			if s.User.UserType < server.GM_USER {
+				return nil, nil
+			}
 
-				database.LastManMutex.Unlock()
-			} else {
-				resp.Concat(messaging.InfoMessage(fmt.Sprintf("Event not started yet.")))
+			if len(parts) < 2 {
+				return messaging.InfoMessage("Usage: /closedungeon <id>"), nil
+			}
+			id, _ := strconv.Atoi(parts[1])
+			i := database.FindDungeonInstance(id)
+			if i == nil || !i.Close(database.DUNGEON_CLOSED, "The dungeon has been closed.") {
+				return messaging.InfoMessage(fmt.Sprintf("No dungeon instance %d.", id)), nil
 			}
 		case "refresh":
 			if s.User.UserType < server.HGM_USER {
 				return nil, nil
 			}
 			if len(parts) < 2 {
-				return nil, nil
+				return messaging.InfoMessage("Tables: " + strings.Join(database.TableNames(), ", ")), nil
 			}
-			command := parts[1]
-			switch command {
-			case "drops":
-				database.GetAllDrops()
+
+			for _, name := range parts[1:] {
+				diff, err := database.ReloadTable(name)
+				if err != nil {
+					resp.Concat(messaging.InfoMessage(err.Error()))
+					continue
+				}
+				resp.Concat(messaging.InfoMessage(diff.String()))
 			}
 
 		/*case "fixdropandexp":
@@ -1520,11 +1663,12 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 					return nil, err
 				}
 
-				tmpUserConn.Conn.Write(guildData)
+				tmpUserConn.Write(guildData)
 
 				gomap, _ := c.ChangeMap(1, nil)
-				tmpUserConn.Conn.Write(gomap)
-				tmpUserConn.Conn.Write(CHARACTER_MENU)
+				tmpUserConn.Write(gomap)
+				tmpUserConn.Write(CHARACTER_MENU)
+				tmpUserConn.Flush()
 				tmpUserConn.OnClose()
 				resp.Concat(messaging.InfoMessage("Restore Character OK!"))
 			}
@@ -1554,12 +1698,18 @@ func (h *ChatHandler) cmdMessage(s *database.Socket, data []byte) ([]byte, error
 				return nil, nil
 			}
 			tmpActive, _ := strconv.ParseBool(parts[1])
-			database.GuildVarActive = tmpActive
+			if !tmpActive {
+				database.StopBattleground(database.BATTLEGROUND_GUILD_WAR)
+			} else if _, err := database.StartBattleground(database.BATTLEGROUND_GUILD_WAR, database.BattlegroundOptions{}); err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		case "goldenbasin":
 			if s.User.UserType < server.GM_USER {
 				return nil, nil
 			}
-			database.StartGoldenBasinWar()
+			if _, err := database.StartBattleground(database.BATTLEGROUND_GOLDEN_BASIN, database.BattlegroundOptions{}); err != nil {
+				return messaging.InfoMessage(err.Error()), nil
+			}
 		}
 	}
 
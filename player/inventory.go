@@ -5,7 +5,6 @@ import (
 	"log"
 	"math"
 	"sort"
-	"strconv"
 	"time"
 
 	"hero-server/database"
@@ -133,7 +132,7 @@ func (h *ReplaceItemHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 		return nil, err
 	}
 	itemInfo := inventory[where]
-	info := database.Items[itemInfo.ItemID]
+	info := database.FindItem(itemInfo.ItemID)
 	isWeapon := false
 
 	if useItem {
@@ -328,7 +327,7 @@ func (h *ArrangeInventoryHandler) Handle(s *database.Socket, data []byte) ([]byt
 		slot.SlotID = int16(i + 0x0B)
 		r.Insert(utils.IntToBytes(uint64(slot.ItemID), 4, true), 6) // item id
 
-		info := database.Items[slot.ItemID]
+		info := database.FindItem(slot.ItemID)
 		if info != nil && slot.Activated { // using state
 			if info.TimerType == 1 {
 				r[10] = 3
@@ -403,7 +402,7 @@ func (h *ArrangeInventoryHandler) Handle(s *database.Socket, data []byte) ([]byt
 		slot.SlotID = int16(i + 0x0155)
 		r.Insert(utils.IntToBytes(uint64(slot.ItemID), 4, true), 6) // item id
 
-		info := database.Items[slot.ItemID]
+		info := database.FindItem(slot.ItemID)
 		if info != nil && slot.Activated { // using state
 			if info.TimerType == 1 {
 				r[10] = 3
@@ -517,7 +516,7 @@ func (h *ArrangeBankHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 			slot.SlotID = int16(page*60 + i + 0x43)
 			r.Insert(utils.IntToBytes(uint64(slot.ItemID), 4, true), 6) // item id
 
-			info := database.Items[slot.ItemID]
+			info := database.FindItem(slot.ItemID)
 			if info != nil && slot.Activated { // using state
 				if info.TimerType == 1 {
 					r[10] = 3
@@ -610,7 +609,9 @@ func (h *DepositHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 			c.LootGold(-gold)
 			u.BankGold += gold
 
-			go logging.AddLogFile(3, c.Socket.User.ID+" idli kullanici ("+c.Name+") karakterinden ("+strconv.Itoa(int(gold))+") GOLD bankaya yatırdı. (BANK)")
+			e := c.Event(logging.ACTION_BANK_DEPOSIT, fmt.Sprintf("Deposited %d gold, %d in the bank", gold, u.BankGold))
+			e.Gold = -int64(gold)
+			logging.Emit(e)
 
 			go u.Update()
 			return c.GetGold(), nil
@@ -650,7 +651,9 @@ func (h *WithdrawHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 			c.LootGold(gold)
 			u.BankGold -= gold
 
-			go logging.AddLogFile(3, c.Socket.User.ID+" idli kullanici bankadan ("+c.Name+") isimli karaktere ("+strconv.Itoa(int(gold))+") GOLD çekti (BANK)")
+			e := c.Event(logging.ACTION_BANK_WITHDRAW, fmt.Sprintf("Withdrew %d gold, %d in the bank", gold, u.BankGold))
+			e.Gold = int64(gold)
+			logging.Emit(e)
 
 			go u.Update()
 			return c.GetGold(), nil
@@ -700,10 +703,10 @@ func (h *BuyHTItemHandler) Handle(s *database.Socket, data []byte) ([]byte, erro
 	itemID := int(utils.BytesToInt(data[6:10], true))
 	slotID := utils.BytesToInt(data[12:14], true)
 
-	if item, ok := database.HTItems[itemID]; ok && item.IsActive && s.User.NCash >= uint64(item.Cash) {
+	if item := database.FindHTItem(itemID); item != nil && item.IsActive && s.User.NCash >= uint64(item.Cash) {
 		s.User.NCash -= uint64(item.Cash)
 		itemCash := item.Cash
-		info := database.Items[int64(itemID)]
+		info := database.FindItem(int64(itemID))
 		quantity := uint(1)
 		if info.Timer > 0 && info.TimerType > 0 {
 			quantity = uint(info.Timer)
@@ -713,8 +716,8 @@ func (h *BuyHTItemHandler) Handle(s *database.Socket, data []byte) ([]byte, erro
 
 		item := &database.InventorySlot{ItemID: int64(itemID), Quantity: quantity}
 		if info.GetType() == database.PET_TYPE {
-			petInfo := database.Pets[int64(itemID)]
-			petExpInfo := database.PetExps[int16(petInfo.Level)]
+			petInfo := database.FindPet(int64(itemID))
+			petExpInfo := database.FindPetExp(int16(petInfo.Level))
 
 			targetExps := []int{petExpInfo.ReqExpEvo1, petExpInfo.ReqExpEvo2, petExpInfo.ReqExpEvo3, petExpInfo.ReqExpHt}
 			item.Pet = &database.PetSlot{
@@ -743,7 +746,9 @@ func (h *BuyHTItemHandler) Handle(s *database.Socket, data []byte) ([]byte, erro
 		resp.Concat(*r)
 
 		go s.User.Update()
-		go logging.AddLogFile(7, s.User.ID+" idli kullanici ("+s.Character.Name+") isimli karakteriyle HT Shopdan belirtilen itemi satın aldı "+info.Name+" Cash Karşılığı: "+strconv.Itoa(itemCash))
+		e := s.Character.Event(logging.ACTION_BUY_HT_ITEM, fmt.Sprintf("Bought %d %s for %d ncash", quantity, info.Name, itemCash))
+		e.ItemIDs = []int64{int64(itemID)}
+		logging.Emit(e)
 		return resp, nil
 	}
 
@@ -946,7 +951,7 @@ func (h *ActivateTimeLimitedItemHandler) Handle(s *database.Socket, data []byte)
 		return nil, nil
 	}
 
-	info := database.Items[item.ItemID]
+	info := database.FindItem(item.ItemID)
 	if info == nil || info.Timer == 0 {
 		return nil, nil
 	}
@@ -1005,7 +1010,7 @@ func (h *ActivateTimeLimitedItemHandler2) Handle(s *database.Socket, data []byte
 		return nil, nil
 	}
 
-	info := database.Items[item.ItemID]
+	info := database.FindItem(item.ItemID)
 	if info == nil || info.Timer == 0 {
 		return nil, nil
 	}
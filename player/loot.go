@@ -63,7 +63,7 @@ func (h *LootHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
 	r := database.DROP_DISAPPEARED
 	r.Insert(utils.IntToBytes(uint64(dropID), 2, true), 6) //drop id
 
-	p := nats.CastPacket{CastNear: true, DropID: int(dropID), Data: r, Type: nats.DROP_DISAPPEAR}
+	p := nats.CastPacket{CastNear: true, DropID: int(dropID), Data: r, Type: nats.DROP_DISAPPEAR, Origin: s.Character.CastOrigin()}
 	p.Cast()
 
 	resp.Concat(r)
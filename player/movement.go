@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"hero-server/codec"
 	"hero-server/database"
 	"hero-server/nats"
 	"hero-server/utils"
@@ -14,11 +15,8 @@ import (
 type MovementHandler struct {
 }
 
-var (
-	CHARACTER_MOVEMENT = utils.Packet{0xAA, 0x55, 0x22, 0x00, 0x22, 0x01, 0x00, 0x00, 0x00, 0x00, 0xC8, 0xB0, 0xFE, 0xBE, 0x00, 0x00, 0x55, 0xAA}
-)
-
-func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *MovementHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
+	req := msg.(*codec.MovementRequest)
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -41,10 +39,6 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		go c.ActivityStatus(0)
 	}
 
-	if len(data) < 26 {
-		return nil, nil
-	}
-
 	if c.DuelID > 0 {
 		player, _ := database.FindCharacterByID(c.DuelID)
 		if player != nil {
@@ -62,8 +56,12 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		}
 	}
 
+	coordinate := &utils.Location{X: req.From.X, Y: req.From.Y}
+	if back, ok := c.CheckMove(coordinate, &utils.Location{X: req.To.X, Y: req.To.Y}); !ok {
+		return c.Teleport(back), nil
+	}
+
 	// Last man standing
-	coordinate := &utils.Location{X: utils.BytesToFloat(data[6:10], true), Y: utils.BytesToFloat(data[10:14], true)}
 	/*
 		if c.Map == 254 {
 			if coordinate.X > 227 && coordinate.X < 253 && coordinate.Y > 250 && coordinate.Y < 280 {
@@ -75,7 +73,7 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		}
 	*/
 
-	if c.Map == 255 && database.IsFactionWarEntranceActive() {
+	if b := database.MapBattleground(c.Map); b != nil && b.Kind == database.BATTLEGROUND_FACTION_WAR && b.Phase() < database.PHASE_RUNNING {
 		parts := strings.Split(c.Coordinate, ",")
 		y := strings.Trim(parts[1], ")")
 		py := strings.Split(y, ".")
@@ -97,24 +95,21 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		}
 	}
 
-	movType := utils.BytesToInt(data[4:6], false)
 	speed := float64(0.0)
 
-	if movType == 8705 { // movement
+	if req.Opcode == codec.WALK { // movement
 		speed = 5.6
-	} else if movType == 8706 || movType == 9732 { // running or flying
+	} else if req.Opcode == codec.RUN || req.Opcode == codec.FLY { // running or flying
 		speed = c.RunningSpeed + c.AdditionalRunningSpeed
 	}
 
-	resp := CHARACTER_MOVEMENT
-	resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 5) // character pseudo id
-
-	resp[4] = data[4]
-	resp[7] = data[5]            // running mode
-	resp.Insert(data[6:14], 8)   // current coordinate-x & coordinate-y
-	resp.Insert(data[18:26], 20) // target coordinate-x & coordinate-y
-
-	resp.Insert(utils.FloatToBytes(speed, 4, true), 32) // speed
+	resp := codec.Encode(&codec.CharacterMoved{
+		Opcode:   req.Opcode,
+		PseudoID: s.Character.PseudoID,
+		From:     req.From,
+		To:       req.To,
+		Speed:    speed,
+	})
 
 	p := &nats.CastPacket{CastNear: true, CharacterID: s.Character.ID, Data: resp, Type: nats.PLAYER_MOVEMENT}
 	err := p.Cast()
@@ -122,12 +117,12 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 		return nil, err
 	}
 
-	c.SetCoordinate(coordinate)
+	c.MoveCoordinate(coordinate)
 	token := utils.RandInt(0, math.MaxInt64)
 	c.MovementToken = token
 
-	target := &utils.Location{X: utils.BytesToFloat(data[18:22], true), Y: utils.BytesToFloat(data[22:26], true)}
-	if c.IsinWar && !database.WarStarted {
+	target := &utils.Location{X: req.To.X, Y: req.To.Y}
+	if b := c.Battleground(); b != nil && b.Kind == database.BATTLEGROUND_WAR && !b.Running() {
 		if coordinate.X >= 155 && c.Faction == 1 && target.X > 155 || target.Y > 65 && c.Faction == 1 {
 			target.X = 155
 			target.Y = coordinate.Y
@@ -156,7 +151,7 @@ func (h *MovementHandler) Handle(s *database.Socket, data []byte) ([]byte, error
 	delay := distance * 1000 / speed // delay (ms)
 	time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
 		if c.MovementToken == token {
-			c.SetCoordinate(target)
+			c.MoveCoordinate(target)
 		}
 	})
 
@@ -29,7 +29,7 @@ func (h *RespawnHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 
 	switch respawnType {
 	case 1: // Respawn at Safe Zone
-		save := database.SavePoints[byte(s.Character.Map)]
+		save := database.FindSavePoint(byte(s.Character.Map))
 		point := database.ConvertPointToLocation(save.Point)
 		if s.Character.Map == 230 {
 			if s.Character.Faction == 1 {
@@ -112,7 +112,7 @@ func (h *RespawnHandler) Handle(s *database.Socket, data []byte) ([]byte, error)
 				break
 			}
 		}
-		save := database.SavePoints[byte(s.Character.Map)]
+		save := database.FindSavePoint(byte(s.Character.Map))
 		point := database.ConvertPointToLocation(save.Point)
 		if s.Character.Map == 230 {
 			if s.Character.Faction == 1 {
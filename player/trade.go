@@ -2,10 +2,10 @@ package player
 
 import (
 	"fmt"
-	"net"
-	"strconv"
+	"log"
 	"time"
 
+	"hero-server/codec"
 	"hero-server/database"
 	"hero-server/logging"
 	"hero-server/messaging"
@@ -13,7 +13,6 @@ import (
 	"hero-server/utils"
 
 	"github.com/google/uuid"
-	"gopkg.in/guregu/null.v3"
 )
 
 type (
@@ -27,19 +26,11 @@ type (
 )
 
 var (
-	SEND_TRADE_REQUEST     = utils.Packet{0xAA, 0x55, 0x06, 0x00, 0x53, 0x01, 0x0A, 0x00, 0x55, 0xAA}
-	TRADE_REQUEST_ACCEPTED = utils.Packet{0xAA, 0x55, 0x04, 0x00, 0x53, 0x02, 0x0A, 0x00, 0x55, 0xAA}
-	TRADE_ITEM_ADDED       = utils.Packet{0xAA, 0x55, 0x33, 0x00, 0x53, 0x04, 0x0A, 0x00, 0x00, 0x00, 0xA2, 0x00, 0x00, 0x00, 0x00, 0x55, 0xAA}
-	TRADE_GOLD_ADDED       = utils.Packet{0xAA, 0x55, 0x0E, 0x00, 0x53, 0x06, 0x0A, 0x00, 0x55, 0xAA}
-	TRADE_ITEM_REMOVED     = utils.Packet{0xAA, 0x55, 0x07, 0x00, 0x53, 0x08, 0x0A, 0x00, 0x00, 0x55, 0xAA}
-	TRADE_ACCEPTED         = utils.Packet{0xAA, 0x55, 0x07, 0x00, 0x53, 0x09, 0x0A, 0x00, 0x01, 0x55, 0xAA}
-	TRADE_REJECTED         = utils.Packet{0xAA, 0x55, 0x07, 0x00, 0x53, 0x09, 0x0A, 0x00, 0x00, 0x55, 0xAA}
-	TRADE_COMPLETED        = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x53, 0x10, 0x0A, 0x00, 0x00, 0x55, 0xAA}
-
-	logger = logging.Logger
+	TRADE_ITEM_ADDED = utils.Packet{0xAA, 0x55, 0x33, 0x00, 0x53, 0x04, 0x0A, 0x00, 0x00, 0x00, 0xA2, 0x00, 0x00, 0x00, 0x00, 0x55, 0xAA}
+	TRADE_COMPLETED  = utils.Packet{0xAA, 0x55, 0x00, 0x00, 0x53, 0x10, 0x0A, 0x00, 0x00, 0x55, 0xAA}
 )
 
-func (h *SendTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *SendTradeRequestHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -55,8 +46,8 @@ func (h *SendTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]byt
 		return nil, err
 	}
 
-	pseudoID := uint16(utils.BytesToInt(data[6:8], true))
-	receiver := server.FindCharacter(user.ConnectedServer, pseudoID)
+	req := msg.(*codec.TradeRequest)
+	receiver := server.FindCharacter(user.ConnectedServer, req.PseudoID)
 	if receiver == nil {
 		return database.TRADE_CANCELLED, nil
 
@@ -69,13 +60,14 @@ func (h *SendTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]byt
 		return nil, nil
 	}
 
-	resp := SEND_TRADE_REQUEST
-	resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 8) // sender pseudo id
+	resp := codec.Encode(&codec.TradeRequested{PseudoID: s.Character.PseudoID})
 
 	tradeID := uuid.New().String()
 	s.Character.TradeID = tradeID
 
-	go logging.AddLogFile(3, s.User.ID+" user ID ("+s.Character.Name+") character name ("+receiver.Socket.User.ID+") ItemID ("+receiver.Name+") sent trade. Trade ID: ("+tradeID+") (TRADE)")
+	e := s.Character.Event(logging.ACTION_TRADE, fmt.Sprintf("Requested trade %s with %s", tradeID, receiver.Name))
+	e.TargetID = receiver.ID
+	logging.Emit(e)
 
 	//sock.Conn.Write(resp)
 	sock.Write(resp)
@@ -92,7 +84,7 @@ func (h *SendTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]byt
 	return nil, nil
 }
 
-func (h *RespondTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *RespondTradeRequestHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -108,10 +100,8 @@ func (h *RespondTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]
 		return nil, err
 	}
 
-	accepted := data[6] == 1
-	pseudoID := uint16(utils.BytesToInt(data[7:9], true))
-
-	sender := server.FindCharacter(user.ConnectedServer, pseudoID)
+	req := msg.(*codec.TradeResponse)
+	sender := server.FindCharacter(user.ConnectedServer, req.PseudoID)
 	if sender == nil || sender.TradeID == "" {
 		return database.TRADE_CANCELLED, nil
 	}
@@ -127,13 +117,15 @@ func (h *RespondTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]
 	}
 
 	resp, r := utils.Packet{}, utils.Packet{}
-	if accepted && sender.IsOnline {
-		resp = TRADE_REQUEST_ACCEPTED
+	if req.Accepted && sender.IsOnline {
+		resp = codec.Encode(&codec.TradeStarted{})
 
 		trade := database.Trade{}
 		trade.New(sender, s.Character)
 
-		go logging.AddLogFile(3, s.User.ID+" user ID ("+s.Character.Name+") character name, ("+sender.Socket.User.ID+") id ("+sender.Name+") started trade. Trade ID: ("+sender.TradeID+") (TRADE)")
+		e := s.Character.Event(logging.ACTION_TRADE, fmt.Sprintf("Accepted trade %s with %s", sender.TradeID, sender.Name))
+		e.TargetID = sender.ID
+		logging.Emit(e)
 
 		s.Character.TradeID = sender.TradeID
 		r = resp
@@ -149,7 +141,7 @@ func (h *RespondTradeRequestHandler) Handle(s *database.Socket, data []byte) ([]
 	return resp, nil
 }
 
-func (h *CancelTradeHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *CancelTradeHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -160,7 +152,7 @@ func (h *CancelTradeHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 	return nil, nil
 }
 
-func (h *AddTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *AddTradeItemHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -172,18 +164,21 @@ func (h *AddTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, e
 		return nil, nil
 	}
 
-	snd, rcv := trade.Sender.Accepted, trade.Receiver.Accepted
-	trade.Sender.Accepted = false
-	trade.Receiver.Accepted = false
+	snd, rcv, ok := trade.Unaccept()
+	if !ok {
+		return nil, nil
+	}
 
 	slots, err := s.Character.InventorySlots()
 	if err != nil {
 		return nil, nil
 	}
 
-	slotID := int16(utils.BytesToInt(data[6:8], true))
-	//count := utils.BytesToInt(data[8:10], true)
-	tradeSlotID := int16(utils.BytesToInt(data[10:12], true))
+	req := msg.(*codec.AddTradeItemRequest)
+	slotID, tradeSlotID := req.SlotID, req.TradeSlotID
+	if slotID < 0 || int(slotID) >= len(slots) {
+		return nil, nil
+	}
 
 	item := slots[slotID]
 	if item == nil {
@@ -194,7 +189,7 @@ func (h *AddTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, e
 		return nil, nil
 	}
 
-	info := database.Items[item.ItemID]
+	info := database.FindItem(item.ItemID)
 	if info == nil { // 01.12.2023 // BUG FIX
 		return nil, nil
 	}
@@ -202,7 +197,9 @@ func (h *AddTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, e
 		return nil, nil
 	}
 
-	go logging.AddLogFile(3, s.User.ID+" id user ("+s.Character.Name+") added an item. Item : ("+info.Name+")("+strconv.Itoa(int(info.ID))+")  Trade ID: ("+s.Character.TradeID+") (TRADE)")
+	e := s.Character.Event(logging.ACTION_TRADE, fmt.Sprintf("Offered %s (%d) in trade %s", info.Name, item.ID, s.Character.TradeID))
+	e.ItemIDs = []int64{item.ItemID}
+	logging.Emit(e)
 
 	resp := TRADE_ITEM_ADDED
 	resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 8) // character pseudo id
@@ -231,29 +228,27 @@ func (h *AddTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, e
 	}
 
 	if snd {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Sender.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Sender.Character.PseudoID}))
 	}
 	if rcv {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Receiver.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Receiver.Character.PseudoID}))
+	}
+
+	if !trade.Offer(s.Character, tradeSlotID, slotID, item) {
+		return nil, nil
 	}
 
 	isSender := trade.Sender.Character.UserID == s.Character.UserID
 	if isSender {
 		trade.Receiver.Character.Socket.Write(resp)
-		trade.Sender.Slots[tradeSlotID] = slotID
 	} else {
 		trade.Sender.Character.Socket.Write(resp)
-		trade.Receiver.Slots[tradeSlotID] = slotID
 	}
 
 	return resp, nil
 }
 
-func (h *AddTradeGoldHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *AddTradeGoldHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -265,45 +260,40 @@ func (h *AddTradeGoldHandler) Handle(s *database.Socket, data []byte) ([]byte, e
 		return nil, nil
 	}
 
-	snd, rcv := trade.Sender.Accepted, trade.Receiver.Accepted
-	trade.Sender.Accepted = false
-	trade.Receiver.Accepted = false
+	snd, rcv, ok := trade.Unaccept()
+	if !ok {
+		return nil, nil
+	}
 
-	gold := utils.BytesToInt(data[6:14], true)
-	if s.Character.Gold < uint64(gold) || gold < 0 {
+	gold := msg.(*codec.AddTradeGoldRequest).Gold
+	if s.Character.Gold < gold {
 		return nil, nil
 	}
 
-	go logging.AddLogFile(3, s.User.ID+" userID ("+s.Character.Name+")  added gold. Gold : ("+strconv.Itoa(int(gold))+")  Trade ID: ("+s.Character.TradeID+") (TRADE)")
+	logging.Emit(s.Character.Event(logging.ACTION_TRADE, fmt.Sprintf("Offered %d gold in trade %s", gold, s.Character.TradeID)))
 
-	resp := TRADE_GOLD_ADDED
-	resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 8) // character pseudo id
-	resp.Insert(utils.IntToBytes(uint64(gold), 8, true), 10)                // gold
+	resp := codec.Encode(&codec.TradeGoldAdded{PseudoID: s.Character.PseudoID, Gold: gold})
 
 	if snd {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Sender.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Sender.Character.PseudoID}))
 	}
 	if rcv {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Receiver.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Receiver.Character.PseudoID}))
 	}
 
 	isSender := trade.Sender.Character.UserID == s.Character.UserID
 	if isSender {
 		trade.Receiver.Character.Socket.Write(resp)
-		trade.Sender.Gold = uint64(gold)
+		trade.Sender.Gold = gold
 	} else {
 		trade.Sender.Character.Socket.Write(resp)
-		trade.Receiver.Gold = uint64(gold)
+		trade.Receiver.Gold = gold
 	}
 
 	return resp, nil
 }
 
-func (h *RemoveTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *RemoveTradeItemHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -315,40 +305,36 @@ func (h *RemoveTradeItemHandler) Handle(s *database.Socket, data []byte) ([]byte
 		return nil, nil
 	}
 
-	snd, rcv := trade.Sender.Accepted, trade.Receiver.Accepted
-	trade.Sender.Accepted = false
-	trade.Receiver.Accepted = false
-
-	tradeSlotID := int16(utils.BytesToInt(data[10:12], true))
+	snd, rcv, ok := trade.Unaccept()
+	if !ok {
+		return nil, nil
+	}
 
-	resp := TRADE_ITEM_REMOVED
-	resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 8) // character pseudo id
-	resp[10] = byte(tradeSlotID)
+	tradeSlotID := msg.(*codec.RemoveTradeItemRequest).TradeSlotID
+	resp := codec.Encode(&codec.TradeItemRemoved{PseudoID: s.Character.PseudoID, TradeSlotID: tradeSlotID})
 
 	if snd {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Sender.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Sender.Character.PseudoID}))
 	}
 	if rcv {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Receiver.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Receiver.Character.PseudoID}))
+	}
+
+	if !trade.Withdraw(s.Character, tradeSlotID) {
+		return nil, nil
 	}
 
 	isSender := trade.Sender.Character.UserID == s.Character.UserID
 	if isSender {
 		trade.Receiver.Character.Socket.Write(resp)
-		delete(trade.Sender.Slots, tradeSlotID)
 	} else {
 		trade.Sender.Character.Socket.Write(resp)
-		delete(trade.Receiver.Slots, tradeSlotID)
 	}
 
 	return resp, nil
 }
 
-func (h *AcceptTradeHandler) Handle(s *database.Socket, data []byte) ([]byte, error) {
+func (h *AcceptTradeHandler) HandleMessage(s *database.Socket, msg codec.Request) ([]byte, error) {
 
 	if s.User == nil || s.Character == nil {
 		s.Conn.Close()
@@ -360,257 +346,132 @@ func (h *AcceptTradeHandler) Handle(s *database.Socket, data []byte) ([]byte, er
 		return nil, nil
 	}
 
-	if trade.Completing {
+	accepted := msg.(*codec.AcceptTradeRequest).Accepted
+	settle, ok := trade.Accept(s.Character, accepted)
+	if !ok {
 		return nil, nil
 	}
 
-	accepted := data[6] == 1
-
-	var conn net.Conn
+	partner := trade.Sender.Character.Socket
 	isSender := trade.Sender.Character.UserID == s.Character.UserID
 	if isSender {
-		conn = trade.Receiver.Character.Socket.Conn
-		trade.Sender.Accepted = accepted
-		if !accepted && trade.Receiver.Accepted {
-			trade.Receiver.Accepted = false
-		}
-
-	} else {
-		conn = trade.Sender.Character.Socket.Conn
-		trade.Receiver.Accepted = accepted
-		if !accepted && trade.Sender.Accepted {
-			trade.Sender.Accepted = false
-		}
+		partner = trade.Receiver.Character.Socket
 	}
 
 	resp := utils.Packet{}
 	if accepted {
-		resp = TRADE_ACCEPTED
-		resp.Insert(utils.IntToBytes(uint64(s.Character.PseudoID), 2, true), 8) // character pseudo id
+		resp = codec.Encode(&codec.TradeAccepted{PseudoID: s.Character.PseudoID, Accepted: true})
 
 	} else {
-		r := TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Sender.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
-
-		r = TRADE_REJECTED
-		r.Insert(utils.IntToBytes(uint64(trade.Receiver.Character.PseudoID), 2, true), 8) // character pseudo id
-		resp.Concat(r)
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Sender.Character.PseudoID}))
+		resp.Concat(codec.Encode(&codec.TradeAccepted{PseudoID: trade.Receiver.Character.PseudoID}))
 	}
 
-	if conn != nil {
-		conn.Write(resp)
+	if partner != nil {
+		partner.Write(resp)
 	}
 
-	revertCBs := []func(){}
-	rGold, sGold := uint64(0), uint64(0)
-	receiverResp, senderResp := utils.Packet{}, utils.Packet{}
-	if trade.Sender.Accepted && trade.Receiver.Accepted && !trade.Completing {
-
-		trade.Completing = true
-
-		senderSlots, err := trade.Sender.Character.InventorySlots()
-		if err != nil {
-			return nil, nil
-		}
-
-		receiverSlots, err := trade.Receiver.Character.InventorySlots()
-		if err != nil {
-			return nil, nil
-		}
-
-		success := true
-		if success {
-			sGold += trade.Receiver.Gold
-			sGold -= trade.Sender.Gold
-
-			rGold += trade.Sender.Gold
-			rGold -= trade.Receiver.Gold
-		}
-
-		recvItemIDs, senderItemIDs := []int{}, []int{}
-		itemArray := []*database.InventorySlot{}
-		if success {
-			r, r2 := TRADE_COMPLETED, utils.Packet{}
-			r.Insert(utils.IntToBytes(trade.Receiver.Character.Gold+rGold, 8, true), 8) // receiver character gold
-			r[16] = byte(len(trade.Sender.Slots))
-
-			index, length := 17, int16(13)
-			for _, slotID := range trade.Sender.Slots {
-				item := *senderSlots[slotID]
-				senderItemIDs = append(senderItemIDs, item.ID)
-
-				freeSlot, err := trade.Receiver.Character.FindFreeSlot()
-				if err != nil {
-					success = false
-					break
-				}
-
-				//receiverSlots[freeSlot] = &item
-
-				r.Insert(utils.IntToBytes(uint64(item.ItemID), 4, true), index) // item id
-				index += 4
-				r.Insert([]byte{0x00, 0xA2}, index)
-				index += 2
-				r.Insert(utils.IntToBytes(uint64(item.Quantity), 2, true), index) // item quantity
-				index += 2
-				r.Insert(utils.IntToBytes(uint64(freeSlot), 2, true), index) // item quantity
-				index += 2
-				r.Insert(item.GetUpgrades(), index) // item upgrades
-				index += 15
-				r.Insert([]byte{byte(item.SocketCount)}, index) // socket count
-				index++
-				r.Insert(item.GetSockets(), index) // item upgrades
-				index += 15
-				r.Insert([]byte{0x00, 0x00, 0x00}, index)
-				index += 3
-				length += 44
-
-				if item.Pet != nil {
-					r2.Concat(item.GetData(freeSlot))
-				}
-
-				item.UserID = null.StringFrom(trade.Receiver.Character.UserID)
-				item.CharacterID = null.IntFrom(int64(trade.Receiver.Character.ID))
-				item.SlotID = freeSlot
-
-				*receiverSlots[freeSlot] = item
-				*senderSlots[slotID] = *database.NewSlot()
-
-				cb := func() {
-					item.UserID = null.StringFrom(trade.Sender.Character.UserID)
-					item.CharacterID = null.IntFrom(int64(trade.Sender.Character.ID))
-					item.SlotID = slotID
-
-					*receiverSlots[freeSlot] = *database.NewSlot()
-					*senderSlots[slotID] = item
-				}
-
-				revertCBs = append(revertCBs, cb)
-				itemArray = append(itemArray, receiverSlots[freeSlot])
-
-				senderResp.Concat(senderSlots[slotID].GetData(slotID))
-			}
-
-			r.SetLength(length)
-			receiverResp.Concat(r)
-			receiverResp.Concat(r2)
-		}
-
-		if success {
-			r, r2 := TRADE_COMPLETED, utils.Packet{}
-			r.Insert(utils.IntToBytes(trade.Sender.Character.Gold+sGold, 8, true), 8) // sender character gold
-			r[16] = byte(len(trade.Receiver.Slots))
-
-			index, length := 17, int16(13)
-			for _, slotID := range trade.Receiver.Slots {
-				item := *receiverSlots[slotID]
-				recvItemIDs = append(recvItemIDs, item.ID)
-
-				freeSlot, err := trade.Sender.Character.FindFreeSlot()
-				if err != nil {
-					success = false
-					break
-				}
-
-				//senderSlots[freeSlot] = &item
-
-				r.Insert(utils.IntToBytes(uint64(item.ItemID), 4, true), index) // item id
-				index += 4
-				r.Insert([]byte{0x00, 0xA2}, index)
-				index += 2
-				r.Insert(utils.IntToBytes(uint64(item.Quantity), 2, true), index) // item quantity
-				index += 2
-				r.Insert(utils.IntToBytes(uint64(freeSlot), 2, true), index) // item quantity
-				index += 2
-				r.Insert(item.GetUpgrades(), index) // item upgrades
-				index += 15
-				r.Insert([]byte{byte(item.SocketCount)}, index) // socket count
-				index++
-				r.Insert(item.GetSockets(), index) // item upgrades
-				index += 15
-				r.Insert([]byte{0x00, 0x00, 0x00}, index)
-				index += 3
-				length += 44
-
-				if item.Pet != nil {
-					r2.Concat(item.GetData(freeSlot))
-				}
-
-				item.UserID = null.StringFrom(trade.Sender.Character.UserID)
-				item.CharacterID = null.IntFrom(int64(trade.Sender.Character.ID))
-				item.SlotID = freeSlot
-
-				*senderSlots[freeSlot] = item
-				*receiverSlots[slotID] = *database.NewSlot()
-
-				cb := func() {
-					item.UserID = null.StringFrom(trade.Receiver.Character.UserID)
-					item.CharacterID = null.IntFrom(int64(trade.Receiver.Character.ID))
-					item.SlotID = slotID
-
-					*senderSlots[freeSlot] = *database.NewSlot()
-					*receiverSlots[slotID] = item
-				}
-
-				revertCBs = append(revertCBs, cb)
-				itemArray = append(itemArray, senderSlots[freeSlot])
-
-				receiverResp.Concat(receiverSlots[slotID].GetData(slotID))
+	if settle {
+		moves, err := trade.Settle()
+		if err != nil { // trade failed, nothing changed hands
+			log.Printf("Trade between %d and %d failed: %s", trade.Sender.Character.ID, trade.Receiver.Character.ID, err.Error())
+			sender, receiver := trade.Sender.Character, trade.Receiver.Character
+			for _, pair := range [][2]*database.Character{{sender, receiver}, {receiver, sender}} {
+				e := pair[0].Event(logging.ACTION_TRADE, fmt.Sprintf("Trade %s with %s failed: %s", pair[0].TradeID, pair[1].Name, err.Error()))
+				e.TargetID = pair[1].ID
+				logging.Emit(e)
 			}
 
-			r.SetLength(length)
-			senderResp.Concat(r)
-			senderResp.Concat(r2)
-		}
-
-		if !success { // trade failed
-			for _, cb := range revertCBs {
-				cb()
-			}
-
-			resp := database.TRADE_CANCELLED
-			if conn != nil {
-				conn.Write(resp)
-			}
-
-			logger.Log(logging.ACTION_TRADE, trade.Sender.Character.ID, fmt.Sprintf("Trade failed with (%d)", trade.Receiver.Character.ID), trade.Sender.Character.UserID, trade.Receiver.Character.Name)
-			logger.Log(logging.ACTION_TRADE, trade.Receiver.Character.ID, fmt.Sprintf("Trade failed with (%d)", trade.Sender.Character.ID), trade.Receiver.Character.UserID, trade.Sender.Character.Name)
-			return resp, nil
-		}
-
-		for _, i := range itemArray {
-			i.Update()
-			database.InventoryItems.Add(i.ID, i)
+			trade.Cancel()
+			return nil, nil
 		}
 
-		trade.Sender.Character.LootGold(sGold)
-		trade.Receiver.Character.LootGold(rGold)
+		senderResp, senderItemIDs := tradeResult(trade.Sender.Character, moves)
+		receiverResp, recvItemIDs := tradeResult(trade.Receiver.Character, moves)
 
 		if isSender {
 			resp.Concat(senderResp)
-			if conn != nil {
-				conn.Write(receiverResp)
+			if partner != nil {
+				partner.Write(receiverResp)
 			}
 		} else {
 			resp.Concat(receiverResp)
-			if conn != nil {
-				conn.Write(senderResp)
+			if partner != nil {
+				partner.Write(senderResp)
 			}
 		}
 
-		go logging.AddLogFile(3, trade.Sender.Character.Socket.User.ID+" id user ("+trade.Sender.Character.Name+") named character, ("+trade.Receiver.Character.Socket.User.ID+") id ("+trade.Receiver.Character.Name+") successfuly traded. Trade ID: ("+trade.Receiver.Character.TradeID+") (TRADE)")
-
-		logger.Log(logging.ACTION_TRADE, trade.Sender.Character.ID,
-			fmt.Sprintf("Trade success with (%d), Gold: %d, Items: %+v", trade.Receiver.Character.ID, trade.Receiver.Gold, recvItemIDs),
-			trade.Sender.Character.UserID, trade.Sender.Character.Name)
-
-		logger.Log(logging.ACTION_TRADE, trade.Receiver.Character.ID,
-			fmt.Sprintf("Trade success with (%d), Gold: %d, Items: %+v", trade.Sender.Character.ID, trade.Sender.Gold, senderItemIDs),
-			trade.Receiver.Character.UserID, trade.Receiver.Character.Name)
+		tradeEvent(trade.Sender.Character, trade.Receiver.Character, int64(trade.Receiver.Gold)-int64(trade.Sender.Gold), senderItemIDs, moves)
+		tradeEvent(trade.Receiver.Character, trade.Sender.Character, int64(trade.Sender.Gold)-int64(trade.Receiver.Gold), recvItemIDs, moves)
 
 		trade.Delete()
 	}
 
 	return resp, nil
 }
+
+// tradeEvent emits a settled trade of c, given are the rows c gave and gold
+// the change of its gold. The item ids are every item of the trade.
+func tradeEvent(c, partner *database.Character, gold int64, given []int, moves []*database.TradeMove) {
+	e := c.Event(logging.ACTION_TRADE, fmt.Sprintf("Trade %s with %s settled, gave items %v", c.TradeID, partner.Name, given))
+	e.TargetID, e.Gold = partner.ID, gold
+	for _, m := range moves {
+		e.ItemIDs = append(e.ItemIDs, m.Item.ItemID)
+	}
+	logging.Emit(e)
+}
+
+// tradeResult builds the packets c gets for a settled trade: its new gold
+// and the items it received, and the now empty slots of the items it gave.
+// It also returns the ids of the items c gave away.
+func tradeResult(c *database.Character, moves []*database.TradeMove) (utils.Packet, []int) {
+	slots, _ := c.InventorySlots()
+
+	given, received, pets := utils.Packet{}, utils.Packet{}, utils.Packet{}
+	r := TRADE_COMPLETED
+	r.Insert(utils.IntToBytes(c.Gold, 8, true), 8) // character gold
+
+	itemIDs := []int{}
+	index, length, count := 17, int16(13), byte(0)
+	for _, m := range moves {
+		if m.From == c {
+			itemIDs = append(itemIDs, m.Item.ID)
+			given.Concat(slots[m.FromSlot].GetData(m.FromSlot))
+			continue
+		} else if m.To != c {
+			continue
+		}
+
+		item := m.Item
+		r.Insert(utils.IntToBytes(uint64(item.ItemID), 4, true), index) // item id
+		index += 4
+		r.Insert([]byte{0x00, 0xA2}, index)
+		index += 2
+		r.Insert(utils.IntToBytes(uint64(item.Quantity), 2, true), index) // item quantity
+		index += 2
+		r.Insert(utils.IntToBytes(uint64(m.ToSlot), 2, true), index) // slot id
+		index += 2
+		r.Insert(item.GetUpgrades(), index) // item upgrades
+		index += 15
+		r.Insert([]byte{byte(item.SocketCount)}, index) // socket count
+		index++
+		r.Insert(item.GetSockets(), index) // item sockets
+		index += 15
+		r.Insert([]byte{0x00, 0x00, 0x00}, index)
+		index += 3
+		length += 44
+		count++
+
+		if item.Pet != nil {
+			pets.Concat(item.GetData(m.ToSlot))
+		}
+	}
+
+	r[16] = count
+	r.SetLength(length)
+	received.Concat(r)
+	received.Concat(pets)
+
+	received.Concat(given)
+	return received, itemIDs
+}
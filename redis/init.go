@@ -1,9 +1,12 @@
 package redis
 
 import (
+	"crypto/tls"
 	"fmt"
 	"time"
 
+	"hero-server/config"
+
 	"github.com/go-redis/redis"
 )
 
@@ -14,30 +17,25 @@ var (
 
 func InitRedis() error {
 
-	/*
-		redisHost := os.Getenv("REDIS_HOST")
-		if redisHost == "" {
-			return nil
-		}
-
-		redisPort := os.Getenv("REDIS_PORT")
-		if redisPort == "" {
-			log.Fatal("REDIS_PORT env variable is empty")
-		}
-
-		redisPassword := os.Getenv("REDIS_PASSWORD")
+	cfg := config.Default.Redis
+	if cfg.Host == "" {
+		return nil
+	}
 
-		redisScheme := os.Getenv("REDIS_SCHEME")
-		if redisScheme == "" {
-			redisScheme = "rediss"
-		}
-	*/
 	var err error
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+
+	// rediss connects over tls
+	var tlsConfig *tls.Config
+	if cfg.Scheme == "rediss" {
+		tlsConfig = &tls.Config{ServerName: cfg.Host}
+	}
 
 	client = redis.NewClient(&redis.Options{
-		Addr:     "127.0.0.1:6379",
-		Password: "111111",
-		DB:       0,
+		Addr:      addr,
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: tlsConfig,
 	})
 	_, err = client.Ping().Result()
 	if err != nil {
@@ -45,9 +43,10 @@ func InitRedis() error {
 	}
 
 	Client2 = redis.NewClient(&redis.Options{
-		Addr:     "127.0.0.1:6379",
-		Password: "111111",
-		DB:       2,
+		Addr:      addr,
+		Password:  cfg.Password,
+		DB:        cfg.DB + 2,
+		TLSConfig: tlsConfig,
 	})
 	_, err = Client2.Ping().Result()
 	if err != nil {
@@ -60,3 +59,19 @@ func InitRedis() error {
 func Set(key string, value interface{}) error {
 	return client.Set(key, value, time.Duration(0)).Err()
 }
+
+// XAdd appends the entries to stream in one round trip, trimming the stream
+// to about maxLen entries. A maxLen of 0 keeps every entry.
+func XAdd(stream string, maxLen int64, entries ...map[string]interface{}) error {
+	if client == nil {
+		return fmt.Errorf("XAdd: redis is not configured")
+	}
+
+	pipe := client.Pipeline()
+	for _, values := range entries {
+		pipe.XAdd(&redis.XAddArgs{Stream: stream, MaxLenApprox: maxLen, Values: values})
+	}
+
+	_, err := pipe.Exec()
+	return err
+}
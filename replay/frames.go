@@ -0,0 +1,99 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Frame is a recorded client packet and the session which sent it.
+type Frame struct {
+	Session string
+	Data    []byte
+}
+
+// LoadFrames reads a recording. Every line holds the session name followed
+// by the frame in hex, blanks between the bytes are allowed and lines
+// starting with # are comments.
+func LoadFrames(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFrames: %s", err.Error())
+	}
+	defer file.Close()
+
+	var (
+		frames []Frame
+		line   int
+	)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("LoadFrames: %s:%d: %s", path, line, err.Error())
+		}
+
+		frames = append(frames, Frame{Session: fields[0], Data: data})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("LoadFrames: %s", err.Error())
+	}
+	return frames, nil
+}
+
+// Replay sends the frames one by one and returns a transcript of the traffic:
+//
+//	> name  frame sent by the client
+//	< name  bytes returned by the handler
+//	~ name  bytes written to the socket of a session while handling the frame
+//	! name  error returned by the handler
+//	x name  the server closed the connection
+func Replay(frames []Frame, sessions map[string]*Session) (string, error) {
+	var names []string
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, frame := range frames {
+		s, ok := sessions[frame.Session]
+		if !ok {
+			return "", fmt.Errorf("Replay: unknown session %s", frame.Session)
+		}
+
+		fmt.Fprintf(&b, "> %s %x\n", frame.Session, frame.Data)
+		resp, err := s.Send(frame.Data)
+		if err != nil {
+			fmt.Fprintf(&b, "! %s %s\n", frame.Session, err.Error())
+		} else if len(resp) > 0 {
+			fmt.Fprintf(&b, "< %s %x\n", frame.Session, resp)
+		}
+
+		for _, name := range names {
+			session := sessions[name]
+			if out := session.Written(); len(out) > 0 {
+				fmt.Fprintf(&b, "~ %s %x\n", name, out)
+			}
+			if session.Closed() && !session.reported {
+				session.reported = true
+				fmt.Fprintf(&b, "x %s\n", name)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
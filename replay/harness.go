@@ -0,0 +1,301 @@
+// Package replay runs recorded client frames through the packet dispatch
+// table without a game client or a live database. Each test gets a fresh
+// Store (or the postgres database in TEST_POSTGRES_DSN) and sessions which
+// wrap a database.Socket over net.Pipe.
+package replay
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"hero-server/database"
+	_ "hero-server/factory"
+	heronats "hero-server/nats"
+	"hero-server/server"
+	"hero-server/utils"
+
+	gnatsd "github.com/nats-io/gnatsd/server"
+)
+
+// POSTGRES_DSN_ENV selects a real (disposable) postgres database instead of
+// the in-memory store. The schema must already exist.
+const POSTGRES_DSN_ENV = "TEST_POSTGRES_DSN"
+
+var (
+	natsOnce sync.Once
+	natsErr  error
+)
+
+type Harness struct {
+	Store *Store // nil when running against postgres
+
+	tb       testing.TB
+	sessions []*Session
+	items    []int64
+}
+
+// New prepares the database package for a test. The embedded NATS server is
+// shared by every test of the process.
+func New(tb testing.TB) *Harness {
+	tb.Helper()
+
+	natsOnce.Do(func() {
+		natsErr = startNats()
+	})
+	if natsErr != nil {
+		tb.Fatalf("replay: nats: %v", natsErr)
+	}
+
+	h := &Harness{tb: tb}
+	if dsn := os.Getenv(POSTGRES_DSN_ENV); dsn != "" {
+		conn, err := sql.Open("postgres", dsn)
+		if err != nil {
+			tb.Fatalf("replay: postgres: %v", err)
+		}
+		database.UseConnection(conn)
+	} else {
+		store, conn, err := NewStore()
+		if err != nil {
+			tb.Fatalf("replay: %v", err)
+		}
+		h.Store = store
+		database.UseConnection(conn)
+	}
+
+	tb.Cleanup(h.close)
+	return h
+}
+
+func startNats() error {
+	opts := heronats.DefaultOptions
+	opts.Port = gnatsd.RANDOM_PORT
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	s := heronats.RunServer(&opts)
+	addr, ok := s.Addr().(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("unexpected listener address %v", s.Addr())
+	}
+
+	opts.Port = addr.Port
+	_, err := heronats.ConnectSelf(&opts)
+	return err
+}
+
+// NewSession opens a connection from the given client address.
+func (h *Harness) NewSession(addr string) *Session {
+	conn, client := net.Pipe()
+	s := &Session{
+		Socket: &database.Socket{Conn: conn, ClientAddr: addr},
+		client: client,
+		done:   make(chan struct{}),
+	}
+
+	go s.read()
+	h.sessions = append(h.sessions, s)
+	return s
+}
+
+// Login attaches the user to the session as if the login and server
+// selection went through.
+func (h *Harness) Login(s *Session, user *database.User) {
+	if user.ConnectedServer == 0 {
+		user.ConnectedServer = 1
+	}
+	user.ConnectedIP = s.Socket.ClientAddr
+
+	database.AddUserToCache(user)
+	s.Socket.User = user
+	s.Socket.Add(user.ID)
+}
+
+// AddCharacter stores c for the logged in user of the session and puts it in
+// game on map 1 (unless c says otherwise) with full HP and CHI.
+func (h *Harness) AddCharacter(s *Session, c *database.Character, at *utils.Location) *database.Character {
+	h.tb.Helper()
+
+	if s.Socket.User == nil {
+		h.tb.Fatalf("replay: AddCharacter %s without a logged in user", c.Name)
+	}
+
+	c.UserID = s.Socket.User.ID
+	if c.Map == 0 {
+		c.Map = 1
+	}
+	if c.Level == 0 {
+		c.Level = 1
+	}
+	if c.RunningSpeed == 0 {
+		c.RunningSpeed = 5.6
+	}
+	if c.Slotbar == nil {
+		c.Slotbar = []byte{}
+	}
+	c.GuildID = -1
+	c.IsOnline = true
+	c.IsActive = true
+	c.Socket = s.Socket
+
+	if err := c.Create(); err != nil {
+		h.tb.Fatalf("replay: create %s: %v", c.Name, err)
+	}
+	database.AddCharacterToCache(c)
+
+	stat := &database.Stat{ID: c.ID, HP: 1000, MaxHP: 1000, CHI: 1000, MaxCHI: 1000, Honor: 10000}
+	database.AddStatToCache(stat)
+	skills := &database.Skills{ID: c.ID}
+	database.AddSkillsToCache(skills)
+
+	s.Socket.Character = c
+	s.Socket.Stats = stat
+	s.Socket.Skills = skills
+	s.Socket.CharacterSelected = true
+
+	if err := database.GenerateID(c); err != nil {
+		h.tb.Fatalf("replay: pseudo id for %s: %v", c.Name, err)
+	}
+	c.SetCoordinate(at)
+	return c
+}
+
+// DefineItem registers item information for the duration of the test.
+func (h *Harness) DefineItem(info *database.Item) {
+	database.SetItem(info)
+	h.items = append(h.items, info.ID)
+}
+
+// GiveItem puts an item into the given inventory slot of c.
+func (h *Harness) GiveItem(c *database.Character, slotID int16, item *database.InventorySlot) *database.InventorySlot {
+	h.tb.Helper()
+
+	if _, _, err := c.AddItem(item, slotID, false); err != nil {
+		h.tb.Fatalf("replay: give item %d to %s: %v", item.ItemID, c.Name, err)
+	}
+
+	slots, err := c.InventorySlots()
+	if err != nil {
+		h.tb.Fatalf("replay: inventory of %s: %v", c.Name, err)
+	}
+	return slots[slotID]
+}
+
+func (h *Harness) close() {
+	for _, s := range h.sessions {
+		s.close()
+	}
+	for _, id := range h.items {
+		database.DeleteItem(id)
+	}
+}
+
+// Session is one client connection. Send feeds a frame through the dispatch
+// table; everything the server pushes to the socket outside of the handler's
+// return value (broadcasts, messages to a trade partner...) is collected and
+// can be read with Written.
+type Session struct {
+	Socket *database.Socket
+
+	client net.Conn
+	mutex  sync.Mutex
+	out    []byte
+	closed bool
+	done   chan struct{}
+
+	reported bool // the transcript already shows the close
+}
+
+// Send runs a single frame through database.Handler, exactly like
+// Socket.Read does for a frame coming from the network.
+func (s *Session) Send(frame []byte) ([]byte, error) {
+	if len(frame) < 6 {
+		return nil, fmt.Errorf("Send: frame too short (%d bytes)", len(frame))
+	}
+
+	opcode := uint16(utils.BytesToInt(frame[4:6], false))
+	return database.Handler(s.Socket, frame, opcode)
+}
+
+// Written returns and clears the bytes written to the socket so far.
+func (s *Session) Written() []byte {
+	s.sync()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	out := s.out
+	s.out = nil
+	return out
+}
+
+// Closed reports whether the server closed the connection.
+func (s *Session) Closed() bool {
+	s.sync()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// sync waits until the socket's write queue is empty and the reader
+// goroutine collected every finished write: net.Pipe hands a write over only
+// after the previous read was consumed, so an empty write works as a barrier.
+func (s *Session) sync() {
+	s.Socket.Flush()
+
+	s.Socket.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err := s.Socket.Conn.Write(nil)
+	s.Socket.Conn.SetWriteDeadline(time.Time{})
+
+	if err == io.ErrClosedPipe { // closed by the server, the reader stops at EOF
+		<-s.done
+	}
+}
+
+func (s *Session) read() {
+	defer close(s.done)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.client.Read(buf)
+		s.mutex.Lock()
+		s.out = append(s.out, buf[:n]...)
+		if err != nil {
+			s.closed = true
+		}
+		s.mutex.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Session) close() {
+	// writes still queued would fail after the close and log the user out of
+	// the next test
+	s.Socket.Flush()
+
+	if c := s.Socket.Character; c != nil {
+		if trade := database.FindTrade(c); trade != nil {
+			trade.Delete()
+		}
+		server.Unregister(c.PseudoID)
+		database.CharacterGrid.Remove(c.ID)
+		database.DeleteCharacterFromCache(c.ID)
+		database.DeleteStatFromCache(c.ID)
+	}
+	if u := s.Socket.User; u != nil {
+		s.Socket.Remove(u.ID)
+		database.DeleteUserFromCache(u.ID)
+	}
+
+	s.Socket.Conn.Close()
+	s.client.Close()
+	<-s.done
+}
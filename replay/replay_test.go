@@ -0,0 +1,675 @@
+package replay
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hero-server/auth"
+	"hero-server/codec"
+	"hero-server/config"
+	"hero-server/database"
+	"hero-server/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the replay tests")
+
+const passwordHash = "5E884898DA28047151D0E56F8DC6292773603D0D6AABBDD62A11EF721D1542D8"
+
+var (
+	sword = &database.Item{ID: 1001, Name: "Training Sword", Type: 70, BuyPrice: 1000, SellPrice: 100, Tradable: 1}
+	stone = &database.Item{ID: 200, Name: "Strengthening Stone", Type: 194, BuyPrice: 10}
+)
+
+// replay runs testdata/<name>.frames and compares the transcript with
+// testdata/<name>.golden, go test ./replay -update rewrites the golden file.
+func replay(t *testing.T, name string, sessions map[string]*Session) {
+	t.Helper()
+
+	frames, err := LoadFrames(filepath.Join("testdata", name+".frames"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Replay(frames, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test ./replay -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: transcript differs from %s\ngot:\n%s\nwant:\n%s", name, golden, got, want)
+	}
+}
+
+func newUser(id, name string) *database.User {
+	return &database.User{ID: id, Username: name, Password: passwordHash, UserType: 1}
+}
+
+func TestLogin(t *testing.T) {
+	h := New(t)
+	alice, bob := h.NewSession("10.0.0.1:50001"), h.NewSession("10.0.0.2:50002")
+
+	database.AddUserToCache(newUser("1", "alice"))
+	database.AddUserToCache(newUser("2", "bob"))
+
+	replay(t, "login", map[string]*Session{"alice": alice, "bob": bob})
+
+	if u := alice.Socket.User; u == nil || u.ID != "1" || u.ConnectedIP != "10.0.0.1:50001" {
+		t.Errorf("alice is not logged in: %+v", u)
+	}
+	if bob.Socket.User != nil || !bob.Closed() {
+		t.Errorf("bob logged in with a wrong password")
+	}
+	if u := alice.Socket.User; u != nil && !database.IsHashedPassword(u.Password) {
+		t.Errorf("password of alice was not rehashed: %s", u.Password)
+	}
+}
+
+func loginFrame(username, password string) []byte {
+	w := codec.NewWriter()
+	w.Opcode(codec.LOGIN)
+	w.U8(0)
+	w.String8(username)
+	w.String8(password)
+	return w.Frame()
+}
+
+func TestLoginRejectsMasterPassword(t *testing.T) {
+	h := New(t)
+	s := h.NewSession("10.0.1.1:50001")
+
+	resp, _ := s.Send(loginFrame("nobody", "E29095B49C4CCF7A449EA5593E63B18418EE22C8F67D1693873EF2C2C41CF179"))
+	if s.Socket.User != nil || !bytes.Equal(resp, auth.USER_NOT_FOUND) {
+		t.Fatalf("unknown user logged in with the old master password: % X", resp)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	h := New(t)
+	user := newUser("3", "carol")
+	user.SetPassword(passwordHash)
+	database.AddUserToCache(user)
+
+	wrong := strings.Repeat("0", codec.PASSWORD_HASH_SIZE)
+	for i := 0; i < config.Default.Auth.MaxLoginFailures; i++ {
+		s := h.NewSession("10.0.2.1:50001")
+		if resp, _ := s.Send(loginFrame("carol", wrong)); !bytes.Equal(resp, auth.USER_NOT_FOUND) {
+			t.Fatalf("attempt %d: % X", i+1, resp)
+		}
+	}
+
+	s := h.NewSession("10.0.2.2:50001") // another ip, the user name is locked
+	if resp, _ := s.Send(loginFrame("carol", passwordHash)); !bytes.Equal(resp, auth.TOO_MANY_ATTEMPTS) || s.Socket.User != nil {
+		t.Fatalf("login after too many failures: % X", resp)
+	}
+}
+
+func TestCharacterCreation(t *testing.T) {
+	h := New(t)
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+
+	for _, id := range []int64{17200576, 17500335, 100031120, 100031121} {
+		h.DefineItem(&database.Item{ID: id, Name: "Starter item", Type: 70})
+	}
+
+	savePoint := database.SavePoints[1]
+	database.SavePoints[1] = &database.SavePoint{ID: 1, Point: "(100.0,100.0)"}
+	defer func() {
+		if savePoint == nil {
+			delete(database.SavePoints, 1)
+		} else {
+			database.SavePoints[1] = savePoint
+		}
+	}()
+
+	replay(t, "character_creation", map[string]*Session{"alice": alice})
+
+	chars := h.Store.Rows("hops.characters")
+	if len(chars) != 1 || chars[0]["name"] != "Tester" || chars[0]["user_id"] != "1" {
+		t.Fatalf("characters after creation: %v", chars)
+	}
+	if items := h.Store.Rows("hops.items_characters"); len(items) != 4 {
+		t.Errorf("expected 4 starter items, got %d", len(items))
+	}
+	if stats := h.Store.Rows("hops.stats"); len(stats) != 1 {
+		t.Errorf("expected the stats of the new character, got %v", stats)
+	}
+}
+
+func TestMovement(t *testing.T) {
+	h := New(t)
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+	c := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, RunningSpeed: 8}, &utils.Location{X: 100, Y: 100})
+
+	replay(t, "movement", map[string]*Session{"alice": alice})
+
+	if c.Coordinate != "(110.0,100.0)" {
+		t.Errorf("coordinate after moving: %s", c.Coordinate)
+	}
+	if ids := database.CharacterGrid.Query(1, 1, &utils.Location{X: 110, Y: 100}, 1); len(ids) != 1 || ids[0] != c.ID {
+		t.Errorf("character not indexed at its new position: %v", ids)
+	}
+	if chi := alice.Socket.Stats.CHI; chi != 996 {
+		t.Errorf("running at speed 8 should cost 4 CHI, have %d", chi)
+	}
+}
+
+func moveFrame(from, to utils.Location) []byte {
+	w := codec.NewWriter()
+	w.Opcode(codec.RUN)
+	w.Location(from)
+	w.Zero(4)
+	w.Location(to)
+	return w.Frame()
+}
+
+func TestMovementChecks(t *testing.T) {
+	h := New(t)
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+	c := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, RunningSpeed: 8}, &utils.Location{X: 100, Y: 100})
+
+	before := database.FindSuspicion(c.ID)
+	if before == nil {
+		before = &database.Suspicion{}
+	}
+	bounds, kick := database.MapBounds, config.Default.Movement.KickScore
+	database.MapBounds = map[int16]*database.MapBound{1: {MapID: 1, MaxX: 500, MaxY: 500}}
+	config.Default.Movement.KickScore = before.Score + 39
+	t.Cleanup(func() { database.MapBounds, config.Default.Movement.KickScore = bounds, kick })
+
+	alice.Send(moveFrame(utils.Location{X: 100, Y: 100}, utils.Location{X: 110, Y: 100}))
+	resp, _ := alice.Send(moveFrame(utils.Location{X: 300, Y: 100}, utils.Location{X: 310, Y: 100}))
+	if !bytes.Equal(resp, c.Teleport(&utils.Location{X: 100, Y: 100})) || c.Coordinate != "(100.0,100.0)" {
+		t.Fatalf("teleport hack was not put back: % X at %s", resp, c.Coordinate)
+	}
+	if s := database.FindSuspicion(c.ID); s == nil || s.Reason != database.VIOLATION_TELEPORT || s.Violations != before.Violations+1 {
+		t.Fatalf("teleport suspicion: %+v", s)
+	}
+
+	alice.Send(moveFrame(utils.Location{X: 100, Y: 100}, utils.Location{X: 600, Y: 100}))
+	if s := database.FindSuspicion(c.ID); s == nil || s.Reason != database.VIOLATION_BOUNDS || s.Violations != before.Violations+2 {
+		t.Fatalf("bounds suspicion: %+v", s)
+	}
+	if !alice.Closed() {
+		t.Error("alice was not kicked at the kick score")
+	}
+}
+
+func TestTrade(t *testing.T) {
+	h := New(t)
+	h.DefineItem(sword)
+
+	alice, bob := h.NewSession("10.0.0.1:50001"), h.NewSession("10.0.0.2:50002")
+	h.Login(alice, newUser("1", "alice"))
+	h.Login(bob, newUser("2", "bob"))
+
+	a := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1}, &utils.Location{X: 100, Y: 100})
+	b := h.AddCharacter(bob, &database.Character{Name: "Bob", Type: 54, Faction: 1, Gold: 10000}, &utils.Location{X: 102, Y: 100})
+	h.GiveItem(a, 11, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+
+	replay(t, "trade", map[string]*Session{"alice": alice, "bob": bob})
+
+	aSlots, _ := a.InventorySlots()
+	bSlots, _ := b.InventorySlots()
+	if aSlots[11].ItemID != 0 || bSlots[11].ItemID != sword.ID {
+		t.Errorf("sword did not change hands: alice has %d, bob has %d", aSlots[11].ItemID, bSlots[11].ItemID)
+	}
+	if a.Gold != 5000 || b.Gold != 5000 {
+		t.Errorf("gold after trade: alice %d, bob %d", a.Gold, b.Gold)
+	}
+	if database.FindTrade(a) != nil || a.TradeID != "" || b.TradeID != "" {
+		t.Errorf("trade still open after completion")
+	}
+
+	if h.Store != nil {
+		for _, row := range h.Store.Rows("hops.characters") {
+			if row["gold"] != int64(5000) {
+				t.Errorf("gold of %s in the database: %v", row["name"], row["gold"])
+			}
+		}
+	}
+}
+
+// A trade whose items changed in the database is rolled back as a whole:
+// the first sword moved inside the transaction must not stay with bob.
+func TestTradeConflict(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+	h.DefineItem(sword)
+
+	alice, bob := h.NewSession("10.0.0.1:50001"), h.NewSession("10.0.0.2:50002")
+	h.Login(alice, newUser("1", "alice"))
+	h.Login(bob, newUser("2", "bob"))
+
+	a := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1}, &utils.Location{X: 100, Y: 100})
+	b := h.AddCharacter(bob, &database.Character{Name: "Bob", Type: 54, Faction: 1, Gold: 10000}, &utils.Location{X: 102, Y: 100})
+	h.GiveItem(a, 11, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+	second := h.GiveItem(a, 12, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+
+	if h.Store.Exec(`update hops.items_characters set version = 7 where id = $1`, int64(second.ID)) != 1 {
+		t.Fatal("could not change the version of the second sword")
+	}
+
+	replay(t, "trade_conflict", map[string]*Session{"alice": alice, "bob": bob})
+
+	if h.Store.Count("rollback") != 1 {
+		t.Errorf("the trade transaction was not rolled back")
+	}
+
+	aSlots, _ := a.InventorySlots()
+	bSlots, _ := b.InventorySlots()
+	if aSlots[11].ItemID != sword.ID || aSlots[12].ItemID != sword.ID || bSlots[11].ItemID != 0 {
+		t.Errorf("items changed hands: alice has %d and %d, bob has %d", aSlots[11].ItemID, aSlots[12].ItemID, bSlots[11].ItemID)
+	}
+	if a.Gold != 0 || b.Gold != 10000 {
+		t.Errorf("gold after failed trade: alice %d, bob %d", a.Gold, b.Gold)
+	}
+	if database.FindTrade(a) != nil || a.TradeID != "" || b.TradeID != "" {
+		t.Errorf("trade still open after failing")
+	}
+
+	for _, row := range h.Store.Rows("hops.items_characters") {
+		if row["character_id"] != int64(a.ID) {
+			t.Errorf("item %v belongs to %v in the database", row["id"], row["character_id"])
+		}
+	}
+	for _, row := range h.Store.Rows("hops.characters") {
+		if want := map[string]int64{"Alice": 0, "Bob": 10000}[row["name"].(string)]; row["gold"] != want {
+			t.Errorf("gold of %s in the database: %v", row["name"], row["gold"])
+		}
+	}
+}
+
+// Two buyers racing for the same consignment item: one gets it, the other
+// keeps its gold, and the seller is paid out of the escrow once.
+func TestConsignmentDoubleSpend(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+	h.DefineItem(sword)
+
+	alice, bob, carol := h.NewSession("10.0.0.1:50001"), h.NewSession("10.0.0.2:50002"), h.NewSession("10.0.0.3:50003")
+	h.Login(alice, newUser("1", "alice"))
+	h.Login(bob, newUser("2", "bob"))
+	h.Login(carol, newUser("3", "carol"))
+
+	a := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, Gold: 1000}, &utils.Location{X: 100, Y: 100})
+	b := h.AddCharacter(bob, &database.Character{Name: "Bob", Type: 54, Faction: 1, Gold: 10000}, &utils.Location{X: 102, Y: 100})
+	c := h.AddCharacter(carol, &database.Character{Name: "Carol", Type: 53, Faction: 1, Gold: 10000}, &utils.Location{X: 104, Y: 100})
+	item := h.GiveItem(a, 11, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+	id := item.ID
+
+	listed := &database.ConsignmentItem{ID: id, SellerID: a.ID, ItemName: sword.Name, Quantity: 1, Price: 5000}
+	if err := listed.Create(); err != nil {
+		t.Fatal(err)
+	}
+	item.SlotID = -1
+	item.Consignment = true
+	if err := item.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	bought := make([]bool, 2)
+	for i, buyer := range []*database.Character{b, c} {
+		wg.Add(1)
+		go func(i int, buyer *database.Character) {
+			defer wg.Done()
+			resp, err := buyer.BuyConsignmentItem(id)
+			if err != nil {
+				t.Errorf("%s: %v", buyer.Name, err)
+			}
+			bought[i] = resp != nil
+		}(i, buyer)
+	}
+	wg.Wait()
+
+	if bought[0] == bought[1] {
+		t.Fatalf("bob bought %v, carol bought %v", bought[0], bought[1])
+	}
+	if b.Gold+c.Gold != 15000 {
+		t.Errorf("gold after purchase: bob %d, carol %d", b.Gold, c.Gold)
+	}
+
+	owner := b
+	if bought[1] {
+		owner = c
+	}
+	for _, row := range h.Store.Rows("hops.items_characters") {
+		if row["id"] == int64(id) && (row["character_id"] != int64(owner.ID) || row["consignment"] != false) {
+			t.Errorf("item in the database: %v", row)
+		}
+	}
+
+	if resp, err := a.ClaimConsignmentItem(id, false); err != nil || resp == nil {
+		t.Fatalf("claim: %x, %v", resp, err)
+	}
+	if a.Gold != 6000 {
+		t.Errorf("seller gold after claim: %d", a.Gold)
+	}
+	// the escrow row is gone, a second claim has nothing to pay out
+	if rows := h.Store.Rows("hops.consignment"); len(rows) != 0 {
+		t.Errorf("consignment rows left: %v", rows)
+	}
+	for _, row := range h.Store.Rows("hops.characters") {
+		if want := map[string]uint64{"Alice": a.Gold, "Bob": b.Gold, "Carol": c.Gold}[row["name"].(string)]; row["gold"] != int64(want) {
+			t.Errorf("gold of %s in the database: %v, want %d", row["name"], row["gold"], want)
+		}
+	}
+}
+
+// The ledger follows an item through a trade and the auditor reports a
+// copied slot and a stack that grew outside of the ledger.
+func TestItemLedger(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+	potion := &database.Item{ID: 300, Name: "Potion", Type: 80, UIF: "potion"}
+	h.DefineItem(sword)
+	h.DefineItem(potion)
+	database.Stackables[9999] = &database.Stackable{ID: 9999, UIF: potion.UIF}
+	t.Cleanup(func() { delete(database.Stackables, 9999) })
+
+	alice, bob := h.NewSession("10.0.0.1:50001"), h.NewSession("10.0.0.2:50002")
+	h.Login(alice, newUser("1", "alice"))
+	h.Login(bob, newUser("2", "bob"))
+
+	a := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1}, &utils.Location{X: 100, Y: 100})
+	b := h.AddCharacter(bob, &database.Character{Name: "Bob", Type: 54, Faction: 1, Gold: 10000}, &utils.Location{X: 102, Y: 100})
+	h.GiveItem(a, 11, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+	stack := h.GiveItem(b, 20, &database.InventorySlot{ItemID: potion.ID, Quantity: 10})
+	if stack.UID == "" {
+		t.Fatal("new item has no uid")
+	}
+
+	replay(t, "trade", map[string]*Session{"alice": alice, "bob": bob})
+
+	bSlots, _ := b.InventorySlots()
+	sword := bSlots[11]
+	events, err := database.FindItemEventsByUID(sword.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s %d %d->%d", e.Event, e.Quantity, e.FromCharacterID.Int64, e.ToCharacterID.Int64))
+	}
+	if want := []string{fmt.Sprintf("created 1 0->%d", a.ID), fmt.Sprintf("traded 0 %d->%d", a.ID, b.ID)}; strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("ledger of the sword: %v, want %v", got, want)
+	}
+
+	// a gm grant is one event, a shop purchase moves the item to the buyer
+	_, slotID, err := a.GrantItem(database.NewItemSlot(sword.ItemID, 1), -1, false, "gm")
+	if err != nil || slotID < 0 {
+		t.Fatalf("grant: %v", err)
+	}
+	aSlots, _ := a.InventorySlots()
+	granted, _ := database.FindItemEventsByUID(aSlots[slotID].UID)
+	if len(granted) != 1 || granted[0].Event != database.ITEM_GRANTED || granted[0].Quantity != 1 || granted[0].Note != "gm" {
+		t.Errorf("ledger of the granted sword: %+v", granted)
+	}
+	if _, err := b.OpenSale("shop", []int16{11}, []uint64{100}); err != nil {
+		t.Fatal(err)
+	}
+	for database.FindSale(b.PseudoID) == nil {
+		time.Sleep(time.Millisecond)
+	}
+	uid := sword.UID
+	if _, err := a.BuySaleItem(b.PseudoID, 0, 30); err != nil {
+		t.Fatal(err)
+	}
+	events, _ = database.FindItemEventsByUID(uid)
+	if last := events[len(events)-1]; last.Event != database.ITEM_BOUGHT || last.FromCharacterID.Int64 != int64(b.ID) || last.ToCharacterID.Int64 != int64(a.ID) || last.Note != "shop, price 100" {
+		t.Errorf("shop purchase: %+v", last)
+	}
+	database.FindSale(b.PseudoID).Delete()
+	sword = aSlots[30]
+
+	audit, err := database.AuditItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit.Duplicates) != 0 || len(audit.Divergences) != 0 {
+		t.Fatalf("clean game audited as %+v", audit)
+	}
+
+	// a copy of the sword in memory, then saved as a second row
+	*bSlots[12] = *sword
+	bSlots[12].SlotID = 12
+	if audit, _ := database.AuditItems(); len(audit.Duplicates) != 1 || !audit.Duplicates[0].Online || audit.Duplicates[0].UID != sword.UID {
+		t.Errorf("copy in memory not found: %+v", audit.Duplicates)
+	}
+	bSlots[12].ID = 0
+	if err := bSlots[12].Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if audit, _ := database.AuditItems(); len(audit.Duplicates) != 1 || audit.Duplicates[0].Online || audit.Duplicates[0].Copies != 2 {
+		t.Errorf("copy in the database not found: %+v", audit.Duplicates)
+	}
+
+	if h.Store.Exec(`update hops.items_characters set quantity = 15 where id = $1`, int64(stack.ID)) != 1 {
+		t.Fatal("could not change the potion stack")
+	}
+	audit, _ = database.AuditItems()
+	if len(audit.Divergences) != 1 || *audit.Divergences[0] != (database.StackDivergence{ItemID: potion.ID, InGame: 15, Ledger: 10}) {
+		t.Errorf("grown stack not found: %+v", audit.Divergences)
+	}
+}
+
+func TestBlacksmithUpgrade(t *testing.T) {
+	h := New(t)
+	h.DefineItem(sword)
+	h.DefineItem(stone)
+
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+	c := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, Gold: 10000}, &utils.Location{X: 100, Y: 100})
+
+	weapon := h.GiveItem(c, 11, &database.InventorySlot{ItemID: sword.ID, Quantity: 1})
+	for slot := int16(12); slot <= 14; slot++ {
+		h.GiveItem(c, slot, &database.InventorySlot{ItemID: stone.ID, Quantity: 1})
+	}
+
+	// three stones on a +0 item always succeed (3 x 400 permille)
+	replay(t, "blacksmith", map[string]*Session{"alice": alice})
+
+	if weapon.Plus != 1 || weapon.GetUpgrades()[0] != byte(stone.ID) {
+		t.Errorf("sword not upgraded: plus %d, upgrades %v", weapon.Plus, weapon.GetUpgrades())
+	}
+	if c.Gold != 10000-400 {
+		t.Errorf("upgrade should cost 400 gold, have %d", c.Gold)
+	}
+
+	slots, _ := c.InventorySlots()
+	for slot := 12; slot <= 14; slot++ {
+		if slots[slot].ItemID != 0 {
+			t.Errorf("stone in slot %d was not used", slot)
+		}
+	}
+}
+
+func TestQuest(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+	h.DefineItem(sword)
+	h.DefineItem(stone)
+
+	quests := database.Quests
+	database.Quests = map[int]*database.Quest{1: {ID: 1, Name: "Wolf Hunt", Gold: 500,
+		Objectives: []*database.QuestObjective{{Kind: database.QUEST_KILL, Target: 40101, Count: 2}, {Kind: database.QUEST_COLLECT, Target: int(stone.ID), Count: 3}},
+		Rewards:    []*database.QuestReward{{ItemID: sword.ID, Quantity: 1}},
+	}}
+	t.Cleanup(func() { database.Quests = quests })
+
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+	c := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, Gold: 1000}, &utils.Location{X: 100, Y: 100})
+
+	if database.CharacterHasQuest(c, 1) {
+		t.Fatal("on a quest that was not accepted")
+	}
+	if _, err := c.AcceptQuest(1); err != nil {
+		t.Fatal(err)
+	}
+	if !database.CharacterHasQuest(c, 1) || c.CanAcceptQuest(1) == nil {
+		t.Fatal("quest was not accepted")
+	}
+
+	c.AdvanceQuests(database.QUEST_KILL, 40101, 1)
+	if err := c.CanCompleteQuest(1); err == nil {
+		t.Fatal("quest can be turned in with objectives left")
+	}
+	if rows := h.Store.Rows("hops.characters_quests"); len(rows) != 1 || rows[0]["progress"] != "{0,0}" {
+		t.Fatalf("progress was written before the save: %v", rows)
+	}
+	database.SaveQuests()
+	if rows := h.Store.Rows("hops.characters_quests"); rows[0]["progress"] != "{1,0}" {
+		t.Fatalf("progress after the save: %v", rows)
+	}
+	c.AdvanceQuests(database.QUEST_KILL, 40101, 1)
+	c.AdvanceQuests(database.QUEST_KILL, 40101, 1)
+	for slot := int16(12); slot <= 14; slot++ {
+		h.GiveItem(c, slot, &database.InventorySlot{ItemID: stone.ID, Quantity: 1})
+	}
+
+	if _, err := c.CompleteQuest(1); err != nil {
+		t.Fatal(err)
+	}
+	rows := h.Store.Rows("hops.characters_quests")
+	if len(rows) != 1 || rows[0]["progress"] != "{2,3}" || rows[0]["completed"] != true {
+		t.Fatalf("quest progress: %v", rows)
+	}
+
+	slots, _ := c.InventorySlots()
+	for slot := 12; slot <= 14; slot++ {
+		if slots[slot].ItemID != 0 {
+			t.Errorf("collected stone in slot %d was not taken", slot)
+		}
+	}
+	if _, slot, _ := c.FindItemInInventory(nil, sword.ID); slot == nil || c.Gold != 1500 {
+		t.Errorf("rewards were not given: sword %v, gold %d", slot, c.Gold)
+	}
+	if database.CharacterHasQuest(c, 1) || c.CanAcceptQuest(1) == nil {
+		t.Error("completed quest that is not repeatable can be taken again")
+	}
+}
+
+func TestAchievement(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+
+	achievements, infections, exps := database.Achievements, database.BuffInfections, database.EXPs
+	database.Achievements = map[int]*database.Achievement{
+		1: {ID: 1, Name: "Beginning", Kind: database.ACHIEVEMENT_KILL, Target: 40101, Count: 3, Title: "Beginner", BuffID: 900, Announce: true},
+		2: {ID: 2, Name: "Grown Up", Kind: database.ACHIEVEMENT_LEVEL, Count: 10},
+	}
+	database.BuffInfections = map[int]*database.BuffInfection{900: {ID: 900, Name: "Beginner", BaseATK: 5}}
+	database.EXPs = map[int16]*database.ExpInfo{1: {Level: 1, Exp: 100}}
+	t.Cleanup(func() { database.Achievements, database.BuffInfections, database.EXPs = achievements, infections, exps })
+
+	alice := h.NewSession("10.0.0.1:50001")
+	h.Login(alice, newUser("1", "alice"))
+	c := h.AddCharacter(alice, &database.Character{Name: "Alice", Type: 53, Faction: 1, Level: 1}, &utils.Location{X: 100, Y: 100})
+
+	c.AdvanceAchievements(database.ACHIEVEMENT_KILL, 40102, 1) // another npc
+	c.AdvanceAchievements(database.ACHIEVEMENT_KILL, 40101, 2)
+	c.AdvanceAchievements(database.ACHIEVEMENT_LEVEL, 0, 7)
+	c.AdvanceAchievements(database.ACHIEVEMENT_LEVEL, 0, 1) // after a reborn
+
+	list, err := database.AchievementsOf(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].Progress != 2 || list[0].Completed || list[1].Progress != 7 {
+		t.Fatalf("progress: %+v %+v", list[0], list[1])
+	}
+	if rows := h.Store.Rows("hops.characters_achievements"); len(rows) != 0 {
+		t.Fatalf("progress was written before the save: %v", rows)
+	}
+	database.SaveAchievements()
+
+	if resp := c.AdvanceAchievements(database.ACHIEVEMENT_KILL, 40101, 5); len(resp) == 0 {
+		t.Fatal("completed achievement was not told")
+	}
+	rows := h.Store.Rows("hops.characters_achievements")
+	if len(rows) != 2 {
+		t.Fatalf("achievement rows: %v", rows)
+	}
+	for _, row := range rows {
+		if row["achievement_id"] == int64(1) && (row["progress"] != int64(3) || row["completed"] != true) {
+			t.Errorf("kill achievement: %v", row)
+		}
+	}
+	if buff, _ := database.FindBuffByID(900, c.ID); buff == nil || buff.ATK != 5 {
+		t.Errorf("reward buff: %+v", buff)
+	}
+	if resp := c.AdvanceAchievements(database.ACHIEVEMENT_KILL, 40101, 1); len(resp) != 0 {
+		t.Error("completed achievement was rewarded again")
+	}
+}
+
+func TestScheduledEventRecord(t *testing.T) {
+	h := New(t)
+	if h.Store == nil {
+		t.Skip("needs the in-memory store")
+	}
+
+	e := &database.ScheduledEvent{Name: "Guild war", Kind: database.EVENT_GUILD_WAR, Cron: "@daily", Timezone: "UTC", MinPlayers: 100}
+	if err := database.SaveScheduledEvent(e); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DeleteScheduledEvent(e.ID) })
+
+	// an edit saved while the event runs
+	h.Store.Exec(`update hops.scheduled_events set name = $1 where id = $2`, "Renamed", int64(e.ID))
+	if _, err := database.RunScheduledEvent(e.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := h.Store.Rows("hops.scheduled_events")
+	if len(rows) != 1 || rows[0]["name"] != "Renamed" || rows[0]["last_result"] != "skipped, 0 of 100 players online" {
+		t.Errorf("scheduled event: %v", rows)
+	}
+}
+
+func TestUnknownOpcode(t *testing.T) {
+	h := New(t)
+	s := h.NewSession("10.0.0.1:50001")
+
+	resp, err := s.Send([]byte{0xAA, 0x55, 0x02, 0x00, 0xFF, 0xFE, 0x55, 0xAA})
+	if resp != nil || err != nil {
+		t.Errorf("unknown opcode answered with %x, %v", resp, err)
+	}
+	if out := s.Written(); len(out) > 0 {
+		t.Errorf("unknown opcode wrote %x", out)
+	}
+}
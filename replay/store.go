@@ -0,0 +1,646 @@
+package replay
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const STORE_DRIVER = "replay-memstore"
+
+var (
+	stores     = make(map[string]*Store)
+	storeMutex sync.Mutex
+	storeSeq   int
+
+	insertRe = regexp.MustCompile(`(?is)^\s*insert\s+into\s+([\w."]+)\s*\((.*?)\)\s*values\s*\((.*)\)\s*(?:returning\s+"?(\w+)"?)?\s*;?\s*$`)
+	updateRe = regexp.MustCompile(`(?is)^\s*update\s+([\w."]+)\s+set\s+(.*?)\s+where\s+(.*?)\s*;?\s*$`)
+	deleteRe = regexp.MustCompile(`(?is)^\s*delete\s+from\s+([\w."]+)(?:\s+where\s+(.*?))?\s*;?\s*$`)
+	selectRe = regexp.MustCompile(`(?is)^\s*select\s+(.*?)\s+from\s+([\w."]+)(?:\s+where\s+(.*?))?(?:\s+group\s+by\s+"?(\w+)"?(?:\s+having\s+count\(\*\)\s*(>|>=|=)\s*(\d+))?)?(?:\s+order\s+by\s+[\w\s,."]+?)?(?:\s+limit\s+\d+)?(?:\s+for\s+update)?\s*;?\s*$`)
+	condRe   = regexp.MustCompile(`(?is)^\s*(lower\()?"?(\w+)"?\)?\s*(=|>=|<=|<>|!=|>|<)\s*(\$\d+|'[^']*'|[\w.\-]+)\s*$`)
+	andRe    = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+func init() {
+	sql.Register(STORE_DRIVER, &storeDriver{})
+}
+
+// Store is a small in-memory stand-in for postgres. It understands the
+// statements gorp generates (inserts, updates and deletes by key) and plain
+// selects with equality or range conditions joined by "and", optionally
+// grouped by one column. Anything else
+// is recorded and answered with an empty result, which the handlers treat as
+// "not found".
+type Store struct {
+	mutex      sync.Mutex
+	txMutex    sync.Mutex // transactions run one after another
+	tables     map[string]*table
+	statements []string
+	nextID     int64
+}
+
+type table struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+// NewStore registers a new empty store and opens a connection to it.
+func NewStore() (*Store, *sql.DB, error) {
+	storeMutex.Lock()
+	storeSeq++
+	name := fmt.Sprintf("store-%d", storeSeq)
+	store := &Store{tables: make(map[string]*table), nextID: 1}
+	stores[name] = store
+	storeMutex.Unlock()
+
+	conn, err := sql.Open(STORE_DRIVER, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("NewStore: %s", err.Error())
+	}
+	return store, conn, nil
+}
+
+// Statements returns the statements executed so far with collapsed
+// whitespace.
+func (s *Store) Statements() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.statements...)
+}
+
+// Count returns how many recorded statements contain all the given parts.
+func (s *Store) Count(parts ...string) int {
+	count := 0
+	for _, stmt := range s.Statements() {
+		matched := true
+		for _, part := range parts {
+			if !strings.Contains(stmt, part) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+// Rows returns a copy of the rows stored in the given table, e.g.
+// "hops.characters".
+func (s *Store) Rows(name string) []map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t := s.tables[tableName(name)]
+	if t == nil {
+		return nil
+	}
+
+	var rows []map[string]interface{}
+	for _, row := range t.rows {
+		r := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			r[k] = v
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// Exec runs a statement against the store outside of the handlers, e.g. to
+// change a row behind the server's back.
+func (s *Store) Exec(query string, args ...driver.Value) int64 {
+	_, affected := s.exec(query, args)
+	return affected
+}
+
+func (s *Store) snapshot() map[string]*table {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tables := make(map[string]*table, len(s.tables))
+	for name, t := range s.tables {
+		c := &table{columns: append([]string{}, t.columns...)}
+		for _, row := range t.rows {
+			r := make(map[string]driver.Value, len(row))
+			for k, v := range row {
+				r[k] = v
+			}
+			c.rows = append(c.rows, r)
+		}
+		tables[name] = c
+	}
+	return tables
+}
+
+func (s *Store) exec(query string, args []driver.Value) (*storeRows, int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.statements = append(s.statements, strings.Join(strings.Fields(query), " "))
+
+	if m := insertRe.FindStringSubmatch(query); m != nil {
+		return s.insert(m, args)
+	} else if m := updateRe.FindStringSubmatch(query); m != nil {
+		return nil, s.update(m, args)
+	} else if m := deleteRe.FindStringSubmatch(query); m != nil {
+		return nil, s.delete(m, args)
+	} else if m := selectRe.FindStringSubmatch(query); m != nil {
+		return s.selectRows(m, args), 0
+	}
+
+	return &storeRows{}, 0
+}
+
+func (s *Store) insert(m []string, args []driver.Value) (*storeRows, int64) {
+	columns := splitList(m[2])
+	values := splitList(m[3])
+	if len(columns) != len(values) {
+		return &storeRows{}, 0
+	}
+
+	name := tableName(m[1])
+	t := s.tables[name]
+	if t == nil {
+		t = &table{}
+		s.tables[name] = t
+	}
+
+	row := make(map[string]driver.Value, len(columns))
+	for i, column := range columns {
+		column = unquote(column)
+		if !contains(t.columns, column) {
+			t.columns = append(t.columns, column)
+		}
+
+		if strings.EqualFold(values[i], "default") {
+			row[column] = s.nextID
+			s.nextID++
+			continue
+		}
+		row[column] = value(values[i], args)
+	}
+	t.rows = append(t.rows, row)
+
+	if returning := m[4]; returning != "" {
+		return &storeRows{columns: []string{returning}, values: [][]driver.Value{{row[returning]}}}, 1
+	}
+	return &storeRows{}, 1
+}
+
+func (s *Store) update(m []string, args []driver.Value) int64 {
+	t := s.tables[tableName(m[1])]
+	if t == nil {
+		return 0
+	}
+
+	match, ok := conditions(m[3], args)
+	if !ok {
+		return 0
+	}
+
+	sets := make(map[string]driver.Value)
+	for _, set := range splitList(m[2]) {
+		parts := strings.SplitN(set, "=", 2)
+		if len(parts) != 2 {
+			return 0
+		}
+		sets[unquote(parts[0])] = value(strings.TrimSpace(parts[1]), args)
+	}
+
+	count := int64(0)
+	for _, row := range t.rows {
+		if !match(row) {
+			continue
+		}
+		for column, v := range sets {
+			row[column] = v
+		}
+		count++
+	}
+	return count
+}
+
+func (s *Store) delete(m []string, args []driver.Value) int64 {
+	t := s.tables[tableName(m[1])]
+	if t == nil {
+		return 0
+	}
+
+	match, ok := conditions(m[2], args)
+	if !ok {
+		return 0
+	}
+
+	var (
+		rows  []map[string]driver.Value
+		count int64
+	)
+	for _, row := range t.rows {
+		if match(row) {
+			count++
+			continue
+		}
+		rows = append(rows, row)
+	}
+	t.rows = rows
+	return count
+}
+
+func (s *Store) selectRows(m []string, args []driver.Value) *storeRows {
+	t := s.tables[tableName(m[2])]
+	if t == nil {
+		t = &table{}
+	}
+
+	match, ok := conditions(m[3], args)
+	if !ok {
+		return &storeRows{}
+	}
+
+	var found []map[string]driver.Value
+	for _, row := range t.rows {
+		if match(row) {
+			found = append(found, row)
+		}
+	}
+
+	fields := strings.TrimSpace(m[1])
+	if m[4] != "" {
+		return groupRows(found, fields, strings.ToLower(m[4]), m[5], value(m[6], nil))
+	}
+	if strings.EqualFold(fields, "count(*)") {
+		return &storeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(found))}}}
+	}
+
+	columns := t.columns
+	if fields != "*" {
+		columns = nil
+		for _, f := range splitList(fields) {
+			f = unquote(f)
+			if !contains(t.columns, f) {
+				return &storeRows{}
+			}
+			columns = append(columns, f)
+		}
+	}
+
+	rows := &storeRows{columns: columns}
+	for _, row := range found {
+		values := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows
+}
+
+// groupRows answers a select grouped by one column, the fields can be that
+// column, count(*) and sum(<column>), each optionally named with "as".
+func groupRows(found []map[string]driver.Value, fields, by, op string, limit driver.Value) *storeRows {
+	var (
+		keys   []string
+		groups = make(map[string][]map[string]driver.Value)
+	)
+	for _, row := range found {
+		key := fmt.Sprint(text(row[by]))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	var list []string
+	rows := &storeRows{}
+	for _, f := range splitList(fields) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		name := f
+		if i := strings.Index(f, " as "); i >= 0 {
+			f, name = strings.TrimSpace(f[:i]), f[i+4:]
+		}
+		list = append(list, f)
+		rows.columns = append(rows.columns, unquote(name))
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if op != "" && !compare(int64(len(group)), op, limit) {
+			continue
+		}
+
+		values := make([]driver.Value, len(list))
+		for i, f := range list {
+			switch {
+			case f == "count(*)":
+				values[i] = int64(len(group))
+			case strings.HasPrefix(f, "sum(") && strings.HasSuffix(f, ")"):
+				column := unquote(f[4 : len(f)-1])
+				sum := int64(0)
+				for _, row := range group {
+					n, _ := number(row[column])
+					sum += int64(n)
+				}
+				values[i] = sum
+			default:
+				values[i] = group[0][unquote(f)]
+			}
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows
+}
+
+// conditions builds a row filter from a where clause. It reports false for
+// clauses it does not understand.
+func conditions(where string, args []driver.Value) (func(map[string]driver.Value) bool, bool) {
+	where = strings.TrimSpace(where)
+	if where == "" {
+		return func(map[string]driver.Value) bool { return true }, true
+	}
+
+	type condition struct {
+		column, op string
+		lower      bool
+		value      driver.Value
+	}
+
+	var conds []condition
+	for _, part := range andRe.Split(where, -1) {
+		m := condRe.FindStringSubmatch(part)
+		if m == nil {
+			return nil, false
+		}
+		conds = append(conds, condition{column: strings.ToLower(m[2]), op: m[3], lower: m[1] != "", value: value(m[4], args)})
+	}
+
+	return func(row map[string]driver.Value) bool {
+		for _, c := range conds {
+			v := row[c.column]
+			if c.lower {
+				v = strings.ToLower(fmt.Sprint(text(v)))
+			}
+			if !compare(v, c.op, c.value) {
+				return false
+			}
+		}
+		return true
+	}, true
+}
+
+func compare(a driver.Value, op string, b driver.Value) bool {
+	var cmp int
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return false
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(fmt.Sprint(text(a)), fmt.Sprint(text(b)))
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0
+	case "<>", "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func number(v driver.Value) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func text(v driver.Value) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// value resolves a placeholder or a literal of a statement.
+func value(token string, args []driver.Value) driver.Value {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, "$") {
+		i, err := strconv.Atoi(token[1:])
+		if err != nil || i < 1 || i > len(args) {
+			return nil
+		}
+		return args[i-1]
+	}
+
+	if strings.HasPrefix(token, "'") {
+		return strings.Trim(token, "'")
+	}
+
+	switch strings.ToLower(token) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	case "now()":
+		return time.Now()
+	}
+
+	if i, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	return token
+}
+
+// splitList splits a comma separated list, ignoring commas inside quotes and
+// parentheses.
+func splitList(list string) []string {
+	var (
+		parts   []string
+		depth   int
+		quoted  bool
+		current strings.Builder
+	)
+
+	for _, r := range list {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+
+	if last := strings.TrimSpace(current.String()); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func tableName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, `"`, ""))
+}
+
+func unquote(column string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(column), `"`))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type storeDriver struct{}
+
+func (d *storeDriver) Open(name string) (driver.Conn, error) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	store, ok := stores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown store %s", name)
+	}
+	return &storeConn{store: store}, nil
+}
+
+type storeConn struct {
+	store *Store
+}
+
+func (c *storeConn) Prepare(query string) (driver.Stmt, error) {
+	return &storeStmt{store: c.store, query: query}, nil
+}
+
+func (c *storeConn) Close() error {
+	return nil
+}
+
+func (c *storeConn) Begin() (driver.Tx, error) {
+	c.store.txMutex.Lock()
+	return &storeTx{store: c.store, tables: c.store.snapshot()}, nil
+}
+
+// Transactions run one at a time, like they would with every row locked,
+// but statements outside of a transaction are not held back: a rollback
+// restores the tables as they were at the start of the transaction, writes
+// made outside of it included.
+type storeTx struct {
+	store  *Store
+	tables map[string]*table
+}
+
+func (tx *storeTx) Commit() error {
+	tx.store.txMutex.Unlock()
+	return nil
+}
+
+func (tx *storeTx) Rollback() error {
+	defer tx.store.txMutex.Unlock()
+
+	tx.store.mutex.Lock()
+	defer tx.store.mutex.Unlock()
+
+	tx.store.tables = tx.tables
+	tx.store.statements = append(tx.store.statements, "rollback")
+	return nil
+}
+
+type storeStmt struct {
+	store *Store
+	query string
+}
+
+func (s *storeStmt) Close() error {
+	return nil
+}
+
+func (s *storeStmt) NumInput() int {
+	return -1
+}
+
+func (s *storeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, affected := s.store.exec(s.query, args)
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *storeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, _ := s.store.exec(s.query, args)
+	if rows == nil {
+		rows = &storeRows{}
+	}
+	return rows, nil
+}
+
+type storeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *storeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *storeRows) Close() error {
+	return nil
+}
+
+func (r *storeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	for i, v := range r.values[0] {
+		if b, ok := v.([]byte); ok { // the handlers must not share memory with the store
+			v = append([]byte{}, b...)
+		}
+		dest[i] = v
+	}
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,187 @@
+package security
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"hero-server/config"
+)
+
+// VIOLATION_WINDOW is the period config.RateLimit.Violations are counted in.
+const VIOLATION_WINDOW = time.Minute
+
+var (
+	RemoteAddrsMutex sync.Mutex
+
+	violations      = make(map[string]*strikes)
+	violationsMutex sync.Mutex
+
+	now = time.Now
+)
+
+type strikes struct {
+	count int
+	since time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(l config.Limit) bool {
+	t := now()
+	if b.last.IsZero() {
+		b.tokens = float64(l.Burst)
+	} else {
+		b.tokens += t.Sub(b.last).Seconds() * l.Rate
+		if b.tokens > float64(l.Burst) {
+			b.tokens = float64(l.Burst)
+		}
+	}
+	b.last = t
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Limiter holds the token buckets of one connection. It is used by the read
+// loop of the connection only and is not safe for concurrent use.
+type Limiter struct {
+	opcodes map[uint16]*bucket
+	groups  map[byte]*bucket
+	def     bucket
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{opcodes: make(map[uint16]*bucket), groups: make(map[byte]*bucket)}
+}
+
+// Allow takes a token from the bucket of opcode and reports whether the
+// packet may be handled.
+func (l *Limiter) Allow(opcode uint16) bool {
+	cfg := &config.Default.RateLimit
+	if !cfg.Enabled {
+		return true
+	}
+
+	if limit, ok := cfg.Opcodes[opcode]; ok {
+		b := l.opcodes[opcode]
+		if b == nil {
+			b = &bucket{}
+			l.opcodes[opcode] = b
+		}
+		return b.take(limit)
+	}
+
+	group := byte(opcode / 256)
+	if limit, ok := cfg.OpcodeGroups[group]; ok {
+		b := l.groups[group]
+		if b == nil {
+			b = &bucket{}
+			l.groups[group] = b
+		}
+		return b.take(limit)
+	}
+
+	return l.def.take(cfg.Default)
+}
+
+// Violation counts a dropped packet for the ip and the user (if logged in).
+// When either reaches the configured number of violations in a minute the
+// ip is blocked and Violation returns true.
+func Violation(ip, userID string) bool {
+	cfg := &config.Default.RateLimit
+
+	keys := []string{"ip:" + ip}
+	if userID != "" {
+		keys = append(keys, "user:"+userID)
+	}
+
+	violationsMutex.Lock()
+	exceeded := false
+	t := now()
+	for _, key := range keys {
+		s := violations[key]
+		if s == nil || t.Sub(s.since) > VIOLATION_WINDOW {
+			s = &strikes{since: t}
+			violations[key] = s
+		}
+		s.count++
+		if s.count >= cfg.Violations {
+			exceeded = true
+		}
+	}
+	if exceeded {
+		for _, key := range keys {
+			delete(violations, key)
+		}
+	}
+	violationsMutex.Unlock()
+
+	if exceeded {
+		Block(ip, time.Duration(cfg.BlockDuration)*time.Second)
+	}
+	return exceeded
+}
+
+// Block refuses connections from ip for the given duration.
+func Block(ip string, d time.Duration) {
+	BannedIPsMutex.Lock()
+	defer BannedIPsMutex.Unlock()
+	BannedIPs[ip] = now().Add(d)
+}
+
+func IsBlocked(ip string) bool {
+	BannedIPsMutex.Lock()
+	defer BannedIPsMutex.Unlock()
+
+	until, ok := BannedIPs[ip]
+	if ok && now().After(until) {
+		delete(BannedIPs, ip)
+		return false
+	}
+	return ok
+}
+
+// OpenConnection registers a new connection of ip, it returns false if the
+// ip is blocked or has too many connections already.
+func OpenConnection(ip string) bool {
+	if IsBlocked(ip) {
+		return false
+	}
+
+	RemoteAddrsMutex.Lock()
+	defer RemoteAddrsMutex.Unlock()
+
+	max := config.Default.RateLimit.MaxConnectionsPerIP
+	if config.Default.RateLimit.Enabled && max > 0 && RemoteAddrs[ip] >= max {
+		return false
+	}
+	RemoteAddrs[ip]++
+	return true
+}
+
+func CloseConnection(ip string) {
+	RemoteAddrsMutex.Lock()
+	defer RemoteAddrsMutex.Unlock()
+
+	if RemoteAddrs[ip] <= 1 {
+		delete(RemoteAddrs, ip)
+	} else {
+		RemoteAddrs[ip]--
+	}
+}
+
+// IP returns the ip part of a host:port address.
+func IP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,112 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"hero-server/config"
+)
+
+func withClock(t *testing.T) *time.Time {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return &clock
+}
+
+func withRateLimit(t *testing.T, r config.RateLimit) {
+	old := config.Default.RateLimit
+	config.Default.RateLimit = r
+	t.Cleanup(func() { config.Default.RateLimit = old })
+}
+
+func TestLimiterRefillsTokens(t *testing.T) {
+	clock := withClock(t)
+	withRateLimit(t, config.RateLimit{
+		Enabled: true,
+		Default: config.Limit{Rate: 100, Burst: 100},
+		Opcodes: map[uint16]config.Limit{28929: {Rate: 2, Burst: 5}},
+	})
+
+	l := NewLimiter()
+	for i := 0; i < 5; i++ {
+		if !l.Allow(28929) {
+			t.Fatalf("packet %d of the burst was dropped", i+1)
+		}
+	}
+	if l.Allow(28929) {
+		t.Fatal("packet over the burst was allowed")
+	}
+	if !l.Allow(22785) {
+		t.Fatal("other opcodes must use their own bucket")
+	}
+
+	*clock = clock.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if !l.Allow(28929) {
+			t.Fatalf("refilled packet %d was dropped", i+1)
+		}
+	}
+	if l.Allow(28929) {
+		t.Fatal("more packets than the rate were allowed")
+	}
+}
+
+func TestLimiterOpcodeGroups(t *testing.T) {
+	withClock(t)
+	withRateLimit(t, config.RateLimit{
+		Enabled:      true,
+		Default:      config.Limit{Rate: 100, Burst: 100},
+		OpcodeGroups: map[byte]config.Limit{65: {Rate: 1, Burst: 2}},
+	})
+
+	l := NewLimiter()
+	if !l.Allow(65*256+1) || !l.Allow(65*256+7) {
+		t.Fatal("attack burst was dropped")
+	}
+	if l.Allow(65*256 + 3) {
+		t.Fatal("the opcode group must share one bucket")
+	}
+}
+
+func TestViolationsBlockIP(t *testing.T) {
+	clock := withClock(t)
+	withRateLimit(t, config.RateLimit{Enabled: true, Violations: 3, BlockDuration: 60})
+	t.Cleanup(func() {
+		delete(BannedIPs, "10.0.0.1")
+		delete(violations, "user:u1")
+	})
+
+	// the same user from another ip counts too
+	if Violation("10.0.0.2", "u1") || Violation("10.0.0.1", "u1") {
+		t.Fatal("blocked before reaching the limit")
+	}
+	if !Violation("10.0.0.1", "u1") {
+		t.Fatal("third violation did not block")
+	}
+	if !IsBlocked("10.0.0.1") || OpenConnection("10.0.0.1") {
+		t.Fatal("blocked ip can still connect")
+	}
+	delete(violations, "ip:10.0.0.2")
+
+	*clock = clock.Add(61 * time.Second)
+	if IsBlocked("10.0.0.1") {
+		t.Fatal("block did not expire")
+	}
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	withRateLimit(t, config.RateLimit{Enabled: true, MaxConnectionsPerIP: 2})
+	t.Cleanup(func() { delete(RemoteAddrs, "10.0.0.3") })
+
+	if !OpenConnection("10.0.0.3") || !OpenConnection("10.0.0.3") {
+		t.Fatal("connections under the limit were refused")
+	}
+	if OpenConnection("10.0.0.3") {
+		t.Fatal("third connection was accepted")
+	}
+	CloseConnection("10.0.0.3")
+	if !OpenConnection("10.0.0.3") {
+		t.Fatal("closed connection was not released")
+	}
+}
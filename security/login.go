@@ -0,0 +1,70 @@
+package security
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"hero-server/config"
+)
+
+var (
+	loginFailures      = make(map[string]*strikes)
+	loginFailuresMutex sync.Mutex
+)
+
+func loginKeys(username, ip string) (string, string) {
+	return "user:" + strings.ToLower(username), "ip:" + ip
+}
+
+// LoginAllowed reports whether the user name and the ip may try to log in,
+// both are locked for a while after too many failed attempts.
+func LoginAllowed(username, ip string) bool {
+	cfg := &config.Default.Auth
+	userKey, ipKey := loginKeys(username, ip)
+
+	loginFailuresMutex.Lock()
+	defer loginFailuresMutex.Unlock()
+	return !loginLocked(userKey, cfg.MaxLoginFailures) && !loginLocked(ipKey, cfg.MaxLoginFailuresPerIP)
+}
+
+func loginLocked(key string, max int) bool {
+	s := loginFailures[key]
+	if s == nil {
+		return false
+	}
+
+	lockout := time.Duration(config.Default.Auth.LoginLockout) * time.Second
+	if now().Sub(s.since) > lockout {
+		delete(loginFailures, key)
+		return false
+	}
+	return s.count >= max
+}
+
+func LoginFailed(username, ip string) {
+	userKey, ipKey := loginKeys(username, ip)
+	lockout := time.Duration(config.Default.Auth.LoginLockout) * time.Second
+
+	loginFailuresMutex.Lock()
+	defer loginFailuresMutex.Unlock()
+
+	t := now()
+	for _, key := range []string{userKey, ipKey} {
+		s := loginFailures[key]
+		if s == nil || t.Sub(s.since) > lockout {
+			s = &strikes{since: t}
+			loginFailures[key] = s
+		}
+		s.count++
+	}
+}
+
+// LoginSucceeded clears the failed attempts of the user name.
+func LoginSucceeded(username string) {
+	userKey, _ := loginKeys(username, "")
+
+	loginFailuresMutex.Lock()
+	defer loginFailuresMutex.Unlock()
+	delete(loginFailures, userKey)
+}
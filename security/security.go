@@ -7,11 +7,12 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 )
 
 var (
-	RemoteAddrs    = make(map[string]int)
-	BannedIPs      = make(map[string]int)
+	RemoteAddrs    = make(map[string]int)       // open connections per ip
+	BannedIPs      = make(map[string]time.Time) // blocked ips and the end of the block
 	BannedIPsMutex sync.RWMutex
 )
 
@@ -11,7 +11,7 @@ import (
 )
 
 var (
-	MapRegister    = make([]map[int16]map[uint16]interface{}, database.SERVER_COUNT+1)
+	MapRegister    = make([]map[int16]map[uint16]interface{}, database.MAX_SERVER+1)
 	mrMutex        sync.RWMutex
 	PlayerRegister = make(map[uint16]interface{}, database.SERVER_COUNT+1)
 	prMutex        sync.RWMutex
@@ -20,12 +20,12 @@ var (
 
 func init() {
 
-	for j := 0; j <= database.SERVER_COUNT; j++ {
+	for j := 0; j <= database.MAX_SERVER; j++ {
 		MapRegister[j] = make(map[int16]map[uint16]interface{})
 	}
 
 	for i := int16(1); i <= 255; i++ {
-		for j := 0; j <= database.SERVER_COUNT; j++ {
+		for j := 0; j <= database.MAX_SERVER; j++ {
 			MapRegister[j][i] = make(map[uint16]interface{})
 		}
 	}
@@ -71,6 +71,8 @@ func init() {
 	}
 
 	database.GenerateID = GenerateID
+	database.GenerateAIID = GenerateIDForAI
+	database.ClearMapRegister = ClearMapRegister
 	database.FindCharacterByPseudoID = FindCharacter
 	database.GeneratePetID = GenerateIDForPet
 
@@ -94,6 +96,14 @@ func GenerateID(character *database.Character) error {
 	return fmt.Errorf("all pseudo ids taken")
 }
 
+// Unregister frees a pseudo id right away, unlike RemoveFromRegister which
+// keeps it reserved for a while after logout.
+func Unregister(ID uint16) {
+	prMutex.Lock()
+	defer prMutex.Unlock()
+	delete(PlayerRegister, ID)
+}
+
 func GenerateIDForAI(AI *database.AI) {
 	mrMutex.Lock()
 	defer mrMutex.Unlock()
@@ -107,6 +117,14 @@ func GenerateIDForAI(AI *database.AI) {
 	}
 }
 
+// ClearMapRegister forgets the mobs, pets and npcs registered on a map of a
+// server.
+func ClearMapRegister(server int, mapID int16) {
+	mrMutex.Lock()
+	defer mrMutex.Unlock()
+	MapRegister[server][mapID] = make(map[uint16]interface{})
+}
+
 func GenerateIDForPet(owner *database.Character, pet *database.PetSlot) {
 	mrMutex.Lock()
 	defer mrMutex.Unlock()
@@ -0,0 +1,503 @@
+package web
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"hero-server/database"
+	"hero-server/metrics"
+	"hero-server/security"
+	"hero-server/server"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/guregu/null.v3"
+)
+
+type player struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	UserID  string `json:"user_id"`
+	Level   int    `json:"level"`
+	Map     int16  `json:"map"`
+	Faction int    `json:"faction"`
+}
+
+func listPlayers(ctx *gin.Context) {
+	characters, err := database.FindOnlineCharacters()
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+
+	players := make([]player, 0, len(characters))
+	for _, c := range characters {
+		players = append(players, player{ID: c.ID, Name: c.Name, UserID: c.UserID, Level: c.Level, Map: c.Map, Faction: c.Faction})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	ctx.JSON(200, gin.H{"players": players})
+}
+
+func findUser(ctx *gin.Context) *database.User {
+	user, err := database.FindUserByID(ctx.Param("id"))
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return nil
+	} else if user == nil {
+		fail(ctx, 404, "user not found")
+		return nil
+	}
+	return user
+}
+
+func kickUser(ctx *gin.Context) {
+	user := findUser(ctx)
+	if user == nil {
+		return
+	}
+
+	s := database.GetSocket(user.ID)
+	if s != nil {
+		s.Conn.Close()
+	}
+	ctx.JSON(200, gin.H{"status": s != nil})
+}
+
+func banUser(ctx *gin.Context) {
+	var req struct {
+		Hours int64 `json:"hours"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Hours <= 0 {
+		fail(ctx, 400, "hours must be a positive number")
+		return
+	}
+
+	user := findUser(ctx)
+	if user == nil {
+		return
+	}
+
+	user.UserType = server.BANNED_USER
+	user.DisabledUntil = null.NewTime(time.Now().Add(time.Hour*time.Duration(req.Hours)), true)
+	if err := user.Update(); err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+
+	if s := database.GetSocket(user.ID); s != nil {
+		s.Conn.Close()
+	}
+	ctx.JSON(200, gin.H{"status": true, "disabled_until": user.DisabledUntil.Time})
+}
+
+func unbanUser(ctx *gin.Context) {
+	user := findUser(ctx)
+	if user == nil {
+		return
+	}
+
+	user.UserType = server.COMMON_USER
+	user.DisabledUntil = null.NewTime(time.Now().Add(time.Minute*time.Duration(-1)), true)
+	if err := user.Update(); err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+func muteUser(ctx *gin.Context) {
+	user := findUser(ctx)
+	if user == nil {
+		return
+	}
+
+	server.MutedPlayers.Set(user.ID, struct{}{})
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+func unmuteUser(ctx *gin.Context) {
+	user := findUser(ctx)
+	if user == nil {
+		return
+	}
+
+	server.MutedPlayers.Remove(user.ID)
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+func kickIP(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{"status": database.CloseSocket(ctx.Param("ip"))})
+}
+
+func unblockIP(ctx *gin.Context) {
+	security.BannedIPsMutex.Lock()
+	delete(security.BannedIPs, ctx.Param("ip"))
+	security.BannedIPsMutex.Unlock()
+
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+// findOnlineCharacter returns the character of the id param, items and gold
+// are only given to online characters so the client is updated right away.
+func findOnlineCharacter(ctx *gin.Context) *database.Character {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		fail(ctx, 400, "invalid character id")
+		return nil
+	}
+
+	c, err := database.FindCharacterByID(id)
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return nil
+	} else if c == nil {
+		fail(ctx, 404, "character not found")
+		return nil
+	} else if !c.IsOnline || c.Socket == nil {
+		fail(ctx, 409, "character is not online")
+		return nil
+	}
+	return c
+}
+
+func giveItem(ctx *gin.Context) {
+	var req struct {
+		ItemID   int64 `json:"item_id"`
+		Quantity uint  `json:"quantity"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Quantity == 0 {
+		fail(ctx, 400, "item_id and a positive quantity are required")
+		return
+	} else if database.FindItem(req.ItemID) == nil {
+		fail(ctx, 400, "unknown item")
+		return
+	}
+
+	c := findOnlineCharacter(ctx)
+	if c == nil {
+		return
+	}
+
+	r, slotID, err := c.GrantItem(database.NewItemSlot(req.ItemID, req.Quantity), -1, false, "api:"+ctx.GetString("token"))
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	} else if r == nil {
+		fail(ctx, 409, "inventory is full")
+		return
+	}
+
+	c.Socket.Write(*r)
+	ctx.JSON(200, gin.H{"status": true, "slot_id": slotID})
+}
+
+func giveGold(ctx *gin.Context) {
+	var req struct {
+		Amount uint64 `json:"amount"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Amount == 0 {
+		fail(ctx, 400, "amount must be a positive number")
+		return
+	}
+
+	c := findOnlineCharacter(ctx)
+	if c == nil {
+		return
+	}
+
+	c.Socket.Write(c.LootGold(req.Amount))
+	database.GoldCreated.Add(float64(req.Amount), "api")
+	ctx.JSON(200, gin.H{"status": true, "gold": c.Gold})
+}
+
+func itemLedger(ctx *gin.Context) {
+	events, err := database.FindItemEventsByUID(ctx.Param("uid"))
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	} else if len(events) == 0 {
+		fail(ctx, 404, "item not found")
+		return
+	}
+	ctx.JSON(200, gin.H{"events": events})
+}
+
+// characterAchievements lists the achievements of a character, online or not.
+func characterAchievements(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		fail(ctx, 400, "invalid character id")
+		return
+	}
+
+	c, err := database.FindCharacterByID(id)
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	} else if c == nil {
+		fail(ctx, 404, "character not found")
+		return
+	}
+
+	achievements, err := database.AchievementsOf(c.ID)
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+	ctx.JSON(200, gin.H{"character": c.Name, "achievements": achievements})
+}
+
+func listSuspicions(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{"suspicions": database.Suspicions()})
+}
+
+func lastItemAudit(ctx *gin.Context) {
+	audit := database.LastItemAudit()
+	if audit == nil {
+		fail(ctx, 404, "no audit has run yet")
+		return
+	}
+	ctx.JSON(200, audit)
+}
+
+func auditItems(ctx *gin.Context) {
+	audit, err := database.AuditItems()
+	if err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+	ctx.JSON(200, audit)
+}
+
+func serveMetrics(ctx *gin.Context) {
+	ctx.Header("Content-Type", metrics.CONTENT_TYPE)
+	ctx.Status(200)
+	metrics.Write(ctx.Writer)
+}
+
+func getRates(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{"exp": database.ExpRate(), "drop": database.DropRate()})
+}
+
+// setRates changes the rates that are given, with minutes set they go back
+// to the configured rates afterwards.
+func setRates(ctx *gin.Context) {
+	var req struct {
+		Exp     float64 `json:"exp"`
+		Drop    float64 `json:"drop"`
+		Minutes int64   `json:"minutes"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Exp < 0 || req.Drop < 0 || req.Minutes < 0 || (req.Exp == 0 && req.Drop == 0) {
+		fail(ctx, 400, "exp or drop must be a positive number")
+		return
+	}
+
+	database.SetRates(req.Exp, req.Drop, req.Minutes)
+	getRates(ctx)
+}
+
+func announce(ctx *gin.Context) {
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Message == "" {
+		fail(ctx, 400, "message is required")
+		return
+	}
+
+	database.MakeAnnouncement(req.Message)
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+// warKinds are the battleground kinds by the type of the wars api.
+var warKinds = map[string]string{
+	"great":        database.BATTLEGROUND_WAR,
+	"divine":       database.BATTLEGROUND_WAR,
+	"faction":      database.BATTLEGROUND_FACTION_WAR,
+	"last_man":     database.BATTLEGROUND_LAST_MAN,
+	"golden_basin": database.BATTLEGROUND_GOLDEN_BASIN,
+	"guild_war":    database.BATTLEGROUND_GUILD_WAR,
+}
+
+// startWar starts the countdown of a war, type is "great", "divine",
+// "faction", "last_man", "golden_basin" or "guild_war". Without a countdown
+// or duration the defaults of the battleground are used.
+func startWar(ctx *gin.Context) {
+	var req struct {
+		Type      string `json:"type"`
+		Countdown int    `json:"countdown"` // seconds
+		Duration  int    `json:"duration"`  // seconds
+		MinLevel  int    `json:"min_level"`
+		MaxLevel  int    `json:"max_level"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		fail(ctx, 400, err.Error())
+		return
+	}
+
+	kind, ok := warKinds[req.Type]
+	if !ok {
+		fail(ctx, 400, "type must be great, divine, faction, last_man, golden_basin or guild_war")
+		return
+	} else if req.Countdown < 0 || req.Duration < 0 {
+		fail(ctx, 400, "countdown and duration can not be negative")
+		return
+	} else if req.Type == "faction" && (req.MinLevel <= 0 || req.MaxLevel < req.MinLevel) {
+		fail(ctx, 400, "invalid level range")
+		return
+	}
+
+	options := database.BattlegroundOptions{Countdown: req.Countdown, Duration: req.Duration, Divine: req.Type == "divine"}
+	if req.Type == "faction" {
+		options.MinLevel, options.MaxLevel = req.MinLevel, req.MaxLevel
+	}
+	b, err := database.StartBattleground(kind, options)
+	if err != nil {
+		fail(ctx, 409, err.Error())
+		return
+	}
+
+	ctx.JSON(200, b.Info())
+}
+
+// stopWar cancels a war before it starts or ends it early with its result.
+func stopWar(ctx *gin.Context) {
+	kind, ok := warKinds[ctx.Param("type")]
+	if !ok {
+		fail(ctx, 400, "type must be great, faction or last_man")
+		return
+	}
+
+	if !database.StopBattleground(kind) {
+		fail(ctx, 409, "no war is running")
+		return
+	}
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+func listBattlegrounds(ctx *gin.Context) {
+	list := []*database.BattlegroundInfo{}
+	for _, b := range database.Battlegrounds() {
+		list = append(list, b.Info())
+	}
+	ctx.JSON(200, list)
+}
+
+func reloadTable(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if _, ok := database.RELOADABLE_TABLES[name]; !ok {
+		fail(ctx, 404, "unknown table")
+		return
+	}
+
+	diff, err := database.ReloadTable(name)
+	if err != nil {
+		fail(ctx, 422, err.Error())
+		return
+	}
+	ctx.JSON(200, gin.H{"status": true, "diff": diff})
+}
+
+type scheduledEvent struct {
+	*database.ScheduledEvent
+	Next []time.Time `json:"next"`
+}
+
+// listEvents lists the scheduled events with their next runs, ?next= of
+// them (3 by default).
+func listEvents(ctx *gin.Context) {
+	n, err := strconv.Atoi(ctx.DefaultQuery("next", "3"))
+	if err != nil || n < 0 || n > 50 {
+		fail(ctx, 400, "next must be a number from 0 to 50")
+		return
+	}
+
+	events := []scheduledEvent{}
+	for _, e := range database.ScheduledEvents() {
+		events = append(events, scheduledEvent{e, e.NextRuns(time.Now(), n)})
+	}
+	ctx.JSON(200, gin.H{"events": events})
+}
+
+func createEvent(ctx *gin.Context) {
+	e := &database.ScheduledEvent{Enabled: true}
+	if err := ctx.ShouldBindJSON(e); err != nil {
+		fail(ctx, 400, err.Error())
+		return
+	}
+	e.ID, e.LastRun, e.LastResult = 0, null.Time{}, ""
+	saveEvent(ctx, e)
+}
+
+// updateEvent changes the fields of an event that are in the body.
+func updateEvent(ctx *gin.Context) {
+	e := findEvent(ctx)
+	if e == nil {
+		return
+	}
+
+	update := *e
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		fail(ctx, 400, err.Error())
+		return
+	}
+	update.ID = e.ID
+	saveEvent(ctx, &update)
+}
+
+func saveEvent(ctx *gin.Context, e *database.ScheduledEvent) {
+	if err := e.Parse(); err != nil {
+		fail(ctx, 400, err.Error())
+		return
+	}
+	if err := database.SaveScheduledEvent(e); err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+	ctx.JSON(200, scheduledEvent{e, e.NextRuns(time.Now(), 3)})
+}
+
+func deleteEvent(ctx *gin.Context) {
+	e := findEvent(ctx)
+	if e == nil {
+		return
+	}
+
+	if _, err := database.DeleteScheduledEvent(e.ID); err != nil {
+		fail(ctx, 500, err.Error())
+		return
+	}
+	ctx.JSON(200, gin.H{"status": true})
+}
+
+// runEvent starts an event now, outside of its schedule.
+func runEvent(ctx *gin.Context) {
+	e := findEvent(ctx)
+	if e == nil {
+		return
+	}
+
+	result, err := database.RunScheduledEvent(e.ID)
+	if err != nil {
+		fail(ctx, 422, err.Error())
+		return
+	}
+	ctx.JSON(200, gin.H{"status": true, "result": result})
+}
+
+func findEvent(ctx *gin.Context) *database.ScheduledEvent {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		fail(ctx, 400, "invalid event id")
+		return nil
+	}
+
+	e := database.FindScheduledEvent(id)
+	if e == nil {
+		fail(ctx, 404, "event not found")
+	}
+	return e
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"hero-server/config"
+	"hero-server/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MAX_AUDIT_BODY is the number of request body bytes kept in the audit log.
+const MAX_AUDIT_BODY = 1024
+
+// emit writes the audit entries to the event log, tests replace it.
+var emit = logging.Emit
+
+// auditEntry is the message of an admin_api event.
+type auditEntry struct {
+	Token  string `json:"token,omitempty"`
+	IP     string `json:"ip"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// audit writes the call to the event log once it has been handled, rejected
+// calls included.
+func audit(ctx *gin.Context) {
+	var body []byte
+	if ctx.Request.Body != nil {
+		body, _ = ioutil.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if len(body) > MAX_AUDIT_BODY {
+		body = body[:MAX_AUDIT_BODY]
+	}
+
+	ctx.Next()
+
+	entry := &auditEntry{
+		Token:  ctx.GetString("token"),
+		IP:     ctx.ClientIP(),
+		Method: ctx.Request.Method,
+		Path:   ctx.Request.URL.Path,
+		Body:   string(body),
+		Status: ctx.Writer.Status(),
+		Error:  ctx.GetString("error"),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Println("Audit log error:", err)
+		return
+	}
+
+	emit(&logging.Event{Action: logging.ACTION_ADMIN_API, Message: string(data)})
+}
+
+// authenticate looks up the bearer token of the request in config.Web.Tokens.
+func authenticate(ctx *gin.Context) {
+	header := ctx.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		fail(ctx, 401, "missing bearer token")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(header, "Bearer ")))
+	for name, token := range config.Default.Web.Tokens {
+		want, err := hex.DecodeString(token.SHA256)
+		if err != nil || subtle.ConstantTimeCompare(sum[:], want) != 1 {
+			continue
+		}
+
+		ctx.Set("token", name)
+		ctx.Set("scopes", token.Scopes)
+		ctx.Next()
+		return
+	}
+
+	fail(ctx, 401, "invalid token")
+}
+
+// scope rejects tokens without the given scope.
+func scope(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scopes, _ := ctx.Get("scopes")
+		for _, s := range scopes.([]string) {
+			if s == name {
+				ctx.Next()
+				return
+			}
+		}
+		fail(ctx, 403, "token does not have the "+name+" scope")
+	}
+}
+
+// fail aborts the call with the message, which is also written to the audit
+// log.
+func fail(ctx *gin.Context, status int, msg string) {
+	ctx.Set("error", msg)
+	ctx.AbortWithStatusJSON(status, gin.H{"error": msg})
+}
@@ -1,64 +1,64 @@
 package web
 
 import (
+	"context"
 	"fmt"
-	"hero-server/database"
-	"hero-server/security"
+	"net/http"
+	"strconv"
+
+	"hero-server/config"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func dcPlayer(ctx *gin.Context) {
-	securityKey := ctx.Request.FormValue("key")
-	playerIP := ctx.Request.FormValue("ip")
-
-	if securityKey == "" && playerIP == "" {
-		ctx.JSON(200, gin.H{
-			"status": false,
-		})
-		return
-	}
-
-	if securityKey != "BBBB" {
-		ctx.JSON(200, gin.H{
-			"status": false,
-		})
-		return
-	}
-
-	val := database.CloseSocket(playerIP)
-
-	ctx.JSON(200, gin.H{
-		"status": val,
-	})
-}
-
-func removeIP(ctx *gin.Context) {
-	securityKey := ctx.Request.FormValue("key")
-	playerIP := ctx.Request.FormValue("ip")
-
-	if securityKey == "" && playerIP == "" {
-		ctx.JSON(200, gin.H{
-			"status": false,
-		})
-		return
-	}
+var httpServer *http.Server
 
-	if securityKey != "BBBB" {
-		ctx.JSON(200, gin.H{
-			"status": false,
-		})
-		return
+// newRouter registers the admin api. Every route needs a token from
+// config.Web.Tokens with the scope of the route, see README.
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	if err := router.SetTrustedProxies(config.Default.Web.TrustedProxies); err != nil {
+		fmt.Println("Trusted proxies error:", err)
 	}
 
-	security.BannedIPsMutex.Lock()
-	delete(security.BannedIPs, playerIP)
-	security.BannedIPsMutex.Unlock()
-
-	ctx.JSON(200, gin.H{
-		"status": true,
-	})
+	// scraped too often to be audited
+	router.GET("/metrics", authenticate, scope(config.SCOPE_READ), serveMetrics)
+
+	v1 := router.Group("/api/v1", audit, authenticate)
+
+	v1.GET("/players", scope(config.SCOPE_READ), listPlayers)
+	v1.GET("/rates", scope(config.SCOPE_READ), getRates)
+	v1.GET("/items/:uid/ledger", scope(config.SCOPE_READ), itemLedger)
+	v1.GET("/items/audit", scope(config.SCOPE_READ), lastItemAudit)
+	v1.GET("/characters/:id/achievements", scope(config.SCOPE_READ), characterAchievements)
+	v1.GET("/suspicions", scope(config.SCOPE_READ), listSuspicions)
+	v1.GET("/events", scope(config.SCOPE_READ), listEvents)
+	v1.GET("/battlegrounds", scope(config.SCOPE_READ), listBattlegrounds)
+
+	v1.POST("/users/:id/kick", scope(config.SCOPE_MODERATE), kickUser)
+	v1.POST("/users/:id/ban", scope(config.SCOPE_MODERATE), banUser)
+	v1.POST("/users/:id/unban", scope(config.SCOPE_MODERATE), unbanUser)
+	v1.POST("/users/:id/mute", scope(config.SCOPE_MODERATE), muteUser)
+	v1.POST("/users/:id/unmute", scope(config.SCOPE_MODERATE), unmuteUser)
+	v1.POST("/ips/:ip/kick", scope(config.SCOPE_MODERATE), kickIP)
+	v1.DELETE("/ips/:ip/block", scope(config.SCOPE_MODERATE), unblockIP)
+
+	v1.POST("/characters/:id/items", scope(config.SCOPE_ECONOMY), giveItem)
+	v1.POST("/characters/:id/gold", scope(config.SCOPE_ECONOMY), giveGold)
+	v1.POST("/items/audit", scope(config.SCOPE_ECONOMY), auditItems)
+
+	v1.PUT("/rates", scope(config.SCOPE_SERVER), setRates)
+	v1.POST("/announcements", scope(config.SCOPE_SERVER), announce)
+	v1.POST("/wars", scope(config.SCOPE_SERVER), startWar)
+	v1.DELETE("/wars/:type", scope(config.SCOPE_SERVER), stopWar)
+	v1.POST("/events", scope(config.SCOPE_SERVER), createEvent)
+	v1.PUT("/events/:id", scope(config.SCOPE_SERVER), updateEvent)
+	v1.DELETE("/events/:id", scope(config.SCOPE_SERVER), deleteEvent)
+	v1.POST("/events/:id/run", scope(config.SCOPE_SERVER), runEvent)
+	v1.POST("/tables/:name/reload", scope(config.SCOPE_SERVER), reloadTable)
+
+	return router
 }
 
 func StartWebServer() {
@@ -68,13 +68,18 @@ func StartWebServer() {
 	}()
 
 	gin.SetMode(gin.ReleaseMode)
-	Router := gin.New()
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"*"}
 
-	Router.POST("/remove-ip", removeIP)
-	Router.POST("/dc", dcPlayer)
-	Router.Run(":4444")
+	httpServer = &http.Server{Addr: ":" + strconv.Itoa(config.Default.Web.Port), Handler: newRouter()}
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Println("Web server error:", err)
+	}
+}
+
+func StopWebServer(ctx context.Context) error {
+	if httpServer == nil {
+		return nil
+	}
+	return httpServer.Shutdown(ctx)
 }
 
 /*
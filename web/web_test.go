@@ -0,0 +1,163 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hero-server/config"
+	"hero-server/database"
+	"hero-server/logging"
+)
+
+func setup(t *testing.T) (*bytes.Buffer, http.Handler) {
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+
+	tokens := config.Default.Web.Tokens
+	config.Default.Web.Tokens = map[string]config.Token{
+		"ops":    {SHA256: hash("ops-secret"), Scopes: []string{config.SCOPE_READ, config.SCOPE_SERVER}},
+		"viewer": {SHA256: hash("viewer-secret"), Scopes: []string{config.SCOPE_READ}},
+	}
+
+	buf := &bytes.Buffer{}
+	emit = func(e *logging.Event) {
+		buf.WriteString(e.Message + "\n")
+	}
+
+	exp, drop := database.ExpRate(), database.DropRate()
+	t.Cleanup(func() {
+		config.Default.Web.Tokens = tokens
+		emit = logging.Emit
+		database.SetRates(exp, drop, 0)
+	})
+	return buf, newRouter()
+}
+
+func call(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	_, h := setup(t)
+
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/api/v1/rates", "", 401},
+		{"GET", "/api/v1/rates", "wrong", 401},
+		{"GET", "/api/v1/rates", "viewer-secret", 200},
+		{"PUT", "/api/v1/rates", "viewer-secret", 403},
+		{"POST", "/api/v1/characters/1/gold", "ops-secret", 403},
+		{"GET", "/metrics", "", 401},
+		{"GET", "/metrics", "viewer-secret", 200},
+	}
+	for _, test := range tests {
+		if w := call(h, test.method, test.path, test.token, `{"exp": 2}`); w.Code != test.want {
+			t.Errorf("%s %s with %q: got %d, want %d", test.method, test.path, test.token, w.Code, test.want)
+		}
+	}
+}
+
+func TestAuditIP(t *testing.T) {
+	buf, h := setup(t)
+
+	req := httptest.NewRequest("GET", "/api/v1/rates", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	req.Header.Set("Authorization", "Bearer viewer-secret")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e auditEntry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.IP != "192.0.2.1" {
+		t.Errorf("audit ip is %s, want the connection address 192.0.2.1", e.IP)
+	}
+}
+
+func TestSetRates(t *testing.T) {
+	buf, h := setup(t)
+
+	w := call(h, "PUT", "/api/v1/rates", "ops-secret", `{"exp": 2.5}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if rate := database.ExpRate(); rate != 2.5 {
+		t.Fatalf("exp rate is %v, want 2.5", rate)
+	}
+
+	if w := call(h, "PUT", "/api/v1/rates", "ops-secret", `{"exp": -1}`); w.Code != 400 {
+		t.Fatalf("negative rate: got %d, want 400", w.Code)
+	}
+
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e auditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Token != "ops" || e.Method != "PUT" || e.Body != `{"exp": 2.5}` || e.Status != 200 {
+		t.Errorf("got %+v", e)
+	}
+	if e := entries[1]; e.Status != 400 || e.Error == "" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	buf, h := setup(t)
+
+	w := call(h, "GET", "/metrics", "viewer-secret", "")
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, name := range []string{"hero_sockets", "hero_online_characters", "hero_handler_panics_total", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), "# TYPE "+name+" ") {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("scrape was audited: %s", buf)
+	}
+}
+
+func TestCreateEventValidation(t *testing.T) {
+	_, h := setup(t)
+
+	bodies := []string{
+		`{"name": "war", "kind": "war", "cron": "0 22 * *", "timezone": "Asia/Shanghai"}`,
+		`{"name": "war", "kind": "war", "cron": "0 22 * * *", "timezone": "Mars/Olympus"}`,
+		`{"name": "faction", "kind": "faction_war", "cron": "0 20 * * 6", "timezone": "UTC", "min_level": 50}`,
+		`{"name": "boss", "kind": "boss", "cron": "@daily", "timezone": "UTC"}`,
+	}
+	for _, body := range bodies {
+		if w := call(h, "POST", "/api/v1/events", "ops-secret", body); w.Code != 400 {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+	if w := call(h, "GET", "/api/v1/events?next=3", "viewer-secret", ""); w.Code != 200 {
+		t.Errorf("list: got %d", w.Code)
+	}
+}